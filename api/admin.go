@@ -0,0 +1,156 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+)
+
+/*
+requireAdmin only lets the request through when the X-Admin-Key header matches
+the admin key from config.json. If no key is configured the admin endpoints
+are disabled altogether instead of being left open. Requests already authenticated
+by apiKeyScope are let through as well, it has checked the key's scope.
+*/
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestAPIKey(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := r.Header.Get("X-Admin-Key")
+		adminKey := s.settings().AdminKey
+		if adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+/*
+parseAnalyticsQuery reads the startDate, endDate and limit parameters shared by
+all the analytics endpoints. On failure it has already written the error
+response and returns ok = false.
+*/
+func (s *Server) parseAnalyticsQuery(w http.ResponseWriter, r *http.Request) (startDate time.Time, endDate time.Time, limit int, ok bool) {
+	var query struct {
+		StartDate time.Time `param:"startDate,required"`
+		EndDate   time.Time `param:"endDate,required"`
+		Limit     int       `param:"limit,min=1"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	startDate, endDate, limit = query.StartDate, query.EndDate, query.Limit
+	if endDate.Before(startDate) || endDate.Sub(startDate) > 366*24*time.Hour {
+		http.Error(w, "Date range must be between 0 and 366 days", http.StatusBadRequest)
+		return
+	}
+	if limit == 0 {
+		limit = 5
+	}
+	return startDate, endDate, limit, true
+}
+
+// roomRows writes the rows of a room utilization table
+func roomRows(rooms []db.RoomUtilization) func(add func(values ...interface{}) error) error {
+	return func(add func(values ...interface{}) error) error {
+		for _, room := range rooms {
+			if err := add(room.Class, room.Occupied, room.Total, room.Percentage); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// searchRows writes the rows of a search count table
+func searchRows(counts []db.SearchCount) func(add func(values ...interface{}) error) error {
+	return func(add func(values ...interface{}) error) error {
+		for _, count := range counts {
+			if err := add(count.Key, count.Count); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Every search made in the date range, oldest first, streamed as they are read; limit does not apply
+func (s *Server) searchEventsHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, _, ok := s.parseAnalyticsQuery(w, r)
+	if !ok {
+		return
+	}
+	stream := newJSONStream(w)
+	err := s.repo.EachSearchEvent(startDate, endDate, func(event db.SearchEvent) error {
+		return stream.add(event)
+	})
+	s.endStream(stream, err)
+}
+
+// Room and slot utilization; format=csv or xlsx downloads it, see writeReport
+func (s *Server) utilizationHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, limit, ok := s.parseAnalyticsQuery(w, r)
+	if !ok {
+		return
+	}
+	format, ok := parseReportFormat(w, r)
+	if !ok {
+		return
+	}
+	utilization, err := s.repo.GetUtilization(startDate, endDate, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format != "json" {
+		roomColumns := []string{"class", "occupied", "total", "percentage"}
+		s.writeReport(w, r, format, "utilization", []reportTable{
+			{"rooms", roomColumns, roomRows(utilization.Rooms)},
+			{"peakHours", []string{"slot", "start", "end", "occupied", "total", "percentage"},
+				func(add func(values ...interface{}) error) error {
+					for _, slot := range utilization.PeakHours {
+						if err := add(slot.Slot, slot.Start, slot.End, slot.Occupied, slot.Total, slot.Percentage); err != nil {
+							return err
+						}
+					}
+					return nil
+				}},
+			{"leastUsed", roomColumns, roomRows(utilization.LeastUsed)},
+		})
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, utilization)
+}
+
+// What people search for; format=csv or xlsx downloads it, see writeReport
+func (s *Server) searchStatsHandler(w http.ResponseWriter, r *http.Request) {
+	startDate, endDate, limit, ok := s.parseAnalyticsQuery(w, r)
+	if !ok {
+		return
+	}
+	format, ok := parseReportFormat(w, r)
+	if !ok {
+		return
+	}
+	stats, err := s.repo.GetSearchStats(startDate, endDate, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format != "json" {
+		columns := []string{"key", "count"}
+		s.writeReport(w, r, format, "searches", []reportTable{
+			{"kinds", columns, searchRows(stats.Kinds)},
+			{"rooms", columns, searchRows(stats.Rooms)},
+			{"slots", columns, searchRows(stats.Slots)},
+			{"days", columns, searchRows(stats.Days)},
+		})
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, stats)
+}
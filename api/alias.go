@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// How long the room names are used before being read again, so rooms added to the timetable show up
+const roomNamesTTL = time.Minute
+
+// Longest accepted alias, normalized, in bytes
+const maxAliasLength = 64
+
+// The parameters naming a classroom, in the path or the query
+var roomParams = []string{"class", "room", "newClass", "home"}
+
+// The classrooms and their aliases, to find the classroom a name means
+type roomNames struct {
+	mu       sync.Mutex
+	classes  map[string]bool
+	aliases  map[string]string
+	byKey    map[string]string
+	loadedAt time.Time
+}
+
+/*
+canonicalRoom returns the ID of the classroom name means: the classroom of
+that ID, the one an alias names, or the one whose ID is the same once
+normalized, in that order. Other names come back as they are.
+*/
+func (s *Server) canonicalRoom(name string) string {
+	if name == "" {
+		return name
+	}
+	names := s.roomNames
+	names.mu.Lock()
+	defer names.mu.Unlock()
+	if names.classes == nil || time.Since(names.loadedAt) >= roomNamesTTL {
+		names.classes = make(map[string]bool)
+		names.byKey = make(map[string]string)
+		for _, class := range s.repo.GetAllClass() {
+			names.classes[class] = true
+			names.byKey[db.NormalizeRoom(class)] = class
+		}
+		names.aliases = make(map[string]string)
+		aliases, err := s.repo.GetRoomAliases()
+		if err != nil {
+			s.logger.Println("Error reading the room aliases", err)
+		}
+		for _, alias := range aliases {
+			names.aliases[alias.Alias] = alias.Class
+		}
+		names.loadedAt = time.Now()
+	}
+	if names.classes[name] {
+		return name
+	}
+	key := db.NormalizeRoom(name)
+	if class, ok := names.aliases[key]; ok {
+		return class
+	}
+	if class, ok := names.byKey[key]; ok {
+		return class
+	}
+	return name
+}
+
+// forgetRoomNames has the next canonicalRoom read the classrooms and aliases again
+func (s *Server) forgetRoomNames() {
+	s.roomNames.mu.Lock()
+	defer s.roomNames.mu.Unlock()
+	s.roomNames.classes = nil
+}
+
+// canonicalRooms replaces the classroom names in the path and query of a request with their IDs
+func (s *Server) canonicalRooms(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, param := range roomParams {
+			if value := router.Param(r, param); value != "" {
+				router.SetParam(r, param, s.canonicalRoom(value))
+			}
+		}
+		query := r.URL.Query()
+		changed := false
+		for _, param := range roomParams {
+			for idx, value := range query[param] {
+				if class := s.canonicalRoom(value); class != value {
+					query[param][idx] = class
+					changed = true
+				}
+			}
+		}
+		if changed {
+			u := *r.URL
+			u.RawQuery = query.Encode()
+			r = r.WithContext(r.Context())
+			r.URL = &u
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) aliasesHandler(w http.ResponseWriter, r *http.Request) {
+	aliases, err := s.repo.GetRoomAliases()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if aliases == nil {
+		aliases = []db.RoomAlias{}
+	}
+	s.writeJSON(w, r, http.StatusOK, aliases)
+}
+
+/*
+setAliasHandler makes the alias of the path another name of the classroom
+class. An alias can't be a classroom's own name, normalized, as that one
+always means the classroom.
+*/
+func (s *Server) setAliasHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class string `param:"class"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	alias := db.RoomAlias{Alias: db.NormalizeRoom(router.Param(r, "alias")), Class: query.Class}
+	if alias.Alias == "" || len(alias.Alias) > maxAliasLength {
+		http.Error(w, "Invalid alias value", http.StatusBadRequest)
+		return
+	}
+	classes := s.repo.GetAllClass()
+	if !containsString(classes, alias.Class) {
+		http.Error(w, "Invalid class value", http.StatusBadRequest)
+		return
+	}
+	for _, class := range classes {
+		if db.NormalizeRoom(class) == alias.Alias {
+			http.Error(w, alias.Alias+" is the classroom "+class, http.StatusConflict)
+			return
+		}
+	}
+	err := s.repo.SetRoomAlias(alias)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.forgetRoomNames()
+	s.audit(r, auditSetAlias, alias.Alias, alias.Class)
+	s.writeJSON(w, r, http.StatusOK, alias)
+}
+
+func (s *Server) deleteAliasHandler(w http.ResponseWriter, r *http.Request) {
+	alias := db.NormalizeRoom(router.Param(r, "alias"))
+	rowsAffected, err := s.repo.DeleteRoomAlias(alias)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such alias", http.StatusNotFound)
+		return
+	}
+	s.forgetRoomNames()
+	s.audit(r, auditDeleteAlias, alias, "")
+	w.WriteHeader(http.StatusNoContent)
+}
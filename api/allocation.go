@@ -0,0 +1,351 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Most students one allocation request may seat
+const maxAllocationStudents = 10000
+
+var errNotEnoughSeats = errors.New("Not enough free seats for the exam")
+
+// Lists the classrooms with capacity data, only those of one campus with campus=
+func (s *Server) classroomsHandler(w http.ResponseWriter, r *http.Request) {
+	all, err := s.repo.GetClassrooms()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var query struct {
+		Campus string `param:"campus"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	classrooms := []db.Classroom{}
+	for _, classroom := range all {
+		if query.Campus == "" || classroom.Campus == query.Campus {
+			classrooms = append(classrooms, classroom)
+		}
+	}
+	s.writeJSON(w, r, http.StatusOK, classrooms)
+}
+
+// Sets the capacity, building, floor and campus of a classroom of the timetable
+func (s *Server) setClassroomHandler(w http.ResponseWriter, r *http.Request) {
+	classroom := db.Classroom{ID: router.Param(r, "class")}
+	if !s.knownClass(w, classroom.ID) {
+		return
+	}
+	var query struct {
+		Capacity int    `param:"capacity,required,min=1"`
+		Building string `param:"building,max=32"`
+		Floor    int    `param:"floor"`
+		Campus   string `param:"campus"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	classroom.Capacity, classroom.Building, classroom.Floor, classroom.Campus = query.Capacity, query.Building, query.Floor, query.Campus
+	exists, err := s.campusExists(classroom.Campus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Invalid campus value", http.StatusBadRequest)
+		return
+	}
+	err = s.repo.SetClassroom(classroom)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	detail := fmt.Sprintf("%d seats in %s floor %d", classroom.Capacity, classroom.Building, classroom.Floor)
+	if classroom.Campus != "" {
+		detail += " on " + classroom.Campus
+	}
+	s.audit(r, auditSetClassroom, classroom.ID, detail)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+examSeats is how many candidates a room of capacity seats: every other seat,
+so that no two candidates sit next to each other.
+*/
+func examSeats(capacity int) int {
+	return capacity / 2
+}
+
+/*
+addRoll returns the roll number n after roll, counting in its trailing digits:
+CB.EN.U4CSE20009 plus 1 is CB.EN.U4CSE20010.
+*/
+func addRoll(roll string, n int) (string, error) {
+	digits := len(roll)
+	for digits > 0 && roll[digits-1] >= '0' && roll[digits-1] <= '9' {
+		digits--
+	}
+	number, err := strconv.Atoi(roll[digits:])
+	if err != nil {
+		return "", fmt.Errorf("%s does not end in a number", roll)
+	}
+	next := strconv.Itoa(number + n)
+	width := len(roll) - digits
+	if len(next) > width {
+		return "", fmt.Errorf("%s has no roll number %d after it", roll, n)
+	}
+	return roll[:digits] + strings.Repeat("0", width-len(next)) + next, nil
+}
+
+// A run of consecutive roll numbers sitting an exam
+type studentGroup struct {
+	FirstRoll string `json:"firstRoll"`
+	Count     int    `json:"count"`
+}
+
+type allocationRequest struct {
+	Students []studentGroup `json:"students"`
+}
+
+// One hall of a proposed seating plan
+type plannedHall struct {
+	db.ExamHall
+	Building string `json:"building"`
+	Floor    int    `json:"floor"`
+	Students int    `json:"students"`
+	Seats    int    `json:"seats"`
+}
+
+/*
+seat fills halls in order with groups, each group in roll order. A hall holds
+a single range of rolls, so a group never shares a hall with the one before;
+a partly filled hall is left for the next group to skip.
+*/
+func seat(groups []studentGroup, halls []db.Classroom) ([]plannedHall, error) {
+	var plan []plannedHall
+	h := 0
+	for _, group := range groups {
+		roll := strings.ToUpper(group.FirstRoll)
+		remaining := group.Count
+		for remaining > 0 {
+			if h >= len(halls) {
+				return nil, errNotEnoughSeats
+			}
+			seats := examSeats(halls[h].Capacity)
+			take := remaining
+			if take > seats {
+				take = seats
+			}
+			if take == 0 {
+				h++
+				continue
+			}
+			lastRoll, err := addRoll(roll, take-1)
+			if err != nil {
+				return nil, err
+			}
+			plan = append(plan, plannedHall{
+				ExamHall: db.ExamHall{Class: halls[h].ID, FirstRoll: roll, LastRoll: lastRoll},
+				Building: halls[h].Building, Floor: halls[h].Floor, Students: take, Seats: seats,
+			})
+			h++
+			remaining -= take
+			if remaining > 0 {
+				roll, err = addRoll(roll, take)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return plan, nil
+}
+
+/*
+allocateHalls proposes where groups sit, in halls free of other exams. Keeping
+an exam together is the adjacency rule: the plan uses one building when any
+building has room, taking its halls floor by floor and preferring the
+building that needs the fewest halls, then the fewest floors. Only when no
+building is big enough are buildings combined.
+*/
+func allocateHalls(groups []studentGroup, free []db.Classroom) ([]plannedHall, error) {
+	sort.SliceStable(free, func(i, j int) bool {
+		a, b := free[i], free[j]
+		if a.Building != b.Building {
+			return a.Building < b.Building
+		}
+		if a.Floor != b.Floor {
+			return a.Floor < b.Floor
+		}
+		return a.ID < b.ID
+	})
+	var best []plannedHall
+	bestFloors := 0
+	for start := 0; start < len(free); {
+		end := start
+		for end < len(free) && free[end].Building == free[start].Building {
+			end++
+		}
+		for k := start + 1; k <= end; k++ {
+			plan, err := seat(groups, free[start:k])
+			if err == errNotEnoughSeats {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			floors := free[k-1].Floor - free[start].Floor + 1
+			if best == nil || len(plan) < len(best) || (len(plan) == len(best) && floors < bestFloors) {
+				best, bestFloors = plan, floors
+			}
+			break
+		}
+		start = end
+	}
+	if best != nil {
+		return best, nil
+	}
+	return seat(groups, free)
+}
+
+// Whether two exams are in the same place at the same time
+func examsOverlap(a db.Exam, b db.Exam) bool {
+	return a.Date.Equal(b.Date) && a.StartTime < b.EndTime && b.StartTime < a.EndTime
+}
+
+/*
+allocateExamHandler proposes a seating plan for an exam from the JSON body
+{"students": [{"firstRoll": "CB.EN.U4CSE20001", "count": 60}]}, using the
+classrooms with capacity data that no overlapping exam uses. With save=true
+the plan replaces the exam's halls, unless dryRun=true asks for a preview of
+the plan and of the halls left out because an overlapping exam uses them.
+*/
+func (s *Server) allocateExamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Save bool `param:"save"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	save := query.Save
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+	var allocation allocationRequest
+	err = json.NewDecoder(r.Body).Decode(&allocation)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	total := 0
+	for _, group := range allocation.Students {
+		if group.Count < 1 {
+			http.Error(w, "Invalid count value", http.StatusBadRequest)
+			return
+		}
+		if _, err := addRoll(group.FirstRoll, group.Count-1); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		total += group.Count
+	}
+	if total == 0 || total > maxAllocationStudents {
+		http.Error(w, "Invalid students value", http.StatusBadRequest)
+		return
+	}
+
+	exams, err := s.repo.GetExams(time.Time{}, time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var exam db.Exam
+	found := false
+	taken := make(map[string]bool)
+	for _, other := range exams {
+		if other.ID == id {
+			exam, found = other, true
+		}
+	}
+	if !found {
+		http.Error(w, "No such exam", http.StatusNotFound)
+		return
+	}
+	var conflicts []string
+	for _, other := range exams {
+		if other.ID != id && examsOverlap(exam, other) {
+			for _, hall := range other.Halls {
+				taken[hall.Class] = true
+				conflicts = append(conflicts, hall.Class+" is taken by "+other.Subject+" from "+other.StartTime)
+			}
+		}
+	}
+	classrooms, err := s.repo.GetClassrooms()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var free []db.Classroom
+	for _, classroom := range classrooms {
+		if !taken[classroom.ID] {
+			free = append(free, classroom)
+		}
+	}
+	plan, err := allocateHalls(allocation.Students, free)
+	if err == errNotEnoughSeats {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Checked like a plan made by hand, which catches groups that overlap
+	request := examRequest{Subject: exam.Subject, Date: exam.Date.Format(calendar.DateLayout),
+		StartTime: exam.StartTime, EndTime: exam.EndTime}
+	for _, hall := range plan {
+		request.Halls = append(request.Halls, hall.ExamHall)
+	}
+	checked, err := s.exam(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	checked.ID = exam.ID
+	if dryRun {
+		s.writePreview(w, r, plan, conflicts)
+		return
+	}
+	if save {
+		err = s.repo.UpdateExam(checked)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No such exam", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.audit(r, auditAllocateExam, strconv.FormatInt(id, 10), fmt.Sprintf("%d students in %d halls", total, len(plan)))
+	}
+	s.writeJSON(w, r, http.StatusOK, plan)
+}
@@ -0,0 +1,4033 @@
+package api_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/api"
+	"github.com/deebakkarthi/coraserver/apitest"
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/cache"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/erp"
+	"github.com/deebakkarthi/coraserver/jobs"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/seal"
+	"github.com/deebakkarthi/coraserver/tracing"
+)
+
+// 2023-06-13 is a Tuesday
+func newHarness(t *testing.T, configure ...func(*api.Config)) *apitest.Harness {
+	h := apitest.New(t, configure...)
+	h.Repo.AddSlot(1, "08:00:00", "08:50:00")
+	h.Repo.AddSlot(2, "08:50:00", "09:40:00")
+	h.Repo.AddSlot(3, "09:50:00", "10:40:00")
+	h.Repo.AddStatic("A104", "TUE", 1, "FREE")
+	h.Repo.AddStatic("A104", "TUE", 2, "FREE")
+	h.Repo.AddStatic("A104", "TUE", 3, "19CSE311")
+	h.Repo.AddStatic("B201", "TUE", 1, "19CSE302")
+	h.Repo.AddStatic("B201", "TUE", 2, "FREE")
+	h.Repo.AddStatic("B201", "TUE", 3, "FREE")
+	return h
+}
+
+func TestFreeClass(t *testing.T) {
+	h := newHarness(t)
+
+	var classes []string
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13", &classes)
+	if want := []string{"A104", "B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("freeclass = %v; want %v", classes, want)
+	}
+	var slots []int
+	h.DoJSON("GET", "/db/freeslot?class=B201&date=2023-06-13", &slots)
+	if want := []int{2, 3}; !reflect.DeepEqual(slots, want) {
+		t.Errorf("freeslot = %v; want %v", slots, want)
+	}
+	h.DoJSON("GET", "/db/multiFreeSlot?startSlot=1&endSlot=2&date=2023-06-13", &classes)
+	if want := []string{"A104"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("multiFreeSlot = %v; want %v", classes, want)
+	}
+	h.DoJSON("GET", "/db/freeclass?slot=2&date="+url.QueryEscape("2023-06-13T09:00:00+05:30"), &classes)
+	if want := []string{"A104", "B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("freeclass with a timestamp = %v; want %v", classes, want)
+	}
+	if n := len(h.Repo.Searches()); n != 4 {
+		t.Errorf("recorded %d searches; want 4", n)
+	}
+
+	resp, _ := h.Do("GET", "/db/freeclass?slot=x&date=2023-06-13")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("freeclass with bad slot = %d; want 400", resp.StatusCode)
+	}
+	resp, _ = h.Do("POST", "/db/freeclass?slot=1&date=2023-06-13")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST freeclass = %d; want 405", resp.StatusCode)
+	}
+}
+
+func TestFreeNow(t *testing.T) {
+	h := newHarness(t)
+	at := func(hour, min int) string {
+		return url.QueryEscape(time.Date(2023, 6, 13, hour, min, 0, 0, time.Local).Format(time.RFC3339))
+	}
+
+	var now struct {
+		Slot    int
+		Until   string
+		Classes []string
+	}
+	h.DoJSON("GET", "/db/freenow?at="+at(8, 10), &now)
+	if now.Slot != 1 || now.Until != "08:50" || !reflect.DeepEqual(now.Classes, []string{"A104"}) {
+		t.Errorf("freenow at 8:10 = %+v; want slot 1 until 08:50 with A104 free", now)
+	}
+	if resp, _ := h.Do("GET", "/db/freenow?at="+at(9, 45)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("freenow between slots status = %d; want 404", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/db/freenow?at=soon"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("freenow at soon status = %d; want 400", resp.StatusCode)
+	}
+
+	var classes []string
+	h.DoJSON("GET", "/db/freerooms?slots=2,3&date=2023-06-13&date=2023-06-20", &classes)
+	if want := []string{"B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("freerooms = %v; want %v", classes, want)
+	}
+	h.Repo.Booking("B201", time.Date(2023, 6, 20, 0, 0, 0, 0, time.UTC), 3, "faculty@cb.amrita.edu", "19CSE302")
+	h.DoJSON("GET", "/db/freerooms?slots=2,3&date=2023-06-13&date=2023-06-20", &classes)
+	if len(classes) != 0 {
+		t.Errorf("freerooms with B201 booked on one date = %v; want none", classes)
+	}
+	if resp, _ := h.Do("GET", "/db/freerooms?slots=2,x&date=2023-06-13"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("freerooms with slot x status = %d; want 400", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/db/freerooms?slots=2"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("freerooms without a date status = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestTimetableLists(t *testing.T) {
+	h := newHarness(t)
+
+	var slots []int
+	h.DoJSON("GET", "/db/getAllSlot", &slots)
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(slots, want) {
+		t.Errorf("getAllSlot = %v; want %v", slots, want)
+	}
+	var classes []string
+	h.DoJSON("GET", "/db/getAllClass", &classes)
+	if want := []string{"A104", "B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("getAllClass = %v; want %v", classes, want)
+	}
+	var subjects []string
+	h.DoJSON("GET", "/db/getAllSubject", &subjects)
+	if want := []string{"19CSE302", "19CSE311"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("getAllSubject = %v; want %v", subjects, want)
+	}
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date=2023-06-13", &subjects)
+	if want := []string{"FREE", "FREE", "19CSE311"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable = %v; want %v", subjects, want)
+	}
+
+	for _, path := range []string{
+		"/db/daytimetable?class=Z999&date=2023-06-13",
+		"/db/freeslot?class=Z999&date=2023-06-13",
+		"/db/booking?class=Z999&date=2023-06-13&slot=1&faculty=f&subject=19CSE311",
+	} {
+		if resp, body := h.Do("GET", path); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %d %s; want 404", path, resp.StatusCode, body)
+		}
+	}
+	// Known, with nothing in it that day
+	resp, body := h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-18")
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != "[]" {
+		t.Errorf("daytimetable on a Sunday = %d %s; want 200 []", resp.StatusCode, body)
+	}
+}
+
+func TestBooking(t *testing.T) {
+	h := newHarness(t)
+	const faculty = "faculty@cb.amrita.edu"
+
+	var inserted struct {
+		Inserted bool `json:"inserted"`
+	}
+	h.DoJSON("GET", "/db/booking?class=A104&date=2023-06-13&slot=1&faculty="+faculty+"&subject=19CSE311", &inserted)
+	if !inserted.Inserted {
+		t.Errorf("booking a free slot: inserted = false")
+	}
+	h.DoJSON("GET", "/db/booking?class=A104&date=2023-06-13&slot=3&faculty="+faculty+"&subject=19CSE311", &inserted)
+	if inserted.Inserted {
+		t.Errorf("booking a taken slot: inserted = true")
+	}
+	h.DoJSON("GET", "/db/multiBooking?class=B201&date=2023-06-13&startSlot=2&endSlot=3&faculty="+faculty+"&subject=19CSE302", &inserted)
+	if !inserted.Inserted {
+		t.Errorf("multiBooking free slots: inserted = false")
+	}
+
+	var bookings []db.BookingRecord
+	h.DoJSON("GET", "/db/getBooking?faculty="+faculty, &bookings)
+	if len(bookings) != 3 {
+		t.Fatalf("getBooking returned %d bookings; want 3", len(bookings))
+	}
+	var subjects []string
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date=2023-06-13", &subjects)
+	if want := []string{"19CSE311", "FREE", "19CSE311"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable after booking = %v; want %v", subjects, want)
+	}
+
+	resp, _ := h.Do("GET", "/db/cancelBooking?class=A104&date=2023-06-13&slot=1")
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("cancelBooking = %d; want 302", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/db/getBooking?faculty="+faculty, &bookings)
+	if len(bookings) != 2 {
+		t.Errorf("getBooking after cancel returned %d bookings; want 2", len(bookings))
+	}
+}
+
+func TestChangesLongPoll(t *testing.T) {
+	h := newHarness(t)
+	type changes struct {
+		Cursor  string
+		Changes []struct {
+			Kind  string
+			Class string
+			Date  string
+			Slots []int
+		}
+		Reset bool
+	}
+
+	var start changes
+	h.DoJSON("GET", "/db/changes", &start)
+	if start.Cursor == "" || len(start.Changes) != 0 {
+		t.Fatalf("changes without a cursor = %+v; want a cursor and nothing else", start)
+	}
+	var idle changes
+	h.DoJSON("GET", "/db/changes?timeout=0&since="+start.Cursor, &idle)
+	if idle.Cursor != start.Cursor || len(idle.Changes) != 0 || idle.Reset {
+		t.Errorf("changes without any = %+v; want the same cursor back", idle)
+	}
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		resp, err := http.Get(h.URL + "/db/booking?class=A104&date=2023-06-13&slot=1&faculty=faculty@cb.amrita.edu&subject=19CSE311")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	var booked changes
+	began := time.Now()
+	h.DoJSON("GET", "/db/changes?timeout=10&since="+start.Cursor, &booked)
+	if time.Since(began) > 5*time.Second {
+		t.Errorf("long poll took %v; want it to end with the booking", time.Since(began))
+	}
+	if len(booked.Changes) != 1 || booked.Changes[0].Kind != "booking" || booked.Changes[0].Class != "A104" ||
+		booked.Changes[0].Date != "2023-06-13" || !reflect.DeepEqual(booked.Changes[0].Slots, []int{1}) {
+		t.Errorf("changes after booking = %+v; want the booking of A104", booked)
+	}
+	if booked.Cursor == start.Cursor {
+		t.Errorf("cursor did not move on with the booking")
+	}
+
+	var reset changes
+	h.DoJSON("GET", "/db/changes?since=0123456789abcdef-4", &reset)
+	if !reset.Reset || reset.Cursor != booked.Cursor {
+		t.Errorf("changes since a cursor of another server = %+v; want a reset to %s", reset, booked.Cursor)
+	}
+	if resp, _ := h.Do("GET", "/db/changes?timeout=soon&since="+booked.Cursor); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("changes with timeout=soon status = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestLoginWithState(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.Do("GET", "/oauth/login")
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("login = %d; want 302", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := location.Query().Get("state")
+	if location.Query().Get("code_challenge_method") != "S256" || state == "" {
+		t.Fatalf("login redirect %s lacks state or PKCE challenge", location)
+	}
+
+	h.Provider.AddUser("web-code", auth.Identity{Mail: "student@cb.students.amrita.edu", GivenName: "Student"})
+	path := "/oauth/exchange?code=web-code&state=" + state
+	resp, body := h.Do("GET", path)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("exchange = %d %s; want 200", resp.StatusCode, body)
+	}
+	if h.Provider.Verifier("web-code") == "" {
+		t.Errorf("exchange did not send the PKCE verifier")
+	}
+	resp, _ = h.Do("GET", path)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reusing a state = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestTokenBytes(t *testing.T) {
+	h := apitest.New(t, func(config *api.Config) {
+		config.TokenBytes = 16
+	})
+
+	resp, _ := h.Do("GET", "/oauth/login")
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := location.Query().Get("state"); len(state) != 22 {
+		t.Errorf("state %q has %d characters; want 22", state, len(state))
+	}
+	session := h.Login(auth.Identity{Mail: "student@cb.students.amrita.edu", GivenName: "Student"})
+	if len(session) != 32 {
+		t.Errorf("session ID %q has %d characters; want 32", session, len(session))
+	}
+}
+
+func TestExchangeUnknownCode(t *testing.T) {
+	h := newHarness(t)
+
+	resp, _ := h.Do("GET", "/oauth/exchange?code=unknown&code_verifier="+strings.Repeat("v", 43))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("exchange with unknown code = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	h := newHarness(t)
+	identity := auth.Identity{Mail: "student@cb.students.amrita.edu", GivenName: "Student"}
+	phone := h.Login(identity)
+	laptop := h.Login(identity)
+
+	var sessions []struct {
+		ID      string `json:"id"`
+		Current bool   `json:"current"`
+	}
+	h.DoJSON("GET", "/me/sessions", &sessions, apitest.Bearer(phone))
+	if len(sessions) != 2 {
+		t.Fatalf("listed %d sessions; want 2", len(sessions))
+	}
+	other := sessions[0].ID
+	if sessions[0].Current {
+		other = sessions[1].ID
+	}
+	resp, _ := h.Do("DELETE", "/me/sessions/"+other, apitest.Bearer(phone))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting a session = %d; want 204", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/me/sessions", apitest.Bearer(laptop))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("using a deleted session = %d; want 401", resp.StatusCode)
+	}
+
+	resp, _ = h.Do("POST", "/oauth/logout", apitest.Bearer(phone))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("logout = %d; want 204", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/me/sessions", apitest.Bearer(phone))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("after logout = %d; want 401", resp.StatusCode)
+	}
+	if revoked := h.Provider.Revoked(); len(revoked) != 2 {
+		t.Errorf("revoked %d refresh tokens; want 2", len(revoked))
+	}
+}
+
+func TestForceLogout(t *testing.T) {
+	h := newHarness(t)
+	mail := "student@cb.students.amrita.edu"
+	session := h.Login(auth.Identity{Mail: mail})
+
+	resp, _ := h.Do("POST", "/admin/users/"+mail+"/logout")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("without admin key = %d; want 403", resp.StatusCode)
+	}
+	var response struct {
+		Sessions int `json:"sessions"`
+	}
+	h.DoJSON("POST", "/admin/users/"+mail+"/logout", &response, apitest.AdminKey())
+	if response.Sessions != 1 {
+		t.Errorf("ended %d sessions; want 1", response.Sessions)
+	}
+	resp, _ = h.Do("GET", "/me/sessions", apitest.Bearer(session))
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("after force logout = %d; want 401", resp.StatusCode)
+	}
+}
+
+func TestAnalytics(t *testing.T) {
+	h := newHarness(t)
+	h.Do("GET", "/db/freeclass?slot=1&date=2023-06-13")
+
+	var utilization db.Utilization
+	h.DoJSON("GET", "/admin/analytics/utilization?startDate=2023-06-13&endDate=2023-06-13", &utilization, apitest.AdminKey())
+	if len(utilization.Rooms) != 2 || utilization.Rooms[0].Total != 3 {
+		t.Errorf("utilization rooms = %+v; want A104 and B201 with 3 periods", utilization.Rooms)
+	}
+	resp, _ := h.Do("GET", "/admin/analytics/searches?startDate=2023-06-13&endDate=2023-06-12", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("reversed date range = %d; want 400", resp.StatusCode)
+	}
+
+	resp, body := h.Do("GET", "/admin/analytics/utilization?startDate=2023-06-13&endDate=2023-06-13&format=csv&table=peakHours", apitest.AdminKey())
+	lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+	if resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" || len(lines) != 4 || lines[0] != "slot,start,end,occupied,total,percentage" ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), "peakHours.csv") {
+		t.Errorf("utilization as CSV = %s %q; want the header and the three slots", resp.Header.Get("Content-Type"), body)
+	}
+	resp, body = h.Do("GET", "/admin/analytics/searches?startDate=2023-06-13&endDate=2023-06-13&format=xlsx", apitest.AdminKey())
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if resp.StatusCode != http.StatusOK || err != nil || len(archive.File) != 8 {
+		t.Errorf("searches as xlsx = %d %v; want a workbook of four sheets", resp.StatusCode, err)
+	}
+	if resp, _ := h.Do("GET", "/admin/analytics/searches?startDate=2023-06-13&endDate=2023-06-13&format=pdf", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("format=pdf = %d; want 400", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/admin/analytics/searches?startDate=2023-06-13&endDate=2023-06-13&format=csv&table=nope", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("an unknown table = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	h := newHarness(t)
+
+	var issued struct {
+		ID  string `json:"id"`
+		Key string `json:"key"`
+	}
+	resp, body := h.Do("POST", "/admin/apikeys?name=signage&scopes=freeclass:read&rateLimit=2", apitest.AdminKey())
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("issuing a key = %d %s; want 201", resp.StatusCode, body)
+	}
+	if err := json.Unmarshal(body, &issued); err != nil {
+		t.Fatal(err)
+	}
+	key := apitest.Header("X-API-Key", issued.Key)
+
+	resp, _ = h.Do("GET", "/db/freeclass?slot=1&date=2023-06-13", key)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("freeclass with key = %d; want 200", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/db/getAllSlot", key)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("getAllSlot without the scope = %d; want 403", resp.StatusCode)
+	}
+	h.Do("GET", "/db/freeclass?slot=1&date=2023-06-13", key)
+	resp, _ = h.Do("GET", "/db/freeclass?slot=1&date=2023-06-13", key)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("over the rate limit = %d; want 429", resp.StatusCode)
+	}
+
+	resp, _ = h.Do("DELETE", "/admin/apikeys/"+issued.ID, apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("revoking = %d; want 204", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/db/freeclass?slot=1&date=2023-06-13", key)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("revoked key = %d; want 401", resp.StatusCode)
+	}
+	var keys []db.APIKey
+	h.DoJSON("GET", "/admin/apikeys", &keys, apitest.AdminKey())
+	if len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Errorf("listed keys = %+v; want one revoked key", keys)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	h := newHarness(t)
+	issue := func(scopes string) apitest.Option {
+		var issued struct {
+			Key string `json:"key"`
+		}
+		resp, body := h.Do("POST", "/admin/apikeys?name=test&scopes="+scopes, apitest.AdminKey())
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("issuing a %s key = %d %s; want 201", scopes, resp.StatusCode, body)
+		}
+		json.Unmarshal(body, &issued)
+		return apitest.Header("X-API-Key", issued.Key)
+	}
+	if resp, _ := h.Do("POST", "/admin/apikeys?name=test&scopes=nothing:*", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("issuing a key for an unknown resource = %d; want 400", resp.StatusCode)
+	}
+
+	signage := issue("timetable:read,freeclass:read")
+	if resp, _ := h.Do("GET", "/db/booking?class=A104&date=2023-06-13&slot=1&faculty=f@cb.amrita.edu", signage); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("booking with the signage key = %d; want 403", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/admin/dashboard", signage); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dashboard with the signage key = %d; want 403", resp.StatusCode)
+	}
+
+	reader := issue("admin:read")
+	if resp, _ := h.Do("GET", "/admin/dashboard", reader); resp.StatusCode != http.StatusOK {
+		t.Errorf("dashboard with admin:read = %d; want 200", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/admin/announcements?title=Now", reader); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("announcing with admin:read = %d; want 403", resp.StatusCode)
+	}
+
+	admin := issue("admin:*")
+	if resp, _ := h.Do("POST", "/admin/announcements?title=Now", admin); resp.StatusCode != http.StatusCreated {
+		t.Errorf("announcing with admin:* = %d; want 201", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/admin/apikeys", admin); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("listing keys with admin:* = %d; want 403", resp.StatusCode)
+	}
+	var events []db.AuditEvent
+	h.DoJSON("GET", "/admin/audit?action=announcement.create", &events, apitest.AdminKey())
+	if len(events) != 1 || !strings.HasPrefix(events[0].Actor, "apikey:") {
+		t.Errorf("audit = %+v; want the announcement made by the key", events)
+	}
+}
+
+func TestAdminTimetable(t *testing.T) {
+	h := newHarness(t)
+	var classes []string
+	h.DoJSON("GET", "/db/getAllClass", &classes)
+
+	resp, body := h.Do("PUT", "/admin/timetable/C301/tuesday/2?subject=19CSE313&faculty=f@cb.amrita.edu", apitest.AdminKey())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("setting a period = %d %s; want 200", resp.StatusCode, body)
+	}
+	h.DoJSON("GET", "/db/getAllClass", &classes)
+	if want := []string{"A104", "B201", "C301"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("getAllClass after edit = %v; want %v", classes, want)
+	}
+	var entries []db.StaticEntry
+	h.DoJSON("GET", "/admin/timetable?faculty=f@cb.amrita.edu", &entries, apitest.AdminKey())
+	if len(entries) != 1 || entries[0].Subject != "19CSE313" || entries[0].Day != "TUE" {
+		t.Errorf("timetable by faculty = %+v; want the C301 period", entries)
+	}
+	var named []struct {
+		Day     string `json:"day"`
+		DayName string `json:"dayName"`
+	}
+	// 2 is the ISO weekday of Tuesday
+	h.DoJSON("GET", "/admin/timetable?class=C301&day=2", &named, apitest.AdminKey(),
+		apitest.Header("Accept-Language", "ta-IN,ta;q=0.9,en;q=0.8"))
+	if len(named) != 1 || named[0].DayName != "செவ்வாய்" {
+		t.Errorf("timetable in Tamil = %+v; want செவ்வாய்", named)
+	}
+	resp, _ = h.Do("PUT", "/admin/timetable/C301/SUN/2?subject=19CSE313", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid day = %d; want 400", resp.StatusCode)
+	}
+	resp, _ = h.Do("DELETE", "/admin/timetable/C301/TUE/2", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting a period = %d; want 204", resp.StatusCode)
+	}
+	resp, _ = h.Do("DELETE", "/admin/timetable/C301/TUE/2", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting it again = %d; want 404", resp.StatusCode)
+	}
+
+	var dashboard struct {
+		RecentAudit []db.AuditEvent `json:"recentAudit"`
+	}
+	h.DoJSON("GET", "/admin/dashboard", &dashboard, apitest.AdminKey())
+	if len(dashboard.RecentAudit) != 2 || dashboard.RecentAudit[0].Action != "timetable.delete" ||
+		dashboard.RecentAudit[0].Actor != "admin" {
+		t.Errorf("recent audit = %+v; want the delete then the set", dashboard.RecentAudit)
+	}
+}
+
+func TestTimetableConflicts(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	h.Repo.SetStatic(db.StaticEntry{Class: "B201", Day: "TUE", Slot: 1, Faculty: "lab@cb.amrita.edu", Subject: "19CSE302", Span: 3})
+	h.Repo.SetStatic(db.StaticEntry{Class: "B201", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE313"})
+	h.Repo.SetStatic(db.StaticEntry{Class: "B201", Day: "WED", Slot: 2, Subject: "FREE"})
+
+	var conflicts struct {
+		RoomClashes []struct {
+			Class   string
+			Day     string
+			Slot    int
+			Entries []db.StaticEntry
+		}
+		FacultyClashes []struct {
+			Faculty string
+			Slot    int
+			Entries []db.StaticEntry
+		}
+		MissingSlots []struct {
+			Class string
+			Day   string
+			Slots []int
+		}
+	}
+	h.DoJSON("GET", "/admin/timetable/conflicts", &conflicts, apitest.AdminKey())
+	if len(conflicts.RoomClashes) != 1 || conflicts.RoomClashes[0].Class != "B201" || conflicts.RoomClashes[0].Slot != 3 ||
+		len(conflicts.RoomClashes[0].Entries) != 2 {
+		t.Errorf("room clashes = %+v; want the lab of B201 reaching over slot 3", conflicts.RoomClashes)
+	}
+	if len(conflicts.FacultyClashes) != 1 || conflicts.FacultyClashes[0].Faculty != "faculty@cb.amrita.edu" ||
+		conflicts.FacultyClashes[0].Slot != 3 {
+		t.Errorf("faculty clashes = %+v; want faculty@ in A104 and B201 in slot 3", conflicts.FacultyClashes)
+	}
+	if len(conflicts.MissingSlots) != 1 || conflicts.MissingSlots[0].Day != "WED" ||
+		!reflect.DeepEqual(conflicts.MissingSlots[0].Slots, []int{1, 3}) {
+		t.Errorf("missing slots = %+v; want B201 on WED in slots 1 and 3", conflicts.MissingSlots)
+	}
+}
+
+func TestRoomAliases(t *testing.T) {
+	h := newHarness(t)
+	var slots []int
+	h.DoJSON("GET", "/db/freeslot?class=b-201&date=2023-06-13", &slots)
+	if !reflect.DeepEqual(slots, []int{2, 3}) {
+		t.Errorf("free slots of b-201 = %v; want those of B201", slots)
+	}
+
+	resp, _ := h.Do("PUT", "/admin/aliases/Main Block 201?class=B201", apitest.AdminKey())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("setting an alias = %d; want 200", resp.StatusCode)
+	}
+	resp, _ = h.Do("PUT", "/admin/aliases/a-104?class=B201", apitest.AdminKey())
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("aliasing A104 to B201 = %d; want 409", resp.StatusCode)
+	}
+	resp, _ = h.Do("PUT", "/admin/aliases/Lab1?class=C999", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("aliasing an unknown class = %d; want 400", resp.StatusCode)
+	}
+	var aliases []db.RoomAlias
+	h.DoJSON("GET", "/admin/aliases", &aliases, apitest.AdminKey())
+	if len(aliases) != 1 || aliases[0].Alias != "MAINBLOCK201" || aliases[0].Class != "B201" {
+		t.Errorf("aliases = %+v; want MAINBLOCK201 for B201", aliases)
+	}
+	slots = nil
+	h.DoJSON("GET", "/db/freeslot?class=main+block+201&date=2023-06-13", &slots)
+	if !reflect.DeepEqual(slots, []int{2, 3}) {
+		t.Errorf("free slots of the alias = %v; want those of B201", slots)
+	}
+
+	resp, _ = h.Do("DELETE", "/admin/aliases/MAIN-BLOCK-201", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting the alias = %d; want 204", resp.StatusCode)
+	}
+	resp, _ = h.Do("DELETE", "/admin/aliases/MAIN-BLOCK-201", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting it again = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestLabSpan(t *testing.T) {
+	h := newHarness(t)
+	// A104 is free in slots 1 and 2 on Tuesdays; a lab from slot 1 takes both
+	resp, body := h.Do("PUT", "/admin/timetable/A104/TUE/1?subject=19CSE312&span=2", apitest.AdminKey())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("setting a lab = %d %s; want 200", resp.StatusCode, body)
+	}
+	var classes []string
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13", &classes)
+	if want := []string{"B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("freeclass in the lab's second slot = %v; want %v", classes, want)
+	}
+	var slots []int
+	h.DoJSON("GET", "/db/freeslot?class=A104&date=2023-06-13", &slots)
+	if len(slots) != 0 {
+		t.Errorf("freeslot of A104 = %v; want none", slots)
+	}
+	var subjects []string
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date=2023-06-13", &subjects)
+	if want := []string{"19CSE312", "19CSE312", "19CSE311"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of A104 = %v; want %v", subjects, want)
+	}
+	var booking struct{ Inserted bool }
+	h.DoJSON("GET", "/db/booking?class=A104&date=2023-06-13&slot=2&faculty=f@cb.amrita.edu&subject=19CSE302", &booking)
+	if booking.Inserted {
+		t.Errorf("booking the lab's second slot was inserted")
+	}
+	// Slot 3 already has 19CSE311
+	resp, _ = h.Do("PUT", "/admin/timetable/A104/TUE/2?subject=19CSE313&span=2", apitest.AdminKey())
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("overlapping lab = %d; want 409", resp.StatusCode)
+	}
+	resp, _ = h.Do("PUT", "/admin/timetable/B201/TUE/2?subject=19CSE313&span=3", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("lab past the last slot = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddFaculty("faculty@cb.amrita.edu", "Faculty")
+	h.Repo.AddFaculty("substitute@cb.amrita.edu", "Substitute")
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	h.Repo.AddFavorite("student@cb.students.amrita.edu", db.Favorite{Kind: db.FavoriteClassroom, Target: "A104"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	other := h.Login(auth.Identity{Mail: "other@cb.amrita.edu"})
+	// Overrides are for today on, so use the next Tuesday
+	tuesday := time.Now()
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	date := tuesday.Format("2006-01-02")
+
+	resp, _ := h.Do("PUT", "/me/overrides/A104/"+date+"/3?cancel=true", apitest.Bearer(other))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("overriding someone else's class = %d; want 403", resp.StatusCode)
+	}
+	resp, body := h.Do("PUT", "/me/overrides/A104/"+date+"/3?room=B201&faculty=substitute@cb.amrita.edu", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("moving a class = %d %s; want 200", resp.StatusCode, body)
+	}
+	var subjects []string
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date="+date, &subjects)
+	if want := []string{"FREE", "FREE", "MOVED:B201"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of A104 = %v; want %v", subjects, want)
+	}
+	h.DoJSON("GET", "/db/daytimetable?class=B201&date="+date, &subjects)
+	if want := []string{"19CSE302", "FREE", "19CSE311"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of B201 = %v; want %v", subjects, want)
+	}
+	sent := h.Notifier.Sent()
+	if len(sent) != 2 || sent[0].To != "student@cb.students.amrita.edu" || sent[1].To != "substitute@cb.amrita.edu" {
+		t.Errorf("notifications = %+v; want the student and the substitute", sent)
+	}
+
+	resp, _ = h.Do("PUT", "/me/overrides/A104/"+date+"/3?cancel=true&reason=Unwell", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("cancelling a class = %d; want 200", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date="+date, &subjects)
+	if want := []string{"FREE", "FREE", "CANCELLED"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of A104 = %v; want %v", subjects, want)
+	}
+	var slots []int
+	h.DoJSON("GET", "/db/freeslot?class=B201&date="+date, &slots)
+	if want := []int{2, 3}; !reflect.DeepEqual(slots, want) {
+		t.Errorf("freeslot of B201 after the move was undone = %v; want %v", slots, want)
+	}
+	var overrides []db.Override
+	h.DoJSON("GET", "/db/overrides?date="+date, &overrides)
+	if len(overrides) != 1 || !overrides[0].Cancelled || overrides[0].Reason != "Unwell" {
+		t.Errorf("overrides = %+v; want the cancellation", overrides)
+	}
+
+	resp, _ = h.Do("DELETE", "/admin/overrides/A104/"+date+"/3", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting the override = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date="+date, &subjects)
+	if want := []string{"FREE", "FREE", "19CSE311"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of A104 = %v; want %v", subjects, want)
+	}
+	resp, _ = h.Do("PUT", "/admin/overrides/A104/"+date+"/1?cancel=true", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("cancelling a free slot = %d; want 404", resp.StatusCode)
+	}
+	resp, _ = h.Do("PUT", "/admin/overrides/A104/2023-06-13/3?cancel=true", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("cancelling a past class = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestOfficeHours(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	h.Repo.SetStatic(db.StaticEntry{Class: "B201", Day: "TUE", Slot: 1, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE302"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	student := h.Login(auth.Identity{Mail: "student@cb.students.amrita.edu"})
+	// Appointments are for today on, so use the next Tuesday
+	tuesday := time.Now()
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	date := tuesday.Format("2006-01-02")
+
+	hours := `[{"day": "tue", "slot": 2, "place": "Staff room 3"}, {"day": "TUE", "slot": 3}]`
+	resp, _ := h.Do("PUT", "/me/officehours", apitest.Bearer(student), apitest.JSONBody(hours))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("office hours of a student = %d; want 403", resp.StatusCode)
+	}
+	resp, body := h.Do("PUT", "/me/officehours", apitest.Bearer(faculty), apitest.JSONBody(hours))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("setting office hours = %d %s; want 204", resp.StatusCode, body)
+	}
+
+	var days []struct {
+		Busy        []int
+		OfficeHours []db.OfficeHour
+		Free        []int
+	}
+	h.DoJSON("GET", "/db/faculty/faculty@cb.amrita.edu/availability?startDate="+date, &days)
+	if len(days) != 1 || !reflect.DeepEqual(days[0].Busy, []int{1, 3}) || !reflect.DeepEqual(days[0].Free, []int{2}) ||
+		len(days[0].OfficeHours) != 1 || days[0].OfficeHours[0].Slot != 2 || days[0].OfficeHours[0].Place != "Staff room 3" {
+		t.Errorf("availability = %+v; want busy in 1 and 3, office hours in 2", days)
+	}
+	resp, _ = h.Do("GET", "/db/faculty/nobody@cb.amrita.edu/availability")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("availability of nobody = %d; want 404", resp.StatusCode)
+	}
+
+	resp, _ = h.Do("POST", "/me/appointments?faculty=faculty@cb.amrita.edu&date="+date+"&slot=3", apitest.Bearer(student))
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("an appointment while teaching = %d; want 409", resp.StatusCode)
+	}
+	resp, body = h.Do("POST", "/me/appointments?faculty=faculty@cb.amrita.edu&date="+date+"&slot=2&note=Project+doubts", apitest.Bearer(student))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("requesting an appointment = %d %s; want 201", resp.StatusCode, body)
+	}
+	var appointment db.Appointment
+	json.Unmarshal(body, &appointment)
+	if appointment.Start.Format("15:04") != "08:50" || appointment.End.Format("15:04") != "09:05" {
+		t.Errorf("appointment from %v to %v; want the first 15 minutes of slot 2", appointment.Start, appointment.End)
+	}
+	resp, _ = h.Do("POST", "/me/appointments?faculty=faculty@cb.amrita.edu&date="+date+"&slot=2", apitest.Bearer(student))
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("requesting it again = %d; want 409", resp.StatusCode)
+	}
+	classmate := h.Login(auth.Identity{Mail: "classmate@cb.students.amrita.edu"})
+	resp, _ = h.Do("POST", "/me/appointments?faculty=faculty@cb.amrita.edu&date="+date+"&slot=2&start=09:00&minutes=30", apitest.Bearer(classmate))
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("an overlapping appointment = %d; want 409", resp.StatusCode)
+	}
+	resp, body = h.Do("POST", "/me/appointments?faculty=faculty@cb.amrita.edu&date="+date+"&slot=2&minutes=30", apitest.Bearer(classmate))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("a second appointment = %d %s; want 201", resp.StatusCode, body)
+	}
+	var second db.Appointment
+	json.Unmarshal(body, &second)
+	if second.Start.Format("15:04") != "09:05" || second.End.Format("15:04") != "09:35" {
+		t.Errorf("second appointment from %v to %v; want it after the first", second.Start, second.End)
+	}
+	resp, _ = h.Do("POST", "/me/appointments?faculty=faculty@cb.amrita.edu&date="+date+"&slot=2&minutes=20", apitest.Bearer(classmate))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("a 20 minute appointment = %d; want 400", resp.StatusCode)
+	}
+
+	id := strconv.FormatInt(appointment.ID, 10)
+	resp, _ = h.Do("POST", "/me/appointments/"+id+"/accept", apitest.Bearer(student))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("accepting one's own request = %d; want 404", resp.StatusCode)
+	}
+	resp, _ = h.Do("POST", "/me/appointments/"+id+"/accept?reply=See+you", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("accepting = %d; want 204", resp.StatusCode)
+	}
+	var appointments []db.Appointment
+	h.DoJSON("GET", "/me/appointments", &appointments, apitest.Bearer(student))
+	if len(appointments) != 1 || appointments[0].Status != db.AppointmentAccepted || appointments[0].Reply != "See you" {
+		t.Errorf("appointments = %+v; want the accepted one", appointments)
+	}
+	sent := h.Notifier.Sent()
+	if len(sent) != 3 || sent[0].To != "faculty@cb.amrita.edu" || sent[2].To != "student@cb.students.amrita.edu" {
+		t.Errorf("notifications = %+v; want the requests and the answer", sent)
+	}
+	_, body = h.Do("GET", "/me/calendar.ics", apitest.Bearer(student))
+	if !strings.Contains(string(body), "SUMMARY:Meeting with faculty@cb.amrita.edu") ||
+		!strings.Contains(string(body), "LOCATION:Staff room 3") {
+		t.Errorf("calendar = %s; want the accepted appointment in the staff room", body)
+	}
+}
+
+func TestChangeRequests(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	h.Repo.SetStatic(db.StaticEntry{Class: "B201", Day: "TUE", Slot: 2, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE313"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	other := h.Login(auth.Identity{Mail: "other@cb.amrita.edu"})
+
+	resp, _ := h.Do("POST", "/me/changes?class=A104&day=TUE&slot=3&newSlot=1", apitest.Bearer(other))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("moving someone else's period = %d; want 403", resp.StatusCode)
+	}
+	// The faculty member teaches in B201 at slot 2
+	resp, _ = h.Do("POST", "/me/changes?class=A104&day=TUE&slot=3&newSlot=2", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("moving into a busy slot = %d; want 409", resp.StatusCode)
+	}
+	resp, body := h.Do("POST", "/me/changes?class=A104&day=TUE&slot=3&newSlot=1&reason=Lab+clash", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("requesting a change = %d %s; want 201", resp.StatusCode, body)
+	}
+	var change db.ChangeRequest
+	json.Unmarshal(body, &change)
+
+	var pending []struct {
+		db.ChangeRequest
+		Conflict string
+	}
+	h.DoJSON("GET", "/admin/changes?status=pending", &pending, apitest.AdminKey())
+	if len(pending) != 1 || pending[0].ID != change.ID || pending[0].Conflict != "" {
+		t.Fatalf("pending changes = %+v; want the request without conflict", pending)
+	}
+	resp, _ = h.Do("POST", "/admin/changes/"+strconv.FormatInt(change.ID, 10)+"/approve", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("approving = %d; want 204", resp.StatusCode)
+	}
+	var subjects []string
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date=2023-06-13", &subjects)
+	if want := []string{"19CSE311", "FREE", "FREE"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of A104 = %v; want %v", subjects, want)
+	}
+	resp, _ = h.Do("POST", "/admin/changes/"+strconv.FormatInt(change.ID, 10)+"/approve", apitest.AdminKey())
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("approving twice = %d; want 409", resp.StatusCode)
+	}
+	var events []db.AuditEvent
+	h.DoJSON("GET", "/admin/audit?action=change.approve", &events, apitest.AdminKey())
+	if len(events) != 1 || events[0].Detail != "A104/TUE/3 to A104/TUE/1" {
+		t.Errorf("audit events = %+v; want the approval", events)
+	}
+
+	// A period of the same length is swapped with
+	resp, body = h.Do("POST", "/me/changes?class=A104&day=TUE&slot=1&newClass=B201", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("requesting a swap = %d %s; want 201", resp.StatusCode, body)
+	}
+	json.Unmarshal(body, &change)
+	resp, _ = h.Do("POST", "/admin/changes/"+strconv.FormatInt(change.ID, 10)+"/reject?note=Keep+it", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("rejecting = %d; want 204", resp.StatusCode)
+	}
+	var mine []db.ChangeRequest
+	h.DoJSON("GET", "/me/changes", &mine, apitest.Bearer(faculty))
+	if len(mine) != 2 || mine[0].Status != db.ChangeRejected || mine[0].Note != "Keep it" || mine[1].Status != db.ChangeApproved {
+		t.Errorf("my changes = %+v; want the rejection then the approval", mine)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 2 || sent[1].Title != "Timetable change rejected" {
+		t.Errorf("notifications = %+v; want the approval and the rejection", sent)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	h := newHarness(t)
+	var inserted struct{ Inserted bool }
+	h.DoJSON("GET", "/db/booking?class=A104&date=2023-06-13&slot=1&faculty=f&subject=19CSE311", &inserted)
+
+	resp, body := h.Do("POST", "/admin/blocks?class=A104&startDate=2023-06-12&endDate=2023-06-14&reason=Repairs", apitest.AdminKey())
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("blocking a room = %d %s; want 201", resp.StatusCode, body)
+	}
+	var created struct {
+		db.Block
+		Bookings []db.BookingRecord
+	}
+	json.Unmarshal(body, &created)
+	if len(created.Bookings) != 1 || created.Bookings[0].Slot != 1 {
+		t.Errorf("bookings in the window = %+v; want the one in slot 1", created.Bookings)
+	}
+	var classes []string
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13", &classes)
+	if want := []string{"B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("freeclass while A104 is blocked = %v; want %v", classes, want)
+	}
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-20", &classes)
+	if want := []string{"A104", "B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("freeclass after the block = %v; want %v", classes, want)
+	}
+	h.DoJSON("GET", "/db/booking?class=A104&date=2023-06-13&slot=2&faculty=f&subject=19CSE311", &inserted)
+	if inserted.Inserted {
+		t.Error("booked a blocked room")
+	}
+	var blocks []db.Block
+	h.DoJSON("GET", "/admin/blocks?class=A104&startDate=2023-06-14", &blocks, apitest.AdminKey())
+	if len(blocks) != 1 || blocks[0].Reason != "Repairs" {
+		t.Errorf("blocks = %+v; want the repairs", blocks)
+	}
+
+	resp, _ = h.Do("DELETE", "/admin/blocks/"+strconv.FormatInt(created.ID, 10), apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting the block = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/db/booking?class=A104&date=2023-06-13&slot=2&faculty=f&subject=19CSE311", &inserted)
+	if !inserted.Inserted {
+		t.Error("could not book the room once unblocked")
+	}
+	resp, _ = h.Do("POST", "/admin/blocks?class=A104&startDate=2023-06-14&endDate=2023-06-12&reason=Repairs", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("block ending before it starts = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestRelocation(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	h.Repo.AddFavorite("student@cb.students.amrita.edu", db.Favorite{Kind: db.FavoriteClassroom, Target: "A104"})
+	// Relocations are for today on, so use the next Tuesday
+	tuesday := time.Now()
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	date := tuesday.Format("2006-01-02")
+	day := time.Date(tuesday.Year(), tuesday.Month(), tuesday.Day(), 0, 0, 0, 0, time.UTC)
+	relocate := "/admin/relocations?from=A104&to=B201&date=" + date + "&reason=Flooded"
+
+	h.Repo.Booking("A104", day, 1, "booker@cb.amrita.edu", "19CSE302")
+	resp, body := h.Do("POST", relocate, apitest.AdminKey())
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("relocating with B201 taken in slot 1 = %d %s; want 409", resp.StatusCode, body)
+	}
+	if len(h.Notifier.Sent()) != 0 {
+		t.Errorf("a refused relocation sent %d notifications", len(h.Notifier.Sent()))
+	}
+	h.Repo.CancelBooking("A104", day, 1)
+	h.Repo.Booking("A104", day, 2, "booker@cb.amrita.edu", "19CSE302")
+
+	var moved struct {
+		Block    db.Block
+		Periods  []db.Override
+		Bookings []db.BookingRecord
+	}
+	h.DoJSON("POST", relocate, &moved, apitest.AdminKey())
+	if len(moved.Periods) != 1 || moved.Periods[0].Slot != 3 || moved.Periods[0].Room != "B201" {
+		t.Errorf("periods moved = %+v; want slot 3 to B201", moved.Periods)
+	}
+	if len(moved.Bookings) != 1 || moved.Bookings[0].Class != "B201" || moved.Bookings[0].Slot != 2 {
+		t.Errorf("bookings moved = %+v; want slot 2 to B201", moved.Bookings)
+	}
+	var subjects []string
+	h.DoJSON("GET", "/db/daytimetable?class=B201&date="+date, &subjects)
+	if want := []string{"19CSE302", "19CSE302", "19CSE311"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of B201 = %v; want %v", subjects, want)
+	}
+	h.DoJSON("GET", "/db/daytimetable?class=A104&date="+date, &subjects)
+	if want := []string{"FREE", "FREE", "MOVED:B201"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("daytimetable of A104 = %v; want %v", subjects, want)
+	}
+	var classes []string
+	h.DoJSON("GET", "/db/freeclass?slot=1&date="+date, &classes)
+	if len(classes) != 0 {
+		t.Errorf("freeclass with A104 flooded = %v; want none", classes)
+	}
+	var to []string
+	for _, msg := range h.Notifier.Sent() {
+		to = append(to, msg.To)
+	}
+	if want := []string{"faculty@cb.amrita.edu", "booker@cb.amrita.edu", "student@cb.students.amrita.edu"}; !reflect.DeepEqual(to, want) {
+		t.Errorf("notified %v; want %v", to, want)
+	}
+
+	resp, _ = h.Do("POST", "/admin/relocations?from=A104&to=A104&date="+date+"&reason=Flooded", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("relocating a room to itself = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	h := newHarness(t)
+	club := h.Login(auth.Identity{Mail: "club@cb.students.amrita.edu"})
+	other := h.Login(auth.Identity{Mail: "other@cb.students.amrita.edu"})
+	// A Tuesday at least a day ahead, so that every event starts in the future
+	tuesday := time.Now().AddDate(0, 0, 1)
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	at := func(hour int, min int) string {
+		return url.QueryEscape(time.Date(tuesday.Year(), tuesday.Month(), tuesday.Day(), hour, min, 0, 0, time.Local).Format(time.RFC3339))
+	}
+	create := func(session string, start string, end string) (*http.Response, []byte) {
+		return h.Do("POST", "/me/events?class=A104&title=Quiz&organizer=Coding+Club&start="+start+"&end="+end, apitest.Bearer(session))
+	}
+
+	// A104 has 19CSE311 in slot 3, 09:50 to 10:40
+	resp, _ := create(club, at(9, 0), at(10, 0))
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("event over a class = %d; want 409", resp.StatusCode)
+	}
+	resp, body := create(club, at(8, 0), at(9, 30))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("event in free slots = %d %s; want 201", resp.StatusCode, body)
+	}
+	var event db.Event
+	json.Unmarshal(body, &event)
+	resp, _ = create(other, at(9, 0), at(9, 45))
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("event over another event = %d; want 409", resp.StatusCode)
+	}
+	resp, _ = create(other, at(17, 0), at(19, 0))
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("evening event = %d; want 201", resp.StatusCode)
+	}
+	resp, _ = create(club, at(19, 0), at(18, 0))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("event ending before it starts = %d; want 400", resp.StatusCode)
+	}
+
+	var events []db.Event
+	h.DoJSON("GET", "/db/events?day="+tuesday.Format("2006-01-02"), &events)
+	if len(events) != 2 || events[0].ID != event.ID || events[0].CreatedBy != "" {
+		t.Errorf("events of the day = %+v; want both, without who made them", events)
+	}
+	resp, _ = h.Do("DELETE", "/me/events/"+strconv.FormatInt(event.ID, 10), apitest.Bearer(other))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting someone else's event = %d; want 404", resp.StatusCode)
+	}
+	resp, _ = h.Do("DELETE", "/me/events/"+strconv.FormatInt(event.ID, 10), apitest.Bearer(club))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting my event = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/me/events", &events, apitest.Bearer(club))
+	if len(events) != 0 {
+		t.Errorf("my events after deleting = %+v; want none", events)
+	}
+}
+
+func TestClubs(t *testing.T) {
+	h := newHarness(t)
+	coordinator := h.Login(auth.Identity{Mail: "lead@cb.students.amrita.edu"})
+	member := h.Login(auth.Identity{Mail: "member@cb.students.amrita.edu"})
+	advisor := h.Login(auth.Identity{Mail: "advisor@cb.amrita.edu"})
+	club := `{"name": "Coding Club", "advisor": "advisor@cb.amrita.edu",
+		"coordinators": ["lead@cb.students.amrita.edu"], "members": ["member@cb.students.amrita.edu"]}`
+	resp, body := h.Do("PUT", "/admin/clubs/coding-club", apitest.AdminKey(), apitest.JSONBody(club))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("adding a club = %d %s; want 200", resp.StatusCode, body)
+	}
+	resp, _ = h.Do("PUT", "/admin/clubs/Coding Club", apitest.AdminKey(), apitest.JSONBody(club))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("a club ID with spaces = %d; want 400", resp.StatusCode)
+	}
+	var clubs []db.Club
+	h.DoJSON("GET", "/db/clubs", &clubs)
+	if len(clubs) != 1 || clubs[0].Name != "Coding Club" || len(clubs[0].Coordinators) != 1 || clubs[0].Members != nil {
+		t.Errorf("clubs = %+v; want the club without its members", clubs)
+	}
+	var mine []struct {
+		ID   string
+		Role string
+	}
+	h.DoJSON("GET", "/me/clubs", &mine, apitest.Bearer(member))
+	if len(mine) != 1 || mine[0].Role != "member" {
+		t.Errorf("clubs of a member = %+v; want coding-club as a member", mine)
+	}
+	resp, _ = h.Do("PUT", "/me/clubs/coding-club/members/new@cb.students.amrita.edu?coordinator=true", apitest.Bearer(coordinator))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("a coordinator naming a coordinator = %d; want 403", resp.StatusCode)
+	}
+	resp, _ = h.Do("PUT", "/me/clubs/coding-club/members/new@cb.students.amrita.edu", apitest.Bearer(coordinator))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("a coordinator adding a member = %d; want 204", resp.StatusCode)
+	}
+
+	tuesday := time.Now().AddDate(0, 0, 1)
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	at := func(hour int) string {
+		return url.QueryEscape(time.Date(tuesday.Year(), tuesday.Month(), tuesday.Day(), hour, 0, 0, 0, time.Local).Format(time.RFC3339))
+	}
+	resp, _ = h.Do("POST", "/me/events?class=A104&title=Hackathon&club=coding-club&start="+at(17)+"&end="+at(19), apitest.Bearer(member))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("a member booking for the club = %d; want 403", resp.StatusCode)
+	}
+	resp, body = h.Do("POST", "/me/events?class=A104&title=Hackathon&club=coding-club&start="+at(17)+"&end="+at(19), apitest.Bearer(coordinator))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("a coordinator booking for the club = %d %s; want 201", resp.StatusCode, body)
+	}
+	var event db.Event
+	json.Unmarshal(body, &event)
+	if !event.Pending || event.Organizer != "Coding Club" {
+		t.Errorf("club event = %+v; want it pending, organized by the club", event)
+	}
+	var events []db.Event
+	h.DoJSON("GET", "/db/events?day="+tuesday.Format("2006-01-02"), &events)
+	if len(events) != 0 {
+		t.Errorf("events of the day = %+v; want none until approved", events)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 1 || sent[0].To != "advisor@cb.amrita.edu" {
+		t.Errorf("notifications = %+v; want the advisor asked", sent)
+	}
+
+	id := strconv.FormatInt(event.ID, 10)
+	resp, _ = h.Do("POST", "/me/events/"+id+"/approve", apitest.Bearer(coordinator))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("a coordinator approving = %d; want 404", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/me/events/pending", &events, apitest.Bearer(advisor))
+	if len(events) != 1 || events[0].ID != event.ID {
+		t.Errorf("events pending for the advisor = %+v; want the hackathon", events)
+	}
+	resp, _ = h.Do("POST", "/me/events/"+id+"/approve", apitest.Bearer(advisor))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("the advisor approving = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/db/events?day="+tuesday.Format("2006-01-02"), &events)
+	if len(events) != 1 || events[0].Club != "coding-club" {
+		t.Errorf("events of the day = %+v; want the approved hackathon", events)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 2 || sent[1].To != "lead@cb.students.amrita.edu" {
+		t.Errorf("notifications = %+v; want the coordinator told", sent)
+	}
+}
+
+func TestSuggestRoom(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddStatic("C301", "TUE", 1, "FREE")
+	h.Repo.AddStatic("C301", "TUE", 2, "FREE")
+	h.Repo.AddStatic("C301", "TUE", 3, "FREE")
+	for _, path := range []string{
+		"/admin/classrooms/A104?capacity=60&building=AB1&floor=1",
+		"/admin/classrooms/B201?capacity=40&building=AB2&floor=2",
+		"/admin/classrooms/C301?capacity=20&building=AB1&floor=3",
+	} {
+		resp, body := h.Do("PUT", path, apitest.AdminKey())
+		if resp.StatusCode/100 != 2 {
+			t.Fatalf("PUT %s = %d %s", path, resp.StatusCode, body)
+		}
+	}
+	resp, _ := h.Do("PUT", "/admin/equipment/PROJ-01?name=Epson&kind=projector&home=B201", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("adding equipment = %d; want 204", resp.StatusCode)
+	}
+
+	var suggestions []struct {
+		Class     string
+		Score     int
+		Equipment []string
+		Missing   []string
+	}
+	h.DoJSON("GET", "/db/suggestroom?day=2023-06-13&slot=2&capacity=35&needs=projector&building=AB1", &suggestions)
+	if len(suggestions) != 2 || suggestions[0].Class != "B201" || suggestions[1].Class != "A104" {
+		t.Fatalf("suggestions = %+v; want B201 with its projector before A104, C301 too small", suggestions)
+	}
+	if !reflect.DeepEqual(suggestions[0].Equipment, []string{"PROJ-01"}) || !reflect.DeepEqual(suggestions[1].Missing, []string{"projector"}) {
+		t.Errorf("suggestions = %+v; want the projector of B201 and A104 missing one", suggestions)
+	}
+	h.DoJSON("GET", "/db/suggestroom?day=2023-06-13&slot=2&capacity=20&building=AB1", &suggestions)
+	if len(suggestions) != 3 || suggestions[0].Class != "C301" || suggestions[1].Class != "A104" {
+		t.Errorf("suggestions = %+v; want the snug C301 first, then A104 in the same building", suggestions)
+	}
+	resp, _ = h.Do("GET", "/db/suggestroom?day=2023-06-13&slot=9")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("an unknown slot = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestBuildings(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddStatic("C301", "TUE", 2, "FREE")
+	h.Repo.SetStatic(db.StaticEntry{Class: "B201", Day: "TUE", Slot: 1, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE302"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	// AB2 is 300 m east of AB1; AB3 has no coordinates, only a path to AB1
+	for _, path := range []string{
+		"/admin/classrooms/A104?capacity=60&building=AB1",
+		"/admin/classrooms/B201?capacity=40&building=AB2",
+		"/admin/classrooms/C301?capacity=20&building=AB3",
+		"/admin/buildings/AB1?name=Academic%20Block%201&latitude=10.9&longitude=76.9",
+		"/admin/buildings/AB2?latitude=10.9&longitude=76.902747",
+		"/admin/buildings/AB3",
+		"/admin/buildings/AB1/paths/AB3?minutes=3",
+	} {
+		resp, body := h.Do("PUT", path, apitest.AdminKey())
+		if resp.StatusCode/100 != 2 {
+			t.Fatalf("PUT %s = %d %s", path, resp.StatusCode, body)
+		}
+	}
+	resp, _ := h.Do("PUT", "/admin/buildings/AB4?latitude=10.9", apitest.AdminKey())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("a latitude without longitude = %d; want 400", resp.StatusCode)
+	}
+	resp, _ = h.Do("PUT", "/admin/buildings/AB1/paths/AB9?minutes=3", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("a path to an unknown building = %d; want 404", resp.StatusCode)
+	}
+
+	var walked struct {
+		From, To string
+		Minutes  int
+		Metres   int
+	}
+	h.DoJSON("GET", "/db/walk?from=A104&to=AB2", &walked)
+	if walked.From != "AB1" || walked.To != "AB2" || walked.Minutes != 6 || walked.Metres < 290 || walked.Metres > 310 {
+		t.Errorf("walk = %+v; want AB1 to AB2 in 6 minutes over about 300 m", walked)
+	}
+	h.DoJSON("GET", "/db/walk?from=C301&to=B201", &walked)
+	if walked.Minutes != 9 {
+		t.Errorf("walk from C301 = %+v; want 9 minutes by the path and AB1", walked)
+	}
+
+	var classes []string
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13&near=AB3", &classes)
+	if !reflect.DeepEqual(classes, []string{"C301", "A104", "B201"}) {
+		t.Errorf("free classes near AB3 = %v; want [C301 A104 B201]", classes)
+	}
+	// The faculty member taught in B201 in slot 1 and has nothing after
+	resp, body := h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13&near=me", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != `["B201","A104","C301"]` {
+		t.Errorf("free classes near the user = %d %s; want B201, A104, C301", resp.StatusCode, body)
+	}
+	resp, _ = h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13&near=NOWHERE")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("near an unknown place = %d; want 400", resp.StatusCode)
+	}
+
+	resp, _ = h.Do("DELETE", "/admin/buildings/AB3", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("deleting a building = %d; want 204", resp.StatusCode)
+	}
+	var paths []db.BuildingPath
+	h.DoJSON("GET", "/db/buildings/paths", &paths)
+	if len(paths) != 0 {
+		t.Errorf("paths = %+v; want the path to the deleted building gone", paths)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddStatic("C301", "TUE", 2, "19ELE401")
+	student := h.Login(auth.Identity{Mail: "student@cb.students.amrita.edu"})
+	for _, path := range []string{
+		"/admin/classrooms/A104?capacity=60&building=AB1",
+		"/admin/classrooms/B201?capacity=40&building=AB2",
+		"/admin/buildings/AB1?latitude=10.9&longitude=76.9",
+		"/admin/buildings/AB2?latitude=10.9&longitude=76.902747",
+	} {
+		resp, body := h.Do("PUT", path, apitest.AdminKey())
+		if resp.StatusCode/100 != 2 {
+			t.Fatalf("PUT %s = %d %s", path, resp.StatusCode, body)
+		}
+	}
+	resp, body := h.Do("PUT", "/me/preferences", apitest.Bearer(student), apitest.JSONBody(`{"subjects": ["19CSE302", "19CSE311"]}`))
+	if resp.StatusCode/100 != 2 {
+		t.Fatalf("setting the subjects = %d %s", resp.StatusCode, body)
+	}
+
+	var gaps struct {
+		Periods []struct {
+			Slot  int
+			Class string
+		}
+		Gaps []struct {
+			StartSlot, EndSlot int
+			Start, End         string
+			Rooms              []string
+		}
+	}
+	resp, body = h.Do("GET", "/me/gaps?day=2023-06-13", apitest.Bearer(student))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("gaps = %d %s; want 200", resp.StatusCode, body)
+	}
+	json.Unmarshal(body, &gaps)
+	if len(gaps.Periods) != 2 || gaps.Periods[0].Class != "B201" || gaps.Periods[1].Class != "A104" {
+		t.Errorf("periods = %+v; want 19CSE302 in B201 and 19CSE311 in A104", gaps.Periods)
+	}
+	// The elective in C301 is not one the student takes, so slot 2 is a gap, and B201 is where they already are
+	if len(gaps.Gaps) != 1 || gaps.Gaps[0].StartSlot != 2 || gaps.Gaps[0].EndSlot != 2 ||
+		!reflect.DeepEqual(gaps.Gaps[0].Rooms, []string{"B201", "A104"}) {
+		t.Errorf("gaps = %+v; want slot 2 with B201 then A104", gaps.Gaps)
+	}
+
+	h.Do("PUT", "/me/preferences", apitest.Bearer(student), apitest.JSONBody(`{"subjects": ["19CSE302", "19CSE311", "19ELE401"]}`))
+	resp, body = h.Do("GET", "/me/gaps?day=2023-06-13", apitest.Bearer(student))
+	json.Unmarshal(body, &gaps)
+	if len(gaps.Periods) != 3 || len(gaps.Gaps) != 0 {
+		t.Errorf("gaps taking the elective = %s; want three periods and no gap", body)
+	}
+	resp, _ = h.Do("PUT", "/me/preferences", apitest.Bearer(student), apitest.JSONBody(`{"subjects": [""]}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("an empty subject = %d; want 400", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/me/gaps?day=someday", apitest.Bearer(student))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("an invalid day = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestEnrollments(t *testing.T) {
+	h := newHarness(t)
+	// Two electives run in parallel in slot 2
+	h.Repo.AddStatic("A104", "TUE", 2, "19ELE401")
+	h.Repo.AddStatic("B201", "TUE", 2, "19ELE402")
+	alice := h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"})
+	bob := h.Login(auth.Identity{Mail: "bob@cb.students.amrita.edu"})
+	for _, token := range []string{alice, bob} {
+		resp, body := h.Do("PUT", "/me/preferences", apitest.Bearer(token),
+			apitest.JSONBody(`{"subjects": ["19CSE302", "19ELE401"]}`))
+		if resp.StatusCode/100 != 2 {
+			t.Fatalf("setting the subjects = %d %s", resp.StatusCode, body)
+		}
+	}
+
+	resp, body := h.Do("POST", "/admin/enrollments", apitest.AdminKey(),
+		apitest.Body("text/csv", "subject,mail\n19ELE401,alice@cb.students.amrita.edu\n19ELE402,Bob@cb.students.amrita.edu\n"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("importing enrollments = %d %s; want 200", resp.StatusCode, body)
+	}
+	resp, _ = h.Do("POST", "/admin/enrollments", apitest.AdminKey(),
+		apitest.Body("text/csv", "subject,mail\n19XYZ999,alice@cb.students.amrita.edu\n"))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("importing an unknown subject = %d; want 400", resp.StatusCode)
+	}
+
+	var timetable struct {
+		Periods []struct {
+			Slot     int
+			Subject  string
+			Elective bool
+		}
+	}
+	resp, body = h.Do("GET", "/me/timetable?day=2023-06-13", apitest.Bearer(alice))
+	json.Unmarshal(body, &timetable)
+	if resp.StatusCode != http.StatusOK || len(timetable.Periods) != 2 || timetable.Periods[1].Subject != "19ELE401" ||
+		!timetable.Periods[1].Elective {
+		t.Errorf("timetable of alice = %d %s; want 19CSE302 and the elective 19ELE401", resp.StatusCode, body)
+	}
+	// Bob listed 19ELE401 but was allocated 19ELE402
+	resp, body = h.Do("GET", "/me/timetable?day=2023-06-13", apitest.Bearer(bob))
+	json.Unmarshal(body, &timetable)
+	if len(timetable.Periods) != 2 || timetable.Periods[1].Subject != "19ELE402" {
+		t.Errorf("timetable of bob = %s; want 19CSE302 and 19ELE402", body)
+	}
+
+	resp, _ = h.Do("DELETE", "/admin/enrollments/19ELE402", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("deleting enrollments = %d; want 204", resp.StatusCode)
+	}
+	var enrollments []db.Enrollment
+	h.DoJSON("GET", "/admin/enrollments?student=bob@cb.students.amrita.edu", &enrollments, apitest.AdminKey())
+	if len(enrollments) != 0 {
+		t.Errorf("enrollments of bob = %+v; want none", enrollments)
+	}
+}
+
+func TestCustomEntries(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"})
+	bob := h.Login(auth.Identity{Mail: "bob@cb.students.amrita.edu"})
+
+	resp, body := h.Do("POST", "/me/timetable/custom?title=Gym&day=tuesday&start=17:30&end=18:30&place=Sports%20complex",
+		apitest.Bearer(alice))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("adding an entry = %d %s; want 201", resp.StatusCode, body)
+	}
+	var entry db.CustomEntry
+	json.Unmarshal(body, &entry)
+	if entry.Day != "TUE" {
+		t.Errorf("entry = %+v; want it on TUE", entry)
+	}
+	resp, _ = h.Do("POST", "/me/timetable/custom?title=Job&day=SAT&start=10:00&end=09:00", apitest.Bearer(alice))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("an entry ending before it starts = %d; want 400", resp.StatusCode)
+	}
+
+	var timetable struct {
+		Custom []db.CustomEntry
+	}
+	_, body = h.Do("GET", "/me/timetable?day=2023-06-13", apitest.Bearer(alice))
+	json.Unmarshal(body, &timetable)
+	if len(timetable.Custom) != 1 || timetable.Custom[0].Title != "Gym" {
+		t.Errorf("timetable = %s; want the gym on Tuesday", body)
+	}
+	_, body = h.Do("GET", "/me/timetable?day=2023-06-14", apitest.Bearer(alice))
+	json.Unmarshal(body, &timetable)
+	if len(timetable.Custom) != 0 {
+		t.Errorf("timetable on Wednesday = %s; want no custom entries", body)
+	}
+	_, body = h.Do("GET", "/me/timetable?day=2023-06-13", apitest.Bearer(bob))
+	json.Unmarshal(body, &timetable)
+	if len(timetable.Custom) != 0 {
+		t.Errorf("timetable of another user = %s; want no custom entries", body)
+	}
+
+	_, body = h.Do("GET", "/me/calendar.ics", apitest.Bearer(alice))
+	if !strings.Contains(string(body), "SUMMARY:Gym") || !strings.Contains(string(body), "RRULE:FREQ=WEEKLY") {
+		t.Errorf("calendar = %s; want the gym every week", body)
+	}
+
+	id := strconv.FormatInt(entry.ID, 10)
+	resp, _ = h.Do("DELETE", "/me/timetable/custom/"+id, apitest.Bearer(bob))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting another user's entry = %d; want 404", resp.StatusCode)
+	}
+	resp, _ = h.Do("DELETE", "/me/timetable/custom/"+id, apitest.Bearer(alice))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting an entry = %d; want 204", resp.StatusCode)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddFaculty("faculty@cb.amrita.edu", "Faculty")
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	h.Repo.AddFavorite("student@cb.students.amrita.edu", db.Favorite{Kind: db.FavoriteClassroom, Target: "A104"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	student := h.Login(auth.Identity{Mail: "student@cb.students.amrita.edu"})
+	tuesday := time.Now()
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	date := tuesday.Format("2006-01-02")
+	h.Do("PUT", "/me/overrides/A104/"+date+"/3?room=B201", apitest.Bearer(faculty))
+	h.Do("PUT", "/me/overrides/A104/"+date+"/3?cancel=true", apitest.Bearer(faculty))
+	if sent := h.Notifier.Sent(); len(sent) != 2 {
+		t.Fatalf("notifications pushed = %+v; want the move and the cancellation", sent)
+	}
+
+	var inbox struct {
+		Unread        int
+		Notifications []db.Notification
+	}
+	h.DoJSON("GET", "/me/notifications", &inbox, apitest.Bearer(student))
+	if inbox.Unread != 2 || len(inbox.Notifications) != 2 || inbox.Notifications[0].ID != 2 ||
+		inbox.Notifications[0].ReadAt != nil {
+		t.Fatalf("inbox = %+v; want both unread, latest first", inbox)
+	}
+	h.DoJSON("GET", "/me/notifications", &inbox, apitest.Bearer(faculty))
+	if inbox.Unread != 0 || len(inbox.Notifications) != 0 {
+		t.Errorf("inbox of the faculty = %+v; want it empty", inbox)
+	}
+
+	var unread struct{ Unread int }
+	resp, body := h.Do("POST", "/me/notifications/read?id=1", apitest.Bearer(student))
+	json.Unmarshal(body, &unread)
+	if resp.StatusCode != http.StatusOK || unread.Unread != 1 {
+		t.Errorf("marking one read = %d %s; want 200 with one left", resp.StatusCode, body)
+	}
+	h.DoJSON("GET", "/me/notifications?unread=true", &inbox, apitest.Bearer(student))
+	if len(inbox.Notifications) != 1 || inbox.Notifications[0].ID != 2 {
+		t.Errorf("unread notifications = %+v; want only the second", inbox.Notifications)
+	}
+	if resp, _ := h.Do("POST", "/me/notifications/read?id=x", apitest.Bearer(student)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("marking a bad id read = %d; want 400", resp.StatusCode)
+	}
+	h.Do("POST", "/me/notifications/read", apitest.Bearer(student))
+	h.DoJSON("GET", "/me/notifications/unread", &unread, apitest.Bearer(student))
+	if unread.Unread != 0 {
+		t.Errorf("unread after marking all read = %d; want 0", unread.Unread)
+	}
+
+	if purged := h.Server.PurgeNotifications(time.Now().Add(89 * 24 * time.Hour)); purged != 0 {
+		t.Errorf("purged %d notifications within the retention period; want 0", purged)
+	}
+	if purged := h.Server.PurgeNotifications(time.Now().Add(91 * 24 * time.Hour)); purged != 2 {
+		t.Errorf("purged %d notifications past the retention period; want 2", purged)
+	}
+}
+
+func TestDigests(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"})
+	bob := h.Login(auth.Identity{Mail: "bob@cb.students.amrita.edu"})
+	resp, body := h.Do("PUT", "/me/preferences", apitest.Bearer(alice),
+		apitest.JSONBody(`{"subjects": ["19CSE311"], "notifications": {"digest": "daily"}}`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("asking for a daily digest = %d %s; want 200", resp.StatusCode, body)
+	}
+	h.Do("PUT", "/me/preferences", apitest.Bearer(bob),
+		apitest.JSONBody(`{"subjects": ["19CSE302"], "notifications": {"digest": "weekly", "digestVia": "mail"}}`))
+	resp, _ = h.Do("PUT", "/me/preferences", apitest.Bearer(bob),
+		apitest.JSONBody(`{"notifications": {"digest": "hourly"}}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("asking for an hourly digest = %d; want 400", resp.StatusCode)
+	}
+
+	// Monday evening, with Tuesday ahead
+	if sent := h.Server.SendDigests(time.Date(2023, 6, 12, 19, 0, 0, 0, time.Local)); sent != 1 {
+		t.Fatalf("sent %d digests on Monday; want only the daily one", sent)
+	}
+	digest := h.Notifier.Sent()[0]
+	if digest.To != "alice@cb.students.amrita.edu" || digest.Kind != "digest" ||
+		digest.Body != "Tue 13 Jun:\n  09:50 19CSE311 in A104" {
+		t.Errorf("daily digest = %+v; want alice's Tuesday", digest)
+	}
+
+	// Sunday, when the weekly digests go out and Monday has nothing for the daily one
+	if sent := h.Server.SendDigests(time.Date(2023, 6, 11, 19, 0, 0, 0, time.Local)); sent != 1 {
+		t.Fatalf("sent %d digests on Sunday; want only the weekly one", sent)
+	}
+	digest = h.Notifier.Sent()[1]
+	if digest.To != "bob@cb.students.amrita.edu" || !strings.HasPrefix(digest.Title, "Your week") ||
+		!strings.Contains(digest.Body, "Tue 13 Jun:\n  08:00 19CSE302 in B201") {
+		t.Errorf("weekly digest = %+v; want bob's week, pushed without a mail server", digest)
+	}
+}
+
+func TestBroadcasts(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	alice := h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"})
+	bob := h.Login(auth.Identity{Mail: "bob@cb.students.amrita.edu"})
+	h.Login(auth.Identity{Mail: "carol@cb.students.amrita.edu"})
+	h.Repo.AddFavorite("alice@cb.students.amrita.edu", db.Favorite{Kind: db.FavoriteSection, Target: "CSE-A"})
+	h.Repo.AddFavorite("carol@cb.students.amrita.edu", db.Favorite{Kind: db.FavoriteSection, Target: "ECE-A"})
+	h.Do("PUT", "/me/preferences", apitest.Bearer(bob), apitest.JSONBody(`{"defaultSection": "CSE-B"}`))
+
+	wait := func(path string, task *jobs.Task, opts ...apitest.Option) {
+		for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			h.DoJSON("GET", path, task, opts...)
+		}
+	}
+	resp, body := h.Do("POST", "/me/broadcasts?audience=department&target=CSE&title=Lab%20closed&body=Use%20B201",
+		apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("broadcasting to a department = %d %s; want 202", resp.StatusCode, body)
+	}
+	var task jobs.Task
+	json.Unmarshal(body, &task)
+	if task.Kind != "broadcast.send" || resp.Header.Get("Location") != "/me/broadcasts/"+task.ID {
+		t.Fatalf("task = %+v, Location %q", task, resp.Header.Get("Location"))
+	}
+	wait("/me/broadcasts/"+task.ID, &task, apitest.Bearer(faculty))
+	if task.State != jobs.TaskDone || task.Done != 2 || task.Total != 2 {
+		t.Fatalf("broadcast after it finished = %+v; want it sent to both CSE students", task)
+	}
+	sent := h.Notifier.Sent()
+	if len(sent) != 2 || sent[0].To != "alice@cb.students.amrita.edu" || sent[1].To != "bob@cb.students.amrita.edu" ||
+		sent[0].Kind != "broadcast" || sent[0].Body != "Use B201" {
+		t.Errorf("broadcast messages = %+v; want alice and bob", sent)
+	}
+	if resp, _ := h.Do("GET", "/me/broadcasts/"+task.ID, apitest.Bearer(alice)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("someone else's broadcast = %d; want 404", resp.StatusCode)
+	}
+
+	if resp, _ := h.Do("POST", "/me/broadcasts?audience=section&target=CSE-A&title=Hi", apitest.Bearer(alice)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("a student broadcasting = %d; want 403", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/me/broadcasts?audience=all&title=Hi", apitest.Bearer(faculty)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("faculty broadcasting to everyone = %d; want 403", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/me/broadcasts?audience=section&target=CSE-A&title=Hi&via=mail", apitest.Bearer(faculty)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("mailing without a mail server = %d; want 400", resp.StatusCode)
+	}
+	for i := 0; i < 2; i++ {
+		h.Do("POST", "/me/broadcasts?audience=section&target=CSE-A&title=Hi", apitest.Bearer(faculty))
+	}
+	resp, _ = h.Do("POST", "/me/broadcasts?audience=section&target=CSE-A&title=Hi", apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("a fourth broadcast in a minute = %d; want 429 with Retry-After", resp.StatusCode)
+	}
+
+	resp, body = h.Do("POST", "/admin/broadcasts?audience=all&title=Holiday", apitest.AdminKey())
+	json.Unmarshal(body, &task)
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get("Location") != "/admin/tasks/"+task.ID {
+		t.Fatalf("broadcasting to everyone = %d %s; want 202", resp.StatusCode, body)
+	}
+	wait("/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+	if task.State != jobs.TaskDone || task.Total != 4 {
+		t.Errorf("broadcast to everyone = %+v; want it sent to the four users", task)
+	}
+}
+
+func TestFeedback(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"})
+
+	resp, body := h.Do("POST", "/feedback?category=timetable&entityKind=period&entityId=A104/tuesday/3&message=Held%20in%20B201",
+		apitest.Bearer(alice))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("reporting a period = %d %s; want 201", resp.StatusCode, body)
+	}
+	var report db.Feedback
+	json.Unmarshal(body, &report)
+	if report.EntityID != "A104/TUE/3" || report.Mail != "alice@cb.students.amrita.edu" || report.Status != "open" {
+		t.Errorf("report = %+v; want alice's open report of A104/TUE/3", report)
+	}
+	resp, _ = h.Do("POST", "/feedback?category=room&entityKind=classroom&entityId=A104&message=Projector%20broken")
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("an anonymous report = %d; want 201", resp.StatusCode)
+	}
+	h.Do("POST", "/feedback?category=timetable&entityKind=period&entityId=A104/TUE/3&message=Wrong%20room")
+	if resp, _ := h.Do("POST", "/feedback?category=room&entityKind=classroom&entityId=Z999&message=Hot"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("a report about an unknown classroom = %d; want 404", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/feedback?category=rant&message=Hi"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("a report of an unknown category = %d; want 400", resp.StatusCode)
+	}
+
+	var entries []struct {
+		db.Feedback
+		SameEntity int
+	}
+	h.DoJSON("GET", "/admin/feedback", &entries, apitest.AdminKey())
+	if len(entries) != 3 || entries[0].EntityID != "A104/TUE/3" || entries[0].SameEntity != 2 || entries[1].SameEntity != 1 {
+		t.Fatalf("open feedback = %+v; want the three reports, two about A104/TUE/3", entries)
+	}
+	if resp, _ := h.Do("POST", "/admin/feedback/1/resolve?note=Moved%20to%20B201%20for%20good", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("resolving a report = %d; want 204", resp.StatusCode)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 1 || sent[0].To != "alice@cb.students.amrita.edu" || sent[0].Body != "Moved to B201 for good" {
+		t.Errorf("notifications = %+v; want alice told", sent)
+	}
+	if resp, _ := h.Do("POST", "/admin/feedback/1/dismiss", apitest.AdminKey()); resp.StatusCode != http.StatusConflict {
+		t.Errorf("dismissing a resolved report = %d; want 409", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/admin/feedback/9/dismiss", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("dismissing an unknown report = %d; want 404", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/admin/feedback?status=open&category=timetable", &entries, apitest.AdminKey())
+	if len(entries) != 1 || entries[0].ID != 3 || entries[0].SameEntity != 1 {
+		t.Errorf("open timetable feedback = %+v; want the third report alone", entries)
+	}
+
+	var mine []db.Feedback
+	h.DoJSON("GET", "/me/feedback", &mine, apitest.Bearer(alice))
+	if len(mine) != 1 || mine[0].Status != "resolved" || mine[0].Note != "Moved to B201 for good" {
+		t.Errorf("alice's feedback = %+v; want her resolved report", mine)
+	}
+
+	for i := 0; i < 5; i++ {
+		resp, _ = h.Do("POST", "/feedback?category=app&message=Crash", apitest.Bearer(alice))
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("a burst of reports = %d; want 429", resp.StatusCode)
+	}
+}
+
+func TestPrivacy(t *testing.T) {
+	h := newHarness(t)
+	alice := h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"})
+	h.Do("PUT", "/me/preferences", apitest.Bearer(alice), apitest.JSONBody(`{"subjects": ["19CSE311"]}`))
+	h.Do("POST", "/feedback?category=app&message=Crash", apitest.Bearer(alice))
+
+	var export map[string]json.RawMessage
+	resp, body := h.Do("GET", "/me/export", apitest.Bearer(alice))
+	json.Unmarshal(body, &export)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Disposition"), ".json") {
+		t.Fatalf("exporting = %d %s; want a JSON download", resp.StatusCode, resp.Header.Get("Content-Disposition"))
+	}
+	if !strings.Contains(string(export["preferences"]), "19CSE311") || !strings.Contains(string(export["feedback"]), "Crash") ||
+		!strings.Contains(string(export["sessions"]), "alice@") {
+		t.Errorf("export = %s; want alice's preferences, feedback and session", body)
+	}
+	resp, body = h.Do("GET", "/me/export?format=zip", apitest.Bearer(alice))
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if resp.StatusCode != http.StatusOK || err != nil || len(archive.File) != len(export) {
+		t.Errorf("zip export = %d %v; want a file per section", resp.StatusCode, err)
+	}
+
+	if resp, _ := h.Do("POST", "/me/delete?reason=Leaving", apitest.Bearer(alice)); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("asking for erasure = %d; want 202", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/me/delete", apitest.Bearer(alice)); resp.StatusCode != http.StatusConflict {
+		t.Errorf("asking twice = %d; want 409", resp.StatusCode)
+	}
+	var requests []db.ErasureRequest
+	h.DoJSON("GET", "/admin/erasures", &requests, apitest.AdminKey())
+	if len(requests) != 1 || requests[0].Mail != "alice@cb.students.amrita.edu" || requests[0].Reason != "Leaving" {
+		t.Fatalf("pending erasures = %+v; want alice's", requests)
+	}
+	if resp, _ := h.Do("POST", "/admin/erasures/1/reject?note=Exams%20pending", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("rejecting = %d; want 204", resp.StatusCode)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 1 || sent[0].Body != "Exams pending" {
+		t.Errorf("notifications = %+v; want alice told why", sent)
+	}
+	if resp, _ := h.Do("POST", "/admin/erasures/1/approve", apitest.AdminKey()); resp.StatusCode != http.StatusConflict {
+		t.Errorf("approving a rejected request = %d; want 409", resp.StatusCode)
+	}
+
+	h.Do("POST", "/me/delete", apitest.Bearer(alice))
+	var result struct {
+		Status string
+		Erased int
+	}
+	resp, body = h.Do("POST", "/admin/erasures/2/approve", apitest.AdminKey())
+	json.Unmarshal(body, &result)
+	if resp.StatusCode != http.StatusOK || result.Status != "approved" || result.Erased == 0 {
+		t.Fatalf("approving = %d %s; want alice's data erased", resp.StatusCode, body)
+	}
+	if resp, _ := h.Do("GET", "/me/export", apitest.Bearer(alice)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("alice's session after erasure = %d; want 401", resp.StatusCode)
+	}
+	if reports, _ := h.Repo.GetFeedback(db.FeedbackFilter{}); len(reports) != 1 || reports[0].Mail != "" {
+		t.Errorf("feedback = %+v; want alice's report kept without her mail", reports)
+	}
+	if data, _ := h.Repo.GetPreferences("alice@cb.students.amrita.edu"); data != "" {
+		t.Errorf("preferences = %q; want none", data)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	h := apitest.New(t, func(config *api.Config) {
+		config.Retention = map[string]time.Duration{"bookings": 24 * time.Hour, "audit": 365 * 24 * time.Hour}
+	})
+	h.Repo.AddSlot(2, "08:50:00", "09:40:00")
+	h.Repo.AddStatic("B201", "TUE", 2, "FREE")
+	h.Do("GET", "/db/booking?class=B201&date=2023-06-13&slot=2&faculty=f&subject=s")
+	h.Repo.RecordAudit(db.AuditEvent{Actor: "admin", Action: "slot.set", At: time.Now().AddDate(-2, 0, 0)})
+	h.Repo.RecordAudit(db.AuditEvent{Actor: "admin", Action: "slot.set", At: time.Now()})
+
+	var preview []struct {
+		Kind      string
+		Retention string
+		Expired   int64
+	}
+	h.DoJSON("GET", "/admin/retention", &preview, apitest.AdminKey())
+	if len(preview) != 2 || preview[0].Kind != "bookings" || preview[0].Expired != 1 ||
+		preview[1].Kind != "audit" || preview[1].Retention != "8760h0m0s" || preview[1].Expired != 1 {
+		t.Fatalf("preview = %+v; want the old booking and audit entry", preview)
+	}
+	purged := h.Server.PurgeExpired(time.Now())
+	if want := map[string]int64{"bookings": 1, "audit": 1}; !reflect.DeepEqual(purged, want) {
+		t.Errorf("purged = %v; want %v", purged, want)
+	}
+	if events, _ := h.Repo.GetAuditEvents("", 10); len(events) != 1 {
+		t.Errorf("audit log = %+v; want the recent entry kept", events)
+	}
+	h.DoJSON("GET", "/admin/retention", &preview, apitest.AdminKey())
+	if preview[0].Expired != 0 || preview[1].Expired != 0 {
+		t.Errorf("preview after purging = %+v; want nothing left", preview)
+	}
+
+	if err := api.ValidateRetention(map[string]time.Duration{"logs": time.Hour}); err == nil {
+		t.Error("a retention for an unknown kind was accepted")
+	}
+	if err := api.ValidateRetention(map[string]time.Duration{"sessions": -time.Hour}); err == nil {
+		t.Error("a negative retention was accepted")
+	}
+}
+
+func TestBackups(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.SetClassroom(db.Classroom{ID: "A104", Capacity: 60, Building: "AB1"})
+	h.Do("GET", "/db/booking?class=B201&date=2023-06-13&slot=2&faculty=f@cb.amrita.edu&subject=19CSE302")
+
+	var backup db.Backup
+	resp, body := h.Do("POST", "/admin/backups", apitest.AdminKey())
+	json.Unmarshal(body, &backup)
+	if resp.StatusCode != http.StatusCreated || backup.Periods != 6 || backup.Classrooms != 1 || backup.Bookings != 1 {
+		t.Fatalf("backing up = %d %s; want the six periods, a classroom and a booking", resp.StatusCode, body)
+	}
+	var backups []db.Backup
+	h.DoJSON("GET", "/admin/backups", &backups, apitest.AdminKey())
+	if len(backups) != 1 || backups[0].ID != backup.ID {
+		t.Errorf("backups = %+v; want the one taken", backups)
+	}
+
+	// The mistakes to recover from
+	h.Do("PUT", "/admin/timetable/A104/TUE/1?subject=19CSE302", apitest.AdminKey())
+	h.Repo.CancelBooking("B201", time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC), 2)
+	h.Repo.SetClassroom(db.Classroom{ID: "A104", Capacity: 10, Building: "AB1"})
+
+	var preview struct {
+		DryRun  bool
+		Changes struct {
+			Timetable struct{ Changed []interface{} }
+			Bookings  int
+		}
+	}
+	h.DoJSON("POST", "/admin/backups/"+backup.ID+"/restore?dryRun=true", &preview, apitest.AdminKey())
+	if !preview.DryRun || len(preview.Changes.Timetable.Changed) != 1 || preview.Changes.Bookings != 1 {
+		t.Fatalf("preview = %+v; want a period and a booking put back", preview)
+	}
+	if classrooms, _ := h.Repo.GetClassrooms(); classrooms[0].Capacity != 10 {
+		t.Error("a dry run restored the classrooms")
+	}
+	var result struct {
+		Bookings  int
+		Snapshot  int64
+		Conflicts []string
+	}
+	resp, body = h.Do("POST", "/admin/backups/"+backup.ID+"/restore", apitest.AdminKey())
+	json.Unmarshal(body, &result)
+	if resp.StatusCode != http.StatusOK || result.Bookings != 1 || result.Snapshot == 0 || len(result.Conflicts) != 0 {
+		t.Fatalf("restoring = %d %s; want the booking back and a snapshot", resp.StatusCode, body)
+	}
+	if entries, _ := h.Repo.GetStatic(db.TimetableFilter{Class: "A104", Day: "TUE"}); entries[0].Subject != "FREE" {
+		t.Errorf("A104 TUE 1 = %+v; want FREE again", entries[0])
+	}
+	if classrooms, _ := h.Repo.GetClassrooms(); classrooms[0].Capacity != 60 {
+		t.Errorf("classrooms = %+v; want A104 back to 60 seats", classrooms)
+	}
+	// A lab set since reaches over the slot of the booking
+	h.Repo.CancelBooking("B201", time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC), 2)
+	h.Do("PUT", "/admin/timetable/B201/TUE/1?subject=19CSE302&span=2", apitest.AdminKey())
+	h.DoJSON("POST", "/admin/backups/"+backup.ID+"/restore?tables=bookings&dryRun=true", &preview, apitest.AdminKey())
+	if preview.Changes.Bookings != 0 {
+		t.Errorf("preview under a lab = %+v; want the booking not put back", preview)
+	}
+
+	resp, body = h.Do("GET", "/admin/backups/"+backup.ID, apitest.AdminKey())
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Disposition"), "backup-") {
+		t.Fatalf("downloading = %d; want the backup", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/admin/restore?tables=classrooms", apitest.AdminKey(), apitest.JSONBody(string(body))); resp.StatusCode != http.StatusOK {
+		t.Errorf("restoring an upload = %d; want 200", resp.StatusCode)
+	}
+	bad := strings.Replace(string(body), `"slot":2`, `"slot":9`, 1)
+	if resp, body := h.Do("POST", "/admin/restore", apitest.AdminKey(), apitest.JSONBody(bad)); resp.StatusCode != http.StatusBadRequest ||
+		!strings.Contains(string(body), "no such slot 9") {
+		t.Errorf("restoring a backup with an unknown slot = %d %s; want 400", resp.StatusCode, body)
+	}
+	if resp, _ := h.Do("POST", "/admin/restore?tables=exams", apitest.AdminKey(), apitest.JSONBody(string(body))); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("restoring an unknown table = %d; want 400", resp.StatusCode)
+	}
+
+	if resp, _ := h.Do("DELETE", "/admin/backups/"+backup.ID, apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/admin/backups/"+backup.ID+"/restore", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("restoring a deleted backup = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestERPImport(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"classrooms.csv": "id,capacity,building\nA104,60,AB1\n",
+		"courses.csv":    "code,title\n19CSE311,Compilers\n19CSE302,Networks\n",
+		"timetable.csv": "class,day,start,end,course\nA104,Tuesday,08:00,09:40,19CSE302\nA104,TUE,10:00,10:40,19CSE311\n" +
+			"B201,TUE,08:50,09:40,19CSE399\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := apitest.New(t, func(config *api.Config) {
+		config.Importers = []erp.Importer{erp.CSV{ImporterName: "exports", Dir: dir}}
+	})
+	h.Repo.AddSlot(1, "08:00:00", "08:50:00")
+	h.Repo.AddSlot(2, "08:50:00", "09:40:00")
+	h.Repo.AddSlot(3, "09:50:00", "10:40:00")
+	h.Repo.AddStatic("A104", "TUE", 1, "FREE")
+	h.Repo.AddStatic("A104", "TUE", 2, "FREE")
+	h.Repo.AddStatic("A104", "TUE", 3, "19CSE311")
+	h.Repo.AddStatic("B201", "TUE", 1, "19CSE302")
+	tuesday := time.Now().AddDate(0, 0, 1)
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	h.Do("GET", "/db/booking?class=A104&date="+tuesday.Format("2006-01-02")+"&slot=2&faculty=f@cb.amrita.edu&subject=19CSE311")
+
+	run := func(path string) (jobs.Task, map[string]interface{}) {
+		resp, body := h.Do("POST", path, apitest.AdminKey())
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("%s = %d %s; want 202", path, resp.StatusCode, body)
+		}
+		var task jobs.Task
+		json.Unmarshal(body, &task)
+		for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			h.DoJSON("GET", "/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+		}
+		result, _ := task.Result.(map[string]interface{})
+		return task, result
+	}
+	task, result := run("/admin/imports/exports/run?dryRun=true")
+	timetable, _ := result["timetable"].(map[string]interface{})
+	changed, _ := timetable["changed"].([]interface{})
+	conflicts, _ := result["conflicts"].([]interface{})
+	if task.State != jobs.TaskDone || task.Kind != "erp.import" || result["classrooms"] != 1.0 || result["courses"] != 2.0 ||
+		len(changed) != 2 || len(conflicts) != 3 {
+		t.Fatalf("dry run = %+v; want A104 TUE 3 and B201 TUE 1 freed, and the booked, unknown slot and course conflicts", task)
+	}
+	if entries, _ := h.Repo.GetStatic(db.TimetableFilter{Class: "A104", Day: "TUE", Slot: 3}); entries[0].Subject != "19CSE311" {
+		t.Error("a dry run changed the timetable")
+	}
+
+	task, result = run("/admin/imports/exports/run")
+	if task.State != jobs.TaskDone || result["snapshot"] == nil {
+		t.Fatalf("import = %+v; want it done with a snapshot", task)
+	}
+	for _, key := range []db.TimetableFilter{{Class: "A104", Day: "TUE", Slot: 1}, {Class: "A104", Day: "TUE", Slot: 3},
+		{Class: "B201", Day: "TUE", Slot: 1}} {
+		if entries, _ := h.Repo.GetStatic(key); entries[0].Subject != "FREE" {
+			t.Errorf("%s TUE %d = %+v; want FREE", key.Class, key.Slot, entries[0])
+		}
+	}
+	if classrooms, _ := h.Repo.GetClassrooms(); len(classrooms) != 1 || classrooms[0].Capacity != 60 {
+		t.Errorf("classrooms = %+v; want A104 with 60 seats", classrooms)
+	}
+	if catalog, _ := h.Repo.GetCatalog(); len(catalog.Subjects) != 2 || catalog.Subjects[0].Name != "Networks" {
+		t.Errorf("subjects = %+v; want the two courses", catalog.Subjects)
+	}
+	var importers []struct {
+		Name    string
+		LastRun *struct{ Conflicts []string }
+	}
+	h.DoJSON("GET", "/admin/imports", &importers, apitest.AdminKey())
+	if len(importers) != 1 || importers[0].LastRun == nil || len(importers[0].LastRun.Conflicts) != 3 {
+		t.Errorf("importers = %+v; want exports with its last run", importers)
+	}
+	if events, _ := h.Repo.GetAuditEvents("erp.import", 10); len(events) != 1 || events[0].Target != "exports" {
+		t.Errorf("audit = %+v; want the import", events)
+	}
+	if resp, _ := h.Do("POST", "/admin/imports/nope/run", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("running an unknown importer = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestStreamedLists(t *testing.T) {
+	h := newHarness(t)
+	for i := 0; i < 600; i++ {
+		h.Repo.RecordAudit(db.AuditEvent{Actor: "admin", Action: "slot.set", Target: strconv.Itoa(i), At: time.Now()})
+	}
+	resp, body := h.Do("GET", "/admin/audit?limit=1000", apitest.AdminKey())
+	var events []db.AuditEvent
+	if err := json.Unmarshal(body, &events); err != nil || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("audit = %s %v; want a JSON array", resp.Header.Get("Content-Type"), err)
+	}
+	if len(events) != 600 || events[0].Target != "599" {
+		t.Errorf("audit with limit=1000 = %d events; want all 600, the latest first", len(events))
+	}
+	if _, body := h.Do("GET", "/admin/audit?action=nothing", apitest.AdminKey()); string(body) != "[]" {
+		t.Errorf("audit of an action never taken = %s; want []", body)
+	}
+
+	h.Do("GET", "/db/freeclass?slot=1&date=2023-06-13")
+	h.Do("GET", "/db/freeslot?class=B201&date=2023-06-13")
+	today := time.Now().Format("2006-01-02")
+	var searches []db.SearchEvent
+	h.DoJSON("GET", "/admin/analytics/events?startDate="+today+"&endDate="+today, &searches, apitest.AdminKey())
+	if len(searches) != 2 || searches[0].Kind != db.SearchFreeClass || searches[1].Class != "B201" {
+		t.Errorf("search events = %+v; want the two searches, oldest first", searches)
+	}
+}
+
+// Collects the surrogate keys purged
+type purgeRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (p *purgeRecorder) Purge(keys ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append(p.keys, keys...)
+}
+
+func (p *purgeRecorder) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := p.keys
+	p.keys = nil
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCDNHeaders(t *testing.T) {
+	purger := &purgeRecorder{}
+	h := newHarness(t, func(config *api.Config) {
+		config.CDNMaxAge = time.Minute
+		config.Purger = purger
+	})
+
+	resp, _ := h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13&campus=all")
+	if got := resp.Header.Get("Cache-Control"); got != "public, max-age=0, s-maxage=60" {
+		t.Errorf("freeclass Cache-Control = %q; want public for a minute", got)
+	}
+	if got := resp.Header.Get("Surrogate-Key"); got != "free free:2023-06-13 free:TUE" {
+		t.Errorf("freeclass Surrogate-Key = %q", got)
+	}
+	if vary := resp.Header.Get("Vary"); vary != "Origin" {
+		t.Errorf("freeclass Vary = %q; want Origin", vary)
+	}
+	// The preferred campus of whoever asks stands in for a missing campus
+	resp, _ = h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13")
+	if got := resp.Header.Get("Cache-Control"); got != "private, no-cache" || resp.Header.Get("Surrogate-Key") != "" {
+		t.Errorf("freeclass without campus Cache-Control = %q; want private", got)
+	}
+	resp, _ = h.Do("GET", "/db/multiFreeSlot?startSlot=1&endSlot=2&date=2023-06-13&campus=all&onlyFavorites=true", apitest.Bearer(h.Login(auth.Identity{Mail: "f@cb.amrita.edu"})))
+	if got := resp.Header.Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("multiFreeSlot of favorites Cache-Control = %q; want private", got)
+	}
+	resp, _ = h.Do("GET", "/db/freeslot?class=B201&date=2023-06-13")
+	if got := resp.Header.Get("Surrogate-Key"); got != "free free:2023-06-13 free:TUE" {
+		t.Errorf("freeslot Surrogate-Key = %q", got)
+	}
+	resp, _ = h.Do("GET", "/db/getAllSlot")
+	if got := resp.Header.Get("Surrogate-Key"); got != "slots" || !strings.HasPrefix(resp.Header.Get("Cache-Control"), "public") {
+		t.Errorf("getAllSlot Surrogate-Key = %q, Cache-Control = %q", got, resp.Header.Get("Cache-Control"))
+	}
+	// Failures are not cacheable
+	resp, _ = h.Do("GET", "/db/freeclass?slot=x&date=2023-06-13&campus=all")
+	if got := resp.Header.Get("Cache-Control"); got != "" {
+		t.Errorf("failed freeclass Cache-Control = %q; want none", got)
+	}
+	if keys := purger.take(); len(keys) != 0 {
+		t.Errorf("lookups purged %v", keys)
+	}
+
+	h.Do("GET", "/db/booking?class=B201&date=2023-06-13&slot=2&faculty=f&subject=s")
+	if keys := purger.take(); !reflect.DeepEqual(keys, []string{"free:2023-06-13"}) {
+		t.Errorf("booking purged %v; want its date", keys)
+	}
+	h.Do("PUT", "/admin/timetable/A104/TUE/3?subject=FREE", apitest.AdminKey())
+	if keys := purger.take(); !reflect.DeepEqual(keys, []string{"free:TUE", "slots"}) {
+		t.Errorf("timetable edit purged %v; want its day and the slots", keys)
+	}
+
+	h = newHarness(t)
+	resp, _ = h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13&campus=all")
+	if got := resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("freeclass without a CDN Cache-Control = %q; want no-cache", got)
+	}
+
+	// A shared host serves every tenant under the same URLs
+	h = newHarness(t, func(config *api.Config) {
+		config.CDNMaxAge = time.Minute
+		config.Tenant = "amrita"
+	})
+	handler, err := api.TenantHandler([]api.Tenant{{Name: "amrita", Hosts: []string{"cora.amrita.edu"}, Handler: h.Router}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	cacheControl := func(host string) string {
+		req, _ := http.NewRequest("GET", ts.URL+"/db/getAllSlot", nil)
+		req.Host = host
+		req.Header.Set("Authorization", "Bearer amrita.0123")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.Header.Get("Cache-Control")
+	}
+	if got := cacheControl("cora.amrita.edu"); got != "public, max-age=0, s-maxage=60" {
+		t.Errorf("getAllSlot on the tenant's host Cache-Control = %q; want public", got)
+	}
+	if got := cacheControl("api.cora.app"); got != "private, no-cache" {
+		t.Errorf("getAllSlot on a shared host Cache-Control = %q; want private", got)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	h := newHarness(t)
+	key := apitest.Header("Idempotency-Key", "7c0e2b9a-booking-1")
+	booking := "/db/booking?class=A104&date=2023-06-13&slot=1&faculty=f@cb.amrita.edu&subject=19CSE311"
+
+	resp, first := h.Do("GET", booking, key)
+	if resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("first booking replayed")
+	}
+	// The app retries after the connection dropped, the booking is not made twice
+	resp, retried := h.Do("GET", booking, key)
+	if resp.Header.Get("Idempotent-Replayed") != "true" || !bytes.Equal(first, retried) || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("retry = %s %q %v; want the first response %s replayed", resp.Status, retried, resp.Header, first)
+	}
+	var inserted map[string]bool
+	json.Unmarshal(retried, &inserted)
+	if !inserted["inserted"] {
+		t.Errorf("retry = %s; want the booking of the first request", retried)
+	}
+	if bookings := h.Repo.GetBooking("f@cb.amrita.edu"); len(bookings) != 1 {
+		t.Errorf("got %d bookings; want 1", len(bookings))
+	}
+	// Without the key a second request runs, and finds the slot taken
+	h.DoJSON("GET", booking, &inserted)
+	if inserted["inserted"] {
+		t.Errorf("booking again without a key inserted")
+	}
+	if resp, _ := h.Do("GET", strings.Replace(booking, "slot=1", "slot=2", 1), key); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("key used for another booking = %s; want 422", resp.Status)
+	}
+	if resp, _ := h.Do("GET", booking, apitest.Header("Idempotency-Key", "two words")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid key = %s; want 400", resp.Status)
+	}
+
+	// POST requests take a key everywhere, it is only ever replayed to the same user
+	alice := apitest.Bearer(h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"}))
+	bob := apitest.Bearer(h.Login(auth.Identity{Mail: "bob@cb.students.amrita.edu"}))
+	key = apitest.Header("Idempotency-Key", "favorite-1")
+	h.Do("POST", "/me/favorites?kind=classroom&id=A104", alice, key)
+	if resp, _ := h.Do("POST", "/me/favorites?kind=classroom&id=A104", alice, key); resp.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retried POST was not replayed")
+	}
+	if resp, _ := h.Do("POST", "/me/favorites?kind=classroom&id=A104", bob, key); resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Errorf("another user got a replay of the key")
+	}
+}
+
+func TestBookingIfMatch(t *testing.T) {
+	h := newHarness(t)
+	h.Do("GET", "/db/booking?class=A104&date=2023-06-13&slot=1&faculty=f@cb.amrita.edu&subject=19CSE311")
+
+	var booking db.BookingRecord
+	resp, body := h.Do("GET", "/db/bookings/A104/2023-06-13/1")
+	json.Unmarshal(body, &booking)
+	if resp.Header.Get("ETag") != `"1"` || booking.Version != 1 || booking.Subject != "19CSE311" {
+		t.Fatalf("booking = %+v, ETag %q; want version 1", booking, resp.Header.Get("ETag"))
+	}
+	if resp, _ := h.Do("GET", "/db/bookings/A104/2023-06-13/2"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing booking = %s; want 404", resp.Status)
+	}
+
+	// Another client hands the booking to a colleague first
+	update := "/db/updateBooking?class=A104&date=2023-06-13&slot=1&faculty=g@cb.amrita.edu&subject=19CSE311"
+	resp, body = h.Do("GET", update, apitest.Header("If-Match", `"1"`))
+	json.Unmarshal(body, &booking)
+	if resp.StatusCode != http.StatusOK || booking.Faculty != "g@cb.amrita.edu" || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("update = %s %+v; want version 2 of g's booking", resp.Status, booking)
+	}
+
+	// The first client's cancel, based on version 1, fails with the booking as it is now
+	resp, body = h.Do("GET", "/db/cancelBooking?class=A104&date=2023-06-13&slot=1", apitest.Header("If-Match", `"1"`))
+	var current db.BookingRecord
+	json.Unmarshal(body, &current)
+	if resp.StatusCode != http.StatusPreconditionFailed || current.Faculty != "g@cb.amrita.edu" || resp.Header.Get("ETag") != `"2"` {
+		t.Errorf("stale cancel = %s %s; want 412 with version 2", resp.Status, body)
+	}
+	if resp, _ := h.Do("GET", update, apitest.Header("If-Match", `"1"`)); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("stale update = %s; want 412", resp.Status)
+	}
+	if resp, _ := h.Do("DELETE", "/admin/bookings/A104/2023-06-13/1", apitest.AdminKey(), apitest.Header("If-Match", `"1"`)); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("stale admin cancel = %s; want 412", resp.Status)
+	}
+	if resp, _ := h.Do("GET", "/db/cancelBooking?class=A104&date=2023-06-13&slot=1", apitest.Header("If-Match", "two")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid If-Match = %s; want 400", resp.Status)
+	}
+
+	resp, _ = h.Do("GET", "/db/cancelBooking?class=A104&date=2023-06-13&slot=1", apitest.Header("If-Match", `"2"`))
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("cancel = %s; want 302", resp.Status)
+	}
+	if resp, _ := h.Do("GET", update, apitest.Header("If-Match", `"2"`)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("update of a cancelled booking = %s; want 404", resp.Status)
+	}
+	if resp, _ := h.Do("GET", "/db/cancelBooking?class=A104&date=2023-06-13&slot=1", apitest.Header("If-Match", `"2"`)); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("cancel of a cancelled booking = %s; want 412", resp.Status)
+	}
+}
+
+func TestJSONResponses(t *testing.T) {
+	h := newHarness(t)
+	session := h.Login(auth.Identity{Mail: "student@cb.amrita.edu"})
+
+	resp, body := h.Do("GET", "/me/favorites", apitest.Bearer(session))
+	if strings.TrimSpace(string(body)) != "[]" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("no favorites = %q %s; want an empty JSON array", resp.Header.Get("Content-Type"), body)
+	}
+	h.Do("POST", "/me/favorites?kind=classroom&id=B201", apitest.Bearer(session))
+	_, body = h.Do("GET", "/me/favorites?pretty=1", apitest.Bearer(session))
+	if !strings.HasPrefix(string(body), "[\n  {\n    \"") {
+		t.Errorf("pretty favorites = %s; want them indented", body)
+	}
+	_, body = h.Do("GET", "/db/getAllSlot?pretty=true")
+	if !strings.HasPrefix(string(body), "[\n  ") {
+		t.Errorf("pretty cached slots = %s; want them indented", body)
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	h := newHarness(t)
+
+	resp, body := h.Do("GET", "/db/freeclass?slot=x&date=2023-06-13", apitest.Header("Accept-Language", "ta-IN,en;q=0.5"))
+	if resp.StatusCode != http.StatusBadRequest || strings.TrimSpace(string(body)) != "slot மதிப்பு தவறானது" ||
+		resp.Header.Get("Content-Language") != "ta" {
+		t.Errorf("a bad slot in Tamil = %d %q %s; want the error in Tamil", resp.StatusCode, resp.Header.Get("Content-Language"), body)
+	}
+	if _, body := h.Do("GET", "/db/freeclass?slot=x&date=2023-06-13"); strings.TrimSpace(string(body)) != "Invalid slot value" {
+		t.Errorf("a bad slot = %s; want the error in English", body)
+	}
+
+	alice := h.Login(auth.Identity{Mail: "alice@cb.students.amrita.edu"})
+	h.Do("PUT", "/me/preferences", apitest.Bearer(alice), apitest.JSONBody(`{"language": "ta"}`))
+	_, body = h.Do("POST", "/me/favorites?kind=planet&id=A104", apitest.Bearer(alice), apitest.Header("Accept-Language", "en"))
+	if strings.TrimSpace(string(body)) != "kind மதிப்பு தவறானது" {
+		t.Errorf("an error for alice = %s; want it in her language over the browser's", body)
+	}
+	h.Do("POST", "/feedback?category=room&entityKind=classroom&entityId=A104&message=Hot", apitest.Bearer(alice))
+	h.Do("POST", "/admin/feedback/1/resolve", apitest.AdminKey())
+	if sent := h.Notifier.Sent(); len(sent) != 1 || sent[0].Title != "உங்கள் புகார் தீர்க்கப்பட்டது" || sent[0].Body != "தெரிவித்ததற்கு நன்றி." {
+		t.Errorf("notifications = %+v; want alice told in Tamil", sent)
+	}
+}
+
+func TestTimetableText(t *testing.T) {
+	h := newHarness(t)
+
+	want := "A104, Tuesday 13 June 2023\n" +
+		"Period 1, 08:00 to 08:50: free.\n" +
+		"Period 2, 08:50 to 09:40: free.\n" +
+		"Period 3, 09:50 to 10:40: 19CSE311.\n"
+	resp, body := h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-13&format=txt")
+	if string(body) != want || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("format=txt = %q %q; want %q", resp.Header.Get("Content-Type"), body, want)
+	}
+	if _, body := h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-13", apitest.Header("Accept", "text/plain, application/json;q=0.5")); string(body) != want {
+		t.Errorf("Accept: text/plain = %q; want %q", body, want)
+	}
+	if resp, _ := h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-13", apitest.Header("Accept", "text/html,*/*;q=0.8")); resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("a browser got %q; want JSON", resp.Header.Get("Content-Type"))
+	}
+	if resp, _ := h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-13&format=pdf"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("format=pdf = %d; want 400", resp.StatusCode)
+	}
+	if _, body := h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-18&format=txt"); string(body) != "A104, Sunday 18 June 2023\nNo classes.\n" {
+		t.Errorf("a Sunday = %q; want no classes", body)
+	}
+	resp, body = h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-13&format=txt", apitest.Header("Accept-Language", "ta"))
+	if !strings.Contains(string(body), "பாடவேளை 1, 08:00 முதல் 08:50 வரை: காலி.") || resp.Header.Get("Content-Language") != "ta" {
+		t.Errorf("in Tamil = %q %s; want the periods in Tamil", resp.Header.Get("Content-Language"), body)
+	}
+}
+
+func TestSMS(t *testing.T) {
+	sms := &notify.MemorySMS{}
+	h := newHarness(t, func(config *api.Config) { config.SMS = sms })
+	student := h.Login(auth.Identity{Mail: "cb.en.u4cse20001@cb.students.amrita.edu"})
+	h.Login(auth.Identity{Mail: "cb.en.u4cse20002@cb.students.amrita.edu"})
+
+	for _, preferences := range []string{`{"phone": "9876543210"}`, `{"notifications": {"sms": true}}`} {
+		if resp, _ := h.Do("PUT", "/me/preferences", apitest.Bearer(student), apitest.JSONBody(preferences)); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("preferences %s = %d; want 400", preferences, resp.StatusCode)
+		}
+	}
+	h.Do("PUT", "/me/preferences", apitest.Bearer(student), apitest.JSONBody(`{"phone": "+919876543210", "notifications": {"sms": true}}`))
+
+	texts := func(n int) []db.Text {
+		var texts []db.Text
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			h.DoJSON("GET", "/admin/texts", &texts, apitest.AdminKey())
+			if len(texts) == n && texts[0].Status != notify.SMSPending && texts[0].Status != notify.SMSSending {
+				break
+			}
+		}
+		return texts
+	}
+
+	resp, body := h.Do("POST", "/admin/broadcasts?audience=all&title=Evacuate+AB3&body=Gather+at+the+ground&emergency=true", apitest.AdminKey())
+	var task jobs.Task
+	json.Unmarshal(body, &task)
+	for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+	}
+	if result, _ := task.Result.(map[string]interface{}); resp.StatusCode != http.StatusAccepted || result["sent"] != 2.0 || result["texted"] != 1.0 {
+		t.Fatalf("emergency broadcast = %d %+v; want it sent to both, texted to one", resp.StatusCode, task)
+	}
+	sent := texts(1)
+	if len(sent) != 1 || sent[0].Phone != "+919876543210" || sent[0].Body != "Evacuate AB3: Gather at the ground" ||
+		sent[0].Status != notify.SMSQueued || sent[0].ProviderID != "SM1" {
+		t.Fatalf("texts = %+v; want the broadcast queued with the provider", sent)
+	}
+	if texted := sms.Texts(); len(texted) != 1 || texted[0].To != "+919876543210" {
+		t.Errorf("provider texted %+v", texted)
+	}
+	if resp, _ := h.Do("POST", "/sms/status", apitest.Body("application/x-www-form-urlencoded", "id=SM1&status=delivered")); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("delivery report = %d; want 204", resp.StatusCode)
+	}
+	var delivered []db.Text
+	h.DoJSON("GET", "/admin/texts?status=delivered", &delivered, apitest.AdminKey())
+	if len(delivered) != 1 {
+		t.Errorf("delivered texts = %+v; want the broadcast", delivered)
+	}
+
+	exam := `{"subject": "19CSE311", "date": "2099-05-02", "startTime": "09:30", "endTime": "12:30", "halls": [
+		{"class": "A104", "firstRoll": "CB.EN.U4CSE20001", "lastRoll": "CB.EN.U4CSE20001"},
+		{"class": "B201", "firstRoll": "CB.EN.U4CSE20002", "lastRoll": "CB.EN.U4CSE20030"}]}`
+	h.Do("POST", "/admin/exams", apitest.AdminKey(), apitest.JSONBody(exam))
+	moved := `{"subject": "19CSE311", "date": "2099-05-02", "startTime": "09:30", "endTime": "12:30", "halls": [
+		{"class": "B201", "firstRoll": "CB.EN.U4CSE20001", "lastRoll": "CB.EN.U4CSE20030"}]}`
+	h.Do("PUT", "/admin/exams/1", apitest.AdminKey(), apitest.JSONBody(moved))
+	if sent := texts(2); len(sent) != 2 || sent[0].Kind != notify.KindExam ||
+		sent[0].Body != "Exam hall changed: Your 19CSE311 exam on 2099-05-02 at 09:30 is in B201." {
+		t.Errorf("texts = %+v; want the new hall texted", sent)
+	}
+	var alerted []string
+	for _, msg := range h.Notifier.Sent() {
+		if msg.Kind == notify.KindExam {
+			alerted = append(alerted, msg.To)
+		}
+	}
+	if want := []string{"cb.en.u4cse20001@cb.students.amrita.edu"}; !reflect.DeepEqual(alerted, want) {
+		t.Errorf("exam alerts went to %v; want %v, whose hall changed", alerted, want)
+	}
+
+	// A text left pending by a server that stopped is sent by the next one
+	id, _ := h.Repo.AddText(db.Text{Mail: "cb.en.u4cse20001@cb.students.amrita.edu", Phone: "+919876543210",
+		Kind: notify.KindExam, Body: "Left behind", Status: notify.SMSPending, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+	next := api.NewServer(h.Repo, cache.NewMemory(), api.Config{SMS: sms}, log.New(ioutil.Discard, "", 0))
+	go next.RunTexts()
+	if sent := texts(3); len(sent) != 3 || sent[0].ID != id || sent[0].Status != notify.SMSQueued {
+		t.Errorf("texts = %+v; want the pending one sent", sent)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := next.StopTexts(ctx); err != nil {
+		t.Errorf("StopTexts = %v", err)
+	}
+	if err := next.StopTexts(ctx); err != nil {
+		t.Errorf("second StopTexts = %v; want it harmless", err)
+	}
+	if texted := sms.Texts(); len(texted) != 3 || texted[2].Body != "Left behind" {
+		t.Errorf("provider texted %+v; want the pending text once", texted)
+	}
+}
+
+// Holds every text until gate is closed
+type gatedSMS struct {
+	*notify.MemorySMS
+	gate chan struct{}
+}
+
+func (g gatedSMS) SendSMS(to string, body string) (string, error) {
+	<-g.gate
+	return g.MemorySMS.SendSMS(to, body)
+}
+
+func TestTextsSentOnce(t *testing.T) {
+	sms := gatedSMS{MemorySMS: &notify.MemorySMS{}, gate: make(chan struct{})}
+	h := newHarness(t, func(config *api.Config) { config.SMS = sms })
+	student := h.Login(auth.Identity{Mail: "cb.en.u4cse20001@cb.students.amrita.edu"})
+	h.Do("PUT", "/me/preferences", apitest.Bearer(student), apitest.JSONBody(`{"phone": "+919876543210", "notifications": {"sms": true}}`))
+	status := func(body string, want string) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			var texts []db.Text
+			h.DoJSON("GET", "/admin/texts", &texts, apitest.AdminKey())
+			for _, text := range texts {
+				if text.Body == body && text.Status == want {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	defer func() {
+		select {
+		case <-sms.gate:
+		default:
+			close(sms.gate)
+		}
+	}()
+
+	// The server is held sending the first text while the second waits in its queue
+	h.Do("POST", "/admin/broadcasts?audience=all&title=First&body=Now&emergency=true", apitest.AdminKey())
+	if !status("First: Now", notify.SMSSending) {
+		t.Fatal("first text not being sent")
+	}
+	h.Do("POST", "/admin/broadcasts?audience=all&title=Second&body=Now&emergency=true", apitest.AdminKey())
+	if !status("Second: Now", notify.SMSPending) {
+		t.Fatal("second text not pending")
+	}
+	// A successor started meanwhile finds the second text pending and claims it
+	next := api.NewServer(h.Repo, cache.NewMemory(), api.Config{SMS: sms}, log.New(ioutil.Discard, "", 0))
+	go next.RunTexts()
+	if !status("Second: Now", notify.SMSSending) {
+		t.Fatal("second text not claimed by the successor")
+	}
+	close(sms.gate)
+	if !status("First: Now", notify.SMSQueued) || !status("Second: Now", notify.SMSQueued) {
+		t.Fatal("texts not sent")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	next.StopTexts(ctx)
+	h.Server.StopTexts(ctx)
+	if texted := sms.Texts(); len(texted) != 2 {
+		t.Errorf("provider texted %+v; want each text once", texted)
+	}
+}
+
+func TestTeams(t *testing.T) {
+	teams := &notify.MemoryTeams{}
+	h := newHarness(t, func(config *api.Config) { config.Teams = teams })
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+
+	for _, query := range []string{
+		"webhook=https://amrita.webhook.office.com/hook&teamId=T1&channelId=C1",
+		"teamId=T1",
+		"webhook=http://amrita.webhook.office.com/hook",
+		"webhook=https://amrita.webhook.office.com/hook&classes=X999",
+	} {
+		if resp, _ := h.Do("PUT", "/admin/teams/CSE-A?"+query, apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Teams channel %s = %d; want 400", query, resp.StatusCode)
+		}
+	}
+	if resp, body := h.Do("PUT", "/admin/teams/CSE-A?webhook=https://amrita.webhook.office.com/hook&classes=A104", apitest.AdminKey()); resp.StatusCode != http.StatusOK {
+		t.Fatalf("webhook channel = %d %s; want 200", resp.StatusCode, body)
+	}
+	if resp, body := h.Do("PUT", "/admin/teams/CSE-B?teamId=T1&channelId=C1&classes=B201", apitest.AdminKey()); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Graph channel = %d %s; want 200", resp.StatusCode, body)
+	}
+	var channels []db.TeamsChannel
+	h.DoJSON("GET", "/admin/teams", &channels, apitest.AdminKey())
+	if len(channels) != 2 || channels[0].Section != "CSE-A" || !reflect.DeepEqual(channels[1].Classes, []string{"B201"}) {
+		t.Errorf("Teams channels = %+v", channels)
+	}
+
+	tuesday := time.Now()
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	if resp, body := h.Do("PUT", "/admin/overrides/A104/"+tuesday.Format("2006-01-02")+"/3?cancel=true", apitest.AdminKey()); resp.StatusCode != http.StatusOK {
+		t.Fatalf("cancelling a class = %d %s; want 200", resp.StatusCode, body)
+	}
+	posts := teams.Posts()
+	if len(posts) != 1 || posts[0].Channel.Webhook != "https://amrita.webhook.office.com/hook" || !strings.HasPrefix(posts[0].Title, "19CSE311") {
+		t.Fatalf("posts = %+v; want the cancellation posted to CSE-A only", posts)
+	}
+	h.Do("POST", "/admin/announcements?title=Holiday&body=No+classes+tomorrow", apitest.AdminKey())
+	posts = teams.Posts()[1:]
+	if len(posts) != 2 || posts[0].Title != "Holiday" || posts[1].Text != "No classes tomorrow" || posts[1].Channel.TeamID != "T1" {
+		t.Errorf("posts = %+v; want the announcement posted to both", posts)
+	}
+
+	if resp, _ := h.Do("DELETE", "/admin/teams/CSE-B", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting a channel = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("DELETE", "/admin/teams/CSE-B", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting it again = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestEquipment(t *testing.T) {
+	h := newHarness(t)
+	resp, _ := h.Do("PUT", "/admin/equipment/PROJ-01?name=Epson&kind=projector&home=A104", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("adding equipment = %d; want 204", resp.StatusCode)
+	}
+
+	var response struct {
+		Inserted bool `json:"inserted"`
+	}
+	h.DoJSON("GET", "/db/booking?class=A104&date=2023-06-13&slot=2&faculty=f&subject=s&equipment=PROJ-01", &response)
+	if !response.Inserted {
+		t.Fatal("booking with equipment was not inserted")
+	}
+	resp, _ = h.Do("GET", "/db/booking?class=B201&date=2023-06-13&slot=2&faculty=f&subject=s&equipment=PROJ-01")
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("booking with reserved equipment = %d; want 409", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/db/booking?class=B201&date=2023-06-13&slot=2&faculty=f&subject=s&equipment=MIC-09")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("booking with unknown equipment = %d; want 404", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/db/reserveEquipment?class=B201&date=2023-06-13&slot=3&equipment=PROJ-01")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("reserving without a booking = %d; want 404", resp.StatusCode)
+	}
+
+	var entries []struct {
+		ID           string `json:"id"`
+		Reservations []struct {
+			Class string `json:"class"`
+		} `json:"reservations"`
+	}
+	h.DoJSON("GET", "/db/equipment?date=2023-06-13&slot=2", &entries)
+	if len(entries) != 1 || len(entries[0].Reservations) != 1 || entries[0].Reservations[0].Class != "A104" {
+		t.Errorf("equipment in slot 2 = %+v; want PROJ-01 reserved in A104", entries)
+	}
+
+	h.Do("GET", "/db/cancelBooking?class=A104&date=2023-06-13&slot=2")
+	entries = nil
+	h.DoJSON("GET", "/db/equipment?date=2023-06-13&slot=2", &entries)
+	if len(entries) != 1 || len(entries[0].Reservations) != 0 {
+		t.Errorf("equipment after cancelling the booking = %+v; want it free", entries)
+	}
+}
+
+func TestWaitlist(t *testing.T) {
+	h := newHarness(t)
+	first := h.Login(auth.Identity{Mail: "first@cb.amrita.edu"})
+	second := h.Login(auth.Identity{Mail: "second@cb.amrita.edu"})
+	tuesday := time.Now().AddDate(0, 0, 1)
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	date := tuesday.Format("2006-01-02")
+	join := func(session string) *http.Response {
+		resp, _ := h.Do("POST", "/me/waitlist?class=B201&date="+date+"&slot=2&subject=19CSE302", apitest.Bearer(session))
+		return resp
+	}
+
+	if resp := join(first); resp.StatusCode != http.StatusConflict {
+		t.Errorf("waiting for a free slot = %d; want 409", resp.StatusCode)
+	}
+	var response struct {
+		Inserted bool `json:"inserted"`
+		Waitlist bool `json:"waitlist"`
+	}
+	h.DoJSON("GET", "/db/booking?class=B201&date="+date+"&slot=2&faculty=owner@cb.amrita.edu&subject=s", &response)
+	if !response.Inserted {
+		t.Fatal("booking was not inserted")
+	}
+	h.DoJSON("GET", "/db/booking?class=B201&date="+date+"&slot=2&faculty=other@cb.amrita.edu&subject=s", &response)
+	if response.Inserted || !response.Waitlist {
+		t.Errorf("booking a booked slot = %+v; want it refused with the waitlist offered", response)
+	}
+	if resp := join(first); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("joining the waitlist = %d; want 201", resp.StatusCode)
+	}
+	if resp := join(first); resp.StatusCode != http.StatusConflict {
+		t.Errorf("joining twice = %d; want 409", resp.StatusCode)
+	}
+	if resp := join(second); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("joining second = %d; want 201", resp.StatusCode)
+	}
+
+	h.Do("GET", "/db/cancelBooking?class=B201&date="+date+"&slot=2")
+	var bookings []db.BookingRecord
+	h.DoJSON("GET", "/db/getBooking?faculty=first@cb.amrita.edu", &bookings)
+	if len(bookings) != 1 || bookings[0].Class != "B201" || bookings[0].Subject != "19CSE302" {
+		t.Errorf("bookings of the first in line = %+v; want the freed slot", bookings)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 1 || sent[0].To != "first@cb.amrita.edu" {
+		t.Errorf("notifications = %+v; want the first in line", sent)
+	}
+	var entries []db.WaitlistEntry
+	h.DoJSON("GET", "/me/waitlist", &entries, apitest.Bearer(first))
+	if len(entries) != 0 {
+		t.Errorf("waitlist of the promoted = %+v; want none", entries)
+	}
+	h.DoJSON("GET", "/me/waitlist", &entries, apitest.Bearer(second))
+	if len(entries) != 1 {
+		t.Fatalf("waitlist of the second = %+v; want one entry", entries)
+	}
+	resp, _ := h.Do("DELETE", "/me/waitlist/"+strconv.FormatInt(entries[0].ID, 10), apitest.Bearer(second))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("leaving the waitlist = %d; want 204", resp.StatusCode)
+	}
+}
+
+func TestCheckIn(t *testing.T) {
+	h := newHarness(t)
+	owner := h.Login(auth.Identity{Mail: "owner@cb.amrita.edu"})
+	other := h.Login(auth.Identity{Mail: "other@cb.amrita.edu"})
+	for _, class := range []string{"A104", "B201"} {
+		var response struct {
+			Inserted bool `json:"inserted"`
+		}
+		h.DoJSON("GET", "/db/booking?class="+class+"&date=2023-06-13&slot=2&faculty=owner@cb.amrita.edu&subject=s", &response)
+		if !response.Inserted {
+			t.Fatalf("booking %s was not inserted", class)
+		}
+	}
+
+	resp, _ := h.Do("GET", "/booking/A104-20230613-2/qr", apitest.Bearer(other))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("QR code of someone else's booking = %d; want 403", resp.StatusCode)
+	}
+	resp, body := h.Do("GET", "/booking/A104-20230613-2/qr", apitest.Bearer(owner))
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" || !bytes.HasPrefix(body, []byte("\x89PNG")) {
+		t.Fatalf("QR code = %d %s; want a PNG", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	date := time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC)
+	checkIns, _ := h.Repo.GetCheckIns("A104", date)
+	if len(checkIns) != 1 {
+		t.Fatalf("check-ins = %+v; want the one of the QR code", checkIns)
+	}
+	resp, _ = h.Do("GET", "/booking/A104-20230613-2/checkin?token=wrong")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("check-in with a wrong token = %d; want 404", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/booking/A104-20230613-2/checkin?token="+checkIns[0].Token)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("check-in after the slot = %d; want 409", resp.StatusCode)
+	}
+
+	h.Repo.MarkCheckedIn("A104", date, 2, time.Date(2023, 6, 13, 8, 55, 0, 0, time.Local))
+	// Slot 2 runs from 08:50, so the grace period is over at 09:05
+	if released := h.Server.ReleaseUnusedBookings(time.Date(2023, 6, 13, 9, 0, 0, 0, time.Local)); released != 0 {
+		t.Errorf("released within the grace period = %d; want 0", released)
+	}
+	if released := h.Server.ReleaseUnusedBookings(time.Date(2023, 6, 13, 9, 10, 0, 0, time.Local)); released != 1 {
+		t.Errorf("released after the grace period = %d; want 1", released)
+	}
+	var bookings []db.BookingRecord
+	h.DoJSON("GET", "/db/getBooking?faculty=owner@cb.amrita.edu", &bookings)
+	if len(bookings) != 1 || bookings[0].Class != "A104" {
+		t.Errorf("bookings left = %+v; want the checked in one", bookings)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 1 || sent[0].To != "owner@cb.amrita.edu" {
+		t.Errorf("notifications = %+v; want the owner of the released booking", sent)
+	}
+}
+
+func TestAttendance(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddFaculty("faculty@cb.amrita.edu", "Faculty")
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	other := h.Login(auth.Identity{Mail: "other@cb.amrita.edu"})
+	student := h.Login(auth.Identity{Mail: "cb.en.u4cse20001@cb.students.amrita.edu"})
+	mark := func(session string, date string, body string) *http.Response {
+		resp, _ := h.Do("PUT", "/me/attendance/A104/"+date+"/3", apitest.Bearer(session), apitest.JSONBody(body))
+		return resp
+	}
+
+	if resp := mark(other, "2023-06-13", `{"present": ["CB.EN.U4CSE20001"]}`); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("marking someone else's class = %d; want 403", resp.StatusCode)
+	}
+	if resp := mark(faculty, time.Now().AddDate(0, 0, 7).Format("2006-01-02"), `{}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("marking a future class = %d; want 400", resp.StatusCode)
+	}
+	if resp := mark(faculty, "2023-06-13", `{"present": ["cb.en.u4cse20001"], "absent": ["CB.EN.U4CSE20001"]}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("marking a student twice = %d; want 400", resp.StatusCode)
+	}
+	if resp := mark(faculty, "2023-06-13", `{"present": ["cb.en.u4cse20001"], "absent": ["CB.EN.U4CSE20002"]}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("marking attendance = %d; want 204", resp.StatusCode)
+	}
+	if resp := mark(faculty, "2023-06-20", `{"present": ["CB.EN.U4CSE20002"], "absent": ["CB.EN.U4CSE20001"]}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("marking attendance = %d; want 204", resp.StatusCode)
+	}
+
+	var mine []struct {
+		Subject    string  `json:"subject"`
+		Attended   int     `json:"attended"`
+		Held       int     `json:"held"`
+		Percentage float64 `json:"percentage"`
+	}
+	h.DoJSON("GET", "/me/attendance", &mine, apitest.Bearer(student))
+	if len(mine) != 1 || mine[0].Subject != "19CSE311" || mine[0].Attended != 1 || mine[0].Held != 2 || mine[0].Percentage != 50 {
+		t.Errorf("my attendance = %+v; want 1 of 2 in 19CSE311", mine)
+	}
+
+	var report []struct {
+		Subject  string `json:"subject"`
+		Periods  int    `json:"periods"`
+		Students int    `json:"students"`
+		Rolls    []struct {
+			Roll     string `json:"roll"`
+			Attended int    `json:"attended"`
+		} `json:"rolls"`
+	}
+	h.DoJSON("GET", "/admin/attendance?subject=19CSE311&startDate=2023-06-01&endDate=2023-06-30", &report, apitest.AdminKey())
+	if len(report) != 1 || report[0].Periods != 2 || report[0].Students != 2 || len(report[0].Rolls) != 2 {
+		t.Errorf("attendance report = %+v; want 2 periods of 2 students", report)
+	}
+	_, body := h.Do("GET", "/admin/attendance?subject=19CSE311&format=csv&table=students", apitest.AdminKey())
+	if want := "subject,roll,attended,held,percentage\n19CSE311,CB.EN.U4CSE20001,1,2,50\n19CSE311,CB.EN.U4CSE20002,1,2,50\n"; string(body) != want {
+		t.Errorf("students as CSV = %q; want %q", body, want)
+	}
+}
+
+func TestAttendanceAlerts(t *testing.T) {
+	h := newHarness(t)
+	mark := func(date string, present string, absent string) {
+		body := `{"present": ["` + present + `"], "absent": ["` + absent + `"]}`
+		resp, _ := h.Do("PUT", "/admin/attendance/A104/"+date+"/3", apitest.AdminKey(), apitest.JSONBody(body))
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("marking attendance = %d; want 204", resp.StatusCode)
+		}
+	}
+	for _, date := range []string{"2023-06-06", "2023-06-13", "2023-06-20"} {
+		mark(date, "CB.EN.U4CSE20001", "CB.EN.U4CSE20002")
+	}
+	mark("2023-06-27", "CB.EN.U4CSE20002", "CB.EN.U4CSE20001")
+
+	// 20002 has been below 75% all along and is told once, on the first day
+	if sent := h.Server.SendAttendanceAlerts(time.Date(2023, 6, 6, 0, 0, 0, 0, time.UTC)); sent != 1 {
+		t.Errorf("alerts on the first day = %d; want 1", sent)
+	}
+	if sent := h.Server.SendAttendanceAlerts(time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC)); sent != 0 {
+		t.Errorf("alerts on the second day = %d; want 0", sent)
+	}
+	// 20001 drops from 100% to 75%, which is not below the threshold
+	if sent := h.Server.SendAttendanceAlerts(time.Date(2023, 6, 27, 0, 0, 0, 0, time.UTC)); sent != 0 {
+		t.Errorf("alerts on the last day = %d; want 0", sent)
+	}
+	if sent := h.Notifier.Sent(); len(sent) != 1 || sent[0].To != "cb.en.u4cse20002@cb.students.amrita.edu" {
+		t.Errorf("notifications = %+v; want one to 20002", sent)
+	}
+
+	var atRisk []struct {
+		Roll       string  `json:"roll"`
+		Percentage float64 `json:"percentage"`
+	}
+	h.DoJSON("GET", "/admin/attendance/at-risk", &atRisk, apitest.AdminKey())
+	if len(atRisk) != 1 || atRisk[0].Roll != "CB.EN.U4CSE20002" || atRisk[0].Percentage != 25 {
+		t.Errorf("at risk = %+v; want 20002 at 25%%", atRisk)
+	}
+	h.DoJSON("GET", "/admin/attendance/at-risk?threshold=80", &atRisk, apitest.AdminKey())
+	if len(atRisk) != 2 {
+		t.Errorf("at risk under 80%% = %+v; want both", atRisk)
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.SetStatic(db.StaticEntry{Class: "A104", Day: "TUE", Slot: 3, Faculty: "faculty@cb.amrita.edu", Subject: "19CSE311"})
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	student := h.Login(auth.Identity{Mail: "cb.en.u4cse20001@cb.students.amrita.edu"})
+	h.Repo.AddFavorite("cb.en.u4cse20001@cb.students.amrita.edu", db.Favorite{Kind: db.FavoriteSection, Target: "CSE-A"})
+	due := func(d time.Duration) string {
+		return url.QueryEscape(time.Now().Add(d).Truncate(time.Second).Format(time.RFC3339))
+	}
+	create := func(subject string, section string, title string, d time.Duration) (*http.Response, db.Assignment) {
+		var assignment db.Assignment
+		resp, body := h.Do("POST", "/me/assignments?subject="+subject+"&section="+section+"&title="+title+
+			"&due="+due(d)+"&link=https://lms.example.edu/a", apitest.Bearer(faculty))
+		json.Unmarshal(body, &assignment)
+		return resp, assignment
+	}
+
+	if resp, _ := create("19CSE302", "CSE-A", "Lab", 48*time.Hour); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("assignment in a subject not taught = %d; want 403", resp.StatusCode)
+	}
+	if resp, _ := create("19CSE311", "CSE-A", "Late", -time.Hour); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("assignment due in the past = %d; want 400", resp.StatusCode)
+	}
+	resp, later := create("19CSE311", "CSE-A", "Report", 72*time.Hour)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating an assignment = %d; want 201", resp.StatusCode)
+	}
+	create("19CSE311", "CSE-A", "Quiz", 12*time.Hour)
+	create("19CSE311", "CSE-B", "Other", 12*time.Hour)
+
+	var feed []db.Assignment
+	h.DoJSON("GET", "/me/assignments", &feed, apitest.Bearer(student))
+	if len(feed) != 2 || feed[0].Title != "Quiz" || feed[1].Title != "Report" {
+		t.Errorf("feed = %+v; want Quiz then Report", feed)
+	}
+	resp, body := h.Do("GET", "/me/calendar.ics", apitest.Bearer(student))
+	if resp.StatusCode != http.StatusOK || strings.Count(string(body), "BEGIN:VEVENT") != 2 ||
+		!strings.Contains(string(body), "SUMMARY:Due: Quiz (19CSE311)") {
+		t.Errorf("calendar = %d %s; want both assignments", resp.StatusCode, body)
+	}
+
+	if sent := h.Server.SendAssignmentReminders(time.Now()); sent != 1 {
+		t.Errorf("reminders = %d; want the Quiz to the one student of CSE-A", sent)
+	}
+	if sent := h.Server.SendAssignmentReminders(time.Now()); sent != 0 {
+		t.Errorf("reminders sent again = %d; want 0", sent)
+	}
+
+	resp, _ = h.Do("PUT", "/me/assignments/"+strconv.FormatInt(later.ID, 10)+"?title=Report&section=CSE-A&due="+due(96*time.Hour), apitest.Bearer(student))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("updating someone else's assignment = %d; want 404", resp.StatusCode)
+	}
+	resp, _ = h.Do("DELETE", "/me/assignments/"+strconv.FormatInt(later.ID, 10), apitest.Bearer(faculty))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting an assignment = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/me/assignments?mine=true", &feed, apitest.Bearer(faculty))
+	if len(feed) != 2 {
+		t.Errorf("my assignments = %+v; want the two left", feed)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	h := newHarness(t)
+	faculty := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+	student := h.Login(auth.Identity{Mail: "student@cb.students.amrita.edu"})
+	upload := func(name string, content string) (*http.Response, []byte) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte(content))
+		writer.Close()
+		return h.Do("POST", "/me/attachments", apitest.Bearer(faculty), apitest.Body(writer.FormDataContentType(), body.String()))
+	}
+
+	if resp, _ := upload("notes.pdf", "just text"); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("text uploaded as a PDF = %d; want 415", resp.StatusCode)
+	}
+	if resp, _ := upload("big.txt", strings.Repeat("x", 2<<10)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload over the limit = %d; want 413", resp.StatusCode)
+	}
+	resp, body := upload(`C:\marks.csv`, "roll,marks\nCB.EN.U4CSE20001,42\n")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("uploading a CSV = %d %s; want 201", resp.StatusCode, body)
+	}
+	var uploaded struct {
+		db.Attachment
+		URL string `json:"url"`
+	}
+	json.Unmarshal(body, &uploaded)
+	if uploaded.Name != "marks.csv" || uploaded.ContentType != "text/csv; charset=utf-8" || uploaded.UploadedBy != "faculty@cb.amrita.edu" {
+		t.Errorf("uploaded = %+v; want marks.csv as text/csv", uploaded)
+	}
+
+	download, err := url.Parse(uploaded.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body = h.Do("GET", download.RequestURI())
+	if resp.StatusCode != http.StatusOK || string(body) != "roll,marks\nCB.EN.U4CSE20001,42\n" ||
+		!strings.Contains(resp.Header.Get("Content-Disposition"), "marks.csv") {
+		t.Errorf("signed download = %d %q; want the CSV", resp.StatusCode, body)
+	}
+	if resp, _ := h.Do("GET", strings.Replace(download.RequestURI(), "sig=", "sig=0", 1)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("download with a bad signature = %d; want 403", resp.StatusCode)
+	}
+	resp, _ = h.Do("GET", "/attachments/"+uploaded.ID, apitest.Bearer(student))
+	if resp.StatusCode != http.StatusFound || !strings.Contains(resp.Header.Get("Location"), "/files/"+uploaded.ID+"?") {
+		t.Errorf("attachment link = %d %s; want a redirect to a signed URL", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	if resp, _ := h.Do("DELETE", "/me/attachments/"+uploaded.ID, apitest.Bearer(student)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting someone else's attachment = %d; want 404", resp.StatusCode)
+	}
+	if resp, _ := h.Do("DELETE", "/me/attachments/"+uploaded.ID, apitest.Bearer(faculty)); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting an attachment = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", download.RequestURI()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("download of a deleted attachment = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestCampuses(t *testing.T) {
+	h := newHarness(t)
+	for _, path := range []string{"/admin/campuses/CB?name=Coimbatore", "/admin/campuses/AMR?name=Amritapuri"} {
+		if resp, _ := h.Do("PUT", path, apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("PUT %s = %d; want 204", path, resp.StatusCode)
+		}
+	}
+	if resp, _ := h.Do("PUT", "/admin/classrooms/A104?capacity=60&building=AB1&campus=XYZ", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("classroom on an unknown campus = %d; want 400", resp.StatusCode)
+	}
+	h.Do("PUT", "/admin/classrooms/A104?capacity=60&building=AB1&campus=CB", apitest.AdminKey())
+	h.Do("PUT", "/admin/classrooms/B201?capacity=60&building=AB1&campus=AMR", apitest.AdminKey())
+
+	var campuses []db.Campus
+	h.DoJSON("GET", "/db/campuses", &campuses)
+	if len(campuses) != 2 || campuses[0].ID != "AMR" || campuses[1].Name != "Coimbatore" {
+		t.Errorf("campuses = %+v; want AMR and CB", campuses)
+	}
+	var classes []string
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13&campus=CB", &classes)
+	if !reflect.DeepEqual(classes, []string{"A104"}) {
+		t.Errorf("free classes on CB = %v; want [A104]", classes)
+	}
+	if resp, _ := h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13&campus=XYZ"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("free classes on an unknown campus = %d; want 400", resp.StatusCode)
+	}
+
+	session := h.Login(auth.Identity{Mail: "faculty@am.amrita.edu"})
+	if resp, _ := h.Do("PUT", "/me/preferences", apitest.Bearer(session), apitest.JSONBody(`{"campus":"XYZ"}`)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("preferring an unknown campus = %d; want 400", resp.StatusCode)
+	}
+	h.Do("PUT", "/me/preferences", apitest.Bearer(session), apitest.JSONBody(`{"campus":"AMR"}`))
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13", &classes, apitest.Bearer(session))
+	if !reflect.DeepEqual(classes, []string{"B201"}) {
+		t.Errorf("free classes on the preferred campus = %v; want [B201]", classes)
+	}
+	h.DoJSON("GET", "/db/getAllClass", &classes, apitest.Bearer(session))
+	if !reflect.DeepEqual(classes, []string{"B201"}) {
+		t.Errorf("classes on the preferred campus = %v; want [B201]", classes)
+	}
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13&campus=all", &classes, apitest.Bearer(session))
+	if len(classes) != 2 {
+		t.Errorf("free classes on every campus = %v; want both", classes)
+	}
+
+	var entries []db.StaticEntry
+	h.DoJSON("GET", "/admin/timetable?campus=AMR", &entries, apitest.AdminKey())
+	if len(entries) != 3 || entries[0].Class != "B201" {
+		t.Errorf("timetable of AMR = %+v; want the three periods of B201", entries)
+	}
+	if resp, _ := h.Do("DELETE", "/admin/campuses/CB", apitest.AdminKey()); resp.StatusCode != http.StatusConflict {
+		t.Errorf("deleting a campus with classrooms = %d; want 409", resp.StatusCode)
+	}
+	h.Do("PUT", "/admin/classrooms/A104?capacity=60&building=AB1", apitest.AdminKey())
+	if resp, _ := h.Do("DELETE", "/admin/campuses/CB", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting an empty campus = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("DELETE", "/admin/campuses/CB", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting a deleted campus = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	amrita, other := newHarness(t), apitest.New(t)
+	handler, err := api.TenantHandler([]api.Tenant{
+		{Name: "amrita", Hosts: []string{"cora.amrita.edu"}, Handler: amrita.Server.CORS(amrita.Router)},
+		{Name: "other", Hosts: []string{"cora.other.edu"}, Handler: other.Server.CORS(other.Router)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	get := func(host string, path string, header string, value string) (int, []string) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		req.Host = host
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var classes []string
+		json.NewDecoder(resp.Body).Decode(&classes)
+		return resp.StatusCode, classes
+	}
+
+	if _, classes := get("cora.amrita.edu:443", "/db/getAllClass", "", ""); len(classes) != 2 {
+		t.Errorf("classes of amrita = %v; want A104 and B201", classes)
+	}
+	if _, classes := get("CORA.OTHER.EDU", "/db/getAllClass", "", ""); len(classes) != 0 {
+		t.Errorf("classes of other = %v; want none of amrita's", classes)
+	}
+	_, body := amrita.Do("POST", "/admin/apikeys?name=signage&scopes=timetable:read", apitest.AdminKey())
+	var issued struct {
+		Key string `json:"key"`
+	}
+	json.Unmarshal(body, &issued)
+	if _, classes := get("api.cora.app", "/db/getAllClass", "X-API-Key", "amrita."+issued.Key); len(classes) != 2 {
+		t.Errorf("classes by an amrita API key on a shared host = %v; want amrita's", classes)
+	}
+	if status, _ := get("api.cora.app", "/me/sessions", "Authorization", "Bearer other.0123"); status != http.StatusUnauthorized {
+		t.Errorf("unknown session of other = %d; want 401 from other", status)
+	}
+	if status, _ := get("api.cora.app", "/db/getAllClass", "", ""); status != http.StatusNotFound {
+		t.Errorf("request for no tenant = %d; want 404", status)
+	}
+	if _, err := api.TenantHandler([]api.Tenant{{Name: "Bad.Name"}}); err == nil {
+		t.Errorf("TenantHandler accepted an invalid name")
+	}
+}
+
+func TestTrash(t *testing.T) {
+	h := newHarness(t)
+	if resp, _ := h.Do("DELETE", "/admin/timetable/A104/TUE/3", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("deleting a period = %d; want 204", resp.StatusCode)
+	}
+	var inserted struct{ Inserted bool }
+	h.DoJSON("GET", "/db/booking?class=B201&date=2023-06-13&slot=2&faculty=f&subject=19CSE302", &inserted)
+	h.Do("DELETE", "/admin/bookings/B201/2023-06-13/2", apitest.AdminKey())
+	h.Do("POST", "/admin/announcements?title=Exams&body=Soon", apitest.AdminKey())
+	h.Do("DELETE", "/admin/announcements/1", apitest.AdminKey())
+
+	var items []db.TrashItem
+	h.DoJSON("GET", "/admin/trash", &items, apitest.AdminKey())
+	if len(items) != 3 || items[0].Kind != db.TrashAnnouncement || items[2].Target != "A104/TUE/3" {
+		t.Fatalf("trash = %+v; want the announcement, booking and period", items)
+	}
+	h.DoJSON("GET", "/admin/trash?kind=booking", &items, apitest.AdminKey())
+	if len(items) != 1 || items[0].Target != "B201/2023-06-13/2" {
+		t.Errorf("trashed bookings = %+v; want B201/2023-06-13/2", items)
+	}
+	if resp, _ := h.Do("GET", "/admin/trash?kind=exam", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("trash of an unknown kind = %d; want 400", resp.StatusCode)
+	}
+
+	var entry db.StaticEntry
+	h.DoJSON("POST", "/admin/trash/1/restore", &entry, apitest.AdminKey())
+	if entry.Subject != "19CSE311" {
+		t.Errorf("restored period = %+v; want 19CSE311", entry)
+	}
+	var entries []db.StaticEntry
+	h.DoJSON("GET", "/admin/timetable?class=A104&slot=3", &entries, apitest.AdminKey())
+	if len(entries) != 1 || entries[0].Subject != "19CSE311" {
+		t.Errorf("timetable after restoring = %+v; want 19CSE311 back", entries)
+	}
+	if resp, _ := h.Do("POST", "/admin/trash/1/restore", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("restoring twice = %d; want 404", resp.StatusCode)
+	}
+
+	h.DoJSON("GET", "/db/booking?class=B201&date=2023-06-13&slot=2&faculty=g&subject=19CSE302", &inserted)
+	if resp, _ := h.Do("POST", "/admin/trash/2/restore", apitest.AdminKey()); resp.StatusCode != http.StatusConflict {
+		t.Errorf("restoring a booking of a taken slot = %d; want 409", resp.StatusCode)
+	}
+
+	var announcement db.Announcement
+	h.DoJSON("POST", "/admin/trash/3/restore", &announcement, apitest.AdminKey())
+	var announcements []db.Announcement
+	h.DoJSON("GET", "/admin/announcements", &announcements, apitest.AdminKey())
+	if len(announcements) != 1 || announcements[0].Title != "Exams" || announcements[0].ID != announcement.ID {
+		t.Errorf("announcements after restoring = %+v; want Exams back", announcements)
+	}
+
+	if purged := h.Server.PurgeTrash(time.Now()); purged != 0 {
+		t.Errorf("purged %d items within the retention period; want 0", purged)
+	}
+	if purged := h.Server.PurgeTrash(time.Now().Add(31 * 24 * time.Hour)); purged != 1 {
+		t.Errorf("purged %d items after the retention period; want the booking", purged)
+	}
+	h.Do("DELETE", "/admin/announcements/"+strconv.FormatInt(announcement.ID, 10), apitest.AdminKey())
+	if resp, _ := h.Do("DELETE", "/admin/trash/4", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("purging an item = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/admin/trash", &items, apitest.AdminKey())
+	if len(items) != 0 {
+		t.Errorf("trash after purging = %+v; want it empty", items)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	h := newHarness(t)
+	resp, body := h.Do("PUT", "/admin/timetable/A104/TUE/3?subject=19CSE311&faculty=a@cb.amrita.edu", apitest.AdminKey())
+	var entry db.StaticEntry
+	json.Unmarshal(body, &entry)
+	seen := resp.Header.Get("ETag")
+	if seen != `"2"` || entry.Version != 2 {
+		t.Fatalf("ETag after an edit = %s, version %d; want \"2\"", seen, entry.Version)
+	}
+	resp, _ = h.Do("PUT", "/admin/timetable/A104/TUE/3?subject=19CSE312", apitest.AdminKey(), apitest.Header("If-Match", seen))
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"3"` {
+		t.Errorf("edit of the current version = %d, ETag %s; want 200, \"3\"", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	resp, body = h.Do("PUT", "/admin/timetable/A104/TUE/3?subject=19CSE313", apitest.AdminKey(), apitest.Header("If-Match", seen))
+	json.Unmarshal(body, &entry)
+	if resp.StatusCode != http.StatusConflict || entry.Subject != "19CSE312" || resp.Header.Get("ETag") != `"3"` {
+		t.Errorf("edit of a stale version = %d %+v; want 409 with 19CSE312 at version 3", resp.StatusCode, entry)
+	}
+	if resp, _ := h.Do("PUT", "/admin/timetable/A104/TUE/3?subject=19CSE313", apitest.AdminKey(), apitest.Header("If-Match", "latest")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("If-Match latest = %d; want 400", resp.StatusCode)
+	}
+	if resp, _ := h.Do("PUT", "/admin/timetable/A104/WED/1?subject=19CSE313", apitest.AdminKey(), apitest.Header("If-Match", `"1"`)); resp.StatusCode != http.StatusConflict {
+		t.Errorf("edit of a missing period = %d; want 409", resp.StatusCode)
+	}
+
+	h.Do("POST", "/admin/announcements?title=Exams&body=Soon", apitest.AdminKey())
+	resp, _ = h.Do("PUT", "/admin/announcements/1?title=Exams&body=Next+week", apitest.AdminKey(), apitest.Header("If-Match", `"1"`))
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("ETag") != `"2"` {
+		t.Errorf("announcement edit = %d, ETag %s; want 204, \"2\"", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	resp, body = h.Do("PUT", "/admin/announcements/1?title=Exams&body=Tomorrow", apitest.AdminKey(), apitest.Header("If-Match", `"1"`))
+	var announcement db.Announcement
+	json.Unmarshal(body, &announcement)
+	if resp.StatusCode != http.StatusConflict || announcement.Body != "Next week" || announcement.Version != 2 {
+		t.Errorf("stale announcement edit = %d %+v; want 409 with the current one", resp.StatusCode, announcement)
+	}
+
+	exam := `{"subject": "19CSE311", "date": "2099-05-02", "startTime": "09:30", "endTime": "12:30", "halls": [
+		{"class": "A104", "firstRoll": "CB.EN.U4CSE20001", "lastRoll": "CB.EN.U4CSE20030"}]}`
+	h.Do("POST", "/admin/exams", apitest.AdminKey(), apitest.JSONBody(exam))
+	if resp, _ := h.Do("PUT", "/admin/exams/1", apitest.AdminKey(), apitest.JSONBody(exam), apitest.Header("If-Match", `"1"`)); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("exam edit = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("PUT", "/admin/exams/1", apitest.AdminKey(), apitest.JSONBody(exam), apitest.Header("If-Match", `"1"`)); resp.StatusCode != http.StatusConflict {
+		t.Errorf("stale exam edit = %d; want 409", resp.StatusCode)
+	}
+	if resp, _ := h.Do("PUT", "/admin/exams/1", apitest.AdminKey(), apitest.JSONBody(exam)); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("exam edit without If-Match = %d; want 204", resp.StatusCode)
+	}
+}
+
+func TestTimetableVersions(t *testing.T) {
+	h := newHarness(t)
+	resp, body := h.Do("POST", "/admin/timetable/versions?semester=2023-odd&label=Start", apitest.AdminKey())
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("saving a version = %d %s; want 201", resp.StatusCode, body)
+	}
+	var saved db.TimetableVersion
+	json.Unmarshal(body, &saved)
+	if saved.Size != 6 {
+		t.Errorf("saved version = %+v; want the 6 periods", saved)
+	}
+	if resp, _ := h.Do("POST", "/admin/timetable/versions", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("saving without a semester = %d; want 400", resp.StatusCode)
+	}
+
+	h.Do("PUT", "/admin/timetable/A104/TUE/1?subject=19CSE302", apitest.AdminKey())
+	h.Do("DELETE", "/admin/timetable/B201/TUE/3", apitest.AdminKey())
+	h.Do("PUT", "/admin/timetable/A104/WED/1?subject=19CSE311", apitest.AdminKey())
+	var diff struct {
+		Added, Removed []db.StaticEntry
+		Changed        []struct{ From, To db.StaticEntry }
+	}
+	h.DoJSON("GET", "/admin/timetable/diff?from="+strconv.FormatInt(saved.ID, 10), &diff, apitest.AdminKey())
+	if len(diff.Added) != 1 || diff.Added[0].Day != "WED" || len(diff.Removed) != 1 || diff.Removed[0].Class != "B201" ||
+		len(diff.Changed) != 1 || diff.Changed[0].To.Subject != "19CSE302" {
+		t.Errorf("diff with the current timetable = %+v; want WED added, B201 removed and A104 changed", diff)
+	}
+
+	resp, body = h.Do("POST", "/admin/timetable/versions/"+strconv.FormatInt(saved.ID, 10)+"/rollback", apitest.AdminKey())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("rolling back = %d %s; want 200", resp.StatusCode, body)
+	}
+	var backup db.TimetableVersion
+	json.Unmarshal(body, &backup)
+	var entries []db.StaticEntry
+	h.DoJSON("GET", "/admin/timetable", &entries, apitest.AdminKey())
+	if len(entries) != 6 || entries[0].Subject != "FREE" {
+		t.Errorf("timetable after rolling back = %+v; want the 6 saved periods", entries)
+	}
+	h.DoJSON("GET", "/admin/timetable/diff?from="+strconv.FormatInt(saved.ID, 10)+"&to="+strconv.FormatInt(backup.ID, 10), &diff, apitest.AdminKey())
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.Changed) != 1 {
+		t.Errorf("diff with the backup = %+v; want the three edits", diff)
+	}
+
+	var versions []db.TimetableVersion
+	h.DoJSON("GET", "/admin/timetable/versions?semester=2023-odd", &versions, apitest.AdminKey())
+	if len(versions) != 2 || versions[0].ID != backup.ID || versions[0].Entries != nil {
+		t.Errorf("versions = %+v; want the backup first, without entries", versions)
+	}
+	if resp, _ := h.Do("DELETE", "/admin/timetable/versions/"+strconv.FormatInt(backup.ID, 10), apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("deleting a version = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/admin/timetable/versions/"+strconv.FormatInt(backup.ID, 10), apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("reading a deleted version = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	h := newHarness(t)
+	h.Do("PUT", "/admin/timetable/A104/TUE/2?subject=19CSE302", apitest.AdminKey())
+	_, body := h.Do("POST", "/admin/timetable/versions?semester=2099-odd", apitest.AdminKey())
+	var saved db.TimetableVersion
+	json.Unmarshal(body, &saved)
+	h.Do("PUT", "/admin/timetable/A104/TUE/2?subject=FREE", apitest.AdminKey())
+	var inserted struct{ Inserted bool }
+	h.DoJSON("GET", "/db/booking?class=A104&date=2099-06-16&slot=2&faculty=f&subject=19CSE311", &inserted)
+
+	var rollback struct {
+		DryRun  bool
+		Changes struct {
+			Changed []struct{ From, To db.StaticEntry }
+		}
+		Conflicts []string
+	}
+	h.DoJSON("POST", "/admin/timetable/versions/"+strconv.FormatInt(saved.ID, 10)+"/rollback?dryRun=true", &rollback, apitest.AdminKey())
+	if !rollback.DryRun || len(rollback.Changes.Changed) != 1 || len(rollback.Conflicts) != 1 {
+		t.Errorf("rollback preview = %+v; want A104 changed and the booking in conflict", rollback)
+	}
+	var entries []db.StaticEntry
+	h.DoJSON("GET", "/admin/timetable?class=A104&slot=2", &entries, apitest.AdminKey())
+	if len(entries) != 1 || entries[0].Subject != "FREE" {
+		t.Errorf("timetable after a preview = %+v; want it unchanged", entries)
+	}
+	if resp, _ := h.Do("POST", "/admin/timetable/versions/"+strconv.FormatInt(saved.ID, 10)+"/rollback?dryRun=maybe", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("dryRun=maybe = %d; want 400", resp.StatusCode)
+	}
+
+	if resp, _ := h.Do("DELETE", "/admin/bookings", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("cancelling every booking = %d; want 400", resp.StatusCode)
+	}
+	var cancel struct {
+		DryRun  bool
+		Changes []db.BookingRecord
+	}
+	h.DoJSON("DELETE", "/admin/bookings?class=A104&dryRun=true", &cancel, apitest.AdminKey())
+	if !cancel.DryRun || len(cancel.Changes) != 1 {
+		t.Errorf("cancel preview = %+v; want the booking", cancel)
+	}
+	var bookings []db.BookingRecord
+	h.DoJSON("DELETE", "/admin/bookings?class=A104&startDate=2099-06-01", &bookings, apitest.AdminKey())
+	if len(bookings) != 1 {
+		t.Errorf("cancelled bookings = %+v; want the booking", bookings)
+	}
+	h.DoJSON("GET", "/admin/bookings?class=A104", &bookings, apitest.AdminKey())
+	if len(bookings) != 0 {
+		t.Errorf("bookings after cancelling = %+v; want none", bookings)
+	}
+
+	exam := `{"subject": "19CSE311", "date": "2099-05-02", "startTime": "09:30", "endTime": "12:30", "halls": [
+		{"class": "A104", "firstRoll": "CB.EN.U4CSE20001", "lastRoll": "CB.EN.U4CSE20030"}]}`
+	h.Do("POST", "/admin/exams", apitest.AdminKey(), apitest.JSONBody(exam))
+	csv := "subject,date,startTime,endTime,class,firstRoll,lastRoll\n" +
+		"19CSE302,2099-05-02,11:00,13:00,A104,CB.EN.U4CSE21001,CB.EN.U4CSE21030\n"
+	var imported struct {
+		Changes   []db.Exam
+		Conflicts []string
+	}
+	h.DoJSON("POST", "/admin/exams/import?dryRun=true", &imported, apitest.AdminKey(), apitest.Body("text/csv", csv))
+	if len(imported.Changes) != 1 || len(imported.Conflicts) != 1 {
+		t.Errorf("import preview = %+v; want the exam and its clash in A104", imported)
+	}
+	var exams []db.Exam
+	h.DoJSON("GET", "/admin/exams", &exams, apitest.AdminKey())
+	if len(exams) != 1 {
+		t.Errorf("exams after a preview = %+v; want only the first", exams)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.CreateSession(db.Session{ID: "old", Mail: "f@example.com", ExpiresAt: time.Now().Add(-time.Hour)})
+	h.Repo.CreateSession(db.Session{ID: "new", Mail: "f@example.com", ExpiresAt: time.Now().Add(time.Hour)})
+
+	var statuses []jobs.Status
+	h.DoJSON("GET", "/admin/jobs", &statuses, apitest.AdminKey())
+	if len(statuses) != 10 || statuses[4].Name != "session-cleanup" || statuses[4].Schedule != "@daily" || statuses[4].Runs != 0 {
+		t.Fatalf("jobs = %+v; want the ten jobs, none run", statuses)
+	}
+	if resp, _ := h.Do("POST", "/admin/jobs/session-cleanup/run", apitest.AdminKey()); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("running a job = %d; want 202", resp.StatusCode)
+	}
+	for deadline := time.Now().Add(5 * time.Second); statuses[4].Runs == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/admin/jobs", &statuses, apitest.AdminKey())
+	}
+	if statuses[4].Runs != 1 || statuses[4].LastRun == nil || statuses[4].LastError != "" {
+		t.Fatalf("session-cleanup after running it = %+v; want one good run", statuses[4])
+	}
+	sessions, _ := h.Repo.GetUserSessions("f@example.com")
+	if len(sessions) != 1 || sessions[0].ID != "new" {
+		t.Errorf("sessions after the cleanup = %+v; want only the unexpired one", sessions)
+	}
+	if _, err := h.Repo.GetSession("old"); err == nil {
+		t.Errorf("the expired session is still there")
+	}
+
+	if resp, _ := h.Do("POST", "/admin/jobs/trash-purge/pause", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("pausing a job = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/admin/jobs", &statuses, apitest.AdminKey())
+	if !statuses[3].Paused {
+		t.Errorf("trash-purge after pausing it = %+v; want it paused", statuses[3])
+	}
+	h.Do("POST", "/admin/jobs/trash-purge/resume", apitest.AdminKey())
+	h.DoJSON("GET", "/admin/jobs", &statuses, apitest.AdminKey())
+	if statuses[3].Paused {
+		t.Errorf("trash-purge after resuming it = %+v; want it running again", statuses[3])
+	}
+	if resp, _ := h.Do("POST", "/admin/jobs/nope/run", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("running an unknown job = %d; want 404", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/admin/jobs"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("jobs without the admin key = %d; want 403", resp.StatusCode)
+	}
+
+	if err := api.ValidateJobSchedules(map[string]string{"attendance-alerts": "0 20 * * 1-5", "trash-purge": api.JobOff}); err != nil {
+		t.Errorf("ValidateJobSchedules() error = %v", err)
+	}
+	for _, schedules := range []map[string]string{{"nope": "@daily"}, {"trash-purge": "whenever"}} {
+		if err := api.ValidateJobSchedules(schedules); err == nil {
+			t.Errorf("ValidateJobSchedules(%v) error = nil; want one", schedules)
+		}
+	}
+}
+
+func TestTasks(t *testing.T) {
+	h := newHarness(t)
+	csv := "subject,date,startTime,endTime,class,firstRoll,lastRoll\n" +
+		"19CSE311,2023-06-20,10:00,13:00,A104,CB.EN.U4CSE20001,CB.EN.U4CSE20030\n" +
+		"19CSE302,2023-06-21,10:00,13:00,B201,CB.EN.U4CSE20001,CB.EN.U4CSE20030\n"
+	resp, body := h.Do("POST", "/admin/exams/import?async=true", apitest.AdminKey(), apitest.Body("text/csv", csv))
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("importing exams in the background = %d %s; want 202", resp.StatusCode, body)
+	}
+	var task jobs.Task
+	json.Unmarshal(body, &task)
+	if task.ID == "" || task.Kind != "exams.import" || resp.Header.Get("Location") != "/admin/tasks/"+task.ID {
+		t.Fatalf("task = %+v, Location %q", task, resp.Header.Get("Location"))
+	}
+	for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+	}
+	if task.State != jobs.TaskDone || task.Done != 2 || task.Total != 2 {
+		t.Fatalf("task after it finished = %+v; want it done with both exams", task)
+	}
+	var exams []db.Exam
+	h.DoJSON("GET", "/admin/exams", &exams, apitest.AdminKey())
+	if len(exams) != 2 {
+		t.Errorf("exams after the import = %+v; want 2", exams)
+	}
+
+	bad := "subject,date,startTime,endTime,class,firstRoll,lastRoll\n19CSE311,2023-06-22,10:00,13:00,Z999,A,B\n"
+	resp, body = h.Do("POST", "/admin/exams/import?async=true", apitest.AdminKey(), apitest.Body("text/csv", bad))
+	json.Unmarshal(body, &task)
+	for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+	}
+	if task.State != jobs.TaskFailed || !strings.Contains(task.Error, "Unknown class Z999") {
+		t.Errorf("task of a bad import = %+v; want it failed on Z999", task)
+	}
+
+	var tasks []jobs.Task
+	h.DoJSON("GET", "/admin/tasks?kind=exams.import", &tasks, apitest.AdminKey())
+	if len(tasks) != 2 || tasks[0].ID != task.ID {
+		t.Errorf("tasks = %+v; want both imports, the latest first", tasks)
+	}
+	if resp, _ := h.Do("GET", "/admin/tasks/nope", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown task = %d; want 404", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/admin/exams/import?async=maybe", apitest.AdminKey(), apitest.Body("text/csv", csv)); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("import with a bad async = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	h := newHarness(t)
+	h.Login(auth.Identity{ID: "u1", Mail: "deebak@cb.amrita.edu", DisplayName: "Deebak", GivenName: "Deebak"})
+	h.Login(auth.Identity{ID: "u2", Mail: "karthi@cb.amrita.edu", DisplayName: "Karthi"})
+	h.Login(auth.Identity{ID: "u1", Mail: "deebak@cb.amrita.edu", DisplayName: "Deebak K", GivenName: "Deebak"})
+
+	var users []db.User
+	h.DoJSON("GET", "/admin/directory?q=deebak", &users, apitest.AdminKey())
+	if len(users) != 1 || users[0].DisplayName != "Deebak K" || users[0].LastLoginAt == nil {
+		t.Fatalf("directory = %+v; want Deebak once, as last seen", users)
+	}
+	var user db.User
+	h.DoJSON("GET", "/admin/directory/"+strconv.FormatInt(users[0].ID, 10), &user, apitest.AdminKey())
+	if user.ExternalID != "u1" || user.Provider != "fake" {
+		t.Errorf("user = %+v; want u1 of the fake provider", user)
+	}
+	if resp, _ := h.Do("GET", "/admin/directory/99", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown user = %d; want 404", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/admin/directory"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("directory without the admin key = %d; want 403", resp.StatusCode)
+	}
+
+	resp, body := h.Do("POST", "/admin/directory/sync", apitest.AdminKey())
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("directory sync = %d %s; want 202", resp.StatusCode, body)
+	}
+	var task jobs.Task
+	json.Unmarshal(body, &task)
+	for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+	}
+	if task.State != jobs.TaskDone || task.Kind != "directory.sync" {
+		t.Errorf("sync without directory providers = %+v; want it done", task)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	h := newHarness(t)
+	staff := h.Login(auth.Identity{Mail: "staff@cb.amrita.edu"})
+	student := h.Login(auth.Identity{Mail: "cb.en.u4cse20001@cb.students.amrita.edu"})
+	h.Provider.SetGroupMembers([]auth.GroupMember{
+		{ID: "u1", Mail: "CB.EN.U4CSE20001@cb.students.amrita.edu", Section: "CSE-A", Role: auth.RoleStudent},
+		{ID: "u2", UserPrincipalName: "cb.en.u4cse20002@cb.students.amrita.edu", Section: "CSE-A", Role: auth.RoleStudent},
+		{ID: "u3", Mail: "staff@cb.amrita.edu", Role: auth.RoleStaff},
+		// A later group does not move them out of their section
+		{ID: "u1", Mail: "cb.en.u4cse20001@cb.students.amrita.edu", Section: "CSE-B"},
+	})
+
+	if resp, _ := h.Do("POST", "/me/broadcasts?audience=section&target=CSE-A&title=Hi", apitest.Bearer(staff)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("broadcast before the staff group is synced = %d; want 403", resp.StatusCode)
+	}
+	resp, body := h.Do("POST", "/admin/groups/sync", apitest.AdminKey())
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("group sync = %d %s; want 202", resp.StatusCode, body)
+	}
+	var task jobs.Task
+	json.Unmarshal(body, &task)
+	for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+	}
+	if results, _ := task.Result.([]interface{}); task.State != jobs.TaskDone || task.Kind != "groups.sync" || len(results) != 1 ||
+		results[0].(map[string]interface{})["members"] != 3.0 {
+		t.Fatalf("group sync = %+v; want the three members of the fake provider", task)
+	}
+
+	var members []db.GroupMember
+	h.DoJSON("GET", "/admin/groups?section=CSE-A", &members, apitest.AdminKey())
+	if len(members) != 2 || members[0].Mail != "cb.en.u4cse20001@cb.students.amrita.edu" || members[0].Role != auth.RoleStudent {
+		t.Errorf("members of CSE-A = %+v", members)
+	}
+	if resp, _ := h.Do("GET", "/admin/groups?role=teacher", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown role = %d; want 400", resp.StatusCode)
+	}
+
+	for _, section := range []string{"CSE-A", "CSE-C"} {
+		h.Repo.CreateAssignment(db.Assignment{Subject: "19CSE311", Section: section, Title: "Lab 1", Due: time.Now().Add(48 * time.Hour)})
+	}
+	var assignments []db.Assignment
+	h.DoJSON("GET", "/me/assignments", &assignments, apitest.Bearer(student))
+	if len(assignments) != 1 || assignments[0].Section != "CSE-A" {
+		t.Errorf("assignments of the student = %+v; want the one of CSE-A, their group's section", assignments)
+	}
+
+	resp, body = h.Do("POST", "/me/broadcasts?audience=section&target=CSE-A&title=Hi", apitest.Bearer(staff))
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("broadcast by synced staff = %d %s; want 202", resp.StatusCode, body)
+	}
+	json.Unmarshal(body, &task)
+	for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/me/broadcasts/"+task.ID, &task, apitest.Bearer(staff))
+	}
+	if task.State != jobs.TaskDone || task.Total != 2 {
+		t.Errorf("broadcast to CSE-A = %+v; want it sent to the two students of its group", task)
+	}
+	if resp, _ := h.Do("POST", "/me/broadcasts?audience=section&target=CSE-A&title=Hi", apitest.Bearer(student)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("a student broadcasting = %d; want 403", resp.StatusCode)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	h := newHarness(t)
+	own := h.Login(auth.Identity{ID: "u1", Mail: "student@cb.students.amrita.edu", GivenName: "Student"})
+	var users []db.User
+	h.DoJSON("GET", "/admin/directory", &users, apitest.AdminKey())
+	userID := strconv.FormatInt(users[0].ID, 10)
+
+	if resp, _ := h.Do("POST", "/admin/impersonations?user="+userID); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("impersonating without the admin key = %d; want 403", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/admin/impersonations?user="+userID+"&duration=24h", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("impersonating for a day = %d; want 400", resp.StatusCode)
+	}
+	if resp, _ := h.Do("POST", "/admin/impersonations?user=99", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("impersonating an unknown user = %d; want 404", resp.StatusCode)
+	}
+	resp, body := h.Do("POST", "/admin/impersonations?user="+userID+"&duration=30m", apitest.AdminKey())
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("impersonating = %d %s; want 201", resp.StatusCode, body)
+	}
+	var impersonation struct {
+		Session struct {
+			ID string `json:"id"`
+		} `json:"session"`
+	}
+	json.Unmarshal(body, &impersonation)
+	session := impersonation.Session.ID
+
+	resp, _ = h.Do("POST", "/me/favorites?kind=classroom&id=B201", apitest.Bearer(session))
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("X-Cora-Impersonated-By") != "admin" {
+		t.Errorf("starring as the student = %d, banner %q; want 201 flagged by admin", resp.StatusCode, resp.Header.Get("X-Cora-Impersonated-By"))
+	}
+	resp, _ = h.Do("GET", "/me/favorites", apitest.Bearer(own))
+	if resp.Header.Get("X-Cora-Impersonated-By") != "" {
+		t.Errorf("the student's own session is flagged as impersonated")
+	}
+	var favorites []db.Favorite
+	h.DoJSON("GET", "/me/favorites", &favorites, apitest.Bearer(own))
+	if len(favorites) != 1 {
+		t.Errorf("the student's favorites = %+v; want the one starred for them", favorites)
+	}
+
+	if resp, _ := h.Do("DELETE", "/admin/impersonations/"+own, apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("ending the student's own session = %d; want 404", resp.StatusCode)
+	}
+	if resp, _ := h.Do("DELETE", "/admin/impersonations/"+session, apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("ending the impersonation = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", "/me/favorites", apitest.Bearer(session)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("the impersonation after it ended = %d; want 401", resp.StatusCode)
+	}
+
+	var events []db.AuditEvent
+	h.DoJSON("GET", "/admin/audit", &events, apitest.AdminKey())
+	var actions []string
+	for _, event := range events {
+		actions = append(actions, event.Action)
+	}
+	want := []string{"impersonation.end", "impersonation.request", "impersonation.start"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("audit = %v; want %v", actions, want)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	h := newHarness(t)
+	bad := "/oauth/exchange?code=x&code_verifier=short"
+	for i := 0; i < 10; i++ {
+		if resp, _ := h.Do("GET", bad); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("failed exchange %d = %d; want 400", i, resp.StatusCode)
+		}
+	}
+	resp, _ := h.Do("GET", bad)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("exchange after 10 failures = %d; want 429 with Retry-After", resp.StatusCode)
+	}
+	// The lockout is of the address, API keys from it are refused too
+	if resp, _ := h.Do("GET", "/db/getAllSlot", apitest.Header("X-API-Key", "cora_0123456789abcdef_x")); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("API key from a locked out address = %d; want 429", resp.StatusCode)
+	}
+
+	var lockouts []struct {
+		IP string `json:"ip"`
+	}
+	h.DoJSON("GET", "/admin/security/lockouts", &lockouts, apitest.AdminKey())
+	if len(lockouts) != 1 || lockouts[0].IP != "127.0.0.1" {
+		t.Fatalf("lockouts = %+v; want 127.0.0.1", lockouts)
+	}
+	var events []db.SecurityEvent
+	h.DoJSON("GET", "/admin/security/events?kind=auth.lockout", &events, apitest.AdminKey())
+	if len(events) != 1 || events[0].IP != "127.0.0.1" {
+		t.Errorf("lockout events = %+v; want one", events)
+	}
+	h.DoJSON("GET", "/admin/security/events?kind=auth.failure&limit=500", &events, apitest.AdminKey())
+	if len(events) != 10 || events[0].Detail != "invalid code_verifier" {
+		t.Errorf("failure events = %d, latest %+v; want 10 bad verifiers", len(events), events[0])
+	}
+
+	if resp, _ := h.Do("DELETE", "/admin/security/lockouts/127.0.0.1", apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("lifting the lockout = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("DELETE", "/admin/security/lockouts/127.0.0.1", apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("lifting it again = %d; want 404", resp.StatusCode)
+	}
+	h.Login(auth.Identity{Mail: "student@cb.students.amrita.edu"})
+}
+
+func TestLoginChallenge(t *testing.T) {
+	verify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("secret") != "s3cret" || r.PostForm.Get("remoteip") != "127.0.0.1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"success": ` + strconv.FormatBool(r.PostForm.Get("response") == "human") + `}`))
+	}))
+	defer verify.Close()
+	h := apitest.New(t, func(config *api.Config) {
+		config.Challenger = auth.Captcha{VerifyURL: verify.URL, Secret: "s3cret"}
+	})
+	bad := "/oauth/exchange?code=x&code_verifier=short"
+	for i := 0; i < 3; i++ {
+		h.Do("GET", bad)
+	}
+	if resp, _ := h.Do("GET", bad); resp.StatusCode != http.StatusPreconditionRequired {
+		t.Errorf("exchange without an answer after 3 failures = %d; want 428", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", bad, apitest.Header("X-Cora-Challenge", "robot")); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("exchange with a wrong answer = %d; want 403", resp.StatusCode)
+	}
+	if resp, _ := h.Do("GET", bad, apitest.Header("X-Cora-Challenge", "human")); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("exchange with the right answer = %d; want it tried (400)", resp.StatusCode)
+	}
+}
+
+func TestTokenKeys(t *testing.T) {
+	const (
+		oldKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+		newKey = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+	)
+	old, err := seal.NewKeyring("old", map[string]string{"old": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := seal.NewKeyring("new", map[string]string{"old": oldKey, "new": newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := apitest.New(t, func(config *api.Config) {
+		config.TokenKeys = keys
+	})
+	mail := "faculty@cb.amrita.edu"
+	session := h.Login(auth.Identity{Mail: mail, GivenName: "Faculty"})
+	stored, err := h.Repo.GetSession(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keys.Current(stored.RefreshToken) {
+		t.Errorf("refresh token stored as %q; want it sealed with the new key", stored.RefreshToken)
+	}
+	sealedOld, err := old.Seal("refresh-old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour)
+	h.Repo.CreateSession(db.Session{ID: "plain", Provider: "fake", Mail: mail, RefreshToken: "refresh-plain", ExpiresAt: expires})
+	h.Repo.CreateSession(db.Session{ID: "old", Provider: "fake", Mail: mail, RefreshToken: sealedOld, ExpiresAt: expires})
+	h.Repo.CreateSession(db.Session{ID: "lost", Provider: "fake", Mail: mail, RefreshToken: "sealed:gone:AAAA", ExpiresAt: expires})
+
+	resp, body := h.Do("POST", "/admin/security/reseal", apitest.AdminKey())
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("reseal = %d %s; want 202", resp.StatusCode, body)
+	}
+	var task jobs.Task
+	json.Unmarshal(body, &task)
+	for deadline := time.Now().Add(5 * time.Second); task.FinishedAt == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		h.DoJSON("GET", "/admin/tasks/"+task.ID, &task, apitest.AdminKey())
+	}
+	result, _ := json.Marshal(task.Result)
+	if task.State != jobs.TaskDone || string(result) != `{"resealed":2,"unreadable":1}` {
+		t.Errorf("reseal = %+v %s; want 2 resealed and 1 unreadable", task, result)
+	}
+	for _, id := range []string{"plain", "old"} {
+		stored, _ := h.Repo.GetSession(id)
+		if !keys.Current(stored.RefreshToken) {
+			t.Errorf("refresh token of %s after reseal = %q; want it sealed with the new key", id, stored.RefreshToken)
+		}
+	}
+
+	h.Do("POST", "/oauth/logout", apitest.Bearer(session))
+	h.Do("POST", "/oauth/logout", apitest.Bearer("old"))
+	revoked := h.Provider.Revoked()
+	if len(revoked) != 2 || !strings.HasPrefix(revoked[0], "refresh-") || revoked[1] != "refresh-old" {
+		t.Errorf("revoked %v; want the refresh tokens decrypted", revoked)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	h := newHarness(t)
+	var mu sync.Mutex
+	var exported bytes.Buffer
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		io.Copy(&exported, r.Body)
+	}))
+	defer collector.Close()
+	tracer := tracing.New(tracing.Config{Endpoint: collector.URL, ServiceName: "coraserver", SampleRatio: 1})
+	go tracer.Run()
+	tracing.SetTracer(tracer)
+	defer tracing.SetTracer(nil)
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13", apitest.Header("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01"))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []string{`"name":"GET /db/freeclass"`, `"name":"db.GetFreeClass"`, `"traceId":"` + traceID + `"`, `"parentSpanId":"00f067aa0ba902b7"`} {
+		if !strings.Contains(exported.String(), want) {
+			t.Errorf("exported spans lack %s:\n%s", want, exported.String())
+		}
+	}
+}
+
+func TestTrafficLog(t *testing.T) {
+	h := newHarness(t)
+	mail := "student@cb.students.amrita.edu"
+	session := h.Login(auth.Identity{Mail: mail, GivenName: "Student"})
+	route := "/admin/logging?route=" + url.QueryEscape("/me/sessions")
+
+	if resp, _ := h.Do("PUT", route); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("logging without the admin key = %d; want 403", resp.StatusCode)
+	}
+	if resp, _ := h.Do("PUT", route+"&duration=48h", apitest.AdminKey()); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("logging for 48h = %d; want 400", resp.StatusCode)
+	}
+	h.Do("GET", "/me/sessions", apitest.Bearer(session))
+	if strings.Contains(h.Logs(), "DEBUG") {
+		t.Fatalf("logged before logging was turned on:\n%s", h.Logs())
+	}
+	if resp, body := h.Do("PUT", route, apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("logging = %d %s; want 204", resp.StatusCode, body)
+	}
+	var routes []struct {
+		Route string `json:"route"`
+	}
+	h.DoJSON("GET", "/admin/logging", &routes, apitest.AdminKey())
+	if len(routes) != 1 || routes[0].Route != "/me/sessions" {
+		t.Errorf("logged routes = %+v; want /me/sessions", routes)
+	}
+
+	h.Do("GET", "/me/sessions?token=s3cret&limit=5", apitest.Bearer(session))
+	logs := h.Logs()
+	if !strings.Contains(logs, "DEBUG GET /me/sessions (/me/sessions) query=limit=5&token=%5Bredacted%5D") {
+		t.Errorf("request not logged with its redacted parameters:\n%s", logs)
+	}
+	for _, secret := range []string{session, mail, "s3cret", "127.0.0.1"} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs contain %q:\n%s", secret, logs)
+		}
+	}
+
+	if resp, _ := h.Do("DELETE", route, apitest.AdminKey()); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("stop logging = %d; want 204", resp.StatusCode)
+	}
+	if resp, _ := h.Do("DELETE", route, apitest.AdminKey()); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("stop logging again = %d; want 404", resp.StatusCode)
+	}
+	h.Do("GET", "/me/sessions", apitest.Bearer(session))
+	if strings.Count(h.Logs(), "DEBUG") != 1 {
+		t.Errorf("logged after logging was turned off:\n%s", h.Logs())
+	}
+}
+
+func TestAnnouncements(t *testing.T) {
+	h := newHarness(t)
+	later := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+
+	resp, _ := h.Do("POST", "/admin/announcements?title=Now&body=Exams", apitest.AdminKey())
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating an announcement = %d; want 201", resp.StatusCode)
+	}
+	h.Do("POST", "/admin/announcements?title=Later&startsAt="+later, apitest.AdminKey())
+
+	var announcements []db.Announcement
+	h.DoJSON("GET", "/announcements", &announcements)
+	if len(announcements) != 1 || announcements[0].Title != "Now" {
+		t.Errorf("active announcements = %+v; want only \"Now\"", announcements)
+	}
+	h.DoJSON("GET", "/admin/announcements", &announcements, apitest.AdminKey())
+	if len(announcements) != 2 {
+		t.Errorf("all announcements = %+v; want 2", announcements)
+	}
+	resp, _ = h.Do("DELETE", "/admin/announcements/99", apitest.AdminKey())
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleting a missing announcement = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	h := newHarness(t)
+	session := h.Login(auth.Identity{Mail: "faculty@cb.amrita.edu"})
+
+	query := url.QueryEscape(`{ freeClasses(date: "2023-06-13", slot: 1, endSlot: 2) timetable(class: "B201", date: "2023-06-13") { slot subject } me { mail } }`)
+	var response struct {
+		Data struct {
+			FreeClasses []string
+			Timetable   []struct {
+				Slot    int
+				Subject string
+			}
+			Me *struct{ Mail string }
+		}
+		Errors []interface{}
+	}
+	h.DoJSON("GET", "/graphql?query="+query, &response, apitest.Bearer(session))
+	if want := []string{"A104"}; !reflect.DeepEqual(response.Data.FreeClasses, want) || response.Errors != nil {
+		t.Errorf("freeClasses = %v, errors %v; want %v", response.Data.FreeClasses, response.Errors, want)
+	}
+	if len(response.Data.Timetable) != 3 || response.Data.Timetable[0].Subject != "19CSE302" {
+		t.Errorf("timetable = %+v; want 3 periods starting with 19CSE302", response.Data.Timetable)
+	}
+	if response.Data.Me == nil || response.Data.Me.Mail != "faculty@cb.amrita.edu" {
+		t.Errorf("me = %+v; want the logged in user", response.Data.Me)
+	}
+
+	response.Data.Me = nil
+	h.DoJSON("GET", "/graphql?query="+url.QueryEscape(`{ me { mail } week(class: "A104", date: "bad") { date } }`), &response)
+	if response.Data.Me != nil || len(response.Errors) != 1 {
+		t.Errorf("without session = me %+v, errors %v; want null and one error", response.Data.Me, response.Errors)
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	h := newHarness(t)
+	session := h.Login(auth.Identity{Mail: "student@cb.amrita.edu"})
+
+	resp, body := h.Do("POST", "/me/favorites?kind=classroom&id=B201", apitest.Bearer(session))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("starring B201 = %d %s; want 201", resp.StatusCode, body)
+	}
+	h.Do("POST", "/me/favorites?kind=section&id=CSE-B", apitest.Bearer(session))
+	resp, _ = h.Do("POST", "/me/favorites?kind=classroom&id=Z999", apitest.Bearer(session))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("starring an unknown classroom = %d; want 400", resp.StatusCode)
+	}
+	var favorites []db.Favorite
+	h.DoJSON("GET", "/me/favorites", &favorites, apitest.Bearer(session))
+	if len(favorites) != 2 || favorites[0].Target != "B201" || favorites[1].Kind != "section" {
+		t.Errorf("favorites = %+v; want B201 and CSE-B", favorites)
+	}
+
+	var classes []string
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13&onlyFavorites=true", &classes, apitest.Bearer(session))
+	if want := []string{"B201"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("favorite free classes = %v; want %v", classes, want)
+	}
+	resp, _ = h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13&onlyFavorites=true")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("onlyFavorites without a session = %d; want 401", resp.StatusCode)
+	}
+
+	resp, _ = h.Do("DELETE", "/me/favorites/classroom/B201", apitest.Bearer(session))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("unstarring B201 = %d; want 204", resp.StatusCode)
+	}
+	h.DoJSON("GET", "/db/freeclass?slot=2&date=2023-06-13&onlyFavorites=true", &classes, apitest.Bearer(session))
+	if len(classes) != 0 {
+		t.Errorf("favorite free classes after unstarring = %v; want none", classes)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	h := newHarness(t)
+	session := h.Login(auth.Identity{Mail: "student@cb.amrita.edu"})
+
+	h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-13", apitest.Bearer(session))
+	h.Do("GET", "/db/freeclass?slot=2&date=2023-06-13", apitest.Bearer(session))
+	h.Do("GET", "/db/daytimetable?class=A104&date=2023-06-14", apitest.Bearer(session))
+	// Not the user's, no session
+	h.Do("GET", "/db/freeslot?class=B201&date=2023-06-13")
+
+	var views []db.RecentView
+	h.DoJSON("GET", "/me/recent", &views, apitest.Bearer(session))
+	if len(views) != 2 || views[0].Kind != db.ViewTimetable || views[0].Date.Format("2006-01-02") != "2023-06-14" ||
+		views[1].Kind != db.SearchFreeClass || views[1].StartSlot != 2 {
+		t.Errorf("recent = %+v; want the A104 timetable of the 14th then the slot 2 search", views)
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	h := newHarness(t)
+	session := h.Login(auth.Identity{Mail: "student@cb.amrita.edu"})
+
+	var preferences map[string]interface{}
+	h.DoJSON("GET", "/me/preferences", &preferences, apitest.Bearer(session))
+	if len(preferences) != 0 {
+		t.Errorf("preferences before saving = %v; want {}", preferences)
+	}
+	h.DoJSON("PUT", "/me/preferences", &preferences, apitest.Bearer(session),
+		apitest.JSONBody(`{"defaultSection": "CSE-B", "notifications": {"bookings": true, "reminderMinutes": 10}}`))
+	h.DoJSON("GET", "/me/preferences", &preferences, apitest.Bearer(session))
+	if preferences["defaultSection"] != "CSE-B" || preferences["notifications"] == nil {
+		t.Errorf("saved preferences = %v; want the section and notifications", preferences)
+	}
+
+	for _, body := range []string{`{"defaultSecton": "CSE-B"}`, `{"theme": "pink"}`, `{"language": "xx"}`, `[]`} {
+		resp, _ := h.Do("PUT", "/me/preferences", apitest.Bearer(session), apitest.JSONBody(body))
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("saving %s = %d; want 400", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestExams(t *testing.T) {
+	h := newHarness(t)
+	csv := "subject,date,startTime,endTime,class,firstRoll,lastRoll\n" +
+		"19CSE311,2099-05-02,09:30,12:30,A104,CB.EN.U4CSE20001,CB.EN.U4CSE20030\n" +
+		"19CSE311,2099-05-02,09:30,12:30,B201,CB.EN.U4CSE20031,CB.EN.U4CSE20060\n" +
+		"19CSE302,2099-05-04,14:00,17:00,A104,CB.EN.U4CSE20001,CB.EN.U4CSE20060\n"
+	resp, body := h.Do("POST", "/admin/exams/import", apitest.AdminKey(), apitest.Body("text/csv", csv))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("importing exams = %d %s; want 201", resp.StatusCode, body)
+	}
+	var exams []db.Exam
+	h.DoJSON("GET", "/admin/exams", &exams, apitest.AdminKey())
+	if len(exams) != 2 || len(exams[0].Halls) != 2 {
+		t.Fatalf("exams = %+v; want 2, the first in two halls", exams)
+	}
+
+	overlapping := `{"subject": "19CSE311", "date": "2099-05-06", "startTime": "09:30", "endTime": "12:30", "halls": [
+		{"class": "A104", "firstRoll": "CB.EN.U4CSE20001", "lastRoll": "CB.EN.U4CSE20040"},
+		{"class": "B201", "firstRoll": "CB.EN.U4CSE20031", "lastRoll": "CB.EN.U4CSE20060"}]}`
+	resp, _ = h.Do("POST", "/admin/exams", apitest.AdminKey(), apitest.JSONBody(overlapping))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("overlapping halls = %d; want 400", resp.StatusCode)
+	}
+
+	session := h.Login(auth.Identity{Mail: "cb.en.u4cse20042@cb.students.amrita.edu"})
+	var mine []struct {
+		Subject string
+		Class   string
+	}
+	h.DoJSON("GET", "/me/exams", &mine, apitest.Bearer(session))
+	if len(mine) != 2 || mine[0].Class != "B201" || mine[1].Class != "A104" {
+		t.Errorf("my exams = %+v; want 19CSE311 in B201 and 19CSE302 in A104", mine)
+	}
+	resp, body = h.Do("GET", "/me/calendar.ics", apitest.Bearer(session))
+	if resp.StatusCode != http.StatusOK || strings.Count(string(body), "BEGIN:VEVENT") != 2 ||
+		!strings.Contains(string(body), "LOCATION:B201\r\n") {
+		t.Errorf("calendar = %d %s; want both exams", resp.StatusCode, body)
+	}
+}
+
+func TestExamAllocation(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddStatic("A105", "TUE", 1, "FREE")
+	for _, room := range []string{"A104?capacity=40&building=AB1&floor=1", "A105?capacity=40&building=AB1&floor=1",
+		"B201?capacity=100&building=AB2&floor=2"} {
+		resp, body := h.Do("PUT", "/admin/classrooms/"+room, apitest.AdminKey())
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("setting %s = %d %s; want 204", room, resp.StatusCode, body)
+		}
+	}
+	csv := "subject,date,startTime,endTime,class,firstRoll,lastRoll\n" +
+		"19CSE311,2099-05-02,09:30,12:30,A104,CB.EN.U4CSE20001,CB.EN.U4CSE20001\n" +
+		"19CSE302,2099-05-02,11:00,13:00,A104,CB.EN.U4ECE20001,CB.EN.U4ECE20001\n" +
+		"19MNG332,2099-05-02,10:00,11:00,A104,CB.EN.U4MEE20001,CB.EN.U4MEE20001\n"
+	h.Do("POST", "/admin/exams/import", apitest.AdminKey(), apitest.Body("text/csv", csv))
+
+	var plan []struct {
+		Class     string
+		FirstRoll string
+		LastRoll  string
+	}
+	// One hall of AB2 beats both halls of AB1
+	h.DoJSON("POST", "/admin/exams/1/allocation?save=true", &plan, apitest.AdminKey(),
+		apitest.JSONBody(`{"students": [{"firstRoll": "CB.EN.U4CSE20001", "count": 45}]}`))
+	if len(plan) != 1 || plan[0].Class != "B201" || plan[0].LastRoll != "CB.EN.U4CSE20045" {
+		t.Errorf("plan = %+v; want B201 for CSE20001 to CSE20045", plan)
+	}
+	// B201 is now taken from 09:30 to 12:30
+	h.DoJSON("POST", "/admin/exams/2/allocation", &plan, apitest.AdminKey(),
+		apitest.JSONBody(`{"students": [{"firstRoll": "CB.EN.U4ECE20001", "count": 30}]}`))
+	if len(plan) != 2 || plan[0].Class != "A104" || plan[0].LastRoll != "CB.EN.U4ECE20020" ||
+		plan[1].Class != "A105" || plan[1].FirstRoll != "CB.EN.U4ECE20021" {
+		t.Errorf("plan = %+v; want A104 for ECE20001 to ECE20020 and A105 for the rest", plan)
+	}
+	resp, _ := h.Do("POST", "/admin/exams/3/allocation", apitest.AdminKey(),
+		apitest.JSONBody(`{"students": [{"firstRoll": "CB.EN.U4MEE20001", "count": 41}]}`))
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("allocating more than the free seats = %d; want 409", resp.StatusCode)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	h := newHarness(t)
+	h.Repo.AddSubject("19CSE311", "Computer Security")
+	h.Repo.AddSubject("19CSE302", "Design and Analysis of Algorithms")
+	h.Repo.AddFaculty("r_kumar@cb.amrita.edu", "Ramesh Kumar")
+
+	cases := []struct {
+		q    string
+		want string
+	}{
+		{"a104", "classroom A104"},
+		{"19cse311", "subject 19CSE311"},
+		{"security", "subject 19CSE311"},
+		{"algoritms", "subject 19CSE302"},
+		{"Kumar", "faculty r_kumar@cb.amrita.edu"},
+	}
+	for _, c := range cases {
+		var results []struct {
+			Type string
+			ID   string
+		}
+		h.DoJSON("GET", "/api/v1/search?q="+url.QueryEscape(c.q), &results)
+		if len(results) == 0 || results[0].Type+" "+results[0].ID != c.want {
+			t.Errorf("search %q = %+v; want %s first", c.q, results, c.want)
+		}
+	}
+	resp, _ := h.Do("GET", "/api/v1/search?q=")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty search = %d; want 400", resp.StatusCode)
+	}
+}
+
+func TestCustomRoute(t *testing.T) {
+	h := newHarness(t)
+	h.Router.Get("/custom/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	resp, body := h.Do("GET", "/custom/fork")
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" {
+		t.Errorf("custom route = %d %q; want 200 \"hello\"", resp.StatusCode, body)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	api.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("/debug/vars is not JSON: %v", err)
+	}
+	for _, name := range []string{"goroutines", "memstats", "uptime"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("/debug/vars lacks %s", name)
+		}
+	}
+}
+
+func TestUpdateSettings(t *testing.T) {
+	h := newHarness(t)
+	preflight := []apitest.Option{
+		apitest.Header("Origin", "https://cora.example.edu"),
+		apitest.Header("Access-Control-Request-Method", "DELETE"),
+	}
+
+	resp, _ := h.Do("OPTIONS", "/me/sessions/1", preflight...)
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("origin allowed before it was configured")
+	}
+	err := h.Server.UpdateSettings(api.Settings{AdminKey: "new-key", AllowedOrigins: []string{"https://cora.example.edu"}})
+	if err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+	resp, _ = h.Do("OPTIONS", "/me/sessions/1", preflight...)
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://cora.example.edu" {
+		t.Errorf("preflight = %d %v; want 204 allowing the origin", resp.StatusCode, resp.Header)
+	}
+	resp, _ = h.Do("GET", "/admin/apikeys", apitest.AdminKey())
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("old admin key = %d; want 403", resp.StatusCode)
+	}
+
+	err = h.Server.UpdateSettings(api.Settings{AdminKey: "other", AllowedOrigins: []string{"cora.example.edu/app"}})
+	if err == nil {
+		t.Fatalf("UpdateSettings() accepted an invalid origin")
+	}
+	resp, _ = h.Do("GET", "/admin/apikeys", apitest.Header("X-Admin-Key", "new-key"))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("admin key after rejected update = %d; want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+/*
+Scopes an API key can be given, as resource:action. A key can also be given
+every scope of a resource at once, like "admin:*".
+*/
+const (
+	ScopeFreeClassRead = "freeclass:read"
+	ScopeTimetableRead = "timetable:read"
+	ScopeAnalyticsRead = "analytics:read"
+	ScopeBookingRead   = "booking:read"
+	ScopeBookingWrite  = "booking:write"
+	ScopeAdminRead     = "admin:read"
+	ScopeAdminWrite    = "admin:write"
+)
+
+var apiKeyScopes = []string{ScopeFreeClassRead, ScopeTimetableRead, ScopeAnalyticsRead,
+	ScopeBookingRead, ScopeBookingWrite, ScopeAdminRead, ScopeAdminWrite}
+
+// validScope reports whether scope is one of apiKeyScopes or all the scopes of one of their resources
+func validScope(scope string) bool {
+	for _, known := range apiKeyScopes {
+		if scope == known || scope == strings.SplitN(known, ":", 2)[0]+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// Requests per minute when none is given at issue time and Settings has none either
+	defaultAPIKeyRateLimit = 60
+	// How long the old key keeps working after a rotation, unless told otherwise
+	defaultAPIKeyGrace = 24 * time.Hour
+)
+
+type apiKeyContextKey struct{}
+
+// requestAPIKey returns the API key the request was authenticated with by apiKeyScope, if any
+func requestAPIKey(r *http.Request) (db.APIKey, bool) {
+	key, ok := r.Context().Value(apiKeyContextKey{}).(db.APIKey)
+	return key, ok
+}
+
+/*
+API keys look like cora_<id>_<secret>. The id is stored as is to find the key,
+the secret, of size random bytes, only as a SHA-256 hash.
+*/
+func newAPIKey(size int) (id string, secret string, err error) {
+	id, err = token.Hex(8)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err = token.URLSafe(size)
+	if err != nil {
+		return "", "", err
+	}
+	return id, secret, nil
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// In multi-tenant mode keys start with the tenant, like amrita.cora_<id>_<secret>
+func (s *Server) formatAPIKey(id string, secret string) string {
+	if s.config.Tenant != "" {
+		return s.config.Tenant + tenantSeparator + "cora_" + id + "_" + secret
+	}
+	return "cora_" + id + "_" + secret
+}
+
+func parseAPIKey(key string) (id string, secret string, ok bool) {
+	_, key = splitTenant(key)
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != "cora" || len(parts[1]) != 16 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// Errors of AuthenticateAPIKey
+var (
+	ErrInvalidAPIKey = errors.New("api: invalid API key")
+	ErrAPIKeyScope   = errors.New("api: API key lacks the scope")
+)
+
+// RateLimitError is returned by AuthenticateAPIKey for a key over its rate limit
+type RateLimitError struct {
+	// Until the next request is allowed
+	Wait time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "api: API key rate limit exceeded"
+}
+
+/*
+AuthenticateAPIKey checks an API key as sent in X-API-Key: it has to be
+active, carry scope and be within its rate limit. It is exported for the
+gRPC server, which takes the same keys.
+*/
+func (s *Server) AuthenticateAPIKey(header string, scope string) (db.APIKey, error) {
+	id, secret, ok := parseAPIKey(header)
+	if !ok {
+		return db.APIKey{}, ErrInvalidAPIKey
+	}
+	key, err := s.repo.GetAPIKey(id)
+	if err == sql.ErrNoRows {
+		return db.APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return db.APIKey{}, err
+	}
+	now := time.Now()
+	hash := hashAPIKeySecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(key.SecretHash)) != 1 || !key.Active(now) {
+		return db.APIKey{}, ErrInvalidAPIKey
+	}
+	if !key.HasScope(scope) {
+		return db.APIKey{}, ErrAPIKeyScope
+	}
+	if ok, wait := s.apiKeyLimiter.Allow(key.ID, key.RateLimit, key.RateLimit); !ok {
+		return db.APIKey{}, &RateLimitError{Wait: wait}
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		s.repo.TouchAPIKey(key.ID, now)
+	}
+	return key, nil
+}
+
+/*
+apiKeyScope checks the X-API-Key header with AuthenticateAPIKey when one is
+sent, and puts the key in the request context for the handlers after it.
+Requests without the header are passed on untouched, so a public endpoint
+behind it stays public.
+*/
+func (s *Server) apiKeyScope(scope string) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get(apiKeyHeader)
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !s.checkLockout(w, r) {
+				return
+			}
+			key, err := s.AuthenticateAPIKey(header, scope)
+			if rateLimitErr, ok := err.(*RateLimitError); ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(rateLimitErr.Wait/time.Second)+1))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			switch err {
+			case nil:
+			case ErrInvalidAPIKey:
+				subject := ""
+				if id, _, ok := parseAPIKey(header); ok {
+					subject = "apikey:" + id
+				}
+				s.authFailed(r, subject, "invalid API key")
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			case ErrAPIKeyScope:
+				http.Error(w, "API key lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+		})
+	}
+}
+
+// adminAPIKeyScope is apiKeyScope for the admin endpoints: reading takes admin:read, anything else admin:write
+func (s *Server) adminAPIKeyScope(next http.Handler) http.Handler {
+	read := s.apiKeyScope(ScopeAdminRead)(next)
+	write := s.apiKeyScope(ScopeAdminWrite)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			read.ServeHTTP(w, r)
+			return
+		}
+		write.ServeHTTP(w, r)
+	})
+}
+
+// requireAdminKey keeps API keys, even admin:* ones, from managing API keys and from the debug endpoints
+func requireAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestAPIKey(r); ok {
+			http.Error(w, "Only the admin key is allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returned once when a key is issued or rotated, the secret cannot be recovered later
+type issuedAPIKeyResponse struct {
+	db.APIKey
+	Key string `json:"key"`
+}
+
+func parseScopes(value string) ([]string, bool) {
+	var scopes []string
+	for _, scope := range strings.Split(value, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !validScope(scope) {
+			return nil, false
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, len(scopes) > 0
+}
+
+// Lists every key, without secrets
+func (s *Server) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.repo.GetAllAPIKey()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if keys == nil {
+		keys = []db.APIKey{}
+	}
+	s.writeJSON(w, r, http.StatusOK, keys)
+}
+
+// Issues a key from the name, scopes (comma separated) and rateLimit (requests per minute) parameters
+func (s *Server) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Name      string `param:"name,required,max=64"`
+		Scopes    string `param:"scopes"`
+		RateLimit int    `param:"rateLimit,min=1"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	name := query.Name
+	scopes, ok := parseScopes(query.Scopes)
+	if !ok {
+		http.Error(w, "Invalid scopes value, expected some of "+strings.Join(apiKeyScopes, ",")+" or resource:*", http.StatusBadRequest)
+		return
+	}
+	rateLimit := s.apiKeyRateLimit()
+	if query.RateLimit != 0 {
+		rateLimit = query.RateLimit
+	}
+	id, secret, err := newAPIKey(s.config.TokenBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := db.APIKey{
+		ID:         id,
+		Name:       name,
+		SecretHash: hashAPIKeySecret(secret),
+		Scopes:     scopes,
+		RateLimit:  rateLimit,
+		CreatedAt:  time.Now(),
+	}
+	err = s.repo.CreateAPIKey(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditCreateAPIKey, id, name)
+	s.writeJSON(w, r, http.StatusCreated, issuedAPIKeyResponse{APIKey: key, Key: s.formatAPIKey(id, secret)})
+}
+
+func (s *Server) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	rowsAffected, err := s.repo.RevokeAPIKey(id, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such active API key", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditRevokeAPIKey, id, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+rotateAPIKeyHandler issues a replacement for the key in the path with the same
+name, scopes and rate limit. The old key keeps working for grace seconds
+(a day by default) so that clients can be switched over without downtime.
+*/
+func (s *Server) rotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		// In seconds
+		Grace *int `param:"grace,min=0"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	grace := defaultAPIKeyGrace
+	if query.Grace != nil {
+		grace = time.Duration(*query.Grace) * time.Second
+	}
+	old, err := s.repo.GetAPIKey(router.Param(r, "id"))
+	now := time.Now()
+	if err == sql.ErrNoRows || (err == nil && !old.Active(now)) {
+		http.Error(w, "No such active API key", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, secret, err := newAPIKey(s.config.TokenBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := db.APIKey{
+		ID:         id,
+		Name:       old.Name,
+		SecretHash: hashAPIKeySecret(secret),
+		Scopes:     old.Scopes,
+		RateLimit:  old.RateLimit,
+		CreatedAt:  now,
+	}
+	err = s.repo.RotateAPIKey(old.ID, key, now.Add(grace))
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such active API key", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditRotateAPIKey, old.ID, "replaced by "+id)
+	s.writeJSON(w, r, http.StatusOK, issuedAPIKeyResponse{APIKey: key, Key: s.formatAPIKey(id, secret)})
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest accepted assignment title and link, in bytes
+const (
+	maxAssignmentTitleLength = 128
+	maxAssignmentLinkLength  = 512
+)
+
+// Students are reminded of an assignment once it is due within this long
+const assignmentReminderLead = 24 * time.Hour
+
+// teaches tells whether the timetable has mail teaching subject somewhere
+func (s *Server) teaches(mail string, subject string) (bool, error) {
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Subject: subject})
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Faculty, mail) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+readAssignment fills the section, title, due date (RFC 3339, in the future)
+and link of assignment from the request. On failure it has already written the
+error response.
+*/
+func (s *Server) readAssignment(w http.ResponseWriter, r *http.Request, assignment *db.Assignment) bool {
+	var query struct {
+		Section string    `param:"section"`
+		Title   string    `param:"title"`
+		Due     time.Time `param:"due,required,instant"`
+		Link    string    `param:"link"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return false
+	}
+	assignment.Section = query.Section
+	assignment.Title = query.Title
+	assignment.Due = query.Due
+	assignment.Link = query.Link
+	if len(assignment.Section) > maxSectionLength {
+		http.Error(w, "Invalid section value", http.StatusBadRequest)
+		return false
+	}
+	if assignment.Title == "" || len(assignment.Title) > maxAssignmentTitleLength {
+		http.Error(w, "Invalid title value", http.StatusBadRequest)
+		return false
+	}
+	if !assignment.Due.After(time.Now()) {
+		http.Error(w, "Invalid due value", http.StatusBadRequest)
+		return false
+	}
+	if assignment.Link != "" {
+		u, err := url.Parse(assignment.Link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			len(assignment.Link) > maxAssignmentLinkLength {
+			http.Error(w, "Invalid link value", http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// writeAssignment answers with assignment and status
+func (s *Server) writeAssignment(w http.ResponseWriter, r *http.Request, status int, assignment db.Assignment) {
+	s.writeJSON(w, r, status, assignment)
+}
+
+/*
+myAssignments lists the assignments due from now on for the sections the user
+starred or their groups put them in, and those set for everyone in a subject.
+Users in no section see them all.
+*/
+func (s *Server) myAssignments(mail string) ([]db.Assignment, error) {
+	favorites, err := s.repo.GetFavorites(mail)
+	if err != nil {
+		return nil, err
+	}
+	var sections []string
+	for _, favorite := range favorites {
+		if favorite.Kind == db.FavoriteSection {
+			sections = append(sections, favorite.Target)
+		}
+	}
+	groupSections, err := s.groupSections(mail)
+	if err != nil {
+		return nil, err
+	}
+	sections = append(sections, groupSections...)
+	assignments, err := s.repo.GetAssignments(db.AssignmentFilter{DueAfter: time.Now()})
+	if err != nil {
+		return nil, err
+	}
+	mine := []db.Assignment{}
+	for _, assignment := range assignments {
+		if len(sections) == 0 || assignment.Section == "" || containsString(sections, assignment.Section) {
+			mine = append(mine, assignment)
+		}
+	}
+	return mine, nil
+}
+
+/*
+myAssignmentsHandler is the user's feed of upcoming assignments, soonest due
+first. With mine=true it lists the ones the user set instead, past ones too.
+*/
+func (s *Server) myAssignmentsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Mine bool `param:"mine"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	var assignments []db.Assignment
+	var err error
+	if query.Mine {
+		assignments, err = s.repo.GetAssignments(db.AssignmentFilter{CreatedBy: currentSession(r).Mail})
+	} else {
+		assignments, err = s.myAssignments(currentSession(r).Mail)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if assignments == nil {
+		assignments = []db.Assignment{}
+	}
+	s.writeJSON(w, r, http.StatusOK, assignments)
+}
+
+// Sets an assignment in a subject the user teaches
+func (s *Server) createAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Subject string `param:"subject"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	assignment := db.Assignment{
+		Subject:   query.Subject,
+		CreatedBy: currentSession(r).Mail,
+		CreatedAt: time.Now(),
+	}
+	if !s.readAssignment(w, r, &assignment) {
+		return
+	}
+	teaches, err := s.teaches(assignment.CreatedBy, assignment.Subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !teaches {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	assignment.ID, err = s.repo.CreateAssignment(assignment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeAssignment(w, r, http.StatusCreated, assignment)
+}
+
+// ownAssignment returns the assignment of the path if the user set it. On failure it has already written the error response.
+func (s *Server) ownAssignment(w http.ResponseWriter, r *http.Request) (db.Assignment, bool) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return db.Assignment{}, false
+	}
+	assignments, err := s.repo.GetAssignments(db.AssignmentFilter{CreatedBy: currentSession(r).Mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.Assignment{}, false
+	}
+	for _, assignment := range assignments {
+		if assignment.ID == id {
+			return assignment, true
+		}
+	}
+	http.Error(w, "No such assignment", http.StatusNotFound)
+	return db.Assignment{}, false
+}
+
+// Changes the section, title, due date or link of one of the user's assignments
+func (s *Server) updateAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	assignment, ok := s.ownAssignment(w, r)
+	if !ok || !s.readAssignment(w, r, &assignment) {
+		return
+	}
+	err := s.repo.UpdateAssignment(assignment)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such assignment", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeAssignment(w, r, http.StatusOK, assignment)
+}
+
+func (s *Server) deleteAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	assignment, ok := s.ownAssignment(w, r)
+	if !ok {
+		return
+	}
+	_, err := s.repo.DeleteAssignment(assignment.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+SendAssignmentReminders tells the users who starred the section of every
+assignment coming due within a day, once per assignment. Assignments for no
+section in particular are not reminded of, as nobody is known to take them.
+It returns how many reminders it sent.
+*/
+func (s *Server) SendAssignmentReminders(now time.Time) int {
+	assignments, err := s.repo.GetAssignments(db.AssignmentFilter{
+		DueAfter:   now,
+		DueBefore:  now.Add(assignmentReminderLead),
+		Unreminded: true,
+	})
+	if err != nil {
+		s.logger.Println("Error listing assignments to remind of", err)
+		return 0
+	}
+	sent := 0
+	for _, assignment := range assignments {
+		var students []string
+		if assignment.Section != "" {
+			students, err = s.repo.GetFavoriteUsers(db.FavoriteSection, assignment.Section)
+			if err != nil {
+				s.logger.Println("Error listing students to remind", err)
+				continue
+			}
+			members, err := s.groupSectionMembers(assignment.Section)
+			if err != nil {
+				s.logger.Println("Error listing students to remind", err)
+				continue
+			}
+			for _, mail := range members {
+				if !containsString(students, mail) {
+					students = append(students, mail)
+				}
+			}
+		}
+		for _, mail := range students {
+			s.notifyUser(mail, notify.KindAssignment,
+				i18n.M("%s: %s is due soon", assignment.Subject, assignment.Title),
+				i18n.M("%s is due %s.", assignment.Title, assignment.Due.In(s.config.Location).Format("Mon 2 Jan 15:04")))
+			sent++
+		}
+		err = s.repo.MarkAssignmentReminded(assignment.ID)
+		if err != nil {
+			s.logger.Println("Error marking an assignment reminded", err)
+		}
+	}
+	return sent
+}
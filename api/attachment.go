@@ -0,0 +1,252 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+/*
+AttachmentUploadPath is where files are uploaded. Its bodies are capped by
+Config.MaxUploadBytes rather than the server wide limit on request bodies.
+*/
+const AttachmentUploadPath = "/me/attachments"
+
+// Room for the multipart boundaries and headers around the file
+const multipartOverhead = 64 << 10
+
+// Longest accepted file name, in bytes
+const maxAttachmentNameLength = 255
+
+// How long a signed download URL works
+const attachmentURLLifetime = time.Hour
+
+/*
+An uploadType is a kind of file that can be uploaded, by extension. Sniffed is
+what http.DetectContentType makes of its content, which has to match: office
+documents are zip files and CSV is plain text to it.
+*/
+type uploadType struct {
+	ContentType string
+	Sniffed     string
+}
+
+var uploadTypes = map[string]uploadType{
+	".pdf":  {"application/pdf", "application/pdf"},
+	".png":  {"image/png", "image/png"},
+	".jpg":  {"image/jpeg", "image/jpeg"},
+	".jpeg": {"image/jpeg", "image/jpeg"},
+	".gif":  {"image/gif", "image/gif"},
+	".txt":  {"text/plain; charset=utf-8", "text/plain"},
+	".csv":  {"text/csv; charset=utf-8", "text/plain"},
+	".zip":  {"application/zip", "application/zip"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "application/zip"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", "application/zip"},
+}
+
+// An uploadResponse describes the attachment along with a signed URL to download it from
+type uploadResponse struct {
+	db.Attachment
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// baseURL is the scheme and host the request was made to, as clients see them
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) attachmentSignature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.config.AttachmentKey)
+	mac.Write([]byte(id + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedAttachmentURL returns a URL anyone can download the attachment from until it expires
+func (s *Server) signedAttachmentURL(r *http.Request, id string) (string, time.Time) {
+	expires := time.Now().Add(attachmentURLLifetime).Truncate(time.Second)
+	return baseURL(r) + "/files/" + id + "?expires=" + strconv.FormatInt(expires.Unix(), 10) +
+		"&sig=" + s.attachmentSignature(id, expires.Unix()), expires
+}
+
+func (s *Server) writeUpload(w http.ResponseWriter, r *http.Request, status int, attachment db.Attachment) {
+	response := uploadResponse{Attachment: attachment}
+	response.URL, response.Expires = s.signedAttachmentURL(r, attachment.ID)
+	s.writeJSON(w, r, status, response)
+}
+
+/*
+uploadAttachmentHandler stores the multipart field "file" and answers with its
+description and a signed download URL. Files larger than MaxUploadBytes or of
+a type not in uploadTypes are refused.
+*/
+func (s *Server) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	if s.config.Storage == nil {
+		http.Error(w, "Uploads are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if r.ContentLength > s.config.MaxUploadBytes+multipartOverhead {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUploadBytes+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Invalid file value", http.StatusBadRequest)
+		return
+	}
+	var content []byte
+	var name string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Invalid file value", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		name = filepath.Base(strings.ReplaceAll(part.FileName(), `\`, "/"))
+		content, err = ioutil.ReadAll(io.LimitReader(part, s.config.MaxUploadBytes+1))
+		if err != nil {
+			http.Error(w, "Invalid file value", http.StatusBadRequest)
+			return
+		}
+		break
+	}
+	if name == "" || name == "." || name == "/" || len(name) > maxAttachmentNameLength {
+		http.Error(w, "Invalid file value", http.StatusBadRequest)
+		return
+	}
+	if int64(len(content)) > s.config.MaxUploadBytes {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	kind, ok := uploadTypes[strings.ToLower(filepath.Ext(name))]
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	if !ok || sniffed != kind.Sniffed {
+		http.Error(w, "Unsupported file type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	attachment := db.Attachment{
+		Name:        name,
+		ContentType: kind.ContentType,
+		Size:        int64(len(content)),
+		UploadedBy:  currentSession(r).Mail,
+		CreatedAt:   time.Now(),
+	}
+	// 16 random bytes, hex encoded to fit the CHAR(32) id column
+	attachment.ID, err = token.Hex(16)
+	if err == nil {
+		err = s.config.Storage.Put(r.Context(), attachment.ID, bytes.NewReader(content), attachment.Size, attachment.ContentType)
+	}
+	if err == nil {
+		err = s.repo.CreateAttachment(attachment)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeUpload(w, r, http.StatusCreated, attachment)
+}
+
+// Deletes an attachment the user uploaded
+func (s *Server) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, err := s.repo.GetAttachment(router.Param(r, "id"))
+	if err == sql.ErrNoRows || (err == nil && !strings.EqualFold(attachment.UploadedBy, currentSession(r).Mail)) {
+		http.Error(w, "No such attachment", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		_, err = s.repo.DeleteAttachment(attachment.ID)
+	}
+	if err == nil && s.config.Storage != nil {
+		err = s.config.Storage.Delete(r.Context(), attachment.ID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+attachmentHandler redirects a logged in user to a fresh signed URL of the
+attachment. It is the link to put in announcements and assignments, which
+outlive the signed URLs.
+*/
+func (s *Server) attachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, err := s.repo.GetAttachment(router.Param(r, "id"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such attachment", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	signedURL, _ := s.signedAttachmentURL(r, attachment.ID)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.Redirect(w, r, signedURL, http.StatusFound)
+}
+
+// fileHandler serves the content of an attachment to whoever has an unexpired signed URL of it
+func (s *Server) fileHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(s.attachmentSignature(id, expires))) {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(w, "The link has expired", http.StatusForbidden)
+		return
+	}
+	attachment, err := s.repo.GetAttachment(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such attachment", http.StatusNotFound)
+		return
+	}
+	if err != nil || s.config.Storage == nil {
+		http.Error(w, "Attachment unavailable", http.StatusInternalServerError)
+		return
+	}
+	content, err := s.config.Storage.Get(r.Context(), attachment.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(attachmentURLLifetime.Seconds())))
+	_, err = io.Copy(w, content)
+	if err != nil {
+		s.logger.Println("Error sending attachment", attachment.ID, err)
+	}
+}
@@ -0,0 +1,383 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Largest accepted attendance body, in bytes
+const maxAttendanceSize = 1 << 18
+
+// Longest accepted roll number, in bytes
+const maxRollLength = 32
+
+// The rolls of the students who were and were not at a period
+type attendanceRequest struct {
+	Present []string `json:"present"`
+	Absent  []string `json:"absent"`
+}
+
+// How often a student, or everyone together, was at the periods of a subject
+type attendanceSummary struct {
+	Subject  string `json:"subject,omitempty"`
+	Roll     string `json:"roll,omitempty"`
+	Attended int    `json:"attended"`
+	Held     int    `json:"held"`
+	// Attended as a percentage of held, to one decimal
+	Percentage float64 `json:"percentage"`
+}
+
+func (a *attendanceSummary) add(present bool) {
+	a.Held++
+	if present {
+		a.Attended++
+	}
+	a.Percentage = math.Round(float64(a.Attended)*1000/float64(a.Held)) / 10
+}
+
+// A subject in the admin attendance report
+type subjectAttendance struct {
+	attendanceSummary
+	// How many periods had attendance taken and how many students were marked
+	Periods  int                 `json:"periods"`
+	Students int                 `json:"students"`
+	Rolls    []attendanceSummary `json:"rolls,omitempty"`
+}
+
+/*
+attendancePeriod reads the class, date and slot of the path and returns the
+timetable period they start with who teaches it that day. Attendance can only
+be taken for periods that have begun, by their faculty member or an admin.
+On failure it has already written the error response and returns ok = false.
+*/
+func (s *Server) attendancePeriod(w http.ResponseWriter, r *http.Request) (entry db.StaticEntry, date time.Time, ok bool) {
+	class := router.Param(r, "class")
+	date, err := calendar.ParseDate(router.Param(r, "date"), s.config.Location)
+	if err != nil || date.After(calendar.Today(s.config.Location)) {
+		http.Error(w, "Invalid date value", http.StatusBadRequest)
+		return
+	}
+	slot, err := strconv.Atoi(router.Param(r, "slot"))
+	if err != nil {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: class, Day: calendar.DayCode(date.Weekday()), Slot: slot})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 || entries[0].Subject == "FREE" {
+		http.Error(w, "No such class", http.StatusNotFound)
+		return
+	}
+	entry = entries[0]
+	override, found, err := s.existingOverride(entry, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if found && override.Cancelled {
+		http.Error(w, "The class was cancelled", http.StatusConflict)
+		return
+	}
+	if found && override.Faculty != "" {
+		entry.Faculty = override.Faculty
+	}
+	if mail := currentSession(r).Mail; mail != "" && !strings.EqualFold(mail, entry.Faculty) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	return entry, date, true
+}
+
+/*
+setAttendanceHandler takes the attendance of a period from a JSON body listing
+the rolls that were present and absent, replacing what was taken before.
+*/
+func (s *Server) setAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	entry, date, ok := s.attendancePeriod(w, r)
+	if !ok {
+		return
+	}
+	var request attendanceRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, maxAttendanceSize)).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	markedBy := currentSession(r).Mail
+	if markedBy == "" {
+		markedBy = adminActor(r)
+	}
+	now := time.Now()
+	var records []db.AttendanceRecord
+	seen := make(map[string]bool)
+	for _, list := range []struct {
+		rolls   []string
+		present bool
+	}{{request.Present, true}, {request.Absent, false}} {
+		for _, roll := range list.rolls {
+			roll = strings.ToUpper(strings.TrimSpace(roll))
+			if roll == "" || len(roll) > maxRollLength || seen[roll] {
+				http.Error(w, "Invalid roll "+roll, http.StatusBadRequest)
+				return
+			}
+			seen[roll] = true
+			records = append(records, db.AttendanceRecord{
+				Subject:  entry.Subject,
+				Roll:     roll,
+				Present:  list.present,
+				MarkedBy: markedBy,
+				MarkedAt: now,
+			})
+		}
+	}
+	err = s.repo.SetAttendance(entry.Class, date, entry.Slot, records)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if currentSession(r).Mail == "" {
+		s.audit(r, auditSetAttendance, entry.Class+"/"+date.Format(calendar.DateLayout)+"/"+strconv.Itoa(entry.Slot),
+			strconv.Itoa(len(request.Present))+" of "+strconv.Itoa(len(records))+" present")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists the attendance taken for a period
+func (s *Server) attendanceHandler(w http.ResponseWriter, r *http.Request) {
+	entry, date, ok := s.attendancePeriod(w, r)
+	if !ok {
+		return
+	}
+	records, err := s.repo.GetAttendance(db.AttendanceFilter{Class: entry.Class, Date: date, Slot: entry.Slot})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []db.AttendanceRecord{}
+	}
+	s.writeJSON(w, r, http.StatusOK, records)
+}
+
+// The student's attendance per subject; the roll number is the part of the mail before the @
+func (s *Server) myAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	roll := strings.ToUpper(strings.SplitN(currentSession(r).Mail, "@", 2)[0])
+	records, err := s.repo.GetAttendance(db.AttendanceFilter{Roll: roll})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	summaries := summarize(records)
+	if summaries == nil {
+		summaries = []attendanceSummary{}
+	}
+	s.writeJSON(w, r, http.StatusOK, summaries)
+}
+
+/*
+attendanceReportHandler sums up attendance per subject between startDate and
+endDate, both optional. With a subject it is narrowed to it and lists every
+student's attendance too. format=csv or xlsx downloads it, see writeReport.
+*/
+func (s *Server) attendanceReportHandler(w http.ResponseWriter, r *http.Request) {
+	format, ok := parseReportFormat(w, r)
+	if !ok {
+		return
+	}
+	var query struct {
+		Subject   string    `param:"subject"`
+		Class     string    `param:"class"`
+		StartDate time.Time `param:"startDate"`
+		EndDate   time.Time `param:"endDate"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	filter := db.AttendanceFilter{Subject: query.Subject, Class: query.Class, StartDate: query.StartDate, EndDate: query.EndDate}
+	if !filter.StartDate.IsZero() && !filter.EndDate.IsZero() && filter.EndDate.Before(filter.StartDate) {
+		http.Error(w, "Invalid endDate value", http.StatusBadRequest)
+		return
+	}
+	records, err := s.repo.GetAttendance(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bySubject := make(map[string]*subjectAttendance)
+	periods := make(map[string]bool)
+	rolls := make(map[string]map[string]*attendanceSummary)
+	report := []*subjectAttendance{}
+	for _, record := range records {
+		subject, ok := bySubject[record.Subject]
+		if !ok {
+			subject = &subjectAttendance{attendanceSummary: attendanceSummary{Subject: record.Subject}}
+			bySubject[record.Subject] = subject
+			rolls[record.Subject] = make(map[string]*attendanceSummary)
+			report = append(report, subject)
+		}
+		subject.add(record.Present)
+		if period := bookingID(record.Class, record.Date, record.Slot); !periods[period] {
+			periods[period] = true
+			subject.Periods++
+		}
+		student, ok := rolls[record.Subject][record.Roll]
+		if !ok {
+			student = &attendanceSummary{Roll: record.Roll}
+			rolls[record.Subject][record.Roll] = student
+			subject.Students++
+		}
+		student.add(record.Present)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Subject < report[j].Subject })
+	if filter.Subject != "" {
+		for _, subject := range report {
+			for _, student := range rolls[subject.Subject] {
+				subject.Rolls = append(subject.Rolls, *student)
+			}
+			sort.Slice(subject.Rolls, func(i, j int) bool { return subject.Rolls[i].Roll < subject.Rolls[j].Roll })
+		}
+	}
+	if format != "json" {
+		tables := []reportTable{{"subjects", []string{"subject", "periods", "students", "attended", "held", "percentage"},
+			func(add func(values ...interface{}) error) error {
+				for _, subject := range report {
+					err := add(subject.Subject, subject.Periods, subject.Students, subject.Attended, subject.Held, subject.Percentage)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}}}
+		if filter.Subject != "" {
+			tables = append(tables, reportTable{"students", []string{"subject", "roll", "attended", "held", "percentage"},
+				func(add func(values ...interface{}) error) error {
+					for _, subject := range report {
+						for _, student := range subject.Rolls {
+							if err := add(subject.Subject, student.Roll, student.Attended, student.Held, student.Percentage); err != nil {
+								return err
+							}
+						}
+					}
+					return nil
+				}})
+		}
+		s.writeReport(w, r, format, "attendance", tables)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, report)
+}
+
+// summarize sums up records per student and subject, in subject and roll order
+func summarize(records []db.AttendanceRecord) []attendanceSummary {
+	index := make(map[[2]string]int)
+	var summaries []attendanceSummary
+	for _, record := range records {
+		key := [2]string{record.Subject, record.Roll}
+		idx, ok := index[key]
+		if !ok {
+			idx = len(summaries)
+			index[key] = idx
+			summaries = append(summaries, attendanceSummary{Subject: record.Subject, Roll: record.Roll})
+		}
+		summaries[idx].add(record.Present)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Subject != summaries[j].Subject {
+			return summaries[i].Subject < summaries[j].Subject
+		}
+		return summaries[i].Roll < summaries[j].Roll
+	})
+	return summaries
+}
+
+/*
+SendAttendanceAlerts tells every student whose attendance in a subject fell
+below the threshold with the periods taken on date. Students already below it
+the day before are not told again. It returns how many alerts it sent.
+*/
+func (s *Server) SendAttendanceAlerts(date time.Time) int {
+	if s.config.StudentMailDomain == "" {
+		s.logger.Println("No student mail domain configured, not sending attendance alerts")
+		return 0
+	}
+	records, err := s.repo.GetAttendance(db.AttendanceFilter{EndDate: date})
+	if err != nil {
+		s.logger.Println("Error reading attendance for alerts", err)
+		return 0
+	}
+	var earlier []db.AttendanceRecord
+	for _, record := range records {
+		if record.Date.Before(date) {
+			earlier = append(earlier, record)
+		}
+	}
+	before := make(map[[2]string]attendanceSummary)
+	for _, summary := range summarize(earlier) {
+		before[[2]string{summary.Subject, summary.Roll}] = summary
+	}
+	sent := 0
+	for _, summary := range summarize(records) {
+		previous, ok := before[[2]string{summary.Subject, summary.Roll}]
+		if summary.Percentage >= s.config.AttendanceThreshold || summary.Held == previous.Held ||
+			(ok && previous.Percentage < s.config.AttendanceThreshold) {
+			continue
+		}
+		s.notifyUser(strings.ToLower(summary.Roll)+"@"+s.config.StudentMailDomain, notify.KindAttendance,
+			i18n.M("Attendance in %s below %g%%", summary.Subject, s.config.AttendanceThreshold),
+			i18n.M("You attended %d of %d periods of %s, %g%%.", summary.Attended, summary.Held,
+				summary.Subject, summary.Percentage))
+		sent++
+	}
+	return sent
+}
+
+/*
+atRiskHandler lists the students below the attendance threshold, or the given
+one, in a subject, lowest first. subject and class narrow it down.
+*/
+func (s *Server) atRiskHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Threshold *float64 `param:"threshold,max=100"`
+		Subject   string   `param:"subject"`
+		Class     string   `param:"class"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	threshold := s.config.AttendanceThreshold
+	if query.Threshold != nil {
+		if *query.Threshold <= 0 {
+			http.Error(w, "Invalid threshold value", http.StatusBadRequest)
+			return
+		}
+		threshold = *query.Threshold
+	}
+	records, err := s.repo.GetAttendance(db.AttendanceFilter{Subject: query.Subject, Class: query.Class})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	atRisk := []attendanceSummary{}
+	for _, summary := range summarize(records) {
+		if summary.Percentage < threshold {
+			atRisk = append(atRisk, summary)
+		}
+	}
+	sort.SliceStable(atRisk, func(i, j int) bool { return atRisk[i].Percentage < atRisk[j].Percentage })
+	s.writeJSON(w, r, http.StatusOK, atRisk)
+}
@@ -0,0 +1,450 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+const (
+	// Format of the backups written now; restores refuse others
+	backupFormat = 1
+	// Largest backup that is restored
+	maxBackupSize = 64 << 20
+	// Longest class ID the database takes
+	maxClassIDLength = 16
+)
+
+// What a backup holds, and what a restore can put back
+var backupTables = []string{"timetable", "classrooms", "bookings"}
+
+// A logical backup of the core tables, as kept in Config.Backups and downloaded
+type backupDocument struct {
+	Format     int                `json:"format"`
+	CreatedBy  string             `json:"createdBy"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	Timetable  []db.StaticEntry   `json:"timetable"`
+	Classrooms []db.Classroom     `json:"classrooms"`
+	Bookings   []db.BookingRecord `json:"bookings"`
+}
+
+// What a restore changes, or would change with dryRun=true
+type restoreChanges struct {
+	Tables     []string       `json:"tables"`
+	Timetable  *timetableDiff `json:"timetable,omitempty"`
+	Classrooms int            `json:"classrooms"`
+	Bookings   int            `json:"bookings"`
+}
+
+type restoreResult struct {
+	restoreChanges
+	// The version the timetable was saved as before it was replaced
+	Snapshot  int64    `json:"snapshot,omitempty"`
+	Conflicts []string `json:"conflicts"`
+}
+
+/*
+validateBackup checks that doc can be restored: its format, and that its
+periods and bookings are in slots that exist, with subjects that exist, once
+each. The error says what is wrong with the first bad row.
+*/
+func validateBackup(doc backupDocument, slots []int, subjects []string) error {
+	if doc.Format != backupFormat {
+		return fmt.Errorf("Unsupported backup format %d", doc.Format)
+	}
+	periods := make(map[string]bool)
+	for idx, entry := range doc.Timetable {
+		weekday, err := calendar.ParseDay(entry.Day)
+		switch {
+		case entry.Class == "" || len(entry.Class) > maxClassIDLength:
+			return fmt.Errorf("Timetable entry %d: invalid class %q", idx+1, entry.Class)
+		case err != nil || calendar.DayCode(weekday) != entry.Day:
+			return fmt.Errorf("Timetable entry %d: invalid day %q", idx+1, entry.Day)
+		case !containsInt(slots, entry.Slot):
+			return fmt.Errorf("Timetable entry %d: no such slot %d", idx+1, entry.Slot)
+		case entry.Subject != "FREE" && !containsString(subjects, entry.Subject):
+			return fmt.Errorf("Timetable entry %d: no such subject %q", idx+1, entry.Subject)
+		case entry.Span < 0:
+			return fmt.Errorf("Timetable entry %d: invalid span %d", idx+1, entry.Span)
+		}
+		key := entry.Class + "/" + entry.Day + "/" + strconv.Itoa(entry.Slot)
+		if periods[key] {
+			return fmt.Errorf("Timetable entry %d: %s is in the backup twice", idx+1, key)
+		}
+		periods[key] = true
+	}
+	classrooms := make(map[string]bool)
+	for idx, classroom := range doc.Classrooms {
+		if classroom.ID == "" || len(classroom.ID) > maxClassIDLength || classroom.Capacity < 0 || classrooms[classroom.ID] {
+			return fmt.Errorf("Classroom %d: invalid or repeated classroom %q", idx+1, classroom.ID)
+		}
+		classrooms[classroom.ID] = true
+	}
+	bookings := make(map[string]bool)
+	for idx, booking := range doc.Bookings {
+		key := booking.Class + "/" + booking.Date.Format(calendar.DateLayout) + "/" + strconv.Itoa(booking.Slot)
+		switch {
+		case booking.Class == "" || booking.Date.IsZero() || booking.Faculty == "":
+			return fmt.Errorf("Booking %d: class, date and faculty are needed", idx+1)
+		case !containsInt(slots, booking.Slot):
+			return fmt.Errorf("Booking %d: no such slot %d", idx+1, booking.Slot)
+		case bookings[key]:
+			return fmt.Errorf("Booking %d: %s is in the backup twice", idx+1, key)
+		}
+		bookings[key] = true
+	}
+	return nil
+}
+
+// parseBackupTables reads the tables parameter, every one of backupTables when it is not given
+func (s *Server) parseBackupTables(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var query struct {
+		Tables []string `param:"tables"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return nil, false
+	}
+	if len(query.Tables) == 0 {
+		return backupTables, true
+	}
+	var tables []string
+	for _, table := range query.Tables {
+		if !containsString(backupTables, table) {
+			http.Error(w, "Invalid tables value", http.StatusBadRequest)
+			return nil, false
+		}
+		if !containsString(tables, table) {
+			tables = append(tables, table)
+		}
+	}
+	return tables, true
+}
+
+/*
+bookingRestorePlan splits the bookings of doc into those to book again and
+conflicts: the slots booked by someone else since and those not free in
+timetable, the one the bookings are restored into. Bookings that are still
+there are left alone.
+*/
+func (s *Server) bookingRestorePlan(doc backupDocument, timetable []db.StaticEntry) ([]db.BookingRecord, []string, error) {
+	current, err := s.repo.GetBookings(db.BookingFilter{})
+	if err != nil {
+		return nil, nil, err
+	}
+	booked := make(map[string]db.BookingRecord, len(current))
+	for _, booking := range current {
+		booked[booking.Class+"/"+booking.Date.Format(calendar.DateLayout)+"/"+strconv.Itoa(booking.Slot)] = booking
+	}
+	subjects := make(map[string]string, len(timetable))
+	for _, entry := range timetable {
+		subjects[entry.Class+"/"+entry.Day+"/"+strconv.Itoa(entry.Slot)] = entry.Subject
+	}
+	// The slots a lab reaches over are taken by it, whatever their own rows say
+	for _, entry := range timetable {
+		if entry.Subject == "FREE" {
+			continue
+		}
+		for slot := entry.Slot + 1; slot < entry.Slot+entry.Span; slot++ {
+			subjects[entry.Class+"/"+entry.Day+"/"+strconv.Itoa(slot)] = entry.Subject
+		}
+	}
+	var toBook []db.BookingRecord
+	var conflicts []string
+	for _, booking := range doc.Bookings {
+		date := booking.Date.Format(calendar.DateLayout)
+		if existing, ok := booked[booking.Class+"/"+date+"/"+strconv.Itoa(booking.Slot)]; ok {
+			if existing.Faculty != booking.Faculty || existing.Subject != booking.Subject {
+				conflicts = append(conflicts, fmt.Sprintf("%s on %s, slot %d is booked by %s now",
+					booking.Class, date, booking.Slot, existing.Faculty))
+			}
+			continue
+		}
+		if subjects[booking.Class+"/"+calendar.DayCode(booking.Date.Weekday())+"/"+strconv.Itoa(booking.Slot)] != "FREE" {
+			conflicts = append(conflicts, fmt.Sprintf("%s on %s, slot %d is not free", booking.Class, date, booking.Slot))
+			continue
+		}
+		toBook = append(toBook, booking)
+	}
+	return toBook, conflicts, nil
+}
+
+/*
+restore puts back the tables of doc that the tables parameter names, all of
+them by default, after validating it. Classrooms in the backup are set as they
+were, others are left alone. The timetable is replaced as a whole, after the
+current one is saved as a version. Bookings that are gone are booked again
+when their slot is still free. With dryRun=true nothing is written and the
+preview tells what would change.
+*/
+func (s *Server) restore(w http.ResponseWriter, r *http.Request, doc backupDocument, source string) {
+	tables, ok := s.parseBackupTables(w, r)
+	if !ok {
+		return
+	}
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+	err := validateBackup(doc, s.repo.GetAllSlot(), s.repo.GetAllSubject())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current, err := s.repo.GetStatic(db.TimetableFilter{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := restoreResult{restoreChanges: restoreChanges{Tables: tables}}
+	timetable := current
+	if containsString(tables, "timetable") {
+		diff := diffTimetables(current, doc.Timetable)
+		result.Timetable = &diff
+		timetable = doc.Timetable
+	}
+	if containsString(tables, "classrooms") {
+		result.Classrooms = len(doc.Classrooms)
+	}
+	var toBook []db.BookingRecord
+	if containsString(tables, "bookings") {
+		toBook, result.Conflicts, err = s.bookingRestorePlan(doc, timetable)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Bookings = len(toBook)
+	}
+	if dryRun {
+		s.writePreview(w, r, result.restoreChanges, result.Conflicts)
+		return
+	}
+
+	if containsString(tables, "classrooms") {
+		for _, classroom := range doc.Classrooms {
+			err = s.repo.SetClassroom(classroom)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	if containsString(tables, "timetable") {
+		snapshot, err := s.snapshotTimetable(r, "", "Before restoring backup "+source)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Snapshot = snapshot.ID
+		err = s.repo.ReplaceStatic(doc.Timetable)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.timetableChanged()
+	}
+	result.Bookings = 0
+	for _, booking := range toBook {
+		rowsAffected, err := s.repo.Booking(booking.Class, booking.Date, booking.Slot, booking.Faculty, booking.Subject)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			result.Conflicts = append(result.Conflicts, fmt.Sprintf("%s on %s, slot %d could not be booked",
+				booking.Class, booking.Date.Format(calendar.DateLayout), booking.Slot))
+			continue
+		}
+		result.Bookings++
+	}
+	if result.Conflicts == nil {
+		result.Conflicts = []string{}
+	}
+	s.audit(r, auditRestoreBackup, source, strings.Join(tables, ","))
+	s.writeHistory(w, r, http.StatusOK, result)
+}
+
+// readBackup reads the document of a backup from Config.Backups
+func (s *Server) readBackup(ctx context.Context, id string) (backupDocument, error) {
+	var doc backupDocument
+	content, err := s.config.Backups.Get(ctx, id)
+	if err != nil {
+		return doc, err
+	}
+	defer content.Close()
+	err = json.NewDecoder(io.LimitReader(content, maxBackupSize)).Decode(&doc)
+	return doc, err
+}
+
+// backupsConfigured tells whether there is somewhere to keep backups, answering 503 when there is not
+func (s *Server) backupsConfigured(w http.ResponseWriter) bool {
+	if s.config.Backups == nil {
+		http.Error(w, "Backups are not configured", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// backup returns the backup of the path. On failure it has already written the error response.
+func (s *Server) backup(w http.ResponseWriter, r *http.Request) (db.Backup, bool) {
+	if !s.backupsConfigured(w) {
+		return db.Backup{}, false
+	}
+	backup, err := s.repo.GetBackup(router.Param(r, "id"))
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such backup", http.StatusNotFound)
+		return backup, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return backup, false
+	}
+	return backup, true
+}
+
+/*
+createBackupHandler copies the weekly timetable, the classrooms and every
+booking into a backup in Config.Backups, and answers 201 with what it holds.
+*/
+func (s *Server) createBackupHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.backupsConfigured(w) {
+		return
+	}
+	doc := backupDocument{Format: backupFormat, CreatedBy: adminActor(r), CreatedAt: time.Now()}
+	var err error
+	doc.Timetable, err = s.repo.GetStatic(db.TimetableFilter{})
+	if err == nil {
+		doc.Classrooms, err = s.repo.GetClassrooms()
+	}
+	if err == nil {
+		doc.Bookings, err = s.repo.GetBookings(db.BookingFilter{})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		s.logger.Println("Error marshalling data", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	backup := db.Backup{
+		Size:       int64(len(content)),
+		Periods:    len(doc.Timetable),
+		Classrooms: len(doc.Classrooms),
+		Bookings:   len(doc.Bookings),
+		CreatedBy:  doc.CreatedBy,
+		CreatedAt:  doc.CreatedAt,
+	}
+	backup.ID, err = token.Hex(16)
+	if err == nil {
+		err = s.config.Backups.Put(r.Context(), backup.ID, bytes.NewReader(content), backup.Size, "application/json")
+	}
+	if err == nil {
+		err = s.repo.CreateBackup(backup)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditCreateBackup, backup.ID, fmt.Sprintf("%d periods, %d classrooms, %d bookings",
+		backup.Periods, backup.Classrooms, backup.Bookings))
+	s.writeHistory(w, r, http.StatusCreated, backup)
+}
+
+// Lists the backups, the latest first
+func (s *Server) backupsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.backupsConfigured(w) {
+		return
+	}
+	backups, err := s.repo.GetBackups()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if backups == nil {
+		backups = []db.Backup{}
+	}
+	s.writeHistory(w, r, http.StatusOK, backups)
+}
+
+// Downloads a backup, which POST /admin/restore takes back
+func (s *Server) downloadBackupHandler(w http.ResponseWriter, r *http.Request) {
+	backup, ok := s.backup(w, r)
+	if !ok {
+		return
+	}
+	content, err := s.config.Backups.Get(r.Context(), backup.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="backup-`+
+		backup.CreatedAt.In(s.config.Location).Format("20060102-150405")+`.json"`)
+	io.Copy(w, content)
+}
+
+func (s *Server) deleteBackupHandler(w http.ResponseWriter, r *http.Request) {
+	backup, ok := s.backup(w, r)
+	if !ok {
+		return
+	}
+	_, err := s.repo.DeleteBackup(backup.ID)
+	if err == nil {
+		err = s.config.Backups.Delete(r.Context(), backup.ID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditDeleteBackup, backup.ID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Restores a backup kept in Config.Backups, see restore
+func (s *Server) restoreBackupHandler(w http.ResponseWriter, r *http.Request) {
+	backup, ok := s.backup(w, r)
+	if !ok {
+		return
+	}
+	doc, err := s.readBackup(r.Context(), backup.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.restore(w, r, doc, backup.ID)
+}
+
+// Restores a backup sent as the body, like one downloaded before, see restore
+func (s *Server) restoreUploadHandler(w http.ResponseWriter, r *http.Request) {
+	content, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBackupSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(content) > maxBackupSize {
+		http.Error(w, "Backup too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var doc backupDocument
+	if json.Unmarshal(content, &doc) != nil {
+		http.Error(w, "Invalid backup", http.StatusBadRequest)
+		return
+	}
+	s.restore(w, r, doc, "upload")
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// A new block and the bookings already made in its window, which facilities may want to move
+type blockResponse struct {
+	db.Block
+	Bookings []db.BookingRecord `json:"bookings"`
+}
+
+// Lists the blocks, filtered by the class, startDate and endDate parameters
+func (s *Server) blocksHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class     string    `param:"class"`
+		StartDate time.Time `param:"startDate"`
+		EndDate   time.Time `param:"endDate"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	blocks, err := s.repo.GetBlocks(query.Class, query.StartDate, query.EndDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blocks == nil {
+		blocks = []db.Block{}
+	}
+	s.writeJSON(w, r, http.StatusOK, blocks)
+}
+
+/*
+createBlockHandler takes the room class out of use from startDate to endDate
+(the same day when not given) for reason. Bookings already made in that window
+stay, they are listed in the response.
+*/
+func (s *Server) createBlockHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class     string    `param:"class"`
+		StartDate time.Time `param:"startDate,required"`
+		EndDate   time.Time `param:"endDate"`
+		Reason    string    `param:"reason"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	block := db.Block{Class: query.Class, StartDate: query.StartDate, EndDate: query.EndDate, Reason: query.Reason, CreatedAt: time.Now()}
+	if !containsString(s.repo.GetAllClass(), block.Class) {
+		http.Error(w, "Invalid class value", http.StatusBadRequest)
+		return
+	}
+	if block.EndDate.IsZero() {
+		block.EndDate = block.StartDate
+	}
+	if block.EndDate.Before(block.StartDate) {
+		http.Error(w, "Invalid endDate value", http.StatusBadRequest)
+		return
+	}
+	if block.Reason == "" || len(block.Reason) > maxReasonLength {
+		http.Error(w, "Invalid reason value", http.StatusBadRequest)
+		return
+	}
+	var err error
+	block.ID, err = s.repo.CreateBlock(block)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Class: block.Class, StartDate: block.StartDate, EndDate: block.EndDate})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if bookings == nil {
+		bookings = []db.BookingRecord{}
+	}
+	s.audit(r, auditCreateBlock, block.Class, fmt.Sprintf("%s to %s: %s",
+		block.StartDate.Format(calendar.DateLayout), block.EndDate.Format(calendar.DateLayout), block.Reason))
+	s.writeJSON(w, r, http.StatusCreated, blockResponse{Block: block, Bookings: bookings})
+}
+
+func (s *Server) deleteBlockHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteBlock(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such block", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteBlock, strconv.FormatInt(id, 10), "")
+	w.WriteHeader(http.StatusNoContent)
+}
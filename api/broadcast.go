@@ -0,0 +1,286 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Who a broadcast goes to
+const (
+	audienceSection    = "section"
+	audienceDepartment = "department"
+	audienceAll        = "all"
+)
+
+const (
+	// Longest accepted broadcast title and body, in bytes
+	maxBroadcastTitleLength = 128
+	maxBroadcastBodyLength  = 4 << 10
+	// Most users a broadcast reaches, and the most users read per source to find them
+	maxBroadcastRecipients = 20000
+	// Broadcasts a user can start per minute, and in a burst
+	broadcastsPerMinute = 1
+	broadcastBurst      = 3
+)
+
+// What a broadcast task reports when it is done
+type broadcastResult struct {
+	Audience   string `json:"audience"`
+	Target     string `json:"target,omitempty"`
+	Via        string `json:"via"`
+	Recipients int    `json:"recipients"`
+	Sent       int    `json:"sent"`
+	Emergency  bool   `json:"emergency,omitempty"`
+	// Of the recipients, those who opted in to texts and were texted too
+	Texted int `json:"texted,omitempty"`
+}
+
+/*
+sectionMembers returns who is in a class section: the users who starred it,
+made it their default section or are put in it by their groups
+*/
+func (s *Server) sectionMembers(section string, preferences map[string]Preferences) ([]string, error) {
+	mails, err := s.repo.GetFavoriteUsers(db.FavoriteSection, section)
+	if err != nil {
+		return nil, err
+	}
+	for mail, p := range preferences {
+		if strings.EqualFold(p.DefaultSection, section) {
+			mails = append(mails, mail)
+		}
+	}
+	members, err := s.groupSectionMembers(section)
+	if err != nil {
+		return nil, err
+	}
+	return append(mails, members...), nil
+}
+
+/*
+broadcastRecipients returns the mails of the users in audience, once each and
+sorted. The sections of a department are named after it, like CSE-A and CSE-B
+of CSE. All users are those of the directory who are not disabled, those with
+a session and those who saved preferences.
+*/
+func (s *Server) broadcastRecipients(audience string, target string) ([]string, error) {
+	all, err := s.repo.GetAllPreferences()
+	if err != nil {
+		return nil, err
+	}
+	preferences := make(map[string]Preferences)
+	for mail, data := range all {
+		var p Preferences
+		if json.Unmarshal([]byte(data), &p) == nil {
+			preferences[mail] = p
+		}
+	}
+
+	var mails []string
+	switch audience {
+	case audienceSection:
+		mails, err = s.sectionMembers(target, preferences)
+		if err != nil {
+			return nil, err
+		}
+	case audienceDepartment:
+		sections, err := s.repo.GetFavoriteTargets(db.FavoriteSection)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range preferences {
+			if p.DefaultSection != "" && !containsString(sections, p.DefaultSection) {
+				sections = append(sections, p.DefaultSection)
+			}
+		}
+		members, err := s.repo.GetGroupMembers(db.GroupMemberFilter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if member.Section != "" && !containsString(sections, member.Section) {
+				sections = append(sections, member.Section)
+			}
+		}
+		for _, section := range sections {
+			if !strings.HasPrefix(strings.ToUpper(section), strings.ToUpper(target)+"-") {
+				continue
+			}
+			members, err := s.sectionMembers(section, preferences)
+			if err != nil {
+				return nil, err
+			}
+			mails = append(mails, members...)
+		}
+	case audienceAll:
+		users, err := s.repo.GetUsers(db.UserFilter{Limit: maxBroadcastRecipients})
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if !user.Disabled {
+				mails = append(mails, user.Mail)
+			}
+		}
+		active, err := s.repo.GetActiveUsers("", maxBroadcastRecipients)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range active {
+			mails = append(mails, user.Mail)
+		}
+		for mail := range preferences {
+			mails = append(mails, mail)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var recipients []string
+	for _, mail := range mails {
+		mail = strings.ToLower(mail)
+		if mail != "" && !seen[mail] {
+			seen[mail] = true
+			recipients = append(recipients, mail)
+		}
+	}
+	sort.Strings(recipients)
+	if len(recipients) > maxBroadcastRecipients {
+		recipients = recipients[:maxBroadcastRecipients]
+	}
+	return recipients, nil
+}
+
+/*
+broadcastHandler sends title and body to everyone in audience: the class
+section or department named by target, or all users. It is pushed, and kept in
+their inboxes, or with via=mail mailed. Messages go out in a background task
+at Config.BroadcastRate per second, so the push gateway or mail server is not
+flooded; the response is the task, whose progress and result are the delivery
+stats. Faculty can message sections and departments, admins everyone. Each
+user can start a broadcast a minute, with bursts of a few. Admins can send an
+emergency=true one, which is texted as well to those who opted in to texts.
+*/
+func (s *Server) broadcastHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Audience  string `param:"audience"`
+		Target    string `param:"target"`
+		Via       string `param:"via"`
+		Title     string `param:"title"`
+		Body      string `param:"body"`
+		Emergency bool   `param:"emergency"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	mail := currentSession(r).Mail
+	result := broadcastResult{Audience: query.Audience, Target: query.Target, Via: query.Via, Emergency: query.Emergency}
+	title, body := query.Title, query.Body
+	switch result.Audience {
+	case audienceSection, audienceDepartment:
+		if result.Target == "" || len(result.Target) > maxSectionLength {
+			http.Error(w, "Invalid target value", http.StatusBadRequest)
+			return
+		}
+	case audienceAll:
+		result.Target = ""
+	default:
+		http.Error(w, "Invalid audience value", http.StatusBadRequest)
+		return
+	}
+	if title == "" || len(title) > maxBroadcastTitleLength {
+		http.Error(w, "Invalid title value", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxBroadcastBodyLength {
+		http.Error(w, "Invalid body value", http.StatusBadRequest)
+		return
+	}
+	if result.Via == "" {
+		result.Via = digestPush
+	}
+	if (result.Via != digestPush && result.Via != digestMail) || (result.Via == digestMail && s.config.Mailer == nil) {
+		http.Error(w, "Invalid via value", http.StatusBadRequest)
+		return
+	}
+	createdBy := adminActor(r)
+	if mail != "" {
+		createdBy = mail
+		faculty, err := s.knownFaculty(mail)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !faculty || result.Audience == audienceAll || result.Emergency {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	if ok, wait := s.broadcasts.Allow(createdBy, broadcastsPerMinute, broadcastBurst); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds()+1)))
+		http.Error(w, "Too many broadcasts, try again later", http.StatusTooManyRequests)
+		return
+	}
+	recipients, err := s.broadcastRecipients(result.Audience, result.Target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result.Recipients = len(recipients)
+	if mail == "" {
+		s.audit(r, auditBroadcast, result.Audience+"/"+result.Target, strconv.Itoa(len(recipients))+" recipients: "+title)
+	}
+
+	notifier := s.config.Notifier
+	if result.Via == digestMail {
+		notifier = s.config.Mailer
+	}
+	text := i18n.M("%s", title)
+	if body != "" {
+		text = i18n.M("%s: %s", title, body)
+	}
+	location := "/admin/tasks/"
+	if mail != "" {
+		location = "/me/broadcasts/"
+	}
+	s.submitTaskAs(w, r, taskBroadcast, createdBy, location,
+		func(ctx context.Context, progress func(done int, total int)) (interface{}, error) {
+			ticker := time.NewTicker(time.Second / time.Duration(s.config.BroadcastRate))
+			defer ticker.Stop()
+			progress(0, len(recipients))
+			for idx, to := range recipients {
+				if idx > 0 {
+					select {
+					case <-ctx.Done():
+						return result, ctx.Err()
+					case <-ticker.C:
+					}
+				}
+				notifier.Notify(notify.Message{To: to, Kind: notify.KindBroadcast, Title: title, Body: body})
+				result.Sent++
+				if result.Emergency && s.textUser(to, notify.KindBroadcast, text) {
+					result.Texted++
+				}
+				progress(result.Sent, len(recipients))
+			}
+			return result, nil
+		})
+}
+
+// The broadcast task of the path, if the user started it
+func (s *Server) myBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.tasks.Get(router.Param(r, "id"))
+	if !ok || task.Kind != taskBroadcast || task.CreatedBy != currentSession(r).Mail {
+		http.Error(w, "No such broadcast", http.StatusNotFound)
+		return
+	}
+	s.writeTask(w, r, http.StatusOK, task)
+}
@@ -0,0 +1,401 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/walk"
+)
+
+const (
+	// Longest accepted building ID, the length of the building of a classroom, and name, in bytes
+	maxBuildingIDLength   = 32
+	maxBuildingNameLength = 64
+	// Longest accepted walking path, in minutes
+	maxPathMinutes = 120
+)
+
+// Passed as near= to sort by where the user is, see userRoom
+const nearMe = "me"
+
+// The walk between two places, by the buildings they are in
+type walkResponse struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Minutes int    `json:"minutes"`
+	// Straight line distance, when both buildings have coordinates
+	Metres int `json:"metres,omitempty"`
+}
+
+// The buildings and paths walks are estimated over, with the building of each classroom
+type campusMap struct {
+	walks    *walk.Map
+	building map[string]string
+	known    map[string]bool
+}
+
+func (s *Server) campusMap() (campusMap, error) {
+	m := campusMap{walks: walk.NewMap(), building: make(map[string]string), known: make(map[string]bool)}
+	buildings, err := s.repo.GetBuildings()
+	if err != nil {
+		return m, err
+	}
+	for _, building := range buildings {
+		if building.Latitude != nil && building.Longitude != nil {
+			m.walks.AddPlace(building.ID, true, *building.Latitude, *building.Longitude)
+		} else {
+			m.walks.AddPlace(building.ID, false, 0, 0)
+		}
+		m.known[building.ID] = true
+	}
+	paths, err := s.repo.GetBuildingPaths()
+	if err != nil {
+		return m, err
+	}
+	for _, path := range paths {
+		m.walks.AddPath(path.From, path.To, path.Minutes)
+	}
+	classrooms, err := s.repo.GetClassrooms()
+	if err != nil {
+		return m, err
+	}
+	for _, classroom := range classrooms {
+		if classroom.Building != "" {
+			m.building[classroom.ID] = classroom.Building
+		}
+	}
+	return m, nil
+}
+
+// place returns the building name means: a building, or the building of the classroom it names
+func (m campusMap) place(s *Server, name string) (string, bool) {
+	if m.known[name] {
+		return name, true
+	}
+	building, ok := m.building[s.canonicalRoom(name)]
+	return building, ok
+}
+
+// minutes returns the minutes it takes to walk from the building from to class, with false when unknown
+func (m campusMap) minutes(from string, class string) (int, bool) {
+	to, ok := m.building[class]
+	if !ok {
+		return 0, false
+	}
+	return m.walks.Minutes(from, to)
+}
+
+/*
+userRoom returns where mail is on date around slot: the room of their period
+or booking in slot, or else of their next one that day, or else of their last
+one. Periods are those they teach, as overridden, and those they substitute
+in. It is empty when they have nothing on date.
+*/
+func (s *Server) userRoom(mail string, date time.Time, slot int) (string, error) {
+	rooms := make(map[int]string)
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Faculty: mail, Day: calendar.DayCode(date.Weekday())})
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.Subject == "FREE" {
+			continue
+		}
+		room := entry.Class
+		override, found, err := s.existingOverride(entry, date)
+		if err != nil {
+			return "", err
+		}
+		if found && (override.Cancelled || (override.Faculty != "" && !strings.EqualFold(override.Faculty, mail))) {
+			continue
+		}
+		if found && override.Room != "" {
+			room = override.Room
+		}
+		for taken := entry.Slot; taken < entry.Slot+max1(entry.Span); taken++ {
+			rooms[taken] = room
+		}
+	}
+	overrides, err := s.repo.GetOverrides(date, "")
+	if err != nil {
+		return "", err
+	}
+	for _, override := range overrides {
+		if override.Cancelled || !strings.EqualFold(override.Faculty, mail) {
+			continue
+		}
+		room := override.Class
+		if override.Room != "" {
+			room = override.Room
+		}
+		for taken := override.Slot; taken < override.Slot+max1(override.Span); taken++ {
+			rooms[taken] = room
+		}
+	}
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Faculty: mail, StartDate: date, EndDate: date})
+	if err != nil {
+		return "", err
+	}
+	for _, booking := range bookings {
+		rooms[booking.Slot] = booking.Class
+	}
+	if room, ok := rooms[slot]; ok {
+		return room, nil
+	}
+	var slots []int
+	for taken := range rooms {
+		slots = append(slots, taken)
+	}
+	sort.Ints(slots)
+	for _, taken := range slots {
+		if taken > slot {
+			return rooms[taken], nil
+		}
+	}
+	if len(slots) > 0 {
+		return rooms[slots[len(slots)-1]], nil
+	}
+	return "", nil
+}
+
+/*
+byProximity sorts classes by the walk to them from the near parameter of the
+request, a building or classroom, nearest first; near=me walks from where the
+user is around slot on date, see userRoom. Classes are left in order without
+near, or when the user is nowhere then, and those the map cannot tell about
+go last. On failure it has already written the error response.
+*/
+func (s *Server) byProximity(w http.ResponseWriter, r *http.Request, classes []string, date time.Time, slot int) ([]string, bool) {
+	near := r.URL.Query().Get("near")
+	if near == "" {
+		return classes, true
+	}
+	m, err := s.campusMap()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	from, ok := s.nearBuilding(w, r, m, near, date, slot)
+	if !ok || from == "" {
+		return classes, ok
+	}
+	return m.nearest(from, classes), true
+}
+
+// nearest returns classes sorted by the walk to them from the building from, those the map cannot tell about last
+func (m campusMap) nearest(from string, classes []string) []string {
+	minutes := make(map[string]int)
+	for _, class := range classes {
+		walked, found := m.minutes(from, class)
+		if !found {
+			walked = math.MaxInt32
+		}
+		minutes[class] = walked
+	}
+	sorted := append([]string{}, classes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return minutes[sorted[i]] < minutes[sorted[j]] })
+	return sorted
+}
+
+/*
+nearBuilding returns the building walks start from for near, empty when
+near=me and the user is nowhere around slot on date. On failure it has
+already written the error response.
+*/
+func (s *Server) nearBuilding(w http.ResponseWriter, r *http.Request, m campusMap, near string, date time.Time, slot int) (string, bool) {
+	if near == nearMe {
+		session, err := s.requestSession(r)
+		if err != nil {
+			http.Error(w, "Invalid near value", http.StatusBadRequest)
+			return "", false
+		}
+		room, err := s.userRoom(session.Mail, date, slot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return "", false
+		}
+		building, _ := m.place(s, room)
+		return building, true
+	}
+	building, ok := m.place(s, near)
+	if !ok {
+		http.Error(w, "Invalid near value", http.StatusBadRequest)
+		return "", false
+	}
+	return building, true
+}
+
+// walkHandler answers with the minutes it takes to walk between the buildings or classrooms from and to
+func (s *Server) walkHandler(w http.ResponseWriter, r *http.Request) {
+	m, err := s.campusMap()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var response walkResponse
+	var ok bool
+	response.From, ok = m.place(s, r.URL.Query().Get("from"))
+	if !ok {
+		http.Error(w, "Invalid from value", http.StatusBadRequest)
+		return
+	}
+	response.To, ok = m.place(s, r.URL.Query().Get("to"))
+	if !ok {
+		http.Error(w, "Invalid to value", http.StatusBadRequest)
+		return
+	}
+	response.Minutes, ok = m.walks.Minutes(response.From, response.To)
+	if !ok {
+		http.Error(w, "No known way from "+response.From+" to "+response.To, http.StatusNotFound)
+		return
+	}
+	if metres, located := m.walks.Straight(response.From, response.To); located {
+		response.Metres = int(metres + 0.5)
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+}
+
+// Lists the buildings by ID
+func (s *Server) buildingsHandler(w http.ResponseWriter, r *http.Request) {
+	buildings, err := s.repo.GetBuildings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if buildings == nil {
+		buildings = []db.Building{}
+	}
+	s.writeJSON(w, r, http.StatusOK, buildings)
+}
+
+// Lists the walking paths between buildings
+func (s *Server) buildingPathsHandler(w http.ResponseWriter, r *http.Request) {
+	paths, err := s.repo.GetBuildingPaths()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if paths == nil {
+		paths = []db.BuildingPath{}
+	}
+	s.writeJSON(w, r, http.StatusOK, paths)
+}
+
+// Adds a building or replaces its name and coordinates, which come together or not at all
+func (s *Server) setBuildingHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Name      string   `param:"name"`
+		Latitude  *float64 `param:"latitude,min=-90,max=90"`
+		Longitude *float64 `param:"longitude,min=-180,max=180"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	building := db.Building{ID: router.Param(r, "id"), Name: query.Name, Latitude: query.Latitude, Longitude: query.Longitude}
+	if building.ID == "" || len(building.ID) > maxBuildingIDLength {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	if building.Name == "" {
+		building.Name = building.ID
+	}
+	if len(building.Name) > maxBuildingNameLength {
+		http.Error(w, "Invalid name value", http.StatusBadRequest)
+		return
+	}
+	if (building.Latitude == nil) != (building.Longitude == nil) {
+		http.Error(w, "Invalid longitude value", http.StatusBadRequest)
+		return
+	}
+	err := s.repo.SetBuilding(building)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	detail := building.Name
+	if building.Latitude != nil {
+		detail += " at " + strconv.FormatFloat(*building.Latitude, 'f', -1, 64) + "," +
+			strconv.FormatFloat(*building.Longitude, 'f', -1, 64)
+	}
+	s.audit(r, auditSetBuilding, building.ID, detail)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deletes a building with its paths; its classrooms keep their building
+func (s *Server) deleteBuildingHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	rowsAffected, err := s.repo.DeleteBuilding(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such building", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteBuilding, id, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Sets the minutes the walk between two buildings takes, for walks the straight line gets wrong
+func (s *Server) setBuildingPathHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Minutes int `param:"minutes,required,min=0"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	path := db.BuildingPath{From: router.Param(r, "id"), To: router.Param(r, "to"), Minutes: query.Minutes}
+	if path.Minutes > maxPathMinutes {
+		http.Error(w, "Invalid minutes value", http.StatusBadRequest)
+		return
+	}
+	if path.From == path.To {
+		http.Error(w, "Invalid to value", http.StatusBadRequest)
+		return
+	}
+	buildings, err := s.repo.GetBuildings()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	found := 0
+	for _, building := range buildings {
+		if building.ID == path.From || building.ID == path.To {
+			found++
+		}
+	}
+	if found < 2 {
+		http.Error(w, "No such building", http.StatusNotFound)
+		return
+	}
+	err = s.repo.SetBuildingPath(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditSetPath, path.From+"-"+path.To, strconv.Itoa(path.Minutes)+" minutes")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteBuildingPathHandler(w http.ResponseWriter, r *http.Request) {
+	from, to := router.Param(r, "id"), router.Param(r, "to")
+	rowsAffected, err := s.repo.DeleteBuildingPath(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such path", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeletePath, from+"-"+to, "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest accepted campus ID and name, in bytes
+const (
+	maxCampusIDLength   = 16
+	maxCampusNameLength = 64
+)
+
+// Passed as campus= to see every campus despite the user's preferred one
+const allCampuses = "all"
+
+// Campus IDs are short codes like "CB" or "AMR", which also go into class IDs
+func validCampusID(id string) bool {
+	if id == "" || len(id) > maxCampusIDLength || id == allCampuses {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// campusExists tells whether id is a campus; the empty ID is no campus in particular and always exists
+func (s *Server) campusExists(id string) (bool, error) {
+	if id == "" {
+		return true, nil
+	}
+	campuses, err := s.repo.GetCampuses()
+	if err != nil {
+		return false, err
+	}
+	for _, campus := range campuses {
+		if campus.ID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+/*
+requestCampus is the campus the request is about: its campus parameter, or
+the campus in the preferences of the logged in user. campus=all and users
+without one mean every campus, which is the empty string. On failure it has
+already written the error response.
+*/
+func (s *Server) requestCampus(w http.ResponseWriter, r *http.Request) (string, bool) {
+	campus := r.URL.Query().Get("campus")
+	if campus == allCampuses {
+		return "", true
+	}
+	if campus == "" {
+		return s.requestPreferences(r).Campus, true
+	}
+	exists, err := s.campusExists(campus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	if !exists {
+		http.Error(w, "Invalid campus value", http.StatusBadRequest)
+		return "", false
+	}
+	return campus, true
+}
+
+/*
+onCampus narrows classes down to the classrooms on the campus of the request,
+see requestCampus. On failure it has already written the error response.
+*/
+func (s *Server) onCampus(w http.ResponseWriter, r *http.Request, classes []string) ([]string, bool) {
+	campus, ok := s.requestCampus(w, r)
+	if !ok || campus == "" {
+		return classes, ok
+	}
+	classrooms, err := s.tracedRepo(r).GetClassrooms()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	there := make(map[string]bool)
+	for _, classroom := range classrooms {
+		if classroom.Campus == campus {
+			there[classroom.ID] = true
+		}
+	}
+	filtered := []string{}
+	for _, class := range classes {
+		if there[class] {
+			filtered = append(filtered, class)
+		}
+	}
+	return filtered, true
+}
+
+// Lists the campuses by ID
+func (s *Server) campusesHandler(w http.ResponseWriter, r *http.Request) {
+	campuses, err := s.repo.GetCampuses()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if campuses == nil {
+		campuses = []db.Campus{}
+	}
+	s.writeJSON(w, r, http.StatusOK, campuses)
+}
+
+// Adds a campus or renames it
+func (s *Server) setCampusHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Name string `param:"name"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	campus := db.Campus{ID: router.Param(r, "id"), Name: query.Name}
+	if !validCampusID(campus.ID) {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	if campus.Name == "" || len(campus.Name) > maxCampusNameLength {
+		http.Error(w, "Invalid name value", http.StatusBadRequest)
+		return
+	}
+	err := s.repo.SetCampus(campus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditSetCampus, campus.ID, campus.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deletes a campus no classroom is on any more
+func (s *Server) deleteCampusHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	rowsAffected, err := s.repo.DeleteCampus(id)
+	if err == db.ErrCampusInUse {
+		http.Error(w, "Classrooms are still on the campus", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such campus", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteCampus, id, "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+)
+
+/*
+The free class lookups and the slot table answer the same to everyone asking
+the same URL, so a CDN or campus proxy may serve them for Config.CDNMaxAge.
+Each answer is tagged with surrogate keys naming what it was computed from, and
+the keys of whatever a write changes are purged through Config.Purger:
+
+  - free: every free class lookup
+  - free:2023-06-13: the lookups of a date, purged by its bookings and overrides
+  - free:TUE: the lookups of a weekday, purged by edits of its weekly timetable
+  - slots: the slot table
+
+Blocks and whole timetables replaced purge free. In a multi-tenant deployment
+the keys start with the tenant, like acme/free.
+*/
+const (
+	surrogateFree  = "free"
+	surrogateSlots = "slots"
+)
+
+// Purger drops what a CDN or proxy cached under any of the surrogate keys, see package cdn
+type Purger interface {
+	Purge(keys ...string)
+}
+
+func (s *Server) surrogateKey(key string) string {
+	if s.config.Tenant != "" {
+		return s.config.Tenant + "/" + key
+	}
+	return key
+}
+
+// purge drops the keys from the CDN, if there is one
+func (s *Server) purge(keys ...string) {
+	if s.config.Purger == nil {
+		return
+	}
+	for idx, key := range keys {
+		keys[idx] = s.surrogateKey(key)
+	}
+	s.config.Purger.Purge(keys...)
+}
+
+// purgeChange purges the lookups a change of the feed makes stale
+func (s *Server) purgeChange(change changeEvent) {
+	switch {
+	case change.Kind == changeBlock:
+		// A block spans dates that are not in its change
+		s.purge(surrogateFree)
+	case change.Date != "":
+		s.purge(surrogateFree + ":" + change.Date)
+	case change.Day != "":
+		s.purge(surrogateFree + ":" + change.Day)
+	default:
+		s.purge(surrogateFree)
+	}
+}
+
+// freeKeys are the surrogate keys of a free class lookup of date
+func freeKeys(date time.Time) []string {
+	return []string{surrogateFree, surrogateFree + ":" + date.Format("2006-01-02"),
+		surrogateFree + ":" + calendar.DayCode(date.Weekday())}
+}
+
+/*
+publicResponse lets shared caches keep the response under the surrogate keys
+for CDNMaxAge; clients revalidate every time, it is the CDN that gets purged.
+It varies by Origin even for requests without one, so that a cached answer
+is not handed to a browser without its CORS headers. A tenant's answers to
+requests on a shared host are kept private: TenantHandler picked the tenant
+from their session or API key, which a shared cache does not key on.
+*/
+func (s *Server) publicResponse(w http.ResponseWriter, r *http.Request, keys ...string) {
+	if s.config.Tenant != "" && r.Context().Value(tenantHostContextKey{}) == nil {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		return
+	}
+	if s.config.CDNMaxAge > 0 {
+		w.Header().Set("Cache-Control", "public, max-age=0, s-maxage="+strconv.Itoa(int(s.config.CDNMaxAge/time.Second)))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	for idx, key := range keys {
+		keys[idx] = s.surrogateKey(key)
+	}
+	w.Header().Set("Surrogate-Key", strings.Join(keys, " "))
+	for _, vary := range w.Header().Values("Vary") {
+		if strings.Contains(vary, "Origin") {
+			return
+		}
+	}
+	w.Header().Add("Vary", "Origin")
+}
+
+/*
+freeResponse marks a free class lookup public, unless its answer depends on
+who asks: the user's favorites, or their preferred campus when the request
+names none.
+*/
+func (s *Server) freeResponse(w http.ResponseWriter, r *http.Request, date time.Time) {
+	query := r.URL.Query()
+	if only, _ := strconv.ParseBool(query.Get("onlyFavorites")); only || query.Get("campus") == "" {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		return
+	}
+	s.publicResponse(w, r, freeKeys(date)...)
+}
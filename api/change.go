@@ -0,0 +1,370 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+var changeStatuses = []string{db.ChangePending, db.ChangeApproved, db.ChangeRejected}
+
+// A change request with what stands in its way right now, for the admin deciding it
+type changeEntry struct {
+	db.ChangeRequest
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// Whether the period a of length spanA overlaps b
+func periodsOverlap(a db.StaticEntry, spanA int, b db.StaticEntry) bool {
+	return a.Class == b.Class && a.Day == b.Day && a.Slot < b.Slot+max1(b.Span) && b.Slot < a.Slot+spanA
+}
+
+func samePeriod(a db.StaticEntry, b db.StaticEntry) bool {
+	return a.Class == b.Class && a.Day == b.Day && a.Slot == b.Slot
+}
+
+/*
+planChange checks a change request against the timetable as it is now and
+returns the periods to write to carry it out. A period moving onto another of
+the same length swaps with it; anything else in the way, a slot that does not
+exist or either faculty member teaching elsewhere at the new time is a
+conflict, described by the returned string.
+*/
+func (s *Server) planChange(change db.ChangeRequest) (writes []db.StaticEntry, conflict string, err error) {
+	sources, err := s.repo.GetStatic(db.TimetableFilter{Class: change.Class, Day: change.Day, Slot: change.Slot})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(sources) == 0 || sources[0].Subject == "FREE" || !strings.EqualFold(sources[0].Faculty, change.Faculty) {
+		return nil, "The period is no longer taught by " + change.Faculty, nil
+	}
+	source := sources[0]
+	span := max1(source.Span)
+	target := db.StaticEntry{Class: change.NewClass, Day: change.NewDay, Slot: change.NewSlot,
+		Faculty: source.Faculty, Subject: source.Subject, Span: span}
+	slots := s.repo.GetAllSlot()
+	for slot := target.Slot; slot < target.Slot+span; slot++ {
+		if !containsInt(slots, slot) {
+			return nil, "Slot " + strconv.Itoa(slot) + " does not exist", nil
+		}
+	}
+
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: target.Class, Day: target.Day})
+	if err != nil {
+		return nil, "", err
+	}
+	var partner *db.StaticEntry
+	for idx, other := range entries {
+		if other.Subject == "FREE" || samePeriod(other, source) || !periodsOverlap(target, span, other) {
+			continue
+		}
+		if other.Slot == target.Slot && max1(other.Span) == span && partner == nil {
+			partner = &entries[idx]
+			continue
+		}
+		return nil, "Overlaps " + other.Subject + " in " + other.Class + " at slot " + strconv.Itoa(other.Slot), nil
+	}
+
+	busy := func(faculty string, at db.StaticEntry) (string, error) {
+		if faculty == "" {
+			return "", nil
+		}
+		taught, err := s.repo.GetStatic(db.TimetableFilter{Faculty: faculty, Day: at.Day})
+		if err != nil {
+			return "", err
+		}
+		for _, other := range taught {
+			if samePeriod(other, source) || (partner != nil && samePeriod(other, *partner)) {
+				continue
+			}
+			if other.Slot < at.Slot+span && at.Slot < other.Slot+max1(other.Span) {
+				return fmt.Sprintf("%s already teaches %s in %s at slot %d", faculty, other.Subject, other.Class, other.Slot), nil
+			}
+		}
+		return "", nil
+	}
+	conflict, err = busy(source.Faculty, target)
+	if conflict != "" || err != nil {
+		return nil, conflict, err
+	}
+	freed := db.StaticEntry{Class: source.Class, Day: source.Day, Slot: source.Slot, Subject: "FREE", Span: 1}
+	if partner != nil {
+		conflict, err = busy(partner.Faculty, source)
+		if conflict != "" || err != nil {
+			return nil, conflict, err
+		}
+		freed.Faculty, freed.Subject, freed.Span = partner.Faculty, partner.Subject, span
+	}
+	return []db.StaticEntry{freed, target}, "", nil
+}
+
+// max1 is span, or 1 for a period stored without one
+func max1(span int) int {
+	if span < 1 {
+		return 1
+	}
+	return span
+}
+
+/*
+createChangeHandler lets faculty ask for their period at class, day and slot
+to move to newClass, newDay and newSlot (each defaulting to where it is now)
+for good. It is refused straight away when it would conflict.
+*/
+func (s *Server) createChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class    string   `param:"class"`
+		Day      dayParam `param:"day,required"`
+		Slot     int      `param:"slot,required"`
+		NewClass string   `param:"newClass"`
+		NewDay   dayParam `param:"newDay"`
+		NewSlot  int      `param:"newSlot"`
+		Reason   string   `param:"reason"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	change := db.ChangeRequest{
+		Faculty:   currentSession(r).Mail,
+		Class:     query.Class,
+		Day:       string(query.Day),
+		Slot:      query.Slot,
+		NewClass:  query.NewClass,
+		NewDay:    string(query.NewDay),
+		NewSlot:   query.NewSlot,
+		Reason:    query.Reason,
+		Status:    db.ChangePending,
+		CreatedAt: time.Now(),
+	}
+	if !containsString(timetableDays, change.Day) {
+		http.Error(w, "Invalid day value", http.StatusBadRequest)
+		return
+	}
+	if change.NewDay == "" {
+		change.NewDay = change.Day
+	}
+	if !containsString(timetableDays, change.NewDay) {
+		http.Error(w, "Invalid newDay value", http.StatusBadRequest)
+		return
+	}
+	if change.NewSlot == 0 {
+		change.NewSlot = change.Slot
+	}
+	if change.NewClass == "" {
+		change.NewClass = change.Class
+	}
+	if !containsString(s.repo.GetAllClass(), change.NewClass) {
+		http.Error(w, "Invalid newClass value", http.StatusBadRequest)
+		return
+	}
+	if change.NewClass == change.Class && change.NewDay == change.Day && change.NewSlot == change.Slot {
+		http.Error(w, "The period is already there", http.StatusBadRequest)
+		return
+	}
+	if len(change.Reason) > maxReasonLength {
+		http.Error(w, "Invalid reason value", http.StatusBadRequest)
+		return
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: change.Class, Day: change.Day, Slot: change.Slot})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 || entries[0].Subject == "FREE" {
+		http.Error(w, "No such period", http.StatusNotFound)
+		return
+	}
+	if !strings.EqualFold(entries[0].Faculty, change.Faculty) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	change.Faculty = entries[0].Faculty
+	_, conflict, err := s.planChange(change)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conflict != "" {
+		http.Error(w, conflict, http.StatusConflict)
+		return
+	}
+	change.ID, err = s.repo.CreateChangeRequest(change)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusCreated, change)
+}
+
+// Lists the change requests of the user, newest first
+func (s *Server) myChangesHandler(w http.ResponseWriter, r *http.Request) {
+	changes, err := s.repo.GetChangeRequests(currentSession(r).Mail, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []db.ChangeRequest{}
+	}
+	s.writeJSON(w, r, http.StatusOK, changes)
+}
+
+// Lists the change requests in status (all when empty); pending ones say what would conflict now
+func (s *Server) adminChangesHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Status string `param:"status"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	status := query.Status
+	if status != "" && !containsString(changeStatuses, status) {
+		http.Error(w, "Invalid status value", http.StatusBadRequest)
+		return
+	}
+	changes, err := s.repo.GetChangeRequests("", status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries := make([]changeEntry, 0, len(changes))
+	for _, change := range changes {
+		entry := changeEntry{ChangeRequest: change}
+		if change.Status == db.ChangePending {
+			_, entry.Conflict, err = s.planChange(change)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		entries = append(entries, entry)
+	}
+	s.writeJSON(w, r, http.StatusOK, entries)
+}
+
+/*
+pendingChange finds the change request of the path. On failure it has already
+written the error response and returns ok = false.
+*/
+func (s *Server) pendingChange(w http.ResponseWriter, r *http.Request) (change db.ChangeRequest, ok bool) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	changes, err := s.repo.GetChangeRequests("", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, change := range changes {
+		if change.ID != id {
+			continue
+		}
+		if change.Status != db.ChangePending {
+			http.Error(w, "Already "+change.Status, http.StatusConflict)
+			return change, false
+		}
+		return change, true
+	}
+	http.Error(w, "No such change request", http.StatusNotFound)
+	return
+}
+
+// Describes where a change request moves a period, like "A104/TUE/3 to B201/WED/2"
+func describeChange(change db.ChangeRequest) string {
+	return fmt.Sprintf("%s/%s/%d to %s/%s/%d", change.Class, change.Day, change.Slot,
+		change.NewClass, change.NewDay, change.NewSlot)
+}
+
+// Carries out a pending change request, unless the timetable changed so that it now conflicts
+func (s *Server) approveChangeHandler(w http.ResponseWriter, r *http.Request) {
+	change, ok := s.pendingChange(w, r)
+	if !ok {
+		return
+	}
+	var query struct {
+		Note string `param:"note"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	if len(query.Note) > maxReasonLength {
+		http.Error(w, "Invalid note value", http.StatusBadRequest)
+		return
+	}
+	writes, conflict, err := s.planChange(change)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conflict != "" {
+		http.Error(w, conflict, http.StatusConflict)
+		return
+	}
+	err = s.repo.DecideChangeRequest(change.ID, db.ChangeApproved, adminActor(r), query.Note, time.Now())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Already decided", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, entry := range writes {
+		err = s.repo.SetStatic(entry)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.timetableChanged()
+	s.audit(r, auditApproveChange, strconv.FormatInt(change.ID, 10), describeChange(change))
+	s.notifyUser(change.Faculty, notify.KindTimetable, i18n.M("Timetable change approved"), i18n.M(describeChange(change)))
+	s.postToTeams(change.Class, i18n.M("Timetable changed"), i18n.M(describeChange(change)))
+	if change.NewClass != change.Class {
+		s.postToTeams(change.NewClass, i18n.M("Timetable changed"), i18n.M(describeChange(change)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) rejectChangeHandler(w http.ResponseWriter, r *http.Request) {
+	change, ok := s.pendingChange(w, r)
+	if !ok {
+		return
+	}
+	var query struct {
+		Note string `param:"note"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	if len(query.Note) > maxReasonLength {
+		http.Error(w, "Invalid note value", http.StatusBadRequest)
+		return
+	}
+	err := s.repo.DecideChangeRequest(change.ID, db.ChangeRejected, adminActor(r), query.Note, time.Now())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Already decided", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditRejectChange, strconv.FormatInt(change.ID, 10), describeChange(change))
+	body := i18n.M(describeChange(change))
+	if query.Note != "" {
+		body = i18n.M("%s: %s", describeChange(change), query.Note)
+	}
+	s.notifyUser(change.Faculty, notify.KindTimetable, i18n.M("Timetable change rejected"), body)
+	w.WriteHeader(http.StatusNoContent)
+}
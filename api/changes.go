@@ -0,0 +1,278 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+const (
+	// How many changes are kept for clients catching up, older cursors get a reset
+	maxFeedChanges = 256
+	// Longest and default wait of a long poll, under the default write timeout of the server
+	maxChangesWait = 25 * time.Second
+)
+
+// Kinds of timetable changes
+const (
+	changeBooking   = "booking"
+	changeTimetable = "timetable"
+	changeBlock     = "block"
+	changeOverride  = "override"
+)
+
+// A change to what the timetable lookups answer
+type changeEvent struct {
+	Kind  string `json:"kind"`
+	Class string `json:"class,omitempty"`
+	// Set for changes of a date, like "2023-06-13"
+	Date string `json:"date,omitempty"`
+	// Set for changes of the weekly timetable, like "TUE"
+	Day   string `json:"day,omitempty"`
+	Slots []int  `json:"slots,omitempty"`
+}
+
+type changesResponse struct {
+	Cursor  string        `json:"cursor"`
+	Changes []changeEvent `json:"changes"`
+	// Set when the changes since the cursor are not known, anything shown should be fetched again
+	Reset bool `json:"reset,omitempty"`
+}
+
+/*
+changeFeed numbers the timetable changes made through this server. A cursor is
+the epoch of the process with the number of the latest change seen, so cursors
+of an earlier run or of another server are told apart and reset.
+*/
+type changeFeed struct {
+	epoch string
+
+	mu  sync.Mutex
+	seq int64
+	// The latest changes, the last one numbered seq
+	recent []changeEvent
+	// Closed on the next change
+	wake chan struct{}
+	// Called with every change after it is recorded
+	onRecord func(changeEvent)
+}
+
+func newChangeFeed() *changeFeed {
+	epoch, err := token.Hex(8)
+	if err != nil {
+		epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return &changeFeed{epoch: epoch, wake: make(chan struct{})}
+}
+
+func (f *changeFeed) record(change changeEvent) {
+	f.mu.Lock()
+	f.seq++
+	f.recent = append(f.recent, change)
+	if len(f.recent) > maxFeedChanges {
+		f.recent = f.recent[len(f.recent)-maxFeedChanges:]
+	}
+	close(f.wake)
+	f.wake = make(chan struct{})
+	f.mu.Unlock()
+	if f.onRecord != nil {
+		f.onRecord(change)
+	}
+}
+
+// current is the cursor of the latest change
+func (f *changeFeed) current() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cursor(f.seq)
+}
+
+// cursor must be called with mu held
+func (f *changeFeed) cursor(seq int64) string {
+	return f.epoch + "-" + strconv.FormatInt(seq, 10)
+}
+
+/*
+since answers with the changes after cursor and a channel closed on the next
+change, for waiting when there are none yet. The response is a reset without a
+channel when cursor is too old or of another process.
+*/
+func (f *changeFeed) since(cursor string) (changesResponse, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	response := changesResponse{Cursor: f.cursor(f.seq), Changes: []changeEvent{}}
+	idx := strings.LastIndex(cursor, "-")
+	if idx < 0 || cursor[:idx] != f.epoch {
+		response.Reset = true
+		return response, nil
+	}
+	seq, err := strconv.ParseInt(cursor[idx+1:], 10, 64)
+	first := f.seq - int64(len(f.recent))
+	if err != nil || seq > f.seq || seq < first {
+		response.Reset = true
+		return response, nil
+	}
+	response.Changes = append(response.Changes, f.recent[seq-first:]...)
+	return response, f.wake
+}
+
+/*
+changeRecorder is the Repository of a Server, recording in its feed the writes
+that change what the timetable lookups answer once they went through.
+*/
+type changeRecorder struct {
+	db.Repository
+	feed *changeFeed
+}
+
+func dateChange(kind string, class string, date time.Time, slots ...int) changeEvent {
+	return changeEvent{Kind: kind, Class: class, Date: date.Format("2006-01-02"), Slots: slots}
+}
+
+func (c changeRecorder) Booking(class string, date time.Time, slot int, faculty string, subject string) (int64, error) {
+	rowsAffected, err := c.Repository.Booking(class, date, slot, faculty, subject)
+	if err == nil && rowsAffected > 0 {
+		c.feed.record(dateChange(changeBooking, class, date, slot))
+	}
+	return rowsAffected, err
+}
+
+func (c changeRecorder) MultiBooking(class string, date time.Time, startSlot int, endSlot int, faculty string, subject string) (int64, error) {
+	rowsAffected, err := c.Repository.MultiBooking(class, date, startSlot, endSlot, faculty, subject)
+	if err == nil && rowsAffected > 0 {
+		var slots []int
+		for slot := startSlot; slot <= endSlot; slot++ {
+			slots = append(slots, slot)
+		}
+		c.feed.record(dateChange(changeBooking, class, date, slots...))
+	}
+	return rowsAffected, err
+}
+
+func (c changeRecorder) CancelBooking(class string, date time.Time, slot int) error {
+	err := c.Repository.CancelBooking(class, date, slot)
+	if err == nil {
+		c.feed.record(dateChange(changeBooking, class, date, slot))
+	}
+	return err
+}
+
+func (c changeRecorder) CancelBookingVersion(class string, date time.Time, slot int, version int) error {
+	err := c.Repository.CancelBookingVersion(class, date, slot, version)
+	if err == nil {
+		c.feed.record(dateChange(changeBooking, class, date, slot))
+	}
+	return err
+}
+
+func (c changeRecorder) UpdateBooking(booking db.BookingRecord) error {
+	err := c.Repository.UpdateBooking(booking)
+	if err == nil {
+		c.feed.record(dateChange(changeBooking, booking.Class, booking.Date, booking.Slot))
+	}
+	return err
+}
+
+func (c changeRecorder) SetStatic(entry db.StaticEntry) error {
+	err := c.Repository.SetStatic(entry)
+	if err == nil {
+		c.feed.record(changeEvent{Kind: changeTimetable, Class: entry.Class, Day: entry.Day, Slots: []int{entry.Slot}})
+	}
+	return err
+}
+
+func (c changeRecorder) DeleteStatic(class string, day string, slot int) (int64, error) {
+	rowsAffected, err := c.Repository.DeleteStatic(class, day, slot)
+	if err == nil && rowsAffected > 0 {
+		c.feed.record(changeEvent{Kind: changeTimetable, Class: class, Day: day, Slots: []int{slot}})
+	}
+	return rowsAffected, err
+}
+
+// A whole timetable replaced is one change without a class
+func (c changeRecorder) ReplaceStatic(entries []db.StaticEntry) error {
+	err := c.Repository.ReplaceStatic(entries)
+	if err == nil {
+		c.feed.record(changeEvent{Kind: changeTimetable})
+	}
+	return err
+}
+
+func (c changeRecorder) CreateBlock(block db.Block) (int64, error) {
+	id, err := c.Repository.CreateBlock(block)
+	if err == nil {
+		c.feed.record(dateChange(changeBlock, block.Class, block.StartDate))
+	}
+	return id, err
+}
+
+func (c changeRecorder) DeleteBlock(id int64) (int64, error) {
+	rowsAffected, err := c.Repository.DeleteBlock(id)
+	if err == nil && rowsAffected > 0 {
+		c.feed.record(changeEvent{Kind: changeBlock})
+	}
+	return rowsAffected, err
+}
+
+func (c changeRecorder) SetOverride(override db.Override) error {
+	err := c.Repository.SetOverride(override)
+	if err == nil {
+		c.feed.record(dateChange(changeOverride, override.Class, override.Date, override.Slot))
+	}
+	return err
+}
+
+func (c changeRecorder) DeleteOverride(class string, date time.Time, slot int) (int64, error) {
+	rowsAffected, err := c.Repository.DeleteOverride(class, date, slot)
+	if err == nil && rowsAffected > 0 {
+		c.feed.record(dateChange(changeOverride, class, date, slot))
+	}
+	return rowsAffected, err
+}
+
+/*
+changesHandler long-polls for timetable changes. Without since it answers at
+once with the cursor to start from; with one it answers with the changes made
+after it, waiting up to timeout seconds for one when there are none yet. The
+answer always carries the cursor to ask with next.
+*/
+func (s *Server) changesHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		// In seconds
+		Timeout *int   `param:"timeout,min=0"`
+		Since   string `param:"since"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	wait := maxChangesWait
+	if query.Timeout != nil {
+		wait = time.Duration(*query.Timeout) * time.Second
+		if wait > maxChangesWait {
+			wait = maxChangesWait
+		}
+	}
+	response := changesResponse{Cursor: s.changes.current(), Changes: []changeEvent{}}
+	if since := query.Since; since != "" {
+		var wake <-chan struct{}
+		response, wake = s.changes.since(since)
+		if wake != nil && len(response.Changes) == 0 && wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-wake:
+				response, _ = s.changes.since(since)
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, r, http.StatusOK, response)
+}
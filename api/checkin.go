@@ -0,0 +1,225 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/token"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// How long before its slot starts a booking can be checked in
+const checkInEarly = 10 * time.Minute
+
+// Width and height of the QR code PNG, in pixels
+const qrSize = 256
+
+// Booking IDs look like A104-20230613-2: the class, the date and the slot
+func bookingID(class string, date time.Time, slot int) string {
+	return class + "-" + date.Format("20060102") + "-" + strconv.Itoa(slot)
+}
+
+// parseBookingID gives the date at midnight UTC, like calendar.Date and the dates bookings are stored with
+func parseBookingID(id string) (class string, date time.Time, slot int, ok bool) {
+	slotAt := strings.LastIndex(id, "-")
+	if slotAt < 0 {
+		return "", time.Time{}, 0, false
+	}
+	dateAt := strings.LastIndex(id[:slotAt], "-")
+	if dateAt < 1 {
+		return "", time.Time{}, 0, false
+	}
+	date, err := time.Parse("20060102", id[dateAt+1:slotAt])
+	if err != nil {
+		return "", time.Time{}, 0, false
+	}
+	slot, err = strconv.Atoi(id[slotAt+1:])
+	if err != nil {
+		return "", time.Time{}, 0, false
+	}
+	return id[:dateAt], date, slot, true
+}
+
+// checkIn returns the check-in of a booking, if it has one
+func (s *Server) checkIn(class string, date time.Time, slot int) (db.CheckIn, bool, error) {
+	checkIns, err := s.repo.GetCheckIns(class, date)
+	if err != nil {
+		return db.CheckIn{}, false, err
+	}
+	for _, checkIn := range checkIns {
+		if checkIn.Slot == slot {
+			return checkIn, true, nil
+		}
+	}
+	return db.CheckIn{}, false, nil
+}
+
+// slotTime returns the start and end of slot on date
+func (s *Server) slotTime(date time.Time, slot int) (time.Time, time.Time, bool, error) {
+	slotTimes, err := s.repo.GetSlotTimes()
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+	for _, slotTime := range slotTimes {
+		if slotTime.ID == slot {
+			return s.clockTime(date, slotTime.Start), s.clockTime(date, slotTime.End), true, nil
+		}
+	}
+	return time.Time{}, time.Time{}, false, nil
+}
+
+/*
+bookingQRHandler answers with a PNG QR code of the URL that checks the booking
+in. Only the faculty member who made the booking gets it; it is meant to be
+shown or printed and scanned at the room.
+*/
+func (s *Server) bookingQRHandler(w http.ResponseWriter, r *http.Request) {
+	class, date, slot, ok := parseBookingID(router.Param(r, "id"))
+	if !ok {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	booking, booked, err := s.booking(class, date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !booked {
+		http.Error(w, "No such booking", http.StatusNotFound)
+		return
+	}
+	if !strings.EqualFold(booking.Faculty, currentSession(r).Mail) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	checkIn, found, err := s.checkIn(class, date, slot)
+	if err == nil && !found {
+		checkIn = db.CheckIn{Class: class, Date: date, Slot: slot}
+		checkIn.Token, err = token.Hex(s.config.TokenBytes)
+		if err == nil {
+			err = s.repo.CreateCheckIn(checkIn)
+		}
+		if err == nil {
+			// Someone may have been faster, whose token was kept
+			checkIn, _, err = s.checkIn(class, date, slot)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	checkInURL := baseURL(r) + "/booking/" + bookingID(class, date, slot) + "/checkin?token=" + checkIn.Token
+	png, err := qrcode.Encode(checkInURL, qrcode.Medium, qrSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(png)
+}
+
+/*
+checkInHandler is what the QR code of a booking opens. It checks the booking
+in from a little before its slot starts until the slot ends.
+*/
+func (s *Server) checkInHandler(w http.ResponseWriter, r *http.Request) {
+	class, date, slot, ok := parseBookingID(router.Param(r, "id"))
+	if !ok {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	checkIn, found, err := s.checkIn(class, date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found || subtle.ConstantTimeCompare([]byte(checkIn.Token), []byte(r.URL.Query().Get("token"))) != 1 {
+		http.Error(w, "No such booking", http.StatusNotFound)
+		return
+	}
+	start, end, _, err := s.slotTime(date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	if now.Before(start.Add(-checkInEarly)) {
+		http.Error(w, "Check-in opens at "+start.Add(-checkInEarly).Format("15:04"), http.StatusConflict)
+		return
+	}
+	if !now.Before(end) {
+		http.Error(w, "The booking is over", http.StatusConflict)
+		return
+	}
+	err = s.repo.MarkCheckedIn(class, date, slot, now)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such booking", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	checkIn, _, err = s.checkIn(class, date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, checkIn)
+}
+
+/*
+ReleaseUnusedBookings cancels the bookings whose slot is under way on now's
+date and started more than the check-in grace period before now without anyone
+checking in, and tells their faculty. It returns how many it cancelled.
+*/
+func (s *Server) ReleaseUnusedBookings(now time.Time) int {
+	date := calendar.Date(now, s.config.Location)
+	bookings, err := s.repo.GetBookings(db.BookingFilter{StartDate: date, EndDate: date})
+	if err != nil {
+		s.logger.Println("Error listing bookings to release", err)
+		return 0
+	}
+	checkIns, err := s.repo.GetCheckIns("", date)
+	if err != nil {
+		s.logger.Println("Error listing check-ins", err)
+		return 0
+	}
+	checkedIn := make(map[string]bool)
+	for _, checkIn := range checkIns {
+		if checkIn.CheckedInAt != nil {
+			checkedIn[bookingID(checkIn.Class, checkIn.Date, checkIn.Slot)] = true
+		}
+	}
+	released := 0
+	for _, booking := range bookings {
+		if checkedIn[bookingID(booking.Class, booking.Date, booking.Slot)] {
+			continue
+		}
+		start, end, ok, err := s.slotTime(date, booking.Slot)
+		if err != nil || !ok || now.Before(start.Add(s.config.CheckInGrace)) || !now.Before(end) {
+			continue
+		}
+		// Not cancelBooking: nobody on the waitlist could make it in time either
+		err = s.repo.CancelBooking(booking.Class, booking.Date, booking.Slot)
+		if err != nil {
+			s.logger.Println("Error releasing a booking", err)
+			continue
+		}
+		released++
+		s.notifyUser(booking.Faculty, notify.KindBooking, i18n.M("Booking of %s released", booking.Class),
+			i18n.M("Nobody checked in to %s on %s, slot %d within %s, so the room was freed.",
+				booking.Class, date.Format(calendar.DateLayout), booking.Slot, s.config.CheckInGrace))
+	}
+	return released
+}
@@ -0,0 +1,451 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+const (
+	// Longest accepted club ID and name, in bytes
+	maxClubIDLength   = 32
+	maxClubNameLength = 64
+	// Most people on the roster of a club
+	maxClubRoster = 500
+	// Largest accepted club body, in bytes
+	maxClubSize = 256 << 10
+)
+
+// What someone is to a club
+const (
+	clubAdvisor     = "advisor"
+	clubCoordinator = "coordinator"
+	clubMember      = "member"
+)
+
+// The body of PUT /admin/clubs/{id}
+type clubRequest struct {
+	Name         string   `json:"name"`
+	Advisor      string   `json:"advisor"`
+	Coordinators []string `json:"coordinators"`
+	Members      []string `json:"members"`
+}
+
+// A club of the user, with what they are to it
+type myClub struct {
+	db.Club
+	Role string `json:"role"`
+}
+
+// Club IDs are short lowercase names like "coding-club"
+func validClubID(id string) bool {
+	if id == "" || len(id) > maxClubIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func validMail(mail string) bool {
+	return len(mail) <= 254 && strings.Count(mail, "@") == 1 && !strings.HasPrefix(mail, "@") &&
+		!strings.HasSuffix(mail, "@") && !strings.ContainsAny(mail, " ,;")
+}
+
+// clubRole returns what mail is to club: its advisor, a coordinator, a member or nothing
+func clubRole(club db.Club, mail string) string {
+	if mail == "" {
+		return ""
+	}
+	if strings.EqualFold(club.Advisor, mail) {
+		return clubAdvisor
+	}
+	for _, coordinator := range club.Coordinators {
+		if strings.EqualFold(coordinator, mail) {
+			return clubCoordinator
+		}
+	}
+	for _, member := range club.Members {
+		if strings.EqualFold(member, mail) {
+			return clubMember
+		}
+	}
+	return ""
+}
+
+// club returns the club with id, if there is one
+func (s *Server) club(id string) (db.Club, bool, error) {
+	clubs, err := s.repo.GetClubs()
+	if err != nil {
+		return db.Club{}, false, err
+	}
+	for _, club := range clubs {
+		if club.ID == id {
+			return club, true, nil
+		}
+	}
+	return db.Club{}, false, nil
+}
+
+func (s *Server) writeClubs(w http.ResponseWriter, r *http.Request, clubs interface{}) {
+	s.writeJSON(w, r, http.StatusOK, clubs)
+}
+
+// Lists the clubs with their advisors and coordinators; the members are left out
+func (s *Server) clubsHandler(w http.ResponseWriter, r *http.Request) {
+	clubs, err := s.repo.GetClubs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if clubs == nil {
+		clubs = []db.Club{}
+	}
+	for idx := range clubs {
+		clubs[idx].Members = nil
+	}
+	s.writeClubs(w, r, clubs)
+}
+
+// Lists the clubs with their whole rosters
+func (s *Server) adminClubsHandler(w http.ResponseWriter, r *http.Request) {
+	clubs, err := s.repo.GetClubs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if clubs == nil {
+		clubs = []db.Club{}
+	}
+	s.writeClubs(w, r, clubs)
+}
+
+// Lists the clubs the user advises, coordinates or is a member of
+func (s *Server) myClubsHandler(w http.ResponseWriter, r *http.Request) {
+	clubs, err := s.repo.GetClubs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mine := []myClub{}
+	for _, club := range clubs {
+		if role := clubRole(club, currentSession(r).Mail); role != "" {
+			mine = append(mine, myClub{Club: club, Role: role})
+		}
+	}
+	s.writeClubs(w, r, mine)
+}
+
+/*
+setClubHandler adds the club of the path or replaces it, roster included, from
+a JSON body like {"name": "Coding Club", "advisor": "faculty@cb.amrita.edu",
+"coordinators": [...], "members": [...]}. Coordinators listed among the members
+too are kept as coordinators.
+*/
+func (s *Server) setClubHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	if !validClubID(id) {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	var request clubRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, maxClubSize)).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	club := db.Club{ID: id, Name: strings.TrimSpace(request.Name), Advisor: strings.TrimSpace(request.Advisor),
+		Coordinators: []string{}}
+	if club.Name == "" || len(club.Name) > maxClubNameLength {
+		http.Error(w, "Invalid name value", http.StatusBadRequest)
+		return
+	}
+	if !validMail(club.Advisor) {
+		http.Error(w, "Invalid advisor value", http.StatusBadRequest)
+		return
+	}
+	if len(request.Coordinators)+len(request.Members) > maxClubRoster {
+		http.Error(w, "Too many members", http.StatusBadRequest)
+		return
+	}
+	for _, mail := range request.Coordinators {
+		mail = strings.TrimSpace(mail)
+		if !validMail(mail) {
+			http.Error(w, "Invalid coordinator "+mail, http.StatusBadRequest)
+			return
+		}
+		if clubRole(club, mail) == "" {
+			club.Coordinators = append(club.Coordinators, mail)
+		}
+	}
+	for _, mail := range request.Members {
+		mail = strings.TrimSpace(mail)
+		if !validMail(mail) {
+			http.Error(w, "Invalid member "+mail, http.StatusBadRequest)
+			return
+		}
+		if clubRole(club, mail) == "" {
+			club.Members = append(club.Members, mail)
+		}
+	}
+	err = s.repo.SetClub(club)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditSetClub, club.ID, club.Name+", advised by "+club.Advisor+", "+
+		strconv.Itoa(len(club.Coordinators)+len(club.Members))+" members")
+	s.writeClubs(w, r, club)
+}
+
+func (s *Server) deleteClubHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	rowsAffected, err := s.repo.DeleteClub(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such club", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteClub, id, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+setClubMemberHandler adds mail of the path to the roster of the club, as a
+coordinator with coordinator=true. Coordinators and the advisor add members;
+only the advisor names coordinators.
+*/
+func (s *Server) setClubMemberHandler(w http.ResponseWriter, r *http.Request) {
+	club, found, err := s.club(router.Param(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "No such club", http.StatusNotFound)
+		return
+	}
+	mail := router.Param(r, "mail")
+	if !validMail(mail) {
+		http.Error(w, "Invalid mail value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Coordinator bool `param:"coordinator"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	coordinator := query.Coordinator
+	role := clubRole(club, currentSession(r).Mail)
+	if role != clubAdvisor && (role != clubCoordinator || coordinator) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if clubRole(club, mail) == clubAdvisor {
+		http.Error(w, mail+" advises the club", http.StatusConflict)
+		return
+	}
+	club = withoutMember(club, mail)
+	if coordinator {
+		club.Coordinators = append(club.Coordinators, mail)
+	} else {
+		club.Members = append(club.Members, mail)
+	}
+	if len(club.Coordinators)+len(club.Members) > maxClubRoster {
+		http.Error(w, "Too many members", http.StatusConflict)
+		return
+	}
+	err = s.repo.SetClub(club)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Takes mail of the path off the roster of the club, by its coordinators, its advisor or mail themselves
+func (s *Server) deleteClubMemberHandler(w http.ResponseWriter, r *http.Request) {
+	club, found, err := s.club(router.Param(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "No such club", http.StatusNotFound)
+		return
+	}
+	mail := router.Param(r, "mail")
+	user := currentSession(r).Mail
+	role := clubRole(club, user)
+	if role != clubAdvisor && role != clubCoordinator && !strings.EqualFold(user, mail) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	// Only the advisor removes coordinators other than themselves
+	if clubRole(club, mail) == clubCoordinator && role != clubAdvisor && !strings.EqualFold(user, mail) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if memberRole := clubRole(club, mail); memberRole != clubCoordinator && memberRole != clubMember {
+		http.Error(w, "No such member", http.StatusNotFound)
+		return
+	}
+	err = s.repo.SetClub(withoutMember(club, mail))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// withoutMember returns club with mail taken off its coordinators and members
+func withoutMember(club db.Club, mail string) db.Club {
+	coordinators := []string{}
+	for _, coordinator := range club.Coordinators {
+		if !strings.EqualFold(coordinator, mail) {
+			coordinators = append(coordinators, coordinator)
+		}
+	}
+	var members []string
+	for _, member := range club.Members {
+		if !strings.EqualFold(member, mail) {
+			members = append(members, member)
+		}
+	}
+	club.Coordinators = coordinators
+	club.Members = members
+	return club
+}
+
+// Lists the pending events of the clubs the user advises
+func (s *Server) pendingEventsHandler(w http.ResponseWriter, r *http.Request) {
+	clubs, err := s.repo.GetClubs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pending := []db.Event{}
+	for _, club := range clubs {
+		if clubRole(club, currentSession(r).Mail) != clubAdvisor {
+			continue
+		}
+		events, err := s.repo.GetEvents(db.EventFilter{Club: club.ID})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, event := range events {
+			if event.Pending {
+				pending = append(pending, event)
+			}
+		}
+	}
+	s.writeEvents(w, r, pending, true)
+}
+
+/*
+pendingClubEvent finds the event of the path, which must wait for the user as
+the advisor of its club. On failure it has already written the error response
+and returns ok = false.
+*/
+func (s *Server) pendingClubEvent(w http.ResponseWriter, r *http.Request) (event db.Event, club db.Club, ok bool) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	clubs, err := s.repo.GetClubs()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, club = range clubs {
+		if clubRole(club, currentSession(r).Mail) != clubAdvisor {
+			continue
+		}
+		events, err := s.repo.GetEvents(db.EventFilter{Club: club.ID})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return event, club, false
+		}
+		for _, event = range events {
+			if event.ID == id && event.Pending {
+				return event, club, true
+			}
+		}
+	}
+	http.Error(w, "No such event", http.StatusNotFound)
+	return db.Event{}, db.Club{}, false
+}
+
+// Describes a club event, like "Hackathon in A104 on behalf of Coding Club"
+func describeClubEvent(event db.Event, club db.Club) i18n.Message {
+	return i18n.M("%s in %s on behalf of %s", event.Title, event.Class, club.Name)
+}
+
+func (s *Server) approveEventHandler(w http.ResponseWriter, r *http.Request) {
+	event, club, ok := s.pendingClubEvent(w, r)
+	if !ok {
+		return
+	}
+	rowsAffected, err := s.repo.ApproveEvent(event.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Already decided", http.StatusConflict)
+		return
+	}
+	s.notifyUser(event.CreatedBy, notify.KindEvent, i18n.M("Event approved"),
+		i18n.M("%s was approved.", describeClubEvent(event, club)))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Cancels a pending club event, telling who booked it the reason
+func (s *Server) rejectEventHandler(w http.ResponseWriter, r *http.Request) {
+	event, club, ok := s.pendingClubEvent(w, r)
+	if !ok {
+		return
+	}
+	var query struct {
+		Reason string `param:"reason"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	reason := query.Reason
+	if len(reason) > maxReasonLength {
+		http.Error(w, "Invalid reason value", http.StatusBadRequest)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteEvent(event.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "Already decided", http.StatusConflict)
+		return
+	}
+	body := i18n.M("%s was rejected", describeClubEvent(event, club))
+	if reason != "" {
+		body = i18n.M("%s was rejected: %s", describeClubEvent(event, club), reason)
+	}
+	s.notifyUser(event.CreatedBy, notify.KindEvent, i18n.M("Event rejected"), body)
+	w.WriteHeader(http.StatusNoContent)
+}
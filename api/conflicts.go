@@ -0,0 +1,158 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+)
+
+// Periods that want the same room, or the same faculty member, in one slot
+type timetableClash struct {
+	Class   string           `json:"class,omitempty"`
+	Faculty string           `json:"faculty,omitempty"`
+	Day     string           `json:"day"`
+	Slot    int              `json:"slot"`
+	Entries []db.StaticEntry `json:"entries"`
+}
+
+// The slots of a day with nothing in the timetable of a classroom, not even FREE
+type missingSlots struct {
+	Class string `json:"class"`
+	Day   string `json:"day"`
+	Slots []int  `json:"slots"`
+}
+
+type timetableConflicts struct {
+	// A lab reaching over a slot holding another subject
+	RoomClashes    []timetableClash `json:"roomClashes"`
+	FacultyClashes []timetableClash `json:"facultyClashes"`
+	MissingSlots   []missingSlots   `json:"missingSlots"`
+}
+
+/*
+findConflicts checks a timetable for what spreadsheet imports tend to get
+wrong. Rows are unique per room, day and slot, so a room is only taken twice
+by a lab reaching over a later slot holding another subject. A faculty member
+is in two places when they teach in two rooms in one slot. Slots are missing
+on the days a room has any row at all, so rooms not used on Saturdays don't
+count as missing them.
+*/
+func findConflicts(entries []db.StaticEntry, slots []int) timetableConflicts {
+	conflicts := timetableConflicts{RoomClashes: []timetableClash{}, FacultyClashes: []timetableClash{}, MissingSlots: []missingSlots{}}
+	type key struct {
+		who  string
+		day  string
+		slot int
+	}
+	rooms := make(map[key][]db.StaticEntry)
+	faculty := make(map[key][]db.StaticEntry)
+	covered := make(map[key]bool)
+	days := make(map[string]map[string]bool)
+	for _, entry := range entries {
+		if days[entry.Class] == nil {
+			days[entry.Class] = make(map[string]bool)
+		}
+		days[entry.Class][entry.Day] = true
+		if entry.Subject == "FREE" {
+			covered[key{entry.Class, entry.Day, entry.Slot}] = true
+			continue
+		}
+		span := entry.Span
+		if span < 1 {
+			span = 1
+		}
+		for slot := entry.Slot; slot < entry.Slot+span; slot++ {
+			room := key{entry.Class, entry.Day, slot}
+			covered[room] = true
+			// The rows of a lab's later slots may repeat it
+			clash := false
+			for _, other := range rooms[room] {
+				clash = clash || other.Subject != entry.Subject
+			}
+			if clash || len(rooms[room]) == 0 {
+				rooms[room] = append(rooms[room], entry)
+			}
+			if entry.Faculty == "" {
+				continue
+			}
+			teacher := key{strings.ToLower(entry.Faculty), entry.Day, slot}
+			elsewhere := false
+			for _, other := range faculty[teacher] {
+				elsewhere = elsewhere || other.Class != entry.Class
+			}
+			if elsewhere || len(faculty[teacher]) == 0 {
+				faculty[teacher] = append(faculty[teacher], entry)
+			}
+		}
+	}
+	for room, clashing := range rooms {
+		if len(clashing) > 1 {
+			conflicts.RoomClashes = append(conflicts.RoomClashes, timetableClash{Class: room.who, Day: room.day, Slot: room.slot, Entries: clashing})
+		}
+	}
+	for teacher, clashing := range faculty {
+		if len(clashing) > 1 {
+			conflicts.FacultyClashes = append(conflicts.FacultyClashes, timetableClash{Faculty: teacher.who, Day: teacher.day, Slot: teacher.slot, Entries: clashing})
+		}
+	}
+	for class, classDays := range days {
+		for day := range classDays {
+			missing := missingSlots{Class: class, Day: day}
+			for _, slot := range slots {
+				if !covered[key{class, day, slot}] {
+					missing.Slots = append(missing.Slots, slot)
+				}
+			}
+			if len(missing.Slots) > 0 {
+				conflicts.MissingSlots = append(conflicts.MissingSlots, missing)
+			}
+		}
+	}
+
+	order := make(map[string]int)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		order[calendar.DayCode(day)] = int(day)
+	}
+	sortClashes := func(clashes []timetableClash) {
+		sort.Slice(clashes, func(i, j int) bool {
+			a, b := clashes[i], clashes[j]
+			if a.Class+a.Faculty != b.Class+b.Faculty {
+				return a.Class+a.Faculty < b.Class+b.Faculty
+			}
+			if a.Day != b.Day {
+				return order[a.Day] < order[b.Day]
+			}
+			return a.Slot < b.Slot
+		})
+	}
+	sortClashes(conflicts.RoomClashes)
+	sortClashes(conflicts.FacultyClashes)
+	sort.Slice(conflicts.MissingSlots, func(i, j int) bool {
+		a, b := conflicts.MissingSlots[i], conflicts.MissingSlots[j]
+		if a.Class != b.Class {
+			return a.Class < b.Class
+		}
+		return order[a.Day] < order[b.Day]
+	})
+	return conflicts
+}
+
+// Reports the conflicts of the stored timetable, of the classrooms on campus when it is given
+func (s *Server) timetableConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Campus string `param:"campus"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Campus: query.Campus})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, findConflicts(entries, s.repo.GetAllSlot()))
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+const (
+	// Most custom entries a user can keep
+	maxCustomEntries = 50
+	// Longest accepted title of a custom entry, in bytes
+	maxCustomTitleLength = 64
+)
+
+// Lists the user's custom entries by day of the week and start time
+func (s *Server) myCustomEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.repo.GetCustomEntries(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []db.CustomEntry{}
+	}
+	s.writeJSON(w, r, http.StatusOK, entries)
+}
+
+/*
+createCustomEntryHandler adds something the user does every week on day, from
+start to end ("17:30"), like the gym. Only the user sees it, in their
+timetable and calendar feed.
+*/
+func (s *Server) createCustomEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Title string   `param:"title"`
+		Day   dayParam `param:"day,required"`
+		Start string   `param:"start"`
+		End   string   `param:"end"`
+		Place string   `param:"place"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	entry := db.CustomEntry{
+		Mail:      currentSession(r).Mail,
+		Title:     query.Title,
+		Day:       string(query.Day),
+		StartTime: query.Start,
+		EndTime:   query.End,
+		Place:     query.Place,
+		CreatedAt: time.Now(),
+	}
+	if entry.Title == "" || len(entry.Title) > maxCustomTitleLength {
+		http.Error(w, "Invalid title value", http.StatusBadRequest)
+		return
+	}
+	start, err := time.Parse(examTimeLayout, entry.StartTime)
+	if err != nil {
+		http.Error(w, "Invalid start value", http.StatusBadRequest)
+		return
+	}
+	end, err := time.Parse(examTimeLayout, entry.EndTime)
+	if err != nil || !end.After(start) {
+		http.Error(w, "Invalid end value", http.StatusBadRequest)
+		return
+	}
+	if len(entry.Place) > maxPlaceLength {
+		http.Error(w, "Invalid place value", http.StatusBadRequest)
+		return
+	}
+	entries, err := s.repo.GetCustomEntries(entry.Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) >= maxCustomEntries {
+		http.Error(w, "Too many entries, at most "+strconv.Itoa(maxCustomEntries), http.StatusConflict)
+		return
+	}
+	entry.ID, err = s.repo.CreateCustomEntry(entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusCreated, entry)
+}
+
+func (s *Server) deleteCustomEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteCustomEntry(currentSession(r).Mail, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such entry", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+customEvents returns the custom entries of mail as weekly calendar events,
+from the first of their day on or after the one they were added on
+*/
+func (s *Server) customEvents(mail string) ([]icsEvent, error) {
+	entries, err := s.repo.GetCustomEntries(mail)
+	if err != nil {
+		return nil, err
+	}
+	var events []icsEvent
+	for _, entry := range entries {
+		created := entry.CreatedAt.In(s.config.Location)
+		date := time.Date(created.Year(), created.Month(), created.Day(), 0, 0, 0, 0, time.UTC)
+		for calendar.DayCode(date.Weekday()) != entry.Day {
+			date = date.AddDate(0, 0, 1)
+		}
+		events = append(events, icsEvent{
+			UID:      "custom-" + strconv.FormatInt(entry.ID, 10) + "@coraserver",
+			Start:    s.clockTime(date, entry.StartTime),
+			End:      s.clockTime(date, entry.EndTime),
+			Summary:  entry.Title,
+			Location: entry.Place,
+			Weekly:   true,
+		})
+	}
+	return events, nil
+}
@@ -0,0 +1,700 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/params"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Audit actions recorded by the admin endpoints
+const (
+	auditSetTimetable       = "timetable.set"
+	auditDeleteTimetable    = "timetable.delete"
+	auditCancelBooking      = "booking.cancel"
+	auditCreateAnnouncement = "announcement.create"
+	auditUpdateAnnouncement = "announcement.update"
+	auditDeleteAnnouncement = "announcement.delete"
+	auditForceLogout        = "user.logout"
+	auditCreateAPIKey       = "apikey.create"
+	auditRevokeAPIKey       = "apikey.revoke"
+	auditRotateAPIKey       = "apikey.rotate"
+	auditCreateExam         = "exam.create"
+	auditUpdateExam         = "exam.update"
+	auditDeleteExam         = "exam.delete"
+	auditImportExams        = "exam.import"
+	auditAllocateExam       = "exam.allocate"
+	auditSetClassroom       = "classroom.set"
+	auditSetOverride        = "override.set"
+	auditDeleteOverride     = "override.delete"
+	auditApproveChange      = "change.approve"
+	auditRejectChange       = "change.reject"
+	auditCreateBlock        = "block.create"
+	auditDeleteBlock        = "block.delete"
+	auditRelocate           = "room.relocate"
+	auditSetAlias           = "alias.set"
+	auditDeleteAlias        = "alias.delete"
+	auditSetTeamsChannel    = "teams.set"
+	auditDeleteTeamsChannel = "teams.delete"
+	auditDeleteEvent        = "event.delete"
+	auditSetClub            = "club.set"
+	auditDeleteClub         = "club.delete"
+	auditSetEquipment       = "equipment.set"
+	auditDeleteEquipment    = "equipment.delete"
+	auditSetAttendance      = "attendance.set"
+	auditSetCampus          = "campus.set"
+	auditDeleteCampus       = "campus.delete"
+	auditSetBuilding        = "building.set"
+	auditDeleteBuilding     = "building.delete"
+	auditSetPath            = "path.set"
+	auditDeletePath         = "path.delete"
+	auditImportEnrollments  = "enrollment.import"
+	auditDeleteEnrollments  = "enrollment.delete"
+	auditBroadcast          = "broadcast.send"
+	auditResolveFeedback    = "feedback.resolve"
+	auditDismissFeedback    = "feedback.dismiss"
+	auditEraseUser          = "user.erase"
+	auditRejectErasure      = "erasure.reject"
+	auditCreateBackup       = "backup.create"
+	auditDeleteBackup       = "backup.delete"
+	auditRestoreBackup      = "backup.restore"
+	auditERPImport          = "erp.import"
+	auditRestoreTrash       = "trash.restore"
+	auditPurgeTrash         = "trash.purge"
+	auditCreateSnapshot     = "snapshot.create"
+	auditDeleteSnapshot     = "snapshot.delete"
+	auditRollbackTimetable  = "timetable.rollback"
+	auditRunJob             = "job.run"
+	auditPauseJob           = "job.pause"
+	auditResumeJob          = "job.resume"
+	auditSyncDirectory      = "directory.sync"
+	auditSyncGroups         = "groups.sync"
+	auditStartImpersonation = "impersonation.start"
+	auditEndImpersonation   = "impersonation.end"
+	// Made by an admin while acting as a user
+	auditImpersonatedRequest = "impersonation.request"
+	auditLiftLockout         = "lockout.lift"
+	auditResealTokens        = "tokens.reseal"
+	auditStartTrafficLog     = "logging.start"
+	auditStopTrafficLog      = "logging.stop"
+)
+
+// How many audit events the dashboard shows
+const dashboardAuditEvents = 10
+
+var timetableDays = []string{"MON", "TUE", "WED", "THU", "FRI"}
+
+// Most slots one period can take, for the longest labs
+const maxSpan = 4
+
+/*
+audit records who made an admin change. Failing to record it is logged but
+does not fail the request, the change has already been made.
+*/
+func (s *Server) audit(r *http.Request, action string, target string, detail string) {
+	s.auditAs(adminActor(r), action, target, detail)
+}
+
+// auditAs records a change made by actor after its request is over, like at the end of a task
+func (s *Server) auditAs(actor string, action string, target string, detail string) {
+	err := s.repo.RecordAudit(db.AuditEvent{
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Detail: detail,
+		At:     time.Now(),
+	})
+	if err != nil {
+		s.logger.Println("Error recording audit event", err)
+	}
+}
+
+// adminActor names who is behind an admin request: "admin" for the admin key, "apikey:<id>" for an API key
+func adminActor(r *http.Request) string {
+	if key, ok := requestAPIKey(r); ok {
+		return "apikey:" + key.ID
+	}
+	return "admin"
+}
+
+// parseLimit reads the limit parameter, which defaults to def and is capped at 500
+func parseLimit(r *http.Request, def int) (int, bool) {
+	return limitParam(r, def, 500)
+}
+
+func limitParam(r *http.Request, def int, max int) (int, bool) {
+	var query struct {
+		Limit int `param:"limit,min=1"`
+	}
+	if err := (params.Decoder{}).Decode(r.URL.Query(), &query); err != nil {
+		return 0, false
+	}
+	if query.Limit == 0 {
+		return def, true
+	}
+	if query.Limit > max {
+		return max, true
+	}
+	return query.Limit, true
+}
+
+type dashboardResponse struct {
+	db.DashboardCounts
+	RecentAudit []db.AuditEvent `json:"recentAudit"`
+}
+
+// The counts on the front page of the admin dashboard and the latest changes
+func (s *Server) dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.repo.GetDashboardCounts(time.Now().In(s.config.Location))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events, err := s.repo.GetAuditEvents("", dashboardAuditEvents)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []db.AuditEvent{}
+	}
+	s.writeJSON(w, r, http.StatusOK, dashboardResponse{DashboardCounts: counts, RecentAudit: events})
+}
+
+// Lists the weekly timetable, filtered by the class, day, slot, subject and faculty parameters
+func (s *Server) adminTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class   string   `param:"class"`
+		Day     dayParam `param:"day"`
+		Slot    int      `param:"slot"`
+		Subject string   `param:"subject"`
+		Faculty string   `param:"faculty"`
+		Campus  string   `param:"campus"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	filter := db.TimetableFilter{
+		Class:   query.Class,
+		Day:     string(query.Day),
+		Slot:    query.Slot,
+		Subject: query.Subject,
+		Faculty: query.Faculty,
+		Campus:  query.Campus,
+	}
+	entries, err := s.repo.GetStatic(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	lang := calendar.Language(r.Header.Get("Accept-Language"))
+	named := make([]timetableEntry, 0, len(entries))
+	for _, entry := range entries {
+		named = append(named, timetableEntry{StaticEntry: entry, DayName: dayName(entry.Day, lang)})
+	}
+	w.Header().Set("Content-Language", lang)
+	s.writeJSON(w, r, http.StatusOK, named)
+}
+
+// A timetable entry with its day named in the language the client asked for
+type timetableEntry struct {
+	db.StaticEntry
+	DayName string `json:"dayName"`
+}
+
+// dayName names a day code of the static table, leaving unknown codes as they are
+func dayName(code string, lang string) string {
+	day, err := calendar.ParseDay(code)
+	if err != nil {
+		return code
+	}
+	return calendar.DayName(day, lang)
+}
+
+/*
+parseTimetablePath reads the class, day and slot path parameters of the
+timetable endpoints, accepting any day calendar.ParseDay does. On failure it
+has already written the error response.
+*/
+func parseTimetablePath(w http.ResponseWriter, r *http.Request) (class string, day string, slot int, ok bool) {
+	class = router.Param(r, "class")
+	weekday, err := calendar.ParseDay(router.Param(r, "day"))
+	day = calendar.DayCode(weekday)
+	if err != nil || !containsString(timetableDays, day) {
+		http.Error(w, "Invalid day value", http.StatusBadRequest)
+		return
+	}
+	slot, err = strconv.Atoi(router.Param(r, "slot"))
+	if err != nil {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	return class, day, slot, true
+}
+
+// The class lists are cached, here and by a CDN, so they have to be dropped when the timetable changes
+func (s *Server) timetableChanged() {
+	s.cache.Delete("slots")
+	s.cache.Delete("classes")
+	s.cache.Delete("subjects")
+	s.purge(surrogateSlots)
+}
+
+/*
+setTimetableHandler puts the subject parameter ("FREE" for a free period) and
+the optional faculty parameter in the period given by the path, replacing
+whatever was there, or only the version in If-Match.
+*/
+func (s *Server) setTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	class, day, slot, ok := parseTimetablePath(w, r)
+	if !ok {
+		return
+	}
+	var query struct {
+		Subject string `param:"subject,required"`
+		Faculty string `param:"faculty"`
+		Span    int    `param:"span,min=1"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	entry := db.StaticEntry{
+		Class:   class,
+		Day:     day,
+		Slot:    slot,
+		Faculty: query.Faculty,
+		Subject: query.Subject,
+		Span:    1,
+		Version: version,
+	}
+	if query.Span != 0 && query.Subject != "FREE" {
+		if query.Span > maxSpan {
+			http.Error(w, "Invalid span value", http.StatusBadRequest)
+			return
+		}
+		entry.Span = query.Span
+	}
+	if !s.checkSpan(w, entry) {
+		return
+	}
+	err := s.repo.SetStatic(entry)
+	if err != nil && err != db.ErrStaleVersion {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stale := err == db.ErrStaleVersion
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: class, Day: day, Slot: slot})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if stale && len(entries) == 0 {
+		http.Error(w, "The period has been deleted", http.StatusConflict)
+		return
+	}
+	if stale {
+		s.writeStale(w, r, entries[0], entries[0].Version)
+		return
+	}
+	if len(entries) > 0 {
+		entry = entries[0]
+	}
+	s.timetableChanged()
+	s.audit(r, auditSetTimetable, class+"/"+day+"/"+strconv.Itoa(slot), query.Subject+" "+entry.Faculty)
+	w.Header().Set("ETag", etag(entry.Version))
+	s.writeJSON(w, r, http.StatusOK, entry)
+}
+
+/*
+checkSpan makes sure that every slot entry takes exists and that it does not
+overlap another period of its class, lab or not. Setting FREE always fits. On
+failure it has already written the error response.
+*/
+func (s *Server) checkSpan(w http.ResponseWriter, entry db.StaticEntry) bool {
+	if entry.Subject == "FREE" {
+		return true
+	}
+	slots := s.repo.GetAllSlot()
+	for slot := entry.Slot; slot < entry.Slot+entry.Span; slot++ {
+		if !containsInt(slots, slot) {
+			http.Error(w, "Slot "+strconv.Itoa(slot)+" does not exist", http.StatusBadRequest)
+			return false
+		}
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: entry.Class, Day: entry.Day})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	for _, other := range entries {
+		if other.Slot == entry.Slot || other.Subject == "FREE" {
+			continue
+		}
+		if other.Slot < entry.Slot+entry.Span && entry.Slot < other.Slot+other.Span {
+			http.Error(w, "Overlaps "+other.Subject+" at slot "+strconv.Itoa(other.Slot), http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) deleteTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	class, day, slot, ok := parseTimetablePath(w, r)
+	if !ok {
+		return
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: class, Day: day, Slot: slot})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteStatic(class, day, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such period", http.StatusNotFound)
+		return
+	}
+	s.timetableChanged()
+	target := class + "/" + day + "/" + strconv.Itoa(slot)
+	if len(entries) > 0 {
+		s.trash(r, db.TrashTimetable, target, entries[0])
+	}
+	s.audit(r, auditDeleteTimetable, target, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists bookings, filtered by the class, faculty, startDate and endDate parameters
+func (s *Server) adminBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, ok := s.parseBookingFilter(w, r)
+	if !ok {
+		return
+	}
+	bookings, err := s.repo.GetBookings(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeBookings(w, r, bookings)
+}
+
+// parseBookingFilter reads the class, faculty, startDate and endDate parameters. On failure it has already written the error response.
+func (s *Server) parseBookingFilter(w http.ResponseWriter, r *http.Request) (db.BookingFilter, bool) {
+	var query struct {
+		Class     string    `param:"class"`
+		Faculty   string    `param:"faculty"`
+		StartDate time.Time `param:"startDate"`
+		EndDate   time.Time `param:"endDate"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return db.BookingFilter{}, false
+	}
+	return db.BookingFilter{Class: query.Class, Faculty: query.Faculty, StartDate: query.StartDate, EndDate: query.EndDate}, true
+}
+
+func (s *Server) writeBookings(w http.ResponseWriter, r *http.Request, bookings []db.BookingRecord) {
+	if bookings == nil {
+		bookings = []db.BookingRecord{}
+	}
+	s.writeJSON(w, r, http.StatusOK, bookings)
+}
+
+/*
+adminCancelBookingsHandler cancels every booking matching the same parameters
+as the list, at least one of which has to be given, and responds with them.
+With dryRun=true it only lists them.
+*/
+func (s *Server) adminCancelBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, ok := s.parseBookingFilter(w, r)
+	if !ok {
+		return
+	}
+	if filter == (db.BookingFilter{}) {
+		http.Error(w, "Give a class, faculty, startDate or endDate", http.StatusBadRequest)
+		return
+	}
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+	bookings, err := s.repo.GetBookings(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if dryRun {
+		if bookings == nil {
+			bookings = []db.BookingRecord{}
+		}
+		s.writePreview(w, r, bookings, nil)
+		return
+	}
+	for idx, booking := range bookings {
+		err = s.cancelBooking(booking.Class, booking.Date, booking.Slot)
+		if err != nil {
+			// Report what was cancelled before the failure, which is not undone
+			s.logger.Println("Error cancelling bookings", err)
+			bookings = bookings[:idx]
+			break
+		}
+		target := booking.Class + "/" + booking.Date.Format(calendar.DateLayout) + "/" + strconv.Itoa(booking.Slot)
+		s.trash(r, db.TrashBooking, target, booking)
+		s.audit(r, auditCancelBooking, target, "")
+	}
+	s.writeBookings(w, r, bookings)
+}
+
+// Cancels anyone's booking, unlike /db/cancelBooking which is meant for the faculty who made it
+func (s *Server) adminCancelBookingHandler(w http.ResponseWriter, r *http.Request) {
+	class := router.Param(r, "class")
+	date, err := calendar.ParseDate(router.Param(r, "date"), s.config.Location)
+	if err != nil {
+		http.Error(w, "Invalid date value", http.StatusBadRequest)
+		return
+	}
+	slot, err := strconv.Atoi(router.Param(r, "slot"))
+	if err != nil {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Class: class, StartDate: date, EndDate: date})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	err = s.cancelBookingVersion(class, date, slot, version)
+	if err == db.ErrStaleVersion {
+		s.writeBookingChanged(w, r, class, date, slot)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target := class + "/" + date.Format(calendar.DateLayout) + "/" + strconv.Itoa(slot)
+	for _, booking := range bookings {
+		if booking.Slot == slot {
+			s.trash(r, db.TrashBooking, target, booking)
+		}
+	}
+	s.audit(r, auditCancelBooking, target, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists users with an active session; q searches mails and names
+func (s *Server) adminUsersHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, 50)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Q string `param:"q"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	users, err := s.repo.GetActiveUsers(query.Q, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []db.UserSummary{}
+	}
+	s.writeJSON(w, r, http.StatusOK, users)
+}
+
+// The latest admin changes, only those of the action parameter when given, streamed as they are read
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseStreamLimit(r, 50)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Action string `param:"action"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	stream := newJSONStream(w)
+	err := s.repo.EachAuditEvent(query.Action, limit, func(event db.AuditEvent) error {
+		return stream.add(event)
+	})
+	s.endStream(stream, err)
+}
+
+/*
+parseAnnouncement reads the title, body, startsAt and expiresAt parameters of
+an announcement, from the query string or a form body. The times are RFC 3339;
+startsAt defaults to now and without expiresAt the announcement stays up
+until it is deleted.
+*/
+func (s *Server) parseAnnouncement(w http.ResponseWriter, r *http.Request) (db.Announcement, bool) {
+	var query struct {
+		Title     string    `param:"title,required,max=128"`
+		Body      string    `param:"body"`
+		StartsAt  time.Time `param:"startsAt,instant"`
+		ExpiresAt time.Time `param:"expiresAt,instant"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return db.Announcement{}, false
+	}
+	now := time.Now()
+	announcement := db.Announcement{
+		Title:     query.Title,
+		Body:      query.Body,
+		StartsAt:  now,
+		CreatedAt: now,
+	}
+	if !query.StartsAt.IsZero() {
+		announcement.StartsAt = query.StartsAt
+	}
+	if !query.ExpiresAt.IsZero() {
+		if !query.ExpiresAt.After(announcement.StartsAt) {
+			http.Error(w, "Invalid expiresAt value", http.StatusBadRequest)
+			return announcement, false
+		}
+		announcement.ExpiresAt = &query.ExpiresAt
+	}
+	return announcement, true
+}
+
+func (s *Server) writeAnnouncements(w http.ResponseWriter, r *http.Request, activeAt time.Time) {
+	announcements, err := s.repo.GetAnnouncements(activeAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if announcements == nil {
+		announcements = []db.Announcement{}
+	}
+	s.writeJSON(w, r, http.StatusOK, announcements)
+}
+
+// The announcements showing right now, for everyone
+func (s *Server) announcementsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeAnnouncements(w, r, time.Now())
+}
+
+// Every announcement, including scheduled and expired ones
+func (s *Server) listAnnouncementsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeAnnouncements(w, r, time.Time{})
+}
+
+func (s *Server) createAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	announcement, ok := s.parseAnnouncement(w, r)
+	if !ok {
+		return
+	}
+	id, err := s.repo.CreateAnnouncement(announcement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	announcement.ID = id
+	s.audit(r, auditCreateAnnouncement, strconv.FormatInt(id, 10), announcement.Title)
+	s.postToTeams("", i18n.M("%s", announcement.Title), i18n.M("%s", announcement.Body))
+	s.writeJSON(w, r, http.StatusCreated, announcement)
+}
+
+func (s *Server) updateAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	announcement, ok := s.parseAnnouncement(w, r)
+	if !ok {
+		return
+	}
+	announcement.ID = id
+	announcement.Version, ok = ifMatch(w, r)
+	if !ok {
+		return
+	}
+	err = s.repo.UpdateAnnouncement(announcement)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such announcement", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != db.ErrStaleVersion {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stale := err == db.ErrStaleVersion
+	current, err := s.announcement(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if current == nil {
+		http.Error(w, "The announcement has been deleted", http.StatusConflict)
+		return
+	}
+	if stale {
+		s.writeStale(w, r, *current, current.Version)
+		return
+	}
+	s.audit(r, auditUpdateAnnouncement, strconv.FormatInt(id, 10), announcement.Title)
+	w.Header().Set("ETag", etag(current.Version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// announcement finds any announcement by ID, nil when there is none
+func (s *Server) announcement(id int64) (*db.Announcement, error) {
+	announcements, err := s.repo.GetAnnouncements(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for idx := range announcements {
+		if announcements[idx].ID == id {
+			return &announcements[idx], nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) deleteAnnouncementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	announcement, err := s.announcement(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteAnnouncement(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such announcement", http.StatusNotFound)
+		return
+	}
+	if announcement != nil {
+		s.trash(r, db.TrashAnnouncement, strconv.FormatInt(id, 10), *announcement)
+	}
+	s.audit(r, auditDeleteAnnouncement, strconv.FormatInt(id, 10), "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+var startedAt = time.Now()
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("uptime", expvar.Func(func() interface{} {
+		return time.Since(startedAt).Round(time.Second).String()
+	}))
+}
+
+/*
+DebugHandler serves the pprof profiles under /debug/pprof/ and the expvar
+runtime stats (memstats, goroutines, uptime, query latencies, connections) under
+/debug/vars. It has no authentication of its own: main either serves it on a
+separate, private address or the server mounts it under /admin behind the
+admin key.
+*/
+func DebugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+)
+
+// How often a user gets a digest, see NotificationPreferences.Digest
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// Where a digest goes, see NotificationPreferences.DigestVia
+const (
+	digestPush = "push"
+	digestMail = "mail"
+)
+
+// Layout of the days in a digest
+const digestDayLayout = "Mon 2 Jan"
+
+// digestDay names date in a digest in lang, with the day named in it
+func digestDay(date time.Time, lang string) string {
+	if lang == i18n.English {
+		return date.Format(digestDayLayout)
+	}
+	return calendar.DayName(date.Weekday(), lang) + " " + date.Format("2/1")
+}
+
+/*
+digest writes what mail has on dates, the days a digest covers: the periods
+of the subjects they take and their custom entries, the rooms they booked and
+their assignments due by the end of the last day, in lang. It returns "" when
+there is nothing.
+*/
+func (s *Server) digest(mail string, preferences Preferences, dates []time.Time, lang string) (string, error) {
+	subjects, electives, err := s.userSubjects(mail, preferences)
+	if err != nil {
+		return "", err
+	}
+	slotTimes, err := s.repo.GetSlotTimes()
+	if err != nil {
+		return "", err
+	}
+	clocks := make(map[int]string)
+	for _, slotTime := range slotTimes {
+		clocks[slotTime.ID] = slotTime.Start
+	}
+	entries, err := s.repo.GetCustomEntries(mail)
+	if err != nil {
+		return "", err
+	}
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Faculty: mail, StartDate: dates[0], EndDate: dates[len(dates)-1]})
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, date := range dates {
+		var day []string
+		periods, err := s.subjectPeriods(subjects, electives, date)
+		if err != nil {
+			return "", err
+		}
+		for _, period := range periods {
+			day = append(day, strings.TrimSpace(clocks[period.Slot]+" "+i18n.Sprintf(lang, "%s in %s", period.Subject, period.Class)))
+		}
+		for _, entry := range entries {
+			if entry.Day == calendar.DayCode(date.Weekday()) {
+				day = append(day, entry.StartTime+" "+entry.Title)
+			}
+		}
+		for _, booking := range bookings {
+			if booking.Date.Equal(date) {
+				day = append(day, strings.TrimSpace(clocks[booking.Slot]+" "+
+					i18n.Sprintf(lang, "%s booked for %s", booking.Class, booking.Subject)))
+			}
+		}
+		if len(day) > 0 {
+			lines = append(lines, digestDay(date, lang)+":")
+			for _, item := range day {
+				lines = append(lines, "  "+item)
+			}
+		}
+	}
+
+	assignments, err := s.myAssignments(mail)
+	if err != nil {
+		return "", err
+	}
+	// Dates are midnight UTC, see calendar.Date
+	last := dates[len(dates)-1]
+	end := time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, s.config.Location)
+	var due []string
+	for _, assignment := range assignments {
+		if assignment.Due.Before(end) {
+			dueAt := assignment.Due.In(s.config.Location)
+			due = append(due, "  "+assignment.Subject+": "+assignment.Title+", "+
+				digestDay(dueAt, lang)+" "+dueAt.Format("15:04"))
+		}
+	}
+	if len(due) > 0 {
+		lines = append(lines, i18n.Sprintf(lang, "Due:"))
+		lines = append(lines, due...)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+/*
+SendDigests sends the users who asked for one their digest of the days after
+now: a daily one of tomorrow, and on Config.WeeklyDigestDay a weekly one of
+the next seven days. Those who asked for it by mail get it from
+Config.Mailer, in the language of their preferences. Empty digests are not
+sent. It returns how many it sent.
+*/
+func (s *Server) SendDigests(now time.Time) int {
+	all, err := s.repo.GetAllPreferences()
+	if err != nil {
+		s.logger.Println("Error reading preferences for digests", err)
+		return 0
+	}
+	tomorrow := calendar.Date(now, s.config.Location).AddDate(0, 0, 1)
+	sent := 0
+	for mail, data := range all {
+		var preferences Preferences
+		if json.Unmarshal([]byte(data), &preferences) != nil || preferences.Notifications == nil {
+			continue
+		}
+		lang := preferences.Language
+		if lang == "" {
+			lang = i18n.English
+		}
+		var dates []time.Time
+		title := i18n.Sprintf(lang, "Tomorrow, %s", digestDay(tomorrow, lang))
+		switch preferences.Notifications.Digest {
+		case digestDaily:
+			dates = []time.Time{tomorrow}
+		case digestWeekly:
+			if now.In(s.config.Location).Weekday() != s.config.WeeklyDigestDay {
+				continue
+			}
+			for day := 0; day < 7; day++ {
+				dates = append(dates, tomorrow.AddDate(0, 0, day))
+			}
+			title = i18n.Sprintf(lang, "Your week from %s", digestDay(tomorrow, lang))
+		default:
+			continue
+		}
+		body, err := s.digest(mail, preferences, dates, lang)
+		if err != nil {
+			s.logger.Println("Error writing the digest of", mail, err)
+			continue
+		}
+		if body == "" {
+			continue
+		}
+		notifier := s.config.Notifier
+		if preferences.Notifications.DigestVia == digestMail {
+			if s.config.Mailer == nil {
+				s.logger.Println("No mail server configured, pushing the digest of", mail)
+			} else {
+				notifier = s.config.Mailer
+			}
+		}
+		notifier.Notify(notify.Message{To: mail, Kind: notify.KindDigest, Title: title, Body: body})
+		sent++
+	}
+	return sent
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/jobs"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// What a directory sync changed in the users of a provider
+type directorySyncResult struct {
+	Provider string `json:"provider"`
+	Updated  int    `json:"updated"`
+	Removed  int    `json:"removed"`
+}
+
+/*
+saveUser records the user logging in with identity in the user directory and
+returns their ID. A failure is only logged and returns 0: the session works
+without it.
+*/
+func (s *Server) saveUser(provider string, identity auth.Identity, at time.Time) int64 {
+	mail := identity.Mail
+	if mail == "" {
+		mail = identity.UserPrincipalName
+	}
+	id, err := s.repo.SaveUser(db.User{
+		Provider:    provider,
+		ExternalID:  identity.ID,
+		Mail:        mail,
+		DisplayName: identity.DisplayName,
+		GivenName:   identity.GivenName,
+		Surname:     identity.Surname,
+		JobTitle:    identity.JobTitle,
+		LastLoginAt: &at,
+	})
+	if err != nil {
+		s.logger.Println("Error saving user", identity.ID, err)
+		return 0
+	}
+	return id
+}
+
+// syncDirectory brings the users of one provider up to date from where its last sync stopped
+func (s *Server) syncDirectory(ctx context.Context, name string, directory auth.Directory) (directorySyncResult, error) {
+	result := directorySyncResult{Provider: name}
+	deltaLink, err := s.repo.GetDirectoryDelta(name)
+	if err != nil {
+		return result, err
+	}
+	deltaLink, err = directory.SyncDirectory(ctx, deltaLink, func(users []auth.DirectoryUser) error {
+		for _, user := range users {
+			if user.Removed {
+				removed, err := s.repo.DisableUser(name, user.ID)
+				if err != nil {
+					return err
+				}
+				result.Removed += int(removed)
+				continue
+			}
+			mail := user.Mail
+			if mail == "" {
+				mail = user.UserPrincipalName
+			}
+			_, err := s.repo.SaveUser(db.User{
+				Provider:    name,
+				ExternalID:  user.ID,
+				Mail:        mail,
+				DisplayName: user.DisplayName,
+				GivenName:   user.GivenName,
+				Surname:     user.Surname,
+				JobTitle:    user.JobTitle,
+			})
+			if err != nil {
+				return err
+			}
+			result.Updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, s.repo.SaveDirectoryDelta(name, deltaLink, time.Now())
+}
+
+/*
+syncDirectories syncs the users of every provider with directory sync on, one
+after the other; progress counts the providers. The first failure stops it, the
+providers synced before keep their changes.
+*/
+func (s *Server) syncDirectories(ctx context.Context, progress func(done int, total int)) ([]directorySyncResult, error) {
+	var directories []auth.Provider
+	for _, provider := range s.config.Providers {
+		if _, ok := provider.(auth.Directory); ok {
+			directories = append(directories, provider)
+		}
+	}
+	results := []directorySyncResult{}
+	for i, provider := range directories {
+		progress(i, len(directories))
+		result, err := s.syncDirectory(ctx, provider.Name(), provider.(auth.Directory))
+		if errors.Is(err, auth.ErrNoDirectory) {
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	progress(len(directories), len(directories))
+	return results, nil
+}
+
+func (s *Server) syncDirectoriesTask() jobs.TaskFunc {
+	return func(ctx context.Context, progress func(done int, total int)) (interface{}, error) {
+		return s.syncDirectories(ctx, progress)
+	}
+}
+
+func (s *Server) writeUsers(w http.ResponseWriter, r *http.Request, v interface{}) {
+	s.writeJSON(w, r, http.StatusOK, v)
+}
+
+// Lists the users of the directory, removed ones included; q searches mails and names
+func (s *Server) directoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, 50)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Q string `param:"q"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	users, err := s.repo.GetUsers(db.UserFilter{Query: query.Q, Limit: limit})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []db.User{}
+	}
+	s.writeUsers(w, r, users)
+}
+
+func (s *Server) directoryUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	user, err := s.repo.GetUser(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such user", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeUsers(w, r, user)
+}
+
+// Starts a directory sync in the background; the task's result has a directorySyncResult per provider
+func (s *Server) syncDirectoryHandler(w http.ResponseWriter, r *http.Request) {
+	s.audit(r, auditSyncDirectory, "", "")
+	s.submitTask(w, r, taskSyncDirectory, s.syncDirectoriesTask())
+}
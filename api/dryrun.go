@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+/*
+What a bulk admin operation would do when called with dryRun=true: the same
+checks run, nothing is written, and the response lists the changes it would
+make and the conflicts it found.
+*/
+type preview struct {
+	DryRun    bool        `json:"dryRun"`
+	Changes   interface{} `json:"changes"`
+	Conflicts []string    `json:"conflicts"`
+}
+
+func newPreview(changes interface{}, conflicts []string) preview {
+	if conflicts == nil {
+		conflicts = []string{}
+	}
+	return preview{DryRun: true, Changes: changes, Conflicts: conflicts}
+}
+
+// parseDryRun reads the dryRun parameter. On failure it has already written the error response.
+func parseDryRun(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	return parseFlag(w, r, "dryRun")
+}
+
+// parseFlag reads a boolean query parameter, false when it is not given. On failure it has already written the error response.
+func parseFlag(w http.ResponseWriter, r *http.Request, name string) (bool, bool) {
+	flagStr := r.URL.Query().Get(name)
+	if flagStr == "" {
+		return false, true
+	}
+	flag, err := strconv.ParseBool(flagStr)
+	if err != nil {
+		http.Error(w, "Invalid "+name+" value", http.StatusBadRequest)
+		return false, false
+	}
+	return flag, true
+}
+
+func (s *Server) writePreview(w http.ResponseWriter, r *http.Request, changes interface{}, conflicts []string) {
+	s.writeJSON(w, r, http.StatusOK, newPreview(changes, conflicts))
+}
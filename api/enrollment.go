@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Largest accepted enrollment import, in bytes
+const maxEnrollmentImportSize = 1 << 20
+
+// The columns of an enrollment import, in order
+var enrollmentImportHeader = []string{"subject", "mail"}
+
+// What an enrollment import replaced
+type enrollmentImport struct {
+	Subjects    []string `json:"subjects"`
+	Enrollments int      `json:"enrollments"`
+}
+
+type myTimetableResponse struct {
+	Date    time.Time   `json:"date"`
+	Periods []gapPeriod `json:"periods"`
+	// The user's own entries on that day of the week
+	Custom []db.CustomEntry `json:"custom"`
+}
+
+/*
+userSubjects returns the subjects mail takes: the subjects of their
+preferences and the electives they are enrolled in, without the electives
+they listed but others were enrolled in. The electives they are enrolled in
+are also returned by themselves.
+*/
+func (s *Server) userSubjects(mail string, preferences Preferences) ([]string, map[string]bool, error) {
+	mail = strings.ToLower(mail)
+	enrolled, err := s.repo.GetEnrollments(db.EnrollmentFilter{Student: mail})
+	if err != nil {
+		return nil, nil, err
+	}
+	electives := make(map[string]bool)
+	for _, enrollment := range enrolled {
+		electives[enrollment.Subject] = true
+	}
+	var subjects []string
+	for _, subject := range preferences.Subjects {
+		if containsString(subjects, subject) {
+			continue
+		}
+		if !electives[subject] {
+			others, err := s.repo.GetEnrollments(db.EnrollmentFilter{Subject: subject})
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(others) > 0 {
+				continue
+			}
+		}
+		subjects = append(subjects, subject)
+	}
+	for _, enrollment := range enrolled {
+		if !containsString(subjects, enrollment.Subject) {
+			subjects = append(subjects, enrollment.Subject)
+		}
+	}
+	return subjects, electives, nil
+}
+
+/*
+myTimetableHandler answers with the periods the user attends on day (a date,
+today by default): those of the subjects they take, see userSubjects, as
+overridden that day, and their custom entries of that day of the week.
+Periods of the electives they are enrolled in are marked elective.
+*/
+func (s *Server) myTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Date time.Time `param:"day"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	date := query.Date
+	if date.IsZero() {
+		date = calendar.Today(s.config.Location)
+	}
+	subjects, electives, err := s.userSubjects(currentSession(r).Mail, s.requestPreferences(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	periods, err := s.subjectPeriods(subjects, electives, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries, err := s.repo.GetCustomEntries(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := myTimetableResponse{Date: date, Periods: periods, Custom: []db.CustomEntry{}}
+	if response.Periods == nil {
+		response.Periods = []gapPeriod{}
+	}
+	for _, entry := range entries {
+		if entry.Day == calendar.DayCode(date.Weekday()) {
+			response.Custom = append(response.Custom, entry)
+		}
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+}
+
+// Lists the enrollments of the subject and student parameters, every enrollment without them
+func (s *Server) enrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Subject string `param:"subject"`
+		Student string `param:"student"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	enrollments, err := s.repo.GetEnrollments(db.EnrollmentFilter{Subject: query.Subject,
+		Student: strings.ToLower(query.Student)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if enrollments == nil {
+		enrollments = []db.Enrollment{}
+	}
+	s.writeJSON(w, r, http.StatusOK, enrollments)
+}
+
+// parseEnrollmentImport reads the CSV of an enrollment import, checking its subjects against subjects
+func parseEnrollmentImport(body io.Reader, subjects []string) ([]db.Enrollment, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = len(enrollmentImportHeader)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil || strings.Join(header, ",") != strings.Join(enrollmentImportHeader, ",") {
+		return nil, errors.New("The first line must be " + strings.Join(enrollmentImportHeader, ","))
+	}
+	var enrollments []db.Enrollment
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		enrollment := db.Enrollment{Subject: record[0], Student: strings.ToLower(record[1])}
+		if !containsString(subjects, enrollment.Subject) {
+			return nil, errors.New("Line " + strconv.Itoa(line) + ": no such subject " + enrollment.Subject)
+		}
+		if !validMail(enrollment.Student) {
+			return nil, errors.New("Line " + strconv.Itoa(line) + ": invalid mail " + record[1])
+		}
+		enrollments = append(enrollments, enrollment)
+	}
+	if len(enrollments) == 0 {
+		return nil, errors.New("No enrollments to import")
+	}
+	return enrollments, nil
+}
+
+/*
+importEnrollmentsHandler takes a CSV body with the enrollmentImportHeader
+columns, one student of an elective per row. The electives in it get exactly
+the students listed, replacing who was enrolled before; other subjects are
+left as they are. Either every row is imported or, on the first bad one, none.
+*/
+func (s *Server) importEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	enrollments, err := parseEnrollmentImport(io.LimitReader(r.Body, maxEnrollmentImportSize), s.repo.GetAllSubject())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result := enrollmentImport{Subjects: []string{}, Enrollments: len(enrollments)}
+	for _, enrollment := range enrollments {
+		if !containsString(result.Subjects, enrollment.Subject) {
+			result.Subjects = append(result.Subjects, enrollment.Subject)
+		}
+	}
+	err = s.repo.SetEnrollments(result.Subjects, enrollments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditImportEnrollments, strings.Join(result.Subjects, ","),
+		strconv.Itoa(len(enrollments))+" enrollments")
+	s.writeJSON(w, r, http.StatusOK, result)
+}
+
+// Removes the enrollments of an elective, whose periods every student taking it attends again
+func (s *Server) deleteEnrollmentsHandler(w http.ResponseWriter, r *http.Request) {
+	subject := router.Param(r, "subject")
+	rowsAffected, err := s.repo.DeleteEnrollments(subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No enrollments in "+subject, http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteEnrollments, subject, strconv.FormatInt(rowsAffected, 10)+" enrollments")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest accepted equipment ID in bytes, the name and kind are bounded by their params
+const maxEquipmentIDLength = 32
+
+// An item of the inventory with its reservations on the asked date
+type equipmentEntry struct {
+	db.Equipment
+	Reservations []db.EquipmentReservation `json:"reservations,omitempty"`
+}
+
+// The equipment reserved for or released from an existing booking
+type equipmentParams struct {
+	slotParams
+	Equipment []string `param:"equipment,required"`
+}
+
+// uniqueStrings drops the repeats of list, like an equipment ID asked for twice
+func uniqueStrings(list []string) []string {
+	var unique []string
+	for _, item := range list {
+		if !containsString(unique, item) {
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+/*
+checkEquipment tells whether every piece of ids exists and is free in slots on
+date. When not it has already answered the request.
+*/
+func (s *Server) checkEquipment(w http.ResponseWriter, ids []string, date time.Time, slots []int) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	equipment, err := s.repo.GetEquipment()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	known := make(map[string]bool)
+	for _, item := range equipment {
+		known[item.ID] = true
+	}
+	for _, id := range ids {
+		if !known[id] {
+			http.Error(w, "No such equipment "+id, http.StatusNotFound)
+			return false
+		}
+	}
+	reservations, err := s.repo.GetEquipmentReservations(date, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	for _, reservation := range reservations {
+		if containsString(ids, reservation.Equipment) && containsInt(slots, reservation.Slot) {
+			http.Error(w, reservation.Equipment+" is reserved in "+reservation.Class+" in slot "+
+				strconv.Itoa(reservation.Slot), http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+/*
+holdEquipment reserves ids for the fresh booking of class in slots on date.
+When someone took one of them in the meantime the booking is cancelled again
+so that it is not left without what it needs.
+*/
+func (s *Server) holdEquipment(class string, date time.Time, slots []int, ids []string) bool {
+	var reservations []db.EquipmentReservation
+	for _, slot := range slots {
+		for _, id := range ids {
+			reservations = append(reservations, db.EquipmentReservation{Equipment: id, Class: class, Date: date, Slot: slot})
+		}
+	}
+	if len(reservations) == 0 {
+		return true
+	}
+	err := s.repo.ReserveEquipment(reservations)
+	if err == nil {
+		return true
+	}
+	s.logger.Println(err)
+	for _, slot := range slots {
+		if err := s.repo.CancelBooking(class, date, slot); err != nil {
+			s.logger.Println(err)
+		}
+	}
+	return false
+}
+
+// Lists the inventory, with the reservations on date (in slot when given) when date is given
+func (s *Server) equipmentHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Date time.Time `param:"date"`
+		Slot int       `param:"slot"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	equipment, err := s.repo.GetEquipment()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entries := []equipmentEntry{}
+	for _, item := range equipment {
+		entries = append(entries, equipmentEntry{Equipment: item})
+	}
+	if !query.Date.IsZero() {
+		if query.Slot != 0 && !containsInt(s.repo.GetAllSlot(), query.Slot) {
+			http.Error(w, "Invalid slot value", http.StatusBadRequest)
+			return
+		}
+		reservations, err := s.repo.GetEquipmentReservations(query.Date, query.Slot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for idx := range entries {
+			for _, reservation := range reservations {
+				if reservation.Equipment == entries[idx].ID {
+					entries[idx].Reservations = append(entries[idx].Reservations, reservation)
+				}
+			}
+		}
+	}
+	s.writeJSON(w, r, http.StatusOK, entries)
+}
+
+// Reserves more equipment for a booking that already exists
+func (s *Server) reserveEquipmentHandler(w http.ResponseWriter, r *http.Request) {
+	var query equipmentParams
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	class, date, slot := query.Class, query.Date, query.Slot
+	ids := uniqueStrings(query.Equipment)
+	if !s.checkEquipment(w, ids, date, []int{slot}) {
+		return
+	}
+	var reservations []db.EquipmentReservation
+	for _, id := range ids {
+		reservations = append(reservations, db.EquipmentReservation{Equipment: id, Class: class, Date: date, Slot: slot})
+	}
+	err := s.repo.ReserveEquipment(reservations)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No such booking", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, db.ErrEquipmentReserved) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, insertResponse{Inserted: true})
+}
+
+// Gives back equipment a booking no longer needs
+func (s *Server) releaseEquipmentHandler(w http.ResponseWriter, r *http.Request) {
+	var query equipmentParams
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	date, slot := query.Date, query.Slot
+	ids := uniqueStrings(query.Equipment)
+	var released int64
+	for _, id := range ids {
+		rowsAffected, err := s.repo.ReleaseEquipment(id, date, slot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		released += rowsAffected
+	}
+	if released == 0 {
+		http.Error(w, "No such reservation", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Adds a piece of equipment to the inventory or updates it
+func (s *Server) setEquipmentHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Name string `param:"name,required,max=64"`
+		Kind string `param:"kind,required,max=32"`
+		Home string `param:"home"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	equipment := db.Equipment{ID: router.Param(r, "id"), Name: query.Name, Kind: query.Kind, Home: query.Home}
+	if equipment.ID == "" || len(equipment.ID) > maxEquipmentIDLength || strings.Contains(equipment.ID, ",") {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	if equipment.Home != "" && !containsString(s.repo.GetAllClass(), equipment.Home) {
+		http.Error(w, "Invalid home value", http.StatusBadRequest)
+		return
+	}
+	err := s.repo.SetEquipment(equipment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditSetEquipment, equipment.ID, equipment.Kind+" "+equipment.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Removes a piece of equipment and its reservations
+func (s *Server) deleteEquipmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	rowsAffected, err := s.repo.DeleteEquipment(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such equipment", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteEquipment, id, "")
+	w.WriteHeader(http.StatusNoContent)
+}
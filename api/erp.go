@@ -0,0 +1,367 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/erp"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest subject code and faculty mail the database takes, in bytes
+const (
+	maxSubjectIDLength = 8
+	maxFacultyIDLength = 254
+)
+
+/*
+What an ERP import changed, or would change on a dry run: how many classrooms,
+courses and faculty members it added or updated, the diff of the timetable of
+the classrooms it has periods in, and what it left alone and why.
+*/
+type importResult struct {
+	Importer   string        `json:"importer"`
+	DryRun     bool          `json:"dryRun"`
+	Classrooms int           `json:"classrooms"`
+	Courses    int           `json:"courses"`
+	Faculty    int           `json:"faculty"`
+	Timetable  timetableDiff `json:"timetable"`
+	// The timetable version saved before the timetable changed, 0 when it did not
+	Snapshot  int64     `json:"snapshot,omitempty"`
+	Conflicts []string  `json:"conflicts"`
+	At        time.Time `json:"at"`
+}
+
+type importerStatus struct {
+	Name    string        `json:"name"`
+	LastRun *importResult `json:"lastRun"`
+}
+
+// The last import of each importer, dry runs left out
+type importRuns struct {
+	mu   sync.Mutex
+	last map[string]importResult
+}
+
+func (runs *importRuns) set(result importResult) {
+	runs.mu.Lock()
+	defer runs.mu.Unlock()
+	if runs.last == nil {
+		runs.last = make(map[string]importResult)
+	}
+	runs.last[result.Importer] = result
+}
+
+func (runs *importRuns) get(name string) (importResult, bool) {
+	runs.mu.Lock()
+	defer runs.mu.Unlock()
+	result, ok := runs.last[name]
+	return result, ok
+}
+
+func (s *Server) importer(name string) erp.Importer {
+	for _, importer := range s.config.Importers {
+		if importer.Name() == name {
+			return importer
+		}
+	}
+	return nil
+}
+
+// importSlots maps period to the slot it starts in and how many it takes, by its slot or its times
+func importSlots(period erp.Period, slots []db.SlotTime) (int, int, error) {
+	if period.Slot != 0 {
+		for _, slot := range slots {
+			if slot.ID == period.Slot {
+				return period.Slot, 1, nil
+			}
+		}
+		return 0, 0, fmt.Errorf("no slot %d", period.Slot)
+	}
+	first, span := 0, 0
+	for _, slot := range slots {
+		if slot.Start == period.Start {
+			first = slot.ID
+		}
+		if first != 0 && slot.Start < period.End {
+			span++
+		}
+	}
+	if first == 0 || span == 0 {
+		return 0, 0, fmt.Errorf("no slot starts at %q", period.Start)
+	}
+	return first, span, nil
+}
+
+/*
+importTimetable turns the periods of an import into the timetable entries
+they make. Only the classrooms with a period are touched: their current
+periods that are not in the import become FREE. Periods with an unknown day,
+slot, course or faculty member, and those given twice, are left out and
+described in the conflicts.
+*/
+func (s *Server) importTimetable(periods []erp.Period, subjects map[string]string, faculty map[string]string) ([]db.StaticEntry, []db.StaticEntry, []string, error) {
+	slots, err := s.repo.GetSlotTimes()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var conflicts []string
+	var entries []db.StaticEntry
+	classes := make(map[string]bool)
+	periodKeys := make(map[string]bool)
+	for idx, period := range periods {
+		describe := fmt.Sprintf("Period %d (%s %s %s)", idx+1, period.Class, period.Day, period.Course)
+		weekday, err := calendar.ParseDay(period.Day)
+		if period.Class == "" || len(period.Class) > maxClassIDLength {
+			conflicts = append(conflicts, describe+": invalid class")
+			continue
+		}
+		if err != nil {
+			conflicts = append(conflicts, describe+": invalid day")
+			continue
+		}
+		// The classroom is in the import even when this period of it is not
+		classes[period.Class] = true
+		slot, span, err := importSlots(period, slots)
+		if err != nil {
+			conflicts = append(conflicts, describe+": "+err.Error())
+			continue
+		}
+		if _, ok := subjects[period.Course]; !ok && period.Course != "FREE" {
+			conflicts = append(conflicts, describe+": no such course")
+			continue
+		}
+		if _, ok := faculty[period.Faculty]; !ok && period.Faculty != "" {
+			conflicts = append(conflicts, describe+": no such faculty "+period.Faculty)
+			continue
+		}
+		entry := db.StaticEntry{Class: period.Class, Day: calendar.DayCode(weekday), Slot: slot,
+			Faculty: period.Faculty, Subject: period.Course, Span: span}
+		key := entry.Class + "/" + entry.Day + "/" + strconv.Itoa(entry.Slot)
+		if periodKeys[key] {
+			conflicts = append(conflicts, describe+": "+key+" is in the import twice")
+			continue
+		}
+		periodKeys[key] = true
+		entries = append(entries, entry)
+	}
+
+	current, err := s.repo.GetStatic(db.TimetableFilter{})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var before []db.StaticEntry
+	for _, entry := range current {
+		if !classes[entry.Class] {
+			continue
+		}
+		key := entry.Class + "/" + entry.Day + "/" + strconv.Itoa(entry.Slot)
+		if periodKeys[key] {
+			before = append(before, entry)
+		} else if entry.Subject != "FREE" {
+			before = append(before, entry)
+			entries = append(entries, db.StaticEntry{Class: entry.Class, Day: entry.Day, Slot: entry.Slot, Subject: "FREE"})
+		}
+	}
+	return before, entries, conflicts, nil
+}
+
+// bookingClashes describes the upcoming bookings entry would put a class on top of
+func bookingClashes(entry db.StaticEntry, bookings []db.BookingRecord) []string {
+	var clashes []string
+	if entry.Subject == "FREE" {
+		return nil
+	}
+	for _, booking := range bookings {
+		if booking.Class == entry.Class && calendar.DayCode(booking.Date.Weekday()) == entry.Day &&
+			entry.Slot <= booking.Slot && booking.Slot < entry.Slot+max1(entry.Span) {
+			clashes = append(clashes, fmt.Sprintf("%s is booked by %s on %s, slot %d, so %s was not put there",
+				booking.Class, booking.Faculty, booking.Date.Format(calendar.DateLayout), booking.Slot, entry.Subject))
+		}
+	}
+	return clashes
+}
+
+/*
+runImport reads what importer holds and applies what differs: classrooms,
+courses and faculty members are added or updated, and the timetable of the
+classrooms in the import is made to match it. Periods that would take a slot
+booked from today on are left as they are and reported. The timetable is saved
+as a version before it changes. With dryRun nothing is written.
+*/
+func (s *Server) runImport(ctx context.Context, importer erp.Importer, actor string, dryRun bool) (importResult, error) {
+	result := importResult{Importer: importer.Name(), DryRun: dryRun, At: time.Now(),
+		Timetable: timetableDiff{Added: []db.StaticEntry{}, Removed: []db.StaticEntry{}, Changed: []timetableChange{}}}
+	snapshot, err := importer.Import(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	rooms, err := s.repo.GetClassrooms()
+	if err != nil {
+		return result, err
+	}
+	knownRooms := make(map[string]db.Classroom, len(rooms))
+	for _, room := range rooms {
+		knownRooms[room.ID] = room
+	}
+	var classrooms []db.Classroom
+	for _, room := range snapshot.Classrooms {
+		classroom := db.Classroom(room)
+		if classroom.ID == "" || len(classroom.ID) > maxClassIDLength || classroom.Capacity < 0 {
+			result.Conflicts = append(result.Conflicts, fmt.Sprintf("Classroom %q: invalid id or capacity", classroom.ID))
+			continue
+		}
+		if known, ok := knownRooms[classroom.ID]; !ok || known != classroom {
+			classrooms = append(classrooms, classroom)
+			knownRooms[classroom.ID] = classroom
+		}
+	}
+
+	catalog, err := s.repo.GetCatalog()
+	if err != nil {
+		return result, err
+	}
+	subjects := make(map[string]string, len(catalog.Subjects))
+	for _, subject := range catalog.Subjects {
+		subjects[subject.ID] = subject.Name
+	}
+	var courses []db.Named
+	for _, course := range snapshot.Courses {
+		if course.Code == "" || len(course.Code) > maxSubjectIDLength || course.Code == "FREE" || course.Title == "" {
+			result.Conflicts = append(result.Conflicts, fmt.Sprintf("Course %q: invalid code or title", course.Code))
+			continue
+		}
+		if name, ok := subjects[course.Code]; !ok || name != course.Title {
+			courses = append(courses, db.Named{ID: course.Code, Name: course.Title})
+			subjects[course.Code] = course.Title
+		}
+	}
+	faculty := make(map[string]string, len(catalog.Faculty))
+	for _, person := range catalog.Faculty {
+		faculty[person.ID] = person.Name
+	}
+	var people []db.Named
+	for _, person := range snapshot.Faculty {
+		if person.Mail == "" || len(person.Mail) > maxFacultyIDLength || person.Name == "" {
+			result.Conflicts = append(result.Conflicts, fmt.Sprintf("Faculty %q: invalid mail or name", person.Mail))
+			continue
+		}
+		if name, ok := faculty[person.Mail]; !ok || name != person.Name {
+			people = append(people, db.Named{ID: person.Mail, Name: person.Name})
+			faculty[person.Mail] = person.Name
+		}
+	}
+
+	var changed []db.StaticEntry
+	if snapshot.Timetable != nil {
+		before, after, conflicts, err := s.importTimetable(snapshot.Timetable, subjects, faculty)
+		if err != nil {
+			return result, err
+		}
+		result.Conflicts = append(result.Conflicts, conflicts...)
+		bookings, err := s.repo.GetBookings(db.BookingFilter{StartDate: calendar.Today(s.config.Location)})
+		if err != nil {
+			return result, err
+		}
+		diff := diffTimetables(before, after)
+		for _, entry := range diff.Added {
+			if clashes := bookingClashes(entry, bookings); clashes != nil {
+				result.Conflicts = append(result.Conflicts, clashes...)
+				continue
+			}
+			result.Timetable.Added = append(result.Timetable.Added, entry)
+			changed = append(changed, entry)
+		}
+		for _, change := range diff.Changed {
+			if clashes := bookingClashes(change.To, bookings); clashes != nil {
+				result.Conflicts = append(result.Conflicts, clashes...)
+				continue
+			}
+			result.Timetable.Changed = append(result.Timetable.Changed, change)
+			changed = append(changed, change.To)
+		}
+	}
+	result.Classrooms, result.Courses, result.Faculty = len(classrooms), len(courses), len(people)
+	if result.Conflicts == nil {
+		result.Conflicts = []string{}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	for _, classroom := range classrooms {
+		if err := s.repo.SetClassroom(classroom); err != nil {
+			return result, err
+		}
+	}
+	for _, course := range courses {
+		if err := s.repo.SetSubject(course.ID, course.Name); err != nil {
+			return result, err
+		}
+	}
+	for _, person := range people {
+		if err := s.repo.SetFaculty(person.ID, person.Name); err != nil {
+			return result, err
+		}
+	}
+	if len(changed) > 0 {
+		version, err := s.snapshotTimetableAs(actor, "", "Before importing from "+importer.Name())
+		if err != nil {
+			return result, err
+		}
+		result.Snapshot = version.ID
+		for _, entry := range changed {
+			if err := s.repo.SetStatic(entry); err != nil {
+				return result, err
+			}
+		}
+		s.timetableChanged()
+	}
+	s.imports.set(result)
+	s.auditAs(actor, auditERPImport, importer.Name(), fmt.Sprintf("%d classrooms, %d courses, %d faculty, %d periods, %d conflicts",
+		result.Classrooms, result.Courses, result.Faculty, len(changed), len(result.Conflicts)))
+	return result, nil
+}
+
+// Lists the ERP importers with what their last import did
+func (s *Server) importersHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := []importerStatus{}
+	for _, importer := range s.config.Importers {
+		status := importerStatus{Name: importer.Name()}
+		if result, ok := s.imports.get(importer.Name()); ok {
+			status.LastRun = &result
+		}
+		statuses = append(statuses, status)
+	}
+	s.writeTask(w, r, http.StatusOK, statuses)
+}
+
+// Starts an import from an ERP in the background; the task's result is an importResult. dryRun=true only reports it.
+func (s *Server) runImportHandler(w http.ResponseWriter, r *http.Request) {
+	importer := s.importer(router.Param(r, "name"))
+	if importer == nil {
+		http.Error(w, "No such importer", http.StatusNotFound)
+		return
+	}
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+	actor := adminActor(r)
+	s.submitTask(w, r, taskERPImport, func(ctx context.Context, progress func(done int, total int)) (interface{}, error) {
+		progress(0, 1)
+		result, err := s.runImport(ctx, importer, actor, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		progress(1, 1)
+		return result, nil
+	})
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest accepted event title and organizer, in bytes
+const (
+	maxEventTitleLength     = 128
+	maxEventOrganizerLength = 64
+)
+
+/*
+eventConflict describes what keeps event from its room, "" when nothing does: a
+block on its date, a class or booking in a slot it overlaps, or another event.
+*/
+func (s *Server) eventConflict(event db.Event) (string, error) {
+	date := calendar.Date(event.Start, s.config.Location)
+	blocks, err := s.repo.GetBlocks(event.Class, date, date)
+	if err != nil {
+		return "", err
+	}
+	if len(blocks) > 0 {
+		return event.Class + " is blocked: " + blocks[0].Reason, nil
+	}
+
+	slotTimes, err := s.repo.GetSlotTimes()
+	if err != nil {
+		return "", err
+	}
+	// What the timetable has in each slot that day, nothing on days without classes
+	taken := make(map[int]string)
+	slots := s.repo.GetAllSlot()
+	if subject := s.repo.GetTimetableByDay(event.Class, date); len(subject) == len(slots) {
+		for idx, slot := range slots {
+			if subject[idx] != "FREE" {
+				taken[slot] = subject[idx]
+			}
+		}
+	}
+	for _, slot := range slotTimes {
+		subject, ok := taken[slot.ID]
+		if ok && event.Start.Before(s.clockTime(date, slot.End)) && s.clockTime(date, slot.Start).Before(event.End) {
+			return "Overlaps " + subject + " in slot " + strconv.Itoa(slot.ID), nil
+		}
+	}
+
+	events, err := s.repo.GetEvents(db.EventFilter{Class: event.Class, Start: event.Start, End: event.End})
+	if err != nil {
+		return "", err
+	}
+	if len(events) > 0 {
+		return "Overlaps " + events[0].Title, nil
+	}
+	return "", nil
+}
+
+// writeEvents answers with events, without who made them unless withCreator
+func (s *Server) writeEvents(w http.ResponseWriter, r *http.Request, events []db.Event, withCreator bool) {
+	if events == nil {
+		events = []db.Event{}
+	}
+	if !withCreator {
+		for idx := range events {
+			events[idx].CreatedBy = ""
+		}
+	}
+	s.writeJSON(w, r, http.StatusOK, events)
+}
+
+// Lists the events on a day, of one class when it is given
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Date  time.Time `param:"day,required"`
+		Class string    `param:"class"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	events, err := s.repo.GetEvents(db.EventFilter{
+		Class: query.Class,
+		Start: query.Date,
+		End:   query.Date.AddDate(0, 0, 1),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	approved := []db.Event{}
+	for _, event := range events {
+		if !event.Pending {
+			approved = append(approved, event)
+		}
+	}
+	s.writeEvents(w, r, approved, false)
+}
+
+// Lists the user's events that have not ended yet
+func (s *Server) myEventsHandler(w http.ResponseWriter, r *http.Request) {
+	events, err := s.repo.GetEvents(db.EventFilter{CreatedBy: currentSession(r).Mail, Start: time.Now()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeEvents(w, r, events, true)
+}
+
+/*
+createEventHandler reserves class from start to end (RFC 3339, within one day)
+for the event title, optionally run by organizer, when the room is free then.
+A coordinator books on behalf of their club with club, the organizer then
+defaulting to the club; the event holds the room but waits for the club's
+advisor, who is told, to approve it.
+*/
+func (s *Server) createEventHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class     string    `param:"class"`
+		Title     string    `param:"title"`
+		Organizer string    `param:"organizer"`
+		Club      string    `param:"club"`
+		Start     time.Time `param:"start,required,instant"`
+		End       time.Time `param:"end,required,instant"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	event := db.Event{
+		Class:     query.Class,
+		Title:     query.Title,
+		Organizer: query.Organizer,
+		Club:      query.Club,
+		Start:     query.Start,
+		End:       query.End,
+		CreatedBy: currentSession(r).Mail,
+		CreatedAt: time.Now(),
+	}
+	var club db.Club
+	if event.Club != "" {
+		var found bool
+		var err error
+		club, found, err = s.club(event.Club)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Invalid club value", http.StatusBadRequest)
+			return
+		}
+		role := clubRole(club, event.CreatedBy)
+		if role != clubAdvisor && role != clubCoordinator {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if event.Organizer == "" {
+			event.Organizer = club.Name
+		}
+		event.Pending = role != clubAdvisor
+	}
+	if !containsString(s.repo.GetAllClass(), event.Class) {
+		http.Error(w, "Invalid class value", http.StatusBadRequest)
+		return
+	}
+	if event.Title == "" || len(event.Title) > maxEventTitleLength {
+		http.Error(w, "Invalid title value", http.StatusBadRequest)
+		return
+	}
+	if len(event.Organizer) > maxEventOrganizerLength {
+		http.Error(w, "Invalid organizer value", http.StatusBadRequest)
+		return
+	}
+	if event.Start.Before(event.CreatedAt) {
+		http.Error(w, "Invalid start value", http.StatusBadRequest)
+		return
+	}
+	if !event.End.After(event.Start) ||
+		!calendar.Date(event.End.Add(-time.Nanosecond), s.config.Location).Equal(calendar.Date(event.Start, s.config.Location)) {
+		http.Error(w, "Invalid end value", http.StatusBadRequest)
+		return
+	}
+	conflict, err := s.eventConflict(event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if conflict != "" {
+		http.Error(w, conflict, http.StatusConflict)
+		return
+	}
+	event.ID, err = s.repo.CreateEvent(event)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if event.Pending {
+		s.notifyUser(club.Advisor, notify.KindEvent, i18n.M("Event to approve"),
+			i18n.M("%s booked %s from %s to %s.", event.CreatedBy, describeClubEvent(event, club),
+				event.Start.In(s.config.Location).Format(calendar.DateLayout+" "+examTimeLayout),
+				event.End.In(s.config.Location).Format(examTimeLayout)))
+	}
+	s.writeJSON(w, r, http.StatusCreated, event)
+}
+
+// Cancels one of the user's events
+func (s *Server) deleteMyEventHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	events, err := s.repo.GetEvents(db.EventFilter{CreatedBy: currentSession(r).Mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, event := range events {
+		if event.ID != id {
+			continue
+		}
+		_, err = s.repo.DeleteEvent(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, "No such event", http.StatusNotFound)
+}
+
+// Cancels anyone's event
+func (s *Server) adminDeleteEventHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteEvent(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such event", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteEvent, strconv.FormatInt(id, 10), "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,501 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/jobs"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Exam times are wall clock times at the institution
+const examTimeLayout = "15:04"
+
+// Largest accepted exam import, in bytes
+const maxExamImportSize = 1 << 20
+
+// Columns of an exam import, one hall of an exam per row
+var examImportHeader = []string{"subject", "date", "startTime", "endTime", "class", "firstRoll", "lastRoll"}
+
+// How an exam is sent to the admin endpoints
+type examRequest struct {
+	Subject   string        `json:"subject"`
+	Date      string        `json:"date"`
+	StartTime string        `json:"startTime"`
+	EndTime   string        `json:"endTime"`
+	Halls     []db.ExamHall `json:"halls"`
+}
+
+/*
+exam checks the request against the timetable and turns it into a db.Exam.
+Every hall has to be a known classroom, and no roll number may be seated in
+two halls.
+*/
+func (s *Server) exam(request examRequest) (db.Exam, error) {
+	exam := db.Exam{Subject: request.Subject, StartTime: request.StartTime, EndTime: request.EndTime, Halls: request.Halls}
+	if exam.Subject == "" || len(exam.Subject) > 8 {
+		return exam, errors.New("Invalid subject value")
+	}
+	var err error
+	exam.Date, err = calendar.ParseDate(request.Date, s.config.Location)
+	if err != nil {
+		return exam, errors.New("Invalid date value")
+	}
+	start, err := time.Parse(examTimeLayout, exam.StartTime)
+	if err != nil {
+		return exam, errors.New("Invalid startTime value")
+	}
+	end, err := time.Parse(examTimeLayout, exam.EndTime)
+	if err != nil || !end.After(start) {
+		return exam, errors.New("Invalid endTime value")
+	}
+	if len(exam.Halls) == 0 {
+		return exam, errors.New("An exam needs at least one hall")
+	}
+	classes := s.repo.GetAllClass()
+	for idx, hall := range exam.Halls {
+		hall.Class = s.canonicalRoom(hall.Class)
+		if !containsString(classes, hall.Class) {
+			return exam, fmt.Errorf("Unknown class %s", hall.Class)
+		}
+		hall.FirstRoll = strings.ToUpper(hall.FirstRoll)
+		hall.LastRoll = strings.ToUpper(hall.LastRoll)
+		if hall.FirstRoll == "" || len(hall.FirstRoll) > 32 || len(hall.FirstRoll) != len(hall.LastRoll) ||
+			hall.FirstRoll > hall.LastRoll {
+			return exam, fmt.Errorf("Invalid roll range in %s", hall.Class)
+		}
+		for _, other := range exam.Halls[:idx] {
+			if other.Class == hall.Class {
+				return exam, fmt.Errorf("%s is listed twice", hall.Class)
+			}
+			if other.Seats(hall.FirstRoll) || other.Seats(hall.LastRoll) || hall.Seats(other.FirstRoll) {
+				return exam, fmt.Errorf("The rolls of %s and %s overlap", other.Class, hall.Class)
+			}
+		}
+		exam.Halls[idx] = hall
+	}
+	return exam, nil
+}
+
+func (s *Server) writeExams(w http.ResponseWriter, r *http.Request, status int, exams []db.Exam) {
+	if exams == nil {
+		exams = []db.Exam{}
+	}
+	s.writeJSON(w, r, status, exams)
+}
+
+// Lists the exams, optionally only those from startDate to endDate
+func (s *Server) adminExamsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		StartDate time.Time `param:"startDate"`
+		EndDate   time.Time `param:"endDate"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	exams, err := s.repo.GetExams(query.StartDate, query.EndDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeExams(w, r, http.StatusOK, exams)
+}
+
+// parseExam reads an exam from the JSON body. On failure it has already written the error response.
+func (s *Server) parseExam(w http.ResponseWriter, r *http.Request) (db.Exam, bool) {
+	var request examRequest
+	err := json.NewDecoder(io.LimitReader(r.Body, maxExamImportSize)).Decode(&request)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return db.Exam{}, false
+	}
+	exam, err := s.exam(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return exam, false
+	}
+	return exam, true
+}
+
+func (s *Server) createExamHandler(w http.ResponseWriter, r *http.Request) {
+	exam, ok := s.parseExam(w, r)
+	if !ok {
+		return
+	}
+	ids, err := s.repo.CreateExams([]db.Exam{exam})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	exam.ID = ids[0]
+	s.audit(r, auditCreateExam, strconv.FormatInt(exam.ID, 10), exam.Subject+" "+exam.Date.Format(calendar.DateLayout))
+	s.writeExams(w, r, http.StatusCreated, []db.Exam{exam})
+}
+
+func (s *Server) updateExamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	exam, ok := s.parseExam(w, r)
+	if !ok {
+		return
+	}
+	exam.ID = id
+	exam.Version, ok = ifMatch(w, r)
+	if !ok {
+		return
+	}
+	before, err := s.examByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.repo.UpdateExam(exam)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such exam", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != db.ErrStaleVersion {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stale := err == db.ErrStaleVersion
+	current, err := s.examByID(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if current == nil {
+		http.Error(w, "The exam has been deleted", http.StatusConflict)
+		return
+	}
+	if stale {
+		s.writeStale(w, r, *current, current.Version)
+		return
+	}
+	s.audit(r, auditUpdateExam, strconv.FormatInt(id, 10), exam.Subject+" "+exam.Date.Format(calendar.DateLayout))
+	if before != nil {
+		s.alertHallChanges(*before, *current)
+	}
+	w.Header().Set("ETag", etag(current.Version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+alertHallChanges alerts the students seated in after whose hall or time is not
+what it was in before, texting those who opted in, see alertUser. Students are
+the users broadcasts to everyone reach, by the roll number of their mail.
+*/
+func (s *Server) alertHallChanges(before db.Exam, after db.Exam) {
+	recipients, err := s.broadcastRecipients(audienceAll, "")
+	if err != nil {
+		s.logger.Println("Error finding the students of exam", after.ID, err)
+		return
+	}
+	for _, mail := range recipients {
+		roll := strings.ToUpper(strings.SplitN(mail, "@", 2)[0])
+		hall, ok := after.Hall(roll)
+		if !ok {
+			continue
+		}
+		if was, ok := before.Hall(roll); ok && was.Class == hall.Class && before.Date.Equal(after.Date) &&
+			before.StartTime == after.StartTime {
+			continue
+		}
+		s.alertUser(mail, notify.KindExam, i18n.M("Exam hall changed"), i18n.M("Your %s exam on %s at %s is in %s.",
+			after.Subject, after.Date.Format(calendar.DateLayout), after.StartTime, hall.Class))
+	}
+}
+
+// examByID finds an exam, nil when there is none
+func (s *Server) examByID(id int64) (*db.Exam, error) {
+	exams, err := s.repo.GetExams(time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for idx := range exams {
+		if exams[idx].ID == id {
+			return &exams[idx], nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) deleteExamHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteExam(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such exam", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteExam, strconv.FormatInt(id, 10), "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseExamImport reads the CSV of an exam import into one request per exam
+func parseExamImport(body io.Reader) ([]examRequest, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = len(examImportHeader)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil || strings.Join(header, ",") != strings.Join(examImportHeader, ",") {
+		return nil, errors.New("The first line must be " + strings.Join(examImportHeader, ","))
+	}
+	var requests []examRequest
+	index := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := strings.Join(record[:4], ",")
+		idx, ok := index[key]
+		if !ok {
+			idx = len(requests)
+			index[key] = idx
+			requests = append(requests, examRequest{Subject: record[0], Date: record[1], StartTime: record[2], EndTime: record[3]})
+		}
+		requests[idx].Halls = append(requests[idx].Halls, db.ExamHall{Class: record[4], FirstRoll: record[5], LastRoll: record[6]})
+	}
+	if len(requests) == 0 {
+		return nil, errors.New("No exams to import")
+	}
+	return requests, nil
+}
+
+// exams checks every request with exam, telling progress how many it got through
+func (s *Server) exams(requests []examRequest, progress func(done int, total int)) ([]db.Exam, error) {
+	exams := make([]db.Exam, 0, len(requests))
+	for _, request := range requests {
+		exam, err := s.exam(request)
+		if err != nil {
+			return nil, errors.New(request.Subject + " on " + request.Date + ": " + err.Error())
+		}
+		exams = append(exams, exam)
+		progress(len(exams), len(requests))
+	}
+	return exams, nil
+}
+
+// createExams stores exams, filling in their IDs
+func (s *Server) createExams(exams []db.Exam, actor string) error {
+	ids, err := s.repo.CreateExams(exams)
+	if err != nil {
+		return err
+	}
+	for idx := range exams {
+		exams[idx].ID = ids[idx]
+	}
+	s.auditAs(actor, auditImportExams, "", strconv.Itoa(len(exams))+" exams")
+	return nil
+}
+
+/*
+importExamsTask does an exam import in the background. Its result is the
+exams imported, or the preview with dryRun.
+*/
+func (s *Server) importExamsTask(requests []examRequest, dryRun bool, actor string) jobs.TaskFunc {
+	return func(ctx context.Context, progress func(done int, total int)) (interface{}, error) {
+		exams, err := s.exams(requests, progress)
+		if err != nil {
+			return nil, err
+		}
+		if dryRun {
+			existing, err := s.repo.GetExams(time.Time{}, time.Time{})
+			if err != nil {
+				return nil, err
+			}
+			return newPreview(exams, hallConflicts(exams, existing)), nil
+		}
+		err = s.createExams(exams, actor)
+		return exams, err
+	}
+}
+
+/*
+importExamsHandler takes a CSV body with the examImportHeader columns, one
+hall per row. Rows with the same subject, date and times make up one exam.
+Either every exam is imported or, on the first bad row, none. With
+dryRun=true nothing is imported; the preview has the exams and the halls they
+share with other exams at the same time. With async=true the import goes on in
+the background and the response is the task to poll, see submitTask.
+*/
+func (s *Server) importExamsHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+	async, ok := parseFlag(w, r, "async")
+	if !ok {
+		return
+	}
+	requests, err := parseExamImport(io.LimitReader(r.Body, maxExamImportSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if async {
+		s.submitTask(w, r, taskImportExams, s.importExamsTask(requests, dryRun, adminActor(r)))
+		return
+	}
+	exams, err := s.exams(requests, func(int, int) {})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if dryRun {
+		existing, err := s.repo.GetExams(time.Time{}, time.Time{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writePreview(w, r, exams, hallConflicts(exams, existing))
+		return
+	}
+	err = s.createExams(exams, adminActor(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeExams(w, r, http.StatusCreated, exams)
+}
+
+// hallConflicts describes the halls of exams used at the same time by another of them or by one of existing
+func hallConflicts(exams []db.Exam, existing []db.Exam) []string {
+	var conflicts []string
+	for idx, exam := range exams {
+		others := append(append([]db.Exam(nil), existing...), exams[:idx]...)
+		for _, other := range others {
+			if !examsOverlap(exam, other) {
+				continue
+			}
+			for _, hall := range exam.Halls {
+				for _, otherHall := range other.Halls {
+					if hall.Class == otherHall.Class {
+						conflicts = append(conflicts, fmt.Sprintf("%s on %s: %s is taken by %s from %s",
+							exam.Subject, exam.Date.Format(calendar.DateLayout), hall.Class, other.Subject, other.StartTime))
+					}
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// An exam as its student sees it, with only their own hall
+type studentExam struct {
+	ID        int64     `json:"id"`
+	Subject   string    `json:"subject"`
+	Date      time.Time `json:"date"`
+	StartTime string    `json:"startTime"`
+	EndTime   string    `json:"endTime"`
+	Class     string    `json:"class"`
+}
+
+/*
+myExams lists the exams from today on that the user has a seat in. Student
+mails start with the roll number (cb.en.u4cse20001@...), which is what the
+halls' ranges are written in.
+*/
+func (s *Server) myExams(mail string) ([]studentExam, error) {
+	roll := strings.SplitN(mail, "@", 2)[0]
+	exams, err := s.repo.GetExams(calendar.Today(s.config.Location), time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	mine := []studentExam{}
+	for _, exam := range exams {
+		if hall, ok := exam.Hall(roll); ok {
+			mine = append(mine, studentExam{ID: exam.ID, Subject: exam.Subject, Date: exam.Date,
+				StartTime: exam.StartTime, EndTime: exam.EndTime, Class: hall.Class})
+		}
+	}
+	return mine, nil
+}
+
+func (s *Server) myExamsHandler(w http.ResponseWriter, r *http.Request) {
+	exams, err := s.myExams(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, exams)
+}
+
+// clockTime is the moment clock ("15:04") strikes on the civil date at the institution
+func (s *Server) clockTime(date time.Time, clock string) time.Time {
+	t, _ := time.Parse(examTimeLayout, clock)
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, s.config.Location)
+}
+
+// The user's calendar feed, for calendar apps to subscribe to
+func (s *Server) myCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	exams, err := s.myExams(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events := make([]icsEvent, 0, len(exams))
+	for _, exam := range exams {
+		events = append(events, icsEvent{
+			UID:      "exam-" + strconv.FormatInt(exam.ID, 10) + "@coraserver",
+			Start:    s.clockTime(exam.Date, exam.StartTime),
+			End:      s.clockTime(exam.Date, exam.EndTime),
+			Summary:  "Exam: " + exam.Subject,
+			Location: exam.Class,
+		})
+	}
+	assignments, err := s.myAssignments(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, assignment := range assignments {
+		events = append(events, icsEvent{
+			UID:     "assignment-" + strconv.FormatInt(assignment.ID, 10) + "@coraserver",
+			Start:   assignment.Due,
+			End:     assignment.Due,
+			Summary: "Due: " + assignment.Title + " (" + assignment.Subject + ")",
+		})
+	}
+	appointments, err := s.appointmentEvents(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events = append(events, appointments...)
+	custom, err := s.customEvents(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events = append(events, custom...)
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(writeICS("CORA", events, time.Now()))
+}
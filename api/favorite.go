@@ -0,0 +1,147 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+const (
+	// How many favorites one user may keep
+	maxFavorites = 100
+	// Longest class section name, like "CSE-B 2020"
+	maxSectionLength = 32
+)
+
+func (s *Server) writeFavorites(w http.ResponseWriter, r *http.Request, favorites []db.Favorite) {
+	if favorites == nil {
+		favorites = []db.Favorite{}
+	}
+	s.writeJSON(w, r, http.StatusOK, favorites)
+}
+
+func (s *Server) myFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	favorites, err := s.repo.GetFavorites(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeFavorites(w, r, favorites)
+}
+
+/*
+Stars the classroom or class section given by the kind and id parameters,
+answering with all of the user's favorites. A classroom has to be in the
+timetable; a section is any name the app uses.
+*/
+func (s *Server) addFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Kind string `param:"kind"`
+		ID   string `param:"id"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	favorite := db.Favorite{Kind: query.Kind, Target: query.ID, CreatedAt: time.Now()}
+	switch favorite.Kind {
+	case db.FavoriteClassroom:
+		if !containsString(s.repo.GetAllClass(), favorite.Target) {
+			http.Error(w, "Invalid id value", http.StatusBadRequest)
+			return
+		}
+	case db.FavoriteSection:
+		if favorite.Target == "" || len(favorite.Target) > maxSectionLength {
+			http.Error(w, "Invalid id value", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Invalid kind value", http.StatusBadRequest)
+		return
+	}
+	mail := currentSession(r).Mail
+	favorites, err := s.repo.GetFavorites(mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(favorites) >= maxFavorites {
+		http.Error(w, "Too many favorites", http.StatusConflict)
+		return
+	}
+	err = s.repo.AddFavorite(mail, favorite)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	favorites, err = s.repo.GetFavorites(mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	s.writeFavorites(w, r, favorites)
+}
+
+func (s *Server) deleteFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	rowsAffected, err := s.repo.DeleteFavorite(currentSession(r).Mail, router.Param(r, "kind"), router.Param(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such favorite", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+onlyFavorites narrows classes down to the user's favorite classrooms when the
+request has onlyFavorites=true, which needs a session. On failure it has
+already written the error response.
+*/
+func (s *Server) onlyFavorites(w http.ResponseWriter, r *http.Request, classes []string) ([]string, bool) {
+	value := r.URL.Query().Get("onlyFavorites")
+	if value == "" {
+		return classes, true
+	}
+	only, err := strconv.ParseBool(value)
+	if err != nil {
+		http.Error(w, "Invalid onlyFavorites value", http.StatusBadRequest)
+		return nil, false
+	}
+	if !only {
+		return classes, true
+	}
+	session, err := s.requestSession(r)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Not logged in", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	favorites, err := s.tracedRepo(r).GetFavorites(session.Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	starred := make(map[string]bool)
+	for _, favorite := range favorites {
+		if favorite.Kind == db.FavoriteClassroom {
+			starred[favorite.Target] = true
+		}
+	}
+	filtered := []string{}
+	for _, class := range classes {
+		if starred[class] {
+			filtered = append(filtered, class)
+		}
+	}
+	return filtered, true
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// What feedback can be about
+var feedbackCategories = []string{"timetable", "room", "app", "other"}
+
+// Kinds of things feedback can point at: a classroom, a period ("A104/TUE/3") or a piece of equipment
+var feedbackEntityKinds = []string{"classroom", "period", "equipment"}
+
+var feedbackStatuses = []string{db.FeedbackOpen, db.FeedbackResolved, db.FeedbackDismissed}
+
+const (
+	// Longest accepted feedback message, in bytes
+	maxFeedbackLength = 2000
+	// Reports a user, or an anonymous client by IP, can send per minute, and in a burst
+	feedbackPerMinute = 2
+	feedbackBurst     = 5
+)
+
+// A report with how many open ones are about the same thing, for the admin triaging it
+type feedbackEntry struct {
+	db.Feedback
+	SameEntity int `json:"sameEntity,omitempty"`
+}
+
+// knownEntity tells whether the entity of kind with id exists
+func (s *Server) knownEntity(kind string, id string) (bool, error) {
+	switch kind {
+	case "classroom":
+		return containsString(s.repo.GetAllClass(), id), nil
+	case "period":
+		parts := strings.Split(id, "/")
+		if len(parts) != 3 {
+			return false, nil
+		}
+		weekday, err := calendar.ParseDay(parts[1])
+		if err != nil {
+			return false, nil
+		}
+		slot, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return false, nil
+		}
+		entries, err := s.repo.GetStatic(db.TimetableFilter{Class: parts[0], Day: calendar.DayCode(weekday)})
+		if err != nil {
+			return false, err
+		}
+		for _, entry := range entries {
+			if entry.Slot == slot {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "equipment":
+		equipment, err := s.repo.GetEquipment()
+		if err != nil {
+			return false, err
+		}
+		for _, item := range equipment {
+			if item.ID == id {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+/*
+createFeedbackHandler takes a report of wrong timetable data, a broken room or
+anything else: a category, the message and optionally the entityKind and
+entityId of what it is about, which must exist. It needs no session; with one
+the user is told when an admin resolves it.
+*/
+func (s *Server) createFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Category   string `param:"category"`
+		EntityKind string `param:"entityKind"`
+		EntityID   string `param:"entityId"`
+		Message    string `param:"message"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	feedback := db.Feedback{
+		Category:   query.Category,
+		EntityKind: query.EntityKind,
+		EntityID:   query.EntityID,
+		Message:    query.Message,
+		Status:     db.FeedbackOpen,
+		CreatedAt:  time.Now(),
+	}
+	if session, err := s.requestSession(r); err == nil {
+		feedback.Mail = session.Mail
+	}
+	if !containsString(feedbackCategories, feedback.Category) {
+		http.Error(w, "Invalid category value", http.StatusBadRequest)
+		return
+	}
+	if feedback.Message == "" || len(feedback.Message) > maxFeedbackLength {
+		http.Error(w, "Invalid message value", http.StatusBadRequest)
+		return
+	}
+	if feedback.EntityKind != "" || feedback.EntityID != "" {
+		if !containsString(feedbackEntityKinds, feedback.EntityKind) {
+			http.Error(w, "Invalid entityKind value", http.StatusBadRequest)
+			return
+		}
+		if feedback.EntityKind == "period" {
+			// Periods are named by their day codes, whatever the report spelt
+			if parts := strings.Split(feedback.EntityID, "/"); len(parts) == 3 {
+				if weekday, err := calendar.ParseDay(parts[1]); err == nil {
+					feedback.EntityID = parts[0] + "/" + calendar.DayCode(weekday) + "/" + parts[2]
+				}
+			}
+		}
+		known, err := s.knownEntity(feedback.EntityKind, feedback.EntityID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !known {
+			http.Error(w, "No such "+feedback.EntityKind, http.StatusNotFound)
+			return
+		}
+	}
+	key := feedback.Mail
+	if key == "" {
+		key = "ip:" + clientIP(r)
+	}
+	if ok, wait := s.feedback.Allow(key, feedbackPerMinute, feedbackBurst); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds()+1)))
+		http.Error(w, "Too many reports, try again later", http.StatusTooManyRequests)
+		return
+	}
+	var err error
+	feedback.ID, err = s.repo.CreateFeedback(feedback)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusCreated, feedback)
+}
+
+// Lists the reports the user sent, newest first, with what became of them
+func (s *Server) myFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	reports, err := s.repo.GetFeedback(db.FeedbackFilter{Mail: currentSession(r).Mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if reports == nil {
+		reports = []db.Feedback{}
+	}
+	s.writeJSON(w, r, http.StatusOK, reports)
+}
+
+/*
+adminFeedbackHandler lists the reports of the status (open by default, all
+for every one), category, entityKind and entityId parameters, newest first.
+Each tells how many open reports there are about the same thing, so what many
+users ran into stands out.
+*/
+func (s *Server) adminFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Category   string `param:"category"`
+		Status     string `param:"status"`
+		EntityKind string `param:"entityKind"`
+		EntityID   string `param:"entityId"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	filter := db.FeedbackFilter{
+		Category:   query.Category,
+		Status:     query.Status,
+		EntityKind: query.EntityKind,
+		EntityID:   query.EntityID,
+	}
+	if filter.Status == "" {
+		filter.Status = db.FeedbackOpen
+	} else if filter.Status == "all" {
+		filter.Status = ""
+	} else if !containsString(feedbackStatuses, filter.Status) {
+		http.Error(w, "Invalid status value", http.StatusBadRequest)
+		return
+	}
+	if filter.Category != "" && !containsString(feedbackCategories, filter.Category) {
+		http.Error(w, "Invalid category value", http.StatusBadRequest)
+		return
+	}
+	reports, err := s.repo.GetFeedback(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	open, err := s.repo.GetFeedback(db.FeedbackFilter{Status: db.FeedbackOpen})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	counts := make(map[string]int)
+	for _, report := range open {
+		if report.EntityKind != "" {
+			counts[report.EntityKind+":"+report.EntityID]++
+		}
+	}
+	entries := make([]feedbackEntry, 0, len(reports))
+	for _, report := range reports {
+		entry := feedbackEntry{Feedback: report}
+		if report.EntityKind != "" {
+			entry.SameEntity = counts[report.EntityKind+":"+report.EntityID]
+		}
+		entries = append(entries, entry)
+	}
+	s.writeJSON(w, r, http.StatusOK, entries)
+}
+
+// closeFeedback resolves or dismisses the report of the path with the note parameter
+func (s *Server) closeFeedback(w http.ResponseWriter, r *http.Request, status string) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Note string `param:"note"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	note := query.Note
+	if len(note) > maxReasonLength {
+		http.Error(w, "Invalid note value", http.StatusBadRequest)
+		return
+	}
+	reports, err := s.repo.GetFeedback(db.FeedbackFilter{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var feedback db.Feedback
+	for _, report := range reports {
+		if report.ID == id {
+			feedback = report
+		}
+	}
+	if feedback.ID == 0 {
+		http.Error(w, "No such report", http.StatusNotFound)
+		return
+	}
+	err = s.repo.CloseFeedback(id, status, adminActor(r), note, time.Now())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Already closed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	action := auditResolveFeedback
+	if status == db.FeedbackDismissed {
+		action = auditDismissFeedback
+	}
+	s.audit(r, action, strconv.FormatInt(id, 10), note)
+	if status == db.FeedbackResolved && feedback.Mail != "" {
+		body := i18n.M("Thanks for reporting it.")
+		if note != "" {
+			body = i18n.M(note)
+		}
+		s.notifyUser(feedback.Mail, notify.KindFeedback, i18n.M("Your report was resolved"), body)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Marks a report resolved and tells who sent it
+func (s *Server) resolveFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	s.closeFeedback(w, r, db.FeedbackResolved)
+}
+
+// Closes a report nothing will be done about, like a duplicate
+func (s *Server) dismissFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	s.closeFeedback(w, r, db.FeedbackDismissed)
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+)
+
+// A period of one of the subjects a user takes, in the room it is held in that day
+type gapPeriod struct {
+	Slot    int    `json:"slot"`
+	Span    int    `json:"span"`
+	Subject string `json:"subject"`
+	Class   string `json:"class"`
+	// Of an elective the user is enrolled in
+	Elective bool `json:"elective,omitempty"`
+}
+
+// Free slots between two periods of a user, with rooms to spend them in
+type timetableGap struct {
+	StartSlot int    `json:"startSlot"`
+	EndSlot   int    `json:"endSlot"`
+	Start     string `json:"start,omitempty"`
+	End       string `json:"end,omitempty"`
+	// Rooms free for the whole gap, nearest to the period before it first
+	Rooms []string `json:"rooms"`
+}
+
+type gapsResponse struct {
+	Date    time.Time      `json:"date"`
+	Periods []gapPeriod    `json:"periods"`
+	Gaps    []timetableGap `json:"gaps"`
+}
+
+/*
+subjectPeriods returns the periods of subjects on date in slot order, as
+overridden: cancelled periods are left out and moved ones are in their new
+room. Those of electives are marked.
+*/
+func (s *Server) subjectPeriods(subjects []string, electives map[string]bool, date time.Time) ([]gapPeriod, error) {
+	var periods []gapPeriod
+	for _, subject := range subjects {
+		entries, err := s.repo.GetStatic(db.TimetableFilter{Subject: subject, Day: calendar.DayCode(date.Weekday())})
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			period := gapPeriod{Slot: entry.Slot, Span: max1(entry.Span), Subject: entry.Subject, Class: entry.Class,
+				Elective: electives[entry.Subject]}
+			override, found, err := s.existingOverride(entry, date)
+			if err != nil {
+				return nil, err
+			}
+			if found && override.Cancelled {
+				continue
+			}
+			if found && override.Room != "" {
+				period.Class = override.Room
+			}
+			periods = append(periods, period)
+		}
+	}
+	sort.SliceStable(periods, func(i, j int) bool { return periods[i].Slot < periods[j].Slot })
+	return periods, nil
+}
+
+/*
+myGapsHandler finds the free periods of the user on day (a date, today by
+default) between the first and the last period of the subjects they take,
+see userSubjects, so electives they do not take leave gaps too. Each gap
+comes with up to limit (5 by default) rooms free for all of it, on the campus
+of the request and nearest to the room of the period before it first.
+*/
+func (s *Server) myGapsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Date time.Time `param:"day"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	date := query.Date
+	if date.IsZero() {
+		date = calendar.Today(s.config.Location)
+	}
+	limit, ok := parseLimit(r, 5)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	subjects, electives, err := s.userSubjects(currentSession(r).Mail, s.requestPreferences(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	periods, err := s.subjectPeriods(subjects, electives, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slotTimes, err := s.repo.GetSlotTimes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	clocks := make(map[int]db.SlotTime)
+	for _, slotTime := range slotTimes {
+		clocks[slotTime.ID] = slotTime
+	}
+	slots := s.repo.GetAllSlot()
+	sort.Ints(slots)
+	taken := make(map[int]string)
+	for _, period := range periods {
+		for slot := period.Slot; slot < period.Slot+period.Span; slot++ {
+			taken[slot] = period.Class
+		}
+	}
+	m, err := s.campusMap()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := gapsResponse{Date: date, Periods: periods, Gaps: []timetableGap{}}
+	if response.Periods == nil {
+		response.Periods = []gapPeriod{}
+	}
+	// Slots before the first period are not a gap, and the room before a gap is where the walk starts
+	var before string
+	var free []int
+	for _, slot := range slots {
+		class, busy := taken[slot]
+		if !busy {
+			if before != "" {
+				free = append(free, slot)
+			}
+			continue
+		}
+		if len(free) > 0 {
+			gap := timetableGap{StartSlot: free[0], EndSlot: free[len(free)-1],
+				Start: clocks[free[0]].Start, End: clocks[free[len(free)-1]].End}
+			rooms, ok := s.onCampus(w, r, s.tracedRepo(r).GetFreeRooms(free, []time.Time{date}))
+			if !ok {
+				return
+			}
+			if building, found := m.place(s, before); found {
+				rooms = m.nearest(building, rooms)
+			}
+			if len(rooms) > limit {
+				rooms = rooms[:limit]
+			}
+			gap.Rooms = append([]string{}, rooms...)
+			response.Gaps = append(response.Gaps, gap)
+			free = nil
+		}
+		before = class
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+)
+
+/*
+The GraphQL schema mirrors the REST endpoints under /db so that a client can
+ask for, say, a class's week and the rooms free in a slot in one round trip.
+Dates are "2006-01-02" strings like everywhere else in the API; RFC 3339
+timestamps are accepted too and stand for their date at the institution.
+*/
+const graphqlSchema = `
+schema {
+	query: Query
+}
+
+type Query {
+	"Rooms free in every slot from slot to endSlot (slot alone when omitted)"
+	freeClasses(date: String!, slot: Int!, endSlot: Int): [String!]!
+	freeSlots(class: String!, date: String!): [Int!]!
+	"The subject of every slot of class on date, FREE when free"
+	timetable(class: String!, date: String!): [Period!]!
+	"Monday to Friday of the week containing date"
+	week(class: String!, date: String!): [Day!]!
+	classrooms: [String!]!
+	slots: [Int!]!
+	subjects: [String!]!
+	bookings(faculty: String!): [Booking!]!
+	"The logged in user, null without a session"
+	me: User
+}
+
+type Period {
+	slot: Int!
+	subject: String!
+}
+
+type Day {
+	date: String!
+	"The day code of the timetable, like MON"
+	day: String!
+	"The day named in the language of the Accept-Language header"
+	name: String!
+	periods: [Period!]!
+}
+
+type Booking {
+	class: String!
+	date: String!
+	slot: Int!
+	faculty: String!
+	subject: String!
+}
+
+type User {
+	mail: String!
+	name: String!
+	sessions: Int!
+}
+`
+
+// Longest accepted query document, in bytes
+const graphqlMaxQueryLength = 16 << 10
+
+type graphqlResolver struct {
+	repo     db.Repository
+	location *time.Location
+}
+
+func (q *graphqlResolver) parseDate(value string) (time.Time, error) {
+	date, err := calendar.ParseDate(value, q.location)
+	if err != nil {
+		return date, errors.New("invalid date " + value + ", expected 2006-01-02 or an RFC 3339 timestamp")
+	}
+	return date, nil
+}
+
+func (q *graphqlResolver) FreeClasses(args struct {
+	Date    string
+	Slot    int32
+	EndSlot *int32
+}) ([]string, error) {
+	date, err := q.parseDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+	var classroom []string
+	if args.EndSlot == nil {
+		classroom = q.repo.GetFreeClass(int(args.Slot), date)
+		q.repo.RecordSearch(db.SearchEvent{Kind: db.SearchFreeClass, StartSlot: int(args.Slot), Date: date})
+	} else {
+		classroom = q.repo.MultiFreeSlot(int(args.Slot), int(*args.EndSlot), date)
+		q.repo.RecordSearch(db.SearchEvent{Kind: db.SearchMultiFreeSlot, StartSlot: int(args.Slot),
+			EndSlot: int(*args.EndSlot), Date: date})
+	}
+	return nonNilStrings(classroom), nil
+}
+
+func (q *graphqlResolver) FreeSlots(args struct{ Class, Date string }) ([]int32, error) {
+	date, err := q.parseDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+	q.repo.RecordSearch(db.SearchEvent{Kind: db.SearchFreeSlot, Class: args.Class, Date: date})
+	return int32s(q.repo.GetFreeSlot(args.Class, date)), nil
+}
+
+type periodResolver struct {
+	slot    int
+	subject string
+}
+
+func (p periodResolver) Slot() int32     { return int32(p.slot) }
+func (p periodResolver) Subject() string { return p.subject }
+
+/*
+periods pairs the subjects from GetTimetableByDay, which come in slot order,
+with the slots, the same way the app lays out /db/daytimetable
+*/
+func (q *graphqlResolver) periods(class string, date time.Time) []periodResolver {
+	subjects := q.repo.GetTimetableByDay(class, date)
+	slots := q.repo.GetAllSlot()
+	periods := []periodResolver{}
+	for idx, subject := range subjects {
+		if idx < len(slots) {
+			periods = append(periods, periodResolver{slot: slots[idx], subject: subject})
+		}
+	}
+	return periods
+}
+
+func (q *graphqlResolver) Timetable(args struct{ Class, Date string }) ([]periodResolver, error) {
+	date, err := q.parseDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+	return q.periods(args.Class, date), nil
+}
+
+type dayResolver struct {
+	date    time.Time
+	lang    string
+	periods []periodResolver
+}
+
+func (d dayResolver) Date() string              { return d.date.Format(calendar.DateLayout) }
+func (d dayResolver) Day() string               { return calendar.DayCode(d.date.Weekday()) }
+func (d dayResolver) Name() string              { return calendar.DayName(d.date.Weekday(), d.lang) }
+func (d dayResolver) Periods() []periodResolver { return d.periods }
+
+func (q *graphqlResolver) Week(ctx context.Context, args struct{ Class, Date string }) ([]dayResolver, error) {
+	date, err := q.parseDate(args.Date)
+	if err != nil {
+		return nil, err
+	}
+	// Weekday is 0 on Sunday, which belongs to the week before
+	offset := (int(date.Weekday()) + 6) % 7
+	monday := date.AddDate(0, 0, -offset)
+	lang, _ := ctx.Value(languageContextKey{}).(string)
+	days := make([]dayResolver, 0, 5)
+	for i := 0; i < 5; i++ {
+		day := monday.AddDate(0, 0, i)
+		days = append(days, dayResolver{date: day, lang: lang, periods: q.periods(args.Class, day)})
+	}
+	return days, nil
+}
+
+func (q *graphqlResolver) Classrooms() []string { return nonNilStrings(q.repo.GetAllClass()) }
+func (q *graphqlResolver) Slots() []int32       { return int32s(q.repo.GetAllSlot()) }
+func (q *graphqlResolver) Subjects() []string   { return nonNilStrings(q.repo.GetAllSubject()) }
+
+type bookingResolver struct {
+	record db.BookingRecord
+}
+
+func (b bookingResolver) Class() string   { return b.record.Class }
+func (b bookingResolver) Date() string    { return b.record.Date.Format(calendar.DateLayout) }
+func (b bookingResolver) Slot() int32     { return int32(b.record.Slot) }
+func (b bookingResolver) Faculty() string { return b.record.Faculty }
+func (b bookingResolver) Subject() string { return b.record.Subject }
+
+func (q *graphqlResolver) Bookings(args struct{ Faculty string }) []bookingResolver {
+	bookings := []bookingResolver{}
+	for _, record := range q.repo.GetBooking(args.Faculty) {
+		bookings = append(bookings, bookingResolver{record: record})
+	}
+	return bookings
+}
+
+type userResolver struct {
+	repo    db.Repository
+	session db.Session
+}
+
+func (u *userResolver) Mail() string { return u.session.Mail }
+func (u *userResolver) Name() string { return u.session.Name }
+
+func (u *userResolver) Sessions() (int32, error) {
+	sessions, err := u.repo.GetUserSessions(u.session.Mail)
+	return int32(len(sessions)), err
+}
+
+func (q *graphqlResolver) Me(ctx context.Context) *userResolver {
+	session, ok := ctx.Value(sessionContextKey{}).(db.Session)
+	if !ok {
+		return nil
+	}
+	return &userResolver{repo: q.repo, session: session}
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func int32s(values []int) []int32 {
+	converted := make([]int32, len(values))
+	for idx, value := range values {
+		converted[idx] = int32(value)
+	}
+	return converted
+}
+
+// Carries the language picked from Accept-Language to the resolvers
+type languageContextKey struct{}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+/*
+graphqlHandler serves /graphql. POST takes the usual JSON body; GET takes the
+query, operationName and variables (JSON) parameters so that simple queries
+can be cached or typed into a browser. Sending a session makes me available,
+an invalid one is treated like none.
+*/
+func (s *Server) graphqlHandler() http.HandlerFunc {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{repo: s.repo, location: s.config.Location}, graphql.MaxDepth(8))
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request graphqlRequest
+		if r.Method == http.MethodGet {
+			request.Query = r.URL.Query().Get("query")
+			request.OperationName = r.URL.Query().Get("operationName")
+			if variables := r.URL.Query().Get("variables"); variables != "" {
+				err := json.Unmarshal([]byte(variables), &request.Variables)
+				if err != nil {
+					http.Error(w, "Invalid variables value", http.StatusBadRequest)
+					return
+				}
+			}
+		} else {
+			err := json.NewDecoder(r.Body).Decode(&request)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		if request.Query == "" || len(request.Query) > graphqlMaxQueryLength {
+			http.Error(w, "Invalid query value", http.StatusBadRequest)
+			return
+		}
+		ctx := context.WithValue(r.Context(), languageContextKey{}, calendar.Language(r.Header.Get("Accept-Language")))
+		session, err := s.requestSession(r)
+		if err == nil {
+			if session.ImpersonatedBy != "" {
+				s.impersonating(w, r, session)
+			}
+			ctx = context.WithValue(ctx, sessionContextKey{}, session)
+		} else if err != sql.ErrNoRows {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response := schema.Exec(ctx, request.Query, request.OperationName, request.Variables)
+		s.writeJSON(w, r, http.StatusOK, response)
+	}
+}
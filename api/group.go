@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/jobs"
+)
+
+// What a group sync found in the groups of a provider
+type groupSyncResult struct {
+	Provider string `json:"provider"`
+	Members  int    `json:"members"`
+}
+
+/*
+syncGroup replaces the section and role of every member of the groups mapped
+in one provider. A user in several groups gets the section of the first one
+mapped that gives one, and is staff when any of them makes them staff.
+*/
+func (s *Server) syncGroup(ctx context.Context, name string, groups auth.Groups) (groupSyncResult, error) {
+	result := groupSyncResult{Provider: name}
+	now := time.Now()
+	var members []db.GroupMember
+	byMail := make(map[string]int)
+	err := groups.SyncGroups(ctx, func(page []auth.GroupMember) error {
+		for _, member := range page {
+			mail := member.Mail
+			if mail == "" {
+				mail = member.UserPrincipalName
+			}
+			mail = strings.ToLower(mail)
+			if mail == "" {
+				continue
+			}
+			idx, ok := byMail[mail]
+			if !ok {
+				idx = len(members)
+				byMail[mail] = idx
+				members = append(members, db.GroupMember{Provider: name, Mail: mail, SyncedAt: now})
+			}
+			if members[idx].Section == "" {
+				members[idx].Section = member.Section
+			}
+			if members[idx].Role != auth.RoleStaff && member.Role != "" {
+				members[idx].Role = member.Role
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Members = len(members)
+	return result, s.repo.ReplaceGroupMembers(name, members)
+}
+
+/*
+syncGroups syncs the group members of every provider that maps groups, one
+after the other; progress counts the providers. The first failure stops it,
+the providers synced before keep their members.
+*/
+func (s *Server) syncGroups(ctx context.Context, progress func(done int, total int)) ([]groupSyncResult, error) {
+	var providers []auth.Provider
+	for _, provider := range s.config.Providers {
+		if _, ok := provider.(auth.Groups); ok {
+			providers = append(providers, provider)
+		}
+	}
+	results := []groupSyncResult{}
+	for i, provider := range providers {
+		progress(i, len(providers))
+		result, err := s.syncGroup(ctx, provider.Name(), provider.(auth.Groups))
+		if errors.Is(err, auth.ErrNoGroups) {
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	progress(len(providers), len(providers))
+	return results, nil
+}
+
+// groupSections lists the sections the groups of mail put them in
+func (s *Server) groupSections(mail string) ([]string, error) {
+	members, err := s.repo.GetGroupMembers(db.GroupMemberFilter{Mail: strings.ToLower(mail)})
+	if err != nil {
+		return nil, err
+	}
+	var sections []string
+	for _, member := range members {
+		if member.Section != "" && !containsString(sections, member.Section) {
+			sections = append(sections, member.Section)
+		}
+	}
+	return sections, nil
+}
+
+// groupSectionMembers lists the users the groups put in section
+func (s *Server) groupSectionMembers(section string) ([]string, error) {
+	members, err := s.repo.GetGroupMembers(db.GroupMemberFilter{Section: section})
+	if err != nil {
+		return nil, err
+	}
+	var mails []string
+	for _, member := range members {
+		if !containsString(mails, member.Mail) {
+			mails = append(mails, member.Mail)
+		}
+	}
+	return mails, nil
+}
+
+// groupStaff tells whether the groups of mail make them staff
+func (s *Server) groupStaff(mail string) (bool, error) {
+	members, err := s.repo.GetGroupMembers(db.GroupMemberFilter{Mail: strings.ToLower(mail), Role: auth.RoleStaff})
+	return len(members) > 0, err
+}
+
+func (s *Server) syncGroupsTask() jobs.TaskFunc {
+	return func(ctx context.Context, progress func(done int, total int)) (interface{}, error) {
+		return s.syncGroups(ctx, progress)
+	}
+}
+
+// Lists the sections and roles the groups give users, of one user with mail, in one section or with one role
+func (s *Server) groupsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Mail    string `param:"mail"`
+		Section string `param:"section"`
+		Role    string `param:"role"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	if query.Role != "" && query.Role != auth.RoleStudent && query.Role != auth.RoleStaff {
+		http.Error(w, "Invalid role value", http.StatusBadRequest)
+		return
+	}
+	members, err := s.repo.GetGroupMembers(db.GroupMemberFilter{Mail: strings.ToLower(query.Mail),
+		Section: query.Section, Role: query.Role})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, members)
+}
+
+// Starts a group sync in the background; the task's result has a groupSyncResult per provider
+func (s *Server) syncGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	s.audit(r, auditSyncGroups, "", "")
+	s.submitTask(w, r, taskSyncGroups, s.syncGroupsTask())
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest accepted semester and label of a timetable version, in bytes
+const (
+	maxSemesterLength     = 32
+	maxVersionLabelLength = 128
+)
+
+// A period that is in both timetables of a diff with another subject, faculty member or span
+type timetableChange struct {
+	From db.StaticEntry `json:"from"`
+	To   db.StaticEntry `json:"to"`
+}
+
+type timetableDiff struct {
+	Added   []db.StaticEntry  `json:"added"`
+	Removed []db.StaticEntry  `json:"removed"`
+	Changed []timetableChange `json:"changed"`
+}
+
+// diffTimetables compares two timetables period by period; versions do not count as a change
+func diffTimetables(from []db.StaticEntry, to []db.StaticEntry) timetableDiff {
+	diff := timetableDiff{Added: []db.StaticEntry{}, Removed: []db.StaticEntry{}, Changed: []timetableChange{}}
+	type key struct {
+		class string
+		day   string
+		slot  int
+	}
+	before := make(map[key]db.StaticEntry, len(from))
+	for _, entry := range from {
+		before[key{entry.Class, entry.Day, entry.Slot}] = entry
+	}
+	after := make(map[key]bool, len(to))
+	for _, entry := range to {
+		after[key{entry.Class, entry.Day, entry.Slot}] = true
+		old, ok := before[key{entry.Class, entry.Day, entry.Slot}]
+		if !ok {
+			diff.Added = append(diff.Added, entry)
+			continue
+		}
+		if old.Subject != entry.Subject || old.Faculty != entry.Faculty || max1(old.Span) != max1(entry.Span) {
+			diff.Changed = append(diff.Changed, timetableChange{From: old, To: entry})
+		}
+	}
+	for _, entry := range from {
+		if !after[key{entry.Class, entry.Day, entry.Slot}] {
+			diff.Removed = append(diff.Removed, entry)
+		}
+	}
+	return diff
+}
+
+func (s *Server) writeHistory(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	s.writeJSON(w, r, status, v)
+}
+
+// snapshotTimetable saves the current timetable as a version and returns it without its entries
+func (s *Server) snapshotTimetable(r *http.Request, semester string, label string) (db.TimetableVersion, error) {
+	return s.snapshotTimetableAs(adminActor(r), semester, label)
+}
+
+// snapshotTimetableAs is snapshotTimetable for a version createdBy someone other than the request's user, like a job
+func (s *Server) snapshotTimetableAs(createdBy string, semester string, label string) (db.TimetableVersion, error) {
+	entries, err := s.repo.GetStatic(db.TimetableFilter{})
+	if err != nil {
+		return db.TimetableVersion{}, err
+	}
+	version := db.TimetableVersion{
+		Semester:  semester,
+		Label:     label,
+		Size:      len(entries),
+		Entries:   entries,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}
+	version.ID, err = s.repo.CreateTimetableVersion(version)
+	version.Entries = nil
+	return version, err
+}
+
+// Lists the saved versions of the timetable, the latest first; semester narrows it down
+func (s *Server) timetableVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Semester string `param:"semester"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	versions, err := s.repo.GetTimetableVersions(query.Semester)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if versions == nil {
+		versions = []db.TimetableVersion{}
+	}
+	s.writeHistory(w, r, http.StatusOK, versions)
+}
+
+// Saves the current timetable as a version of the semester parameter, with an optional label
+func (s *Server) createTimetableVersionHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Semester string `param:"semester,required"`
+		Label    string `param:"label"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	semester, label := query.Semester, query.Label
+	if len(semester) > maxSemesterLength {
+		http.Error(w, "Invalid semester value", http.StatusBadRequest)
+		return
+	}
+	if len(label) > maxVersionLabelLength {
+		http.Error(w, "Invalid label value", http.StatusBadRequest)
+		return
+	}
+	version, err := s.snapshotTimetable(r, semester, label)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditCreateSnapshot, strconv.FormatInt(version.ID, 10), semester+" "+label)
+	s.writeHistory(w, r, http.StatusCreated, version)
+}
+
+/*
+timetableVersion reads the version whose ID is given by name, a path or query
+parameter. On failure it has already written the error response.
+*/
+func (s *Server) timetableVersion(w http.ResponseWriter, name string, idStr string) (db.TimetableVersion, bool) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid "+name+" value", http.StatusBadRequest)
+		return db.TimetableVersion{}, false
+	}
+	version, err := s.repo.GetTimetableVersion(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such version", http.StatusNotFound)
+		return db.TimetableVersion{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.TimetableVersion{}, false
+	}
+	return version, true
+}
+
+func (s *Server) timetableVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version, ok := s.timetableVersion(w, "id", router.Param(r, "id"))
+	if !ok {
+		return
+	}
+	if version.Entries == nil {
+		version.Entries = []db.StaticEntry{}
+	}
+	s.writeHistory(w, r, http.StatusOK, version)
+}
+
+func (s *Server) deleteTimetableVersionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	rowsAffected, err := s.repo.DeleteTimetableVersion(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such version", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteSnapshot, strconv.FormatInt(id, 10), "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists the periods added, removed and changed from the version from to the version to, the current timetable when to is not given
+func (s *Server) timetableDiffHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		From string `param:"from"`
+		To   string `param:"to"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	from, ok := s.timetableVersion(w, "from", query.From)
+	if !ok {
+		return
+	}
+	var to []db.StaticEntry
+	if query.To != "" {
+		version, ok := s.timetableVersion(w, "to", query.To)
+		if !ok {
+			return
+		}
+		to = version.Entries
+	} else {
+		var err error
+		to, err = s.repo.GetStatic(db.TimetableFilter{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	s.writeHistory(w, r, http.StatusOK, diffTimetables(from.Entries, to))
+}
+
+// rollbackConflicts describes the upcoming bookings in periods that entries has a class in
+func (s *Server) rollbackConflicts(entries []db.StaticEntry) ([]string, error) {
+	bookings, err := s.repo.GetBookings(db.BookingFilter{StartDate: calendar.Today(s.config.Location)})
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []string
+	for _, booking := range bookings {
+		day := calendar.DayCode(booking.Date.Weekday())
+		for _, entry := range entries {
+			if entry.Class == booking.Class && entry.Day == day && entry.Subject != "FREE" &&
+				entry.Slot <= booking.Slot && booking.Slot < entry.Slot+max1(entry.Span) {
+				conflicts = append(conflicts, fmt.Sprintf("%s is booked by %s on %s, slot %d, which would be %s",
+					booking.Class, booking.Faculty, booking.Date.Format(calendar.DateLayout), booking.Slot, entry.Subject))
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+/*
+rollbackTimetableHandler puts the timetable back the way it was in a version,
+all at once. The timetable it replaces is saved as a version first, which the
+response describes, so the rollback can be rolled back too. With dryRun=true
+the preview has the diff from the current timetable and the upcoming bookings
+in periods that would stop being free.
+*/
+func (s *Server) rollbackTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	version, ok := s.timetableVersion(w, "id", router.Param(r, "id"))
+	if !ok {
+		return
+	}
+	dryRun, ok := parseDryRun(w, r)
+	if !ok {
+		return
+	}
+	if dryRun {
+		current, err := s.repo.GetStatic(db.TimetableFilter{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		conflicts, err := s.rollbackConflicts(version.Entries)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.writePreview(w, r, diffTimetables(current, version.Entries), conflicts)
+		return
+	}
+	backup, err := s.snapshotTimetable(r, version.Semester, "Before rolling back to "+strconv.FormatInt(version.ID, 10))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.repo.ReplaceStatic(version.Entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.timetableChanged()
+	s.audit(r, auditRollbackTimetable, strconv.FormatInt(version.ID, 10), "backup "+strconv.FormatInt(backup.ID, 10))
+	s.writeHistory(w, r, http.StatusOK, backup)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+// Form of UTC date-times in iCalendar
+const icsTimeLayout = "20060102T150405Z"
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+// An event of the calendar feed
+type icsEvent struct {
+	UID      string
+	Start    time.Time
+	End      time.Time
+	Summary  string
+	Location string
+	// Repeats every week from Start on
+	Weekly bool
+}
+
+/*
+writeICS renders events as an RFC 5545 calendar. Lines are folded at 75
+octets, taking care not to split a UTF-8 sequence.
+*/
+func writeICS(name string, events []icsEvent, now time.Time) []byte {
+	var b bytes.Buffer
+	line := func(content string) {
+		for len(content) > 75 {
+			cut := 75
+			for cut > 0 && content[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(content[:cut] + "\r\n ")
+			content = content[cut:]
+		}
+		b.WriteString(content + "\r\n")
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//CORA//coraserver//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + icsEscaper.Replace(name))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.UID)
+		line("DTSTAMP:" + now.UTC().Format(icsTimeLayout))
+		line("DTSTART:" + event.Start.UTC().Format(icsTimeLayout))
+		line("DTEND:" + event.End.UTC().Format(icsTimeLayout))
+		if event.Weekly {
+			line("RRULE:FREQ=WEEKLY")
+		}
+		line("SUMMARY:" + icsEscaper.Replace(event.Summary))
+		if event.Location != "" {
+			line("LOCATION:" + icsEscaper.Replace(event.Location))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return b.Bytes()
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// Set on a response that is the stored one of an earlier request with the same key
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	// Longest accepted key, a UUID is 36 characters
+	maxIdempotencyKey = 255
+	// Larger responses are sent but not kept, a retry runs the request again
+	maxIdempotentResponse = 1 << 20
+)
+
+// The headers of a response that are replayed with it
+var idempotentHeaders = []string{"Content-Type", "Location", "ETag", "Cache-Control", "Content-Disposition"}
+
+// A response kept for the retries of its request
+type idempotentResponse struct {
+	// Of the request the key was first used with, see requestFingerprint
+	Fingerprint string            `json:"fingerprint"`
+	Status      int               `json:"status"`
+	Header      map[string]string `json:"header"`
+	Body        []byte            `json:"body"`
+}
+
+// The keys of the requests running right now, whose retries have to wait for them
+type idempotencyLocks struct {
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func (l *idempotencyLocks) lock(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[key] {
+		return false
+	}
+	if l.running == nil {
+		l.running = make(map[string]bool)
+	}
+	l.running[key] = true
+	return true
+}
+
+func (l *idempotencyLocks) unlock(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.running, key)
+}
+
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+func (w *idempotencyRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.body.Len()+len(p) > maxIdempotentResponse {
+		w.tooLarge = true
+		w.body.Reset()
+	}
+	if !w.tooLarge {
+		w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *idempotencyRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+/*
+idempotencyScope tells apart the clients using a key: by the credentials sent,
+or the address of an anonymous one. Two users picking the same key get their
+own responses.
+*/
+func (s *Server) idempotencyScope(r *http.Request) string {
+	hash := sha256.New()
+	hash.Write([]byte(s.config.Tenant + "\n" + r.Header.Get("Authorization") + "\n" +
+		r.Header.Get(apiKeyHeader) + "\n" + r.Header.Get("X-Admin-Key") + "\n"))
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		hash.Write([]byte(cookie.Value))
+	}
+	hash.Write([]byte("\n"))
+	if r.Header.Get("Authorization") == "" && r.Header.Get(apiKeyHeader) == "" && r.Header.Get("X-Admin-Key") == "" {
+		hash.Write([]byte(clientIP(r)))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// requestFingerprint sums up a request, to refuse a key used again for a different one
+func requestFingerprint(r *http.Request, body []byte) string {
+	sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+idempotent makes a request sent with an Idempotency-Key header safe to retry:
+the response to the first request with a key is kept for the idempotency
+window, and a retry with the same key gets it back, with an
+Idempotent-Replayed header, instead of running again. Server errors and rate
+limits are not kept, their retry runs. A retry while the first request is
+still running gets a 409, and the key used again for a different request a
+422. Requests without the header run as usual.
+*/
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey || !printableASCII(key) {
+			http.Error(w, "Invalid Idempotency-Key value", http.StatusBadRequest)
+			return
+		}
+		// Read whole to fingerprint it, so no more than an upload may be
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxUploadBytes+multipartOverhead))
+		if err != nil {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		fingerprint := requestFingerprint(r, body)
+		cacheKey := "idempotency:" + s.idempotencyScope(r) + ":" + key
+
+		if !s.idempotency.lock(cacheKey) {
+			http.Error(w, "A request with this Idempotency-Key is still running", http.StatusConflict)
+			return
+		}
+		defer s.idempotency.unlock(cacheKey)
+		if stored, ok := s.cache.Get(cacheKey); ok {
+			var response idempotentResponse
+			if err := json.Unmarshal(stored, &response); err == nil {
+				if response.Fingerprint != fingerprint {
+					http.Error(w, "Idempotency-Key was used for a different request", http.StatusUnprocessableEntity)
+					return
+				}
+				for name, value := range response.Header {
+					w.Header().Set(name, value)
+				}
+				w.Header().Set(idempotentReplayedHeader, "true")
+				w.WriteHeader(response.Status)
+				w.Write(response.Body)
+				return
+			}
+			s.logger.Println("Error reading stored response", err)
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		if recorder.tooLarge || recorder.status >= 500 || recorder.status == http.StatusTooManyRequests {
+			return
+		}
+		response := idempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      recorder.status,
+			Header:      make(map[string]string),
+			Body:        recorder.body.Bytes(),
+		}
+		for _, name := range idempotentHeaders {
+			if value := w.Header().Get(name); value != "" {
+				response.Header[name] = value
+			}
+		}
+		stored, err := json.Marshal(response)
+		if err != nil {
+			s.logger.Println("Error marshalling data", err)
+			return
+		}
+		s.cache.Set(cacheKey, stored, s.config.IdempotencyWindow)
+	})
+}
+
+// idempotentPosts is idempotent for the POST requests, the others go straight to next
+func (s *Server) idempotentPosts(next http.Handler) http.Handler {
+	idempotent := s.idempotent(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			idempotent.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func printableASCII(value string) bool {
+	for idx := 0; idx < len(value); idx++ {
+		if value[idx] < 0x21 || value[idx] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Set on every response to a request made with an impersonation session, to the admin behind it
+const impersonationHeader = "X-Cora-Impersonated-By"
+
+const (
+	defaultImpersonation = time.Hour
+	maxImpersonation     = 8 * time.Hour
+)
+
+type impersonationResponse struct {
+	Session sessionResponse `json:"session"`
+	User    db.User         `json:"user"`
+}
+
+/*
+impersonating flags a request made by an admin acting as a user: clients show
+a banner when the header is set, and everything but a GET is audited with the
+admin as the actor.
+*/
+func (s *Server) impersonating(w http.ResponseWriter, r *http.Request, session db.Session) {
+	w.Header().Set(impersonationHeader, session.ImpersonatedBy)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.auditAs(session.ImpersonatedBy, auditImpersonatedRequest, session.Mail, r.Method+" "+r.URL.Path)
+	}
+}
+
+/*
+Starts acting as the user of the directory given by the user parameter, for
+duration (1h by default, at most 8h). The answer has a session of that user to
+send like their own, marked with the admin, which shows up in their session
+list and can be ended with DELETE /admin/impersonations/{id} or a logout.
+*/
+func (s *Server) impersonateHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		User     int64          `param:"user,required"`
+		Duration *time.Duration `param:"duration"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	duration := defaultImpersonation
+	if query.Duration != nil {
+		duration = *query.Duration
+	}
+	if duration <= 0 || duration > maxImpersonation {
+		http.Error(w, "Invalid duration value", http.StatusBadRequest)
+		return
+	}
+	user, err := s.repo.GetUser(query.User)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such user", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if user.Disabled {
+		http.Error(w, "The user is disabled", http.StatusConflict)
+		return
+	}
+	sessionID, err := s.sessionID()
+	if err != nil {
+		s.logger.Println("Error generating session ID", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	actor := adminActor(r)
+	now := time.Now()
+	session := db.Session{
+		ID:        sessionID,
+		Provider:  user.Provider,
+		Mail:      user.Mail,
+		Name:      user.GivenName,
+		Device:    "Impersonated by " + actor,
+		IP:        clientIP(r),
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+
+		UserID:         user.ID,
+		ImpersonatedBy: actor,
+	}
+	err = s.repo.CreateSession(session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditStartImpersonation, user.Mail, "until "+session.ExpiresAt.Format(time.RFC3339))
+	s.writeJSON(w, r, http.StatusCreated, impersonationResponse{
+		Session: sessionResponse{ID: session.ID, ExpiresAt: session.ExpiresAt, UserID: user.ID},
+		User:    user,
+	})
+}
+
+// Ends an impersonation before it expires; sessions users logged in with themselves cannot be ended here
+func (s *Server) endImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := s.repo.GetSession(router.Param(r, "id"))
+	if err == sql.ErrNoRows || (err == nil && session.ImpersonatedBy == "") {
+		http.Error(w, "No such impersonation", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.endSession(r, session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/notify"
+)
+
+/*
+inbox keeps every message in the repository, for /me/notifications, before
+handing it to the Notifier that delivers it. Users with the app closed when a
+message was pushed still find it there.
+*/
+type inbox struct {
+	repo   db.Repository
+	next   notify.Notifier
+	logger *log.Logger
+}
+
+func (i inbox) Notify(msg notify.Message) {
+	_, err := i.repo.AddNotification(db.Notification{Mail: strings.ToLower(msg.To), Kind: msg.Kind,
+		Title: msg.Title, Body: msg.Body, CreatedAt: time.Now()})
+	if err != nil {
+		i.logger.Println("Error keeping the notification to", msg.To, err)
+	}
+	i.next.Notify(msg)
+}
+
+type inboxResponse struct {
+	Unread        int               `json:"unread"`
+	Notifications []db.Notification `json:"notifications"`
+}
+
+/*
+myNotificationsHandler lists the user's latest notifications, up to limit (50
+by default), only the unread ones with unread=true, with how many are unread
+*/
+func (s *Server) myNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, 50)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Unread bool `param:"unread"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	mail := strings.ToLower(currentSession(r).Mail)
+	notifications, err := s.repo.GetNotifications(mail, query.Unread, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := inboxResponse{Notifications: notifications}
+	if response.Notifications == nil {
+		response.Notifications = []db.Notification{}
+	}
+	response.Unread, err = s.repo.CountUnreadNotifications(mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+}
+
+// Only how many of the user's notifications are unread, for a badge
+func (s *Server) myUnreadHandler(w http.ResponseWriter, r *http.Request) {
+	unread, err := s.repo.CountUnreadNotifications(strings.ToLower(currentSession(r).Mail))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, struct {
+		Unread int `json:"unread"`
+	}{unread})
+}
+
+/*
+readNotificationsHandler marks the user's notifications with the ids in id
+("4,7") read, or all of them without it, and answers with how many are left
+unread
+*/
+func (s *Server) readNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		IDs []int64 `param:"id"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	ids := query.IDs
+	mail := strings.ToLower(currentSession(r).Mail)
+	_, err := s.repo.MarkNotificationsRead(mail, ids, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.myUnreadHandler(w, r)
+}
+
+// PurgeNotifications deletes the notifications sent longer than the retention period before now
+func (s *Server) PurgeNotifications(now time.Time) int64 {
+	purged, err := s.repo.PurgeNotifications(now.Add(-s.config.NotificationRetention))
+	if err != nil {
+		s.logger.Println("Error purging notifications", err)
+	}
+	return purged
+}
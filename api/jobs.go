@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/jobs"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Names of the background jobs, as used in Config.JobSchedules and /admin/jobs
+const (
+	jobCheckInSweep        = "checkin-sweep"
+	jobAttendanceAlerts    = "attendance-alerts"
+	jobAssignmentReminders = "assignment-reminders"
+	jobTrashPurge          = "trash-purge"
+	jobSessionCleanup      = "session-cleanup"
+	jobDirectorySync       = "directory-sync"
+	jobNotificationPurge   = "notification-purge"
+	jobDigests             = "digests"
+	jobRetentionPurge      = "retention-purge"
+	jobERPImport           = "erp-import"
+)
+
+// JobOff in Config.JobSchedules keeps a job from running on its own; it can still be run from /admin/jobs
+const JobOff = "off"
+
+// Default schedules of the background jobs, see jobs.Parse; cron ones are in Config.Location
+var defaultJobSchedules = []struct {
+	name string
+	spec string
+}{
+	// Bookings nobody checked in to
+	{jobCheckInSweep, "@every 1m"},
+	// The day's attendance alerts, every night
+	{jobAttendanceAlerts, "0 21 * * *"},
+	// Assignments coming due
+	{jobAssignmentReminders, "@every 15m"},
+	// Trash older than the retention period
+	{jobTrashPurge, "@hourly"},
+	// Expired sessions, which GetSession already ignores
+	{jobSessionCleanup, "@daily"},
+	// Users added to or removed from the directories of providers that sync them, and the members of their mapped groups
+	{jobDirectorySync, "@daily"},
+	// Notifications older than their retention period
+	{jobNotificationPurge, "@daily"},
+	// Digests of the next day or week, in the evening
+	{jobDigests, "0 19 * * *"},
+	// Data older than its retention period, at night
+	{jobRetentionPurge, "0 3 * * *"},
+	// Classrooms, courses and the timetable from the ERP
+	{jobERPImport, "@daily"},
+}
+
+// ValidateJobSchedules checks the job names and schedules of Config.JobSchedules
+func ValidateJobSchedules(schedules map[string]string) error {
+	for name, spec := range schedules {
+		known := false
+		for _, job := range defaultJobSchedules {
+			known = known || job.name == name
+		}
+		if !known {
+			return fmt.Errorf("no job is called %q", name)
+		}
+		if spec == JobOff {
+			continue
+		}
+		if _, err := jobs.Parse(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jobFuncs does what each job does, by name
+func (s *Server) jobFuncs() map[string]jobs.Func {
+	return map[string]jobs.Func{
+		jobCheckInSweep: func(ctx context.Context, now time.Time) error {
+			if released := s.ReleaseUnusedBookings(now); released > 0 {
+				s.logger.Println("Released", released, "bookings nobody checked in to")
+			}
+			return nil
+		},
+		jobAttendanceAlerts: func(ctx context.Context, now time.Time) error {
+			if sent := s.SendAttendanceAlerts(calendar.Date(now, s.config.Location)); sent > 0 {
+				s.logger.Println("Sent", sent, "attendance alerts")
+			}
+			return nil
+		},
+		jobAssignmentReminders: func(ctx context.Context, now time.Time) error {
+			s.SendAssignmentReminders(now)
+			return nil
+		},
+		jobTrashPurge: func(ctx context.Context, now time.Time) error {
+			if purged := s.PurgeTrash(now); purged > 0 {
+				s.logger.Println("Purged", purged, "deleted items")
+			}
+			return nil
+		},
+		jobSessionCleanup: func(ctx context.Context, now time.Time) error {
+			deleted, err := s.repo.DeleteExpiredSessions(now)
+			if deleted > 0 {
+				s.logger.Println("Deleted", deleted, "expired sessions")
+			}
+			return err
+		},
+		jobNotificationPurge: func(ctx context.Context, now time.Time) error {
+			if purged := s.PurgeNotifications(now); purged > 0 {
+				s.logger.Println("Purged", purged, "old notifications")
+			}
+			return nil
+		},
+		jobDigests: func(ctx context.Context, now time.Time) error {
+			if sent := s.SendDigests(now); sent > 0 {
+				s.logger.Println("Sent", sent, "digests")
+			}
+			return nil
+		},
+		jobRetentionPurge: func(ctx context.Context, now time.Time) error {
+			for kind, purged := range s.PurgeExpired(now) {
+				s.logger.Println("Purged", purged, kind, "past their retention")
+			}
+			return nil
+		},
+		jobERPImport: func(ctx context.Context, now time.Time) error {
+			for _, importer := range s.config.Importers {
+				result, err := s.runImport(ctx, importer, "job:"+jobERPImport, false)
+				if err != nil {
+					return fmt.Errorf("%s: %v", importer.Name(), err)
+				}
+				for _, conflict := range result.Conflicts {
+					s.logger.Println("Import from", importer.Name()+":", conflict)
+				}
+			}
+			return nil
+		},
+		jobDirectorySync: func(ctx context.Context, now time.Time) error {
+			results, err := s.syncDirectories(ctx, func(int, int) {})
+			for _, result := range results {
+				if result.Updated > 0 || result.Removed > 0 {
+					s.logger.Println("Synced", result.Updated, "users and removed", result.Removed, "from", result.Provider)
+				}
+			}
+			if err != nil {
+				return err
+			}
+			groups, err := s.syncGroups(ctx, func(int, int) {})
+			for _, result := range groups {
+				s.logger.Println("Synced", result.Members, "group members from", result.Provider)
+			}
+			return err
+		},
+	}
+}
+
+/*
+newScheduler adds every job to a scheduler, on its schedule in
+Config.JobSchedules or the default one. A job turned off is added paused, so
+it still shows up and can be run by hand.
+*/
+func (s *Server) newScheduler() *jobs.Scheduler {
+	scheduler := jobs.New(s.config.Location, s.logger)
+	funcs := s.jobFuncs()
+	for _, job := range defaultJobSchedules {
+		spec := job.spec
+		configured := s.config.JobSchedules[job.name]
+		if configured != "" && configured != JobOff {
+			if _, err := jobs.Parse(configured); err != nil {
+				s.logger.Println("Keeping the default schedule of", job.name+":", err)
+			} else {
+				spec = configured
+			}
+		}
+		err := scheduler.Add(job.name, spec, funcs[job.name])
+		if err != nil {
+			panic(err)
+		}
+		if configured == JobOff {
+			scheduler.Pause(job.name)
+		}
+	}
+	return scheduler
+}
+
+// StartJobs starts running the background jobs on their schedules
+func (s *Server) StartJobs() {
+	s.jobs.Start()
+}
+
+/*
+StopJobs keeps the background jobs and tasks from starting again and waits for
+the ones going to finish, or for ctx to be done, for a graceful shutdown. Tasks
+still waiting for a worker fail.
+*/
+func (s *Server) StopJobs(ctx context.Context) error {
+	jobsErr := s.jobs.Stop(ctx)
+	err := s.tasks.Stop(ctx)
+	if jobsErr != nil {
+		return jobsErr
+	}
+	return err
+}
+
+// Lists the background jobs with when they last and next run and how the last run went
+func (s *Server) jobsHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, r, http.StatusOK, s.jobs.Status())
+}
+
+// writeJobError answers a failed job request
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrUnknownJob):
+		http.Error(w, "No such job", http.StatusNotFound)
+	case errors.Is(err, jobs.ErrRunning):
+		http.Error(w, "The job is already running", http.StatusConflict)
+	case errors.Is(err, jobs.ErrStopped):
+		http.Error(w, "The server is shutting down", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// Starts a run of a job right away; it goes on in the background, /admin/jobs tells how it went
+func (s *Server) runJobHandler(w http.ResponseWriter, r *http.Request) {
+	name := router.Param(r, "name")
+	err := s.jobs.RunNow(name)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	s.audit(r, auditRunJob, name, "")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Stops a job from running on its schedule until it is resumed or the server restarts
+func (s *Server) pauseJobHandler(w http.ResponseWriter, r *http.Request) {
+	name := router.Param(r, "name")
+	err := s.jobs.Pause(name)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	s.audit(r, auditPauseJob, name, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) resumeJobHandler(w http.ResponseWriter, r *http.Request) {
+	name := router.Param(r, "name")
+	err := s.jobs.Resume(name)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	s.audit(r, auditResumeJob, name, "")
+	w.WriteHeader(http.StatusNoContent)
+}
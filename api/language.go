@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+)
+
+/*
+requestLanguage is the language to answer r in: the one the user logged in to
+it picked in their preferences, else the best of the Accept-Language header.
+*/
+func (s *Server) requestLanguage(r *http.Request) string {
+	if lang := s.requestPreferences(r).Language; lang != "" {
+		return lang
+	}
+	return i18n.Language(r.Header.Get("Accept-Language"))
+}
+
+// userLanguage is the language mail picked in their preferences, English when none
+func (s *Server) userLanguage(mail string) string {
+	if lang := s.userPreferences(mail).Language; lang != "" {
+		return lang
+	}
+	return i18n.English
+}
+
+// notifyUser sends mail a notification of kind in their language
+func (s *Server) notifyUser(mail string, kind string, title i18n.Message, body i18n.Message) {
+	lang := s.userLanguage(mail)
+	s.config.Notifier.Notify(notify.Message{To: mail, Kind: kind, Title: title.In(lang), Body: body.In(lang)})
+}
+
+/*
+localizeErrors translates the plain text errors handlers answer with
+http.Error to the language of the request, see requestLanguage, and says which
+it is in a Content-Language header. Other responses pass untouched, so do
+errors without a translation.
+*/
+func (s *Server) localizeErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lw := &localizedWriter{ResponseWriter: w, s: s, r: r}
+		next.ServeHTTP(lw, r)
+		// An error without text
+		lw.sendHeader()
+	})
+}
+
+type localizedWriter struct {
+	http.ResponseWriter
+	s *Server
+	r *http.Request
+	// Of an error between its header and its text, which is sent with it; -1 once sent
+	status int
+}
+
+func (w *localizedWriter) WriteHeader(status int) {
+	if status >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") && w.status == 0 {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *localizedWriter) Write(p []byte) (int, error) {
+	if w.status <= 0 {
+		return w.ResponseWriter.Write(p)
+	}
+	n := len(p)
+	lang := w.s.requestLanguage(w.r)
+	message := strings.TrimSuffix(string(p), "\n")
+	if translated := i18n.Translate(lang, message); translated != message {
+		w.Header().Set("Content-Language", lang)
+		p = []byte(translated + "\n")
+	}
+	w.sendHeader()
+	if _, err := w.ResponseWriter.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// sendHeader sends the header of an error held back for its text
+func (w *localizedWriter) sendHeader() {
+	if w.status > 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+		w.status = -1
+	}
+}
+
+func (w *localizedWriter) Flush() {
+	w.sendHeader()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+/*
+A session as shown to its owner. The session ID is a bearer secret so it is
+never listed; sessions are referred to by a hash of it instead.
+*/
+type sessionInfo struct {
+	ID           string    `json:"id"`
+	Provider     string    `json:"provider"`
+	Device       string    `json:"device"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	Current      bool      `json:"current"`
+}
+
+func sessionHandle(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Lists the active sessions of the logged in user
+func (s *Server) mySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	current := currentSession(r)
+	sessions, err := s.repo.GetUserSessions(current.Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := make([]sessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionInfo{
+			ID:           sessionHandle(session.ID),
+			Provider:     session.Provider,
+			Device:       session.Device,
+			IP:           session.IP,
+			CreatedAt:    session.CreatedAt,
+			LastActiveAt: session.LastActiveAt,
+			ExpiresAt:    session.ExpiresAt,
+			Current:      session.ID == current.ID,
+		})
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+}
+
+// Ends one of the user's sessions, the id is the one from the listing
+func (s *Server) deleteMySessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.repo.GetUserSessions(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	handle := router.Param(r, "id")
+	for _, session := range sessions {
+		if sessionHandle(session.ID) == handle {
+			err = s.endSession(r, session)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	http.Error(w, "No such session", http.StatusNotFound)
+}
@@ -0,0 +1,469 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+type organizationResponse struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+type sessionResponse struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// The user in the user directory, 0 when they could not be saved
+	UserID int64 `json:"userId"`
+}
+
+type oauthExchangeResponse struct {
+	Profile      auth.Identity        `json:"profile"`
+	Organization organizationResponse `json:"organization"`
+	Session      sessionResponse      `json:"session"`
+}
+
+func (s *Server) oauthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	s.providerLogin(w, r, s.config.DefaultProvider)
+}
+
+func (s *Server) oauthExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	s.providerExchange(w, r, s.config.DefaultProvider)
+}
+
+func (s *Server) oauthProviderLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.config.Providers[router.Param(r, "provider")]
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+	s.providerLogin(w, r, provider)
+}
+
+func (s *Server) oauthProviderExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.config.Providers[router.Param(r, "provider")]
+	if !ok {
+		http.Error(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+	s.providerExchange(w, r, provider)
+}
+
+/*
+providerLogin redirects to the provider with a fresh state and PKCE challenge.
+The matching verifier stays on the server until the code comes back to
+providerExchange along with the state.
+*/
+func (s *Server) providerLogin(w http.ResponseWriter, r *http.Request, provider auth.Provider) {
+	verifier, err := auth.NewCodeVerifier()
+	if err != nil {
+		s.logger.Println("Error generating code verifier", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stateToken, err := token.URLSafe(s.config.TokenBytes)
+	if err != nil {
+		s.logger.Println("Error generating state", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state := db.OAuthState{
+		State:        stateToken,
+		Provider:     provider.Name(),
+		CodeVerifier: verifier,
+		CreatedAt:    time.Now(),
+	}
+	err = s.repo.SaveOAuthState(state)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	options := append(provider.AuthCodeOptions(), auth.ChallengeOptions(verifier)...)
+	authURL := provider.OAuth2().AuthCodeURL(state.State, options...)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// profileStore keeps the profiles identity providers cache in the database
+type profileStore struct {
+	repo db.Repository
+}
+
+func (p profileStore) LoadProfile(provider string, userID string) ([]byte, time.Time, error) {
+	profile, err := p.repo.GetProfile(provider, userID)
+	return profile.Data, profile.FetchedAt, err
+}
+
+func (p profileStore) SaveProfile(provider string, userID string, data []byte, fetchedAt time.Time) error {
+	return p.repo.SaveProfile(db.Profile{Provider: provider, UserID: userID, Data: data, FetchedAt: fetchedAt})
+}
+
+// sessionID makes the ID of a new session, which starts with the tenant when there is one
+func (s *Server) sessionID() (string, error) {
+	sessionID, err := token.Hex(s.config.TokenBytes)
+	if err == nil && s.config.Tenant != "" {
+		sessionID = s.config.Tenant + tenantSeparator + sessionID
+	}
+	return sessionID, err
+}
+
+/*
+identityErrorStatus maps an error from a provider lookup to the status we
+answer with: 502 when the provider itself is failing or unreachable, 403 when it
+refused the token or the user is not part of the institution.
+*/
+func identityErrorStatus(err error) int {
+	if auth.Unavailable(err) {
+		return http.StatusBadGateway
+	}
+	return http.StatusForbidden
+}
+
+/*
+providerExchange accepts the code in one of two ways
+  - state: the login was started by providerLogin, the verifier is looked up
+  - code_verifier (and optionally redirect_uri): the mobile app sent the user
+    to the provider itself with its own PKCE challenge, we only exchange
+*/
+func (s *Server) providerExchange(w http.ResponseWriter, r *http.Request, provider auth.Provider) {
+	if !s.checkLockout(w, r) || !s.checkChallenge(w, r) {
+		return
+	}
+	code := r.URL.Query().Get("code")
+	oauthConfig := *provider.OAuth2()
+	verifier := r.URL.Query().Get("code_verifier")
+	if verifier != "" {
+		if !auth.ValidCodeVerifier(verifier) {
+			s.authFailed(r, "", "invalid code_verifier")
+			http.Error(w, "Invalid code_verifier value", http.StatusBadRequest)
+			return
+		}
+		if redirectURL := r.URL.Query().Get("redirect_uri"); redirectURL != "" {
+			if !containsString(s.config.MobileRedirectURLs[provider.Name()], redirectURL) {
+				s.authFailed(r, "", "redirect_uri not allowed")
+				http.Error(w, "redirect_uri is not allowed", http.StatusBadRequest)
+				return
+			}
+			oauthConfig.RedirectURL = redirectURL
+		}
+	} else {
+		state, err := s.repo.TakeOAuthState(r.URL.Query().Get("state"))
+		if err == sql.ErrNoRows || (err == nil && state.Provider != provider.Name()) {
+			s.authFailed(r, "", "invalid or expired state")
+			http.Error(w, "Invalid or expired state", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		verifier = state.CodeVerifier
+	}
+	token, err := oauthConfig.Exchange(r.Context(), code, auth.VerifierOption(verifier))
+	if err != nil {
+		s.logger.Println("Error while exchanging authorization code", err)
+		s.authFailed(r, "", "code exchange failed")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	identity, err := provider.Identity(r.Context(), token)
+	if errors.Is(err, auth.ErrNotMember) {
+		s.authFailed(r, identity.Mail, "not a member of the institution")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("This app is only for members of Amrita Vishwa Vidyapeetham"))
+		return
+	}
+	if err != nil {
+		s.logger.Println("Error getting user identity", err)
+		if !auth.Unavailable(err) {
+			s.authFailed(r, identity.Mail, "identity refused")
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(identityErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	sessionID, err := s.sessionID()
+	if err != nil {
+		s.logger.Println("Error generating session ID", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.loginSucceeded(r, identity.Mail)
+	now := time.Now()
+	userID := s.saveUser(provider.Name(), identity, now)
+	session := db.Session{
+		ID:        sessionID,
+		Provider:  provider.Name(),
+		Mail:      identity.Mail,
+		Name:      identity.GivenName,
+		Device:    requestDevice(r),
+		IP:        clientIP(r),
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionLifetime),
+
+		UserID: userID,
+	}
+	session.RefreshToken, err = s.sealToken(token.RefreshToken)
+	if err == nil {
+		err = s.repo.CreateSession(session)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := oauthExchangeResponse{
+		Profile: identity,
+		Organization: organizationResponse{
+			ID:          identity.Organization.ID,
+			DisplayName: identity.Organization.DisplayName,
+		},
+		Session: sessionResponse{
+			ID:        session.ID,
+			ExpiresAt: session.ExpiresAt,
+			UserID:    session.UserID,
+		},
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	s.writeJSON(w, r, http.StatusOK, response)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+requestSession finds the session the request was made with, either from the
+session cookie or from an "Authorization: Bearer <session id>" header.
+sql.ErrNoRows means there is none or it has expired.
+*/
+func (s *Server) requestSession(r *http.Request) (db.Session, error) {
+	sessionID := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if sessionID == "" {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			sessionID = cookie.Value
+		}
+	}
+	if sessionID == "" {
+		return db.Session{}, sql.ErrNoRows
+	}
+	session, err := s.repo.GetSession(sessionID)
+	if err != nil {
+		return session, err
+	}
+	// Only write when it is worth it, most requests come in bursts
+	now := time.Now()
+	ip := clientIP(r)
+	if now.Sub(session.LastActiveAt) > sessionTouchInterval || ip != session.IP {
+		err = s.repo.TouchSession(session.ID, ip, now)
+		if err != nil {
+			return session, err
+		}
+		session.LastActiveAt = now
+		session.IP = ip
+	}
+	return session, nil
+}
+
+type sessionContextKey struct{}
+
+/*
+requireSession only lets requests with a valid session through. The session
+is put in the request context, handlers get it with currentSession. Everything
+under /me is behind it.
+*/
+func (s *Server) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, err := s.requestSession(r)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not logged in", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if session.ImpersonatedBy != "" {
+			s.impersonating(w, r, session)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
+	})
+}
+
+// currentSession returns the session checked by requireSession
+func currentSession(r *http.Request) db.Session {
+	session, _ := r.Context().Value(sessionContextKey{}).(db.Session)
+	return session
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+/*
+requestDevice names the device a login comes from. The app sends its own name
+in the device parameter, otherwise the User-Agent is boiled down to something
+readable like "Chrome on Android".
+*/
+func requestDevice(r *http.Request) string {
+	device := r.URL.Query().Get("device")
+	if device == "" {
+		device = describeUserAgent(r.UserAgent())
+	}
+	if len(device) > 128 {
+		device = device[:128]
+	}
+	return device
+}
+
+func describeUserAgent(ua string) string {
+	platforms := []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	}
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"Dart/", "CORA app"},
+	}
+	platform, browser := "", ""
+	for _, p := range platforms {
+		if strings.Contains(ua, p.token) {
+			platform = p.name
+			break
+		}
+	}
+	for _, b := range browsers {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	}
+	return "Unknown device"
+}
+
+/*
+endSession revokes the refresh token of the session at its provider, when the
+provider supports it, and deletes the session. A failed revocation is only
+logged, the session is gone either way.
+*/
+func (s *Server) endSession(r *http.Request, session db.Session) error {
+	if session.ImpersonatedBy != "" {
+		s.auditAs(session.ImpersonatedBy, auditEndImpersonation, session.Mail, "")
+	}
+	if session.RefreshToken != "" {
+		if revoker, ok := s.config.Providers[session.Provider].(auth.Revoker); ok {
+			refreshToken, err := s.openToken(session.RefreshToken)
+			if err == nil {
+				err = revoker.Revoke(r.Context(), refreshToken)
+			}
+			if err != nil {
+				s.logger.Println("Error revoking refresh token", err)
+			}
+		}
+	}
+	return s.repo.DeleteSession(session.ID)
+}
+
+func (s *Server) oauthLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := s.requestSession(r)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		err = s.endSession(r, session)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type forceLogoutResponse struct {
+	Sessions int `json:"sessions"`
+}
+
+// Ends every session of the user given by the mail path parameter
+func (s *Server) forceLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	mail := router.Param(r, "mail")
+	sessions, err := s.repo.GetUserSessions(mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var response forceLogoutResponse
+	for _, session := range sessions {
+		err = s.endSession(r, session)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Sessions++
+	}
+	s.audit(r, auditForceLogout, mail, strconv.Itoa(response.Sessions)+" sessions")
+	s.writeJSON(w, r, http.StatusOK, response)
+}
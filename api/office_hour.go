@@ -0,0 +1,553 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+const (
+	// Most office hours a faculty member can publish
+	maxOfficeHours = 20
+	// Longest accepted place of an office hour, in bytes
+	maxPlaceLength = 64
+	// Largest accepted office hours body, in bytes
+	maxOfficeHoursSize = 16 << 10
+	// Longest range of dates an availability covers
+	maxAvailabilityDays = 14
+)
+
+// Lengths of an appointment a student can ask for, in minutes
+var appointmentLengths = []int{15, 30}
+
+// When an appointment holds a faculty member, without who it is with
+type appointmentTime struct {
+	Slot  int       `json:"slot"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// A date as a faculty member's timetable leaves it
+type facultyDay struct {
+	Date time.Time `json:"date"`
+	// Slots taken by periods or bookings
+	Busy []int `json:"busy"`
+	// The office hours that are not taken
+	OfficeHours []db.OfficeHour `json:"officeHours"`
+	Free        []int           `json:"free"`
+	// Appointments asked for or accepted, which the free slots and office hours are not open for
+	Appointments []appointmentTime `json:"appointments"`
+}
+
+/*
+facultyBusy returns the slots in which faculty teaches or has booked a room on
+date: their periods, unless cancelled or taken by a substitute, the periods
+they substitute in and their bookings.
+*/
+func (s *Server) facultyBusy(faculty string, date time.Time) ([]int, error) {
+	var busy []int
+	take := func(slot int, span int) {
+		for taken := slot; taken < slot+max1(span); taken++ {
+			if !containsInt(busy, taken) {
+				busy = append(busy, taken)
+			}
+		}
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Faculty: faculty, Day: calendar.DayCode(date.Weekday())})
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Subject == "FREE" {
+			continue
+		}
+		override, found, err := s.existingOverride(entry, date)
+		if err != nil {
+			return nil, err
+		}
+		if found && (override.Cancelled || (override.Faculty != "" && !strings.EqualFold(override.Faculty, faculty))) {
+			continue
+		}
+		take(entry.Slot, entry.Span)
+	}
+	overrides, err := s.repo.GetOverrides(date, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		if !override.Cancelled && strings.EqualFold(override.Faculty, faculty) {
+			take(override.Slot, override.Span)
+		}
+	}
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Faculty: faculty, StartDate: date, EndDate: date})
+	if err != nil {
+		return nil, err
+	}
+	for _, booking := range bookings {
+		take(booking.Slot, 1)
+	}
+	sort.Ints(busy)
+	return busy, nil
+}
+
+// activeAppointments lists the appointments of faculty on date that are pending or accepted, soonest first
+func (s *Server) activeAppointments(faculty string, date time.Time) ([]db.Appointment, error) {
+	appointments, err := s.repo.GetAppointments(db.AppointmentFilter{Faculty: faculty, Date: date})
+	if err != nil {
+		return nil, err
+	}
+	var active []db.Appointment
+	for _, appointment := range appointments {
+		if appointment.Status != db.AppointmentDeclined {
+			active = append(active, appointment)
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool { return active[i].Start.Before(active[j].Start) })
+	return active, nil
+}
+
+// Describes the time of an appointment, like "2023-06-13 08:15 to 08:30"
+func describeAppointment(appointment db.Appointment) i18n.Message {
+	return i18n.M("%s to %s", appointment.Start.Format(calendar.DateLayout+" "+examTimeLayout),
+		appointment.End.Format(examTimeLayout))
+}
+
+// knownFaculty tells whether faculty teaches any period, publishes office hours or is staff by their groups
+func (s *Server) knownFaculty(faculty string) (bool, error) {
+	if staff, err := s.groupStaff(faculty); err != nil || staff {
+		return staff, err
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Faculty: faculty})
+	if err != nil {
+		return false, err
+	}
+	if len(entries) > 0 {
+		return true, nil
+	}
+	hours, err := s.repo.GetOfficeHours(faculty)
+	return len(hours) > 0, err
+}
+
+/*
+facultyAvailabilityHandler tells students when the faculty member of the path
+is reachable on the days from startDate to endDate (today by default): the
+slots they are busy in, their office hours and the slots they are free in.
+Weekends are left out.
+*/
+func (s *Server) facultyAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	faculty := router.Param(r, "id")
+	var query struct {
+		StartDate time.Time `param:"startDate"`
+		EndDate   time.Time `param:"endDate"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	startDate, endDate := query.StartDate, query.EndDate
+	if startDate.IsZero() {
+		startDate = calendar.Today(s.config.Location)
+	}
+	if endDate.IsZero() {
+		endDate = startDate
+	}
+	if endDate.Before(startDate) || endDate.After(startDate.AddDate(0, 0, maxAvailabilityDays-1)) {
+		http.Error(w, "Invalid endDate value", http.StatusBadRequest)
+		return
+	}
+	known, err := s.knownFaculty(faculty)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !known {
+		http.Error(w, "No such faculty", http.StatusNotFound)
+		return
+	}
+	hours, err := s.repo.GetOfficeHours(faculty)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slots := s.repo.GetAllSlot()
+	days := []facultyDay{}
+	for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+		day := calendar.DayCode(date.Weekday())
+		if !containsString(timetableDays, day) {
+			continue
+		}
+		busy, err := s.facultyBusy(faculty, date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		appointments, err := s.activeAppointments(faculty, date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		available := facultyDay{Date: date, Busy: busy, OfficeHours: []db.OfficeHour{}, Free: []int{},
+			Appointments: []appointmentTime{}}
+		if available.Busy == nil {
+			available.Busy = []int{}
+		}
+		for _, appointment := range appointments {
+			available.Appointments = append(available.Appointments,
+				appointmentTime{Slot: appointment.Slot, Start: appointment.Start, End: appointment.End})
+		}
+		for _, hour := range hours {
+			if hour.Day == day && !containsInt(busy, hour.Slot) {
+				available.OfficeHours = append(available.OfficeHours, hour)
+			}
+		}
+		for _, slot := range slots {
+			if !containsInt(busy, slot) {
+				available.Free = append(available.Free, slot)
+			}
+		}
+		days = append(days, available)
+	}
+	s.writeJSON(w, r, http.StatusOK, days)
+}
+
+func (s *Server) myOfficeHoursHandler(w http.ResponseWriter, r *http.Request) {
+	hours, err := s.repo.GetOfficeHours(currentSession(r).Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if hours == nil {
+		hours = []db.OfficeHour{}
+	}
+	s.writeJSON(w, r, http.StatusOK, hours)
+}
+
+/*
+setOfficeHoursHandler replaces the office hours of the user with the ones of a
+JSON body like [{"day": "TUE", "slot": 2, "place": "Staff room 3"}]. Only
+faculty teaching in the timetable publish office hours.
+*/
+func (s *Server) setOfficeHoursHandler(w http.ResponseWriter, r *http.Request) {
+	faculty := currentSession(r).Mail
+	var hours []db.OfficeHour
+	err := json.NewDecoder(io.LimitReader(r.Body, maxOfficeHoursSize)).Decode(&hours)
+	if err != nil || len(hours) > maxOfficeHours {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	slots := s.repo.GetAllSlot()
+	for idx, hour := range hours {
+		weekday, err := calendar.ParseDay(hour.Day)
+		hour.Day = calendar.DayCode(weekday)
+		if err != nil || !containsString(timetableDays, hour.Day) {
+			http.Error(w, "Invalid day value", http.StatusBadRequest)
+			return
+		}
+		if !containsInt(slots, hour.Slot) {
+			http.Error(w, "Invalid slot value", http.StatusBadRequest)
+			return
+		}
+		hour.Place = strings.TrimSpace(hour.Place)
+		if len(hour.Place) > maxPlaceLength {
+			http.Error(w, "Invalid place value", http.StatusBadRequest)
+			return
+		}
+		for _, other := range hours[:idx] {
+			if other.Day == hour.Day && other.Slot == hour.Slot {
+				http.Error(w, fmt.Sprintf("%s slot %d is listed twice", hour.Day, hour.Slot), http.StatusBadRequest)
+				return
+			}
+		}
+		hour.Faculty = faculty
+		hours[idx] = hour
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Faculty: faculty})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	err = s.repo.SetOfficeHours(faculty, hours)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+requestAppointmentHandler asks faculty for a meeting of minutes (15 or 30) in
+slot on date, which must be one they are not busy in. It starts at the clock
+time start, or else at the first time in the slot not taken by another
+appointment. The faculty member is told and answers with the accept and
+decline endpoints.
+*/
+func (s *Server) requestAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Faculty string    `param:"faculty"`
+		Date    time.Time `param:"date,required"`
+		Slot    int       `param:"slot,required"`
+		Minutes int       `param:"minutes"`
+		Start   string    `param:"start"`
+		Note    string    `param:"note"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	appointment := db.Appointment{
+		Faculty:   query.Faculty,
+		Student:   currentSession(r).Mail,
+		Date:      query.Date,
+		Slot:      query.Slot,
+		Note:      query.Note,
+		Status:    db.AppointmentPending,
+		CreatedAt: time.Now(),
+	}
+	if appointment.Date.Before(calendar.Today(s.config.Location)) ||
+		!containsString(timetableDays, calendar.DayCode(appointment.Date.Weekday())) {
+		http.Error(w, "Invalid date value", http.StatusBadRequest)
+		return
+	}
+	if !containsInt(s.repo.GetAllSlot(), appointment.Slot) {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	minutes := appointmentLengths[0]
+	if query.Minutes != 0 {
+		if !containsInt(appointmentLengths, query.Minutes) {
+			http.Error(w, "Invalid minutes value", http.StatusBadRequest)
+			return
+		}
+		minutes = query.Minutes
+	}
+	length := time.Duration(minutes) * time.Minute
+	start := query.Start
+	if _, err := time.Parse(examTimeLayout, start); start != "" && err != nil {
+		http.Error(w, "Invalid start value", http.StatusBadRequest)
+		return
+	}
+	if len(appointment.Note) > maxReasonLength {
+		http.Error(w, "Invalid note value", http.StatusBadRequest)
+		return
+	}
+	if appointment.Faculty == "" || strings.EqualFold(appointment.Faculty, appointment.Student) {
+		http.Error(w, "Invalid faculty value", http.StatusBadRequest)
+		return
+	}
+	known, err := s.knownFaculty(appointment.Faculty)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !known {
+		http.Error(w, "No such faculty", http.StatusNotFound)
+		return
+	}
+	busy, err := s.facultyBusy(appointment.Faculty, appointment.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if containsInt(busy, appointment.Slot) {
+		http.Error(w, appointment.Faculty+" is busy in slot "+strconv.Itoa(appointment.Slot), http.StatusConflict)
+		return
+	}
+	slotStart, slotEnd, _, err := s.slotTime(appointment.Date, appointment.Slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	active, err := s.activeAppointments(appointment.Faculty, appointment.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, other := range active {
+		if other.Slot == appointment.Slot && other.Student == appointment.Student {
+			http.Error(w, "Already requested", http.StatusConflict)
+			return
+		}
+	}
+	if start != "" {
+		appointment.Start = s.clockTime(appointment.Date, start)
+		if appointment.Start.Before(slotStart) || appointment.Start.Add(length).After(slotEnd) {
+			http.Error(w, "Invalid start value", http.StatusBadRequest)
+			return
+		}
+		for _, other := range active {
+			if appointment.Start.Before(other.End) && other.Start.Before(appointment.Start.Add(length)) {
+				http.Error(w, "Overlaps another appointment", http.StatusConflict)
+				return
+			}
+		}
+	} else {
+		appointment.Start = slotStart
+		for _, other := range active {
+			if appointment.Start.Before(other.End) && other.Start.Before(appointment.Start.Add(length)) {
+				appointment.Start = other.End
+			}
+		}
+		if appointment.Start.Add(length).After(slotEnd) {
+			http.Error(w, "No time left in slot "+strconv.Itoa(appointment.Slot), http.StatusConflict)
+			return
+		}
+	}
+	appointment.End = appointment.Start.Add(length)
+	appointment.ID, err = s.repo.CreateAppointment(appointment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body := i18n.M("%s asks to meet you on %s.", appointment.Student, describeAppointment(appointment))
+	if appointment.Note != "" {
+		body = i18n.M("%s %s", body, appointment.Note)
+	}
+	s.notifyUser(appointment.Faculty, notify.KindAppointment, i18n.M("Appointment request"), body)
+	s.writeJSON(w, r, http.StatusCreated, appointment)
+}
+
+// Lists the appointments the user asked for and the ones asked of them, soonest first
+func (s *Server) myAppointmentsHandler(w http.ResponseWriter, r *http.Request) {
+	mail := currentSession(r).Mail
+	asked, err := s.repo.GetAppointments(db.AppointmentFilter{Student: mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	askedOf, err := s.repo.GetAppointments(db.AppointmentFilter{Faculty: mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	appointments := append(append([]db.Appointment{}, asked...), askedOf...)
+	sort.SliceStable(appointments, func(i, j int) bool { return appointments[i].Start.Before(appointments[j].Start) })
+	s.writeJSON(w, r, http.StatusOK, appointments)
+}
+
+/*
+decideAppointment accepts or declines the appointment of the path, which must
+be asked of the user, with the reply parameter for the student. Accepting is
+refused once the faculty member became busy in its slot.
+*/
+func (s *Server) decideAppointment(w http.ResponseWriter, r *http.Request, status string) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Reply string `param:"reply"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	reply := query.Reply
+	if len(reply) > maxReasonLength {
+		http.Error(w, "Invalid reply value", http.StatusBadRequest)
+		return
+	}
+	mail := currentSession(r).Mail
+	appointments, err := s.repo.GetAppointments(db.AppointmentFilter{Faculty: mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var appointment *db.Appointment
+	for idx := range appointments {
+		if appointments[idx].ID == id {
+			appointment = &appointments[idx]
+		}
+	}
+	if appointment == nil {
+		http.Error(w, "No such appointment", http.StatusNotFound)
+		return
+	}
+	if status == db.AppointmentAccepted {
+		busy, err := s.facultyBusy(appointment.Faculty, appointment.Date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if containsInt(busy, appointment.Slot) {
+			http.Error(w, "You are busy in slot "+strconv.Itoa(appointment.Slot), http.StatusConflict)
+			return
+		}
+	}
+	err = s.repo.DecideAppointment(id, status, reply, time.Now())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Already decided", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Accepted or declined
+	body := i18n.M("%s "+status+" meeting you on %s.", appointment.Faculty, describeAppointment(*appointment))
+	if reply != "" {
+		body = i18n.M("%s %s", body, reply)
+	}
+	s.notifyUser(appointment.Student, notify.KindAppointment, i18n.M("Appointment "+status), body)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) acceptAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	s.decideAppointment(w, r, db.AppointmentAccepted)
+}
+
+func (s *Server) declineAppointmentHandler(w http.ResponseWriter, r *http.Request) {
+	s.decideAppointment(w, r, db.AppointmentDeclined)
+}
+
+/*
+appointmentEvents returns the accepted appointments of mail, asked for or
+asked of them, as calendar events held where the faculty member keeps office
+hours in their slot, if they do.
+*/
+func (s *Server) appointmentEvents(mail string) ([]icsEvent, error) {
+	var events []icsEvent
+	for _, filter := range []db.AppointmentFilter{{Student: mail, Status: db.AppointmentAccepted},
+		{Faculty: mail, Status: db.AppointmentAccepted}} {
+		appointments, err := s.repo.GetAppointments(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, appointment := range appointments {
+			with := appointment.Faculty
+			if filter.Faculty != "" {
+				with = appointment.Student
+			}
+			event := icsEvent{
+				UID:     "appointment-" + strconv.FormatInt(appointment.ID, 10) + "@coraserver",
+				Start:   appointment.Start,
+				End:     appointment.End,
+				Summary: "Meeting with " + with,
+			}
+			hours, err := s.repo.GetOfficeHours(appointment.Faculty)
+			if err != nil {
+				return nil, err
+			}
+			for _, hour := range hours {
+				if hour.Day == calendar.DayCode(appointment.Date.Weekday()) && hour.Slot == appointment.Slot {
+					event.Location = hour.Place
+				}
+			}
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest accepted reason for an override, in bytes
+const maxReasonLength = 256
+
+// What /db/daytimetable shows for overridden periods
+const (
+	cancelledSubject = "CANCELLED"
+	// Followed by the substitute room
+	movedSubjectPrefix = "MOVED:"
+)
+
+// Lists the overrides on date, of class when it is given
+func (s *Server) overridesHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Date  time.Time `param:"date,required"`
+		Class string    `param:"class"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	overrides, err := s.repo.GetOverrides(query.Date, query.Class)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if overrides == nil {
+		overrides = []db.Override{}
+	}
+	s.writeJSON(w, r, http.StatusOK, overrides)
+}
+
+/*
+applyOverrides rewrites the subjects of class on date, one per slot of the
+timetable, with the overrides of that date: a cancelled period shows as
+CANCELLED and a moved one as MOVED:<room>. The substitute room itself is booked
+when the override is made, so it already shows the subject.
+*/
+func (s *Server) applyOverrides(subject []string, class string, date time.Time) []string {
+	overrides, err := s.repo.GetOverrides(date, class)
+	if err != nil || len(overrides) == 0 {
+		return subject
+	}
+	slots := s.repo.GetAllSlot()
+	if len(slots) != len(subject) {
+		return subject
+	}
+	subject = append([]string(nil), subject...)
+	for _, override := range overrides {
+		for idx, slot := range slots {
+			if slot < override.Slot || slot >= override.Slot+override.Span {
+				continue
+			}
+			if override.Cancelled {
+				subject[idx] = cancelledSubject
+			} else if override.Room != "" {
+				subject[idx] = movedSubjectPrefix + override.Room
+			}
+		}
+	}
+	return subject
+}
+
+/*
+overridePeriod reads the class, date and slot of the path and returns the
+timetable period they start. Faculty may only change their own periods, admins
+any. On failure it has already written the error response and returns ok =
+false.
+*/
+func (s *Server) overridePeriod(w http.ResponseWriter, r *http.Request) (entry db.StaticEntry, date time.Time, ok bool) {
+	class := router.Param(r, "class")
+	date, err := calendar.ParseDate(router.Param(r, "date"), s.config.Location)
+	if err != nil || date.Before(calendar.Today(s.config.Location)) {
+		http.Error(w, "Invalid date value", http.StatusBadRequest)
+		return
+	}
+	slot, err := strconv.Atoi(router.Param(r, "slot"))
+	if err != nil {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: class, Day: calendar.DayCode(date.Weekday()), Slot: slot})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 || entries[0].Subject == "FREE" {
+		http.Error(w, "No such class", http.StatusNotFound)
+		return
+	}
+	entry = entries[0]
+	if entry.Span < 1 {
+		entry.Span = 1
+	}
+	if mail := currentSession(r).Mail; mail != "" && !strings.EqualFold(mail, entry.Faculty) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	return entry, date, true
+}
+
+// existingOverride returns the override of the period, if there is one
+func (s *Server) existingOverride(entry db.StaticEntry, date time.Time) (db.Override, bool, error) {
+	overrides, err := s.repo.GetOverrides(date, entry.Class)
+	if err != nil {
+		return db.Override{}, false, err
+	}
+	for _, override := range overrides {
+		if override.Slot == entry.Slot {
+			return override, true, nil
+		}
+	}
+	return db.Override{}, false, nil
+}
+
+// releaseRoom cancels the bookings holding the substitute room of override
+func (s *Server) releaseRoom(override db.Override) error {
+	if override.Room == "" {
+		return nil
+	}
+	for slot := override.Slot; slot < override.Slot+override.Span; slot++ {
+		err := s.cancelBooking(override.Room, override.Date, slot)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+notifyOverride tells the students who starred the classroom, and the
+substitute faculty member, about a change to the period. It is posted to the
+Teams channels of the sections meeting there too.
+*/
+func (s *Server) notifyOverride(override db.Override, title i18n.Message, body i18n.Message) {
+	students, err := s.repo.GetFavoriteUsers(db.FavoriteClassroom, override.Class)
+	if err != nil {
+		s.logger.Println("Error listing students to notify", err)
+	}
+	if override.Faculty != "" && !containsString(students, override.Faculty) {
+		students = append(students, override.Faculty)
+	}
+	for _, mail := range students {
+		s.notifyUser(mail, notify.KindTimetable, title, body)
+	}
+	s.postToTeams(override.Class, title, body)
+}
+
+// Describes a period for a notification, like "19CSE311 in A104 on 2023-06-13, slot 3"
+func describePeriod(override db.Override) i18n.Message {
+	return i18n.M("%s in %s on %s, slot %d", override.Subject, override.Class,
+		override.Date.Format(calendar.DateLayout), override.Slot)
+}
+
+/*
+setOverrideHandler cancels a period on a date (cancel=true) or gives it a
+substitute faculty member and/or room (faculty, room), with an optional
+reason. The substitute room has to be free for the whole period and is booked
+for it.
+*/
+func (s *Server) setOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	entry, date, ok := s.overridePeriod(w, r)
+	if !ok {
+		return
+	}
+	var query struct {
+		Faculty string `param:"faculty"`
+		Room    string `param:"room"`
+		Reason  string `param:"reason"`
+		Cancel  bool   `param:"cancel"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	override := db.Override{
+		Class:     entry.Class,
+		Date:      date,
+		Slot:      entry.Slot,
+		Span:      entry.Span,
+		Subject:   entry.Subject,
+		Faculty:   query.Faculty,
+		Room:      query.Room,
+		Reason:    query.Reason,
+		Cancelled: query.Cancel,
+		CreatedBy: currentSession(r).Mail,
+		CreatedAt: time.Now(),
+	}
+	if override.CreatedBy == "" {
+		override.CreatedBy = "admin"
+	}
+	if override.Cancelled == (override.Faculty != "" || override.Room != "") {
+		http.Error(w, "Either cancel or give a substitute faculty or room", http.StatusBadRequest)
+		return
+	}
+	if len(override.Reason) > maxReasonLength {
+		http.Error(w, "Invalid reason value", http.StatusBadRequest)
+		return
+	}
+	if override.Faculty != "" {
+		catalog, err := s.repo.GetCatalog()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		known := false
+		for _, faculty := range catalog.Faculty {
+			known = known || strings.EqualFold(faculty.ID, override.Faculty)
+		}
+		if !known || strings.EqualFold(override.Faculty, entry.Faculty) {
+			http.Error(w, "Invalid faculty value", http.StatusBadRequest)
+			return
+		}
+	}
+	if override.Room != "" && (override.Room == entry.Class || !containsString(s.repo.GetAllClass(), override.Room)) {
+		http.Error(w, "Invalid room value", http.StatusBadRequest)
+		return
+	}
+
+	previous, found, err := s.existingOverride(entry, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if found {
+		err = s.releaseRoom(previous)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if override.Room != "" {
+		free := s.repo.GetFreeSlot(override.Room, date)
+		for slot := entry.Slot; slot < entry.Slot+entry.Span; slot++ {
+			if !containsInt(free, slot) {
+				http.Error(w, override.Room+" is not free then", http.StatusConflict)
+				return
+			}
+		}
+		faculty := override.Faculty
+		if faculty == "" {
+			faculty = entry.Faculty
+		}
+		_, err = s.repo.MultiBooking(override.Room, date, entry.Slot, entry.Slot+entry.Span-1, faculty, entry.Subject)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	err = s.repo.SetOverride(override)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var changes []i18n.Message
+	if override.Cancelled {
+		changes = append(changes, i18n.M("cancelled"))
+	}
+	if override.Faculty != "" {
+		changes = append(changes, i18n.M("taken by %s", override.Faculty))
+	}
+	if override.Room != "" {
+		changes = append(changes, i18n.M("moved to %s", override.Room))
+	}
+	body := i18n.M("%s is %s", describePeriod(override), i18n.And(changes...))
+	if override.Reason != "" {
+		body = i18n.M("%s is %s: %s", describePeriod(override), i18n.And(changes...), override.Reason)
+	}
+	s.notifyOverride(override, i18n.M("%s %s", override.Subject, changes[0]), body)
+	if currentSession(r).Mail == "" {
+		s.audit(r, auditSetOverride, entry.Class+"/"+date.Format(calendar.DateLayout)+"/"+strconv.Itoa(entry.Slot), body.String())
+	}
+
+	s.writeJSON(w, r, http.StatusOK, override)
+}
+
+// Puts a period back as the weekly timetable has it and frees its substitute room
+func (s *Server) deleteOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	entry, date, ok := s.overridePeriod(w, r)
+	if !ok {
+		return
+	}
+	override, found, err := s.existingOverride(entry, date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "No such override", http.StatusNotFound)
+		return
+	}
+	_, err = s.repo.DeleteOverride(entry.Class, date, entry.Slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = s.releaseRoom(override)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body := i18n.M("%s is back as scheduled", describePeriod(override))
+	s.notifyOverride(override, i18n.M("%s back as scheduled", override.Subject), body)
+	if currentSession(r).Mail == "" {
+		s.audit(r, auditDeleteOverride, entry.Class+"/"+date.Format(calendar.DateLayout)+"/"+strconv.Itoa(entry.Slot), "")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/params"
+)
+
+/*
+decodeParams binds the query and form parameters of r into dst, a struct with
+param tags naming what the endpoint takes, see package params. On failure it
+has already answered 400 with the parameter at fault.
+*/
+func (s *Server) decodeParams(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	err := params.Decoder{Location: s.config.Location}.Request(r, dst)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// dayParam is a day parameter in any form calendar.ParseDay takes, kept as its day code like TUE
+type dayParam string
+
+func (d *dayParam) UnmarshalText(text []byte) error {
+	day, err := calendar.ParseDay(string(text))
+	if err != nil {
+		return err
+	}
+	*d = dayParam(calendar.DayCode(day))
+	return nil
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+)
+
+// Largest accepted preferences document, in bytes
+const maxPreferencesSize = 4 << 10
+
+// Most subjects a user can take, and the longest subject code, in bytes, like exams have
+const (
+	maxPreferredSubjects = 16
+	maxSubjectLength     = 8
+)
+
+/*
+Preferences is the schema of the documents behind /me/preferences. Every field
+is optional and fields it does not know are rejected, so that a typo in the
+app shows up instead of being saved and ignored.
+*/
+type Preferences struct {
+	// Class section shown first, like "CSE-B"
+	DefaultSection    string `json:"defaultSection,omitempty"`
+	PreferredBuilding string `json:"preferredBuilding,omitempty"`
+	// ID of the campus free classrooms and class lists are shown for, when the request names none
+	Campus string `json:"campus,omitempty"`
+	// Codes of the subjects the user takes, electives included, whose periods make up their day
+	Subjects []string `json:"subjects,omitempty"`
+	// Language of day names, errors, notifications and digests, one that calendar.Language knows;
+	// messages i18n has no bundle of are in English
+	Language string `json:"language,omitempty"`
+	Theme    string `json:"theme,omitempty"`
+	// Mobile number in E.164 form, like "+919876543210", critical alerts are texted to when Notifications.SMS
+	Phone         string                   `json:"phone,omitempty"`
+	Notifications *NotificationPreferences `json:"notifications,omitempty"`
+}
+
+type NotificationPreferences struct {
+	Bookings      bool `json:"bookings"`
+	Announcements bool `json:"announcements"`
+	// How long before a booked slot to remind, 0 for no reminder
+	ReminderMinutes int `json:"reminderMinutes"`
+	// "daily" for a digest of the next day every evening, "weekly" for one of the next week; none when empty
+	Digest string `json:"digest,omitempty"`
+	// "push", the default, or "mail"
+	DigestVia string `json:"digestVia,omitempty"`
+	// Opts in to texts to Phone of emergency broadcasts and changes to the user's exam halls
+	SMS bool `json:"sms,omitempty"`
+}
+
+var themes = []string{"light", "dark", "system"}
+
+// An E.164 number: a + and up to 15 digits, the country code first
+var phoneNumber = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Validate reports the first problem with p, nil when it can be saved
+func (p Preferences) Validate() error {
+	if len(p.DefaultSection) > maxSectionLength {
+		return fmt.Errorf("defaultSection: longer than %d bytes", maxSectionLength)
+	}
+	if len(p.PreferredBuilding) > 64 {
+		return errors.New("preferredBuilding: longer than 64 bytes")
+	}
+	if p.Campus != "" && !validCampusID(p.Campus) {
+		return fmt.Errorf("campus: %q is not a campus ID", p.Campus)
+	}
+	if len(p.Subjects) > maxPreferredSubjects {
+		return fmt.Errorf("subjects: more than %d", maxPreferredSubjects)
+	}
+	for _, subject := range p.Subjects {
+		if subject == "" || len(subject) > maxSubjectLength {
+			return fmt.Errorf("subjects: %q is not a subject code", subject)
+		}
+	}
+	if p.Language != "" && calendar.Language(p.Language) != p.Language {
+		return fmt.Errorf("language: %q is not supported", p.Language)
+	}
+	if p.Theme != "" && !containsString(themes, p.Theme) {
+		return fmt.Errorf("theme: %q is not one of light, dark or system", p.Theme)
+	}
+	if n := p.Notifications; n != nil && (n.ReminderMinutes < 0 || n.ReminderMinutes > 24*60) {
+		return errors.New("notifications.reminderMinutes: must be between 0 and 1440")
+	}
+	if n := p.Notifications; n != nil && n.Digest != "" && n.Digest != digestDaily && n.Digest != digestWeekly {
+		return fmt.Errorf("notifications.digest: %q is not daily or weekly", n.Digest)
+	}
+	if n := p.Notifications; n != nil && n.DigestVia != "" && n.DigestVia != digestPush && n.DigestVia != digestMail {
+		return fmt.Errorf("notifications.digestVia: %q is not push or mail", n.DigestVia)
+	}
+	if p.Phone != "" && !phoneNumber.MatchString(p.Phone) {
+		return fmt.Errorf("phone: %q is not a number like +919876543210", p.Phone)
+	}
+	if n := p.Notifications; n != nil && n.SMS && p.Phone == "" {
+		return errors.New("notifications.sms: needs a phone")
+	}
+	return nil
+}
+
+func (s *Server) writePreferences(w http.ResponseWriter, data string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(data))
+}
+
+// requestPreferences returns the preferences of the user logged in to the request; none without a session
+func (s *Server) requestPreferences(r *http.Request) Preferences {
+	session, err := s.requestSession(r)
+	if err != nil {
+		return Preferences{}
+	}
+	return s.userPreferences(session.Mail)
+}
+
+// userPreferences returns the preferences mail saved, none when they saved none
+func (s *Server) userPreferences(mail string) Preferences {
+	var preferences Preferences
+	data, err := s.repo.GetPreferences(mail)
+	if err != nil {
+		return preferences
+	}
+	json.Unmarshal([]byte(data), &preferences)
+	return preferences
+}
+
+// Returns the saved preferences of the user, {} when there are none
+func (s *Server) myPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := s.repo.GetPreferences(currentSession(r).Mail)
+	if err == sql.ErrNoRows {
+		data = "{}"
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writePreferences(w, data)
+}
+
+// Replaces the preferences of the user with the JSON body, after checking it against Preferences
+func (s *Server) setPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxPreferencesSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxPreferencesSize {
+		http.Error(w, "Preferences too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var preferences Preferences
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&preferences)
+	if err != nil {
+		http.Error(w, "Invalid preferences: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = preferences.Validate()
+	if err != nil {
+		http.Error(w, "Invalid preferences: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	exists, err := s.campusExists(preferences.Campus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Invalid preferences: campus: no such campus", http.StatusBadRequest)
+		return
+	}
+	// Saved as the schema writes it, which drops the client's whitespace and empty fields
+	data, err := json.Marshal(preferences)
+	if err != nil {
+		s.logger.Println("Error marshalling data", err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = s.repo.SetPreferences(currentSession(r).Mail, string(data), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writePreferences(w, string(data))
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Most rows of each kind an export holds
+const maxExportRows = 10000
+
+// An approved erasure with how many rows went
+type erasureResult struct {
+	db.ErasureRequest
+	Erased int64 `json:"erased"`
+}
+
+/*
+userExport gathers everything stored about mail, by section: their directory
+entries and provider profiles, sessions, preferences, favorites, recent views,
+bookings, attendance (by the roll number in their mail), custom entries,
+notifications, feedback, enrollments, appointments, waitlists, timetable
+change requests, events, security log and the audit entries they made or that
+were about them.
+*/
+func (s *Server) userExport(mail string) (map[string]interface{}, error) {
+	export := make(map[string]interface{})
+	found, err := s.repo.GetUsers(db.UserFilter{Query: mail, Limit: maxExportRows})
+	if err != nil {
+		return nil, err
+	}
+	users := []db.User{}
+	profiles := []db.Profile{}
+	for _, user := range found {
+		if !strings.EqualFold(user.Mail, mail) {
+			continue
+		}
+		users = append(users, user)
+		if profile, err := s.repo.GetProfile(user.Provider, user.ExternalID); err == nil {
+			profiles = append(profiles, profile)
+		}
+	}
+	export["users"] = users
+	export["profiles"] = profiles
+	if export["sessions"], err = s.repo.GetUserSessions(mail); err != nil {
+		return nil, err
+	}
+	data, err := s.repo.GetPreferences(mail)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	export["preferences"] = json.RawMessage("{}")
+	if data != "" {
+		export["preferences"] = json.RawMessage(data)
+	}
+	if export["favorites"], err = s.repo.GetFavorites(mail); err != nil {
+		return nil, err
+	}
+	if export["recent"], err = s.repo.GetRecentViews(mail, maxExportRows); err != nil {
+		return nil, err
+	}
+	if export["bookings"], err = s.repo.GetBookings(db.BookingFilter{Faculty: mail}); err != nil {
+		return nil, err
+	}
+	roll := strings.ToUpper(strings.SplitN(mail, "@", 2)[0])
+	if export["attendance"], err = s.repo.GetAttendance(db.AttendanceFilter{Roll: roll}); err != nil {
+		return nil, err
+	}
+	if export["customEntries"], err = s.repo.GetCustomEntries(mail); err != nil {
+		return nil, err
+	}
+	if export["notifications"], err = s.repo.GetNotifications(mail, false, maxExportRows); err != nil {
+		return nil, err
+	}
+	if export["texts"], err = s.repo.GetTexts(db.TextFilter{Mail: mail, Limit: maxExportRows}); err != nil {
+		return nil, err
+	}
+	if export["groups"], err = s.repo.GetGroupMembers(db.GroupMemberFilter{Mail: mail}); err != nil {
+		return nil, err
+	}
+	if export["feedback"], err = s.repo.GetFeedback(db.FeedbackFilter{Mail: mail}); err != nil {
+		return nil, err
+	}
+	if export["enrollments"], err = s.repo.GetEnrollments(db.EnrollmentFilter{Student: mail}); err != nil {
+		return nil, err
+	}
+	appointments, err := s.repo.GetAppointments(db.AppointmentFilter{Student: mail})
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := s.repo.GetAppointments(db.AppointmentFilter{Faculty: mail})
+	if err != nil {
+		return nil, err
+	}
+	export["appointments"] = append(appointments, theirs...)
+	if export["waitlist"], err = s.repo.GetWaitlist(db.WaitlistFilter{Faculty: mail}); err != nil {
+		return nil, err
+	}
+	if export["changes"], err = s.repo.GetChangeRequests(mail, ""); err != nil {
+		return nil, err
+	}
+	if export["events"], err = s.repo.GetEvents(db.EventFilter{CreatedBy: mail}); err != nil {
+		return nil, err
+	}
+	if export["security"], err = s.repo.GetSecurityEvents(db.SecurityEventFilter{Subject: mail, Limit: maxExportRows}); err != nil {
+		return nil, err
+	}
+	if export["audit"], err = s.repo.GetUserAuditEvents(mail, maxExportRows); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+/*
+exportHandler downloads everything stored about the user, as one JSON
+document of sections or, with format=zip, a zip of a JSON file per section.
+*/
+func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Format string `param:"format"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	format := query.Format
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		http.Error(w, "Invalid format value", http.StatusBadRequest)
+		return
+	}
+	mail := currentSession(r).Mail
+	export, err := s.userExport(mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name := "coraserver-export-" + time.Now().In(s.config.Location).Format("20060102")
+	if format == "json" {
+		responseJSON, err := marshalIndentJSON(export)
+		if err != nil {
+			s.logger.Println("Error marshalling data", err)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.json"`)
+		w.Write(responseJSON)
+		return
+	}
+
+	sections := make([]string, 0, len(export))
+	for section := range export {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, section := range sections {
+		responseJSON, err := marshalIndentJSON(export[section])
+		if err != nil {
+			s.logger.Println("Error marshalling data", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		file, err := zw.Create(name + "/" + section + ".json")
+		if err == nil {
+			_, err = file.Write(responseJSON)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.zip"`)
+	w.Write(archive.Bytes())
+}
+
+/*
+requestErasureHandler asks for the user's data to be erased, with an optional
+reason. An admin has to approve it; until then there is one pending request
+per user.
+*/
+func (s *Server) requestErasureHandler(w http.ResponseWriter, r *http.Request) {
+	mail := currentSession(r).Mail
+	var query struct {
+		Reason string `param:"reason"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	reason := query.Reason
+	if len(reason) > maxReasonLength {
+		http.Error(w, "Invalid reason value", http.StatusBadRequest)
+		return
+	}
+	pending, err := s.repo.GetErasureRequests(mail, db.ErasurePending)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(pending) > 0 {
+		http.Error(w, "Already requested", http.StatusConflict)
+		return
+	}
+	request := db.ErasureRequest{Mail: mail, Reason: reason, Status: db.ErasurePending, CreatedAt: time.Now()}
+	request.ID, err = s.repo.CreateErasureRequest(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusAccepted, request)
+}
+
+// Lists the user's erasure requests, newest first
+func (s *Server) myErasuresHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeErasures(w, r, currentSession(r).Mail, "")
+}
+
+// Lists the erasure requests of the status parameter, pending by default and all for every one
+func (s *Server) erasuresHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Status string `param:"status"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	status := query.Status
+	if status == "" {
+		status = db.ErasurePending
+	} else if status == "all" {
+		status = ""
+	} else if status != db.ErasurePending && status != db.ErasureApproved && status != db.ErasureRejected {
+		http.Error(w, "Invalid status value", http.StatusBadRequest)
+		return
+	}
+	s.writeErasures(w, r, "", status)
+}
+
+func (s *Server) writeErasures(w http.ResponseWriter, r *http.Request, mail string, status string) {
+	requests, err := s.repo.GetErasureRequests(mail, status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if requests == nil {
+		requests = []db.ErasureRequest{}
+	}
+	s.writeJSON(w, r, http.StatusOK, requests)
+}
+
+// pendingErasure returns the erasure request of the path, writing the error when it is not pending
+func (s *Server) pendingErasure(w http.ResponseWriter, r *http.Request) (db.ErasureRequest, bool) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return db.ErasureRequest{}, false
+	}
+	requests, err := s.repo.GetErasureRequests("", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.ErasureRequest{}, false
+	}
+	for _, request := range requests {
+		if request.ID != id {
+			continue
+		}
+		if request.Status != db.ErasurePending {
+			http.Error(w, "Already decided", http.StatusConflict)
+			return request, false
+		}
+		return request, true
+	}
+	http.Error(w, "No such request", http.StatusNotFound)
+	return db.ErasureRequest{}, false
+}
+
+/*
+approveErasureHandler erases the data of the user of a pending request: what
+they set up in the app, their sessions and directory entries, see
+db.EraseUser. Bookings, attendance and the audit log are kept. It answers
+with the request and how many rows were erased.
+*/
+func (s *Server) approveErasureHandler(w http.ResponseWriter, r *http.Request) {
+	request, ok := s.pendingErasure(w, r)
+	if !ok {
+		return
+	}
+	erased, err := s.repo.EraseUser(request.Mail)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	err = s.repo.DecideErasureRequest(request.ID, db.ErasureApproved, adminActor(r), "", now)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditEraseUser, request.Mail, strconv.FormatInt(erased, 10)+" rows")
+	request.Status = db.ErasureApproved
+	request.DecidedBy = adminActor(r)
+	request.DecidedAt = &now
+	s.writeJSON(w, r, http.StatusOK, erasureResult{ErasureRequest: request, Erased: erased})
+}
+
+// Turns down a pending erasure request with the note parameter, which the user is sent
+func (s *Server) rejectErasureHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Note string `param:"note"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	note := query.Note
+	if len(note) > maxReasonLength {
+		http.Error(w, "Invalid note value", http.StatusBadRequest)
+		return
+	}
+	request, ok := s.pendingErasure(w, r)
+	if !ok {
+		return
+	}
+	err := s.repo.DecideErasureRequest(request.ID, db.ErasureRejected, adminActor(r), note, time.Now())
+	if err == sql.ErrNoRows {
+		http.Error(w, "Already decided", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditRejectErasure, request.Mail, note)
+	body := i18n.M("Your data was kept.")
+	if note != "" {
+		body = i18n.M(note)
+	}
+	s.notifyUser(request.Mail, notify.KindPrivacy, i18n.M("Your request to erase your data was turned down"), body)
+	w.WriteHeader(http.StatusNoContent)
+}
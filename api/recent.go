@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/deebakkarthi/coraserver/db"
+)
+
+/*
+recordView remembers view for the user of the request's session. Requests
+without a session are not remembered, and failing to look the session up only
+costs the shortcut.
+*/
+func (s *Server) recordView(r *http.Request, view db.RecentView) {
+	session, err := s.requestSession(r)
+	if err != nil {
+		return
+	}
+	view.Mail = session.Mail
+	s.repo.RecordView(view)
+}
+
+// Lists the latest free class searches and timetable views of the user, latest first
+func (s *Server) myRecentHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, 20)
+	if !ok || limit > 50 {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	views, err := s.repo.GetRecentViews(currentSession(r).Mail, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if views == nil {
+		views = []db.RecentView{}
+	}
+	s.writeJSON(w, r, http.StatusOK, views)
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+)
+
+// What an emergency relocation did
+type relocationResponse struct {
+	Block db.Block `json:"block"`
+	// The periods moved, as their overrides
+	Periods []db.Override `json:"periods"`
+	// The bookings moved, as they are now
+	Bookings []db.BookingRecord `json:"bookings"`
+	// Periods left alone since they were already cancelled or moved
+	Skipped []db.StaticEntry `json:"skipped"`
+}
+
+/*
+relocateHandler moves everything in room from on date to room to, for when a
+room can't be used at short notice: from is blocked for the day, each period
+gets an override moving it to to, which is booked for it, and the bookings of
+from move along. Nothing changes unless to is free for all of it. Everyone
+affected, the faculty of the periods and bookings and the students who starred
+from, gets one notification.
+*/
+func (s *Server) relocateHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		From   string    `param:"from"`
+		To     string    `param:"to"`
+		Date   time.Time `param:"date,required"`
+		Reason string    `param:"reason"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	from := s.canonicalRoom(query.From)
+	to := s.canonicalRoom(query.To)
+	date, reason := query.Date, query.Reason
+	classes := s.repo.GetAllClass()
+	if !containsString(classes, from) {
+		http.Error(w, "Invalid from value", http.StatusBadRequest)
+		return
+	}
+	if !containsString(classes, to) || to == from {
+		http.Error(w, "Invalid to value", http.StatusBadRequest)
+		return
+	}
+	if date.Before(calendar.Today(s.config.Location)) {
+		http.Error(w, "Invalid date value", http.StatusBadRequest)
+		return
+	}
+	if reason == "" || len(reason) > maxReasonLength {
+		http.Error(w, "Invalid reason value", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: from, Day: calendar.DayCode(date.Weekday())})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Class: from, StartDate: date, EndDate: date})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	response := relocationResponse{Periods: []db.Override{}, Bookings: []db.BookingRecord{}, Skipped: []db.StaticEntry{}}
+	// The periods to move, with who teaches them
+	type period struct {
+		override db.Override
+		faculty  string
+	}
+	var periods []period
+	var needed []int
+	for _, entry := range entries {
+		if entry.Subject == "FREE" {
+			continue
+		}
+		if entry.Span < 1 {
+			entry.Span = 1
+		}
+		override := db.Override{Class: from, Date: date, Slot: entry.Slot, Span: entry.Span, Subject: entry.Subject,
+			Room: to, Reason: reason, CreatedBy: "admin", CreatedAt: time.Now()}
+		previous, found, err := s.existingOverride(entry, date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if found && (previous.Cancelled || previous.Room != "") {
+			response.Skipped = append(response.Skipped, entry)
+			continue
+		}
+		// A substitute stays the one teaching it
+		override.Faculty = previous.Faculty
+		faculty := override.Faculty
+		if faculty == "" {
+			faculty = entry.Faculty
+		}
+		periods = append(periods, period{override: override, faculty: faculty})
+		for slot := entry.Slot; slot < entry.Slot+entry.Span; slot++ {
+			needed = append(needed, slot)
+		}
+	}
+	for _, booking := range bookings {
+		needed = append(needed, booking.Slot)
+	}
+	free := s.repo.GetFreeSlot(to, date)
+	for _, slot := range needed {
+		if !containsInt(free, slot) {
+			http.Error(w, to+" is not free in slot "+strconv.Itoa(slot), http.StatusConflict)
+			return
+		}
+	}
+
+	response.Block = db.Block{Class: from, StartDate: date, EndDate: date, Reason: reason, CreatedAt: time.Now()}
+	response.Block.ID, err = s.repo.CreateBlock(response.Block)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var notified []string
+	for _, period := range periods {
+		override := period.override
+		_, err = s.repo.MultiBooking(to, date, override.Slot, override.Slot+override.Span-1, period.faculty, override.Subject)
+		if err == nil {
+			err = s.repo.SetOverride(override)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.Periods = append(response.Periods, override)
+		if period.faculty != "" && !containsString(notified, period.faculty) {
+			notified = append(notified, period.faculty)
+		}
+	}
+	for _, booking := range bookings {
+		err = s.repo.CancelBooking(from, date, booking.Slot)
+		if err == nil {
+			_, err = s.repo.Booking(to, date, booking.Slot, booking.Faculty, booking.Subject)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		booking.Class = to
+		response.Bookings = append(response.Bookings, booking)
+		if !containsString(notified, booking.Faculty) {
+			notified = append(notified, booking.Faculty)
+		}
+	}
+
+	students, err := s.repo.GetFavoriteUsers(db.FavoriteClassroom, from)
+	if err != nil {
+		s.logger.Println("Error listing students to notify", err)
+	}
+	for _, mail := range students {
+		if !containsString(notified, mail) {
+			notified = append(notified, mail)
+		}
+	}
+	title := i18n.M("Classes in %s moved to %s", from, to)
+	body := i18n.M("Everything in %s on %s is moved to %s: %s", from, date.Format(calendar.DateLayout), to, reason)
+	for _, mail := range notified {
+		s.notifyUser(mail, notify.KindTimetable, title, body)
+	}
+	s.postToTeams(from, title, body)
+	s.audit(r, auditRelocate, from, "to "+to+" on "+date.Format(calendar.DateLayout)+", "+
+		strconv.Itoa(len(response.Periods))+" periods and "+strconv.Itoa(len(response.Bookings))+" bookings: "+reason)
+
+	s.writeJSON(w, r, http.StatusOK, response)
+}
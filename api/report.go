@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/report"
+)
+
+// One table of a report download, which add writes the rows of
+type reportTable struct {
+	name    string
+	columns []string
+	rows    func(add func(values ...interface{}) error) error
+}
+
+/*
+parseReportFormat reads the format parameter of the analytics endpoints:
+json, the default, csv or xlsx. On failure it has already written the error
+response.
+*/
+func parseReportFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "xlsx" {
+		http.Error(w, "Invalid format value", http.StatusBadRequest)
+		return "", false
+	}
+	return format, true
+}
+
+/*
+writeReport downloads tables as a spreadsheet named after name and today. An
+xlsx has a sheet per table; a csv has the one the table parameter names, the
+first by default. Rows are written out as they come, so once the first is out
+a failure can only cut the download short, which is logged.
+*/
+func (s *Server) writeReport(w http.ResponseWriter, r *http.Request, format string, name string, tables []reportTable) {
+	filename := name + "-" + time.Now().In(s.config.Location).Format("20060102")
+	var writer report.Writer
+	switch format {
+	case "csv":
+		table := r.URL.Query().Get("table")
+		if table == "" {
+			table = tables[0].name
+		}
+		var chosen []reportTable
+		for _, t := range tables {
+			if t.name == table {
+				chosen = append(chosen, t)
+			}
+		}
+		if chosen == nil {
+			http.Error(w, "Invalid table value", http.StatusBadRequest)
+			return
+		}
+		tables = chosen
+		filename += "-" + table + ".csv"
+		w.Header().Set("Content-Type", report.CSVContentType)
+		writer = report.NewCSV(w)
+	default:
+		filename += ".xlsx"
+		w.Header().Set("Content-Type", report.XLSXContentType)
+		writer = report.NewXLSX(w)
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	for _, table := range tables {
+		err := writer.Table(table.name, table.columns...)
+		if err == nil {
+			err = table.rows(writer.Row)
+		}
+		if err != nil {
+			s.logger.Println("Error writing report", name, err)
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		s.logger.Println("Error writing report", name, err)
+	}
+}
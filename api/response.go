@@ -0,0 +1,192 @@
+package api
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+/*
+writeJSON answers v as JSON with status. With ?pretty=1 the response is
+indented for reading. Nil slices and maps are written as [] and {}, never as
+null: a list that is empty is still a list. Nil pointers stay null, and fields
+tagged omitempty are left out when empty, nil or not.
+*/
+func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	responseJSON, err := marshalJSON(v)
+	if err != nil {
+		s.logger.Println("Error marshalling data", err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	s.writeRawJSON(w, r, status, responseJSON)
+}
+
+// writeRawJSON is writeJSON for a response marshalled already, by marshalJSON
+func (s *Server) writeRawJSON(w http.ResponseWriter, r *http.Request, status int, responseJSON []byte) {
+	if prettyJSON(r) {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, responseJSON, "", "  "); err == nil {
+			indented.WriteByte('\n')
+			responseJSON = indented.Bytes()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(responseJSON)
+}
+
+// prettyJSON tells whether r asked for an indented response with ?pretty=1
+func prettyJSON(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
+}
+
+// marshalJSON is json.Marshal writing nil slices and maps as empty ones
+func marshalJSON(v interface{}) ([]byte, error) {
+	value, changed := emptyCollections(reflect.ValueOf(v))
+	if !changed {
+		return json.Marshal(v)
+	}
+	return json.Marshal(value.Interface())
+}
+
+// marshalIndentJSON is marshalJSON indented, for the files a user downloads
+func marshalIndentJSON(v interface{}) ([]byte, error) {
+	responseJSON, err := marshalJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, responseJSON, "", "  "); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+/*
+emptyCollections returns v with its nil slices and maps, and those of
+everything it holds, made empty, and whether there were any. v itself is not
+changed: whatever holds a nil one is copied. Types marshalling themselves,
+like time.Time, are left alone.
+*/
+func emptyCollections(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, false
+	}
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return v, false
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := emptyCollections(v.Elem())
+		if !changed {
+			return v, false
+		}
+		if v.Kind() == reflect.Ptr {
+			copied := reflect.New(t.Elem())
+			copied.Elem().Set(elem)
+			return copied, true
+		}
+		copied := reflect.New(t).Elem()
+		copied.Set(elem)
+		return copied, true
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// []byte is a base64 string
+			return v, false
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return reflect.MakeSlice(t, 0, 0), true
+		}
+		var copied reflect.Value
+		for idx := 0; idx < v.Len(); idx++ {
+			elem, changed := emptyCollections(v.Index(idx))
+			if !changed {
+				continue
+			}
+			if !copied.IsValid() {
+				copied = copyList(v)
+			}
+			copied.Index(idx).Set(elem)
+		}
+		if copied.IsValid() {
+			return copied, true
+		}
+		return v, false
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.MakeMap(t), true
+		}
+		var copied reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, changed := emptyCollections(iter.Value())
+			if !changed {
+				continue
+			}
+			if !copied.IsValid() {
+				copied = reflect.MakeMapWithSize(t, v.Len())
+				for _, key := range v.MapKeys() {
+					copied.SetMapIndex(key, v.MapIndex(key))
+				}
+			}
+			copied.SetMapIndex(iter.Key(), elem)
+		}
+		if copied.IsValid() {
+			return copied, true
+		}
+		return v, false
+	case reflect.Struct:
+		var copied reflect.Value
+		for idx := 0; idx < v.NumField(); idx++ {
+			// Unexported fields json does not see, or that cannot be set in the copy
+			if !v.Field(idx).CanInterface() {
+				continue
+			}
+			elem, changed := emptyCollections(v.Field(idx))
+			if !changed {
+				continue
+			}
+			if !copied.IsValid() {
+				copied = reflect.New(t).Elem()
+				copied.Set(v)
+			}
+			copied.Field(idx).Set(elem)
+		}
+		if copied.IsValid() {
+			return copied, true
+		}
+		return v, false
+	}
+	return v, false
+}
+
+// copyList copies the slice or array v, for its elements to be changed
+func copyList(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Array {
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		return copied
+	}
+	copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(copied, v)
+	return copied
+}
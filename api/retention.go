@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+)
+
+// What a retention policy would delete now
+type retentionEntry struct {
+	Kind      string    `json:"kind"`
+	Retention string    `json:"retention"`
+	Before    time.Time `json:"before"`
+	Expired   int64     `json:"expired"`
+}
+
+// ValidateRetention checks the kinds and periods of Config.Retention
+func ValidateRetention(retention map[string]time.Duration) error {
+	for kind, period := range retention {
+		if !containsString(db.RetainedKinds, kind) {
+			return fmt.Errorf("no retention for %q", kind)
+		}
+		if period <= 0 {
+			return fmt.Errorf("the retention of %s must be positive", kind)
+		}
+	}
+	return nil
+}
+
+// retentionPolicies returns the kinds with a retention period in order, with the time what is older than goes
+func (s *Server) retentionPolicies(now time.Time) []retentionEntry {
+	var entries []retentionEntry
+	for _, kind := range db.RetainedKinds {
+		period, ok := s.config.Retention[kind]
+		if !ok || period <= 0 {
+			continue
+		}
+		entries = append(entries, retentionEntry{Kind: kind, Retention: period.String(), Before: now.Add(-period)})
+	}
+	return entries
+}
+
+/*
+PurgeExpired deletes the bookings, audit entries, search events and sessions
+older than their retention period before now, for those that have one. It
+returns how many rows of each kind went.
+*/
+func (s *Server) PurgeExpired(now time.Time) map[string]int64 {
+	purged := make(map[string]int64)
+	for _, policy := range s.retentionPolicies(now) {
+		count, err := s.repo.PurgeExpired(policy.Kind, policy.Before)
+		if err != nil {
+			s.logger.Println("Error purging", policy.Kind, err)
+			continue
+		}
+		if count > 0 {
+			purged[policy.Kind] = count
+		}
+	}
+	return purged
+}
+
+// Previews the retention purge: for each kind of data with a retention period, how much would go now
+func (s *Server) retentionHandler(w http.ResponseWriter, r *http.Request) {
+	entries := s.retentionPolicies(time.Now())
+	for idx := range entries {
+		count, err := s.repo.CountExpired(entries[idx].Kind, entries[idx].Before)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries[idx].Expired = count
+	}
+	if entries == nil {
+		entries = []retentionEntry{}
+	}
+	s.writeJSON(w, r, http.StatusOK, entries)
+}
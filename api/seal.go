@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// What resealing the refresh tokens changed
+type resealResult struct {
+	Resealed int `json:"resealed"`
+	// Sealed with a key no longer configured or damaged; they keep working until their session ends, but cannot be revoked
+	Unreadable int `json:"unreadable"`
+}
+
+// sealToken encrypts a refresh token before it is stored, when Config.TokenKeys is set
+func (s *Server) sealToken(refreshToken string) (string, error) {
+	if s.config.TokenKeys == nil || refreshToken == "" {
+		return refreshToken, nil
+	}
+	return s.config.TokenKeys.Seal(refreshToken)
+}
+
+// openToken decrypts a refresh token read from the database; one stored before encryption is returned as is
+func (s *Server) openToken(stored string) (string, error) {
+	if s.config.TokenKeys == nil {
+		return stored, nil
+	}
+	return s.config.TokenKeys.Open(stored)
+}
+
+/*
+resealTokens seals every stored refresh token not sealed with the current key
+again: those stored before encryption was turned on, and those sealed with a
+key being rotated out. Once it is done the old key can be dropped.
+*/
+func (s *Server) resealTokens(ctx context.Context, progress func(done int, total int)) (resealResult, error) {
+	var result resealResult
+	tokens, err := s.repo.GetRefreshTokens()
+	if err != nil {
+		return result, err
+	}
+	done := 0
+	for id, stored := range tokens {
+		progress(done, len(tokens))
+		done++
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		if s.config.TokenKeys.Current(stored) {
+			continue
+		}
+		refreshToken, err := s.config.TokenKeys.Open(stored)
+		if err != nil {
+			result.Unreadable++
+			continue
+		}
+		sealed, err := s.config.TokenKeys.Seal(refreshToken)
+		if err != nil {
+			return result, err
+		}
+		replaced, err := s.repo.ReplaceRefreshToken(id, stored, sealed)
+		if err != nil {
+			return result, err
+		}
+		if replaced {
+			result.Resealed++
+		}
+	}
+	progress(len(tokens), len(tokens))
+	return result, nil
+}
+
+// Starts sealing the stored refresh tokens with the current key in the background, see resealTokens
+func (s *Server) resealTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if s.config.TokenKeys == nil {
+		http.Error(w, "No token keys configured", http.StatusConflict)
+		return
+	}
+	s.audit(r, auditResealTokens, "", "")
+	s.submitTask(w, r, taskResealTokens, func(ctx context.Context, progress func(done int, total int)) (interface{}, error) {
+		return s.resealTokens(ctx, progress)
+	})
+}
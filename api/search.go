@@ -0,0 +1,192 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Kinds of search results
+const (
+	searchClassroom = "classroom"
+	searchSubject   = "subject"
+	searchFaculty   = "faculty"
+)
+
+// Longest accepted search query, in bytes
+const searchMaxQueryLength = 64
+
+type searchResult struct {
+	Type  string  `json:"type"`
+	ID    string  `json:"id"`
+	Name  string  `json:"name,omitempty"`
+	Score float64 `json:"score"`
+}
+
+// normalize lowercases value and drops everything but letters, digits and single spaces
+func normalize(value string) string {
+	var b strings.Builder
+	space := false
+	for _, c := range strings.ToLower(value) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteRune(c)
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// levenshtein is the edit distance between a and b
+func levenshtein(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// isSubsequence reports whether the letters of query appear in target in order
+func isSubsequence(query string, target string) bool {
+	rest := []rune(query)
+	for _, c := range target {
+		if len(rest) > 0 && c == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+/*
+matchScore rates how well the normalized query matches target, from 1 for the
+same text down to 0 for no match. Whole-text matches beat matches on one word
+of target, and a few typos (one for every four letters) still count.
+*/
+func matchScore(query string, target string) float64 {
+	target = normalize(target)
+	switch {
+	case query == "" || target == "":
+		return 0
+	case target == query:
+		return 1
+	case strings.HasPrefix(target, query):
+		return 0.9
+	}
+	best := 0.0
+	for _, word := range strings.Fields(target) {
+		if strings.HasPrefix(word, query) {
+			best = 0.8
+			break
+		}
+	}
+	if best == 0 && strings.Contains(target, query) {
+		best = 0.7
+	}
+	if best > 0 {
+		return best
+	}
+	allowed := len([]rune(query)) / 4
+	if allowed > 0 {
+		for _, word := range append(strings.Fields(target), target) {
+			// Compare with the start of word, so that a misspelt prefix still matches
+			runes := []rune(word)
+			if len(runes) > len([]rune(query)) {
+				word = string(runes[:len([]rune(query))])
+			}
+			if distance := levenshtein(query, word); distance <= allowed {
+				score := 0.6 - 0.1*float64(distance-1)
+				if score > best {
+					best = score
+				}
+			}
+		}
+	}
+	if best == 0 && isSubsequence(strings.ReplaceAll(query, " ", ""), strings.ReplaceAll(target, " ", "")) {
+		best = 0.3
+	}
+	return best
+}
+
+// The better of the scores of query against each of targets
+func bestScore(query string, targets ...string) float64 {
+	best := 0.0
+	for _, target := range targets {
+		if score := matchScore(query, target); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+/*
+searchHandler serves /api/v1/search?q=...&limit=20, a fuzzy search across
+classroom names, subject codes and titles, and faculty names and mails. The
+results are the best matches first, each with its type.
+*/
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := normalize(r.URL.Query().Get("q"))
+	if query == "" || len(query) > searchMaxQueryLength {
+		http.Error(w, "Invalid q value", http.StatusBadRequest)
+		return
+	}
+	limit, ok := parseLimit(r, 20)
+	if !ok || limit > 50 {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	catalog, err := s.repo.GetCatalog()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results := []searchResult{}
+	add := func(kind string, id string, name string, score float64) {
+		if score > 0 {
+			results = append(results, searchResult{Type: kind, ID: id, Name: name, Score: score})
+		}
+	}
+	for _, class := range catalog.Classes {
+		add(searchClassroom, class, "", bestScore(query, class))
+	}
+	for _, subject := range catalog.Subjects {
+		add(searchSubject, subject.ID, subject.Name, bestScore(query, subject.ID, subject.Name))
+	}
+	for _, faculty := range catalog.Faculty {
+		// Only the part of the mail before the @ is worth matching
+		user := strings.SplitN(faculty.ID, "@", 2)[0]
+		add(searchFaculty, faculty.ID, faculty.Name, bestScore(query, faculty.Name, user))
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	s.writeJSON(w, r, http.StatusOK, results)
+}
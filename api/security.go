@@ -0,0 +1,318 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Kinds of security events
+const (
+	securityFailure = "auth.failure"
+	securityLockout = "auth.lockout"
+	securityAnomaly = "auth.anomaly"
+)
+
+// Where a client sends its answer to the challenge, see Config.Challenger
+const challengeHeader = "X-Cora-Challenge"
+
+// A user logging in from this many addresses within anomalyWindow is reported
+const (
+	anomalyLoginIPs = 5
+	anomalyWindow   = time.Hour
+)
+
+/*
+failureTracker counts the failed logins of each IP and subject in memory, and
+keeps the IPs locked out for failing too often. It also remembers where users
+logged in from lately, to notice accounts used from many places at once.
+*/
+type failureTracker struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	locked   map[string]time.Time
+	// By mail, the addresses of their logins and when they were last seen
+	logins map[string]map[string]time.Time
+	swept  time.Time
+}
+
+func newFailureTracker() *failureTracker {
+	return &failureTracker{
+		failures: make(map[string][]time.Time),
+		locked:   make(map[string]time.Time),
+		logins:   make(map[string]map[string]time.Time),
+	}
+}
+
+// recent drops the times of key older than window and returns those left; t.mu is held
+func (t *failureTracker) recent(key string, now time.Time, window time.Duration) []time.Time {
+	times := t.failures[key]
+	for len(times) > 0 && now.Sub(times[0]) > window {
+		times = times[1:]
+	}
+	if len(times) == 0 {
+		delete(t.failures, key)
+		return nil
+	}
+	t.failures[key] = times
+	return times
+}
+
+// fail records a failure of key and returns how many it had within window
+func (t *failureTracker) fail(key string, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now, window)
+	t.failures[key] = append(t.recent(key, now, window), now)
+	return len(t.failures[key])
+}
+
+func (t *failureTracker) count(key string, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.recent(key, now, window))
+}
+
+func (t *failureTracker) lock(key string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.locked[key] = until
+}
+
+// lockedFor returns how long key stays locked out, 0 when it is not
+func (t *failureTracker) lockedFor(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.locked[key]
+	if !ok || !now.Before(until) {
+		delete(t.locked, key)
+		return 0
+	}
+	return until.Sub(now)
+}
+
+// unlock lifts the lockout of key and forgets its failures, and tells whether it was locked
+func (t *failureTracker) unlock(key string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.locked[key]
+	delete(t.locked, key)
+	delete(t.failures, key)
+	return ok && now.Before(until)
+}
+
+func (t *failureTracker) lockouts(now time.Time) map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lockouts := make(map[string]time.Time)
+	for key, until := range t.locked {
+		if now.Before(until) {
+			lockouts[key] = until
+		}
+	}
+	return lockouts
+}
+
+// login records a login of mail from ip and returns from how many addresses they logged in within window
+func (t *failureTracker) login(mail string, ip string, now time.Time, window time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ips, ok := t.logins[mail]
+	if !ok {
+		ips = make(map[string]time.Time)
+		t.logins[mail] = ips
+	}
+	ips[ip] = now
+	for seenIP, at := range ips {
+		if now.Sub(at) > window {
+			delete(ips, seenIP)
+		}
+	}
+	return len(ips)
+}
+
+// Every few minutes forget what is too old to matter; t.mu is held
+func (t *failureTracker) sweep(now time.Time, window time.Duration) {
+	if now.Sub(t.swept) < 5*time.Minute {
+		return
+	}
+	t.swept = now
+	for key := range t.failures {
+		t.recent(key, now, window)
+	}
+	for key, until := range t.locked {
+		if !now.Before(until) {
+			delete(t.locked, key)
+		}
+	}
+	for mail, ips := range t.logins {
+		for ip, at := range ips {
+			if now.Sub(at) > anomalyWindow {
+				delete(ips, ip)
+			}
+		}
+		if len(ips) == 0 {
+			delete(t.logins, mail)
+		}
+	}
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// securityEvent records event about the request; failing to is only logged
+func (s *Server) securityEvent(r *http.Request, kind string, subject string, detail string) {
+	err := s.repo.RecordSecurityEvent(db.SecurityEvent{
+		Kind:    kind,
+		IP:      clientIP(r),
+		Subject: subject,
+		Detail:  detail,
+		At:      time.Now(),
+	})
+	if err != nil {
+		s.logger.Println("Error recording security event", err)
+	}
+}
+
+/*
+checkLockout answers 429 to a client locked out for failing to log in too
+often and returns false. On success it has written nothing.
+*/
+func (s *Server) checkLockout(w http.ResponseWriter, r *http.Request) bool {
+	wait := s.failures.lockedFor(ipKey(clientIP(r)), time.Now())
+	if wait == 0 {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)+1))
+	http.Error(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+	return false
+}
+
+/*
+checkChallenge makes a client that failed to log in Config.ChallengeAfter times
+answer the challenge in the X-Cora-Challenge header: without one it answers
+428, with a wrong one 403, and returns false. On success it has written
+nothing.
+*/
+func (s *Server) checkChallenge(w http.ResponseWriter, r *http.Request) bool {
+	if s.config.Challenger == nil {
+		return true
+	}
+	ip := clientIP(r)
+	if s.failures.count(ipKey(ip), time.Now(), s.config.LoginFailureWindow) < s.config.ChallengeAfter {
+		return true
+	}
+	answer := r.Header.Get(challengeHeader)
+	if answer == "" {
+		http.Error(w, "Challenge required", http.StatusPreconditionRequired)
+		return false
+	}
+	err := s.config.Challenger.Verify(r.Context(), answer, ip)
+	if errors.Is(err, auth.ErrChallengeFailed) {
+		s.authFailed(r, "", "challenge failed")
+		http.Error(w, "Challenge failed", http.StatusForbidden)
+		return false
+	}
+	if err != nil {
+		s.logger.Println("Error verifying challenge", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return false
+	}
+	return true
+}
+
+/*
+authFailed records a failed login or API key from the request, about subject
+when it is known. An IP failing Config.LoginMaxFailures times within the window
+is locked out; a subject failing as often, from wherever, is reported as an
+anomaly, since locking it would let anyone lock a user or service out.
+*/
+func (s *Server) authFailed(r *http.Request, subject string, detail string) {
+	s.securityEvent(r, securityFailure, subject, detail)
+	now := time.Now()
+	ip := clientIP(r)
+	if s.failures.fail(ipKey(ip), now, s.config.LoginFailureWindow) >= s.config.LoginMaxFailures &&
+		s.failures.lockedFor(ipKey(ip), now) == 0 {
+		s.failures.lock(ipKey(ip), now.Add(s.config.LoginLockout))
+		s.securityEvent(r, securityLockout, subject, "locked out for "+s.config.LoginLockout.String())
+	}
+	if subject != "" && s.failures.fail(subject, now, s.config.LoginFailureWindow) == s.config.LoginMaxFailures {
+		s.securityEvent(r, securityAnomaly, subject, strconv.Itoa(s.config.LoginMaxFailures)+" failures within "+s.config.LoginFailureWindow.String())
+	}
+}
+
+// loginSucceeded reports a user logging in from more places at once than people do
+func (s *Server) loginSucceeded(r *http.Request, mail string) {
+	if s.failures.login(mail, clientIP(r), time.Now(), anomalyWindow) == anomalyLoginIPs {
+		s.securityEvent(r, securityAnomaly, mail, "logins from "+strconv.Itoa(anomalyLoginIPs)+" addresses within "+anomalyWindow.String())
+	}
+}
+
+func (s *Server) writeSecurity(w http.ResponseWriter, r *http.Request, v interface{}) {
+	s.writeJSON(w, r, http.StatusOK, v)
+}
+
+// The latest security events, narrowed down by the kind, ip and subject parameters
+func (s *Server) securityEventsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, 50)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Kind    string `param:"kind"`
+		IP      string `param:"ip"`
+		Subject string `param:"subject"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	events, err := s.repo.GetSecurityEvents(db.SecurityEventFilter{
+		Kind:    query.Kind,
+		IP:      query.IP,
+		Subject: query.Subject,
+		Limit:   limit,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []db.SecurityEvent{}
+	}
+	s.writeSecurity(w, r, events)
+}
+
+type lockoutResponse struct {
+	IP    string    `json:"ip"`
+	Until time.Time `json:"until"`
+}
+
+// Lists the IPs locked out now, the one locked out the longest first
+func (s *Server) lockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts := []lockoutResponse{}
+	for key, until := range s.failures.lockouts(time.Now()) {
+		lockouts = append(lockouts, lockoutResponse{IP: key[len(ipKey("")):], Until: until})
+	}
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].Until.After(lockouts[j].Until) })
+	s.writeSecurity(w, r, lockouts)
+}
+
+// Lifts the lockout of an IP, for someone locked out by mistake or behind a shared address
+func (s *Server) liftLockoutHandler(w http.ResponseWriter, r *http.Request) {
+	ip := router.Param(r, "ip")
+	if !s.failures.unlock(ipKey(ip), time.Now()) {
+		http.Error(w, "No such lockout", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditLiftLockout, ip, "")
+	w.WriteHeader(http.StatusNoContent)
+}
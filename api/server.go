@@ -0,0 +1,551 @@
+/*
+Package api holds the HTTP handlers of the server. Everything a handler needs
+(the database, the response cache, the identity providers and a logger) is
+given to NewServer, so main only has to read the config and wire things up and
+the handlers can be tested against fakes.
+*/
+package api
+
+import (
+	cryptorand "crypto/rand"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/erp"
+	"github.com/deebakkarthi/coraserver/jobs"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/ratelimit"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/seal"
+	"github.com/deebakkarthi/coraserver/storage"
+	"github.com/deebakkarthi/coraserver/token"
+	"github.com/deebakkarthi/coraserver/web"
+)
+
+const (
+	sessionCookie   = "cora_session"
+	sessionLifetime = 30 * 24 * time.Hour
+	// Minimum time between two updates of a session's last_active_at
+	sessionTouchInterval = time.Minute
+	// How long the slot, class and subject lists are served from the cache
+	listCacheTTL = 5 * time.Minute
+)
+
+// Cache stores encoded responses; *cache.Memory implements it
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+type Config struct {
+	/*
+		Identity providers users can log in with, keyed by the name used in
+		/oauth/{provider}/login. DefaultProvider serves the plain /oauth/login
+		and /oauth/exchange routes.
+	*/
+	Providers       map[string]auth.Provider
+	DefaultProvider auth.Provider
+	// Redirect URLs accepted from mobile clients in /oauth/exchange, per provider
+	MobileRedirectURLs map[string][]string
+	// Initial Settings, see Server.UpdateSettings
+	Settings Settings
+	// Serve DebugHandler under /admin/debug/, for when it has no port of its own
+	Debug bool
+	// Time zone of the institution, which decides what "today" is. Defaults to time.Local.
+	Location *time.Location
+	// Delivers messages to users. Defaults to writing them to the log.
+	Notifier notify.Notifier
+	// Mails the digests users want by mail. They are pushed like other messages when nil.
+	Mailer notify.Notifier
+	/*
+		Texts emergency broadcasts and changes to exam halls to the users who
+		opted in with a phone number; nothing is texted when nil
+	*/
+	SMS notify.SMS
+	/*
+		Posts timetable changes and announcements to the Teams channels of
+		class sections, see /admin/teams; nothing is posted when nil
+	*/
+	Teams notify.Teams
+	// Day of the week the weekly digests are sent on, Sunday by default
+	WeeklyDigestDay time.Weekday
+	// Messages per second broadcasts are delivered at. Defaults to 10.
+	BroadcastRate int
+	// How long after its slot starts a booking nobody checked in to is released. Defaults to 15 minutes.
+	CheckInGrace time.Duration
+	// Attendance percentage under which students are alerted and reported at risk. Defaults to 75.
+	AttendanceThreshold float64
+	// Domain of student mails, whose local part is the roll number; attendance alerts are only sent when it is set
+	StudentMailDomain string
+	// Where uploaded attachments are kept; uploads are refused without one
+	Storage storage.Store
+	// Where backups of the timetable, classrooms and bookings are kept; they are refused without one
+	Backups storage.Store
+	// Where classrooms, courses, faculty and the timetable are synced from, see package erp
+	Importers []erp.Importer
+	// How long the response to a request with an Idempotency-Key is replayed to its retries. Defaults to 24 hours.
+	IdempotencyWindow time.Duration
+	// How long a CDN or proxy in front may serve the public lookups; 0 has it ask every time
+	CDNMaxAge time.Duration
+	// Drops what a CDN or proxy cached under the surrogate keys of changed answers; nothing is purged when nil
+	Purger Purger
+	// Signs attachment download URLs. Defaults to a random key, which makes the URLs stop working on restart.
+	AttachmentKey []byte
+	// Largest accepted upload. Defaults to 10 MB.
+	MaxUploadBytes int64
+	/*
+		Name of the institution in a multi-tenant deployment, see TenantHandler.
+		Session IDs and API keys start with it so requests can be routed by them.
+	*/
+	Tenant string
+	// How long deleted timetable entries, bookings and announcements can be restored. Defaults to 30 days.
+	TrashRetention time.Duration
+	// How long notifications are kept in the users' inboxes. Defaults to 90 days.
+	NotificationRetention time.Duration
+	/*
+		How long each kind of data in db.RetainedKinds is kept, after which the
+		retention-purge job deletes it. Kinds without one are kept forever.
+	*/
+	Retention map[string]time.Duration
+	/*
+		Schedules of the background jobs by name, see jobs.Parse, in place of
+		their defaults. JobOff keeps one from running on its own.
+	*/
+	JobSchedules map[string]string
+	// How many background tasks, like async imports, run at once. Defaults to 2.
+	TaskWorkers int
+	/*
+		An IP failing to log in or with an API key LoginMaxFailures times within
+		LoginFailureWindow is locked out for LoginLockout. Default to 10, 15
+		minutes and 15 minutes.
+	*/
+	LoginMaxFailures   int
+	LoginFailureWindow time.Duration
+	LoginLockout       time.Duration
+	// When set, IPs that failed to log in ChallengeAfter times (3 by default) have to pass it to try again
+	Challenger     auth.Challenger
+	ChallengeAfter int
+	// Bytes of randomness in OAuth states, session IDs, API key secrets and check-in codes, see package token. Defaults to 32.
+	TokenBytes int
+	/*
+		Encrypts the refresh tokens of sessions in the database. Without it
+		they are stored as the provider issued them.
+	*/
+	TokenKeys *seal.Keyring
+}
+
+type Server struct {
+	repo          db.Repository
+	cache         Cache
+	config        Config
+	logger        *log.Logger
+	apiKeyLimiter *ratelimit.Limiter
+	failures      *failureTracker
+	traffic       *trafficLog
+	jobs          *jobs.Scheduler
+	tasks         *jobs.Queue
+	changes       *changeFeed
+	roomNames     *roomNames
+	// Broadcasts started by each user
+	broadcasts *ratelimit.Limiter
+	// Feedback sent by each user or anonymous client
+	feedback *ratelimit.Limiter
+	// The last run of each ERP importer
+	imports *importRuns
+	// The Idempotency-Keys of the requests running
+	idempotency *idempotencyLocks
+	// Texts waiting for Config.SMS, see textUser and RunTexts
+	texts chan db.Text
+	// Closed by StopTexts, once, to stop RunTexts, which closes textsDone when it returns
+	stopTexts     chan struct{}
+	stopTextsOnce sync.Once
+	textsDone     chan struct{}
+	// Holds a Settings
+	currentSettings atomic.Value
+}
+
+func NewServer(repo db.Repository, cache Cache, config Config, logger *log.Logger) *Server {
+	s := &Server{
+		repo:          repo,
+		cache:         cache,
+		config:        config,
+		logger:        logger,
+		apiKeyLimiter: ratelimit.New(),
+		failures:      newFailureTracker(),
+		traffic:       newTrafficLog(),
+		changes:       newChangeFeed(),
+		roomNames:     &roomNames{},
+		broadcasts:    ratelimit.New(),
+		feedback:      ratelimit.New(),
+		imports:       &importRuns{},
+		idempotency:   &idempotencyLocks{},
+	}
+	s.repo = changeRecorder{Repository: repo, feed: s.changes}
+	s.changes.onRecord = s.purgeChange
+	if s.config.Location == nil {
+		s.config.Location = time.Local
+	}
+	if s.config.Notifier == nil {
+		s.config.Notifier = notify.Log{Logger: logger}
+	}
+	if s.config.CheckInGrace == 0 {
+		s.config.CheckInGrace = 15 * time.Minute
+	}
+	if s.config.AttendanceThreshold == 0 {
+		s.config.AttendanceThreshold = 75
+	}
+	if len(s.config.AttachmentKey) == 0 {
+		s.config.AttachmentKey = make([]byte, 32)
+		_, err := cryptorand.Read(s.config.AttachmentKey)
+		if err != nil {
+			panic(err)
+		}
+		logger.Println("No attachment key configured, download links will stop working on restart")
+	}
+	if s.config.MaxUploadBytes == 0 {
+		s.config.MaxUploadBytes = 10 << 20
+	}
+	if s.config.IdempotencyWindow == 0 {
+		s.config.IdempotencyWindow = 24 * time.Hour
+	}
+	if s.config.TrashRetention == 0 {
+		s.config.TrashRetention = 30 * 24 * time.Hour
+	}
+	if s.config.BroadcastRate == 0 {
+		s.config.BroadcastRate = 10
+	}
+	if s.config.NotificationRetention == 0 {
+		s.config.NotificationRetention = 90 * 24 * time.Hour
+	}
+	s.config.Notifier = inbox{repo: s.repo, next: s.config.Notifier, logger: logger}
+	if s.config.SMS != nil {
+		s.texts = make(chan db.Text, smsBacklog)
+		s.stopTexts = make(chan struct{})
+		s.textsDone = make(chan struct{})
+	}
+	s.currentSettings.Store(config.Settings)
+	for _, provider := range s.config.Providers {
+		if caching, ok := provider.(auth.ProfileCaching); ok {
+			caching.SetProfileStore(profileStore{repo: repo})
+		}
+	}
+	if s.config.TaskWorkers == 0 {
+		s.config.TaskWorkers = 2
+	}
+	if s.config.LoginMaxFailures == 0 {
+		s.config.LoginMaxFailures = 10
+	}
+	if s.config.LoginFailureWindow == 0 {
+		s.config.LoginFailureWindow = 15 * time.Minute
+	}
+	if s.config.LoginLockout == 0 {
+		s.config.LoginLockout = 15 * time.Minute
+	}
+	if s.config.ChallengeAfter == 0 {
+		s.config.ChallengeAfter = 3
+	}
+	if s.config.TokenBytes == 0 {
+		s.config.TokenBytes = token.DefaultBytes
+	}
+	if s.config.TokenKeys == nil {
+		logger.Println("No token keys configured, refresh tokens are stored unencrypted")
+	}
+	s.jobs = s.newScheduler()
+	s.tasks = jobs.NewQueue(s.config.TaskWorkers, taskBacklog, taskRetention, logger)
+	return s
+}
+
+// Routes builds the router serving every endpoint
+func (s *Server) Routes() *router.Router {
+	r := router.New()
+	r.Use(s.traceRequest, s.localizeErrors, s.logTraffic, s.canonicalRooms, s.idempotentPosts)
+
+	r.Route("/oauth", func(oauth *router.Router) {
+		oauth.Get("/login", s.oauthLoginHandler)
+		oauth.Get("/exchange", s.oauthExchangeHandler)
+		oauth.Post("/logout", s.oauthLogoutHandler)
+		oauth.Get("/{provider}/login", s.oauthProviderLoginHandler)
+		oauth.Get("/{provider}/exchange", s.oauthProviderExchangeHandler)
+	})
+
+	r.Get("/announcements", s.announcementsHandler)
+	r.Post("/feedback", s.createFeedbackHandler)
+	r.With(s.requireSession).Get("/booking/{id}/qr", s.bookingQRHandler)
+	r.Get("/booking/{id}/checkin", s.checkInHandler)
+	r.With(s.requireSession).Get("/attachments/{id}", s.attachmentHandler)
+	r.Get("/files/{id}", s.fileHandler)
+	r.Post("/sms/status", s.smsStatusHandler)
+
+	r.Route("/api/v1", func(v1 *router.Router) {
+		v1.Use(s.apiKeyScope(ScopeTimetableRead))
+		v1.Get("/search", s.searchHandler)
+	})
+
+	graphql := s.graphqlHandler()
+	r.Get("/graphql", graphql)
+	r.Post("/graphql", graphql)
+
+	r.Route("/me", func(me *router.Router) {
+		me.Use(s.requireSession)
+		me.Get("/sessions", s.mySessionsHandler)
+		me.Delete("/sessions/{id}", s.deleteMySessionHandler)
+		me.Get("/favorites", s.myFavoritesHandler)
+		me.Post("/favorites", s.addFavoriteHandler)
+		me.Delete("/favorites/{kind}/{id}", s.deleteFavoriteHandler)
+		me.Get("/recent", s.myRecentHandler)
+		me.Get("/preferences", s.myPreferencesHandler)
+		me.Put("/preferences", s.setPreferencesHandler)
+		me.Get("/exams", s.myExamsHandler)
+		me.Get("/calendar.ics", s.myCalendarHandler)
+		me.Get("/timetable", s.myTimetableHandler)
+		me.Get("/timetable/custom", s.myCustomEntriesHandler)
+		me.Post("/timetable/custom", s.createCustomEntryHandler)
+		me.Delete("/timetable/custom/{id}", s.deleteCustomEntryHandler)
+		me.Get("/gaps", s.myGapsHandler)
+		me.Get("/notifications", s.myNotificationsHandler)
+		me.Get("/notifications/unread", s.myUnreadHandler)
+		me.Post("/notifications/read", s.readNotificationsHandler)
+		me.Post("/broadcasts", s.broadcastHandler)
+		me.Get("/broadcasts/{id}", s.myBroadcastHandler)
+		me.Get("/feedback", s.myFeedbackHandler)
+		me.Get("/export", s.exportHandler)
+		me.Get("/delete", s.myErasuresHandler)
+		me.Post("/delete", s.requestErasureHandler)
+		me.Put("/overrides/{class}/{date}/{slot}", s.setOverrideHandler)
+		me.Delete("/overrides/{class}/{date}/{slot}", s.deleteOverrideHandler)
+		me.Get("/changes", s.myChangesHandler)
+		me.Post("/changes", s.createChangeHandler)
+		me.Get("/events", s.myEventsHandler)
+		me.Post("/events", s.createEventHandler)
+		me.Delete("/events/{id}", s.deleteMyEventHandler)
+		me.Get("/events/pending", s.pendingEventsHandler)
+		me.Post("/events/{id}/approve", s.approveEventHandler)
+		me.Post("/events/{id}/reject", s.rejectEventHandler)
+		me.Get("/clubs", s.myClubsHandler)
+		me.Put("/clubs/{id}/members/{mail}", s.setClubMemberHandler)
+		me.Delete("/clubs/{id}/members/{mail}", s.deleteClubMemberHandler)
+		me.Get("/waitlist", s.myWaitlistHandler)
+		me.Post("/waitlist", s.joinWaitlistHandler)
+		me.Delete("/waitlist/{id}", s.leaveWaitlistHandler)
+		me.Get("/attendance", s.myAttendanceHandler)
+		me.Get("/attendance/{class}/{date}/{slot}", s.attendanceHandler)
+		me.Put("/attendance/{class}/{date}/{slot}", s.setAttendanceHandler)
+		me.Get("/assignments", s.myAssignmentsHandler)
+		me.Post("/assignments", s.createAssignmentHandler)
+		me.Put("/assignments/{id}", s.updateAssignmentHandler)
+		me.Delete("/assignments/{id}", s.deleteAssignmentHandler)
+		me.Post("/attachments", s.uploadAttachmentHandler)
+		me.Delete("/attachments/{id}", s.deleteAttachmentHandler)
+		me.Get("/officehours", s.myOfficeHoursHandler)
+		me.Put("/officehours", s.setOfficeHoursHandler)
+		me.Get("/appointments", s.myAppointmentsHandler)
+		me.Post("/appointments", s.requestAppointmentHandler)
+		me.Post("/appointments/{id}/accept", s.acceptAppointmentHandler)
+		me.Post("/appointments/{id}/decline", s.declineAppointmentHandler)
+	})
+
+	/*
+		The mobile app only speaks GET, so the booking endpoints that change
+		things are GET too
+	*/
+	r.Route("/db", func(dbRoutes *router.Router) {
+		freeClass := dbRoutes.With(s.apiKeyScope(ScopeFreeClassRead))
+		freeClass.Get("/freeclass", s.freeClassHandler)
+		freeClass.Get("/freeslot", s.freeSlotHandler)
+		freeClass.Get("/multiFreeSlot", s.multiFreeSlotHandler)
+		freeClass.Get("/freenow", s.freeNowHandler)
+		freeClass.Get("/freerooms", s.freeRoomsHandler)
+		freeClass.Get("/suggestroom", s.suggestRoomHandler)
+		freeClass.Get("/equipment", s.equipmentHandler)
+
+		timetable := dbRoutes.With(s.apiKeyScope(ScopeTimetableRead))
+		timetable.Get("/daytimetable", s.dayTimetableHandler)
+		timetable.Get("/getAllSlot", s.getAllSlotHandler)
+		timetable.Get("/getAllClass", s.getAllClassHandler)
+		timetable.Get("/getAllSubject", s.getAllSubjectHandler)
+		timetable.Get("/overrides", s.overridesHandler)
+		timetable.Get("/events", s.eventsHandler)
+		timetable.Get("/campuses", s.campusesHandler)
+		timetable.Get("/changes", s.changesHandler)
+		timetable.Get("/faculty/{id}/availability", s.facultyAvailabilityHandler)
+		timetable.Get("/clubs", s.clubsHandler)
+		timetable.Get("/buildings", s.buildingsHandler)
+		timetable.Get("/buildings/paths", s.buildingPathsHandler)
+		timetable.Get("/walk", s.walkHandler)
+
+		bookingRead := dbRoutes.With(s.apiKeyScope(ScopeBookingRead))
+		bookingRead.Get("/getBooking", s.getBookingHandler)
+		bookingRead.Get("/bookings/{class}/{date}/{slot}", s.bookingByKeyHandler)
+
+		// Bookings made over GET are only retried safely with an Idempotency-Key too
+		bookingWrite := dbRoutes.With(s.apiKeyScope(ScopeBookingWrite), s.idempotent)
+		bookingWrite.Get("/booking", s.bookingHandler)
+		bookingWrite.Get("/multiBooking", s.multiBookingHandler)
+		bookingWrite.Get("/cancelBooking", s.cancelBookingHandler)
+		bookingWrite.Get("/updateBooking", s.updateBookingHandler)
+		bookingWrite.Get("/reserveEquipment", s.reserveEquipmentHandler)
+		bookingWrite.Get("/releaseEquipment", s.releaseEquipmentHandler)
+	})
+
+	r.Route("/admin", func(admin *router.Router) {
+		admin.Route("/analytics", func(analytics *router.Router) {
+			analytics.Use(s.apiKeyScope(ScopeAnalyticsRead), s.requireAdmin)
+			analytics.Get("/utilization", s.utilizationHandler)
+			analytics.Get("/searches", s.searchStatsHandler)
+			analytics.Get("/events", s.searchEventsHandler)
+		})
+
+		admin.Use(s.adminAPIKeyScope, s.requireAdmin)
+		admin.Get("/dashboard", s.dashboardHandler)
+		admin.Get("/timetable", s.adminTimetableHandler)
+		admin.Get("/timetable/versions", s.timetableVersionsHandler)
+		admin.Post("/timetable/versions", s.createTimetableVersionHandler)
+		admin.Get("/timetable/versions/{id}", s.timetableVersionHandler)
+		admin.Delete("/timetable/versions/{id}", s.deleteTimetableVersionHandler)
+		admin.Post("/timetable/versions/{id}/rollback", s.rollbackTimetableHandler)
+		admin.Get("/timetable/diff", s.timetableDiffHandler)
+		admin.Get("/timetable/conflicts", s.timetableConflictsHandler)
+		admin.Put("/timetable/{class}/{day}/{slot}", s.setTimetableHandler)
+		admin.Delete("/timetable/{class}/{day}/{slot}", s.deleteTimetableHandler)
+		admin.Get("/bookings", s.adminBookingsHandler)
+		admin.Delete("/bookings", s.adminCancelBookingsHandler)
+		admin.Delete("/bookings/{class}/{date}/{slot}", s.adminCancelBookingHandler)
+		admin.Get("/users", s.adminUsersHandler)
+		admin.Get("/announcements", s.listAnnouncementsHandler)
+		admin.Post("/announcements", s.createAnnouncementHandler)
+		admin.Put("/announcements/{id}", s.updateAnnouncementHandler)
+		admin.Delete("/announcements/{id}", s.deleteAnnouncementHandler)
+		admin.Get("/audit", s.auditHandler)
+		admin.Get("/exams", s.adminExamsHandler)
+		admin.Post("/exams", s.createExamHandler)
+		admin.Post("/exams/import", s.importExamsHandler)
+		admin.Put("/exams/{id}", s.updateExamHandler)
+		admin.Delete("/exams/{id}", s.deleteExamHandler)
+		admin.Post("/exams/{id}/allocation", s.allocateExamHandler)
+		admin.Put("/overrides/{class}/{date}/{slot}", s.setOverrideHandler)
+		admin.Delete("/overrides/{class}/{date}/{slot}", s.deleteOverrideHandler)
+		admin.Get("/changes", s.adminChangesHandler)
+		admin.Post("/changes/{id}/approve", s.approveChangeHandler)
+		admin.Post("/changes/{id}/reject", s.rejectChangeHandler)
+		admin.Get("/blocks", s.blocksHandler)
+		admin.Post("/blocks", s.createBlockHandler)
+		admin.Delete("/blocks/{id}", s.deleteBlockHandler)
+		admin.Post("/relocations", s.relocateHandler)
+		admin.Delete("/events/{id}", s.adminDeleteEventHandler)
+		admin.Get("/clubs", s.adminClubsHandler)
+		admin.Put("/clubs/{id}", s.setClubHandler)
+		admin.Delete("/clubs/{id}", s.deleteClubHandler)
+		admin.Get("/equipment", s.equipmentHandler)
+		admin.Put("/equipment/{id}", s.setEquipmentHandler)
+		admin.Delete("/equipment/{id}", s.deleteEquipmentHandler)
+		admin.Get("/attendance", s.attendanceReportHandler)
+		admin.Get("/attendance/at-risk", s.atRiskHandler)
+		admin.Get("/attendance/{class}/{date}/{slot}", s.attendanceHandler)
+		admin.Put("/attendance/{class}/{date}/{slot}", s.setAttendanceHandler)
+		admin.Get("/classrooms", s.classroomsHandler)
+		admin.Put("/classrooms/{class}", s.setClassroomHandler)
+		admin.Get("/aliases", s.aliasesHandler)
+		admin.Put("/aliases/{alias}", s.setAliasHandler)
+		admin.Delete("/aliases/{alias}", s.deleteAliasHandler)
+		admin.Get("/teams", s.teamsChannelsHandler)
+		admin.Put("/teams/{section}", s.setTeamsChannelHandler)
+		admin.Delete("/teams/{section}", s.deleteTeamsChannelHandler)
+		admin.Get("/campuses", s.campusesHandler)
+		admin.Put("/campuses/{id}", s.setCampusHandler)
+		admin.Delete("/campuses/{id}", s.deleteCampusHandler)
+		admin.Get("/enrollments", s.enrollmentsHandler)
+		admin.Post("/enrollments", s.importEnrollmentsHandler)
+		admin.Delete("/enrollments/{subject}", s.deleteEnrollmentsHandler)
+		admin.Post("/broadcasts", s.broadcastHandler)
+		admin.Get("/texts", s.textsHandler)
+		admin.Get("/feedback", s.adminFeedbackHandler)
+		admin.Post("/feedback/{id}/resolve", s.resolveFeedbackHandler)
+		admin.Post("/feedback/{id}/dismiss", s.dismissFeedbackHandler)
+		admin.Get("/erasures", s.erasuresHandler)
+		admin.Post("/erasures/{id}/approve", s.approveErasureHandler)
+		admin.Post("/erasures/{id}/reject", s.rejectErasureHandler)
+		admin.Get("/buildings", s.buildingsHandler)
+		admin.Put("/buildings/{id}", s.setBuildingHandler)
+		admin.Delete("/buildings/{id}", s.deleteBuildingHandler)
+		admin.Put("/buildings/{id}/paths/{to}", s.setBuildingPathHandler)
+		admin.Delete("/buildings/{id}/paths/{to}", s.deleteBuildingPathHandler)
+		admin.Get("/trash", s.trashHandler)
+		admin.Post("/trash/{id}/restore", s.restoreTrashHandler)
+		admin.Delete("/trash/{id}", s.purgeTrashHandler)
+		admin.Get("/jobs", s.jobsHandler)
+		admin.Get("/retention", s.retentionHandler)
+		admin.Get("/backups", s.backupsHandler)
+		admin.Post("/backups", s.createBackupHandler)
+		admin.Get("/backups/{id}", s.downloadBackupHandler)
+		admin.Delete("/backups/{id}", s.deleteBackupHandler)
+		admin.Post("/backups/{id}/restore", s.restoreBackupHandler)
+		admin.Post("/restore", s.restoreUploadHandler)
+		admin.Post("/jobs/{name}/run", s.runJobHandler)
+		admin.Post("/jobs/{name}/pause", s.pauseJobHandler)
+		admin.Post("/jobs/{name}/resume", s.resumeJobHandler)
+		admin.Get("/tasks", s.tasksHandler)
+		admin.Get("/tasks/{id}", s.taskHandler)
+		admin.Get("/directory", s.directoryHandler)
+		admin.Get("/directory/{id}", s.directoryUserHandler)
+		admin.Post("/directory/sync", s.syncDirectoryHandler)
+		admin.Get("/groups", s.groupsHandler)
+		admin.Post("/groups/sync", s.syncGroupsHandler)
+		admin.Get("/imports", s.importersHandler)
+		admin.Post("/imports/{name}/run", s.runImportHandler)
+		admin.Post("/impersonations", s.impersonateHandler)
+		admin.Delete("/impersonations/{id}", s.endImpersonationHandler)
+		admin.Get("/security/events", s.securityEventsHandler)
+		admin.Get("/security/lockouts", s.lockoutsHandler)
+		admin.Delete("/security/lockouts/{ip}", s.liftLockoutHandler)
+		admin.Post("/security/reseal", s.resealTokensHandler)
+		admin.Post("/users/{mail}/logout", s.forceLogoutHandler)
+		adminKey := admin.With(requireAdminKey)
+		adminKey.Get("/apikeys", s.listAPIKeysHandler)
+		adminKey.Post("/apikeys", s.createAPIKeyHandler)
+		adminKey.Delete("/apikeys/{id}", s.revokeAPIKeyHandler)
+		adminKey.Post("/apikeys/{id}/rotate", s.rotateAPIKeyHandler)
+		adminKey.Get("/logging", s.loggedRoutesHandler)
+		adminKey.Put("/logging", s.logRouteHandler)
+		adminKey.Delete("/logging", s.unlogRouteHandler)
+
+		if s.config.Debug {
+			// pprof only knows its paths as /debug/pprof/...
+			debug := http.StripPrefix("/admin", DebugHandler())
+			adminKey.Handle(http.MethodGet, "/debug/{path...}", debug)
+			adminKey.Handle(http.MethodPost, "/debug/{path...}", debug)
+		}
+	})
+
+	// The browser front end, for everything the routes above do not take
+	r.Handle(http.MethodGet, "/{path...}", web.Handler())
+
+	return r
+}
+
+/*
+writeCachedJSON serves the response stored under key, or builds it with load,
+caches it for ttl and serves it.
+*/
+func (s *Server) writeCachedJSON(w http.ResponseWriter, r *http.Request, key string, ttl time.Duration,
+	load func() ([]byte, error)) {
+	responseJSON, ok := s.cache.Get(key)
+	if !ok {
+		var err error
+		responseJSON, err = load()
+		if err != nil {
+			s.logger.Println("Error marshalling data", err)
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		s.cache.Set(key, responseJSON, ttl)
+	}
+	s.writeRawJSON(w, r, http.StatusOK, responseJSON)
+}
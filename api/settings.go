@@ -0,0 +1,103 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+Settings are the parts of the configuration that can change while the server
+is running (main reloads them from config.json on SIGHUP). They are swapped as
+a whole, so a request never sees half of an update.
+*/
+type Settings struct {
+	// Shared secret that has to be presented to reach the /admin endpoints
+	AdminKey string
+	// Origins of web front ends allowed to call the API from a browser, or "*"
+	AllowedOrigins []string
+	// Requests per minute of API keys issued without a rateLimit
+	APIKeyRateLimit int
+}
+
+// Validate reports the first problem with s, nil when it can be used
+func (s Settings) Validate() error {
+	if s.APIKeyRateLimit < 0 {
+		return errors.New("apiKeyRateLimit must not be negative")
+	}
+	for _, origin := range s.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("allowedOrigins: %q is not an origin like https://cora.example.edu", origin)
+		}
+	}
+	return nil
+}
+
+func (s *Server) settings() Settings {
+	return s.currentSettings.Load().(Settings)
+}
+
+// UpdateSettings replaces the settings if they are valid and keeps the old ones otherwise
+func (s *Server) UpdateSettings(settings Settings) error {
+	err := settings.Validate()
+	if err != nil {
+		return err
+	}
+	s.currentSettings.Store(settings)
+	return nil
+}
+
+func (s *Server) apiKeyRateLimit() int {
+	if limit := s.settings().APIKeyRateLimit; limit > 0 {
+		return limit
+	}
+	return defaultAPIKeyRateLimit
+}
+
+/*
+CORS lets the allowed origins call the API from a browser, with credentials so
+the session cookie is sent along. Preflight requests are answered here, before
+they reach the router which only knows the methods of each route. It wraps the
+whole router rather than being router middleware for that reason.
+*/
+func (s *Server) CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !originAllowed(s.settings().AllowedOrigins, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", impersonationHeader+", "+idempotentReplayedHeader)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, "+apiKeyHeader+", "+idempotencyKeyHeader)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func originAllowed(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+)
+
+// Texts waiting for Config.SMS; more are recorded failed
+const smsBacklog = 1024
+
+/*
+textUser texts body, in their language, to mail when they opted in to texts of
+critical alerts with a phone in their preferences, and tells whether it did.
+The text is recorded pending and sent by RunTexts, which keeps its status.
+*/
+func (s *Server) textUser(mail string, kind string, body i18n.Message) bool {
+	if s.config.SMS == nil {
+		return false
+	}
+	preferences := s.userPreferences(mail)
+	if preferences.Phone == "" || preferences.Notifications == nil || !preferences.Notifications.SMS {
+		return false
+	}
+	lang := preferences.Language
+	if lang == "" {
+		lang = i18n.English
+	}
+	now := time.Now()
+	text := db.Text{Mail: strings.ToLower(mail), Phone: preferences.Phone, Kind: kind, Body: body.In(lang),
+		Status: notify.SMSPending, CreatedAt: now, UpdatedAt: now}
+	var err error
+	text.ID, err = s.repo.AddText(text)
+	if err != nil {
+		s.logger.Println("Error keeping the text to", mail, err)
+		return false
+	}
+	select {
+	case s.texts <- text:
+	default:
+		s.logger.Println("SMS buffer full, dropping text to", mail)
+		s.repo.UpdateText(text.ID, "", notify.SMSFailed, "Too many texts waiting", time.Now())
+	}
+	return true
+}
+
+// alertUser notifies mail of a critical alert and texts it to them when they opted in, see textUser
+func (s *Server) alertUser(mail string, kind string, title i18n.Message, body i18n.Message) {
+	s.notifyUser(mail, kind, title, body)
+	s.textUser(mail, kind, i18n.M("%s: %s", title, body))
+}
+
+/*
+RunTexts hands the texts textUser queues to Config.SMS one by one, until
+StopTexts. The texts still pending from before the server started, which were
+queued when it stopped or crashed, are sent first. Every text is claimed
+before it is sent, so that a server still draining its queue during a restart,
+or another one on the same database, does not send it again. main runs it,
+like the jobs.
+*/
+func (s *Server) RunTexts() {
+	if s.config.SMS == nil {
+		return
+	}
+	defer close(s.textsDone)
+	pending, err := s.repo.GetTexts(db.TextFilter{Status: notify.SMSPending})
+	if err != nil {
+		s.logger.Println("Error listing the texts pending", err)
+	}
+	for idx := len(pending) - 1; idx >= 0; idx-- {
+		select {
+		case <-s.stopTexts:
+			return
+		default:
+		}
+		s.sendText(pending[idx])
+	}
+	for {
+		select {
+		case text := <-s.texts:
+			s.sendText(text)
+		case <-s.stopTexts:
+			return
+		}
+	}
+}
+
+/*
+StopTexts stops RunTexts once the text being sent is, and waits for that or
+for ctx to be done. The texts still queued stay pending until the next start.
+*/
+func (s *Server) StopTexts(ctx context.Context) error {
+	if s.config.SMS == nil {
+		return nil
+	}
+	s.stopTextsOnce.Do(func() { close(s.stopTexts) })
+	select {
+	case <-s.textsDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+/*
+sendText hands text to Config.SMS and keeps how it went, unless it is no
+longer pending: sent already, or being sent by another server. A text whose
+server stops while it is sending stays sending rather than risk a second SMS.
+*/
+func (s *Server) sendText(text db.Text) {
+	claimed, err := s.repo.ClaimText(text.ID, notify.SMSPending, notify.SMSSending, time.Now())
+	if err != nil {
+		s.logger.Println("Error claiming the text to", text.Mail, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	providerID, err := s.config.SMS.SendSMS(text.Phone, text.Body)
+	status, errText := notify.SMSQueued, ""
+	if err != nil {
+		s.logger.Println("Error texting", text.Mail, err)
+		status, errText = notify.SMSFailed, err.Error()
+	}
+	if err := s.repo.UpdateText(text.ID, providerID, status, errText, time.Now()); err != nil {
+		s.logger.Println("Error keeping the status of the text to", text.Mail, err)
+	}
+}
+
+/*
+smsStatusHandler records the delivery reports Config.SMS posts to its status
+callback. Reports it cannot verify are refused.
+*/
+func (s *Server) smsStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if s.config.SMS == nil {
+		http.Error(w, "Texts are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	status, err := s.config.SMS.ParseStatus(r)
+	if err != nil {
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	if status.ID == "" || status.Status == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.repo.SetTextStatus(status.ID, status.Status, status.Error, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// textsHandler lists the texts sent, latest first, of one user with mail and in one status with status
+func (s *Server) textsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r, 100)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	var query struct {
+		Mail   string `param:"mail"`
+		Status string `param:"status"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	texts, err := s.repo.GetTexts(db.TextFilter{Mail: strings.ToLower(query.Mail), Status: query.Status, Limit: limit})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, texts)
+}
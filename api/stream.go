@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+)
+
+const (
+	// Elements written between flushes of a streamed array
+	streamFlushEvery = 100
+	// Highest limit of the streamed lists; the others stop at 500
+	maxStreamLimit = 50000
+)
+
+/*
+jsonStream writes a JSON array one element at a time, flushing every
+streamFlushEvery elements so the client gets the first rows while the last
+are still being read and the array is never held in memory. Nothing is
+written before the first element, so a failure up to there can still be
+answered with an error status.
+*/
+type jsonStream struct {
+	w       http.ResponseWriter
+	started bool
+	n       int
+}
+
+func newJSONStream(w http.ResponseWriter) *jsonStream {
+	return &jsonStream{w: w}
+}
+
+func (js *jsonStream) add(v interface{}) error {
+	element, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	if !js.started {
+		js.started = true
+		js.w.Header().Set("Content-Type", "application/json")
+		_, err = js.w.Write([]byte("["))
+	} else {
+		_, err = js.w.Write([]byte(","))
+	}
+	if err == nil {
+		_, err = js.w.Write(element)
+	}
+	js.n++
+	if js.n%streamFlushEvery == 0 {
+		js.flush()
+	}
+	return err
+}
+
+func (js *jsonStream) flush() {
+	if flusher, ok := js.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+/*
+endStream closes the array of js, or answers err. Once elements are out the
+status has been sent, so a failure can only cut the array short: it is
+logged and the client is left with JSON that does not parse.
+*/
+func (s *Server) endStream(js *jsonStream, err error) {
+	switch {
+	case err != nil && !js.started:
+		http.Error(js.w, err.Error(), http.StatusInternalServerError)
+	case err != nil:
+		s.logger.Println("Error streaming response", err)
+	case !js.started:
+		js.w.Header().Set("Content-Type", "application/json")
+		js.w.Write([]byte("[]"))
+	default:
+		js.w.Write([]byte("]"))
+		js.flush()
+	}
+}
+
+// parseStreamLimit is parseLimit for the streamed lists, which go up to maxStreamLimit
+func parseStreamLimit(r *http.Request, def int) (int, bool) {
+	return limitParam(r, def, maxStreamLimit)
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+)
+
+// The need met by rooms whose timetable holds labs rather than by equipment
+const needLab = "lab"
+
+// How much each part of the fit weighs in the score of a suggested room, out of 100
+const (
+	needsWeight    = 50
+	capacityWeight = 30
+	buildingWeight = 20
+	// Points of the building weight lost for every minute of walking from near
+	walkPenalty = 2
+)
+
+// A free room and how well it fits what was asked for
+type roomSuggestion struct {
+	Class    string `json:"class"`
+	Score    int    `json:"score"`
+	Capacity int    `json:"capacity,omitempty"`
+	Building string `json:"building,omitempty"`
+	Floor    int    `json:"floor,omitempty"`
+	// Minutes it takes to walk there from near, when asked and known
+	WalkMinutes *int `json:"walkMinutes,omitempty"`
+	// The needs the room meets, and the equipment kept there that meets them
+	Meets     []string `json:"meets"`
+	Equipment []string `json:"equipment"`
+	Missing   []string `json:"missing"`
+}
+
+/*
+suggestRoomHandler ranks the rooms free in slot on day by how well they fit:
+the share of needs they meet, the capacity wasted over the capacity asked for
+and whether they are in building, by default the user's preferred building.
+With near, a building, a classroom or me for where the user is then, the walk
+from there counts instead, less for every minute. Needs are equipment kinds
+kept in the room and not reserved then, like projector; a room whose
+timetable holds labs meets lab. Rooms known to be smaller than capacity are
+left out.
+*/
+func (s *Server) suggestRoomHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Date     time.Time `param:"day,required"`
+		Slot     int       `param:"slot,required"`
+		Capacity int       `param:"capacity,min=1"`
+		Needs    []string  `param:"needs"`
+		Building string    `param:"building"`
+		Near     string    `param:"near"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	date, slot, capacity := query.Date, query.Slot, query.Capacity
+	if !containsInt(s.repo.GetAllSlot(), slot) {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	var needs []string
+	for _, need := range query.Needs {
+		need = strings.ToLower(need)
+		if !containsString(needs, need) {
+			needs = append(needs, need)
+		}
+	}
+	limit, ok := parseLimit(r, 10)
+	if !ok {
+		http.Error(w, "Invalid limit value", http.StatusBadRequest)
+		return
+	}
+	building := query.Building
+	if building == "" {
+		building = s.requestPreferences(r).PreferredBuilding
+	}
+	free, ok := s.onCampus(w, r, s.tracedRepo(r).GetFreeClass(slot, date))
+	if !ok {
+		return
+	}
+	var m campusMap
+	var near string
+	if query.Near != "" {
+		var err error
+		m, err = s.campusMap()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		near, ok = s.nearBuilding(w, r, m, query.Near, date, slot)
+		if !ok {
+			return
+		}
+	}
+
+	classrooms, err := s.repo.GetClassrooms()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rooms := make(map[string]db.Classroom)
+	for _, classroom := range classrooms {
+		rooms[classroom.ID] = classroom
+	}
+	equipment, err := s.repo.GetEquipment()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reservations, err := s.repo.GetEquipmentReservations(date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reserved := make(map[string]bool)
+	for _, reservation := range reservations {
+		reserved[reservation.Equipment] = true
+	}
+	labs := make(map[string]bool)
+	if containsString(needs, needLab) {
+		entries, err := s.repo.GetStatic(db.TimetableFilter{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, entry := range entries {
+			if entry.Span > 1 {
+				labs[entry.Class] = true
+			}
+		}
+	}
+
+	suggestions := []roomSuggestion{}
+	for _, class := range free {
+		room := rooms[class]
+		if capacity > 0 && room.Capacity > 0 && room.Capacity < capacity {
+			continue
+		}
+		suggestion := roomSuggestion{Class: class, Capacity: room.Capacity, Building: room.Building, Floor: room.Floor,
+			Meets: []string{}, Equipment: []string{}, Missing: []string{}}
+		for _, need := range needs {
+			met := need == needLab && labs[class]
+			for _, item := range equipment {
+				if item.Home == class && strings.EqualFold(item.Kind, need) && !reserved[item.ID] {
+					suggestion.Equipment = append(suggestion.Equipment, item.ID)
+					met = true
+				}
+			}
+			if met {
+				suggestion.Meets = append(suggestion.Meets, need)
+			} else {
+				suggestion.Missing = append(suggestion.Missing, need)
+			}
+		}
+		score := float64(needsWeight)
+		if len(needs) > 0 {
+			score = needsWeight * float64(len(suggestion.Meets)) / float64(len(needs))
+		}
+		// Rooms of unknown size may well not fit
+		if capacity == 0 {
+			score += capacityWeight
+		} else if room.Capacity > 0 {
+			score += capacityWeight * float64(capacity) / float64(room.Capacity)
+		}
+		if near != "" {
+			if minutes, found := m.minutes(near, class); found {
+				suggestion.WalkMinutes = &minutes
+				if minutes < buildingWeight/walkPenalty {
+					score += float64(buildingWeight - walkPenalty*minutes)
+				}
+			}
+		} else if building == "" || strings.EqualFold(room.Building, building) {
+			score += buildingWeight
+		}
+		suggestion.Score = int(score + 0.5)
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Class < suggestions[j].Class
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	s.repo.RecordSearch(db.SearchEvent{Kind: db.SearchFreeClass, StartSlot: slot, Date: date})
+	s.writeJSON(w, r, http.StatusOK, suggestions)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/jobs"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Kinds of background tasks
+const (
+	taskImportExams   = "exams.import"
+	taskSyncDirectory = "directory.sync"
+	taskSyncGroups    = "groups.sync"
+	taskResealTokens  = "tokens.reseal"
+	taskBroadcast     = "broadcast.send"
+	taskERPImport     = "erp.import"
+)
+
+const (
+	// Most tasks waiting for a worker; more are refused until some start
+	taskBacklog = 100
+	// How long a finished task can still be polled
+	taskRetention = 24 * time.Hour
+)
+
+func (s *Server) writeTask(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	s.writeJSON(w, r, status, v)
+}
+
+/*
+submitTask queues run and answers 202 with the task, which /admin/tasks/{id}
+(also in the Location header) reports the progress, result or error of.
+*/
+func (s *Server) submitTask(w http.ResponseWriter, r *http.Request, kind string, run jobs.TaskFunc) {
+	s.submitTaskAs(w, r, kind, adminActor(r), "/admin/tasks/", run)
+}
+
+// submitTaskAs is submitTask for tasks createdBy someone else, which location followed by the ID reports on
+func (s *Server) submitTaskAs(w http.ResponseWriter, r *http.Request, kind string, createdBy string, location string,
+	run jobs.TaskFunc) {
+	task, err := s.tasks.Submit(kind, createdBy, run)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too many tasks are waiting, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, jobs.ErrStopped) {
+		http.Error(w, "The server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", location+task.ID)
+	s.writeTask(w, r, http.StatusAccepted, task)
+}
+
+// Lists the background tasks of the last day, the latest first; kind narrows it down
+func (s *Server) tasksHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Kind string `param:"kind"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	s.writeTask(w, r, http.StatusOK, s.tasks.List(query.Kind))
+}
+
+func (s *Server) taskHandler(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.tasks.Get(router.Param(r, "id"))
+	if !ok {
+		http.Error(w, "No such task", http.StatusNotFound)
+		return
+	}
+	s.writeTask(w, r, http.StatusOK, task)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest IDs of a team and of a channel Graph gives
+const (
+	maxTeamIDLength    = 64
+	maxChannelIDLength = 128
+)
+
+/*
+postToTeams posts title and body, in English as the channels are shared, to
+the Teams channels of the sections meeting in class, or to every channel when
+class is empty.
+*/
+func (s *Server) postToTeams(class string, title i18n.Message, body i18n.Message) {
+	if s.config.Teams == nil {
+		return
+	}
+	channels, err := s.repo.GetTeamsChannels()
+	if err != nil {
+		s.logger.Println("Error listing Teams channels to post to", err)
+		return
+	}
+	post := notify.Post{Title: title.String(), Text: body.String()}
+	for _, channel := range channels {
+		if class == "" || channel.HasClass(class) {
+			s.config.Teams.Post(notify.Channel{Webhook: channel.Webhook, TeamID: channel.TeamID, ChannelID: channel.ChannelID}, post)
+		}
+	}
+}
+
+func (s *Server) teamsChannelsHandler(w http.ResponseWriter, r *http.Request) {
+	channels, err := s.repo.GetTeamsChannels()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, channels)
+}
+
+/*
+setTeamsChannelHandler sets where the section of the path is posted to: an
+incoming webhook, or a channel of a team through Graph, and the classrooms it
+meets in.
+*/
+func (s *Server) setTeamsChannelHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Webhook   string   `param:"webhook"`
+		TeamID    string   `param:"teamId"`
+		ChannelID string   `param:"channelId"`
+		Classes   []string `param:"classes"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	channel := db.TeamsChannel{Section: router.Param(r, "section"), Webhook: query.Webhook,
+		TeamID: query.TeamID, ChannelID: query.ChannelID, Classes: query.Classes}
+	if channel.Section == "" || len(channel.Section) > maxSectionLength || strings.Contains(channel.Section, ",") {
+		http.Error(w, "Invalid section value", http.StatusBadRequest)
+		return
+	}
+	if (channel.Webhook == "") == (channel.TeamID == "" && channel.ChannelID == "") {
+		http.Error(w, "Set either webhook or teamId and channelId", http.StatusBadRequest)
+		return
+	}
+	if channel.Webhook != "" {
+		// The webhooks of Teams are on its own hosts, which only take https
+		u, err := url.Parse(channel.Webhook)
+		if err != nil || u.Scheme != "https" || u.Host == "" || len(channel.Webhook) > 512 {
+			http.Error(w, "Invalid webhook value", http.StatusBadRequest)
+			return
+		}
+	} else if channel.TeamID == "" || len(channel.TeamID) > maxTeamIDLength {
+		http.Error(w, "Invalid teamId value", http.StatusBadRequest)
+		return
+	} else if channel.ChannelID == "" || len(channel.ChannelID) > maxChannelIDLength {
+		http.Error(w, "Invalid channelId value", http.StatusBadRequest)
+		return
+	}
+	classes := s.repo.GetAllClass()
+	for _, class := range channel.Classes {
+		if !containsString(classes, class) {
+			http.Error(w, "Invalid classes value", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(strings.Join(channel.Classes, ",")) > 256 {
+		http.Error(w, "Invalid classes value", http.StatusBadRequest)
+		return
+	}
+	err := s.repo.SetTeamsChannel(channel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Not the webhook, anyone who reads it can post to the channel
+	s.audit(r, auditSetTeamsChannel, channel.Section, strings.Join(channel.Classes, ","))
+	s.writeJSON(w, r, http.StatusOK, channel)
+}
+
+func (s *Server) deleteTeamsChannelHandler(w http.ResponseWriter, r *http.Request) {
+	section := router.Param(r, "section")
+	rowsAffected, err := s.repo.DeleteTeamsChannel(section)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "No such section", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditDeleteTeamsChannel, section, "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Separates the tenant from the rest of session IDs and API keys
+const tenantSeparator = "."
+
+// Longest accepted tenant name, in bytes
+const maxTenantLength = 32
+
+/*
+A Tenant is one institution of a multi-tenant deployment. Each has a Server of
+its own, with its own database, identity providers and admin key, so that
+nothing one serves can come from the data of another.
+*/
+type Tenant struct {
+	// Like "amrita", lower case letters, digits and dashes
+	Name string
+	// Host names the tenant is served on, like "cora.amrita.edu"
+	Hosts   []string
+	Handler http.Handler
+}
+
+// ValidTenantName tells whether name can be the Name of a Tenant
+func ValidTenantName(name string) bool {
+	if name == "" || len(name) > maxTenantLength {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Marks the requests TenantHandler sent to their tenant by the host they were made to
+type tenantHostContextKey struct{}
+
+// splitTenant splits a session ID or API key into the tenant it was issued by, if any, and the rest
+func splitTenant(token string) (string, string) {
+	at := strings.Index(token, tenantSeparator)
+	if at < 0 || !ValidTenantName(token[:at]) {
+		return "", token
+	}
+	return token[:at], token[at+len(tenantSeparator):]
+}
+
+/*
+TenantHandler sends every request to the handler of its tenant: the one
+serving the host it was made to or, on hosts shared by every tenant like the
+one of the mobile app, the one named at the start of its session ID (in the
+Authorization header or the session cookie) or API key. Logging in on a shared
+host takes a tenant parameter instead. Requests for no tenant get a 404.
+*/
+func TenantHandler(tenants []Tenant) (http.Handler, error) {
+	byName := make(map[string]http.Handler)
+	byHost := make(map[string]http.Handler)
+	for _, tenant := range tenants {
+		if !ValidTenantName(tenant.Name) {
+			return nil, fmt.Errorf("api: invalid tenant name %q", tenant.Name)
+		}
+		if _, ok := byName[tenant.Name]; ok {
+			return nil, fmt.Errorf("api: duplicate tenant %s", tenant.Name)
+		}
+		byName[tenant.Name] = tenant.Handler
+		for _, host := range tenant.Hosts {
+			host = strings.ToLower(host)
+			if _, ok := byHost[host]; ok {
+				return nil, fmt.Errorf("api: host %s is served by two tenants", host)
+			}
+			byHost[host] = tenant.Handler
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if handler, ok := byHost[strings.ToLower(host)]; ok {
+			handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantHostContextKey{}, true)))
+			return
+		}
+		token := r.Header.Get(apiKeyHeader)
+		if token == "" {
+			token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if token == "" {
+			if cookie, err := r.Cookie(sessionCookie); err == nil {
+				token = cookie.Value
+			}
+		}
+		name, _ := splitTenant(token)
+		if name == "" {
+			name = r.URL.Query().Get("tenant")
+		}
+		if handler, ok := byName[name]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "Unknown tenant", http.StatusNotFound)
+	}), nil
+}
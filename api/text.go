@@ -0,0 +1,109 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/i18n"
+)
+
+// wantsText tells whether r asked for plain text rather than JSON, with
+// format=txt or an Accept header preferring text/plain to application/json. Only
+// those two are weighed, so a browser's */* still gets JSON. On a bad format it
+// has already written the error response and returns ok = false.
+func wantsText(w http.ResponseWriter, r *http.Request) (text bool, ok bool) {
+	switch r.URL.Query().Get("format") {
+	case "txt":
+		return true, true
+	case "json":
+		return false, true
+	case "":
+	default:
+		http.Error(w, "Invalid format value", http.StatusBadRequest)
+		return false, false
+	}
+	w.Header().Add("Vary", "Accept")
+	weights := make(map[string]float64)
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				q = 0
+			}
+		}
+		weights[mediaType] = q
+	}
+	return weights["text/plain"] > weights["application/json"], true
+}
+
+// textDay names date in lang for a line of plain text, like "Tuesday 13 June 2023"
+func textDay(date time.Time, lang string) string {
+	name := calendar.DayName(date.Weekday(), lang)
+	if lang == i18n.English {
+		return name + " " + date.Format("2 January 2006")
+	}
+	return name + " " + date.Format("2/1/2006")
+}
+
+/*
+writeTimetableText answers the periods of class on date, subjects as
+/db/daytimetable has them, as a line of plain text each in the language of r,
+for screen readers and SMS gateways:
+
+	A104, Tuesday 13 June 2023
+	Period 1, 08:00 to 08:50: free.
+	Period 2, 08:50 to 09:40: moved to B201.
+	Period 3, 09:50 to 10:40: 19CSE311.
+*/
+func (s *Server) writeTimetableText(w http.ResponseWriter, r *http.Request, class string, date time.Time, subjects []string) {
+	slotTimes, err := s.repo.GetSlotTimes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	clocks := make(map[int][2]string)
+	for _, slotTime := range slotTimes {
+		clocks[slotTime.ID] = [2]string{slotTime.Start, slotTime.End}
+	}
+	lang := s.requestLanguage(r)
+	lines := []string{class + ", " + textDay(date, lang)}
+	slots := s.repo.GetAllSlot()
+	for idx, subject := range subjects {
+		if idx >= len(slots) {
+			break
+		}
+		var what i18n.Message
+		switch {
+		case subject == "FREE":
+			what = i18n.M("free")
+		case subject == cancelledSubject:
+			what = i18n.M("cancelled")
+		case strings.HasPrefix(subject, movedSubjectPrefix):
+			what = i18n.M("moved to %s", strings.TrimPrefix(subject, movedSubjectPrefix))
+		default:
+			what = i18n.M("%s", subject)
+		}
+		period := i18n.M("Period %d", slots[idx])
+		if clock, ok := clocks[slots[idx]]; ok {
+			period = i18n.M("Period %d, %s to %s", slots[idx], clock[0], clock[1])
+		}
+		lines = append(lines, i18n.Sprintf(lang, "%s: %s.", period, what))
+	}
+	if len(lines) == 1 {
+		lines = append(lines, i18n.Sprintf(lang, "No classes."))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if lang != i18n.English {
+		w.Header().Set("Content-Language", lang)
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
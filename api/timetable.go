@@ -0,0 +1,454 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// The class, date and slot naming a booking, or the lookups of them
+type slotParams struct {
+	Class string    `param:"class,required"`
+	Date  time.Time `param:"date,required"`
+	Slot  int       `param:"slot,required"`
+}
+
+type bookingParams struct {
+	slotParams
+	Faculty   string   `param:"faculty"`
+	Subject   string   `param:"subject"`
+	Equipment []string `param:"equipment"`
+}
+
+type multiBookingParams struct {
+	Class     string    `param:"class,required"`
+	Date      time.Time `param:"date,required"`
+	StartSlot int       `param:"startSlot,required"`
+	EndSlot   int       `param:"endSlot,required"`
+	Faculty   string    `param:"faculty"`
+	Subject   string    `param:"subject"`
+	Equipment []string  `param:"equipment"`
+}
+
+type insertResponse struct {
+	Inserted bool `json:"inserted"`
+	// Set when the slot is booked by someone else, who may be waited for
+	Waitlist bool `json:"waitlist,omitempty"`
+}
+
+/*
+knownClass answers 404 for a class the timetable does not have. A known class
+goes on, whatever is free or booked in it and even on a day it has no periods.
+*/
+func (s *Server) knownClass(w http.ResponseWriter, class string) bool {
+	exists, err := s.repo.ClassExists(class)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !exists {
+		http.Error(w, "No such class", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+func (s *Server) freeClassHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Date time.Time `param:"date,required"`
+		Slot int       `param:"slot,required"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	date, slot := query.Date, query.Slot
+	classroom, ok := s.onlyFavorites(w, r, s.tracedRepo(r).GetFreeClass(slot, date))
+	if ok {
+		classroom, ok = s.onCampus(w, r, classroom)
+	}
+	if ok {
+		classroom, ok = s.byProximity(w, r, classroom, date, slot)
+	}
+	if !ok {
+		return
+	}
+	s.repo.RecordSearch(db.SearchEvent{Kind: db.SearchFreeClass, StartSlot: slot, Date: date})
+	s.recordView(r, db.RecentView{Kind: db.SearchFreeClass, StartSlot: slot, Date: date})
+	s.freeResponse(w, r, date)
+	s.writeJSON(w, r, http.StatusOK, classroom)
+}
+
+func (s *Server) freeSlotHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class string    `param:"class,required"`
+		Date  time.Time `param:"date,required"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	class, date := query.Class, query.Date
+	if !s.knownClass(w, class) {
+		return
+	}
+	var slot []int = s.tracedRepo(r).GetFreeSlot(class, date)
+	s.repo.RecordSearch(db.SearchEvent{Kind: db.SearchFreeSlot, Class: class, Date: date})
+	s.recordView(r, db.RecentView{Kind: db.SearchFreeSlot, Class: class, Date: date})
+	s.publicResponse(w, r, freeKeys(date)...)
+	s.writeJSON(w, r, http.StatusOK, slot)
+}
+
+func (s *Server) multiFreeSlotHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		StartSlot int       `param:"startSlot,required"`
+		EndSlot   int       `param:"endSlot,required"`
+		Date      time.Time `param:"date,required"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	startSlot, endSlot, date := query.StartSlot, query.EndSlot, query.Date
+	slot, ok := s.onlyFavorites(w, r, s.tracedRepo(r).MultiFreeSlot(startSlot, endSlot, date))
+	if ok {
+		slot, ok = s.onCampus(w, r, slot)
+	}
+	if !ok {
+		return
+	}
+	s.repo.RecordSearch(db.SearchEvent{Kind: db.SearchMultiFreeSlot, StartSlot: startSlot, EndSlot: endSlot, Date: date})
+	s.recordView(r, db.RecentView{Kind: db.SearchMultiFreeSlot, StartSlot: startSlot, EndSlot: endSlot, Date: date})
+	s.freeResponse(w, r, date)
+	s.writeJSON(w, r, http.StatusOK, slot)
+}
+
+func (s *Server) dayTimetableHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Class string    `param:"class,required"`
+		Date  time.Time `param:"date,required"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	class, date := query.Class, query.Date
+	text, ok := wantsText(w, r)
+	if !ok || !s.knownClass(w, class) {
+		return
+	}
+	var subject []string = s.tracedRepo(r).GetTimetableByDay(class, date)
+	subject = s.applyOverrides(subject, class, date)
+	s.recordView(r, db.RecentView{Kind: db.ViewTimetable, Class: class, Date: date})
+	if text {
+		s.writeTimetableText(w, r, class, date, subject)
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, subject)
+}
+
+func (s *Server) getAllSlotHandler(w http.ResponseWriter, r *http.Request) {
+	s.publicResponse(w, r, surrogateSlots)
+	s.writeCachedJSON(w, r, "slots", listCacheTTL, func() ([]byte, error) {
+		return marshalJSON(s.repo.GetAllSlot())
+	})
+}
+
+// Only the list of every campus is cached, the campus ones are cut from it
+func (s *Server) getAllClassHandler(w http.ResponseWriter, r *http.Request) {
+	campus, ok := s.requestCampus(w, r)
+	if !ok {
+		return
+	}
+	if campus == "" {
+		s.writeCachedJSON(w, r, "classes", listCacheTTL, func() ([]byte, error) {
+			return marshalJSON(s.repo.GetAllClass())
+		})
+		return
+	}
+	classes, ok := s.onCampus(w, r, s.repo.GetAllClass())
+	if !ok {
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, classes)
+}
+
+func (s *Server) getAllSubjectHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeCachedJSON(w, r, "subjects", listCacheTTL, func() ([]byte, error) {
+		return marshalJSON(s.repo.GetAllSubject())
+	})
+}
+
+func (s *Server) getBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Faculty string `param:"faculty"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	var subject []db.BookingRecord = s.repo.GetBooking(query.Faculty)
+	s.writeJSON(w, r, http.StatusOK, subject)
+}
+
+func (s *Server) bookingHandler(w http.ResponseWriter, r *http.Request) {
+	var response insertResponse
+	var query bookingParams
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	class, date, slot, faculty, subject := query.Class, query.Date, query.Slot, query.Faculty, query.Subject
+	if !s.knownClass(w, class) {
+		return
+	}
+	equipment := uniqueStrings(query.Equipment)
+	if !s.checkEquipment(w, equipment, date, []int{slot}) {
+		return
+	}
+	rowsAffected, err := s.repo.Booking(class, date, slot, faculty, subject)
+	if err != nil {
+		s.logger.Println(err)
+		response.Inserted = false
+	} else {
+		if rowsAffected > 0 {
+			response.Inserted = s.holdEquipment(class, date, []int{slot}, equipment)
+		} else {
+			response.Inserted = false
+		}
+	}
+	if !response.Inserted {
+		_, response.Waitlist, _ = s.booking(class, date, slot)
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+	return
+}
+
+func (s *Server) multiBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var response insertResponse
+	var query multiBookingParams
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	class, date, startSlot, endSlot, faculty, subject := query.Class, query.Date, query.StartSlot, query.EndSlot, query.Faculty, query.Subject
+	if !s.knownClass(w, class) {
+		return
+	}
+	var slots []int
+	for _, slot := range s.repo.GetAllSlot() {
+		if slot >= startSlot && slot <= endSlot {
+			slots = append(slots, slot)
+		}
+	}
+	equipment := uniqueStrings(query.Equipment)
+	if !s.checkEquipment(w, equipment, date, slots) {
+		return
+	}
+	rowsAffected, err := s.repo.MultiBooking(class, date, startSlot, endSlot, faculty, subject)
+	if err != nil {
+		s.logger.Println(err)
+		response.Inserted = false
+	} else {
+		if rowsAffected == int64(endSlot-startSlot+1) {
+			response.Inserted = s.holdEquipment(class, date, slots, equipment)
+		} else {
+			response.Inserted = false
+		}
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+	return
+}
+
+func (s *Server) cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var query slotParams
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	class, date, slot := query.Class, query.Date, query.Slot
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	err := s.cancelBookingVersion(class, date, slot, version)
+	if err == db.ErrStaleVersion {
+		s.writeBookingChanged(w, r, class, date, slot)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	http.Redirect(w, r, "/profile.html", http.StatusFound)
+	return
+}
+
+// bookingByKeyHandler answers with a booking and its version as the ETag, to make conditional changes with
+func (s *Server) bookingByKeyHandler(w http.ResponseWriter, r *http.Request) {
+	class := router.Param(r, "class")
+	date, err := calendar.ParseDate(router.Param(r, "date"), s.config.Location)
+	if err != nil {
+		http.Error(w, "Invalid date value", http.StatusBadRequest)
+		return
+	}
+	slot, err := strconv.Atoi(router.Param(r, "slot"))
+	if err != nil {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	booking, found, err := s.booking(class, date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "No such booking", http.StatusNotFound)
+		return
+	}
+	s.writeBooking(w, r, booking)
+}
+
+/*
+updateBookingHandler hands a booking to another faculty member or subject. With
+an If-Match header it only does so while the booking is at that version, and
+answers 412 with the booking as it is now otherwise.
+*/
+func (s *Server) updateBookingHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		slotParams
+		Faculty string `param:"faculty,required"`
+		Subject string `param:"subject,required"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	class, date, slot, faculty, subject := query.Class, query.Date, query.Slot, query.Faculty, query.Subject
+	version, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	err := s.repo.UpdateBooking(db.BookingRecord{Class: class, Date: date, Slot: slot, Faculty: faculty, Subject: subject, Version: version})
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such booking", http.StatusNotFound)
+		return
+	}
+	if err == db.ErrStaleVersion {
+		s.writeBookingChanged(w, r, class, date, slot)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	booking, found, err := s.booking(class, date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "No such booking", http.StatusNotFound)
+		return
+	}
+	s.writeBooking(w, r, booking)
+}
+
+func (s *Server) writeBooking(w http.ResponseWriter, r *http.Request, booking db.BookingRecord) {
+	w.Header().Set("ETag", etag(booking.Version))
+	s.writeJSON(w, r, http.StatusOK, booking)
+}
+
+// The most dates a free rooms search may span
+const maxFreeRoomDates = 31
+
+// The rooms free in the slot running at a moment
+type freeNowResponse struct {
+	Slot    int      `json:"slot"`
+	Until   string   `json:"until"`
+	Classes []string `json:"classes"`
+}
+
+/*
+freeNowHandler answers with the rooms free for the rest of the slot running
+now, or at the RFC 3339 time of the at parameter. There is no slot between the
+periods, before the first or after the last.
+*/
+func (s *Server) freeNowHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		At time.Time `param:"at,instant"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	now := query.At
+	if now.IsZero() {
+		now = time.Now()
+	}
+	now = now.In(s.config.Location)
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	slotTimes, err := s.repo.GetSlotTimes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var response freeNowResponse
+	for _, slotTime := range slotTimes {
+		if !now.Before(s.clockTime(date, slotTime.Start)) && now.Before(s.clockTime(date, slotTime.End)) {
+			response.Slot = slotTime.ID
+			response.Until = slotTime.End
+		}
+	}
+	if response.Slot == 0 {
+		http.Error(w, "No such slot", http.StatusNotFound)
+		return
+	}
+	classroom, ok := s.onlyFavorites(w, r, s.tracedRepo(r).GetFreeClass(response.Slot, date))
+	if ok {
+		classroom, ok = s.onCampus(w, r, classroom)
+	}
+	if ok {
+		classroom, ok = s.byProximity(w, r, classroom, date, response.Slot)
+	}
+	if !ok {
+		return
+	}
+	response.Classes = classroom
+	if response.Classes == nil {
+		response.Classes = []string{}
+	}
+	s.writeJSON(w, r, http.StatusOK, response)
+}
+
+/*
+freeRoomsHandler answers with the rooms free in all the comma separated slots
+on every date parameter, for a group looking for a room it can keep across a
+week or a series of days.
+*/
+func (s *Server) freeRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Slots []int       `param:"slots,required"`
+		Dates []time.Time `param:"date,required"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	var slots []int
+	for _, slot := range query.Slots {
+		if !containsInt(slots, slot) {
+			slots = append(slots, slot)
+		}
+	}
+	dates := query.Dates
+	if len(dates) > maxFreeRoomDates {
+		http.Error(w, "Too many dates, at most "+strconv.Itoa(maxFreeRoomDates), http.StatusBadRequest)
+		return
+	}
+	classroom, ok := s.onlyFavorites(w, r, s.tracedRepo(r).GetFreeRooms(slots, dates))
+	if ok {
+		classroom, ok = s.onCampus(w, r, classroom)
+	}
+	if ok {
+		// Walks start from where the user is at the first slot of the first date
+		classroom, ok = s.byProximity(w, r, classroom, dates[0], slots[0])
+	}
+	if !ok {
+		return
+	}
+	s.writeJSON(w, r, http.StatusOK, classroom)
+}
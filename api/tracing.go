@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/tracing"
+)
+
+// statusRecorder keeps the status of a response for its span
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+/*
+traceRequest records a server span for each request, named after its route so
+that requests to /db/booking/1 and /db/booking/2 group together, continuing the
+trace of the caller when it sent a traceparent.
+*/
+func (s *Server) traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tracing.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pattern := router.Pattern(r)
+		ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), r.Method+" "+pattern, tracing.Server)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", pattern)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", recorder.status)
+		if recorder.status >= 500 {
+			span.SetError(fmt.Errorf("%s", http.StatusText(recorder.status)))
+		}
+	})
+}
+
+/*
+tracedRepository records a client span for each of the queries behind the
+free class and timetable searches, the slow ones worth following end to end.
+The rest of the queries pass straight through.
+*/
+type tracedRepository struct {
+	db.Repository
+	ctx context.Context
+}
+
+// tracedRepo returns the repository to query for r, one recording spans when tracing is on
+func (s *Server) tracedRepo(r *http.Request) db.Repository {
+	if !tracing.Enabled() {
+		return s.repo
+	}
+	return tracedRepository{Repository: s.repo, ctx: r.Context()}
+}
+
+func (t tracedRepository) start(method string) *tracing.Span {
+	_, span := tracing.Start(t.ctx, "db."+method, tracing.Client)
+	span.SetAttribute("db.system", "mysql")
+	span.SetAttribute("db.operation", method)
+	return span
+}
+
+func (t tracedRepository) GetFreeClass(slot int, date time.Time) []string {
+	span := t.start("GetFreeClass")
+	defer span.End()
+	classes := t.Repository.GetFreeClass(slot, date)
+	span.SetAttribute("db.rows", len(classes))
+	return classes
+}
+
+func (t tracedRepository) GetFreeSlot(class string, date time.Time) []int {
+	span := t.start("GetFreeSlot")
+	defer span.End()
+	slots := t.Repository.GetFreeSlot(class, date)
+	span.SetAttribute("db.rows", len(slots))
+	return slots
+}
+
+func (t tracedRepository) MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
+	span := t.start("MultiFreeSlot")
+	defer span.End()
+	classes := t.Repository.MultiFreeSlot(startSlot, endSlot, date)
+	span.SetAttribute("db.rows", len(classes))
+	return classes
+}
+
+func (t tracedRepository) GetFreeRooms(slots []int, dates []time.Time) []string {
+	span := t.start("GetFreeRooms")
+	defer span.End()
+	classes := t.Repository.GetFreeRooms(slots, dates)
+	span.SetAttribute("db.rows", len(classes))
+	return classes
+}
+
+func (t tracedRepository) GetTimetableByDay(class string, date time.Time) []string {
+	span := t.start("GetTimetableByDay")
+	defer span.End()
+	subjects := t.Repository.GetTimetableByDay(class, date)
+	span.SetAttribute("db.rows", len(subjects))
+	return subjects
+}
+
+func (t tracedRepository) GetFavorites(mail string) ([]db.Favorite, error) {
+	span := t.start("GetFavorites")
+	defer span.End()
+	favorites, err := t.Repository.GetFavorites(mail)
+	span.SetError(err)
+	span.SetAttribute("db.rows", len(favorites))
+	return favorites, err
+}
+
+func (t tracedRepository) GetClassrooms() ([]db.Classroom, error) {
+	span := t.start("GetClassrooms")
+	defer span.End()
+	classrooms, err := t.Repository.GetClassrooms()
+	span.SetError(err)
+	span.SetAttribute("db.rows", len(classrooms))
+	return classrooms, err
+}
@@ -0,0 +1,317 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/redact"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+const (
+	defaultTrafficLog = time.Hour
+	maxTrafficLog     = 24 * time.Hour
+	// Bodies are logged up to this many bytes
+	maxLoggedBody = 4 << 10
+)
+
+const redacted = redact.Redacted
+
+/*
+Fields whose values are never logged, matched without regard to case: those
+named like one of sensitiveFields, and those whose name contains one of
+sensitiveFieldParts.
+*/
+var (
+	sensitiveFields     = []string{"code", "state", "key", "mail", "email", "faculty", "name", "givenname", "surname", "displayname", "phone", "ip", "device"}
+	sensitiveFieldParts = []string{"token", "secret", "password", "verifier", "authorization", "cookie", "apikey", "challenge"}
+)
+
+// trafficLog holds the route patterns whose traffic is logged and until when
+type trafficLog struct {
+	mu     sync.Mutex
+	routes map[string]time.Time
+}
+
+func newTrafficLog() *trafficLog {
+	return &trafficLog{routes: make(map[string]time.Time)}
+}
+
+func (t *trafficLog) enabled(pattern string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.routes[pattern]
+	if ok && !now.Before(until) {
+		delete(t.routes, pattern)
+		return false
+	}
+	return ok
+}
+
+func (t *trafficLog) enable(pattern string, until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes[pattern] = until
+}
+
+// disable stops logging pattern and tells whether it was logged
+func (t *trafficLog) disable(pattern string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.routes[pattern]
+	delete(t.routes, pattern)
+	return ok && now.Before(until)
+}
+
+func (t *trafficLog) list(now time.Time) map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	routes := make(map[string]time.Time)
+	for pattern, until := range t.routes {
+		if now.Before(until) {
+			routes[pattern] = until
+		}
+	}
+	return routes
+}
+
+func sensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, field := range sensitiveFields {
+		if name == field {
+			return true
+		}
+	}
+	for _, part := range sensitiveFieldParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+sensitiveValue catches what slips past the field names: mail addresses, API
+keys, bearer tokens and anything long enough and random looking to be a
+session ID or another token, see package redact.
+*/
+func sensitiveValue(value string) bool {
+	return redact.Sensitive(value)
+}
+
+func redactValues(values url.Values) string {
+	redactedValues := make(url.Values, len(values))
+	for name, vals := range values {
+		for _, value := range vals {
+			if sensitiveField(name) || sensitiveValue(value) {
+				value = redacted
+			}
+			redactedValues.Add(name, value)
+		}
+	}
+	return redactedValues.Encode()
+}
+
+// redactJSON replaces the sensitive values anywhere in v, a decoded JSON document
+func redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, value := range v {
+			if sensitiveField(name) {
+				v[name] = redacted
+				continue
+			}
+			v[name] = redactJSON(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactJSON(value)
+		}
+	case string:
+		if sensitiveValue(v) {
+			return redacted
+		}
+	}
+	return v
+}
+
+func redactPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if unescaped, err := url.PathUnescape(part); err == nil && sensitiveValue(unescaped) {
+			parts[i] = redacted
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+/*
+redactBody describes a request or response body for the log: JSON and forms
+with their sensitive values redacted, anything else only by its type and size.
+A body cut off at maxLoggedBody can't be parsed, so only its size is logged.
+*/
+func redactBody(contentType string, body []byte, truncated bool) string {
+	if len(body) == 0 {
+		return "-"
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !truncated {
+		switch mediaType {
+		case "application/json":
+			var v interface{}
+			if json.Unmarshal(body, &v) == nil {
+				redactedJSON, err := json.Marshal(redactJSON(v))
+				if err == nil {
+					return string(redactedJSON)
+				}
+			}
+		case "application/x-www-form-urlencoded":
+			values, err := url.ParseQuery(string(body))
+			if err == nil {
+				return redactValues(values)
+			}
+		}
+	}
+	more := ""
+	if truncated {
+		more = "+"
+	}
+	return "<" + mediaType + ", " + strconv.Itoa(len(body)) + more + " bytes>"
+}
+
+// trafficRecorder keeps the status and the start of the body of a response for the log
+type trafficRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *trafficRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *trafficRecorder) Write(p []byte) (int, error) {
+	room := maxLoggedBody - w.body.Len()
+	if len(p) > room {
+		w.body.Write(p[:room])
+		w.truncated = true
+	} else {
+		w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *trafficRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+/*
+logTraffic logs the requests to the routes turned on with PUT /admin/logging,
+with their parameters and body and the response: what a client reporting an
+issue actually sent and got. Tokens, secrets and personal data are redacted
+before anything is written.
+*/
+func (s *Server) logTraffic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern := router.Pattern(r)
+		if !s.traffic.enabled(pattern, time.Now()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var requestBody []byte
+		requestTruncated := false
+		if r.Body != nil {
+			requestBody, _ = ioutil.ReadAll(io.LimitReader(r.Body, maxLoggedBody+1))
+			r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(requestBody), r.Body))
+			if len(requestBody) > maxLoggedBody {
+				requestBody = requestBody[:maxLoggedBody]
+				requestTruncated = true
+			}
+		}
+		recorder := &trafficRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+		s.logger.Printf("DEBUG %s %s (%s) query=%s body=%s -> %d in %s: %s",
+			r.Method, redactPath(r.URL.Path), pattern, redactValues(r.URL.Query()),
+			redactBody(r.Header.Get("Content-Type"), requestBody, requestTruncated),
+			recorder.status, time.Since(start).Round(time.Millisecond),
+			redactBody(recorder.Header().Get("Content-Type"), recorder.body.Bytes(), recorder.truncated))
+	})
+}
+
+type loggedRouteResponse struct {
+	Route string    `json:"route"`
+	Until time.Time `json:"until"`
+}
+
+// Lists the routes whose traffic is logged, the one logged the longest first
+func (s *Server) loggedRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	routes := []loggedRouteResponse{}
+	for pattern, until := range s.traffic.list(time.Now()) {
+		routes = append(routes, loggedRouteResponse{Route: pattern, Until: until})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Until.After(routes[j].Until) })
+	s.writeJSON(w, r, http.StatusOK, routes)
+}
+
+/*
+Starts logging the traffic of the route given by its pattern in the route
+parameter, like /db/booking/{id}, for duration (1h by default, at most 24h).
+*/
+func (s *Server) logRouteHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Route    string         `param:"route,required"`
+		Duration *time.Duration `param:"duration"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	pattern := query.Route
+	if !strings.HasPrefix(pattern, "/") {
+		http.Error(w, "Invalid route value", http.StatusBadRequest)
+		return
+	}
+	duration := defaultTrafficLog
+	if query.Duration != nil {
+		duration = *query.Duration
+	}
+	if duration <= 0 || duration > maxTrafficLog {
+		http.Error(w, "Invalid duration value", http.StatusBadRequest)
+		return
+	}
+	until := time.Now().Add(duration)
+	s.traffic.enable(pattern, until)
+	s.audit(r, auditStartTrafficLog, pattern, "until "+until.Format(time.RFC3339))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stops logging the traffic of the route in the route parameter before its time is up
+func (s *Server) unlogRouteHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Route string `param:"route"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	pattern := query.Route
+	if !s.traffic.disable(pattern, time.Now()) {
+		http.Error(w, "No such logged route", http.StatusNotFound)
+		return
+	}
+	s.audit(r, auditStopTrafficLog, pattern, "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+/*
+trash keeps what an admin request deleted so it can be restored until it is
+purged. The deletion has already happened, so a failure is only logged.
+*/
+func (s *Server) trash(r *http.Request, kind string, target string, deleted interface{}) {
+	data, err := json.Marshal(deleted)
+	if err != nil {
+		s.logger.Println("Error marshalling data", err)
+		return
+	}
+	_, err = s.repo.AddTrash(db.TrashItem{
+		Kind:      kind,
+		Target:    target,
+		Data:      data,
+		DeletedBy: adminActor(r),
+		DeletedAt: time.Now(),
+	})
+	if err != nil {
+		s.logger.Println("Error keeping a deleted item", err)
+	}
+}
+
+// Lists what admins deleted, the latest first; kind narrows it to timetable, booking or announcement
+func (s *Server) trashHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		Kind string `param:"kind"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	kind := query.Kind
+	if kind != "" && kind != db.TrashTimetable && kind != db.TrashBooking && kind != db.TrashAnnouncement {
+		http.Error(w, "Invalid kind value", http.StatusBadRequest)
+		return
+	}
+	items, err := s.repo.GetTrash(kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if items == nil {
+		items = []db.TrashItem{}
+	}
+	s.writeJSON(w, r, http.StatusOK, items)
+}
+
+// trashItem reads the item in the path. On failure it has already written the error response.
+func (s *Server) trashItem(w http.ResponseWriter, r *http.Request) (db.TrashItem, bool) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return db.TrashItem{}, false
+	}
+	item, err := s.repo.GetTrashItem(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No such item", http.StatusNotFound)
+		return db.TrashItem{}, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return db.TrashItem{}, false
+	}
+	return item, true
+}
+
+/*
+restoreTrashHandler puts a deleted item back and responds with it. A period
+that has been set again or a slot that has been booked again is a 409; a
+restored announcement gets a new ID.
+*/
+func (s *Server) restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.trashItem(w, r)
+	if !ok {
+		return
+	}
+	var restored interface{}
+	switch item.Kind {
+	case db.TrashTimetable:
+		restored, ok = s.restoreTimetable(w, item)
+	case db.TrashBooking:
+		restored, ok = s.restoreBooking(w, item)
+	case db.TrashAnnouncement:
+		restored, ok = s.restoreAnnouncement(w, item)
+	default:
+		http.Error(w, "Cannot restore a "+item.Kind, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		return
+	}
+	_, err := s.repo.DeleteTrash(item.ID)
+	if err != nil {
+		s.logger.Println("Error removing a restored item", err)
+	}
+	s.audit(r, auditRestoreTrash, item.Kind+"/"+item.Target, "")
+	s.writeJSON(w, r, http.StatusOK, restored)
+}
+
+// The restore functions have written the error response when they fail
+func (s *Server) restoreTimetable(w http.ResponseWriter, item db.TrashItem) (interface{}, bool) {
+	var entry db.StaticEntry
+	err := json.Unmarshal(item.Data, &entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	entries, err := s.repo.GetStatic(db.TimetableFilter{Class: entry.Class, Day: entry.Day, Slot: entry.Slot})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if len(entries) > 0 {
+		http.Error(w, "The period has been set again", http.StatusConflict)
+		return nil, false
+	}
+	if !s.checkSpan(w, entry) {
+		return nil, false
+	}
+	// Versions start over with the new row
+	entry.Version = 0
+	err = s.repo.SetStatic(entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	s.timetableChanged()
+	entry.Version = 1
+	return entry, true
+}
+
+func (s *Server) restoreBooking(w http.ResponseWriter, item db.TrashItem) (interface{}, bool) {
+	var booking db.BookingRecord
+	err := json.Unmarshal(item.Data, &booking)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Class: booking.Class, StartDate: booking.Date, EndDate: booking.Date})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	for _, other := range bookings {
+		if other.Slot == booking.Slot {
+			http.Error(w, "The slot has been booked again", http.StatusConflict)
+			return nil, false
+		}
+	}
+	rowsAffected, err := s.repo.Booking(booking.Class, booking.Date, booking.Slot, booking.Faculty, booking.Subject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if rowsAffected == 0 {
+		http.Error(w, "The slot is no longer free", http.StatusConflict)
+		return nil, false
+	}
+	return booking, true
+}
+
+func (s *Server) restoreAnnouncement(w http.ResponseWriter, item db.TrashItem) (interface{}, bool) {
+	var announcement db.Announcement
+	err := json.Unmarshal(item.Data, &announcement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	announcement.ID, err = s.repo.CreateAnnouncement(announcement)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return announcement, true
+}
+
+// Deletes an item for good before its retention period is over
+func (s *Server) purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.trashItem(w, r)
+	if !ok {
+		return
+	}
+	_, err := s.repo.DeleteTrash(item.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.audit(r, auditPurgeTrash, item.Kind+"/"+item.Target, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeTrash deletes for good what was deleted longer than the retention period before now
+func (s *Server) PurgeTrash(now time.Time) int64 {
+	purged, err := s.repo.PurgeTrash(now.Add(-s.config.TrashRetention))
+	if err != nil {
+		s.logger.Println("Error purging the trash", err)
+	}
+	return purged
+}
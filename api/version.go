@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/*
+Periods, announcements, exams and bookings carry a version that goes up with
+every change, sent as their ETag. An edit with an If-Match header only goes
+through when nobody changed the thing since the client read it; otherwise the
+client gets what is stored now, to merge its changes into and try again: a 409
+for the admin's edits, and the 412 of RFC 9110 for bookings.
+*/
+
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch reads the version in the If-Match header, 0 when there is none. On failure it has already written the error response.
+func ifMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || version < 1 {
+		http.Error(w, "Invalid If-Match value", http.StatusBadRequest)
+		return 0, false
+	}
+	return version, true
+}
+
+// writeStale refuses an edit based on an older version with the current state and its ETag
+func (s *Server) writeStale(w http.ResponseWriter, r *http.Request, current interface{}, version int) {
+	s.writeCurrent(w, r, http.StatusConflict, current, version)
+}
+
+// writePreconditionFailed is writeStale for a request whose If-Match no longer matches
+func (s *Server) writePreconditionFailed(w http.ResponseWriter, r *http.Request, current interface{}, version int) {
+	s.writeCurrent(w, r, http.StatusPreconditionFailed, current, version)
+}
+
+func (s *Server) writeCurrent(w http.ResponseWriter, r *http.Request, status int, current interface{}, version int) {
+	w.Header().Set("ETag", etag(version))
+	s.writeJSON(w, r, status, current)
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/i18n"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+)
+
+// Longest accepted subject of a waitlist entry, in bytes
+const maxWaitlistSubjectLength = 64
+
+// booking returns the booking of class in slot on date, if there is one
+func (s *Server) booking(class string, date time.Time, slot int) (db.BookingRecord, bool, error) {
+	bookings, err := s.repo.GetBookings(db.BookingFilter{Class: class, StartDate: date, EndDate: date})
+	if err != nil {
+		return db.BookingRecord{}, false, err
+	}
+	for _, booking := range bookings {
+		if booking.Slot == slot {
+			return booking, true, nil
+		}
+	}
+	return db.BookingRecord{}, false, nil
+}
+
+/*
+cancelBooking cancels the booking of class in slot on date and hands the slot
+to the first one waiting for it.
+*/
+func (s *Server) cancelBooking(class string, date time.Time, slot int) error {
+	err := s.repo.CancelBooking(class, date, slot)
+	if err != nil {
+		return err
+	}
+	s.promoteWaitlist(class, date, slot)
+	return nil
+}
+
+/*
+cancelBookingVersion is cancelBooking only while the booking is at version,
+any version when it is 0. It fails with db.ErrStaleVersion otherwise.
+*/
+func (s *Server) cancelBookingVersion(class string, date time.Time, slot int, version int) error {
+	if version == 0 {
+		return s.cancelBooking(class, date, slot)
+	}
+	err := s.repo.CancelBookingVersion(class, date, slot, version)
+	if err != nil {
+		return err
+	}
+	s.promoteWaitlist(class, date, slot)
+	return nil
+}
+
+/*
+writeBookingChanged answers a conditional write of a booking that changed
+since, with the booking as it is now, or no body when it is gone.
+*/
+func (s *Server) writeBookingChanged(w http.ResponseWriter, r *http.Request, class string, date time.Time, slot int) {
+	current, found, err := s.booking(class, date, slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Booking no longer exists", http.StatusPreconditionFailed)
+		return
+	}
+	s.writePreconditionFailed(w, r, current, current.Version)
+}
+
+/*
+promoteWaitlist books the freed slot for the oldest waitlist entry and tells
+its faculty member. When the slot cannot be booked, because it is blocked or
+was taken again, everyone keeps waiting.
+*/
+func (s *Server) promoteWaitlist(class string, date time.Time, slot int) {
+	entries, err := s.repo.GetWaitlist(db.WaitlistFilter{Class: class, Date: date, Slot: slot})
+	if err != nil {
+		s.logger.Println("Error reading the waitlist", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	entry := entries[0]
+	rowsAffected, err := s.repo.Booking(class, date, slot, entry.Faculty, entry.Subject)
+	if err != nil {
+		s.logger.Println("Error booking for the waitlist", err)
+		return
+	}
+	if rowsAffected == 0 {
+		return
+	}
+	_, err = s.repo.LeaveWaitlist(entry.ID)
+	if err != nil {
+		s.logger.Println("Error removing a waitlist entry", err)
+	}
+	s.notifyUser(entry.Faculty, notify.KindWaitlist, i18n.M("Booked %s on %s", class, date.Format(calendar.DateLayout)),
+		i18n.M("%s on %s, slot %d was freed and is now booked for you.", class, date.Format(calendar.DateLayout), slot))
+}
+
+/*
+joinWaitlistHandler puts the user in line for a slot of a room that someone
+has booked. subject is what the booking will be for.
+*/
+func (s *Server) joinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		slotParams
+		Subject string `param:"subject"`
+	}
+	if !s.decodeParams(w, r, &query) {
+		return
+	}
+	entry := db.WaitlistEntry{
+		Class:     query.Class,
+		Date:      query.Date,
+		Slot:      query.Slot,
+		Faculty:   currentSession(r).Mail,
+		Subject:   query.Subject,
+		CreatedAt: time.Now(),
+	}
+	if !containsString(s.repo.GetAllClass(), entry.Class) {
+		http.Error(w, "Invalid class value", http.StatusBadRequest)
+		return
+	}
+	if entry.Date.Before(calendar.Today(s.config.Location)) {
+		http.Error(w, "Invalid date value", http.StatusBadRequest)
+		return
+	}
+	if !containsInt(s.repo.GetAllSlot(), entry.Slot) {
+		http.Error(w, "Invalid slot value", http.StatusBadRequest)
+		return
+	}
+	if len(entry.Subject) > maxWaitlistSubjectLength {
+		http.Error(w, "Invalid subject value", http.StatusBadRequest)
+		return
+	}
+	booking, booked, err := s.booking(entry.Class, entry.Date, entry.Slot)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !booked {
+		http.Error(w, "The slot is not booked", http.StatusConflict)
+		return
+	}
+	if strings.EqualFold(booking.Faculty, entry.Faculty) {
+		http.Error(w, "You already hold the booking", http.StatusConflict)
+		return
+	}
+	waiting, err := s.repo.GetWaitlist(db.WaitlistFilter{Class: entry.Class, Date: entry.Date, Slot: entry.Slot, Faculty: entry.Faculty})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(waiting) > 0 {
+		http.Error(w, "Already on the waitlist", http.StatusConflict)
+		return
+	}
+	entry.ID, err = s.repo.JoinWaitlist(entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, r, http.StatusCreated, entry)
+}
+
+// Lists the slots the user is waiting for, from today on
+func (s *Server) myWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := s.repo.GetWaitlist(db.WaitlistFilter{Faculty: currentSession(r).Mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	today := calendar.Today(s.config.Location)
+	upcoming := []db.WaitlistEntry{}
+	for _, entry := range entries {
+		if !entry.Date.Before(today) {
+			upcoming = append(upcoming, entry)
+		}
+	}
+	s.writeJSON(w, r, http.StatusOK, upcoming)
+}
+
+// Takes the user off a waitlist
+func (s *Server) leaveWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.Param(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id value", http.StatusBadRequest)
+		return
+	}
+	entries, err := s.repo.GetWaitlist(db.WaitlistFilter{Faculty: currentSession(r).Mail})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, entry := range entries {
+		if entry.ID != id {
+			continue
+		}
+		_, err = s.repo.LeaveWaitlist(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, "No such waitlist entry", http.StatusNotFound)
+}
@@ -0,0 +1,213 @@
+/*
+Package apitest runs the whole API in a test: the real router and handlers on
+top of an in-memory database and a fake identity provider. It is exported so
+that forks adding their own handlers can test them the same way, by
+registering them on Harness.Router.
+
+	h := apitest.New(t)
+	h.Repo.AddStatic("A104", "TUE", 1, "FREE")
+	session := h.Login(auth.Identity{Mail: "user@cb.amrita.edu"})
+	resp, body := h.Do("GET", "/me/sessions", apitest.Bearer(session))
+*/
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/api"
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/cache"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/router"
+	"github.com/deebakkarthi/coraserver/storage"
+)
+
+// Sent in X-Admin-Key by the AdminKey option
+const AdminKeyValue = "apitest-admin-key"
+
+// A PKCE verifier that passes auth.ValidCodeVerifier
+const codeVerifier = "apitest-code-verifier-0123456789abcdefghijklmnopqrstuvwxyz"
+
+type Harness struct {
+	Repo     *db.Memory
+	Provider *Provider
+	// Every message the API sent
+	Notifier *notify.Memory
+	Server   *api.Server
+	// Routes of Server; handlers registered here are served too
+	Router *router.Router
+	// Base URL of the running API
+	URL string
+
+	t      testing.TB
+	mu     sync.Mutex
+	logins int
+	logs   logBuffer
+}
+
+// logBuffer keeps what the server logs, from whichever goroutine
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Logs returns everything the server logged so far
+func (h *Harness) Logs() string {
+	h.logs.mu.Lock()
+	defer h.logs.mu.Unlock()
+	return h.logs.buf.String()
+}
+
+/*
+New starts the API with an empty Memory repository. configure may change the
+api.Config before the server is made. Everything is shut down when the test
+ends.
+*/
+func New(t testing.TB, configure ...func(*api.Config)) *Harness {
+	h := &Harness{t: t, Repo: db.NewMemory(), Notifier: &notify.Memory{}}
+	h.Provider = NewProvider(t, "fake")
+	config := api.Config{
+		Providers:          map[string]auth.Provider{h.Provider.Name(): h.Provider},
+		DefaultProvider:    h.Provider,
+		MobileRedirectURLs: map[string][]string{},
+		Settings:           api.Settings{AdminKey: AdminKeyValue},
+		Notifier:           h.Notifier,
+		StudentMailDomain:  "cb.students.amrita.edu",
+		Storage:            &storage.Memory{},
+		Backups:            &storage.Memory{},
+		MaxUploadBytes:     1 << 10,
+	}
+	for _, fn := range configure {
+		fn(&config)
+	}
+	logger := log.New(&h.logs, "", 0)
+	h.Server = api.NewServer(h.Repo, cache.NewMemory(), config, logger)
+	h.Router = h.Server.Routes()
+	go h.Server.RunTexts()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		h.Server.StopTexts(ctx)
+	})
+	ts := httptest.NewServer(h.Server.CORS(h.Router))
+	t.Cleanup(ts.Close)
+	h.URL = ts.URL
+	return h
+}
+
+// Option changes a request made by Do
+type Option func(*http.Request)
+
+// Bearer authenticates the request with a session from Login
+func Bearer(sessionID string) Option {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+sessionID)
+	}
+}
+
+// AdminKey authenticates the request as an admin
+func AdminKey() Option {
+	return Header("X-Admin-Key", AdminKeyValue)
+}
+
+func Header(name string, value string) Option {
+	return func(r *http.Request) {
+		r.Header.Set(name, value)
+	}
+}
+
+// Body sends body as the request body, of the given content type
+func Body(contentType string, body string) Option {
+	return func(r *http.Request) {
+		r.Body = ioutil.NopCloser(strings.NewReader(body))
+		r.ContentLength = int64(len(body))
+		r.Header.Set("Content-Type", contentType)
+	}
+}
+
+func JSONBody(body string) Option {
+	return Body("application/json", body)
+}
+
+/*
+Do sends a request to path (which may carry a query string) and returns the
+response along with its body, already read and closed. Redirects are not
+followed.
+*/
+func (h *Harness) Do(method string, path string, options ...Option) (*http.Response, []byte) {
+	h.t.Helper()
+	req, err := http.NewRequest(method, h.URL+path, nil)
+	if err != nil {
+		h.t.Fatalf("apitest: %v", err)
+	}
+	for _, option := range options {
+		option(req)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		h.t.Fatalf("apitest: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Fatalf("apitest: reading %s %s: %v", method, path, err)
+	}
+	return resp, body
+}
+
+// DoJSON is Do for endpoints answering 200 with JSON, which is decoded into v
+func (h *Harness) DoJSON(method string, path string, v interface{}, options ...Option) {
+	h.t.Helper()
+	resp, body := h.Do(method, path, options...)
+	if resp.StatusCode != http.StatusOK {
+		h.t.Fatalf("apitest: %s %s = %d %s", method, path, resp.StatusCode, body)
+	}
+	err := json.Unmarshal(body, v)
+	if err != nil {
+		h.t.Fatalf("apitest: decoding %s %s: %v", method, path, err)
+	}
+}
+
+/*
+Login logs identity in through /oauth/exchange, the way the mobile app does
+with its own PKCE verifier, and returns the session ID.
+*/
+func (h *Harness) Login(identity auth.Identity) string {
+	h.t.Helper()
+	h.mu.Lock()
+	h.logins++
+	code := "code-" + strconv.Itoa(h.logins)
+	h.mu.Unlock()
+	h.Provider.AddUser(code, identity)
+
+	query := url.Values{"code": {code}, "code_verifier": {codeVerifier}}
+	var response struct {
+		Session struct {
+			ID string `json:"id"`
+		} `json:"session"`
+	}
+	h.DoJSON("GET", "/oauth/exchange?"+query.Encode(), &response)
+	return response.Session.ID
+}
@@ -0,0 +1,146 @@
+package apitest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/deebakkarthi/coraserver/auth"
+	"golang.org/x/oauth2"
+)
+
+/*
+Provider is an identity provider with its own token endpoint. An authorization
+code registered with AddUser is exchanged for an access token equal to the
+code, and that token resolves to the identity. Unknown codes are rejected with
+invalid_grant, unknown tokens with auth.ErrNotMember.
+*/
+type Provider struct {
+	name   string
+	config *oauth2.Config
+
+	mu         sync.Mutex
+	identities map[string]auth.Identity
+	// code_verifier sent with each exchanged code
+	verifiers map[string]string
+	revoked   []string
+	members   []auth.GroupMember
+}
+
+var (
+	_ auth.Revoker = (*Provider)(nil)
+	_ auth.Groups  = (*Provider)(nil)
+)
+
+func NewProvider(t testing.TB, name string) *Provider {
+	p := &Provider{
+		name:       name,
+		identities: make(map[string]auth.Identity),
+		verifiers:  make(map[string]string),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(p.token))
+	t.Cleanup(ts.Close)
+	p.config = &oauth2.Config{
+		ClientID:     "apitest",
+		ClientSecret: "apitest-secret",
+		RedirectURL:  "http://localhost/oauth/exchange",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   ts.URL + "/authorize",
+			TokenURL:  ts.URL + "/token",
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+	}
+	return p
+}
+
+// AddUser makes code log in as identity
+func (p *Provider) AddUser(code string, identity auth.Identity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.identities[code] = identity
+}
+
+// Verifier returns the PKCE verifier the server sent along with code
+func (p *Provider) Verifier(code string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.verifiers[code]
+}
+
+// Revoked lists the refresh tokens revoked so far
+func (p *Provider) Revoked() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.revoked...)
+}
+
+// SetGroupMembers makes SyncGroups list members; until it is called the provider maps no groups
+func (p *Provider) SetGroupMembers(members []auth.GroupMember) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.members = append([]auth.GroupMember{}, members...)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+	p.mu.Lock()
+	_, ok := p.identities[code]
+	if ok {
+		p.verifiers[code] = r.FormValue("code_verifier")
+	}
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  code,
+		"refresh_token": "refresh-" + code,
+		"token_type":    "Bearer",
+		"expires_in":    3600,
+	})
+}
+
+func (p *Provider) Name() string {
+	return p.name
+}
+
+func (p *Provider) OAuth2() *oauth2.Config {
+	return p.config
+}
+
+func (p *Provider) AuthCodeOptions() []oauth2.AuthCodeOption {
+	return nil
+}
+
+func (p *Provider) Identity(ctx context.Context, token *oauth2.Token) (auth.Identity, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	identity, ok := p.identities[token.AccessToken]
+	if !ok {
+		return auth.Identity{}, auth.ErrNotMember
+	}
+	return identity, nil
+}
+
+func (p *Provider) Revoke(ctx context.Context, refreshToken string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.revoked = append(p.revoked, refreshToken)
+	return nil
+}
+
+func (p *Provider) SyncGroups(ctx context.Context, page func(members []auth.GroupMember) error) error {
+	p.mu.Lock()
+	members := p.members
+	p.mu.Unlock()
+	if members == nil {
+		return auth.ErrNoGroups
+	}
+	return page(members)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Returned by a Challenger when the answer was wrong, as opposed to the check itself failing
+var ErrChallengeFailed = errors.New("auth: challenge failed")
+
+/*
+Challenger checks that a client is a person before it may try to log in again
+after failing a few times, typically with a CAPTCHA. answer is what the client
+sent back, ip where it came from.
+*/
+type Challenger interface {
+	Verify(ctx context.Context, answer string, ip string) error
+}
+
+/*
+Captcha is a Challenger for the CAPTCHA services that share the siteverify
+protocol: reCAPTCHA, hCaptcha and Cloudflare Turnstile. VerifyURL is the
+service's siteverify endpoint.
+*/
+type Captcha struct {
+	VerifyURL string
+	Secret    string
+}
+
+func (c Captcha) Verify(ctx context.Context, answer string, ip string) error {
+	form := url.Values{"secret": {c.Secret}, "response": {answer}, "remoteip": {ip}}
+	req, err := http.NewRequest("POST", c.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{URL: c.VerifyURL, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return err
+	}
+	if !result.Success {
+		return ErrChallengeFailed
+	}
+	return nil
+}
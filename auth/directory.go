@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/deebakkarthi/coraserver/graph"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Returned by SyncDirectory when the provider was not configured to sync its directory
+var ErrNoDirectory = errors.New("auth: directory sync is not enabled")
+
+// A user as a directory sync sees them; Removed ones were deleted or disabled in the directory
+type DirectoryUser struct {
+	ID                string
+	DisplayName       string
+	GivenName         string
+	Surname           string
+	Mail              string
+	UserPrincipalName string
+	JobTitle          string
+	Removed           bool
+}
+
+/*
+Directory is implemented by the providers that can list every user of the
+institution. SyncDirectory hands the users changed since deltaLink to page,
+a page at a time, or every user when deltaLink is "", and returns the link to
+pass next time. Stopping at an error loses nothing: the next sync starts from
+the same deltaLink again.
+*/
+type Directory interface {
+	SyncDirectory(ctx context.Context, deltaLink string, page func(users []DirectoryUser) error) (string, error)
+}
+
+// The properties of a user asked for by a directory sync
+const directorySelect = "users/delta?$select=id,displayName,givenName,surname,mail,userPrincipalName,jobTitle,accountEnabled"
+
+type graphDeltaPage struct {
+	Value []struct {
+		graphMe
+		AccountEnabled *bool           `json:"accountEnabled"`
+		Removed        json.RawMessage `json:"@removed"`
+	} `json:"value"`
+	NextLink  string `json:"@odata.nextLink"`
+	DeltaLink string `json:"@odata.deltaLink"`
+}
+
+/*
+SyncDirectory runs a delta query of the tenant's users on Graph when
+ProviderConfig.DirectorySync is set. It logs in as the application itself,
+which needs the User.Read.All application permission. Graph forgets delta
+links after a while; an expired one starts a full sync.
+*/
+func (m *Microsoft) SyncDirectory(ctx context.Context, deltaLink string, page func(users []DirectoryUser) error) (string, error) {
+	if !m.directorySync {
+		return "", ErrNoDirectory
+	}
+	appToken, err := m.appConfig().Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	link := directorySelect
+	if deltaLink != "" {
+		link = deltaLink
+	}
+	for {
+		body, err := m.graph.Get(ctx, appToken.AccessToken, strings.TrimPrefix(link, m.graph.BaseURL))
+		var statusErr *graph.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusGone && link != directorySelect {
+			link = directorySelect
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		var delta graphDeltaPage
+		err = json.Unmarshal(body, &delta)
+		if err != nil {
+			return "", err
+		}
+		users := make([]DirectoryUser, 0, len(delta.Value))
+		for _, user := range delta.Value {
+			users = append(users, DirectoryUser{
+				ID:                user.ID,
+				DisplayName:       user.DisplayName,
+				GivenName:         user.GivenName,
+				Surname:           user.Surname,
+				Mail:              user.Mail,
+				UserPrincipalName: user.UserPrincipalName,
+				JobTitle:          user.JobTitle,
+				Removed:           user.Removed != nil || (user.AccountEnabled != nil && !*user.AccountEnabled),
+			})
+		}
+		err = page(users)
+		if err != nil {
+			return "", err
+		}
+		if delta.NextLink == "" {
+			return delta.DeltaLink, nil
+		}
+		link = delta.NextLink
+	}
+}
+
+// appConfig gets tokens for the application itself rather than a user
+func (m *Microsoft) appConfig() *clientcredentials.Config {
+	return &clientcredentials.Config{
+		ClientID:     m.config.ClientID,
+		ClientSecret: m.config.ClientSecret,
+		TokenURL:     m.config.Endpoint.TokenURL,
+		Scopes:       []string{"https://graph.microsoft.com/.default"},
+	}
+}
+
+/*
+AppTokenSource logs in as the application itself on Graph, for what it does
+on its own account, like posting to Teams channels.
+*/
+func (m *Microsoft) AppTokenSource(ctx context.Context) oauth2.TokenSource {
+	return m.appConfig().TokenSource(ctx)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+var googleEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+	TokenURL: "https://oauth2.googleapis.com/token",
+}
+
+const googleUserinfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+
+/*
+Google logs users in with their Google Workspace account. Only accounts of
+hostedDomain are accepted, which Google reports in the "hd" claim.
+*/
+type Google struct {
+	name         string
+	config       *oauth2.Config
+	hostedDomain string
+}
+
+func NewGoogle(cfg ProviderConfig) *Google {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &Google{
+		name: cfg.Name,
+		config: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+			Endpoint:     googleEndpoint,
+		},
+		hostedDomain: cfg.HostedDomain,
+	}
+}
+
+func (g *Google) Name() string {
+	return g.name
+}
+
+func (g *Google) OAuth2() *oauth2.Config {
+	return g.config
+}
+
+func (g *Google) AuthCodeOptions() []oauth2.AuthCodeOption {
+	options := []oauth2.AuthCodeOption{oauth2.AccessTypeOnline, oauth2.SetAuthURLParam("prompt", "select_account")}
+	if g.hostedDomain != "" {
+		// Only a hint for the account chooser, Identity does the real check
+		options = append(options, oauth2.SetAuthURLParam("hd", g.hostedDomain))
+	}
+	return options
+}
+
+func (g *Google) Identity(ctx context.Context, token *oauth2.Token) (Identity, error) {
+	var info userInfo
+	err := getJSON(ctx, googleUserinfoURL, token.AccessToken, &info)
+	if err != nil {
+		return Identity{}, err
+	}
+	if !info.EmailVerified || g.hostedDomain == "" || !strings.EqualFold(info.HostedDomain, g.hostedDomain) {
+		return Identity{}, ErrNotMember
+	}
+	return info.identity(strings.ToLower(info.HostedDomain)), nil
+}
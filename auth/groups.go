@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Roles a GroupMapping gives the members of its group
+const (
+	RoleStudent = "student"
+	RoleStaff   = "staff"
+)
+
+// Returned by SyncGroups when the provider maps no groups
+var ErrNoGroups = errors.New("auth: no groups are mapped")
+
+/*
+A GroupMapping puts the members of the Azure AD group Group, by its object ID,
+in the class section Section with the role Role. Members of groups nested in
+it count too. Either of Section and Role may be empty to only give the other.
+*/
+type GroupMapping struct {
+	Group   string `json:"group"`
+	Section string `json:"section"`
+	Role    string `json:"role"`
+}
+
+// Validate checks that the mapping names a group and gives its members something known
+func (g GroupMapping) Validate() error {
+	if g.Group == "" {
+		return errors.New("a group mapping needs a group")
+	}
+	if g.Section == "" && g.Role == "" {
+		return fmt.Errorf("group %s maps to neither a section nor a role", g.Group)
+	}
+	if g.Role != "" && g.Role != RoleStudent && g.Role != RoleStaff {
+		return fmt.Errorf("group %s maps to the unknown role %q", g.Group, g.Role)
+	}
+	return nil
+}
+
+// A user of a mapped group, with the section and role the mapping gives them
+type GroupMember struct {
+	ID                string
+	Mail              string
+	UserPrincipalName string
+	Section           string
+	Role              string
+}
+
+/*
+Groups is implemented by the providers that can list the members of the
+groups mapped in ProviderConfig.Groups. SyncGroups hands them to page, a page
+of one group at a time, every group in the order mapped. A user in several
+groups is handed once for each.
+*/
+type Groups interface {
+	SyncGroups(ctx context.Context, page func(members []GroupMember) error) error
+}
+
+// The properties of a member asked for by a group sync
+const groupMembersSelect = "/transitiveMembers?$select=id,mail,userPrincipalName&$top=999"
+
+type graphMembersPage struct {
+	Value []struct {
+		Type              string `json:"@odata.type"`
+		ID                string `json:"id"`
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+	} `json:"value"`
+	NextLink string `json:"@odata.nextLink"`
+}
+
+/*
+SyncGroups lists the members of the mapped groups on Graph, logged in as the
+application itself, which needs the GroupMember.Read.All application
+permission. Devices and groups among the members are left out.
+*/
+func (m *Microsoft) SyncGroups(ctx context.Context, page func(members []GroupMember) error) error {
+	if len(m.groups) == 0 {
+		return ErrNoGroups
+	}
+	appToken, err := m.appConfig().Token(ctx)
+	if err != nil {
+		return err
+	}
+	for _, mapping := range m.groups {
+		link := "groups/" + url.PathEscape(mapping.Group) + groupMembersSelect
+		for link != "" {
+			body, err := m.graph.Get(ctx, appToken.AccessToken, strings.TrimPrefix(link, m.graph.BaseURL))
+			if err != nil {
+				return fmt.Errorf("group %s: %w", mapping.Group, err)
+			}
+			var members graphMembersPage
+			err = json.Unmarshal(body, &members)
+			if err != nil {
+				return err
+			}
+			users := make([]GroupMember, 0, len(members.Value))
+			for _, member := range members.Value {
+				if member.Type != "#microsoft.graph.user" {
+					continue
+				}
+				users = append(users, GroupMember{
+					ID:                member.ID,
+					Mail:              member.Mail,
+					UserPrincipalName: member.UserPrincipalName,
+					Section:           mapping.Section,
+					Role:              mapping.Role,
+				})
+			}
+			err = page(users)
+			if err != nil {
+				return err
+			}
+			link = members.NextLink
+		}
+	}
+	return nil
+}
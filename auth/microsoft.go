@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/graph"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+)
+
+/*
+Members of Amrita Vishwa Vidyapeetham. Used when a microsoft provider does not
+set organizationID.
+*/
+const DefaultOrganizationID = "00f9cda3-075e-44e5-aa0b-aba3add6539f"
+
+type graphMe struct {
+	OdataContext      string   `json:"@odata.context"`
+	BusinessPhones    []string `json:"businessPhones"`
+	DisplayName       string   `json:"displayName"`
+	GivenName         string   `json:"givenName"`
+	JobTitle          string   `json:"jobTitle"`
+	Mail              string   `json:"mail"`
+	MobilePhone       string   `json:"mobilePhone"`
+	OfficeLocation    string   `json:"officeLocation"`
+	PreferredLanguage string   `json:"preferredLanguage"`
+	Surname           string   `json:"surname"`
+	UserPrincipalName string   `json:"userPrincipalName"`
+	ID                string   `json:"id"`
+}
+
+type graphOrganization struct {
+	OdataContext string                   `json:"@odata.context"`
+	Value        []graphOrganizationValue `json:"value"`
+}
+
+type graphOrganizationValue struct {
+	ID                                        string   `json:"id"`
+	DeletedDateTime                           string   `json:"deletedDateTime"`
+	BusinessPhones                            []string `json:"businessPhones"`
+	City                                      string   `json:"city"`
+	Country                                   string   `json:"country"`
+	CountryLetterCode                         string   `json:"countryLetterCode"`
+	CreatedDateTime                           string   `json:"createdDateTime"`
+	DefaultUsageLocation                      string   `json:"defaultUsageLocation"`
+	DisplayName                               string   `json:"displayName"`
+	IsMultipleDataLocationsForServicesEnabled string   `json:"isMultipleDataLocationsForServicesEnabled"`
+	MarketingNotificationEmails               []string `json:"marketingNotificationEmails"`
+	OnPremisesLastSyncDateTime                string   `json:"onPremisesLastSyncDateTime"`
+	OnPremisesSyncEnabled                     string   `json:"onPremisesSyncEnabled"`
+	PartnerTenantType                         string   `json:"partnerTenantType"`
+	PostalCode                                string   `json:"postalCode"`
+	PreferredLanguage                         string   `json:"preferredLanguage"`
+	SecurityComplianceNotificationMails       []string `json:"securityComplianceNotificationMails"`
+	SecurityComplianceNotificationPhones      []string `json:"securityComplianceNotificationPhones"`
+	State                                     string   `json:"state"`
+	Street                                    string   `json:"street"`
+	TechnicalNotificationMails                []string `json:"technicalNotificationMails"`
+	TenantType                                string   `json:"tenantType"`
+	DirectorySizeQuota                        struct {
+		Used  int `json:"used"`
+		Total int `json:"total"`
+	} `json:"directorySizeQuota"`
+	OnPremisesSyncStatus []string `json:"onPremisesSyncStatus"`
+	AssignedPlans        []string `json:"assignedPlans"`
+	PrivacyProfile       struct {
+		ContactEmail string `json:"contactEmail"`
+		StatementURL string `json:"statementUrl"`
+	} `json:"privacyProfile"`
+	ProvisionedPlans []string `json:"provisionedPlans"`
+	VerifiedDomains  []struct {
+		Capabilities string `json:"capabilities"`
+		IsDefault    bool   `json:"isDefault"`
+		IsInitial    bool   `json:"isInitial"`
+		Name         string `json:"name"`
+		Type         string `json:"type"`
+	} `json:"verifiedDomains"`
+}
+
+// Microsoft logs users in through Azure AD and looks them up on Microsoft Graph
+type Microsoft struct {
+	name           string
+	config         *oauth2.Config
+	organizationID string
+	graph          *graph.Client
+	profiles       *profileCache
+	directorySync  bool
+	groups         []GroupMapping
+}
+
+// How long a profile lookup done in the background may take
+const profileRefreshTimeout = 30 * time.Second
+
+func NewMicrosoft(cfg ProviderConfig, client *graph.Client) *Microsoft {
+	organizationID := cfg.OrganizationID
+	if organizationID == "" {
+		organizationID = DefaultOrganizationID
+	}
+	return &Microsoft{
+		name: cfg.Name,
+		config: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+			Endpoint:     microsoft.AzureADEndpoint(cfg.Tenant),
+		},
+		organizationID: organizationID,
+		graph:          client,
+		profiles:       newProfileCache(cfg.Name, ProfileTTL),
+		directorySync:  cfg.DirectorySync,
+		groups:         cfg.Groups,
+	}
+}
+
+// SetProfileStore keeps the profiles looked up on Graph in store too
+func (m *Microsoft) SetProfileStore(store ProfileStore) {
+	m.profiles.setStore(store)
+}
+
+func (m *Microsoft) Name() string {
+	return m.name
+}
+
+func (m *Microsoft) OAuth2() *oauth2.Config {
+	return m.config
+}
+
+func (m *Microsoft) AuthCodeOptions() []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{oauth2.AccessTypeOnline, oauth2.SetAuthURLParam("prompt", "select_account")}
+}
+
+/*
+Identity answers from the profile cache when it can. With the openid scope
+Azure AD sends an ID token naming the user and their tenant, which is all a
+login needs to be checked: a cached profile is then used as it is, and
+one older than ProfileTTL is looked up again on Graph in the background. Only
+users logging in for the first time, or without an ID token, wait for Graph.
+*/
+func (m *Microsoft) Identity(ctx context.Context, token *oauth2.Token) (Identity, error) {
+	var claims microsoftClaims
+	if !idTokenClaims(token, &claims) || claims.ObjectID == "" {
+		return m.lookup(ctx, token.AccessToken)
+	}
+	if claims.TenantID != m.organizationID {
+		return Identity{}, ErrNotMember
+	}
+	identity, stale, ok := m.profiles.get(claims.ObjectID)
+	if !ok {
+		identity, err := m.lookup(ctx, token.AccessToken)
+		if err == nil {
+			m.profiles.put(claims.ObjectID, identity)
+		}
+		return identity, err
+	}
+	if stale && m.profiles.startRefresh(claims.ObjectID) {
+		go m.refresh(claims.ObjectID, token.AccessToken)
+	}
+	return identity, nil
+}
+
+// refresh looks a cached profile up again; the login it was for has been answered already
+func (m *Microsoft) refresh(userID string, accessToken string) {
+	defer m.profiles.endRefresh(userID)
+	ctx, cancel := context.WithTimeout(context.Background(), profileRefreshTimeout)
+	defer cancel()
+	identity, err := m.lookup(ctx, accessToken)
+	if err != nil {
+		log.Println("Error refreshing the profile of", userID, err)
+		return
+	}
+	m.profiles.put(userID, identity)
+}
+
+// lookup asks Graph who the user is
+func (m *Microsoft) lookup(ctx context.Context, accessToken string) (Identity, error) {
+	var identity Identity
+	graphMeResponse, err := m.graph.Get(ctx, accessToken, "me")
+	if err != nil {
+		return identity, err
+	}
+	graphOrganizationResponse, err := m.graph.Get(ctx, accessToken, "organization")
+	if err != nil {
+		return identity, err
+	}
+	var profile graphMe
+	var organization graphOrganization
+	err = json.Unmarshal(graphMeResponse, &profile)
+	if err != nil {
+		return identity, err
+	}
+	err = json.Unmarshal(graphOrganizationResponse, &organization)
+	if err != nil {
+		return identity, err
+	}
+	if len(organization.Value) == 0 || organization.Value[0].ID != m.organizationID {
+		return identity, ErrNotMember
+	}
+	identity = Identity{
+		ID:                profile.ID,
+		DisplayName:       profile.DisplayName,
+		GivenName:         profile.GivenName,
+		Surname:           profile.Surname,
+		Mail:              profile.Mail,
+		UserPrincipalName: profile.UserPrincipalName,
+		JobTitle:          profile.JobTitle,
+		Organization: Organization{
+			ID:          organization.Value[0].ID,
+			DisplayName: organization.Value[0].DisplayName,
+		},
+	}
+	return identity, nil
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/graph"
+	"golang.org/x/oauth2"
+)
+
+type memoryProfiles struct {
+	mu       sync.Mutex
+	profiles map[string][]byte
+	fetched  map[string]time.Time
+}
+
+func (m *memoryProfiles) LoadProfile(provider string, userID string) ([]byte, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.profiles[provider+"/"+userID]
+	if !ok {
+		return nil, time.Time{}, errors.New("no profile")
+	}
+	return data, m.fetched[provider+"/"+userID], nil
+}
+
+func (m *memoryProfiles) SaveProfile(provider string, userID string, data []byte, fetchedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[provider+"/"+userID] = data
+	m.fetched[provider+"/"+userID] = fetchedAt
+	return nil
+}
+
+func loginToken(claims string) *oauth2.Token {
+	idToken := "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2ln"
+	return (&oauth2.Token{AccessToken: "token"}).WithExtra(map[string]interface{}{"id_token": idToken})
+}
+
+func TestMicrosoftProfileCache(t *testing.T) {
+	var calls int32
+	name := "Deebak"
+	var nameMu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path == "/organization" {
+			w.Write([]byte(`{"value": [{"id": "org", "displayName": "Amrita"}]}`))
+			return
+		}
+		nameMu.Lock()
+		defer nameMu.Unlock()
+		w.Write([]byte(`{"id": "u1", "givenName": "` + name + `", "mail": "d@example.edu"}`))
+	}))
+	defer ts.Close()
+	newMicrosoft := func(store ProfileStore) *Microsoft {
+		client := graph.NewClient()
+		client.BaseURL = ts.URL + "/"
+		m := NewMicrosoft(ProviderConfig{Name: "microsoft", OrganizationID: "org"}, client)
+		m.SetProfileStore(store)
+		return m
+	}
+	store := &memoryProfiles{profiles: make(map[string][]byte), fetched: make(map[string]time.Time)}
+	token := loginToken(`{"oid": "u1", "tid": "org"}`)
+
+	identity, err := newMicrosoft(store).Identity(context.Background(), token)
+	if err != nil || identity.GivenName != "Deebak" || calls != 2 {
+		t.Fatalf("first Identity() = %+v, %v after %d calls; want Deebak from Graph", identity, err, calls)
+	}
+
+	// A restart only has the store
+	m := newMicrosoft(store)
+	identity, err = m.Identity(context.Background(), token)
+	if err != nil || identity.GivenName != "Deebak" || identity.Organization.DisplayName != "Amrita" || calls != 2 {
+		t.Errorf("cached Identity() = %+v, %v after %d calls; want Deebak without Graph", identity, err, calls)
+	}
+
+	if _, err := m.Identity(context.Background(), loginToken(`{"oid": "u1", "tid": "other"}`)); err != ErrNotMember {
+		t.Errorf("Identity() of another tenant error = %v; want ErrNotMember", err)
+	}
+
+	// An old profile is answered with and looked up again behind the login
+	store.mu.Lock()
+	store.fetched["microsoft/u1"] = time.Now().Add(-2 * ProfileTTL)
+	store.mu.Unlock()
+	nameMu.Lock()
+	name = "Deebakkarthi"
+	nameMu.Unlock()
+	m = newMicrosoft(store)
+	identity, err = m.Identity(context.Background(), token)
+	if err != nil || identity.GivenName != "Deebak" {
+		t.Fatalf("stale Identity() = %+v, %v; want the cached Deebak", identity, err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		identity, stale, _ := m.profiles.get("u1")
+		if !stale && identity.GivenName == "Deebakkarthi" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the profile was not refreshed: %+v", identity)
+		}
+	}
+
+	before := atomic.LoadInt32(&calls)
+	if _, err := m.Identity(context.Background(), &oauth2.Token{AccessToken: "token"}); err != nil || atomic.LoadInt32(&calls) != before+2 {
+		t.Errorf("Identity() without an ID token = %v after %d calls; want Graph asked", err, atomic.LoadInt32(&calls)-before)
+	}
+}
+
+func TestMicrosoftSyncDirectory(t *testing.T) {
+	var ts *httptest.Server
+	var expired int32
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "app", "token_type": "Bearer", "expires_in": 3600}`))
+		case r.Header.Get("Authorization") != "Bearer app":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Query().Get("$deltatoken") == "old" && atomic.LoadInt32(&expired) == 1:
+			w.WriteHeader(http.StatusGone)
+		case r.URL.Query().Get("$deltatoken") != "":
+			w.Write([]byte(`{"value": [{"id": "u2", "@removed": {"reason": "deleted"}}],
+				"@odata.deltaLink": "` + ts.URL + `/users/delta?$deltatoken=new"}`))
+		case r.URL.Query().Get("$skiptoken") != "":
+			w.Write([]byte(`{"value": [{"id": "u2", "displayName": "Karthi", "accountEnabled": false}],
+				"@odata.deltaLink": "` + ts.URL + `/users/delta?$deltatoken=old"}`))
+		default:
+			w.Write([]byte(`{"value": [{"id": "u1", "displayName": "Deebak", "mail": "d@example.edu"}],
+				"@odata.nextLink": "` + ts.URL + `/users/delta?$skiptoken=2"}`))
+		}
+	}))
+	defer ts.Close()
+	client := graph.NewClient()
+	client.BaseURL = ts.URL + "/"
+	m := NewMicrosoft(ProviderConfig{Name: "microsoft", DirectorySync: true}, client)
+	m.config.Endpoint.TokenURL = ts.URL + "/token"
+
+	var users []DirectoryUser
+	collect := func(page []DirectoryUser) error {
+		users = append(users, page...)
+		return nil
+	}
+	deltaLink, err := m.SyncDirectory(context.Background(), "", collect)
+	if err != nil || len(users) != 2 || users[0].Mail != "d@example.edu" || users[0].Removed || !users[1].Removed {
+		t.Fatalf("full sync = %+v, %v; want Deebak and the disabled Karthi", users, err)
+	}
+	users = nil
+	if deltaLink, err = m.SyncDirectory(context.Background(), deltaLink, collect); err != nil || len(users) != 1 || !users[0].Removed {
+		t.Errorf("delta sync = %+v, %v; want Karthi removed", users, err)
+	}
+	if deltaLink != ts.URL+"/users/delta?$deltatoken=new" {
+		t.Errorf("delta link = %q", deltaLink)
+	}
+
+	// Graph no longer knows an old delta link, everyone is listed again
+	atomic.StoreInt32(&expired, 1)
+	users = nil
+	if _, err := m.SyncDirectory(context.Background(), ts.URL+"/users/delta?$deltatoken=old", collect); err != nil || len(users) != 2 {
+		t.Errorf("sync from an expired link = %+v, %v; want a full sync", users, err)
+	}
+
+	m = NewMicrosoft(ProviderConfig{Name: "microsoft"}, client)
+	if _, err := m.SyncDirectory(context.Background(), "", collect); err != ErrNoDirectory {
+		t.Errorf("SyncDirectory() without directorySync = %v; want ErrNoDirectory", err)
+	}
+}
+
+func TestMicrosoftSyncGroups(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token": "app", "token_type": "Bearer", "expires_in": 3600}`))
+		case r.Header.Get("Authorization") != "Bearer app":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/groups/g-cse-a/transitiveMembers" && r.URL.Query().Get("$skiptoken") == "":
+			w.Write([]byte(`{"value": [{"@odata.type": "#microsoft.graph.user", "id": "u1", "mail": "a@example.edu"},
+				{"@odata.type": "#microsoft.graph.group", "id": "g-nested"}],
+				"@odata.nextLink": "` + ts.URL + `/groups/g-cse-a/transitiveMembers?$skiptoken=2"}`))
+		case r.URL.Path == "/groups/g-cse-a/transitiveMembers":
+			w.Write([]byte(`{"value": [{"@odata.type": "#microsoft.graph.user", "id": "u2", "userPrincipalName": "b@example.edu"}]}`))
+		case r.URL.Path == "/groups/g-staff/transitiveMembers":
+			w.Write([]byte(`{"value": [{"@odata.type": "#microsoft.graph.user", "id": "u3", "mail": "c@example.edu"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	client := graph.NewClient()
+	client.BaseURL = ts.URL + "/"
+	m := NewMicrosoft(ProviderConfig{Name: "microsoft", Groups: []GroupMapping{
+		{Group: "g-cse-a", Section: "CSE-A", Role: RoleStudent},
+		{Group: "g-staff", Role: RoleStaff},
+	}}, client)
+	m.config.Endpoint.TokenURL = ts.URL + "/token"
+
+	var members []GroupMember
+	err := m.SyncGroups(context.Background(), func(page []GroupMember) error {
+		members = append(members, page...)
+		return nil
+	})
+	if err != nil || len(members) != 3 {
+		t.Fatalf("SyncGroups() = %+v, %v; want the two users of CSE-A and the staff member", members, err)
+	}
+	if members[1].UserPrincipalName != "b@example.edu" || members[1].Section != "CSE-A" || members[2].Role != RoleStaff || members[2].Section != "" {
+		t.Errorf("members = %+v", members)
+	}
+
+	m = NewMicrosoft(ProviderConfig{Name: "microsoft"}, client)
+	if err := m.SyncGroups(context.Background(), func([]GroupMember) error { return nil }); err != ErrNoGroups {
+		t.Errorf("SyncGroups() without groups = %v; want ErrNoGroups", err)
+	}
+	if _, err := NewProvider(context.Background(), ProviderConfig{Name: "microsoft", Type: "microsoft",
+		Groups: []GroupMapping{{Group: "g-cse-a", Role: "admin"}}}, client); err == nil {
+		t.Errorf("NewProvider accepted a group mapped to an unknown role")
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Standard claims returned by an OpenID Connect userinfo endpoint
+type userInfo struct {
+	Sub           string `json:"sub"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// Google Workspace only
+	HostedDomain string `json:"hd"`
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+}
+
+/*
+OIDC is any OpenID Connect provider that publishes a discovery document
+(Keycloak, Okta, Shibboleth with the OIDC plugin, ...). Membership of the
+institution is decided by the domain of the verified email address.
+*/
+type OIDC struct {
+	name           string
+	config         *oauth2.Config
+	userinfoURL    string
+	revocationURL  string
+	allowedDomains []string
+}
+
+func NewOIDC(ctx context.Context, cfg ProviderConfig) (*OIDC, error) {
+	var discovery oidcDiscovery
+	err := getJSON(ctx, strings.TrimSuffix(cfg.Issuer, "/")+"/.well-known/openid-configuration", "", &discovery)
+	if err != nil {
+		return nil, err
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDC{
+		name: cfg.Name,
+		config: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+		},
+		userinfoURL:    discovery.UserinfoEndpoint,
+		revocationURL:  discovery.RevocationEndpoint,
+		allowedDomains: cfg.AllowedDomains,
+	}, nil
+}
+
+func (o *OIDC) Name() string {
+	return o.name
+}
+
+func (o *OIDC) OAuth2() *oauth2.Config {
+	return o.config
+}
+
+func (o *OIDC) AuthCodeOptions() []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{oauth2.AccessTypeOnline}
+}
+
+func (o *OIDC) Identity(ctx context.Context, token *oauth2.Token) (Identity, error) {
+	var info userInfo
+	err := getJSON(ctx, o.userinfoURL, token.AccessToken, &info)
+	if err != nil {
+		return Identity{}, err
+	}
+	domain := mailDomain(info.Email)
+	if !info.EmailVerified || !domainAllowed(domain, o.allowedDomains) {
+		return Identity{}, ErrNotMember
+	}
+	return info.identity(domain), nil
+}
+
+func (info userInfo) identity(domain string) Identity {
+	return Identity{
+		ID:                info.Sub,
+		DisplayName:       info.Name,
+		GivenName:         info.GivenName,
+		Surname:           info.FamilyName,
+		Mail:              info.Email,
+		UserPrincipalName: info.Email,
+		Organization: Organization{
+			ID:          domain,
+			DisplayName: domain,
+		},
+	}
+}
+
+// An empty allow list lets every domain in
+func domainAllowed(domain string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, d := range allowed {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+	return false
+}
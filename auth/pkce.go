@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/deebakkarthi/coraserver/token"
+	"golang.org/x/oauth2"
+)
+
+// NewCodeVerifier returns a PKCE code verifier (RFC 7636): 32 random bytes, base64url encoded to 43 characters
+func NewCodeVerifier() (string, error) {
+	return token.URLSafe(32)
+}
+
+// ValidCodeVerifier checks the length and alphabet required by RFC 7636
+func ValidCodeVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ChallengeOptions adds the S256 code challenge for verifier to the authorization URL
+func ChallengeOptions(verifier string) []oauth2.AuthCodeOption {
+	sum := sha256.Sum256([]byte(verifier))
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+}
+
+// VerifierOption sends verifier along with the authorization code when exchanging it
+func VerifierOption(verifier string) oauth2.AuthCodeOption {
+	return oauth2.SetAuthURLParam("code_verifier", verifier)
+}
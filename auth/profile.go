@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// How long a cached profile is used as it is; an older one is still used, but looked up again in the background
+const ProfileTTL = 24 * time.Hour
+
+/*
+ProfileStore keeps the profiles of users across restarts, so a login can be
+answered without the provider even when its lookup is slow or down. data is
+opaque, LoadProfile returns an error when there is none.
+*/
+type ProfileStore interface {
+	LoadProfile(provider string, userID string) (data []byte, fetchedAt time.Time, err error)
+	SaveProfile(provider string, userID string, data []byte, fetchedAt time.Time) error
+}
+
+// ProfileCaching is implemented by the providers that can keep profiles in a ProfileStore
+type ProfileCaching interface {
+	SetProfileStore(store ProfileStore)
+}
+
+// What a ProfileStore keeps of an Identity
+type storedProfile struct {
+	Identity     Identity     `json:"identity"`
+	Organization Organization `json:"organization"`
+}
+
+type cachedProfile struct {
+	identity  Identity
+	fetchedAt time.Time
+}
+
+/*
+profileCache keeps the profiles of a provider in memory in front of its
+ProfileStore, and remembers which ones are being looked up again so a user
+logging in on several devices at once causes one lookup.
+*/
+type profileCache struct {
+	provider string
+	ttl      time.Duration
+
+	mu         sync.Mutex
+	store      ProfileStore
+	entries    map[string]cachedProfile
+	refreshing map[string]bool
+}
+
+func newProfileCache(provider string, ttl time.Duration) *profileCache {
+	return &profileCache{
+		provider:   provider,
+		ttl:        ttl,
+		entries:    make(map[string]cachedProfile),
+		refreshing: make(map[string]bool),
+	}
+}
+
+func (c *profileCache) setStore(store ProfileStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+// get returns the profile of userID from memory or the store and whether it is older than the TTL
+func (c *profileCache) get(userID string) (identity Identity, stale bool, ok bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[userID]
+	store := c.store
+	c.mu.Unlock()
+	if !ok && store != nil {
+		data, fetchedAt, err := store.LoadProfile(c.provider, userID)
+		var stored storedProfile
+		if err == nil && json.Unmarshal(data, &stored) == nil {
+			stored.Identity.Organization = stored.Organization
+			entry = cachedProfile{identity: stored.Identity, fetchedAt: fetchedAt}
+			ok = true
+			c.mu.Lock()
+			c.entries[userID] = entry
+			c.mu.Unlock()
+		}
+	}
+	if !ok {
+		return Identity{}, false, false
+	}
+	return entry.identity, time.Since(entry.fetchedAt) > c.ttl, true
+}
+
+// put caches a profile just looked up; failing to store it is only logged, the next login looks it up again
+func (c *profileCache) put(userID string, identity Identity) {
+	now := time.Now()
+	c.mu.Lock()
+	c.entries[userID] = cachedProfile{identity: identity, fetchedAt: now}
+	store := c.store
+	c.mu.Unlock()
+	if store == nil {
+		return
+	}
+	data, err := json.Marshal(storedProfile{Identity: identity, Organization: identity.Organization})
+	if err == nil {
+		err = store.SaveProfile(c.provider, userID, data, now)
+	}
+	if err != nil {
+		log.Println("Error saving the profile of", userID, err)
+	}
+}
+
+// startRefresh tells whether the caller should look userID up again, false when someone already is
+func (c *profileCache) startRefresh(userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[userID] {
+		return false
+	}
+	c.refreshing[userID] = true
+	return true
+}
+
+func (c *profileCache) endRefresh(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.refreshing, userID)
+}
+
+// The claims of an Azure AD ID token that say who the user is and which tenant they belong to
+type microsoftClaims struct {
+	ObjectID string `json:"oid"`
+	TenantID string `json:"tid"`
+}
+
+/*
+idTokenClaims reads the claims of the ID token that came with token, when the
+openid scope was asked for. The token came straight from the provider's token
+endpoint over TLS, which OpenID Connect accepts in place of checking its
+signature.
+*/
+func idTokenClaims(token *oauth2.Token, claims interface{}) bool {
+	idToken, _ := token.Extra("id_token").(string)
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(payload, claims) == nil
+}
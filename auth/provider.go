@@ -0,0 +1,168 @@
+/*
+Package auth hides the differences between the identity providers users can
+log in with. Every provider is an OAuth2 authorization code flow followed by a
+lookup of who the user is; the handlers only ever deal with the Provider
+interface and the Identity it returns.
+*/
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/graph"
+	"github.com/deebakkarthi/coraserver/tracing"
+	"golang.org/x/oauth2"
+)
+
+// Returned by Identity when the user authenticated fine but is not part of the institution
+var ErrNotMember = errors.New("auth: user is not a member of the institution")
+
+type Organization struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+}
+
+type Identity struct {
+	ID                string       `json:"id"`
+	DisplayName       string       `json:"displayName"`
+	GivenName         string       `json:"givenName"`
+	Surname           string       `json:"surname"`
+	Mail              string       `json:"mail"`
+	UserPrincipalName string       `json:"userPrincipalName"`
+	JobTitle          string       `json:"jobTitle"`
+	Organization      Organization `json:"-"`
+}
+
+type Provider interface {
+	// Name is the path segment used in /oauth/{provider}/...
+	Name() string
+	OAuth2() *oauth2.Config
+	// AuthCodeOptions are added to the login redirect
+	AuthCodeOptions() []oauth2.AuthCodeOption
+	// Identity looks the user up and checks that they belong to the institution
+	Identity(ctx context.Context, token *oauth2.Token) (Identity, error)
+}
+
+/*
+ProviderConfig is one entry of the "providers" list in config.json. Type picks
+the implementation: "microsoft", "google" or "oidc".
+*/
+type ProviderConfig struct {
+	Name         string   `json:"name"`
+	Type         string   `json:"type"`
+	ClientID     string   `json:"clientID"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectURL  string   `json:"redirectURL"`
+	Scopes       []string `json:"scopes"`
+	// Redirect URLs (e.g. custom app schemes) a mobile app may use when it
+	// runs the authorization request itself with its own PKCE verifier
+	MobileRedirectURLs []string `json:"mobileRedirectURLs"`
+	// microsoft
+	Tenant         string `json:"tenant"`
+	OrganizationID string `json:"organizationID"`
+	// Sync every user of the tenant into the user directory, see Directory
+	DirectorySync bool `json:"directorySync"`
+	// Sections and roles given to the members of groups of the tenant, see Groups
+	Groups []GroupMapping `json:"groups"`
+	// google
+	HostedDomain string `json:"hostedDomain"`
+	// oidc
+	Issuer         string   `json:"issuer"`
+	AllowedDomains []string `json:"allowedDomains"`
+}
+
+/*
+NewProvider builds the provider described by cfg. OIDC providers fetch their
+discovery document here. Microsoft providers call Graph with client, which is
+meant to be shared by all of them so that they retry, back off and are limited
+together.
+*/
+func NewProvider(ctx context.Context, cfg ProviderConfig, client *graph.Client) (Provider, error) {
+	switch cfg.Type {
+	case "microsoft":
+		for _, mapping := range cfg.Groups {
+			if err := mapping.Validate(); err != nil {
+				return nil, fmt.Errorf("auth: %s: %v", cfg.Name, err)
+			}
+		}
+		return NewMicrosoft(cfg, client), nil
+	case "google":
+		return NewGoogle(cfg), nil
+	case "oidc":
+		return NewOIDC(ctx, cfg)
+	}
+	return nil, fmt.Errorf("auth: unknown provider type %q for %q", cfg.Type, cfg.Name)
+}
+
+/*
+HTTPError is returned when a provider endpoint answered with a non-200
+status. Microsoft errors are *graph.StatusError instead.
+*/
+type HTTPError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("auth: %s answered %s", e.URL, e.Status)
+}
+
+/*
+Unavailable reports whether err means the provider could not be reached or
+failed on its side, so the handlers answer 502 rather than 403.
+*/
+func Unavailable(err error) bool {
+	if err == nil || errors.Is(err, ErrNotMember) {
+		return false
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	return graph.Unavailable(err)
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second, Transport: &tracing.Transport{}}
+
+// getJSON fetches url, optionally with a bearer token, and decodes the body into v
+func getJSON(ctx context.Context, url string, accessToken string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// mailDomain returns the lower cased part after the @
+func mailDomain(mail string) string {
+	idx := strings.LastIndex(mail, "@")
+	if idx < 0 {
+		return ""
+	}
+	return strings.ToLower(mail[idx+1:])
+}
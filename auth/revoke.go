@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+/*
+Revoker is implemented by providers that can revoke a refresh token. Azure AD
+has no endpoint to revoke a single token, so Microsoft does not implement it.
+*/
+type Revoker interface {
+	Revoke(ctx context.Context, refreshToken string) error
+}
+
+const googleRevocationURL = "https://oauth2.googleapis.com/revoke"
+
+func (g *Google) Revoke(ctx context.Context, refreshToken string) error {
+	return revoke(ctx, googleRevocationURL, refreshToken, "", "")
+}
+
+func (o *OIDC) Revoke(ctx context.Context, refreshToken string) error {
+	if o.revocationURL == "" {
+		return nil
+	}
+	return revoke(ctx, o.revocationURL, refreshToken, o.config.ClientID, o.config.ClientSecret)
+}
+
+// RFC 7009 token revocation
+func revoke(ctx context.Context, endpoint string, refreshToken string, clientID string, clientSecret string) error {
+	form := url.Values{}
+	form.Set("token", refreshToken)
+	form.Set("token_type_hint", "refresh_token")
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{URL: endpoint, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+/*
+Package cache keeps responses that rarely change, like the list of slots or
+classrooms, in memory for a while so every app start does not hit the
+database.
+*/
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// How often Set drops the expired entries nobody asked for again
+const sweepInterval = time.Minute
+
+// Memory is a map with per entry expiry, safe for concurrent use
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	swept   time.Time
+	// For tests
+	now func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]entry), now: time.Now}
+}
+
+// Get returns the value stored under key unless it has expired
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !m.now().Before(e.expiresAt) {
+		delete(m.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (m *Memory) Set(key string, value []byte, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if now.Sub(m.swept) >= sweepInterval {
+		m.swept = now
+		for k, e := range m.entries {
+			if !now.Before(e.expiresAt) {
+				delete(m.entries, k)
+			}
+		}
+	}
+	m.entries[key] = entry{value: value, expiresAt: now.Add(ttl)}
+}
+
+// Delete drops key, for when the data behind it has changed
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+}
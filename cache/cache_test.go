@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryExpiry(t *testing.T) {
+	now := time.Date(2023, 6, 13, 10, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	m.Set("slots", []byte("[1,2]"), time.Minute)
+	if value, ok := m.Get("slots"); !ok || string(value) != "[1,2]" {
+		t.Fatalf("Get(slots) = %q, %v; want \"[1,2]\", true", value, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok := m.Get("slots"); ok {
+		t.Errorf("Get(slots) after ttl = true; want false")
+	}
+	if _, ok := m.Get("missing"); ok {
+		t.Errorf("Get(missing) = true; want false")
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	now := time.Date(2023, 6, 13, 10, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	m.Set("idempotency:a", []byte("{}"), time.Minute)
+	m.Set("idempotency:b", []byte("{}"), time.Hour)
+	now = now.Add(2 * time.Minute)
+	m.Set("slots", []byte("[1,2]"), time.Minute)
+	if _, ok := m.entries["idempotency:a"]; ok {
+		t.Errorf("expired entry kept after a sweep")
+	}
+	if len(m.entries) != 2 {
+		t.Errorf("got %d entries; want the two live ones", len(m.entries))
+	}
+}
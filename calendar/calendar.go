@@ -0,0 +1,45 @@
+/*
+Package calendar turns the dates clients send into the dates the timetable
+works with. A date is a day of the institution's calendar, not an instant: it
+is carried as a time.Time at midnight UTC, which is what MySQL DATE columns
+read back as and what the driver writes out unchanged. "Today" and the date
+of a timestamp are taken in the institution's time zone, whatever the zone of
+the server is.
+*/
+package calendar
+
+import (
+	"errors"
+	"time"
+)
+
+// The layout of dates in the API, like "2023-06-13"
+const DateLayout = "2006-01-02"
+
+var ErrInvalidDate = errors.New("calendar: expected a date like 2006-01-02 or an RFC 3339 timestamp")
+
+// Date returns the date t falls on in loc
+func Date(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Today is the current date in loc
+func Today(loc *time.Location) time.Time {
+	return Date(time.Now(), loc)
+}
+
+/*
+ParseDate reads a date like "2023-06-13", or an RFC 3339 timestamp like
+"2023-06-13T09:30:00+05:30" which stands for its date in loc.
+*/
+func ParseDate(value string, loc *time.Location) (time.Time, error) {
+	if date, err := time.Parse(DateLayout, value); err == nil {
+		return date, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	return Date(t, loc), nil
+}
@@ -0,0 +1,28 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	cases := []struct {
+		value string
+		want  string
+	}{
+		{"2023-06-13", "2023-06-13"},
+		// 20:00 UTC is already the next day in India
+		{"2023-06-13T20:00:00Z", "2023-06-14"},
+		{"2023-06-14T01:00:00+05:30", "2023-06-14"},
+	}
+	for _, c := range cases {
+		date, err := ParseDate(c.value, kolkata)
+		if err != nil || date.Format(DateLayout) != c.want || date.Location() != time.UTC {
+			t.Errorf("ParseDate(%q) = %v, %v; want %s UTC", c.value, date, err, c.want)
+		}
+	}
+	if _, err := ParseDate("13-06-2023", kolkata); err != ErrInvalidDate {
+		t.Errorf("ParseDate of a bad date = %v; want ErrInvalidDate", err)
+	}
+}
@@ -0,0 +1,38 @@
+package calendar
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidDay = errors.New("calendar: expected a day like MON, Monday or an ISO weekday number 1-7")
+
+// The day codes of the static table, indexed by time.Weekday
+var dayCodes = [...]string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// DayCode is the code the timetable stores day under, like "MON"
+func DayCode(day time.Weekday) string {
+	return dayCodes[day]
+}
+
+/*
+ParseDay reads a day the way clients happen to send it: "mon", "MON",
+"Monday" or the ISO weekday number, 1 for Monday to 7 for Sunday.
+*/
+func ParseDay(value string) (time.Weekday, error) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 1 || n > 7 {
+			return 0, ErrInvalidDay
+		}
+		return time.Weekday(n % 7), nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(value, dayCodes[day]) || strings.EqualFold(value, day.String()) {
+			return day, nil
+		}
+	}
+	return 0, ErrInvalidDay
+}
@@ -0,0 +1,48 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDay(t *testing.T) {
+	cases := map[string]time.Weekday{
+		"MON":      time.Monday,
+		"mon":      time.Monday,
+		"Monday":   time.Monday,
+		" tue ":    time.Tuesday,
+		"1":        time.Monday,
+		"7":        time.Sunday,
+		"sATURDAY": time.Saturday,
+	}
+	for value, want := range cases {
+		day, err := ParseDay(value)
+		if err != nil || day != want {
+			t.Errorf("ParseDay(%q) = %v, %v; want %v", value, day, err, want)
+		}
+	}
+	for _, value := range []string{"", "0", "8", "mo", "Mondays"} {
+		if _, err := ParseDay(value); err != ErrInvalidDay {
+			t.Errorf("ParseDay(%q) = %v; want ErrInvalidDay", value, err)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":                          "en",
+		"fr-FR":                     "en",
+		"ta-IN,ta;q=0.9,en;q=0.8":   "ta",
+		"en;q=0.5, hi;q=0.9":        "hi",
+		"fr, ml-IN;q=0.7, en;q=0.3": "ml",
+		"ta;q=0":                    "en",
+	}
+	for header, want := range cases {
+		if lang := Language(header); lang != want {
+			t.Errorf("Language(%q) = %q; want %q", header, lang, want)
+		}
+	}
+	if name := DayName(time.Tuesday, "ta"); name != "செவ்வாய்" {
+		t.Errorf("DayName(Tuesday, ta) = %q", name)
+	}
+}
@@ -0,0 +1,42 @@
+package calendar
+
+import (
+	"time"
+
+	"github.com/deebakkarthi/coraserver/i18n"
+)
+
+// Day names by language, indexed by time.Weekday
+var dayNames = map[string][7]string{
+	"en": {"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	"hi": {"रविवार", "सोमवार", "मंगलवार", "बुधवार", "गुरुवार", "शुक्रवार", "शनिवार"},
+	"kn": {"ಭಾನುವಾರ", "ಸೋಮವಾರ", "ಮಂಗಳವಾರ", "ಬುಧವಾರ", "ಗುರುವಾರ", "ಶುಕ್ರವಾರ", "ಶನಿವಾರ"},
+	"ml": {"ഞായർ", "തിങ്കൾ", "ചൊവ്വ", "ബുധൻ", "വ്യാഴം", "വെള്ളി", "ശനി"},
+	"ta": {"ஞாயிறு", "திங்கள்", "செவ்வாய்", "புதன்", "வியாழன்", "வெள்ளி", "சனி"},
+	"te": {"ఆదివారం", "సోమవారం", "మంగళవారం", "బుధవారం", "గురువారం", "శుక్రవారం", "శనివారం"},
+}
+
+/*
+Language picks the language to name days in from an Accept-Language header,
+like "ta-IN,ta;q=0.9,en;q=0.8". Only the primary subtag counts; English is the
+fallback.
+*/
+func Language(acceptLanguage string) string {
+	lang := i18n.Negotiate(acceptLanguage, func(lang string) bool {
+		_, ok := dayNames[lang]
+		return ok
+	})
+	if lang == "" {
+		return i18n.English
+	}
+	return lang
+}
+
+// DayName names day in lang, one of the languages Language returns
+func DayName(day time.Weekday, lang string) string {
+	names, ok := dayNames[lang]
+	if !ok {
+		names = dayNames["en"]
+	}
+	return names[day]
+}
@@ -0,0 +1,115 @@
+/*
+Package cdn tells a CDN or reverse proxy in front of the server to drop the
+responses it cached under surrogate keys, the tags the server sends in the
+Surrogate-Key header of its public lookups. Purges are sent as one request
+naming the keys in a header, which is what Fastly's purge by key takes, and
+Varnish with the xkey module given a PURGE method and its header.
+*/
+package cdn
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// Where purges go, like https://api.fastly.com/service/SERVICE_ID/purge
+	URL string `json:"url"`
+	// POST by default
+	Method string `json:"method"`
+	// Header the space separated keys go in, Surrogate-Key by default
+	KeyHeader string `json:"keyHeader"`
+	// Sent with every purge, like {"Fastly-Key": "..."}
+	Headers map[string]string `json:"headers"`
+}
+
+const (
+	// Keys waiting to be purged; more are dropped until the purger catches up
+	queueSize = 4096
+	// Longest a key waits for others to be purged along with it
+	batchDelay = time.Second
+	// Most keys in one purge, Fastly takes 256
+	batchSize = 256
+)
+
+/*
+Purger queues the keys given to Purge and sends them in batches, so the
+changes of a timetable import or a multi-slot booking make a single purge.
+*/
+type Purger struct {
+	config Config
+	client *http.Client
+	queue  chan string
+}
+
+func New(config Config) *Purger {
+	if config.Method == "" {
+		config.Method = http.MethodPost
+	}
+	if config.KeyHeader == "" {
+		config.KeyHeader = "Surrogate-Key"
+	}
+	return &Purger{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan string, queueSize),
+	}
+}
+
+func (p *Purger) Purge(keys ...string) {
+	for _, key := range keys {
+		select {
+		case p.queue <- key:
+		default:
+			log.Println("CDN purge queue full, dropping key", key)
+		}
+	}
+}
+
+// Run blocks forever, so it has to be started in its own goroutine
+func (p *Purger) Run() {
+	for key := range p.queue {
+		batch := map[string]bool{key: true}
+		timer := time.NewTimer(batchDelay)
+	collect:
+		for len(batch) < batchSize {
+			select {
+			case key := <-p.queue:
+				batch[key] = true
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		keys := make([]string, 0, len(batch))
+		for key := range batch {
+			keys = append(keys, key)
+		}
+		if err := p.send(keys); err != nil {
+			log.Println("Error purging CDN keys", strings.Join(keys, " "), err)
+		}
+	}
+}
+
+func (p *Purger) send(keys []string) error {
+	req, err := http.NewRequest(p.config.Method, p.config.URL, nil)
+	if err != nil {
+		return err
+	}
+	for name, value := range p.config.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set(p.config.KeyHeader, strings.Join(keys, " "))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", p.config.URL, resp.Status)
+	}
+	return nil
+}
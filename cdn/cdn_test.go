@@ -0,0 +1,43 @@
+package cdn
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPurgeBatchesKeys(t *testing.T) {
+	type purge struct {
+		method string
+		keys   []string
+		token  string
+	}
+	received := make(chan purge, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys := strings.Fields(r.Header.Get("xkey-purge"))
+		sort.Strings(keys)
+		received <- purge{r.Method, keys, r.Header.Get("Fastly-Key")}
+	}))
+	defer ts.Close()
+
+	purger := New(Config{URL: ts.URL, Method: "PURGE", KeyHeader: "xkey-purge", Headers: map[string]string{"Fastly-Key": "secret"}})
+	go purger.Run()
+	purger.Purge("free:2023-06-13", "slots")
+	purger.Purge("free:2023-06-13")
+	select {
+	case got := <-received:
+		if got.method != "PURGE" || strings.Join(got.keys, " ") != "free:2023-06-13 slots" || got.token != "secret" {
+			t.Errorf("purged %+v; want the two keys once with PURGE and the header", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("purger did not send the keys")
+	}
+	select {
+	case got := <-received:
+		t.Errorf("purged %+v again; want one purge", got)
+	case <-time.After(2 * batchDelay):
+	}
+}
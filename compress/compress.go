@@ -0,0 +1,210 @@
+/*
+Package compress gzips or deflates responses for clients that ask for it in
+Accept-Encoding. Small bodies are not worth the CPU, so the response is
+buffered until it reaches MinSize before deciding; only the content types in
+ContentTypes are compressed.
+*/
+package compress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Options struct {
+	Disabled bool `json:"disabled"`
+	// Bodies smaller than this are sent as they are
+	MinSize int `json:"minSize"`
+	// Media types (without parameters) that may be compressed
+	ContentTypes []string `json:"contentTypes"`
+	// gzip/flate level, 0 means the library default
+	Level int `json:"level"`
+}
+
+var DefaultOptions = Options{
+	MinSize:      1024,
+	ContentTypes: []string{"application/json", "text/plain", "text/html", "text/css", "text/calendar", "text/csv", "application/javascript"},
+	Level:        gzip.DefaultCompression,
+}
+
+func Handler(opts Options, next http.Handler) http.Handler {
+	if opts.Disabled {
+		return next
+	}
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &responseWriter{ResponseWriter: w, opts: opts, encoding: encoding, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+/*
+negotiate picks gzip or deflate (in that order of preference) from an
+Accept-Encoding header, honoring q=0. It returns "" if neither is acceptable.
+*/
+func negotiate(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if name != "" {
+			accepted[name] = q > 0
+		}
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[encoding]; ok || (!listed && accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	opts     Options
+	encoding string
+	status   int
+	// Set once the headers have been sent
+	decided bool
+	buf     []byte
+	encoder io.WriteCloser
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.decided {
+		return
+	}
+	w.status = status
+	// Nothing to compress in these
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.opts.MinSize {
+			return len(p), nil
+		}
+		err := w.decide(w.compressible())
+		if err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *responseWriter) compressible() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.opts.ContentTypes {
+		if strings.EqualFold(mediaType, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide sends the headers and whatever was buffered, compressed or not
+func (w *responseWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if compress {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		var err error
+		if w.encoding == "gzip" {
+			w.encoder, err = gzip.NewWriterLevel(w.ResponseWriter, w.opts.Level)
+		} else {
+			w.encoder, err = flate.NewWriter(w.ResponseWriter, w.opts.Level)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush is needed by streaming handlers. It forces the decision on what has been buffered so far.
+func (w *responseWriter) Flush() {
+	if !w.decided {
+		w.decide(w.compressible())
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *responseWriter) close() {
+	if !w.decided {
+		// Never reached MinSize
+		w.decide(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
@@ -0,0 +1,77 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(t *testing.T, acceptEncoding string, contentType string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := Handler(DefaultOptions, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte(body))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCompressesLargeJSON(t *testing.T) {
+	body := "[" + strings.Repeat(`"C203",`, 500) + `"C203"]`
+	rec := serve(t, "gzip, deflate", "application/json", body)
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q; want gzip", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != body {
+		t.Errorf("decompressed body differs from the original")
+	}
+}
+
+func TestSkipsSmallBodies(t *testing.T) {
+	rec := serve(t, "gzip", "application/json", `["C203"]`)
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q; want none", got)
+	}
+	if rec.Body.String() != `["C203"]` {
+		t.Errorf("body = %q; want [\"C203\"]", rec.Body.String())
+	}
+}
+
+func TestSkipsOtherContentTypes(t *testing.T) {
+	rec := serve(t, "gzip", "image/png", strings.Repeat("x", 4096))
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q; want none", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                    "",
+		"gzip":                "gzip",
+		"deflate":             "deflate",
+		"gzip;q=0, deflate":   "deflate",
+		"br":                  "",
+		"*":                   "gzip",
+		"*, gzip;q=0":         "deflate",
+		"identity, gzip;q=.5": "gzip",
+	}
+	for header, want := range cases {
+		if got := negotiate(header); got != want {
+			t.Errorf("negotiate(%q) = %q; want %q", header, got, want)
+		}
+	}
+}
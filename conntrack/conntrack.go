@@ -0,0 +1,213 @@
+/*
+Package conntrack counts the connections of an HTTP server and the latency of
+the requests on them, by protocol and by whether the connection was new or
+kept alive, to see what HTTP/2 and keep-alives do for clients that come back
+every few minutes.
+
+A Tracker is hooked into an http.Server with its ConnState and ConnContext
+and wrapped around the handler:
+
+	tracker := conntrack.New()
+	server.ConnState = tracker.ConnState
+	server.ConnContext = tracker.ConnContext
+	server.Handler = tracker.Handler(server.Handler)
+*/
+package conntrack
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds of the latency buckets; slower requests land in a last, unbounded one
+var latencyBuckets = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+	50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second, 10 * time.Second,
+}
+
+type connKey struct{}
+
+type histogram struct {
+	count  int
+	total  time.Duration
+	max    time.Duration
+	counts []int
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]int, len(latencyBuckets)+1)}
+}
+
+func (h *histogram) observe(took time.Duration) {
+	h.count++
+	h.total += took
+	if took > h.max {
+		h.max = took
+	}
+	bucket := len(latencyBuckets)
+	for idx, bound := range latencyBuckets {
+		if took <= bound {
+			bucket = idx
+			break
+		}
+	}
+	h.counts[bucket]++
+}
+
+type Tracker struct {
+	mu       sync.Mutex
+	conns    map[net.Conn]http.ConnState
+	accepted int
+	closed   int
+	// By protocol, like HTTP/1.1 or HTTP/2.0
+	requests map[string]*histogram
+	// By whether the request was the first on its connection
+	first  *histogram
+	reused *histogram
+}
+
+func New() *Tracker {
+	return &Tracker{
+		conns:    make(map[net.Conn]http.ConnState),
+		requests: make(map[string]*histogram),
+		first:    newHistogram(),
+		reused:   newHistogram(),
+	}
+}
+
+// ConnState follows a connection through its states, it is the http.Server hook of the same name
+func (t *Tracker) ConnState(conn net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		t.accepted++
+		t.conns[conn] = state
+	case http.StateClosed, http.StateHijacked:
+		if _, ok := t.conns[conn]; ok {
+			delete(t.conns, conn)
+			t.closed++
+		}
+	default:
+		if _, ok := t.conns[conn]; ok {
+			t.conns[conn] = state
+		}
+	}
+}
+
+/*
+ConnContext gives every connection a count of its requests, which Handler uses
+to tell the first request from the ones on a kept alive connection. It is the
+http.Server hook of the same name; HTTP/2 requests get it too.
+*/
+func (t *Tracker) ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, new(int64))
+}
+
+// Handler times the requests to next
+func (t *Tracker) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reused := false
+		if n, ok := r.Context().Value(connKey{}).(*int64); ok {
+			reused = atomic.AddInt64(n, 1) > 1
+		}
+		start := time.Now()
+		defer func() {
+			t.observe(r.Proto, reused, time.Since(start))
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *Tracker) observe(proto string, reused bool, took time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.requests[proto]
+	if !ok {
+		h = newHistogram()
+		t.requests[proto] = h
+	}
+	h.observe(took)
+	if reused {
+		t.reused.observe(took)
+	} else {
+		t.first.observe(took)
+	}
+}
+
+type Bucket struct {
+	// Upper bound, like "25ms", or "+Inf"
+	LE    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// Latency is a histogram of request latencies, from the request being read until the handler returned
+type Latency struct {
+	Count   int      `json:"count"`
+	MeanMs  float64  `json:"meanMs"`
+	MaxMs   float64  `json:"maxMs"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+type Stats struct {
+	// Connections accepted and closed since the start
+	Accepted int `json:"accepted"`
+	Closed   int `json:"closed"`
+	// Open connections by state: new, active or idle
+	Open map[string]int `json:"open"`
+	// Requests served per accepted connection
+	RequestsPerConn float64 `json:"requestsPerConn"`
+	// Requests by protocol, like HTTP/1.1 or HTTP/2.0
+	Requests map[string]Latency `json:"requests"`
+	// Requests that opened their connection and those that came on one kept alive
+	First  Latency `json:"first"`
+	Reused Latency `json:"reused"`
+}
+
+func (t *Tracker) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := Stats{
+		Accepted: t.accepted,
+		Closed:   t.closed,
+		Open:     map[string]int{"new": 0, "active": 0, "idle": 0},
+		Requests: make(map[string]Latency, len(t.requests)),
+		First:    t.first.latency(),
+		Reused:   t.reused.latency(),
+	}
+	for _, state := range t.conns {
+		stats.Open[state.String()]++
+	}
+	for proto, h := range t.requests {
+		stats.Requests[proto] = h.latency()
+	}
+	if t.accepted > 0 {
+		stats.RequestsPerConn = float64(t.first.count+t.reused.count) / float64(t.accepted)
+	}
+	return stats
+}
+
+func (h *histogram) latency() Latency {
+	latency := Latency{Count: h.count, MaxMs: milliseconds(h.max)}
+	if h.count > 0 {
+		latency.MeanMs = milliseconds(h.total) / float64(h.count)
+	}
+	for idx, count := range h.counts {
+		le := "+Inf"
+		if idx < len(latencyBuckets) {
+			le = latencyBuckets[idx].String()
+		}
+		latency.Buckets = append(latency.Buckets, Bucket{LE: le, Count: count})
+	}
+	return latency
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,85 @@
+package conntrack_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/conntrack"
+)
+
+func newServer(tracker *conntrack.Tracker) *httptest.Server {
+	server := httptest.NewUnstartedServer(tracker.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})))
+	server.Config.ConnState = tracker.ConnState
+	server.Config.ConnContext = tracker.ConnContext
+	return server
+}
+
+func get(t *testing.T, client *http.Client, url string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reading to the end lets the client reuse the connection
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+}
+
+func TestKeepAlive(t *testing.T) {
+	tracker := conntrack.New()
+	server := newServer(tracker)
+	server.Start()
+	defer server.Close()
+
+	for i := 0; i < 3; i++ {
+		get(t, server.Client(), server.URL)
+	}
+	stats := tracker.Stats()
+	if stats.Accepted != 1 || stats.RequestsPerConn != 3 {
+		t.Errorf("got %d connections with %v requests each, want 1 with 3", stats.Accepted, stats.RequestsPerConn)
+	}
+	if stats.First.Count != 1 || stats.Reused.Count != 2 {
+		t.Errorf("got %d first and %d reused requests, want 1 and 2", stats.First.Count, stats.Reused.Count)
+	}
+	if stats.Requests["HTTP/1.1"].Count != 3 {
+		t.Errorf("got %+v, want 3 HTTP/1.1 requests", stats.Requests)
+	}
+	latency := stats.Requests["HTTP/1.1"]
+	if n := len(latency.Buckets); latency.Buckets[n-1].LE != "+Inf" {
+		t.Errorf("got buckets %+v, want the last unbounded", latency.Buckets)
+	}
+
+	// The server notices the closed connection on its own time
+	server.CloseClientConnections()
+	deadline := time.Now().Add(5 * time.Second)
+	for stats = tracker.Stats(); stats.Closed != 1 && time.Now().Before(deadline); stats = tracker.Stats() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats.Closed != 1 || stats.Open["active"]+stats.Open["idle"] != 0 {
+		t.Errorf("got %d closed and %v open after closing, want 1 and none", stats.Closed, stats.Open)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	tracker := conntrack.New()
+	server := newServer(tracker)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		get(t, server.Client(), server.URL)
+	}
+	stats := tracker.Stats()
+	if stats.Requests["HTTP/2.0"].Count != 2 {
+		t.Errorf("got %+v, want 2 HTTP/2.0 requests", stats.Requests)
+	}
+	if stats.First.Count != 1 || stats.Reused.Count != 1 {
+		t.Errorf("got %d first and %d reused requests, want 1 and 1", stats.First.Count, stats.Reused.Count)
+	}
+}
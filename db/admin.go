@@ -0,0 +1,286 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// One period of the weekly timetable
+type StaticEntry struct {
+	Class   string `json:"class"`
+	Day     string `json:"day"`
+	Slot    int    `json:"slot"`
+	Faculty string `json:"faculty"`
+	Subject string `json:"subject"`
+	// Number of consecutive slots taken from Slot on, more than 1 for labs
+	Span int `json:"span"`
+	/*
+		Starts at 1 and goes up with every change. Given to SetStatic it has
+		to be the stored one; 0 replaces whatever is there.
+	*/
+	Version int `json:"version"`
+}
+
+// Returned when an update names a version that is no longer the stored one
+var ErrStaleVersion = errors.New("db: stale version")
+
+// Zero fields match everything
+type TimetableFilter struct {
+	Class   string
+	Day     string
+	Slot    int
+	Subject string
+	Faculty string
+	// Only the classrooms on the campus with this ID
+	Campus string
+}
+
+// Zero fields match everything; the dates are inclusive
+type BookingFilter struct {
+	Class     string
+	Faculty   string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// A user with at least one unexpired session
+type UserSummary struct {
+	Mail         string    `json:"mail"`
+	Name         string    `json:"name"`
+	Sessions     int       `json:"sessions"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+}
+
+// The numbers on the admin dashboard
+type DashboardCounts struct {
+	BookingsToday       int `json:"bookingsToday"`
+	UpcomingBookings    int `json:"upcomingBookings"`
+	ActiveSessions      int `json:"activeSessions"`
+	ActiveUsers         int `json:"activeUsers"`
+	ActiveAPIKeys       int `json:"activeAPIKeys"`
+	ActiveAnnouncements int `json:"activeAnnouncements"`
+}
+
+// where builds a WHERE clause from the conditions whose argument is not the zero value
+func where(conditions []string, args []interface{}) (string, []interface{}) {
+	var clauses []string
+	var used []interface{}
+	for idx, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			if v == "" {
+				continue
+			}
+		case int:
+			if v == 0 {
+				continue
+			}
+		case time.Time:
+			if v.IsZero() {
+				continue
+			}
+		}
+		clauses = append(clauses, conditions[idx])
+		used = append(used, arg)
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), used
+}
+
+func GetStatic(dsn string, filter TimetableFilter) ([]StaticEntry, error) {
+	var entries []StaticEntry
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where(
+		[]string{"class_id = ?", "day = ?", "slot_id = ?", "subject_id = ?", "faculty_id = ?",
+			"class_id IN (SELECT id FROM classroom WHERE campus = ?)"},
+		[]interface{}{filter.Class, filter.Day, filter.Slot, filter.Subject, filter.Faculty, filter.Campus})
+	rows, err := db.Query(`SELECT class_id, day, slot_id, COALESCE(faculty_id, ''),
+    subject_id, span, version FROM static`+clause+` ORDER BY class_id, FIELD(day, 'MON', 'TUE',
+    'WED', 'THU', 'FRI'), slot_id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp StaticEntry
+		err := rows.Scan(&tmp.Class, &tmp.Day, &tmp.Slot, &tmp.Faculty, &tmp.Subject, &tmp.Span, &tmp.Version)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		entries = append(entries, tmp)
+	}
+	return entries, rows.Err()
+}
+
+/*
+SetStatic adds the period to the weekly timetable or replaces what is there.
+With a Version it only replaces that version of an existing period and returns
+ErrStaleVersion otherwise.
+*/
+func SetStatic(dsn string, entry StaticEntry) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	if entry.Span < 1 {
+		entry.Span = 1
+	}
+	if entry.Version != 0 {
+		result, err := db.Exec(`UPDATE static SET faculty_id = ?, subject_id = ?, span = ?,
+    version = version + 1 WHERE class_id = ? AND day = ? AND slot_id = ? AND version = ?`,
+			nullString(entry.Faculty), entry.Subject, entry.Span, entry.Class, entry.Day, entry.Slot, entry.Version)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		// The version always changes, so nothing affected means it did not match
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return ErrStaleVersion
+		}
+		return nil
+	}
+	_, err = db.Exec(`INSERT INTO static (class_id, day, slot_id, faculty_id,
+    subject_id, span) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE
+    faculty_id = VALUES(faculty_id), subject_id = VALUES(subject_id),
+    span = VALUES(span), version = version + 1`,
+		entry.Class, entry.Day, entry.Slot, nullString(entry.Faculty), entry.Subject, entry.Span)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func DeleteStatic(dsn string, class string, day string, slot int) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM static WHERE class_id = ? AND day = ? AND
+    slot_id = ?`, class, day, slot)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+func GetBookings(dsn string, filter BookingFilter) ([]BookingRecord, error) {
+	var bookings []BookingRecord
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where(
+		[]string{"class_id = ?", "faculty_id = ?", "date >= ?", "date <= ?"},
+		[]interface{}{filter.Class, filter.Faculty, filter.StartDate, filter.EndDate})
+	rows, err := db.Query(`SELECT class_id, date, slot_id, faculty_id, subject_id, version
+    FROM dynamic`+clause+` ORDER BY date, slot_id, class_id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp BookingRecord
+		err := rows.Scan(&tmp.Class, &tmp.Date, &tmp.Slot, &tmp.Faculty, &tmp.Subject, &tmp.Version)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		bookings = append(bookings, tmp)
+	}
+	return bookings, rows.Err()
+}
+
+/*
+GetActiveUsers lists the users with an unexpired session, the most recently
+active first. query matches part of the mail or name, empty matches everyone.
+*/
+func GetActiveUsers(dsn string, query string, limit int) ([]UserSummary, error) {
+	var users []UserSummary
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query) + "%"
+	rows, err := db.Query(`SELECT mail, MAX(name), COUNT(*), MAX(last_active_at)
+    FROM session WHERE expires_at > ? AND (mail LIKE ? OR name LIKE ?)
+    GROUP BY mail ORDER BY MAX(last_active_at) DESC LIMIT ?`,
+		time.Now(), pattern, pattern, limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp UserSummary
+		err := rows.Scan(&tmp.Mail, &tmp.Name, &tmp.Sessions, &tmp.LastActiveAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		users = append(users, tmp)
+	}
+	return users, rows.Err()
+}
+
+func GetDashboardCounts(dsn string, now time.Time) (DashboardCounts, error) {
+	var counts DashboardCounts
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return counts, err
+	}
+	defer db.Close()
+
+	today := now.Format("2006-01-02")
+	queries := []struct {
+		dest  *int
+		query string
+		args  []interface{}
+	}{
+		{&counts.BookingsToday, `SELECT COUNT(*) FROM dynamic WHERE date = ?`, []interface{}{today}},
+		{&counts.UpcomingBookings, `SELECT COUNT(*) FROM dynamic WHERE date > ?`, []interface{}{today}},
+		{&counts.ActiveSessions, `SELECT COUNT(*) FROM session WHERE expires_at > ?`, []interface{}{now}},
+		{&counts.ActiveUsers, `SELECT COUNT(DISTINCT mail) FROM session WHERE expires_at > ?`, []interface{}{now}},
+		{&counts.ActiveAPIKeys, `SELECT COUNT(*) FROM api_key WHERE revoked_at IS NULL AND
+        (expires_at IS NULL OR expires_at > ?)`, []interface{}{now}},
+		{&counts.ActiveAnnouncements, `SELECT COUNT(*) FROM announcement WHERE starts_at <= ?
+        AND (expires_at IS NULL OR expires_at > ?)`, []interface{}{now, now}},
+	}
+	for _, q := range queries {
+		err = db.QueryRow(q.query, q.args...).Scan(q.dest)
+		if err != nil {
+			log.Println(err)
+			return counts, err
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"unicode"
+)
+
+/*
+A RoomAlias is another name a classroom goes by in some import, like
+"A Block 101" for AB101. Alias is kept normalized, see NormalizeRoom.
+*/
+type RoomAlias struct {
+	Alias string `json:"alias"`
+	Class string `json:"class"`
+}
+
+/*
+NormalizeRoom reduces a room name to what tells rooms apart, upper case
+letters and digits, so "AB-101", "ab 101" and "AB101" are the same room.
+*/
+func NormalizeRoom(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, name)
+}
+
+func GetRoomAliases(dsn string) ([]RoomAlias, error) {
+	var aliases []RoomAlias
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT alias, class_id FROM room_alias ORDER BY class_id, alias`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp RoomAlias
+		err := rows.Scan(&tmp.Alias, &tmp.Class)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		aliases = append(aliases, tmp)
+	}
+	return aliases, rows.Err()
+}
+
+// SetRoomAlias adds the alias or points it at another classroom
+func SetRoomAlias(dsn string, alias RoomAlias) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO room_alias (alias, class_id) VALUES (?, ?)
+    ON DUPLICATE KEY UPDATE class_id = VALUES(class_id)`, NormalizeRoom(alias.Alias), alias.Class)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func DeleteRoomAlias(dsn string, alias string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM room_alias WHERE alias = ?`, NormalizeRoom(alias))
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+)
+
+type RoomUtilization struct {
+	Class      string  `json:"class"`
+	Occupied   int     `json:"occupied"`
+	Total      int     `json:"total"`
+	Percentage float64 `json:"percentage"`
+}
+
+type SlotUtilization struct {
+	Slot       int     `json:"slot"`
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Occupied   int     `json:"occupied"`
+	Total      int     `json:"total"`
+	Percentage float64 `json:"percentage"`
+}
+
+type Utilization struct {
+	StartDate string            `json:"startDate"`
+	EndDate   string            `json:"endDate"`
+	Rooms     []RoomUtilization `json:"rooms"`
+	PeakHours []SlotUtilization `json:"peakHours"`
+	LeastUsed []RoomUtilization `json:"leastUsed"`
+}
+
+type staticKey struct {
+	class string
+	day   string
+	slot  int
+}
+
+/*
+GetUtilization walks every date in [startDate, endDate] and counts, per room
+and per slot, how many periods were taken either by the weekly timetable or by
+a booking. A period is only counted once even though a booking can only exist
+on top of a FREE static slot. The result is limited to the `limit` busiest slots
+and `limit` least used rooms.
+*/
+func GetUtilization(dsn string, startDate time.Time, endDate time.Time, limit int) (Utilization, error) {
+	var utilization Utilization
+	utilization.StartDate = startDate.Format("2006-01-02")
+	utilization.EndDate = endDate.Format("2006-01-02")
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return utilization, err
+	}
+	defer db.Close()
+
+	// static[day] holds every (class, slot) period that exists on that day
+	// along with whether the timetable already occupies it
+	static := make(map[string]map[staticKey]bool)
+	spans := make(map[staticKey]int)
+	rows, err := db.Query(`SELECT class_id, day, slot_id, subject_id, span FROM static`)
+	if err != nil {
+		log.Println(err)
+		return utilization, err
+	}
+	for rows.Next() {
+		var key staticKey
+		var subject string
+		var span int
+		err := rows.Scan(&key.class, &key.day, &key.slot, &subject, &span)
+		if err != nil {
+			rows.Close()
+			log.Println(err)
+			return utilization, err
+		}
+		if static[key.day] == nil {
+			static[key.day] = make(map[staticKey]bool)
+		}
+		static[key.day][key] = subject != "FREE"
+		if span > 1 && subject != "FREE" {
+			spans[key] = span
+		}
+	}
+	rows.Close()
+	coverSpans(static, spans)
+
+	booked := make(map[string]map[staticKey]bool)
+	stmt, err := db.Prepare(`SELECT class_id, date, slot_id FROM dynamic WHERE
+    date BETWEEN ? AND ?`)
+	if err != nil {
+		log.Println(err)
+		return utilization, err
+	}
+	defer stmt.Close()
+	rows, err = stmt.Query(startDate, endDate)
+	if err != nil {
+		log.Println(err)
+		return utilization, err
+	}
+	for rows.Next() {
+		var key staticKey
+		var date time.Time
+		err := rows.Scan(&key.class, &date, &key.slot)
+		if err != nil {
+			rows.Close()
+			log.Println(err)
+			return utilization, err
+		}
+		dateStr := date.Format("2006-01-02")
+		if booked[dateStr] == nil {
+			booked[dateStr] = make(map[staticKey]bool)
+		}
+		booked[dateStr][key] = true
+	}
+	rows.Close()
+
+	slotTimes := make(map[int][2]string)
+	rows, err = db.Query(`SELECT id, stime, etime FROM slot`)
+	if err != nil {
+		log.Println(err)
+		return utilization, err
+	}
+	for rows.Next() {
+		var id int
+		var start, end string
+		err := rows.Scan(&id, &start, &end)
+		if err != nil {
+			rows.Close()
+			log.Println(err)
+			return utilization, err
+		}
+		slotTimes[id] = [2]string{start, end}
+	}
+	rows.Close()
+
+	return buildUtilization(static, booked, slotTimes, startDate, endDate, limit), nil
+}
+
+// coverSpans marks the periods that labs reach over as occupied
+func coverSpans(static map[string]map[staticKey]bool, spans map[staticKey]int) {
+	for key, span := range spans {
+		for slot := key.slot + 1; slot < key.slot+span; slot++ {
+			covered := staticKey{class: key.class, day: key.day, slot: slot}
+			if _, ok := static[key.day][covered]; ok {
+				static[key.day][covered] = true
+			}
+		}
+	}
+}
+
+/*
+buildUtilization does the counting for GetUtilization once the timetable
+(static[day]), the bookings (booked[date]) and the slot times are loaded.
+*/
+func buildUtilization(static map[string]map[staticKey]bool, booked map[string]map[staticKey]bool,
+	slotTimes map[int][2]string, startDate time.Time, endDate time.Time, limit int) Utilization {
+	var utilization Utilization
+	utilization.StartDate = startDate.Format("2006-01-02")
+	utilization.EndDate = endDate.Format("2006-01-02")
+
+	rooms := make(map[string]*RoomUtilization)
+	slots := make(map[int]*SlotUtilization)
+	for date := startDate; !date.After(endDate); date = date.AddDate(0, 0, 1) {
+		day := calendar.DayCode(date.Weekday())
+		dateStr := date.Format("2006-01-02")
+		for key, occupied := range static[day] {
+			if !occupied {
+				occupied = booked[dateStr][staticKey{class: key.class, slot: key.slot}]
+			}
+			room, ok := rooms[key.class]
+			if !ok {
+				room = &RoomUtilization{Class: key.class}
+				rooms[key.class] = room
+			}
+			slot, ok := slots[key.slot]
+			if !ok {
+				slot = &SlotUtilization{Slot: key.slot}
+				slots[key.slot] = slot
+			}
+			room.Total++
+			slot.Total++
+			if occupied {
+				room.Occupied++
+				slot.Occupied++
+			}
+		}
+	}
+
+	for id, times := range slotTimes {
+		if slot, ok := slots[id]; ok {
+			slot.Start = times[0]
+			slot.End = times[1]
+		}
+	}
+
+	for _, room := range rooms {
+		room.Percentage = percentage(room.Occupied, room.Total)
+		utilization.Rooms = append(utilization.Rooms, *room)
+	}
+	sort.Slice(utilization.Rooms, func(i, j int) bool {
+		return utilization.Rooms[i].Class < utilization.Rooms[j].Class
+	})
+
+	for _, slot := range slots {
+		slot.Percentage = percentage(slot.Occupied, slot.Total)
+		utilization.PeakHours = append(utilization.PeakHours, *slot)
+	}
+	sort.Slice(utilization.PeakHours, func(i, j int) bool {
+		a, b := utilization.PeakHours[i], utilization.PeakHours[j]
+		if a.Percentage != b.Percentage {
+			return a.Percentage > b.Percentage
+		}
+		return a.Slot < b.Slot
+	})
+	if len(utilization.PeakHours) > limit {
+		utilization.PeakHours = utilization.PeakHours[:limit]
+	}
+
+	utilization.LeastUsed = append(utilization.LeastUsed, utilization.Rooms...)
+	sort.SliceStable(utilization.LeastUsed, func(i, j int) bool {
+		return utilization.LeastUsed[i].Percentage < utilization.LeastUsed[j].Percentage
+	})
+	if len(utilization.LeastUsed) > limit {
+		utilization.LeastUsed = utilization.LeastUsed[:limit]
+	}
+	return utilization
+}
+
+func percentage(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part*10000/total) / 100
+}
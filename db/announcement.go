@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// A notice shown to every user between StartsAt and ExpiresAt (forever when nil)
+type Announcement struct {
+	ID        int64      `json:"id"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	StartsAt  time.Time  `json:"startsAt"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+	// See StaticEntry.Version
+	Version int `json:"version"`
+}
+
+const announcementColumns = `id, title, body, starts_at, expires_at, created_at, version`
+
+func scanAnnouncement(scanner interface{ Scan(...interface{}) error }) (Announcement, error) {
+	var announcement Announcement
+	var expiresAt sql.NullTime
+	err := scanner.Scan(&announcement.ID, &announcement.Title, &announcement.Body,
+		&announcement.StartsAt, &expiresAt, &announcement.CreatedAt, &announcement.Version)
+	announcement.ExpiresAt = nullTimePtr(expiresAt)
+	return announcement, err
+}
+
+func timePtrArg(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// CreateAnnouncement stores announcement and returns its ID
+func CreateAnnouncement(dsn string, announcement Announcement) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO announcement (title, body, starts_at,
+    expires_at, created_at) VALUES (?, ?, ?, ?, ?)`, announcement.Title,
+		announcement.Body, announcement.StartsAt, timePtrArg(announcement.ExpiresAt),
+		announcement.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+/*
+UpdateAnnouncement replaces everything but the creation time. sql.ErrNoRows
+means there is no such announcement, ErrStaleVersion that it is no longer at
+the Version given.
+*/
+func UpdateAnnouncement(dsn string, announcement Announcement) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE announcement SET title = ?, body = ?,
+    starts_at = ?, expires_at = ?, version = version + 1 WHERE id = ? AND
+    (? = 0 OR version = ?)`, announcement.Title, announcement.Body,
+		announcement.StartsAt, timePtrArg(announcement.ExpiresAt), announcement.ID,
+		announcement.Version, announcement.Version)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	// The version always changes, so nothing affected means no row or another version
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		return nil
+	}
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM announcement WHERE id = ?`, announcement.ID).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return ErrStaleVersion
+}
+
+func DeleteAnnouncement(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM announcement WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+/*
+GetAnnouncements lists the announcements that are showing at activeAt, the
+newest first, or all of them when activeAt is the zero time.
+*/
+func GetAnnouncements(dsn string, activeAt time.Time) ([]Announcement, error) {
+	var announcements []Announcement
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT ` + announcementColumns + ` FROM announcement`
+	var args []interface{}
+	if !activeAt.IsZero() {
+		query += ` WHERE starts_at <= ? AND (expires_at IS NULL OR expires_at > ?)`
+		args = append(args, activeAt, activeAt)
+	}
+	rows, err := db.Query(query+` ORDER BY starts_at DESC, id DESC`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		announcement, err := scanAnnouncement(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		announcements = append(announcements, announcement)
+	}
+	return announcements, rows.Err()
+}
+
+// showing reports whether the announcement is shown at t
+func (a Announcement) showing(t time.Time) bool {
+	return !a.StartsAt.After(t) && (a.ExpiresAt == nil || a.ExpiresAt.After(t))
+}
@@ -0,0 +1,206 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+/*
+APIKey lets another service call the API without a user login. Only a hash of
+the secret part of the key is stored. ExpiresAt is set on the old key when a key
+is rotated so that clients have a grace period to switch over.
+*/
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	SecretHash string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  int        `json:"rateLimit"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// Active reports whether the key may still be used at now
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// HasScope reports whether the key carries scope; "booking:*" carries every scope of bookings
+func (k APIKey) HasScope(scope string) bool {
+	resource := strings.SplitN(scope, ":", 2)[0]
+	for _, s := range k.Scopes {
+		if s == scope || s == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateAPIKey(dsn string, key APIKey) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO api_key (id, name, secret_hash, scopes,
+    rate_limit, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`, key.ID,
+		key.Name, key.SecretHash, strings.Join(key.Scopes, ","), key.RateLimit,
+		key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+const apiKeyColumns = `id, name, secret_hash, scopes, rate_limit, created_at,
+    expires_at, revoked_at, last_used_at`
+
+func scanAPIKey(scanner interface{ Scan(...interface{}) error }) (APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	err := scanner.Scan(&key.ID, &key.Name, &key.SecretHash, &scopes,
+		&key.RateLimit, &key.CreatedAt, &expiresAt, &revokedAt, &lastUsedAt)
+	if err != nil {
+		return key, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	return key, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// GetAPIKey returns sql.ErrNoRows for unknown IDs. Revoked and expired keys are returned too.
+func GetAPIKey(dsn string, id string) (APIKey, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return APIKey{}, err
+	}
+	defer db.Close()
+
+	key, err := scanAPIKey(db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_key WHERE id = ?`, id))
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	return key, err
+}
+
+func GetAllAPIKey(dsn string) ([]APIKey, error) {
+	var keys []APIKey
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT ` + apiKeyColumns + ` FROM api_key ORDER BY created_at`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func RevokeAPIKey(dsn string, id string, at time.Time) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE api_key SET revoked_at = ? WHERE id = ? AND
+    revoked_at IS NULL`, at, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+/*
+RotateAPIKey stores replacement and makes the key it replaces expire at
+oldExpiresAt, in one transaction so that a failure leaves the old key as it was.
+sql.ErrNoRows means the old key is unknown or no longer active.
+*/
+func RotateAPIKey(dsn string, id string, replacement APIKey, oldExpiresAt time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	// A key that is already expiring keeps its earlier expiry
+	result, err := tx.Exec(`UPDATE api_key SET expires_at =
+    LEAST(COALESCE(expires_at, ?), ?) WHERE id = ? AND revoked_at IS NULL AND
+    (expires_at IS NULL OR expires_at > ?)`, oldExpiresAt, oldExpiresAt, id,
+		replacement.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	_, err = tx.Exec(`INSERT INTO api_key (id, name, secret_hash, scopes,
+    rate_limit, created_at) VALUES (?, ?, ?, ?, ?, ?)`, replacement.ID,
+		replacement.Name, replacement.SecretHash, strings.Join(replacement.Scopes, ","),
+		replacement.RateLimit, replacement.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func TouchAPIKey(dsn string, id string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE api_key SET last_used_at = ? WHERE id = ?`, at, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+An Assignment is work set by a faculty member in one of their subjects, for a
+class section (like "CSE-B 2020") or for everyone taking the subject when
+Section is empty.
+*/
+type Assignment struct {
+	ID        int64     `json:"id"`
+	Subject   string    `json:"subject"`
+	Section   string    `json:"section,omitempty"`
+	Title     string    `json:"title"`
+	Due       time.Time `json:"due"`
+	Link      string    `json:"link,omitempty"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Whether the students were reminded of the deadline
+	Reminded bool `json:"-"`
+}
+
+// An AssignmentFilter picks assignments; zero fields match everything
+type AssignmentFilter struct {
+	Subject   string
+	CreatedBy string
+	// Due at or after DueAfter and before DueBefore
+	DueAfter  time.Time
+	DueBefore time.Time
+	// Only the ones whose students were not reminded yet
+	Unreminded bool
+}
+
+// CreateAssignment stores assignment and returns its ID
+func CreateAssignment(dsn string, assignment Assignment) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO assignment (subject_id, section, title, due, link,
+    created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`, assignment.Subject, assignment.Section,
+		assignment.Title, assignment.Due, assignment.Link, assignment.CreatedBy, assignment.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+/*
+UpdateAssignment replaces the section, title, due date and link of the
+assignment with assignment's ID. Moving the due date means the students are
+reminded again. sql.ErrNoRows means there is no such assignment.
+*/
+func UpdateAssignment(dsn string, assignment Assignment) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE assignment SET section = ?, title = ?, link = ?,
+    reminded = reminded AND due = ?, due = ? WHERE id = ?`, assignment.Section, assignment.Title,
+		assignment.Link, assignment.Due, assignment.Due, assignment.ID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func DeleteAssignment(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM assignment WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// MarkAssignmentReminded records that the students of the assignment were reminded
+func MarkAssignmentReminded(dsn string, id int64) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE assignment SET reminded = TRUE WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetAssignments lists the assignments matching filter, soonest due first
+func GetAssignments(dsn string, filter AssignmentFilter) ([]Assignment, error) {
+	var assignments []Assignment
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"subject_id = ?", "created_by = ?", "due >= ?", "due < ?"},
+		[]interface{}{filter.Subject, filter.CreatedBy, filter.DueAfter, filter.DueBefore})
+	if filter.Unreminded && clause == "" {
+		clause = " WHERE reminded = FALSE"
+	} else if filter.Unreminded {
+		clause += " AND reminded = FALSE"
+	}
+	rows, err := db.Query(`SELECT id, subject_id, section, title, due, link, created_by,
+    created_at, reminded FROM assignment`+clause+` ORDER BY due, id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Assignment
+		err := rows.Scan(&tmp.ID, &tmp.Subject, &tmp.Section, &tmp.Title, &tmp.Due, &tmp.Link,
+			&tmp.CreatedBy, &tmp.CreatedAt, &tmp.Reminded)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		assignments = append(assignments, tmp)
+	}
+	return assignments, rows.Err()
+}
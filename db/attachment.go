@@ -0,0 +1,75 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+An Attachment is a file uploaded to go with an announcement, an assignment or
+a timetable import. Only its description is kept here; the content is in the
+storage backend under ID.
+*/
+type Attachment struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	UploadedBy  string    `json:"uploadedBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func CreateAttachment(dsn string, attachment Attachment) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO attachment (id, name, content_type, size, uploaded_by,
+    created_at) VALUES (?, ?, ?, ?, ?, ?)`, attachment.ID, attachment.Name, attachment.ContentType,
+		attachment.Size, attachment.UploadedBy, attachment.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetAttachment returns sql.ErrNoRows for unknown IDs
+func GetAttachment(dsn string, id string) (Attachment, error) {
+	var attachment Attachment
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return Attachment{}, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow(`SELECT id, name, content_type, size, uploaded_by, created_at
+    FROM attachment WHERE id = ?`, id).Scan(&attachment.ID, &attachment.Name,
+		&attachment.ContentType, &attachment.Size, &attachment.UploadedBy, &attachment.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	return attachment, err
+}
+
+func DeleteAttachment(dsn string, id string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM attachment WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+An AttendanceRecord says whether the student with Roll was at the period of
+Class starting at Slot on Date. Subject is copied from the timetable when the
+attendance is taken, so that later timetable changes do not move it.
+*/
+type AttendanceRecord struct {
+	Class    string    `json:"class"`
+	Date     time.Time `json:"date"`
+	Slot     int       `json:"slot"`
+	Subject  string    `json:"subject"`
+	Roll     string    `json:"roll"`
+	Present  bool      `json:"present"`
+	MarkedBy string    `json:"markedBy"`
+	MarkedAt time.Time `json:"markedAt"`
+}
+
+// An AttendanceFilter picks records; zero fields match everything
+type AttendanceFilter struct {
+	Class     string
+	Date      time.Time
+	Slot      int
+	Subject   string
+	Roll      string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+/*
+SetAttendance replaces the attendance of the period of class starting at slot
+on date by records.
+*/
+func SetAttendance(dsn string, class string, date time.Time, slot int, records []AttendanceRecord) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`DELETE FROM attendance WHERE class_id = ? AND date = ? AND slot_id = ?`,
+		class, date, slot)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, record := range records {
+		_, err = tx.Exec(`INSERT INTO attendance (class_id, date, slot_id, subject_id, roll,
+        present, marked_by, marked_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, class, date, slot,
+			record.Subject, record.Roll, record.Present, record.MarkedBy, record.MarkedAt)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetAttendance lists the records matching filter by date, slot, class and roll
+func GetAttendance(dsn string, filter AttendanceFilter) ([]AttendanceRecord, error) {
+	var records []AttendanceRecord
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"class_id = ?", "date = ?", "slot_id = ?", "subject_id = ?",
+		"roll = ?", "date >= ?", "date <= ?"}, []interface{}{filter.Class, filter.Date, filter.Slot,
+		filter.Subject, filter.Roll, filter.StartDate, filter.EndDate})
+	rows, err := db.Query(`SELECT class_id, date, slot_id, subject_id, roll, present,
+    marked_by, marked_at FROM attendance`+clause+` ORDER BY date, slot_id, class_id, roll`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp AttendanceRecord
+		err := rows.Scan(&tmp.Class, &tmp.Date, &tmp.Slot, &tmp.Subject, &tmp.Roll, &tmp.Present,
+			&tmp.MarkedBy, &tmp.MarkedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		records = append(records, tmp)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+AuditEvent records a change made through the admin endpoints. Actor is
+"admin" for the admin key or "apikey:<id>"; Target names what was changed,
+like "A104/TUE/3" or a user's mail.
+*/
+type AuditEvent struct {
+	ID     int64     `json:"id"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Detail string    `json:"detail"`
+	At     time.Time `json:"at"`
+}
+
+func RecordAudit(dsn string, event AuditEvent) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO audit_event (actor, action, target, detail, at)
+    VALUES (?, ?, ?, ?, ?)`, event.Actor, event.Action, event.Target, event.Detail, event.At)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetAuditEvents returns the latest limit events, only those of action unless it is empty
+func GetAuditEvents(dsn string, action string, limit int) ([]AuditEvent, error) {
+	var events []AuditEvent
+	err := EachAuditEvent(dsn, action, limit, func(event AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+/*
+EachAuditEvent is GetAuditEvents calling fn with every event as it is read
+instead of collecting them, so a long log is never held in memory. An error
+from fn stops it and is returned.
+*/
+func EachAuditEvent(dsn string, action string, limit int, fn func(AuditEvent) error) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"action = ?"}, []interface{}{action})
+	rows, err := db.Query(`SELECT id, actor, action, target, detail, at FROM
+    audit_event`+clause+` ORDER BY at DESC, id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp AuditEvent
+		err := rows.Scan(&tmp.ID, &tmp.Actor, &tmp.Action, &tmp.Target, &tmp.Detail, &tmp.At)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		if err := fn(tmp); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetUserAuditEvents returns the latest limit events mail made or that were about them
+func GetUserAuditEvents(dsn string, mail string, limit int) ([]AuditEvent, error) {
+	var events []AuditEvent
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, actor, action, target, detail, at FROM audit_event
+    WHERE actor = ? OR target = ? ORDER BY at DESC, id DESC LIMIT ?`, mail, mail, limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp AuditEvent
+		err := rows.Scan(&tmp.ID, &tmp.Actor, &tmp.Action, &tmp.Target, &tmp.Detail, &tmp.At)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		events = append(events, tmp)
+	}
+	return events, rows.Err()
+}
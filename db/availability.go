@@ -0,0 +1,172 @@
+package db
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+)
+
+// Highest slot ID the availability bitmaps have room for
+const maxMatrixSlot = 63
+
+/*
+availability is the room × day × slot matrix of free slots Preloaded answers
+from: for every room a bitmap per weekday of its free periods (bit n for slot
+n, labs reaching over later slots taken into account), less a bitmap per date
+of its bookings, and none at all on the dates it is blocked. Whether a room is
+free in any set of slots of a date is then a mask test.
+*/
+type availability struct {
+	rooms  []string
+	index  map[string]int
+	weekly [][7]uint64
+	// By date, like "2023-06-13", then room
+	booked map[string][]uint64
+	// By room
+	blocks [][]Block
+}
+
+// newAvailability builds the matrix, or returns nil when a slot ID does not fit a bitmap
+func newAvailability(entries []StaticEntry, bookings []BookingRecord, blocks []Block) *availability {
+	a := &availability{index: make(map[string]int), booked: make(map[string][]uint64)}
+	for _, entry := range entries {
+		if entry.Slot < 0 || entry.Slot > maxMatrixSlot {
+			return nil
+		}
+		if _, ok := a.index[entry.Class]; !ok {
+			a.index[entry.Class] = 0
+			a.rooms = append(a.rooms, entry.Class)
+		}
+	}
+	sort.Strings(a.rooms)
+	for idx, room := range a.rooms {
+		a.index[room] = idx
+	}
+	a.weekly = make([][7]uint64, len(a.rooms))
+	a.blocks = make([][]Block, len(a.rooms))
+	days := make(map[string]int)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		days[calendar.DayCode(day)] = int(day)
+	}
+	for _, entry := range entries {
+		day, ok := days[entry.Day]
+		if ok && entry.Subject == "FREE" {
+			a.weekly[a.index[entry.Class]][day] |= 1 << uint(entry.Slot)
+		}
+	}
+	// Labs take the later slots they reach over, whatever those rows say
+	for _, entry := range entries {
+		day, ok := days[entry.Day]
+		if ok && entry.Subject != "FREE" && entry.Span > 1 {
+			a.weekly[a.index[entry.Class]][day] &^= slotRange(entry.Slot+1, entry.Slot+entry.Span-1)
+		}
+	}
+	for _, booking := range bookings {
+		a.book(booking.Class, booking.Date, []int{booking.Slot})
+	}
+	for _, block := range blocks {
+		if room, ok := a.index[block.Class]; ok {
+			a.blocks[room] = append(a.blocks[room], block)
+		}
+	}
+	return a
+}
+
+// slotRange is the bitmap of the slots from start to end, none when start is after end
+func slotRange(start int, end int) uint64 {
+	if start < 0 {
+		start = 0
+	}
+	if end > maxMatrixSlot {
+		end = maxMatrixSlot
+	}
+	if start > end {
+		return 0
+	}
+	return (^uint64(0) >> uint(maxMatrixSlot-end)) &^ (1<<uint(start) - 1)
+}
+
+// slotMask is the bitmap of slots, or false when one does not fit
+func slotMask(slots []int) (uint64, bool) {
+	var mask uint64
+	for _, slot := range slots {
+		if slot < 0 || slot > maxMatrixSlot {
+			return 0, false
+		}
+		mask |= 1 << uint(slot)
+	}
+	return mask, true
+}
+
+func (a *availability) free(room int, date time.Time) uint64 {
+	for _, block := range a.blocks[room] {
+		if !date.Before(block.StartDate) && !date.After(block.EndDate) {
+			return 0
+		}
+	}
+	free := a.weekly[room][date.Weekday()]
+	if booked, ok := a.booked[date.Format("2006-01-02")]; ok {
+		free &^= booked[room]
+	}
+	return free
+}
+
+func (a *availability) book(class string, date time.Time, slots []int) {
+	a.mark(class, date, slots, true)
+}
+
+func (a *availability) release(class string, date time.Time, slots []int) {
+	a.mark(class, date, slots, false)
+}
+
+func (a *availability) mark(class string, date time.Time, slots []int, booked bool) {
+	room, ok := a.index[class]
+	mask, fits := slotMask(slots)
+	if !ok || !fits {
+		return
+	}
+	key := date.Format("2006-01-02")
+	if a.booked[key] == nil {
+		a.booked[key] = make([]uint64, len(a.rooms))
+	}
+	if booked {
+		a.booked[key][room] |= mask
+	} else {
+		a.booked[key][room] &^= mask
+	}
+}
+
+// freeRooms lists the rooms free in every slot of mask on every date
+func (a *availability) freeRooms(mask uint64, dates []time.Time) []string {
+	var rooms []string
+	if mask == 0 || len(dates) == 0 {
+		return rooms
+	}
+	for room, name := range a.rooms {
+		free := true
+		for _, date := range dates {
+			if a.free(room, date)&mask != mask {
+				free = false
+				break
+			}
+		}
+		if free {
+			rooms = append(rooms, name)
+		}
+	}
+	return rooms
+}
+
+func (a *availability) freeSlots(class string, date time.Time) []int {
+	var slots []int
+	room, ok := a.index[class]
+	if !ok {
+		return slots
+	}
+	for free := a.free(room, date); free != 0; free &= free - 1 {
+		slots = append(slots, bits.TrailingZeros64(free))
+	}
+	return slots
+}
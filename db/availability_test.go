@@ -0,0 +1,43 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAvailability(t *testing.T) {
+	tuesday := time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC)
+	entries := []StaticEntry{
+		{Class: "A104", Day: "TUE", Slot: 1, Subject: "FREE"},
+		{Class: "A104", Day: "TUE", Slot: 2, Subject: "FREE"},
+		{Class: "A104", Day: "TUE", Slot: 3, Subject: "FREE"},
+		{Class: "B201", Day: "TUE", Slot: 1, Subject: "19CSE302", Span: 2},
+		{Class: "B201", Day: "TUE", Slot: 2, Subject: "FREE"},
+		{Class: "B201", Day: "TUE", Slot: 3, Subject: "FREE"},
+	}
+	bookings := []BookingRecord{{Class: "A104", Date: tuesday, Slot: 3}}
+	blocks := []Block{{Class: "B201", StartDate: tuesday.AddDate(0, 0, 7), EndDate: tuesday.AddDate(0, 0, 7)}}
+	a := newAvailability(entries, bookings, blocks)
+
+	if got, want := a.freeSlots("A104", tuesday), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("freeSlots(A104) = %v; want %v", got, want)
+	}
+	if got, want := a.freeSlots("B201", tuesday), []int{3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("freeSlots(B201) under a lab = %v; want %v", got, want)
+	}
+	if got, want := a.freeRooms(slotRange(2, 3), []time.Time{tuesday.AddDate(0, 0, 14)}), []string{"A104"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("freeRooms(2-3) = %v; want %v", got, want)
+	}
+	if got := a.freeRooms(slotRange(3, 3), []time.Time{tuesday, tuesday.AddDate(0, 0, 7)}); len(got) != 0 {
+		t.Errorf("freeRooms(3) across a booking and a block = %v; want none", got)
+	}
+	a.release("A104", tuesday, []int{3})
+	a.book("A104", tuesday, []int{1})
+	if got, want := a.freeSlots("A104", tuesday), []int{2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("freeSlots(A104) after moving the booking = %v; want %v", got, want)
+	}
+	if newAvailability(append(entries, StaticEntry{Class: "C301", Day: "TUE", Slot: 64, Subject: "FREE"}), nil, nil) != nil {
+		t.Error("newAvailability with slot 64 made a matrix; want none")
+	}
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+A Backup is a copy of the weekly timetable, the classrooms and the bookings
+taken at CreatedAt, kept in the backup storage under its ID. The counts tell
+what it holds without reading it.
+*/
+type Backup struct {
+	ID         string    `json:"id"`
+	Size       int64     `json:"size"`
+	Periods    int       `json:"periods"`
+	Classrooms int       `json:"classrooms"`
+	Bookings   int       `json:"bookings"`
+	CreatedBy  string    `json:"createdBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func CreateBackup(dsn string, backup Backup) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO db_backup (id, size, periods, classrooms, bookings, created_by,
+    created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`, backup.ID, backup.Size, backup.Periods,
+		backup.Classrooms, backup.Bookings, backup.CreatedBy, backup.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetBackups lists the backups, the latest first
+func GetBackups(dsn string) ([]Backup, error) {
+	var backups []Backup
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, size, periods, classrooms, bookings, created_by, created_at
+    FROM db_backup ORDER BY created_at DESC`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Backup
+		err := rows.Scan(&tmp.ID, &tmp.Size, &tmp.Periods, &tmp.Classrooms, &tmp.Bookings, &tmp.CreatedBy, &tmp.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		backups = append(backups, tmp)
+	}
+	return backups, rows.Err()
+}
+
+// GetBackup returns a backup, or sql.ErrNoRows for unknown IDs
+func GetBackup(dsn string, id string) (Backup, error) {
+	var backup Backup
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return backup, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow(`SELECT id, size, periods, classrooms, bookings, created_by, created_at
+    FROM db_backup WHERE id = ?`, id).Scan(&backup.ID, &backup.Size, &backup.Periods,
+		&backup.Classrooms, &backup.Bookings, &backup.CreatedBy, &backup.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	return backup, err
+}
+
+func DeleteBackup(dsn string, id string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM db_backup WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+A Block takes a room out of use from StartDate to EndDate inclusive, for
+repairs or an event. The free class queries skip it and it cannot be booked
+in that window.
+*/
+type Block struct {
+	ID        int64     `json:"id"`
+	Class     string    `json:"class"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// The test for the static row s that its room is not blocked on the date passed as the argument
+const notBlocked = `NOT EXISTS (SELECT 1 FROM room_block b WHERE
+    b.class_id=s.class_id AND ? BETWEEN b.start_date AND b.end_date)`
+
+// CreateBlock stores block and returns its ID
+func CreateBlock(dsn string, block Block) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO room_block (class_id, start_date, end_date,
+    reason, created_at) VALUES (?, ?, ?, ?, ?)`, block.Class, block.StartDate,
+		block.EndDate, block.Reason, block.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func DeleteBlock(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM room_block WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+/*
+GetBlocks lists the blocks of class that reach into startDate to endDate, in
+start date order. Empty arguments match everything.
+*/
+func GetBlocks(dsn string, class string, startDate time.Time, endDate time.Time) ([]Block, error) {
+	var blocks []Block
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"class_id = ?", "end_date >= ?", "start_date <= ?"},
+		[]interface{}{class, startDate, endDate})
+	rows, err := db.Query(`SELECT id, class_id, start_date, end_date, reason, created_at
+    FROM room_block`+clause+` ORDER BY start_date, class_id, id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Block
+		err := rows.Scan(&tmp.ID, &tmp.Class, &tmp.StartDate, &tmp.EndDate, &tmp.Reason, &tmp.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		blocks = append(blocks, tmp)
+	}
+	return blocks, rows.Err()
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+)
+
+/*
+A Building classrooms are in, matched by name to the building of a
+classroom. Buildings placed on the map have coordinates, in degrees.
+*/
+type Building struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// A BuildingPath is a walk between two buildings taking a known time, either way
+type BuildingPath struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Minutes int    `json:"minutes"`
+}
+
+// Stores paths with the buildings in order, so each pair is stored once
+func pathKey(from, to string) (string, string) {
+	if to < from {
+		return to, from
+	}
+	return from, to
+}
+
+func GetBuildings(dsn string) ([]Building, error) {
+	var buildings []Building
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, name, latitude, longitude FROM building ORDER BY id`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Building
+		var latitude, longitude sql.NullFloat64
+		err := rows.Scan(&tmp.ID, &tmp.Name, &latitude, &longitude)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if latitude.Valid && longitude.Valid {
+			tmp.Latitude, tmp.Longitude = &latitude.Float64, &longitude.Float64
+		}
+		buildings = append(buildings, tmp)
+	}
+	return buildings, rows.Err()
+}
+
+// SetBuilding adds the building or replaces its name and coordinates
+func SetBuilding(dsn string, building Building) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO building (id, name, latitude, longitude) VALUES (?, ?, ?, ?)
+    ON DUPLICATE KEY UPDATE name = VALUES(name), latitude = VALUES(latitude), longitude = VALUES(longitude)`,
+		building.ID, building.Name, building.Latitude, building.Longitude)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteBuilding removes the building with its paths
+func DeleteBuilding(dsn string, id string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM building_path WHERE from_id = ? OR to_id = ?`, id, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	result, err := db.Exec(`DELETE FROM building WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetBuildingPaths lists the paths, each with its buildings in order
+func GetBuildingPaths(dsn string) ([]BuildingPath, error) {
+	var paths []BuildingPath
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT from_id, to_id, minutes FROM building_path ORDER BY from_id, to_id`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp BuildingPath
+		err := rows.Scan(&tmp.From, &tmp.To, &tmp.Minutes)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		paths = append(paths, tmp)
+	}
+	return paths, rows.Err()
+}
+
+// SetBuildingPath adds the path or replaces the time it takes
+func SetBuildingPath(dsn string, path BuildingPath) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	from, to := pathKey(path.From, path.To)
+	_, err = db.Exec(`INSERT INTO building_path (from_id, to_id, minutes) VALUES (?, ?, ?)
+    ON DUPLICATE KEY UPDATE minutes = VALUES(minutes)`, from, to, path.Minutes)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func DeleteBuildingPath(dsn string, from, to string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	from, to = pathKey(from, to)
+	result, err := db.Exec(`DELETE FROM building_path WHERE from_id = ? AND to_id = ?`, from, to)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
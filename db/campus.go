@@ -0,0 +1,94 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// A Campus of the institution, which classrooms are assigned to
+type Campus struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ErrCampusInUse is returned when deleting a campus classrooms are still on
+var ErrCampusInUse = errors.New("db: campus has classrooms")
+
+func GetCampuses(dsn string) ([]Campus, error) {
+	var campuses []Campus
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, name FROM campus ORDER BY id`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Campus
+		err := rows.Scan(&tmp.ID, &tmp.Name)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		campuses = append(campuses, tmp)
+	}
+	return campuses, rows.Err()
+}
+
+// SetCampus adds the campus or renames it
+func SetCampus(dsn string, campus Campus) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO campus (id, name) VALUES (?, ?)
+    ON DUPLICATE KEY UPDATE name = VALUES(name)`, campus.ID, campus.Name)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteCampus fails with ErrCampusInUse while classrooms are on the campus
+func DeleteCampus(dsn string, id string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer tx.Rollback()
+	var classrooms int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM classroom WHERE campus = ? FOR UPDATE`, id).Scan(&classrooms)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	result, err := tx.Exec(`DELETE FROM campus WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected > 0 && classrooms > 0 {
+		return 0, ErrCampusInUse
+	}
+	return rowsAffected, tx.Commit()
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+)
+
+// A subject or faculty member: the code or mail, and what people call it
+type Named struct {
+	ID   string
+	Name string
+}
+
+// Everything a search can find, without the FREE placeholders
+type Catalog struct {
+	Classes  []string
+	Subjects []Named
+	Faculty  []Named
+}
+
+func queryNamed(db *sql.DB, query string) ([]Named, error) {
+	var named []Named
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Named
+		err := rows.Scan(&tmp.ID, &tmp.Name)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		named = append(named, tmp)
+	}
+	return named, rows.Err()
+}
+
+func GetCatalog(dsn string) (Catalog, error) {
+	var catalog Catalog
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return catalog, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT DISTINCT class_id FROM static ORDER BY class_id`)
+	if err != nil {
+		log.Println(err)
+		return catalog, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp string
+		err := rows.Scan(&tmp)
+		if err != nil {
+			log.Println(err)
+			return catalog, err
+		}
+		catalog.Classes = append(catalog.Classes, tmp)
+	}
+	if err := rows.Err(); err != nil {
+		return catalog, err
+	}
+	catalog.Subjects, err = queryNamed(db, `SELECT id, name FROM subject WHERE id != "FREE" ORDER BY id`)
+	if err != nil {
+		return catalog, err
+	}
+	catalog.Faculty, err = queryNamed(db, `SELECT id, name FROM faculty WHERE id != "FREE" ORDER BY id`)
+	return catalog, err
+}
+
+// SetSubject adds the subject or renames it
+func SetSubject(dsn string, id string, name string) error {
+	return setNamed(dsn, `INSERT INTO subject (id, name) VALUES (?, ?)
+    ON DUPLICATE KEY UPDATE name = VALUES(name)`, id, name)
+}
+
+// SetFaculty adds the faculty member or renames them
+func SetFaculty(dsn string, id string, name string) error {
+	return setNamed(dsn, `INSERT INTO faculty (id, name) VALUES (?, ?)
+    ON DUPLICATE KEY UPDATE name = VALUES(name)`, id, name)
+}
+
+func setNamed(dsn string, query string, id string, name string) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(query, id, name)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// States of a change request
+const (
+	ChangePending  = "pending"
+	ChangeApproved = "approved"
+	ChangeRejected = "rejected"
+)
+
+/*
+ChangeRequest is a faculty member asking for one of their periods to move for
+good, to another slot, day or room. When the new place holds another period the
+two are swapped. Nothing changes until an admin approves it.
+*/
+type ChangeRequest struct {
+	ID      int64  `json:"id"`
+	Faculty string `json:"faculty"`
+	Class   string `json:"class"`
+	Day     string `json:"day"`
+	Slot    int    `json:"slot"`
+	// Where the period should go
+	NewClass  string    `json:"newClass"`
+	NewDay    string    `json:"newDay"`
+	NewSlot   int       `json:"newSlot"`
+	Reason    string    `json:"reason,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Set once an admin decided
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+	Note      string     `json:"note,omitempty"`
+}
+
+func CreateChangeRequest(dsn string, change ChangeRequest) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO change_request (faculty_id, class_id, day,
+    slot_id, new_class_id, new_day, new_slot_id, reason, status, created_at) VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, change.Faculty, change.Class, change.Day, change.Slot,
+		change.NewClass, change.NewDay, change.NewSlot, change.Reason, ChangePending, change.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+/*
+DecideChangeRequest approves or rejects a pending request. sql.ErrNoRows means
+there is no such request or it was already decided.
+*/
+func DecideChangeRequest(dsn string, id int64, status string, by string, note string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE change_request SET status = ?, decided_by = ?,
+    decided_at = ?, note = ? WHERE id = ? AND status = ?`, status, by, at, note, id, ChangePending)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetChangeRequests lists the requests of faculty in status, newest first; empty arguments match everything
+func GetChangeRequests(dsn string, faculty string, status string) ([]ChangeRequest, error) {
+	var changes []ChangeRequest
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"faculty_id = ?", "status = ?"}, []interface{}{faculty, status})
+	rows, err := db.Query(`SELECT id, faculty_id, class_id, day, slot_id, new_class_id,
+    new_day, new_slot_id, reason, status, created_at, COALESCE(decided_by, ''),
+    decided_at, note FROM change_request`+clause+` ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp ChangeRequest
+		var decidedAt sql.NullTime
+		err := rows.Scan(&tmp.ID, &tmp.Faculty, &tmp.Class, &tmp.Day, &tmp.Slot, &tmp.NewClass,
+			&tmp.NewDay, &tmp.NewSlot, &tmp.Reason, &tmp.Status, &tmp.CreatedAt, &tmp.DecidedBy,
+			&decidedAt, &tmp.Note)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.DecidedAt = nullTimePtr(decidedAt)
+		changes = append(changes, tmp)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+/*
+A CheckIn belongs to the booking of Class, Date and Slot. Token is what its QR
+code carries; CheckedInAt is set once the code was scanned at the room. It goes
+away with the booking.
+*/
+type CheckIn struct {
+	Class       string     `json:"class"`
+	Date        time.Time  `json:"date"`
+	Slot        int        `json:"slot"`
+	Token       string     `json:"-"`
+	CheckedInAt *time.Time `json:"checkedInAt,omitempty"`
+}
+
+/*
+CreateCheckIn stores the token of a booking unless it has one already. It
+fails with sql.ErrNoRows when there is no such booking.
+*/
+func CreateCheckIn(dsn string, checkIn CheckIn) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT IGNORE INTO booking_checkin (class_id, date, slot_id, token)
+    VALUES (?, ?, ?, ?)`, checkIn.Class, checkIn.Date, checkIn.Slot, checkIn.Token)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errNoReferencedRow {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// MarkCheckedIn records the check-in of a booking; sql.ErrNoRows means it has no token
+func MarkCheckedIn(dsn string, class string, date time.Time, slot int, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE booking_checkin SET checked_in_at = COALESCE(checked_in_at, ?)
+    WHERE class_id = ? AND date = ? AND slot_id = ?`, at, class, date, slot)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetCheckIns lists the check-ins on date, of class when it is not empty
+func GetCheckIns(dsn string, class string, date time.Time) ([]CheckIn, error) {
+	var checkIns []CheckIn
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"class_id = ?", "date = ?"}, []interface{}{class, date})
+	rows, err := db.Query(`SELECT class_id, date, slot_id, token, checked_in_at FROM
+    booking_checkin`+clause+` ORDER BY slot_id, class_id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp CheckIn
+		var checkedInAt sql.NullTime
+		err := rows.Scan(&tmp.Class, &tmp.Date, &tmp.Slot, &tmp.Token, &checkedInAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.CheckedInAt = nullTimePtr(checkedInAt)
+		checkIns = append(checkIns, tmp)
+	}
+	return checkIns, rows.Err()
+}
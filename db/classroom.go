@@ -0,0 +1,65 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+)
+
+// What is known about a classroom beyond its timetable
+type Classroom struct {
+	ID       string `json:"id"`
+	Capacity int    `json:"capacity"`
+	Building string `json:"building"`
+	Floor    int    `json:"floor"`
+	// ID of the campus the classroom is on, empty for institutions with one
+	Campus string `json:"campus,omitempty"`
+}
+
+// GetClassrooms lists the classrooms with capacity data, by campus, building, floor and ID
+func GetClassrooms(dsn string) ([]Classroom, error) {
+	var classrooms []Classroom
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, capacity, building, floor, campus FROM classroom
+    ORDER BY campus, building, floor, id`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Classroom
+		err := rows.Scan(&tmp.ID, &tmp.Capacity, &tmp.Building, &tmp.Floor, &tmp.Campus)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		classrooms = append(classrooms, tmp)
+	}
+	return classrooms, rows.Err()
+}
+
+// SetClassroom adds the classroom or replaces what is known about it
+func SetClassroom(dsn string, classroom Classroom) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO classroom (id, capacity, building, floor, campus) VALUES
+    (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE capacity = VALUES(capacity),
+    building = VALUES(building), floor = VALUES(floor), campus = VALUES(campus)`,
+		classroom.ID, classroom.Capacity, classroom.Building, classroom.Floor, classroom.Campus)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+)
+
+/*
+A Club is a student organization that books rooms for its events. Its
+coordinators book on its behalf, and its faculty advisor approves what they
+book.
+*/
+type Club struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Advisor string `json:"advisor"`
+	// Mails, in order; coordinators are not repeated among the members
+	Coordinators []string `json:"coordinators"`
+	Members      []string `json:"members,omitempty"`
+}
+
+// GetClubs lists the clubs by ID with their rosters
+func GetClubs(dsn string) ([]Club, error) {
+	var clubs []Club
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, name, advisor_id FROM club ORDER BY id`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	byID := make(map[string]int)
+	for rows.Next() {
+		var tmp Club
+		err := rows.Scan(&tmp.ID, &tmp.Name, &tmp.Advisor)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.Coordinators = []string{}
+		byID[tmp.ID] = len(clubs)
+		clubs = append(clubs, tmp)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	members, err := db.Query(`SELECT club_id, mail, coordinator FROM club_member ORDER BY club_id, mail`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer members.Close()
+	for members.Next() {
+		var id, mail string
+		var coordinator bool
+		err := members.Scan(&id, &mail, &coordinator)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		idx, ok := byID[id]
+		if !ok {
+			continue
+		}
+		if coordinator {
+			clubs[idx].Coordinators = append(clubs[idx].Coordinators, mail)
+		} else {
+			clubs[idx].Members = append(clubs[idx].Members, mail)
+		}
+	}
+	return clubs, members.Err()
+}
+
+// SetClub adds club or replaces it, roster included
+func SetClub(dsn string, club Club) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO club (id, name, advisor_id) VALUES (?, ?, ?)
+    ON DUPLICATE KEY UPDATE name = VALUES(name), advisor_id = VALUES(advisor_id)`,
+		club.ID, club.Name, club.Advisor)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM club_member WHERE club_id = ?`, club.ID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, roster := range []struct {
+		mails       []string
+		coordinator bool
+	}{{club.Coordinators, true}, {club.Members, false}} {
+		for _, mail := range roster.mails {
+			_, err = tx.Exec(`INSERT INTO club_member (club_id, mail, coordinator) VALUES (?, ?, ?)`,
+				club.ID, mail, roster.coordinator)
+			if err != nil {
+				log.Println(err)
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteClub removes the club with its roster; its events stay
+func DeleteClub(dsn string, id string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM club_member WHERE club_id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	result, err := db.Exec(`DELETE FROM club WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
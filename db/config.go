@@ -0,0 +1,87 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// The database of the zero Store, see Configure
+var dataSourceName = "cora:@/cora?parseTime=true"
+
+// The read replica of the zero Store, if any
+var replicaSourceName string
+
+// A replica that does not answer within this long is taken for down
+const replicaDialTimeout = 2 * time.Second
+
+/*
+Config says how to reach the MySQL database. Empty fields keep the defaults:
+user cora without a password, the local server and database cora.
+*/
+type Config struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	// host:port, or the path of a unix socket
+	Addr string `json:"addr"`
+	Name string `json:"name"`
+	// Read replica for the timetable queries; its empty fields are the same as the primary's
+	Replica *Config `json:"replica"`
+}
+
+// Configure sets the database of the zero Store. It has to be called before the Store is used.
+func Configure(cfg Config) {
+	dataSourceName = formatDSN(cfg)
+	replicaSourceName = replicaDSN(cfg, dataSourceName)
+}
+
+// replicaDSN registers the replica of cfg, whose DSN is primary, and returns its DSN; "" without one
+func replicaDSN(cfg Config, primary string) string {
+	if cfg.Replica == nil {
+		return ""
+	}
+	replica := *cfg.Replica
+	replica.Replica = nil
+	if replica.User == "" {
+		replica.User = cfg.User
+	}
+	if replica.Password == "" {
+		replica.Password = cfg.Password
+	}
+	if replica.Addr == "" {
+		replica.Addr = cfg.Addr
+	}
+	if replica.Name == "" {
+		replica.Name = cfg.Name
+	}
+	dsn, err := mysql.ParseDSN(formatDSN(replica))
+	if err != nil {
+		return ""
+	}
+	dsn.Timeout = replicaDialTimeout
+	registerReplica(dsn.FormatDSN(), primary, replica.Addr)
+	return dsn.FormatDSN()
+}
+
+func formatDSN(cfg Config) string {
+	dsn := mysql.NewConfig()
+	dsn.User = "cora"
+	dsn.DBName = "cora"
+	dsn.ParseTime = true
+	if cfg.User != "" {
+		dsn.User = cfg.User
+	}
+	dsn.Passwd = cfg.Password
+	if cfg.Name != "" {
+		dsn.DBName = cfg.Name
+	}
+	if cfg.Addr != "" {
+		dsn.Net = "tcp"
+		if strings.HasPrefix(cfg.Addr, "/") {
+			dsn.Net = "unix"
+		}
+		dsn.Addr = cfg.Addr
+	}
+	return dsn.FormatDSN()
+}
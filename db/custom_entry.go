@@ -0,0 +1,89 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+A CustomEntry is something a user does every week outside the timetable, like
+the gym or a part-time job, which only they see alongside their periods
+*/
+type CustomEntry struct {
+	ID    int64  `json:"id"`
+	Mail  string `json:"-"`
+	Title string `json:"title"`
+	Day   string `json:"day"`
+	// Clock times like "17:30"
+	StartTime string    `json:"startTime"`
+	EndTime   string    `json:"endTime"`
+	Place     string    `json:"place,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GetCustomEntries lists the custom entries of mail by day and start time
+func GetCustomEntries(dsn string, mail string) ([]CustomEntry, error) {
+	var entries []CustomEntry
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, mail, title, day, TIME_FORMAT(start_time, '%H:%i'),
+    TIME_FORMAT(end_time, '%H:%i'), place, created_at FROM custom_entry WHERE mail = ?
+    ORDER BY FIELD(day, 'MON', 'TUE', 'WED', 'THU', 'FRI', 'SAT', 'SUN'), start_time, id`, mail)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp CustomEntry
+		err := rows.Scan(&tmp.ID, &tmp.Mail, &tmp.Title, &tmp.Day, &tmp.StartTime, &tmp.EndTime, &tmp.Place, &tmp.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		entries = append(entries, tmp)
+	}
+	return entries, rows.Err()
+}
+
+func CreateCustomEntry(dsn string, entry CustomEntry) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO custom_entry (mail, title, day, start_time, end_time, place, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?)`, entry.Mail, entry.Title, entry.Day, entry.StartTime, entry.EndTime,
+		entry.Place, entry.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// DeleteCustomEntry removes the entry with id if it is one of mail's
+func DeleteCustomEntry(dsn string, mail string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM custom_entry WHERE id = ? AND mail = ?`, id, mail)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
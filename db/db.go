@@ -3,16 +3,27 @@ package db
 import (
 	"database/sql"
 	"log"
-	"strings"
+	"sort"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/deebakkarthi/coraserver/calendar"
 )
 
-func GetFreeClass(slot int, date time.Time) []string {
+/*
+A lab is one static row spanning several slots, so a FREE row is only free when
+no earlier row of the same class and day reaches over it. This is that test
+for the static row s.
+*/
+const notCoveredByLab = `NOT EXISTS (SELECT 1 FROM static l WHERE
+    l.class_id=s.class_id AND l.day=s.day AND l.slot_id < s.slot_id AND
+    l.slot_id + l.span > s.slot_id AND l.subject_id != "FREE")`
+
+func GetFreeClass(dsn string, slot int, date time.Time) []string {
 	var classroom []string
-	day := strings.ToUpper(date.Weekday().String()[:3])
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+	day := calendar.DayCode(date.Weekday())
+	db, err := sql.Open(driverName, dsn)
 
 	if err != nil {
 		log.Fatal(err)
@@ -26,14 +37,13 @@ func GetFreeClass(slot int, date time.Time) []string {
         subject_id = "FREE" AND
         NOT EXISTS (SELECT 1 FROM dynamic WHERE
         slot_id=s.slot_id AND
-    date=? AND class_id=s.class_id)
-        `)
+    date=? AND class_id=s.class_id) AND ` + notCoveredByLab + ` AND ` + notBlocked)
 	if err != nil {
 		panic(err)
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(slot, day, date)
+	rows, err := stmt.Query(slot, day, date, date)
 	// Process the query results
 	for rows.Next() {
 		var tmp string
@@ -46,10 +56,10 @@ func GetFreeClass(slot int, date time.Time) []string {
 	return classroom
 }
 
-func GetFreeSlot(class string, date time.Time) []int {
+func GetFreeSlot(dsn string, class string, date time.Time) []int {
 	var slot []int
-	day := strings.ToUpper(date.Weekday().String()[:3])
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+	day := calendar.DayCode(date.Weekday())
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Println(err)
 		return slot
@@ -61,13 +71,14 @@ func GetFreeSlot(class string, date time.Time) []int {
         class_id = ? AND
         day = ? AND
         subject_id = "FREE" AND NOT EXISTS (SELECT 1 FROM dynamic WHERE
-        class_id=s.class_id AND date=? AND slot_id=s.slot_id)`)
+        class_id=s.class_id AND date=? AND slot_id=s.slot_id) AND ` + notCoveredByLab +
+			` AND ` + notBlocked)
 	if err != nil {
 		log.Println(err)
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(class, day, date)
+	rows, err := stmt.Query(class, day, date, date)
 	if err != nil {
 		log.Println(err)
 	}
@@ -83,10 +94,10 @@ func GetFreeSlot(class string, date time.Time) []int {
 	return slot
 }
 
-func MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
+func MultiFreeSlot(dsn string, startSlot int, endSlot int, date time.Time) []string {
 	var slot []string
-	day := strings.ToUpper(date.Weekday().String()[:3])
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+	day := calendar.DayCode(date.Weekday())
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Println(err)
 		return slot
@@ -97,7 +108,9 @@ func MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
     SELECT class_id FROM (SELECT class_id, COUNT(class_id) as num_free FROM
     static s WHERE slot_id BETWEEN ? AND ? AND subject_id="FREE" AND day=? AND
     NOT EXISTS (SELECT 1 FROM dynamic WHERE slot_id=s.slot_id AND date=? AND
-    class_id=s.class_id) GROUP BY class_id) as tmp WHERE num_free=(?-?)+1;
+    class_id=s.class_id) AND ` + notCoveredByLab + ` AND ` + notBlocked + `
+    GROUP BY class_id) as tmp
+    WHERE num_free=(?-?)+1;
     `)
 	/*
 	   SELECT class_id FROM (SELECT class_id, COUNT(class_id) as num_free FROM
@@ -111,7 +124,7 @@ func MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(startSlot, endSlot, day, date, endSlot, startSlot)
+	rows, err := stmt.Query(startSlot, endSlot, day, date, date, endSlot, startSlot)
 	if err != nil {
 		log.Println(err)
 	}
@@ -127,10 +140,33 @@ func MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
 	return slot
 }
 
-func GetTimetableByDay(class string, date time.Time) []string {
+// GetFreeRooms returns the classes free in every one of slots on every one of dates
+func GetFreeRooms(dsn string, slots []int, dates []time.Time) []string {
+	var classroom []string
+	if len(slots) == 0 || len(dates) == 0 {
+		return classroom
+	}
+	count := make(map[string]int)
+	for _, date := range dates {
+		for _, slot := range slots {
+			for _, class := range GetFreeClass(dsn, slot, date) {
+				count[class]++
+			}
+		}
+	}
+	for class, n := range count {
+		if n == len(slots)*len(dates) {
+			classroom = append(classroom, class)
+		}
+	}
+	sort.Strings(classroom)
+	return classroom
+}
+
+func GetTimetableByDay(dsn string, class string, date time.Time) []string {
 	var subject []string
-	day := strings.ToUpper(date.Weekday().String()[:3])
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+	day := calendar.DayCode(date.Weekday())
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -144,7 +180,10 @@ func GetTimetableByDay(class string, date time.Time) []string {
 	stmt, err := db.Prepare(`
     SELECT subject_id FROM
     (SELECT slot_id, subject_id FROM dynamic WHERE date=? AND class_id=? UNION
-    SELECT slot_id, subject_id FROM static WHERE day=? AND class_id=?) as tmp
+    SELECT s.slot_id, COALESCE((SELECT l.subject_id FROM static l WHERE
+    l.class_id=s.class_id AND l.day=s.day AND l.slot_id < s.slot_id AND
+    l.slot_id + l.span > s.slot_id AND l.subject_id != "FREE" LIMIT 1),
+    s.subject_id) FROM static s WHERE day=? AND class_id=?) as tmp
     GROUP BY slot_id;
     `)
 	if err != nil {
@@ -165,9 +204,9 @@ func GetTimetableByDay(class string, date time.Time) []string {
 	return subject
 }
 
-func GetAllSlot() []int {
+func GetAllSlot(dsn string) []int {
 	var slot []int
-	db, err := sql.Open("mysql", "cora:@/cora")
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -192,9 +231,9 @@ func GetAllSlot() []int {
 	return slot
 }
 
-func GetAllClass() []string {
+func GetAllClass(dsn string) []string {
 	var class []string
-	db, err := sql.Open("mysql", "cora:@/cora")
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -219,9 +258,26 @@ func GetAllClass() []string {
 	return class
 }
 
-func GetAllSubject() []string {
+// ClassExists tells whether the weekly timetable has class
+func ClassExists(dsn string, class string) (bool, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	defer db.Close()
+
+	var exists bool
+	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM static WHERE class_id = ?)`, class).Scan(&exists)
+	if err != nil {
+		log.Println(err)
+	}
+	return exists, err
+}
+
+func GetAllSubject(dsn string) []string {
 	var subject []string
-	db, err := sql.Open("mysql", "cora:@/cora")
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -252,10 +308,12 @@ type BookingRecord struct {
 	Slot    int       `json:"slot"`
 	Faculty string    `json:"faculty"`
 	Subject string    `json:"subject"`
+	// Goes up with every change, see UpdateBooking
+	Version int `json:"version"`
 }
 
-func CancelBooking(class string, date time.Time, slot int) error {
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+func CancelBooking(dsn string, class string, date time.Time, slot int) error {
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Println(err)
 		return nil
@@ -275,15 +333,83 @@ func CancelBooking(class string, date time.Time, slot int) error {
 	return nil
 }
 
-func GetBooking(faculty string) []BookingRecord {
+/*
+CancelBookingVersion cancels the booking of class in slot on date only while
+it is at version. ErrStaleVersion means it changed or is gone since.
+*/
+func CancelBookingVersion(dsn string, class string, date time.Time, slot int, version int) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM dynamic WHERE class_id = ? AND date = ? AND
+    slot_id = ? AND version = ?`, class, date, slot, version)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrStaleVersion
+	}
+	return nil
+}
+
+/*
+UpdateBooking changes the faculty and subject of the booking in the class, date
+and slot of booking, only while it is at its Version when that is set.
+sql.ErrNoRows means there is no such booking, ErrStaleVersion that it is no
+longer at the Version given.
+*/
+func UpdateBooking(dsn string, booking BookingRecord) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	query := `UPDATE dynamic SET faculty_id = ?, subject_id = ?, version = version + 1
+    WHERE class_id = ? AND date = ? AND slot_id = ?`
+	args := []interface{}{booking.Faculty, booking.Subject, booking.Class, booking.Date, booking.Slot}
+	if booking.Version != 0 {
+		query += ` AND version = ?`
+		args = append(args, booking.Version)
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	// The version always changes, so nothing affected means no booking or another version
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+		return nil
+	}
+	var exists bool
+	err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM dynamic WHERE class_id = ? AND
+    date = ? AND slot_id = ?)`, booking.Class, booking.Date, booking.Slot).Scan(&exists)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return ErrStaleVersion
+}
+
+func GetBooking(dsn string, faculty string) []BookingRecord {
 	var booking []BookingRecord
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Println(err)
 		return nil
 	}
 	defer db.Close()
-	stmt, err := db.Prepare(`SELECT * FROM dynamic WHERE faculty_id=?`)
+	stmt, err := db.Prepare(`SELECT class_id, date, slot_id, faculty_id, subject_id, version
+    FROM dynamic WHERE faculty_id=?`)
 	if err != nil {
 		log.Println(err)
 		return nil
@@ -292,7 +418,7 @@ func GetBooking(faculty string) []BookingRecord {
 	rows, err := stmt.Query(faculty)
 	for rows.Next() {
 		var tmp BookingRecord
-		err := rows.Scan(&tmp.Class, &tmp.Date, &tmp.Slot, &tmp.Faculty, &tmp.Subject)
+		err := rows.Scan(&tmp.Class, &tmp.Date, &tmp.Slot, &tmp.Faculty, &tmp.Subject, &tmp.Version)
 		if err != nil {
 			panic(err)
 		}
@@ -301,32 +427,35 @@ func GetBooking(faculty string) []BookingRecord {
 	return booking
 }
 
-func Booking(class string, date time.Time, slot int, faculty string, subject string) (int64, error) {
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+func Booking(dsn string, class string, date time.Time, slot int, faculty string, subject string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Println(err)
 		return 0, err
 	}
 	defer db.Close()
 
-	day := strings.ToUpper(date.Weekday().String()[:3])
+	day := calendar.DayCode(date.Weekday())
 
 	/*
-	   INSERT INTO dynamic SELECT "A104", "2023-06-13", 1,
+	   INSERT INTO dynamic (class_id, date, slot_id, faculty_id, subject_id) SELECT "A104", "2023-06-13", 1,
 	   "cb.en.u4cse20613@cb.students.amrita.edu", "19CSE311" FROM dual WHERE
-	   (SELECT subject_id FROM static WHERE class_id="A104" AND slot_id=1 AND
-	   day="TUE")="FREE";
+	   EXISTS (SELECT 1 FROM static s WHERE s.class_id="A104" AND s.slot_id=1 AND
+	   s.day="TUE" AND s.subject_id="FREE" AND <not in a lab>);
 	*/
-	stmt, err := db.Prepare(`INSERT INTO dynamic SELECT ?, ?, ?, ?, ? FROM
-    dual WHERE (SELECT subject_id FROM static WHERE class_id = ? AND day = ?
-    AND slot_id = ?)="FREE";`)
+	stmt, err := db.Prepare(`INSERT INTO dynamic (class_id, date, slot_id, faculty_id, subject_id)
+    SELECT ?, ?, ?, ?, ? FROM
+    dual WHERE EXISTS (SELECT 1 FROM static s WHERE s.class_id = ? AND s.day = ?
+    AND s.slot_id = ? AND s.subject_id = "FREE" AND ` + notCoveredByLab + `)
+    AND NOT EXISTS (SELECT 1 FROM room_block WHERE class_id = ? AND ? BETWEEN
+    start_date AND end_date);`)
 
 	if err != nil {
 		log.Println(err)
 		return 0, err
 	}
 	defer stmt.Close()
-	result, err := stmt.Exec(class, date, slot, faculty, subject, class, day, slot)
+	result, err := stmt.Exec(class, date, slot, faculty, subject, class, day, slot, class, date)
 	if err != nil {
 		log.Println(err)
 		return 0, err
@@ -335,26 +464,29 @@ func Booking(class string, date time.Time, slot int, faculty string, subject str
 	return rowsAffected, nil
 }
 
-func MultiBooking(class string, date time.Time, startSlot int, endSlot int, faculty string, subject string) (int64, error) {
+func MultiBooking(dsn string, class string, date time.Time, startSlot int, endSlot int, faculty string, subject string) (int64, error) {
 	var rowsAffected int64
-	db, err := sql.Open("mysql", "cora:@/cora?parseTime=true")
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		log.Println(err)
 		return 0, err
 	}
 	defer db.Close()
 
-	day := strings.ToUpper(date.Weekday().String()[:3])
-	stmt, err := db.Prepare(`INSERT INTO dynamic SELECT ?, ?, ?, ?, ? FROM
-    dual WHERE (SELECT subject_id FROM static WHERE class_id = ? AND day = ?
-    AND slot_id = ?)="FREE";`)
+	day := calendar.DayCode(date.Weekday())
+	stmt, err := db.Prepare(`INSERT INTO dynamic (class_id, date, slot_id, faculty_id, subject_id)
+    SELECT ?, ?, ?, ?, ? FROM
+    dual WHERE EXISTS (SELECT 1 FROM static s WHERE s.class_id = ? AND s.day = ?
+    AND s.slot_id = ? AND s.subject_id = "FREE" AND ` + notCoveredByLab + `)
+    AND NOT EXISTS (SELECT 1 FROM room_block WHERE class_id = ? AND ? BETWEEN
+    start_date AND end_date);`)
 	if err != nil {
 		log.Println(err)
 		return 0, err
 	}
 	defer stmt.Close()
 	for slot := startSlot; slot <= endSlot; slot++ {
-		result, err := stmt.Exec(class, date, slot, faculty, subject, class, day, slot)
+		result, err := stmt.Exec(class, date, slot, faculty, subject, class, day, slot, class, date)
 		if err != nil {
 			log.Println(err)
 			return rowsAffected, err
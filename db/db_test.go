@@ -3,10 +3,11 @@ package db
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestGetAllSlot(t *testing.T) {
-	result := GetAllSlot()
+	result := GetAllSlot(dataSourceName)
 	correct := []int{1, 2, 3, 4, 5, 6, 7, 8}
 	passed := true
 	for idx, val := range result {
@@ -23,10 +24,32 @@ func TestGetAllSlot(t *testing.T) {
 }
 
 func TestGetFreeClass(t *testing.T) {
-	result := GetFreeClass(8, "THU")
+	// 2023-06-15 is a Thursday
+	result := GetFreeClass(dataSourceName, 8, time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC))
 	if len(result) == 0 {
 		fmt.Println("PASS")
 	} else {
 		t.Errorf(`GetFreeClass(8, "THU") = %v; want nil`, result)
 	}
 }
+
+func TestBookingInLab(t *testing.T) {
+	// 2023-06-13 is a Tuesday; the lab in slot 1 reaches over slot 2
+	tuesday := time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC)
+	for _, entry := range []StaticEntry{
+		{Class: "LAB-TEST", Day: "TUE", Slot: 1, Subject: "19CSE311", Span: 2},
+		{Class: "LAB-TEST", Day: "TUE", Slot: 2, Subject: "FREE"},
+	} {
+		if err := SetStatic(dataSourceName, entry); err != nil {
+			t.Fatal(err)
+		}
+		defer DeleteStatic(dataSourceName, entry.Class, entry.Day, entry.Slot)
+	}
+	faculty := "pn_kumar@cb.amrita.edu"
+	if inserted, err := Booking(dataSourceName, "LAB-TEST", tuesday, 2, faculty, "19CSE312"); err != nil || inserted != 0 {
+		t.Errorf("Booking(slot 2) = %d, %v; want 0 under the lab", inserted, err)
+	}
+	if inserted, err := MultiBooking(dataSourceName, "LAB-TEST", tuesday, 2, 2, faculty, "19CSE312"); err != nil || inserted != 0 {
+		t.Errorf("MultiBooking(2-2) = %d, %v; want 0 under the lab", inserted, err)
+	}
+}
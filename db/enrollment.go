@@ -0,0 +1,100 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+)
+
+/*
+An Enrollment allocates a student to an elective. Once an elective has
+enrollments, only the students enrolled in it attend its periods.
+*/
+type Enrollment struct {
+	Subject string `json:"subject"`
+	Student string `json:"student"`
+}
+
+// Zero fields match everything
+type EnrollmentFilter struct {
+	Subject string
+	Student string
+}
+
+func GetEnrollments(dsn string, filter EnrollmentFilter) ([]Enrollment, error) {
+	var enrollments []Enrollment
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"subject_id = ?", "mail = ?"}, []interface{}{filter.Subject, filter.Student})
+	rows, err := db.Query(`SELECT subject_id, mail FROM enrollment`+clause+` ORDER BY subject_id, mail`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Enrollment
+		err := rows.Scan(&tmp.Subject, &tmp.Student)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		enrollments = append(enrollments, tmp)
+	}
+	return enrollments, rows.Err()
+}
+
+// SetEnrollments replaces the enrollments of every subject in subjects with the ones of enrollments, all or none
+func SetEnrollments(dsn string, subjects []string, enrollments []Enrollment) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	for _, subject := range subjects {
+		_, err = tx.Exec(`DELETE FROM enrollment WHERE subject_id = ?`, subject)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	for _, enrollment := range enrollments {
+		_, err = tx.Exec(`INSERT IGNORE INTO enrollment (subject_id, mail) VALUES (?, ?)`,
+			enrollment.Subject, enrollment.Student)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteEnrollments removes the enrollments of subject, which all students attend again
+func DeleteEnrollments(dsn string, subject string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM enrollment WHERE subject_id = ?`, subject)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// A movable piece of equipment, like a projector, microphone or lab kit
+type Equipment struct {
+	// Asset tag, like "PROJ-01"
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Room it is kept in, if any
+	Home string `json:"home,omitempty"`
+}
+
+/*
+EquipmentReservation holds a piece of equipment for a booking. It belongs to
+the booking of Class, Date and Slot and goes away when that is cancelled.
+*/
+type EquipmentReservation struct {
+	Equipment string    `json:"equipment"`
+	Class     string    `json:"class"`
+	Date      time.Time `json:"date"`
+	Slot      int       `json:"slot"`
+}
+
+// Returned by ReserveEquipment when the equipment is already reserved in that slot
+var ErrEquipmentReserved = errors.New("db: equipment is already reserved")
+
+// MySQL error numbers
+const (
+	errDuplicateEntry  = 1062
+	errNoReferencedRow = 1452
+)
+
+// SetEquipment adds the equipment to the inventory or replaces the one with its ID
+func SetEquipment(dsn string, equipment Equipment) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO equipment (id, name, kind, home_class_id) VALUES
+    (?, ?, ?, ?) ON DUPLICATE KEY UPDATE name = VALUES(name), kind = VALUES(kind),
+    home_class_id = VALUES(home_class_id)`, equipment.ID, equipment.Name, equipment.Kind,
+		nullString(equipment.Home))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteEquipment removes the equipment and its reservations
+func DeleteEquipment(dsn string, id string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM equipment WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+func GetEquipment(dsn string) ([]Equipment, error) {
+	var equipment []Equipment
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, name, kind, COALESCE(home_class_id, '') FROM
+    equipment ORDER BY kind, id`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Equipment
+		err := rows.Scan(&tmp.ID, &tmp.Name, &tmp.Kind, &tmp.Home)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		equipment = append(equipment, tmp)
+	}
+	return equipment, rows.Err()
+}
+
+/*
+ReserveEquipment stores all of reservations or none of them. It fails with
+ErrEquipmentReserved when one of them is taken and with sql.ErrNoRows when
+there is no booking to tie one to.
+*/
+func ReserveEquipment(dsn string, reservations []EquipmentReservation) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	for _, reservation := range reservations {
+		_, err = tx.Exec(`INSERT INTO equipment_reservation (equipment_id, class_id, date,
+        slot_id) VALUES (?, ?, ?, ?)`, reservation.Equipment, reservation.Class,
+			reservation.Date, reservation.Slot)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+			return ErrEquipmentReserved
+		}
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errNoReferencedRow {
+			return sql.ErrNoRows
+		}
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func ReleaseEquipment(dsn string, equipment string, date time.Time, slot int) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM equipment_reservation WHERE equipment_id = ?
+    AND date = ? AND slot_id = ?`, equipment, date, slot)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetEquipmentReservations lists the reservations on date, in slot when it is not 0
+func GetEquipmentReservations(dsn string, date time.Time, slot int) ([]EquipmentReservation, error) {
+	var reservations []EquipmentReservation
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"date = ?", "slot_id = ?"}, []interface{}{date, slot})
+	rows, err := db.Query(`SELECT equipment_id, class_id, date, slot_id FROM
+    equipment_reservation`+clause+` ORDER BY slot_id, equipment_id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp EquipmentReservation
+		err := rows.Scan(&tmp.Equipment, &tmp.Class, &tmp.Date, &tmp.Slot)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		reservations = append(reservations, tmp)
+	}
+	return reservations, rows.Err()
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// States of an erasure request
+const (
+	ErasurePending  = "pending"
+	ErasureApproved = "approved"
+	ErasureRejected = "rejected"
+)
+
+// An ErasureRequest is a user asking for their data to be deleted, which an admin has to approve first
+type ErasureRequest struct {
+	ID        int64     `json:"id"`
+	Mail      string    `json:"mail"`
+	Reason    string    `json:"reason,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Set once an admin decided
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+	Note      string     `json:"note,omitempty"`
+}
+
+/*
+The tables and columns EraseUser deletes the rows of a user from: what they
+set up in the app themselves. Timetables, bookings, attendance, assignments
+and the audit log are the institution's records and stay.
+*/
+var erasedColumns = [][2]string{
+	{"session", "mail"},
+	{"favorite", "mail"},
+	{"recent_view", "mail"},
+	{"preference", "mail"},
+	{"custom_entry", "mail"},
+	{"notification", "mail"},
+	{"sms", "mail"},
+	{"group_member", "mail"},
+	{"club_member", "mail"},
+	{"waitlist", "faculty_id"},
+	{"appointment", "student_id"},
+}
+
+func CreateErasureRequest(dsn string, request ErasureRequest) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO erasure_request (mail, reason, status, created_at) VALUES (?, ?, ?, ?)`,
+		request.Mail, request.Reason, ErasurePending, request.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetErasureRequests lists the requests of mail in status, newest first; empty arguments match everything
+func GetErasureRequests(dsn string, mail string, status string) ([]ErasureRequest, error) {
+	var requests []ErasureRequest
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"mail = ?", "status = ?"}, []interface{}{mail, status})
+	rows, err := db.Query(`SELECT id, mail, reason, status, created_at, decided_by, decided_at, note
+    FROM erasure_request`+clause+` ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp ErasureRequest
+		var decidedAt sql.NullTime
+		err := rows.Scan(&tmp.ID, &tmp.Mail, &tmp.Reason, &tmp.Status, &tmp.CreatedAt, &tmp.DecidedBy,
+			&decidedAt, &tmp.Note)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.DecidedAt = nullTimePtr(decidedAt)
+		requests = append(requests, tmp)
+	}
+	return requests, rows.Err()
+}
+
+/*
+DecideErasureRequest approves or rejects a pending request. sql.ErrNoRows
+means there is no such request or it was already decided.
+*/
+func DecideErasureRequest(dsn string, id int64, status string, by string, note string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE erasure_request SET status = ?, decided_by = ?, decided_at = ?, note = ?
+    WHERE id = ? AND status = ?`, status, by, at, note, id, ErasurePending)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+/*
+EraseUser deletes the data of mail in erasedColumns, their cached provider
+profiles and directory entries, and takes their mail off their feedback, all
+or nothing. It returns how many rows went.
+*/
+func EraseUser(dsn string, mail string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer tx.Rollback()
+	var erased int64
+	statements := []string{
+		`DELETE profile FROM profile JOIN users ON profile.provider = users.provider
+    AND profile.user_id = users.external_id WHERE users.mail = ?`,
+		`DELETE FROM users WHERE mail = ?`,
+		`UPDATE feedback SET mail = '' WHERE mail = ?`,
+	}
+	for _, column := range erasedColumns {
+		statements = append(statements, `DELETE FROM `+column[0]+` WHERE `+column[1]+` = ?`)
+	}
+	for _, statement := range statements {
+		result, err := tx.Exec(statement, mail)
+		if err != nil {
+			log.Println(err)
+			return 0, err
+		}
+		rowsAffected, _ := result.RowsAffected()
+		erased += rowsAffected
+	}
+	return erased, tx.Commit()
+}
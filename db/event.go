@@ -0,0 +1,157 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+An Event holds a room outside the slot grid, like a club meeting in the
+evening, from Start to End.
+*/
+type Event struct {
+	ID        int64  `json:"id"`
+	Class     string `json:"class"`
+	Title     string `json:"title"`
+	Organizer string `json:"organizer,omitempty"`
+	// The ID of the club it is booked on behalf of
+	Club      string    `json:"club,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Set while a club event waits for its advisor, it holds the room all the same
+	Pending bool `json:"pending,omitempty"`
+}
+
+// Zero fields match everything; Start and End select the events overlapping that window
+type EventFilter struct {
+	Class     string
+	CreatedBy string
+	Club      string
+	Start     time.Time
+	End       time.Time
+}
+
+// The start and end of a slot, like "08:00" and "08:50"
+type SlotTime struct {
+	ID    int    `json:"id"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+func GetSlotTimes(dsn string) ([]SlotTime, error) {
+	var slots []SlotTime
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, TIME_FORMAT(stime, '%H:%i'), TIME_FORMAT(etime, '%H:%i')
+    FROM slot ORDER BY id`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp SlotTime
+		err := rows.Scan(&tmp.ID, &tmp.Start, &tmp.End)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		slots = append(slots, tmp)
+	}
+	return slots, rows.Err()
+}
+
+// CreateEvent stores event and returns its ID
+func CreateEvent(dsn string, event Event) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO event (class_id, title, organizer, club_id, start_at,
+    end_at, created_by, created_at, pending) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, event.Class,
+		event.Title, event.Organizer, event.Club, event.Start, event.End, event.CreatedBy,
+		event.CreatedAt, event.Pending)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func DeleteEvent(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM event WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// ApproveEvent ends the wait of a pending event; no rows are affected when it was not pending
+func ApproveEvent(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE event SET pending = FALSE WHERE id = ? AND pending`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetEvents lists the events matching filter in start order
+func GetEvents(dsn string, filter EventFilter) ([]Event, error) {
+	var events []Event
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"class_id = ?", "created_by = ?", "club_id = ?", "end_at > ?", "start_at < ?"},
+		[]interface{}{filter.Class, filter.CreatedBy, filter.Club, filter.Start, filter.End})
+	rows, err := db.Query(`SELECT id, class_id, title, organizer, club_id, start_at, end_at,
+    created_by, created_at, pending FROM event`+clause+` ORDER BY start_at, class_id, id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Event
+		err := rows.Scan(&tmp.ID, &tmp.Class, &tmp.Title, &tmp.Organizer, &tmp.Club, &tmp.Start,
+			&tmp.End, &tmp.CreatedBy, &tmp.CreatedAt, &tmp.Pending)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		events = append(events, tmp)
+	}
+	return events, rows.Err()
+}
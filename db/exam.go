@@ -0,0 +1,227 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+/*
+ExamHall is one hall of an exam and the students seated in it, given as an
+inclusive range of roll numbers like CB.EN.U4CSE20001 to CB.EN.U4CSE20060.
+*/
+type ExamHall struct {
+	Class     string `json:"class"`
+	FirstRoll string `json:"firstRoll"`
+	LastRoll  string `json:"lastRoll"`
+}
+
+/*
+An Exam is held outside the weekly slot grid, so it carries its own times,
+"15:04" on Date at the institution.
+*/
+type Exam struct {
+	ID        int64      `json:"id"`
+	Subject   string     `json:"subject"`
+	Date      time.Time  `json:"date"`
+	StartTime string     `json:"startTime"`
+	EndTime   string     `json:"endTime"`
+	Halls     []ExamHall `json:"halls"`
+	// See StaticEntry.Version
+	Version int `json:"version"`
+}
+
+// Seats reports whether roll falls in the hall's range. Roll numbers compare as text.
+func (h ExamHall) Seats(roll string) bool {
+	roll = strings.ToUpper(roll)
+	return len(roll) == len(h.FirstRoll) && strings.ToUpper(h.FirstRoll) <= roll &&
+		roll <= strings.ToUpper(h.LastRoll)
+}
+
+// Hall returns the hall roll is seated in
+func (e Exam) Hall(roll string) (ExamHall, bool) {
+	for _, hall := range e.Halls {
+		if hall.Seats(roll) {
+			return hall, true
+		}
+	}
+	return ExamHall{}, false
+}
+
+func insertExamHalls(tx *sql.Tx, exam Exam) error {
+	for _, hall := range exam.Halls {
+		_, err := tx.Exec(`INSERT INTO exam_hall (exam_id, class_id, first_roll,
+    last_roll) VALUES (?, ?, ?, ?)`, exam.ID, hall.Class, hall.FirstRoll, hall.LastRoll)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertExam(tx *sql.Tx, exam Exam) (int64, error) {
+	result, err := tx.Exec(`INSERT INTO exam (subject_id, date, start_time, end_time)
+    VALUES (?, ?, ?, ?)`, exam.Subject, exam.Date, exam.StartTime, exam.EndTime)
+	if err != nil {
+		return 0, err
+	}
+	exam.ID, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return exam.ID, insertExamHalls(tx, exam)
+}
+
+// CreateExams stores all of exams or none of them and returns their IDs
+func CreateExams(dsn string, exams []Exam) ([]int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer tx.Rollback()
+	ids := make([]int64, 0, len(exams))
+	for _, exam := range exams {
+		id, err := insertExam(tx, exam)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, tx.Commit()
+}
+
+/*
+UpdateExam replaces the exam and its halls. sql.ErrNoRows means there is no
+such exam, ErrStaleVersion that it is no longer at the Version given.
+*/
+func UpdateExam(dsn string, exam Exam) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	err = tx.QueryRow(`SELECT version FROM exam WHERE id = ? FOR UPDATE`, exam.ID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if exam.Version != 0 && exam.Version != version {
+		return ErrStaleVersion
+	}
+	_, err = tx.Exec(`UPDATE exam SET subject_id = ?, date = ?, start_time = ?,
+    end_time = ?, version = version + 1 WHERE id = ?`, exam.Subject, exam.Date, exam.StartTime, exam.EndTime, exam.ID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM exam_hall WHERE exam_id = ?`, exam.ID)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = insertExamHalls(tx, exam)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func DeleteExam(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	// exam_hall rows go with ON DELETE CASCADE
+	result, err := db.Exec(`DELETE FROM exam WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetExams lists the exams from startDate to endDate inclusive in date and time order; zero dates leave that end open
+func GetExams(dsn string, startDate time.Time, endDate time.Time) ([]Exam, error) {
+	var exams []Exam
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"date >= ?", "date <= ?"}, []interface{}{startDate, endDate})
+	rows, err := db.Query(`SELECT id, subject_id, date, TIME_FORMAT(start_time, '%H:%i'),
+    TIME_FORMAT(end_time, '%H:%i'), version FROM exam`+clause+` ORDER BY date, start_time, id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	index := make(map[int64]int)
+	for rows.Next() {
+		var tmp Exam
+		err := rows.Scan(&tmp.ID, &tmp.Subject, &tmp.Date, &tmp.StartTime, &tmp.EndTime, &tmp.Version)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		index[tmp.ID] = len(exams)
+		exams = append(exams, tmp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(exams) == 0 {
+		return exams, nil
+	}
+
+	halls, err := db.Query(`SELECT exam_hall.exam_id, class_id, first_roll, last_roll
+    FROM exam_hall JOIN exam ON exam.id = exam_hall.exam_id`+clause+`
+    ORDER BY exam_hall.exam_id, first_roll`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer halls.Close()
+	for halls.Next() {
+		var id int64
+		var hall ExamHall
+		err := halls.Scan(&id, &hall.Class, &hall.FirstRoll, &hall.LastRoll)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if idx, ok := index[id]; ok {
+			exams[idx].Halls = append(exams[idx].Halls, hall)
+		}
+	}
+	return exams, halls.Err()
+}
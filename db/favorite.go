@@ -0,0 +1,141 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Kinds of favorites
+const (
+	FavoriteClassroom = "classroom"
+	FavoriteSection   = "section"
+)
+
+// A classroom or class section a user starred
+type Favorite struct {
+	Kind      string    `json:"kind"`
+	Target    string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AddFavorite stars the target for mail; starring it again changes nothing
+func AddFavorite(dsn string, mail string, favorite Favorite) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT IGNORE INTO favorite (mail, kind, target, created_at)
+    VALUES (?, ?, ?, ?)`, mail, favorite.Kind, favorite.Target, favorite.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func DeleteFavorite(dsn string, mail string, kind string, target string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM favorite WHERE mail = ? AND kind = ? AND
+    target = ?`, mail, kind, target)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetFavorites returns the favorites of mail, oldest first
+func GetFavorites(dsn string, mail string) ([]Favorite, error) {
+	var favorites []Favorite
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT kind, target, created_at FROM favorite WHERE
+    mail = ? ORDER BY created_at, kind, target`, mail)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Favorite
+		err := rows.Scan(&tmp.Kind, &tmp.Target, &tmp.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		favorites = append(favorites, tmp)
+	}
+	return favorites, rows.Err()
+}
+
+// GetFavoriteUsers returns who starred the target, like the students to tell about a change to a classroom
+func GetFavoriteUsers(dsn string, kind string, target string) ([]string, error) {
+	var mails []string
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT mail FROM favorite WHERE kind = ? AND target = ?
+    ORDER BY mail`, kind, target)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mail string
+		err := rows.Scan(&mail)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		mails = append(mails, mail)
+	}
+	return mails, rows.Err()
+}
+
+// GetFavoriteTargets returns everything of kind somebody starred, like the class sections in use
+func GetFavoriteTargets(dsn string, kind string) ([]string, error) {
+	var targets []string
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT DISTINCT target FROM favorite WHERE kind = ? ORDER BY target`, kind)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var target string
+		err := rows.Scan(&target)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, rows.Err()
+}
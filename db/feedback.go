@@ -0,0 +1,124 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// States of a feedback report
+const (
+	FeedbackOpen      = "open"
+	FeedbackResolved  = "resolved"
+	FeedbackDismissed = "dismissed"
+)
+
+/*
+Feedback is a report from a user of the app, like a period listed in the wrong
+room or a broken projector, for admins to triage. EntityKind and EntityID name
+what it is about when it is about something in particular, like classroom and
+A104. Mail is empty for anonymous reports.
+*/
+type Feedback struct {
+	ID         int64     `json:"id"`
+	Mail       string    `json:"mail,omitempty"`
+	Category   string    `json:"category"`
+	EntityKind string    `json:"entityKind,omitempty"`
+	EntityID   string    `json:"entityId,omitempty"`
+	Message    string    `json:"message"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// Set once an admin closed it
+	ClosedBy string     `json:"closedBy,omitempty"`
+	ClosedAt *time.Time `json:"closedAt,omitempty"`
+	Note     string     `json:"note,omitempty"`
+}
+
+// FeedbackFilter narrows down GetFeedback; empty fields match everything
+type FeedbackFilter struct {
+	Mail       string
+	Category   string
+	Status     string
+	EntityKind string
+	EntityID   string
+}
+
+func CreateFeedback(dsn string, feedback Feedback) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO feedback (mail, category, entity_kind, entity_id, message,
+    status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`, feedback.Mail, feedback.Category,
+		feedback.EntityKind, feedback.EntityID, feedback.Message, FeedbackOpen, feedback.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetFeedback lists the reports of filter, newest first
+func GetFeedback(dsn string, filter FeedbackFilter) ([]Feedback, error) {
+	var reports []Feedback
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"mail = ?", "category = ?", "status = ?", "entity_kind = ?", "entity_id = ?"},
+		[]interface{}{filter.Mail, filter.Category, filter.Status, filter.EntityKind, filter.EntityID})
+	rows, err := db.Query(`SELECT id, mail, category, entity_kind, entity_id, message, status,
+    created_at, closed_by, closed_at, note FROM feedback`+clause+` ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Feedback
+		var closedAt sql.NullTime
+		err := rows.Scan(&tmp.ID, &tmp.Mail, &tmp.Category, &tmp.EntityKind, &tmp.EntityID, &tmp.Message,
+			&tmp.Status, &tmp.CreatedAt, &tmp.ClosedBy, &closedAt, &tmp.Note)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.ClosedAt = nullTimePtr(closedAt)
+		reports = append(reports, tmp)
+	}
+	return reports, rows.Err()
+}
+
+/*
+CloseFeedback resolves or dismisses an open report. sql.ErrNoRows means there
+is no such report or it was already closed.
+*/
+func CloseFeedback(dsn string, id int64, status string, by string, note string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE feedback SET status = ?, closed_by = ?, closed_at = ?, note = ?
+    WHERE id = ? AND status = ?`, status, by, at, note, id, FeedbackOpen)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+A GroupMember is a user of a provider's directory put in a class section, or
+given a role, by the groups they are in. Only the last sync of the provider's
+groups is kept.
+*/
+type GroupMember struct {
+	Provider string    `json:"provider"`
+	Mail     string    `json:"mail"`
+	Section  string    `json:"section,omitempty"`
+	Role     string    `json:"role,omitempty"`
+	SyncedAt time.Time `json:"syncedAt"`
+}
+
+// GroupMemberFilter narrows down GetGroupMembers; empty fields match everything
+type GroupMemberFilter struct {
+	Mail    string
+	Section string
+	Role    string
+}
+
+// ReplaceGroupMembers makes members the group members of provider, dropping the ones of the sync before
+func ReplaceGroupMembers(dsn string, provider string, members []GroupMember) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`DELETE FROM group_member WHERE provider = ?`, provider)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, member := range members {
+		_, err = tx.Exec(`INSERT INTO group_member (provider, mail, section, role,
+        synced_at) VALUES (?, ?, ?, ?, ?)`, provider, member.Mail, member.Section,
+			member.Role, member.SyncedAt)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetGroupMembers lists the members matching filter, by section and mail
+func GetGroupMembers(dsn string, filter GroupMemberFilter) ([]GroupMember, error) {
+	var members []GroupMember
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"mail = ?", "section = ?", "role = ?"},
+		[]interface{}{filter.Mail, filter.Section, filter.Role})
+	rows, err := db.Query(`SELECT provider, mail, section, role, synced_at
+    FROM group_member`+clause+` ORDER BY section, mail, provider`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp GroupMember
+		err := rows.Scan(&tmp.Provider, &tmp.Mail, &tmp.Section, &tmp.Role, &tmp.SyncedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		members = append(members, tmp)
+	}
+	return members, rows.Err()
+}
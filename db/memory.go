@@ -0,0 +1,2825 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+)
+
+/*
+Memory is a Repository that keeps everything in maps. It follows the MySQL
+queries closely enough for the handlers to be tested without a database; fill
+it with AddSlot, AddSubject, AddFaculty and AddStatic.
+*/
+type Memory struct {
+	mu       sync.Mutex
+	slots    map[int][2]string
+	subjects map[string]string
+	static   map[staticKey]string
+	faculty  map[staticKey]string
+	spans    map[staticKey]int
+	versions map[staticKey]int
+	people   map[string]string
+	bookings map[staticKey]BookingRecord
+	searches []SearchEvent
+	sessions map[string]Session
+	states   map[string]OAuthState
+	apiKeys  map[string]APIKey
+	keyOrder []string
+	notices  []Announcement
+	noticeID int64
+	audit    []AuditEvent
+	stars    map[string][]Favorite
+	views    []RecentView
+	prefs    map[string]string
+	exams    []Exam
+	examID   int64
+	rooms    map[string]Classroom
+	changes  map[staticKey]Override
+	requests []ChangeRequest
+	blocks   []Block
+	blockID  int64
+	events   []Event
+	eventID  int64
+	clubs    map[string]Club
+	kit      map[string]Equipment
+	// Keyed by equipment ID in place of the class
+	kitHolds map[staticKey]EquipmentReservation
+	waiting  []WaitlistEntry
+	waitID   int64
+	checkIns map[staticKey]CheckIn
+	// Keyed by the period, in roll order
+	attendance   map[staticKey][]AttendanceRecord
+	assignments  []Assignment
+	assignmentID int64
+	attachments  map[string]Attachment
+	campuses     map[string]Campus
+	buildings    map[string]Building
+	// Minutes by the buildings of the path, in order
+	paths map[[2]string]int
+	// Class by normalized alias
+	aliases map[string]string
+	// By section
+	teams map[string]TeamsChannel
+	// By faculty, in the order set
+	officeHours   map[string][]OfficeHour
+	appointments  []Appointment
+	appointmentID int64
+	trash         []TrashItem
+	trashID       int64
+	snapshots     []TimetableVersion
+	snapshotID    int64
+	profiles      map[[2]string]Profile
+	users         []User
+	deltas        map[string]string
+	groupMembers  []GroupMember
+	security      []SecurityEvent
+	// By subject, then student
+	enrollments   map[string]map[string]bool
+	customEntries []CustomEntry
+	customID      int64
+	notifications []Notification
+	notifyID      int64
+	texts         []Text
+	textID        int64
+	feedback      []Feedback
+	feedbackID    int64
+	erasures      []ErasureRequest
+	erasureID     int64
+	backups       []Backup
+}
+
+var _ Repository = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		slots:       make(map[int][2]string),
+		subjects:    make(map[string]string),
+		static:      make(map[staticKey]string),
+		faculty:     make(map[staticKey]string),
+		spans:       make(map[staticKey]int),
+		versions:    make(map[staticKey]int),
+		people:      make(map[string]string),
+		bookings:    make(map[staticKey]BookingRecord),
+		sessions:    make(map[string]Session),
+		states:      make(map[string]OAuthState),
+		apiKeys:     make(map[string]APIKey),
+		stars:       make(map[string][]Favorite),
+		prefs:       make(map[string]string),
+		rooms:       make(map[string]Classroom),
+		changes:     make(map[staticKey]Override),
+		kit:         make(map[string]Equipment),
+		kitHolds:    make(map[staticKey]EquipmentReservation),
+		checkIns:    make(map[staticKey]CheckIn),
+		attendance:  make(map[staticKey][]AttendanceRecord),
+		attachments: make(map[string]Attachment),
+		campuses:    make(map[string]Campus),
+		buildings:   make(map[string]Building),
+		paths:       make(map[[2]string]int),
+		aliases:     make(map[string]string),
+		teams:       make(map[string]TeamsChannel),
+		officeHours: make(map[string][]OfficeHour),
+		enrollments: make(map[string]map[string]bool),
+		clubs:       make(map[string]Club),
+		profiles:    make(map[[2]string]Profile),
+		deltas:      make(map[string]string),
+	}
+}
+
+// AddSlot adds a slot with its start and end time, like "08:00:00"
+func (m *Memory) AddSlot(id int, start string, end string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slots[id] = [2]string{start, end}
+}
+
+func (m *Memory) AddSubject(id string, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subjects[id] = name
+}
+
+// AddFaculty adds a faculty member by mail
+func (m *Memory) AddFaculty(id string, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.people[id] = name
+}
+
+// AddStatic puts subject (or "FREE") in the weekly timetable of class
+func (m *Memory) AddStatic(class string, day string, slot int, subject string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.static[staticKey{class: class, day: day, slot: slot}] = subject
+	m.versions[staticKey{class: class, day: day, slot: slot}]++
+	if _, ok := m.slots[slot]; !ok {
+		m.slots[slot] = [2]string{}
+	}
+	if _, ok := m.subjects[subject]; !ok && subject != "FREE" {
+		m.subjects[subject] = ""
+	}
+}
+
+// Searches returns the events passed to RecordSearch
+func (m *Memory) Searches() []SearchEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SearchEvent(nil), m.searches...)
+}
+
+func weekday(date time.Time) string {
+	return calendar.DayCode(date.Weekday())
+}
+
+// Bookings are per date, so bookingKey puts the date where static keys have the day
+func bookingKey(class string, date time.Time, slot int) staticKey {
+	return staticKey{class: class, day: date.Format("2006-01-02"), slot: slot}
+}
+
+/*
+coveringLab returns the subject of the lab reaching over slot from an earlier
+slot, "" when there is none. It must be called with mu held.
+*/
+func (m *Memory) coveringLab(class string, day string, slot int) string {
+	for start := slot - 1; start > 0; start-- {
+		key := staticKey{class: class, day: day, slot: start}
+		if span := m.spans[key]; start+span > slot && m.static[key] != "FREE" {
+			return m.static[key]
+		}
+	}
+	return ""
+}
+
+// free must be called with mu held
+func (m *Memory) free(class string, date time.Time, slot int) bool {
+	if m.static[staticKey{class: class, day: weekday(date), slot: slot}] != "FREE" ||
+		m.coveringLab(class, weekday(date), slot) != "" {
+		return false
+	}
+	for _, block := range m.blocks {
+		if block.Class == class && !date.Before(block.StartDate) && !date.After(block.EndDate) {
+			return false
+		}
+	}
+	_, booked := m.bookings[bookingKey(class, date, slot)]
+	return !booked
+}
+
+// classes must be called with mu held
+func (m *Memory) classes() []string {
+	seen := make(map[string]bool)
+	var classes []string
+	for key := range m.static {
+		if !seen[key.class] {
+			seen[key.class] = true
+			classes = append(classes, key.class)
+		}
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// slotIDs must be called with mu held
+func (m *Memory) slotIDs() []int {
+	var ids []int
+	for id := range m.slots {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func (m *Memory) GetFreeClass(slot int, date time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var classroom []string
+	for _, class := range m.classes() {
+		if m.free(class, date, slot) {
+			classroom = append(classroom, class)
+		}
+	}
+	return classroom
+}
+
+func (m *Memory) GetFreeSlot(class string, date time.Time) []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var slot []int
+	for _, id := range m.slotIDs() {
+		if m.free(class, date, id) {
+			slot = append(slot, id)
+		}
+	}
+	return slot
+}
+
+func (m *Memory) MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var classroom []string
+	for _, class := range m.classes() {
+		free := startSlot <= endSlot
+		for slot := startSlot; slot <= endSlot && free; slot++ {
+			free = m.free(class, date, slot)
+		}
+		if free {
+			classroom = append(classroom, class)
+		}
+	}
+	return classroom
+}
+
+func (m *Memory) GetFreeRooms(slots []int, dates []time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var classroom []string
+	for _, class := range m.classes() {
+		free := len(slots) > 0 && len(dates) > 0
+		for _, date := range dates {
+			for _, slot := range slots {
+				free = free && m.free(class, date, slot)
+			}
+		}
+		if free {
+			classroom = append(classroom, class)
+		}
+	}
+	return classroom
+}
+
+func (m *Memory) GetTimetableByDay(class string, date time.Time) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subject []string
+	for _, slot := range m.slotIDs() {
+		if booking, ok := m.bookings[bookingKey(class, date, slot)]; ok {
+			subject = append(subject, booking.Subject)
+		} else if s, ok := m.static[staticKey{class: class, day: weekday(date), slot: slot}]; ok {
+			if lab := m.coveringLab(class, weekday(date), slot); lab != "" {
+				s = lab
+			}
+			subject = append(subject, s)
+		}
+	}
+	return subject
+}
+
+func (m *Memory) GetAllSlot() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.slotIDs()
+}
+
+// Slots added without times are left out
+func (m *Memory) GetSlotTimes() ([]SlotTime, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var slots []SlotTime
+	for _, id := range m.slotIDs() {
+		times := m.slots[id]
+		if len(times[0]) >= 5 && len(times[1]) >= 5 {
+			slots = append(slots, SlotTime{ID: id, Start: times[0][:5], End: times[1][:5]})
+		}
+	}
+	return slots, nil
+}
+
+func (m *Memory) GetAllClass() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.classes()
+}
+
+func (m *Memory) ClassExists(class string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.static {
+		if key.class == class {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) GetAllSubject() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subject []string
+	for id := range m.subjects {
+		if id != "FREE" {
+			subject = append(subject, id)
+		}
+	}
+	sort.Strings(subject)
+	return subject
+}
+
+func (m *Memory) GetCatalog() (Catalog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	catalog := Catalog{Classes: m.classes()}
+	for id, name := range m.subjects {
+		if id != "FREE" {
+			catalog.Subjects = append(catalog.Subjects, Named{ID: id, Name: name})
+		}
+	}
+	for id, name := range m.people {
+		catalog.Faculty = append(catalog.Faculty, Named{ID: id, Name: name})
+	}
+	sort.Slice(catalog.Subjects, func(i, j int) bool { return catalog.Subjects[i].ID < catalog.Subjects[j].ID })
+	sort.Slice(catalog.Faculty, func(i, j int) bool { return catalog.Faculty[i].ID < catalog.Faculty[j].ID })
+	return catalog, nil
+}
+
+func (m *Memory) GetBooking(faculty string) []BookingRecord {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var booking []BookingRecord
+	for _, record := range m.bookings {
+		if record.Faculty == faculty {
+			booking = append(booking, record)
+		}
+	}
+	sort.Slice(booking, func(i, j int) bool {
+		a, b := booking[i], booking[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Slot != b.Slot {
+			return a.Slot < b.Slot
+		}
+		return a.Class < b.Class
+	})
+	return booking
+}
+
+// Returned by Booking for a period that is already booked, like the primary key violation in MySQL
+var ErrDuplicateBooking = errors.New("db: period is already booked")
+
+// booking must be called with mu held
+func (m *Memory) booking(class string, date time.Time, slot int, faculty string, subject string) (int64, error) {
+	if _, ok := m.bookings[bookingKey(class, date, slot)]; ok {
+		return 0, ErrDuplicateBooking
+	}
+	if !m.free(class, date, slot) {
+		return 0, nil
+	}
+	m.bookings[bookingKey(class, date, slot)] = BookingRecord{
+		Class:   class,
+		Date:    date,
+		Slot:    slot,
+		Faculty: faculty,
+		Subject: subject,
+		Version: 1,
+	}
+	return 1, nil
+}
+
+func (m *Memory) Booking(class string, date time.Time, slot int, faculty string, subject string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.booking(class, date, slot, faculty, subject)
+}
+
+func (m *Memory) MultiBooking(class string, date time.Time, startSlot int, endSlot int, faculty string, subject string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rowsAffected int64
+	for slot := startSlot; slot <= endSlot; slot++ {
+		tmp, err := m.booking(class, date, slot, faculty, subject)
+		if err != nil {
+			return rowsAffected, err
+		}
+		rowsAffected += tmp
+	}
+	return rowsAffected, nil
+}
+
+func (m *Memory) CancelBooking(class string, date time.Time, slot int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancelBooking(class, date, slot)
+	return nil
+}
+
+func (m *Memory) CancelBookingVersion(class string, date time.Time, slot int, version int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if booking, ok := m.bookings[bookingKey(class, date, slot)]; !ok || booking.Version != version {
+		return ErrStaleVersion
+	}
+	m.cancelBooking(class, date, slot)
+	return nil
+}
+
+func (m *Memory) UpdateBooking(booking BookingRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := bookingKey(booking.Class, booking.Date, booking.Slot)
+	current, ok := m.bookings[key]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if booking.Version != 0 && booking.Version != current.Version {
+		return ErrStaleVersion
+	}
+	current.Faculty = booking.Faculty
+	current.Subject = booking.Subject
+	current.Version++
+	m.bookings[key] = current
+	return nil
+}
+
+// cancelBooking must be called with mu held
+func (m *Memory) cancelBooking(class string, date time.Time, slot int) {
+	delete(m.bookings, bookingKey(class, date, slot))
+	delete(m.checkIns, bookingKey(class, date, slot))
+	for key, reservation := range m.kitHolds {
+		if reservation.Class == class && reservation.Date.Equal(date) && reservation.Slot == slot {
+			delete(m.kitHolds, key)
+		}
+	}
+}
+
+func (m *Memory) RecordSearch(event SearchEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.searches = append(m.searches, event)
+}
+
+func (m *Memory) GetSearchStats(startDate time.Time, endDate time.Time, limit int) (SearchStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var stats SearchStats
+	stats.StartDate = startDate.Format("2006-01-02")
+	stats.EndDate = endDate.Format("2006-01-02")
+
+	kinds := make(map[string]int)
+	rooms := make(map[string]int)
+	slots := make(map[string]int)
+	days := make(map[string]int)
+	to := endDate.AddDate(0, 0, 1)
+	for _, event := range m.searches {
+		if event.At.Before(startDate) || !event.At.Before(to) {
+			continue
+		}
+		stats.Total++
+		kinds[event.Kind]++
+		if event.Class != "" {
+			rooms[event.Class]++
+		}
+		if event.StartSlot != 0 {
+			end := event.EndSlot
+			if end == 0 {
+				end = event.StartSlot
+			}
+			for slot := event.StartSlot; slot <= end; slot++ {
+				if _, ok := m.slots[slot]; ok {
+					slots[strconv.Itoa(slot)]++
+				}
+			}
+		}
+		days[weekday(event.Date)]++
+	}
+	stats.Kinds = topCounts(kinds, limit)
+	stats.Rooms = topCounts(rooms, limit)
+	stats.Slots = topCounts(slots, limit)
+	stats.Days = topCounts(days, limit)
+	return stats, nil
+}
+
+// topCounts sorts like ORDER BY n DESC, with the key to break ties
+func topCounts(counts map[string]int, limit int) []SearchCount {
+	var result []SearchCount
+	for key, count := range counts {
+		result = append(result, SearchCount{Key: key, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+func (m *Memory) GetUtilization(startDate time.Time, endDate time.Time, limit int) (Utilization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	static := make(map[string]map[staticKey]bool)
+	spans := make(map[staticKey]int)
+	for key, subject := range m.static {
+		if static[key.day] == nil {
+			static[key.day] = make(map[staticKey]bool)
+		}
+		static[key.day][key] = subject != "FREE"
+		if m.spans[key] > 1 && subject != "FREE" {
+			spans[key] = m.spans[key]
+		}
+	}
+	coverSpans(static, spans)
+	booked := make(map[string]map[staticKey]bool)
+	for key, record := range m.bookings {
+		if record.Date.Before(startDate) || record.Date.After(endDate) {
+			continue
+		}
+		if booked[key.day] == nil {
+			booked[key.day] = make(map[staticKey]bool)
+		}
+		booked[key.day][staticKey{class: key.class, slot: key.slot}] = true
+	}
+	return buildUtilization(static, booked, m.slots, startDate, endDate, limit), nil
+}
+
+func (m *Memory) CreateSession(session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.LastActiveAt = session.CreatedAt
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *Memory) GetSession(id string) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return Session{}, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (m *Memory) GetUserSessions(mail string) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []Session
+	now := time.Now()
+	for _, session := range m.sessions {
+		if session.Mail == mail && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActiveAt.After(sessions[j].LastActiveAt)
+	})
+	return sessions, nil
+}
+
+func (m *Memory) DeleteSession(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *Memory) TouchSession(id string, ip string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, ok := m.sessions[id]; ok {
+		session.IP = ip
+		session.LastActiveAt = at
+		m.sessions[id] = session
+	}
+	return nil
+}
+
+func (m *Memory) DeleteExpiredSessions(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for id, session := range m.sessions {
+		if !session.ExpiresAt.After(before) {
+			delete(m.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *Memory) GetRefreshTokens() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tokens := make(map[string]string)
+	now := time.Now()
+	for id, session := range m.sessions {
+		if session.RefreshToken != "" && session.ExpiresAt.After(now) {
+			tokens[id] = session.RefreshToken
+		}
+	}
+	return tokens, nil
+}
+
+func (m *Memory) ReplaceRefreshToken(id string, old string, new string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok || session.RefreshToken != old {
+		return false, nil
+	}
+	session.RefreshToken = new
+	m.sessions[id] = session
+	return true, nil
+}
+
+func (m *Memory) SaveOAuthState(state OAuthState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.states[state.State] = state
+	return nil
+}
+
+func (m *Memory) TakeOAuthState(state string) (OAuthState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oauthState, ok := m.states[state]
+	if !ok {
+		return OAuthState{}, sql.ErrNoRows
+	}
+	delete(m.states, state)
+	if oauthState.CreatedAt.Before(time.Now().Add(-oauthStateLifetime)) {
+		return OAuthState{}, sql.ErrNoRows
+	}
+	return oauthState, nil
+}
+
+func (m *Memory) CreateAPIKey(key APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.apiKeys[key.ID]; ok {
+		return errors.New("db: duplicate API key id " + key.ID)
+	}
+	m.apiKeys[key.ID] = key
+	m.keyOrder = append(m.keyOrder, key.ID)
+	return nil
+}
+
+func (m *Memory) GetAPIKey(id string) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return APIKey{}, sql.ErrNoRows
+	}
+	return key, nil
+}
+
+func (m *Memory) GetAllAPIKey() ([]APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []APIKey
+	for _, id := range m.keyOrder {
+		keys = append(keys, m.apiKeys[id])
+	}
+	return keys, nil
+}
+
+func (m *Memory) RevokeAPIKey(id string, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.apiKeys[id]
+	if !ok || key.RevokedAt != nil {
+		return 0, nil
+	}
+	key.RevokedAt = &at
+	m.apiKeys[id] = key
+	return 1, nil
+}
+
+func (m *Memory) RotateAPIKey(id string, replacement APIKey, oldExpiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.apiKeys[id]
+	if !ok || !key.Active(replacement.CreatedAt) {
+		return sql.ErrNoRows
+	}
+	if key.ExpiresAt == nil || oldExpiresAt.Before(*key.ExpiresAt) {
+		key.ExpiresAt = &oldExpiresAt
+	}
+	m.apiKeys[id] = key
+	m.apiKeys[replacement.ID] = replacement
+	m.keyOrder = append(m.keyOrder, replacement.ID)
+	return nil
+}
+
+func (m *Memory) TouchAPIKey(id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key, ok := m.apiKeys[id]; ok {
+		key.LastUsedAt = &at
+		m.apiKeys[id] = key
+	}
+	return nil
+}
+
+func (m *Memory) GetStatic(filter TimetableFilter) ([]StaticEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	days := map[string]int{"MON": 0, "TUE": 1, "WED": 2, "THU": 3, "FRI": 4}
+	var entries []StaticEntry
+	for key, subject := range m.static {
+		entry := StaticEntry{Class: key.class, Day: key.day, Slot: key.slot,
+			Faculty: m.faculty[key], Subject: subject, Span: 1, Version: m.versions[key]}
+		if span, ok := m.spans[key]; ok {
+			entry.Span = span
+		}
+		if (filter.Class != "" && filter.Class != entry.Class) ||
+			(filter.Day != "" && filter.Day != entry.Day) ||
+			(filter.Slot != 0 && filter.Slot != entry.Slot) ||
+			(filter.Subject != "" && filter.Subject != entry.Subject) ||
+			(filter.Faculty != "" && filter.Faculty != entry.Faculty) ||
+			(filter.Campus != "" && filter.Campus != m.rooms[entry.Class].Campus) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Class != b.Class {
+			return a.Class < b.Class
+		}
+		if a.Day != b.Day {
+			return days[a.Day] < days[b.Day]
+		}
+		return a.Slot < b.Slot
+	})
+	return entries, nil
+}
+
+func (m *Memory) SetStatic(entry StaticEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := staticKey{class: entry.Class, day: entry.Day, slot: entry.Slot}
+	if _, ok := m.static[key]; entry.Version != 0 && (!ok || m.versions[key] != entry.Version) {
+		return ErrStaleVersion
+	}
+	m.versions[key]++
+	m.static[key] = entry.Subject
+	m.faculty[key] = entry.Faculty
+	delete(m.spans, key)
+	if entry.Span > 1 {
+		m.spans[key] = entry.Span
+	}
+	if _, ok := m.slots[entry.Slot]; !ok {
+		m.slots[entry.Slot] = [2]string{}
+	}
+	if _, ok := m.subjects[entry.Subject]; !ok && entry.Subject != "FREE" {
+		m.subjects[entry.Subject] = ""
+	}
+	return nil
+}
+
+func (m *Memory) DeleteStatic(class string, day string, slot int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := staticKey{class: class, day: day, slot: slot}
+	if _, ok := m.static[key]; !ok {
+		return 0, nil
+	}
+	delete(m.static, key)
+	delete(m.faculty, key)
+	delete(m.spans, key)
+	delete(m.versions, key)
+	return 1, nil
+}
+
+func (m *Memory) GetBookings(filter BookingFilter) ([]BookingRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var bookings []BookingRecord
+	for _, record := range m.bookings {
+		if (filter.Class != "" && filter.Class != record.Class) ||
+			(filter.Faculty != "" && filter.Faculty != record.Faculty) ||
+			(!filter.StartDate.IsZero() && record.Date.Before(filter.StartDate)) ||
+			(!filter.EndDate.IsZero() && record.Date.After(filter.EndDate)) {
+			continue
+		}
+		bookings = append(bookings, record)
+	}
+	sort.Slice(bookings, func(i, j int) bool {
+		a, b := bookings[i], bookings[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Slot != b.Slot {
+			return a.Slot < b.Slot
+		}
+		return a.Class < b.Class
+	})
+	return bookings, nil
+}
+
+func (m *Memory) GetActiveUsers(query string, limit int) ([]UserSummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	query = strings.ToLower(query)
+	users := make(map[string]*UserSummary)
+	now := time.Now()
+	for _, session := range m.sessions {
+		if !session.ExpiresAt.After(now) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(session.Mail), query) &&
+			!strings.Contains(strings.ToLower(session.Name), query) {
+			continue
+		}
+		user, ok := users[session.Mail]
+		if !ok {
+			user = &UserSummary{Mail: session.Mail}
+			users[session.Mail] = user
+		}
+		user.Sessions++
+		if session.Name > user.Name {
+			user.Name = session.Name
+		}
+		if session.LastActiveAt.After(user.LastActiveAt) {
+			user.LastActiveAt = session.LastActiveAt
+		}
+	}
+	var summaries []UserSummary
+	for _, user := range users {
+		summaries = append(summaries, *user)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].LastActiveAt.After(summaries[j].LastActiveAt)
+	})
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+	return summaries, nil
+}
+
+func (m *Memory) GetDashboardCounts(now time.Time) (DashboardCounts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var counts DashboardCounts
+	today := now.Format("2006-01-02")
+	for key := range m.bookings {
+		switch {
+		case key.day == today:
+			counts.BookingsToday++
+		case key.day > today:
+			counts.UpcomingBookings++
+		}
+	}
+	users := make(map[string]bool)
+	for _, session := range m.sessions {
+		if session.ExpiresAt.After(now) {
+			counts.ActiveSessions++
+			users[session.Mail] = true
+		}
+	}
+	counts.ActiveUsers = len(users)
+	for _, key := range m.apiKeys {
+		if key.Active(now) {
+			counts.ActiveAPIKeys++
+		}
+	}
+	for _, announcement := range m.notices {
+		if announcement.showing(now) {
+			counts.ActiveAnnouncements++
+		}
+	}
+	return counts, nil
+}
+
+func (m *Memory) CreateAnnouncement(announcement Announcement) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.noticeID++
+	announcement.ID = m.noticeID
+	announcement.Version = 1
+	m.notices = append(m.notices, announcement)
+	return announcement.ID, nil
+}
+
+func (m *Memory) UpdateAnnouncement(announcement Announcement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, existing := range m.notices {
+		if existing.ID == announcement.ID {
+			if announcement.Version != 0 && announcement.Version != existing.Version {
+				return ErrStaleVersion
+			}
+			announcement.CreatedAt = existing.CreatedAt
+			announcement.Version = existing.Version + 1
+			m.notices[idx] = announcement
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *Memory) DeleteAnnouncement(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, existing := range m.notices {
+		if existing.ID == id {
+			m.notices = append(m.notices[:idx], m.notices[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) GetAnnouncements(activeAt time.Time) ([]Announcement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var announcements []Announcement
+	for _, announcement := range m.notices {
+		if activeAt.IsZero() || announcement.showing(activeAt) {
+			announcements = append(announcements, announcement)
+		}
+	}
+	sort.SliceStable(announcements, func(i, j int) bool {
+		a, b := announcements[i], announcements[j]
+		if !a.StartsAt.Equal(b.StartsAt) {
+			return a.StartsAt.After(b.StartsAt)
+		}
+		return a.ID > b.ID
+	})
+	return announcements, nil
+}
+
+func (m *Memory) RecordAudit(event AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event.ID = 1
+	if len(m.audit) > 0 {
+		event.ID = m.audit[len(m.audit)-1].ID + 1
+	}
+	m.audit = append(m.audit, event)
+	return nil
+}
+
+func (m *Memory) GetAuditEvents(action string, limit int) ([]AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []AuditEvent
+	for idx := len(m.audit) - 1; idx >= 0 && len(events) < limit; idx-- {
+		if action == "" || m.audit[idx].Action == action {
+			events = append(events, m.audit[idx])
+		}
+	}
+	return events, nil
+}
+
+func (m *Memory) GetUserAuditEvents(mail string, limit int) ([]AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []AuditEvent
+	for idx := len(m.audit) - 1; idx >= 0 && len(events) < limit; idx-- {
+		if m.audit[idx].Actor == mail || m.audit[idx].Target == mail {
+			events = append(events, m.audit[idx])
+		}
+	}
+	return events, nil
+}
+
+func (m *Memory) AddFavorite(mail string, favorite Favorite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.stars[mail] {
+		if existing.Kind == favorite.Kind && existing.Target == favorite.Target {
+			return nil
+		}
+	}
+	m.stars[mail] = append(m.stars[mail], favorite)
+	return nil
+}
+
+func (m *Memory) DeleteFavorite(mail string, kind string, target string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, existing := range m.stars[mail] {
+		if existing.Kind == kind && existing.Target == target {
+			m.stars[mail] = append(m.stars[mail][:idx:idx], m.stars[mail][idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) GetFavorites(mail string) ([]Favorite, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Favorite(nil), m.stars[mail]...), nil
+}
+
+func (m *Memory) GetFavoriteUsers(kind string, target string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var mails []string
+	for mail, favorites := range m.stars {
+		for _, favorite := range favorites {
+			if favorite.Kind == kind && favorite.Target == target {
+				mails = append(mails, mail)
+			}
+		}
+	}
+	sort.Strings(mails)
+	return mails, nil
+}
+
+func (m *Memory) GetFavoriteTargets(kind string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var targets []string
+	seen := make(map[string]bool)
+	for _, favorites := range m.stars {
+		for _, favorite := range favorites {
+			if favorite.Kind == kind && !seen[favorite.Target] {
+				seen[favorite.Target] = true
+				targets = append(targets, favorite.Target)
+			}
+		}
+	}
+	sort.Strings(targets)
+	return targets, nil
+}
+
+func (m *Memory) RecordView(view RecentView) {
+	if view.At.IsZero() {
+		view.At = time.Now()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, existing := range m.views {
+		if existing.Mail == view.Mail && existing.Kind == view.Kind && existing.Class == view.Class &&
+			existing.StartSlot == view.StartSlot && existing.EndSlot == view.EndSlot {
+			m.views = append(m.views[:idx:idx], m.views[idx+1:]...)
+			break
+		}
+	}
+	m.views = append(m.views, view)
+}
+
+func (m *Memory) GetRecentViews(mail string, limit int) ([]RecentView, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var views []RecentView
+	for idx := len(m.views) - 1; idx >= 0 && len(views) < limit; idx-- {
+		if m.views[idx].Mail == mail {
+			views = append(views, m.views[idx])
+		}
+	}
+	return views, nil
+}
+
+func (m *Memory) GetPreferences(mail string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.prefs[mail]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return data, nil
+}
+
+func (m *Memory) GetAllPreferences() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefs := make(map[string]string)
+	for mail, data := range m.prefs {
+		prefs[mail] = data
+	}
+	return prefs, nil
+}
+
+func (m *Memory) SetPreferences(mail string, data string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prefs[mail] = data
+	return nil
+}
+
+func (m *Memory) CreateExams(exams []Exam) ([]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]int64, 0, len(exams))
+	for _, exam := range exams {
+		m.examID++
+		exam.ID = m.examID
+		exam.Version = 1
+		exam.Halls = append([]ExamHall(nil), exam.Halls...)
+		m.exams = append(m.exams, exam)
+		ids = append(ids, exam.ID)
+	}
+	return ids, nil
+}
+
+func (m *Memory) UpdateExam(exam Exam) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, existing := range m.exams {
+		if existing.ID == exam.ID {
+			if exam.Version != 0 && exam.Version != existing.Version {
+				return ErrStaleVersion
+			}
+			exam.Version = existing.Version + 1
+			exam.Halls = append([]ExamHall(nil), exam.Halls...)
+			m.exams[idx] = exam
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *Memory) DeleteExam(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, existing := range m.exams {
+		if existing.ID == id {
+			m.exams = append(m.exams[:idx:idx], m.exams[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) GetExams(startDate time.Time, endDate time.Time) ([]Exam, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var exams []Exam
+	for _, exam := range m.exams {
+		if (startDate.IsZero() || !exam.Date.Before(startDate)) && (endDate.IsZero() || !exam.Date.After(endDate)) {
+			exam.Halls = append([]ExamHall(nil), exam.Halls...)
+			sort.Slice(exam.Halls, func(i, j int) bool { return exam.Halls[i].FirstRoll < exam.Halls[j].FirstRoll })
+			exams = append(exams, exam)
+		}
+	}
+	sort.SliceStable(exams, func(i, j int) bool {
+		if !exams[i].Date.Equal(exams[j].Date) {
+			return exams[i].Date.Before(exams[j].Date)
+		}
+		return exams[i].StartTime < exams[j].StartTime
+	})
+	return exams, nil
+}
+
+func (m *Memory) GetClassrooms() ([]Classroom, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var classrooms []Classroom
+	for _, classroom := range m.rooms {
+		classrooms = append(classrooms, classroom)
+	}
+	sort.Slice(classrooms, func(i, j int) bool {
+		a, b := classrooms[i], classrooms[j]
+		if a.Campus != b.Campus {
+			return a.Campus < b.Campus
+		}
+		if a.Building != b.Building {
+			return a.Building < b.Building
+		}
+		if a.Floor != b.Floor {
+			return a.Floor < b.Floor
+		}
+		return a.ID < b.ID
+	})
+	return classrooms, nil
+}
+
+func (m *Memory) SetClassroom(classroom Classroom) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rooms[classroom.ID] = classroom
+	return nil
+}
+
+func (m *Memory) SetOverride(override Override) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changes[bookingKey(override.Class, override.Date, override.Slot)] = override
+	return nil
+}
+
+func (m *Memory) DeleteOverride(class string, date time.Time, slot int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := bookingKey(class, date, slot)
+	if _, ok := m.changes[key]; !ok {
+		return 0, nil
+	}
+	delete(m.changes, key)
+	return 1, nil
+}
+
+func (m *Memory) GetOverrides(date time.Time, class string) ([]Override, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var overrides []Override
+	for _, override := range m.changes {
+		if override.Date.Equal(date) && (class == "" || override.Class == class) {
+			overrides = append(overrides, override)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		if overrides[i].Class != overrides[j].Class {
+			return overrides[i].Class < overrides[j].Class
+		}
+		return overrides[i].Slot < overrides[j].Slot
+	})
+	return overrides, nil
+}
+
+func (m *Memory) CreateChangeRequest(change ChangeRequest) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change.ID = int64(len(m.requests) + 1)
+	change.Status = ChangePending
+	m.requests = append(m.requests, change)
+	return change.ID, nil
+}
+
+func (m *Memory) DecideChangeRequest(id int64, status string, by string, note string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.requests {
+		if m.requests[idx].ID == id && m.requests[idx].Status == ChangePending {
+			m.requests[idx].Status = status
+			m.requests[idx].DecidedBy = by
+			m.requests[idx].DecidedAt = &at
+			m.requests[idx].Note = note
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *Memory) GetChangeRequests(faculty string, status string) ([]ChangeRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var changes []ChangeRequest
+	for idx := len(m.requests) - 1; idx >= 0; idx-- {
+		change := m.requests[idx]
+		if (faculty == "" || change.Faculty == faculty) && (status == "" || change.Status == status) {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (m *Memory) CreateBlock(block Block) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blockID++
+	block.ID = m.blockID
+	m.blocks = append(m.blocks, block)
+	return block.ID, nil
+}
+
+func (m *Memory) DeleteBlock(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, block := range m.blocks {
+		if block.ID == id {
+			m.blocks = append(m.blocks[:idx:idx], m.blocks[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) GetBlocks(class string, startDate time.Time, endDate time.Time) ([]Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var blocks []Block
+	for _, block := range m.blocks {
+		if (class == "" || block.Class == class) && (startDate.IsZero() || !block.EndDate.Before(startDate)) &&
+			(endDate.IsZero() || !block.StartDate.After(endDate)) {
+			blocks = append(blocks, block)
+		}
+	}
+	sort.SliceStable(blocks, func(i, j int) bool { return blocks[i].StartDate.Before(blocks[j].StartDate) })
+	return blocks, nil
+}
+
+func (m *Memory) CreateEvent(event Event) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventID++
+	event.ID = m.eventID
+	m.events = append(m.events, event)
+	return event.ID, nil
+}
+
+func (m *Memory) DeleteEvent(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, event := range m.events {
+		if event.ID == id {
+			m.events = append(m.events[:idx:idx], m.events[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) ApproveEvent(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.events {
+		if m.events[idx].ID == id && m.events[idx].Pending {
+			m.events[idx].Pending = false
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) GetClubs() ([]Club, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var clubs []Club
+	for _, club := range m.clubs {
+		club.Coordinators = append([]string{}, club.Coordinators...)
+		club.Members = append([]string(nil), club.Members...)
+		clubs = append(clubs, club)
+	}
+	sort.Slice(clubs, func(i, j int) bool { return clubs[i].ID < clubs[j].ID })
+	return clubs, nil
+}
+
+func (m *Memory) SetClub(club Club) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clubs[club.ID] = club
+	return nil
+}
+
+func (m *Memory) DeleteClub(id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.clubs[id]; !ok {
+		return 0, nil
+	}
+	delete(m.clubs, id)
+	return 1, nil
+}
+
+func (m *Memory) GetEvents(filter EventFilter) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []Event
+	for _, event := range m.events {
+		if (filter.Class == "" || event.Class == filter.Class) &&
+			(filter.CreatedBy == "" || event.CreatedBy == filter.CreatedBy) &&
+			(filter.Club == "" || event.Club == filter.Club) &&
+			(filter.Start.IsZero() || event.End.After(filter.Start)) &&
+			(filter.End.IsZero() || event.Start.Before(filter.End)) {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Start.Before(events[j].Start) })
+	return events, nil
+}
+
+func (m *Memory) SetEquipment(equipment Equipment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kit[equipment.ID] = equipment
+	return nil
+}
+
+func (m *Memory) DeleteEquipment(id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.kit[id]; !ok {
+		return 0, nil
+	}
+	delete(m.kit, id)
+	for key := range m.kitHolds {
+		if key.class == id {
+			delete(m.kitHolds, key)
+		}
+	}
+	return 1, nil
+}
+
+func (m *Memory) GetEquipment() ([]Equipment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var equipment []Equipment
+	for _, item := range m.kit {
+		equipment = append(equipment, item)
+	}
+	sort.Slice(equipment, func(i, j int) bool {
+		if equipment[i].Kind != equipment[j].Kind {
+			return equipment[i].Kind < equipment[j].Kind
+		}
+		return equipment[i].ID < equipment[j].ID
+	})
+	return equipment, nil
+}
+
+func (m *Memory) ReserveEquipment(reservations []EquipmentReservation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, reservation := range reservations {
+		if _, ok := m.bookings[bookingKey(reservation.Class, reservation.Date, reservation.Slot)]; !ok {
+			return sql.ErrNoRows
+		}
+		key := bookingKey(reservation.Equipment, reservation.Date, reservation.Slot)
+		if _, ok := m.kitHolds[key]; ok {
+			return ErrEquipmentReserved
+		}
+		for _, earlier := range reservations[:idx] {
+			if bookingKey(earlier.Equipment, earlier.Date, earlier.Slot) == key {
+				return ErrEquipmentReserved
+			}
+		}
+	}
+	for _, reservation := range reservations {
+		m.kitHolds[bookingKey(reservation.Equipment, reservation.Date, reservation.Slot)] = reservation
+	}
+	return nil
+}
+
+func (m *Memory) ReleaseEquipment(equipment string, date time.Time, slot int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := bookingKey(equipment, date, slot)
+	if _, ok := m.kitHolds[key]; !ok {
+		return 0, nil
+	}
+	delete(m.kitHolds, key)
+	return 1, nil
+}
+
+func (m *Memory) GetEquipmentReservations(date time.Time, slot int) ([]EquipmentReservation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var reservations []EquipmentReservation
+	for _, reservation := range m.kitHolds {
+		if reservation.Date.Equal(date) && (slot == 0 || reservation.Slot == slot) {
+			reservations = append(reservations, reservation)
+		}
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		if reservations[i].Slot != reservations[j].Slot {
+			return reservations[i].Slot < reservations[j].Slot
+		}
+		return reservations[i].Equipment < reservations[j].Equipment
+	})
+	return reservations, nil
+}
+
+func (m *Memory) JoinWaitlist(entry WaitlistEntry) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waitID++
+	entry.ID = m.waitID
+	m.waiting = append(m.waiting, entry)
+	return entry.ID, nil
+}
+
+func (m *Memory) LeaveWaitlist(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, entry := range m.waiting {
+		if entry.ID == id {
+			m.waiting = append(m.waiting[:idx], m.waiting[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) GetWaitlist(filter WaitlistFilter) ([]WaitlistEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []WaitlistEntry
+	for _, entry := range m.waiting {
+		if (filter.Class != "" && filter.Class != entry.Class) ||
+			(!filter.Date.IsZero() && !filter.Date.Equal(entry.Date)) ||
+			(filter.Slot != 0 && filter.Slot != entry.Slot) ||
+			(filter.Faculty != "" && filter.Faculty != entry.Faculty) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (m *Memory) CreateCheckIn(checkIn CheckIn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := bookingKey(checkIn.Class, checkIn.Date, checkIn.Slot)
+	if _, ok := m.bookings[key]; !ok {
+		return sql.ErrNoRows
+	}
+	if _, ok := m.checkIns[key]; !ok {
+		m.checkIns[key] = checkIn
+	}
+	return nil
+}
+
+func (m *Memory) MarkCheckedIn(class string, date time.Time, slot int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := bookingKey(class, date, slot)
+	checkIn, ok := m.checkIns[key]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if checkIn.CheckedInAt == nil {
+		checkIn.CheckedInAt = &at
+		m.checkIns[key] = checkIn
+	}
+	return nil
+}
+
+func (m *Memory) GetCheckIns(class string, date time.Time) ([]CheckIn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var checkIns []CheckIn
+	for _, checkIn := range m.checkIns {
+		if (class == "" || class == checkIn.Class) && checkIn.Date.Equal(date) {
+			checkIns = append(checkIns, checkIn)
+		}
+	}
+	sort.Slice(checkIns, func(i, j int) bool {
+		if checkIns[i].Slot != checkIns[j].Slot {
+			return checkIns[i].Slot < checkIns[j].Slot
+		}
+		return checkIns[i].Class < checkIns[j].Class
+	})
+	return checkIns, nil
+}
+
+func (m *Memory) SetAttendance(class string, date time.Time, slot int, records []AttendanceRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := make([]AttendanceRecord, 0, len(records))
+	for _, record := range records {
+		record.Class, record.Date, record.Slot = class, date, slot
+		stored = append(stored, record)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].Roll < stored[j].Roll })
+	m.attendance[bookingKey(class, date, slot)] = stored
+	return nil
+}
+
+func (m *Memory) GetAttendance(filter AttendanceFilter) ([]AttendanceRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var records []AttendanceRecord
+	for _, period := range m.attendance {
+		for _, record := range period {
+			if (filter.Class != "" && filter.Class != record.Class) ||
+				(!filter.Date.IsZero() && !filter.Date.Equal(record.Date)) ||
+				(filter.Slot != 0 && filter.Slot != record.Slot) ||
+				(filter.Subject != "" && filter.Subject != record.Subject) ||
+				(filter.Roll != "" && filter.Roll != record.Roll) ||
+				(!filter.StartDate.IsZero() && record.Date.Before(filter.StartDate)) ||
+				(!filter.EndDate.IsZero() && record.Date.After(filter.EndDate)) {
+				continue
+			}
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Slot != b.Slot {
+			return a.Slot < b.Slot
+		}
+		if a.Class != b.Class {
+			return a.Class < b.Class
+		}
+		return a.Roll < b.Roll
+	})
+	return records, nil
+}
+
+func (m *Memory) CreateAssignment(assignment Assignment) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.assignmentID++
+	assignment.ID = m.assignmentID
+	m.assignments = append(m.assignments, assignment)
+	return assignment.ID, nil
+}
+
+func (m *Memory) UpdateAssignment(assignment Assignment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, stored := range m.assignments {
+		if stored.ID != assignment.ID {
+			continue
+		}
+		stored.Reminded = stored.Reminded && stored.Due.Equal(assignment.Due)
+		stored.Section, stored.Title, stored.Due, stored.Link = assignment.Section, assignment.Title, assignment.Due, assignment.Link
+		m.assignments[idx] = stored
+		return nil
+	}
+	return sql.ErrNoRows
+}
+
+func (m *Memory) DeleteAssignment(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, assignment := range m.assignments {
+		if assignment.ID == id {
+			m.assignments = append(m.assignments[:idx], m.assignments[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) MarkAssignmentReminded(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.assignments {
+		if m.assignments[idx].ID == id {
+			m.assignments[idx].Reminded = true
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetAssignments(filter AssignmentFilter) ([]Assignment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var assignments []Assignment
+	for _, assignment := range m.assignments {
+		if (filter.Subject != "" && filter.Subject != assignment.Subject) ||
+			(filter.CreatedBy != "" && filter.CreatedBy != assignment.CreatedBy) ||
+			(!filter.DueAfter.IsZero() && assignment.Due.Before(filter.DueAfter)) ||
+			(!filter.DueBefore.IsZero() && !assignment.Due.Before(filter.DueBefore)) ||
+			(filter.Unreminded && assignment.Reminded) {
+			continue
+		}
+		assignments = append(assignments, assignment)
+	}
+	sort.SliceStable(assignments, func(i, j int) bool { return assignments[i].Due.Before(assignments[j].Due) })
+	return assignments, nil
+}
+
+func (m *Memory) CreateAttachment(attachment Attachment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attachments[attachment.ID] = attachment
+	return nil
+}
+
+func (m *Memory) GetAttachment(id string) (Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attachment, ok := m.attachments[id]
+	if !ok {
+		return Attachment{}, sql.ErrNoRows
+	}
+	return attachment, nil
+}
+
+func (m *Memory) DeleteAttachment(id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.attachments[id]; !ok {
+		return 0, nil
+	}
+	delete(m.attachments, id)
+	return 1, nil
+}
+
+func (m *Memory) GetCampuses() ([]Campus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var campuses []Campus
+	for _, campus := range m.campuses {
+		campuses = append(campuses, campus)
+	}
+	sort.Slice(campuses, func(i, j int) bool { return campuses[i].ID < campuses[j].ID })
+	return campuses, nil
+}
+
+func (m *Memory) SetCampus(campus Campus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.campuses[campus.ID] = campus
+	return nil
+}
+
+func (m *Memory) DeleteCampus(id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.campuses[id]; !ok {
+		return 0, nil
+	}
+	for _, classroom := range m.rooms {
+		if classroom.Campus == id {
+			return 0, ErrCampusInUse
+		}
+	}
+	delete(m.campuses, id)
+	return 1, nil
+}
+
+func (m *Memory) GetBuildings() ([]Building, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var buildings []Building
+	for _, building := range m.buildings {
+		buildings = append(buildings, building)
+	}
+	sort.Slice(buildings, func(i, j int) bool { return buildings[i].ID < buildings[j].ID })
+	return buildings, nil
+}
+
+func (m *Memory) SetBuilding(building Building) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buildings[building.ID] = building
+	return nil
+}
+
+func (m *Memory) DeleteBuilding(id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.buildings[id]; !ok {
+		return 0, nil
+	}
+	for key := range m.paths {
+		if key[0] == id || key[1] == id {
+			delete(m.paths, key)
+		}
+	}
+	delete(m.buildings, id)
+	return 1, nil
+}
+
+func (m *Memory) GetBuildingPaths() ([]BuildingPath, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var paths []BuildingPath
+	for key, minutes := range m.paths {
+		paths = append(paths, BuildingPath{From: key[0], To: key[1], Minutes: minutes})
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if paths[i].From != paths[j].From {
+			return paths[i].From < paths[j].From
+		}
+		return paths[i].To < paths[j].To
+	})
+	return paths, nil
+}
+
+func (m *Memory) SetBuildingPath(path BuildingPath) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, to := pathKey(path.From, path.To)
+	m.paths[[2]string{from, to}] = path.Minutes
+	return nil
+}
+
+func (m *Memory) DeleteBuildingPath(from, to string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, to = pathKey(from, to)
+	if _, ok := m.paths[[2]string{from, to}]; !ok {
+		return 0, nil
+	}
+	delete(m.paths, [2]string{from, to})
+	return 1, nil
+}
+
+func (m *Memory) GetRoomAliases() ([]RoomAlias, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var aliases []RoomAlias
+	for alias, class := range m.aliases {
+		aliases = append(aliases, RoomAlias{Alias: alias, Class: class})
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		if aliases[i].Class != aliases[j].Class {
+			return aliases[i].Class < aliases[j].Class
+		}
+		return aliases[i].Alias < aliases[j].Alias
+	})
+	return aliases, nil
+}
+
+func (m *Memory) SetRoomAlias(alias RoomAlias) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aliases[NormalizeRoom(alias.Alias)] = alias.Class
+	return nil
+}
+
+func (m *Memory) DeleteRoomAlias(alias string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.aliases[NormalizeRoom(alias)]; !ok {
+		return 0, nil
+	}
+	delete(m.aliases, NormalizeRoom(alias))
+	return 1, nil
+}
+
+func (m *Memory) GetTeamsChannels() ([]TeamsChannel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var channels []TeamsChannel
+	for _, channel := range m.teams {
+		channel.Classes = append([]string(nil), channel.Classes...)
+		channels = append(channels, channel)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Section < channels[j].Section })
+	return channels, nil
+}
+
+func (m *Memory) SetTeamsChannel(channel TeamsChannel) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channel.Classes = append([]string(nil), channel.Classes...)
+	m.teams[channel.Section] = channel
+	return nil
+}
+
+func (m *Memory) DeleteTeamsChannel(section string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.teams[section]; !ok {
+		return 0, nil
+	}
+	delete(m.teams, section)
+	return 1, nil
+}
+
+func (m *Memory) GetEnrollments(filter EnrollmentFilter) ([]Enrollment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var enrollments []Enrollment
+	for subject, students := range m.enrollments {
+		for student := range students {
+			if (filter.Subject == "" || filter.Subject == subject) && (filter.Student == "" || filter.Student == student) {
+				enrollments = append(enrollments, Enrollment{Subject: subject, Student: student})
+			}
+		}
+	}
+	sort.Slice(enrollments, func(i, j int) bool {
+		if enrollments[i].Subject != enrollments[j].Subject {
+			return enrollments[i].Subject < enrollments[j].Subject
+		}
+		return enrollments[i].Student < enrollments[j].Student
+	})
+	return enrollments, nil
+}
+
+func (m *Memory) SetEnrollments(subjects []string, enrollments []Enrollment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, subject := range subjects {
+		delete(m.enrollments, subject)
+	}
+	for _, enrollment := range enrollments {
+		if m.enrollments[enrollment.Subject] == nil {
+			m.enrollments[enrollment.Subject] = make(map[string]bool)
+		}
+		m.enrollments[enrollment.Subject][enrollment.Student] = true
+	}
+	return nil
+}
+
+func (m *Memory) DeleteEnrollments(subject string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rowsAffected := int64(len(m.enrollments[subject]))
+	delete(m.enrollments, subject)
+	return rowsAffected, nil
+}
+
+func (m *Memory) GetCustomEntries(mail string) ([]CustomEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []CustomEntry
+	for _, entry := range m.customEntries {
+		if entry.Mail == mail {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, _ := calendar.ParseDay(entries[i].Day)
+		b, _ := calendar.ParseDay(entries[j].Day)
+		// Weeks start on Monday
+		a, b = (a+6)%7, (b+6)%7
+		if a != b {
+			return a < b
+		}
+		return entries[i].StartTime < entries[j].StartTime
+	})
+	return entries, nil
+}
+
+func (m *Memory) CreateCustomEntry(entry CustomEntry) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.customID++
+	entry.ID = m.customID
+	m.customEntries = append(m.customEntries, entry)
+	return entry.ID, nil
+}
+
+func (m *Memory) DeleteCustomEntry(mail string, id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, entry := range m.customEntries {
+		if entry.ID == id && entry.Mail == mail {
+			m.customEntries = append(m.customEntries[:idx], m.customEntries[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) AddNotification(notification Notification) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifyID++
+	notification.ID = m.notifyID
+	m.notifications = append(m.notifications, notification)
+	return notification.ID, nil
+}
+
+func (m *Memory) GetNotifications(mail string, unread bool, limit int) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var notifications []Notification
+	// Latest first
+	for idx := len(m.notifications) - 1; idx >= 0 && len(notifications) < limit; idx-- {
+		notification := m.notifications[idx]
+		if notification.Mail == mail && (!unread || notification.ReadAt == nil) {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications, nil
+}
+
+func (m *Memory) CountUnreadNotifications(mail string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, notification := range m.notifications {
+		if notification.Mail == mail && notification.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) MarkNotificationsRead(mail string, ids []int64, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rowsAffected int64
+	for idx, notification := range m.notifications {
+		if notification.Mail != mail || notification.ReadAt != nil {
+			continue
+		}
+		listed := len(ids) == 0
+		for _, id := range ids {
+			listed = listed || id == notification.ID
+		}
+		if !listed {
+			continue
+		}
+		readAt := at
+		m.notifications[idx].ReadAt = &readAt
+		rowsAffected++
+	}
+	return rowsAffected, nil
+}
+
+func (m *Memory) PurgeNotifications(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []Notification
+	for _, notification := range m.notifications {
+		if !notification.CreatedAt.Before(before) {
+			kept = append(kept, notification)
+		}
+	}
+	purged := int64(len(m.notifications) - len(kept))
+	m.notifications = kept
+	return purged, nil
+}
+
+func (m *Memory) AddText(text Text) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.textID++
+	text.ID = m.textID
+	m.texts = append(m.texts, text)
+	return text.ID, nil
+}
+
+func (m *Memory) UpdateText(id int64, providerID string, status string, errText string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.texts {
+		if m.texts[idx].ID == id {
+			m.texts[idx].ProviderID = providerID
+			m.texts[idx].Status = status
+			m.texts[idx].Error = errText
+			m.texts[idx].UpdatedAt = at
+		}
+	}
+	return nil
+}
+
+func (m *Memory) ClaimText(id int64, from string, to string, at time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.texts {
+		if m.texts[idx].ID == id && m.texts[idx].Status == from {
+			m.texts[idx].Status = to
+			m.texts[idx].UpdatedAt = at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) SetTextStatus(providerID string, status string, errText string, at time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rowsAffected int64
+	for idx := range m.texts {
+		if m.texts[idx].ProviderID == providerID {
+			m.texts[idx].Status = status
+			m.texts[idx].Error = errText
+			m.texts[idx].UpdatedAt = at
+			rowsAffected++
+		}
+	}
+	return rowsAffected, nil
+}
+
+func (m *Memory) GetTexts(filter TextFilter) ([]Text, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var texts []Text
+	// Latest first
+	for idx := len(m.texts) - 1; idx >= 0 && (filter.Limit == 0 || len(texts) < filter.Limit); idx-- {
+		text := m.texts[idx]
+		if (filter.Mail == "" || text.Mail == filter.Mail) && (filter.Status == "" || text.Status == filter.Status) {
+			texts = append(texts, text)
+		}
+	}
+	return texts, nil
+}
+
+func (m *Memory) CreateFeedback(feedback Feedback) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.feedbackID++
+	feedback.ID = m.feedbackID
+	feedback.Status = FeedbackOpen
+	m.feedback = append(m.feedback, feedback)
+	return feedback.ID, nil
+}
+
+func (m *Memory) GetFeedback(filter FeedbackFilter) ([]Feedback, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var reports []Feedback
+	for idx := len(m.feedback) - 1; idx >= 0; idx-- {
+		feedback := m.feedback[idx]
+		if (filter.Mail == "" || feedback.Mail == filter.Mail) &&
+			(filter.Category == "" || feedback.Category == filter.Category) &&
+			(filter.Status == "" || feedback.Status == filter.Status) &&
+			(filter.EntityKind == "" || feedback.EntityKind == filter.EntityKind) &&
+			(filter.EntityID == "" || feedback.EntityID == filter.EntityID) {
+			reports = append(reports, feedback)
+		}
+	}
+	return reports, nil
+}
+
+func (m *Memory) CloseFeedback(id int64, status string, by string, note string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.feedback {
+		if m.feedback[idx].ID == id && m.feedback[idx].Status == FeedbackOpen {
+			m.feedback[idx].Status = status
+			m.feedback[idx].ClosedBy = by
+			m.feedback[idx].ClosedAt = &at
+			m.feedback[idx].Note = note
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *Memory) GetOfficeHours(faculty string) ([]OfficeHour, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var hours []OfficeHour
+	for who, theirs := range m.officeHours {
+		if faculty == "" || faculty == who {
+			hours = append(hours, theirs...)
+		}
+	}
+	return hours, nil
+}
+
+func (m *Memory) SetOfficeHours(faculty string, hours []OfficeHour) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := make([]OfficeHour, len(hours))
+	for idx, hour := range hours {
+		hour.Faculty = faculty
+		stored[idx] = hour
+	}
+	m.officeHours[faculty] = stored
+	return nil
+}
+
+func (m *Memory) CreateAppointment(appointment Appointment) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.appointmentID++
+	appointment.ID = m.appointmentID
+	appointment.Status = AppointmentPending
+	m.appointments = append(m.appointments, appointment)
+	return appointment.ID, nil
+}
+
+func (m *Memory) DecideAppointment(id int64, status string, reply string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.appointments {
+		if m.appointments[idx].ID == id && m.appointments[idx].Status == AppointmentPending {
+			m.appointments[idx].Status = status
+			m.appointments[idx].Reply = reply
+			m.appointments[idx].DecidedAt = &at
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *Memory) GetAppointments(filter AppointmentFilter) ([]Appointment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var appointments []Appointment
+	for _, appointment := range m.appointments {
+		if (filter.Faculty != "" && filter.Faculty != appointment.Faculty) ||
+			(filter.Student != "" && filter.Student != appointment.Student) ||
+			(!filter.Date.IsZero() && !filter.Date.Equal(appointment.Date)) ||
+			(filter.Slot != 0 && filter.Slot != appointment.Slot) ||
+			(filter.Status != "" && filter.Status != appointment.Status) {
+			continue
+		}
+		appointments = append(appointments, appointment)
+	}
+	sort.SliceStable(appointments, func(i, j int) bool {
+		return appointments[i].Start.Before(appointments[j].Start)
+	})
+	return appointments, nil
+}
+
+func (m *Memory) AddTrash(item TrashItem) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trashID++
+	item.ID = m.trashID
+	m.trash = append(m.trash, item)
+	return item.ID, nil
+}
+
+func (m *Memory) GetTrash(kind string) ([]TrashItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var items []TrashItem
+	for _, item := range m.trash {
+		if kind == "" || item.Kind == kind {
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if !a.DeletedAt.Equal(b.DeletedAt) {
+			return a.DeletedAt.After(b.DeletedAt)
+		}
+		return a.ID > b.ID
+	})
+	return items, nil
+}
+
+func (m *Memory) GetTrashItem(id int64) (TrashItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, item := range m.trash {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return TrashItem{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteTrash(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, item := range m.trash {
+		if item.ID == id {
+			m.trash = append(m.trash[:idx], m.trash[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) PurgeTrash(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []TrashItem
+	for _, item := range m.trash {
+		if !item.DeletedAt.Before(before) {
+			kept = append(kept, item)
+		}
+	}
+	purged := int64(len(m.trash) - len(kept))
+	m.trash = kept
+	return purged, nil
+}
+
+func (m *Memory) CreateTimetableVersion(version TimetableVersion) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshotID++
+	version.ID = m.snapshotID
+	version.Size = len(version.Entries)
+	version.Entries = append([]StaticEntry(nil), version.Entries...)
+	m.snapshots = append(m.snapshots, version)
+	return version.ID, nil
+}
+
+func (m *Memory) GetTimetableVersions(semester string) ([]TimetableVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var versions []TimetableVersion
+	for _, version := range m.snapshots {
+		if semester == "" || version.Semester == semester {
+			version.Entries = nil
+			versions = append(versions, version)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, b := versions[i], versions[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	return versions, nil
+}
+
+func (m *Memory) GetTimetableVersion(id int64) (TimetableVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, version := range m.snapshots {
+		if version.ID == id {
+			version.Entries = append([]StaticEntry(nil), version.Entries...)
+			return version, nil
+		}
+	}
+	return TimetableVersion{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteTimetableVersion(id int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, version := range m.snapshots {
+		if version.ID == id {
+			m.snapshots = append(m.snapshots[:idx], m.snapshots[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) ReplaceStatic(entries []StaticEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := m.versions
+	m.static = make(map[staticKey]string)
+	m.faculty = make(map[staticKey]string)
+	m.spans = make(map[staticKey]int)
+	m.versions = make(map[staticKey]int)
+	for _, entry := range entries {
+		key := staticKey{class: entry.Class, day: entry.Day, slot: entry.Slot}
+		m.static[key] = entry.Subject
+		m.faculty[key] = entry.Faculty
+		if entry.Span > 1 {
+			m.spans[key] = entry.Span
+		}
+		m.versions[key] = versions[key] + 1
+		if _, ok := m.subjects[entry.Subject]; !ok && entry.Subject != "FREE" {
+			m.subjects[entry.Subject] = ""
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetProfile(provider string, userID string) (Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile, ok := m.profiles[[2]string{provider, userID}]
+	if !ok {
+		return Profile{Provider: provider, UserID: userID}, sql.ErrNoRows
+	}
+	return profile, nil
+}
+
+func (m *Memory) SaveProfile(profile Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	profile.Data = append(json.RawMessage(nil), profile.Data...)
+	m.profiles[[2]string{profile.Provider, profile.UserID}] = profile
+	return nil
+}
+
+func (m *Memory) SaveUser(user User) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for i, existing := range m.users {
+		if existing.Provider != user.Provider || existing.ExternalID != user.ExternalID {
+			continue
+		}
+		user.ID, user.CreatedAt, user.UpdatedAt = existing.ID, existing.CreatedAt, now
+		if user.LastLoginAt == nil {
+			user.LastLoginAt = existing.LastLoginAt
+		}
+		user.Disabled = false
+		m.users[i] = user
+		return user.ID, nil
+	}
+	user.ID = int64(len(m.users) + 1)
+	user.CreatedAt, user.UpdatedAt, user.Disabled = now, now, false
+	m.users = append(m.users, user)
+	return user.ID, nil
+}
+
+func (m *Memory) GetUser(id int64) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.users)) {
+		return User{}, sql.ErrNoRows
+	}
+	return m.users[id-1], nil
+}
+
+func (m *Memory) GetUsers(filter UserFilter) ([]User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	query := strings.ToLower(filter.Query)
+	var users []User
+	for _, user := range m.users {
+		if strings.Contains(strings.ToLower(user.Mail), query) ||
+			strings.Contains(strings.ToLower(user.DisplayName), query) {
+			users = append(users, user)
+		}
+	}
+	sort.SliceStable(users, func(i, j int) bool { return users[i].DisplayName < users[j].DisplayName })
+	if len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+func (m *Memory) DisableUser(provider string, externalID string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, user := range m.users {
+		if user.Provider == provider && user.ExternalID == externalID {
+			m.users[i].Disabled = true
+			m.users[i].UpdatedAt = time.Now()
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) GetDirectoryDelta(provider string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deltas[provider], nil
+}
+
+func (m *Memory) SaveDirectoryDelta(provider string, deltaLink string, syncedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deltas[provider] = deltaLink
+	return nil
+}
+
+func (m *Memory) ReplaceGroupMembers(provider string, members []GroupMember) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var kept []GroupMember
+	for _, member := range m.groupMembers {
+		if member.Provider != provider {
+			kept = append(kept, member)
+		}
+	}
+	for _, member := range members {
+		member.Provider = provider
+		kept = append(kept, member)
+	}
+	m.groupMembers = kept
+	return nil
+}
+
+func (m *Memory) GetGroupMembers(filter GroupMemberFilter) ([]GroupMember, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var members []GroupMember
+	for _, member := range m.groupMembers {
+		if (filter.Mail == "" || member.Mail == filter.Mail) && (filter.Section == "" || member.Section == filter.Section) &&
+			(filter.Role == "" || member.Role == filter.Role) {
+			members = append(members, member)
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].Section != members[j].Section {
+			return members[i].Section < members[j].Section
+		}
+		if members[i].Mail != members[j].Mail {
+			return members[i].Mail < members[j].Mail
+		}
+		return members[i].Provider < members[j].Provider
+	})
+	return members, nil
+}
+
+func (m *Memory) RecordSecurityEvent(event SecurityEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event.ID = int64(len(m.security) + 1)
+	m.security = append(m.security, event)
+	return nil
+}
+
+func (m *Memory) GetSecurityEvents(filter SecurityEventFilter) ([]SecurityEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []SecurityEvent
+	for idx := len(m.security) - 1; idx >= 0 && len(events) < filter.Limit; idx-- {
+		event := m.security[idx]
+		if (filter.Kind == "" || event.Kind == filter.Kind) && (filter.IP == "" || event.IP == filter.IP) &&
+			(filter.Subject == "" || event.Subject == filter.Subject) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *Memory) CreateErasureRequest(request ErasureRequest) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.erasureID++
+	request.ID = m.erasureID
+	request.Status = ErasurePending
+	m.erasures = append(m.erasures, request)
+	return request.ID, nil
+}
+
+func (m *Memory) GetErasureRequests(mail string, status string) ([]ErasureRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var requests []ErasureRequest
+	for idx := len(m.erasures) - 1; idx >= 0; idx-- {
+		request := m.erasures[idx]
+		if (mail == "" || request.Mail == mail) && (status == "" || request.Status == status) {
+			requests = append(requests, request)
+		}
+	}
+	return requests, nil
+}
+
+func (m *Memory) DecideErasureRequest(id int64, status string, by string, note string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx := range m.erasures {
+		if m.erasures[idx].ID == id && m.erasures[idx].Status == ErasurePending {
+			m.erasures[idx].Status = status
+			m.erasures[idx].DecidedBy = by
+			m.erasures[idx].DecidedAt = &at
+			m.erasures[idx].Note = note
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *Memory) EraseUser(mail string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var erased int64
+	for id, session := range m.sessions {
+		if session.Mail == mail {
+			delete(m.sessions, id)
+			erased++
+		}
+	}
+	erased += int64(len(m.stars[mail]))
+	delete(m.stars, mail)
+	if _, ok := m.prefs[mail]; ok {
+		delete(m.prefs, mail)
+		erased++
+	}
+	var views []RecentView
+	for _, view := range m.views {
+		if view.Mail != mail {
+			views = append(views, view)
+		}
+	}
+	erased += int64(len(m.views) - len(views))
+	m.views = views
+	var entries []CustomEntry
+	for _, entry := range m.customEntries {
+		if entry.Mail != mail {
+			entries = append(entries, entry)
+		}
+	}
+	erased += int64(len(m.customEntries) - len(entries))
+	m.customEntries = entries
+	var notifications []Notification
+	for _, notification := range m.notifications {
+		if notification.Mail != mail {
+			notifications = append(notifications, notification)
+		}
+	}
+	erased += int64(len(m.notifications) - len(notifications))
+	m.notifications = notifications
+	var texts []Text
+	for _, text := range m.texts {
+		if text.Mail != mail {
+			texts = append(texts, text)
+		}
+	}
+	erased += int64(len(m.texts) - len(texts))
+	m.texts = texts
+	var groupMembers []GroupMember
+	for _, member := range m.groupMembers {
+		if member.Mail != mail {
+			groupMembers = append(groupMembers, member)
+		}
+	}
+	erased += int64(len(m.groupMembers) - len(groupMembers))
+	m.groupMembers = groupMembers
+	for id, club := range m.clubs {
+		var coordinators, members []string
+		for _, coordinator := range club.Coordinators {
+			if coordinator != mail {
+				coordinators = append(coordinators, coordinator)
+			}
+		}
+		for _, member := range club.Members {
+			if member != mail {
+				members = append(members, member)
+			}
+		}
+		erased += int64(len(club.Coordinators) - len(coordinators) + len(club.Members) - len(members))
+		club.Coordinators, club.Members = coordinators, members
+		m.clubs[id] = club
+	}
+	var waiting []WaitlistEntry
+	for _, entry := range m.waiting {
+		if entry.Faculty != mail {
+			waiting = append(waiting, entry)
+		}
+	}
+	erased += int64(len(m.waiting) - len(waiting))
+	m.waiting = waiting
+	var appointments []Appointment
+	for _, appointment := range m.appointments {
+		if appointment.Student != mail {
+			appointments = append(appointments, appointment)
+		}
+	}
+	erased += int64(len(m.appointments) - len(appointments))
+	m.appointments = appointments
+	var users []User
+	for _, user := range m.users {
+		if user.Mail != mail {
+			users = append(users, user)
+			continue
+		}
+		if _, ok := m.profiles[[2]string{user.Provider, user.ExternalID}]; ok {
+			delete(m.profiles, [2]string{user.Provider, user.ExternalID})
+			erased++
+		}
+	}
+	erased += int64(len(m.users) - len(users))
+	m.users = users
+	for idx := range m.feedback {
+		if m.feedback[idx].Mail == mail {
+			m.feedback[idx].Mail = ""
+			erased++
+		}
+	}
+	return erased, nil
+}
+
+func (m *Memory) CountExpired(kind string, before time.Time) (int64, error) {
+	return m.expired(kind, before, false)
+}
+
+func (m *Memory) PurgeExpired(kind string, before time.Time) (int64, error) {
+	return m.expired(kind, before, true)
+}
+
+// expired counts the data of kind older than before, deleting it with purge
+func (m *Memory) expired(kind string, before time.Time, purge bool) (int64, error) {
+	if _, err := retainedColumn(kind); err != nil {
+		return 0, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	switch kind {
+	case RetainBookings:
+		for key, booking := range m.bookings {
+			if !booking.Date.Before(before) {
+				continue
+			}
+			count++
+			if purge {
+				delete(m.bookings, key)
+				delete(m.checkIns, key)
+				for holdKey, reservation := range m.kitHolds {
+					if reservation.Class == booking.Class && reservation.Date.Equal(booking.Date) && reservation.Slot == booking.Slot {
+						delete(m.kitHolds, holdKey)
+					}
+				}
+			}
+		}
+	case RetainAudit:
+		var kept []AuditEvent
+		for _, event := range m.audit {
+			if event.At.Before(before) {
+				count++
+			} else {
+				kept = append(kept, event)
+			}
+		}
+		if purge {
+			m.audit = kept
+		}
+	case RetainSearches:
+		var kept []SearchEvent
+		for _, event := range m.searches {
+			if event.At.Before(before) {
+				count++
+			} else {
+				kept = append(kept, event)
+			}
+		}
+		if purge {
+			m.searches = kept
+		}
+	case RetainSessions:
+		for id, session := range m.sessions {
+			if session.LastActiveAt.Before(before) {
+				count++
+				if purge {
+					delete(m.sessions, id)
+				}
+			}
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CreateBackup(backup Backup) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.backups = append(m.backups, backup)
+	return nil
+}
+
+func (m *Memory) GetBackups() ([]Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var backups []Backup
+	for idx := len(m.backups) - 1; idx >= 0; idx-- {
+		backups = append(backups, m.backups[idx])
+	}
+	return backups, nil
+}
+
+func (m *Memory) GetBackup(id string) (Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, backup := range m.backups {
+		if backup.ID == id {
+			return backup, nil
+		}
+	}
+	return Backup{}, sql.ErrNoRows
+}
+
+func (m *Memory) DeleteBackup(id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for idx, backup := range m.backups {
+		if backup.ID == id {
+			m.backups = append(m.backups[:idx:idx], m.backups[idx+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *Memory) SetSubject(id string, name string) error {
+	m.AddSubject(id, name)
+	return nil
+}
+
+func (m *Memory) SetFaculty(id string, name string) error {
+	m.AddFaculty(id, name)
+	return nil
+}
+
+// EachAuditEvent calls fn outside the lock, so it can take its time
+func (m *Memory) EachAuditEvent(action string, limit int, fn func(AuditEvent) error) error {
+	events, _ := m.GetAuditEvents(action, limit)
+	for _, event := range events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) EachSearchEvent(startDate time.Time, endDate time.Time, fn func(SearchEvent) error) error {
+	to := endDate.AddDate(0, 0, 1)
+	for _, event := range m.Searches() {
+		if event.At.Before(startDate) || !event.At.Before(to) {
+			continue
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
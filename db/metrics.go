@@ -0,0 +1,280 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"expvar"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/redact"
+)
+
+/*
+driverName is the MySQL driver wrapped to time every query, which every
+function here opens its database with.
+*/
+const driverName = "mysql-timed"
+
+// Queries taking at least this long are logged unless SetSlowQuery says otherwise
+const DefaultSlowQuery = 500 * time.Millisecond
+
+// Upper bounds of the latency buckets; slower queries land in a last, unbounded one
+var latencyBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Longest logged string parameter, the rest is cut
+const maxLoggedParam = 64
+
+func init() {
+	sql.Register(driverName, timedDriver{})
+	expvar.Publish("queries", expvar.Func(func() interface{} {
+		return QueryStats()
+	}))
+}
+
+var metrics = struct {
+	mu        sync.Mutex
+	slowQuery time.Duration
+	queries   map[string]*histogram
+}{slowQuery: DefaultSlowQuery, queries: make(map[string]*histogram)}
+
+// SetSlowQuery sets how long a query has to take to be logged with its parameters; 0 logs none
+func SetSlowQuery(threshold time.Duration) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	metrics.slowQuery = threshold
+}
+
+type histogram struct {
+	count  int
+	total  time.Duration
+	max    time.Duration
+	counts []int
+}
+
+type Bucket struct {
+	// Upper bound, like "25ms", or "+Inf"
+	LE    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+/*
+QueryLatency is the latency histogram of one query, named after the function
+running it, like GetFreeClass. A query counts in the first bucket its latency
+fits under; the time is until MySQL answered, reading the rows is not included.
+*/
+type QueryLatency struct {
+	Count   int      `json:"count"`
+	MeanMs  float64  `json:"meanMs"`
+	MaxMs   float64  `json:"maxMs"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// QueryStats returns the latency histograms of the queries run since the start, by query name
+func QueryStats() map[string]QueryLatency {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	stats := make(map[string]QueryLatency, len(metrics.queries))
+	for name, h := range metrics.queries {
+		latency := QueryLatency{
+			Count:  h.count,
+			MeanMs: milliseconds(h.total) / float64(h.count),
+			MaxMs:  milliseconds(h.max),
+		}
+		for idx, count := range h.counts {
+			le := "+Inf"
+			if idx < len(latencyBuckets) {
+				le = latencyBuckets[idx].String()
+			}
+			latency.Buckets = append(latency.Buckets, Bucket{LE: le, Count: count})
+		}
+		stats[name] = latency
+	}
+	return stats
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// observe adds a query to its histogram and logs it when it was slow
+func observe(name string, took time.Duration, args []driver.NamedValue) {
+	metrics.mu.Lock()
+	h, ok := metrics.queries[name]
+	if !ok {
+		h = &histogram{counts: make([]int, len(latencyBuckets)+1)}
+		metrics.queries[name] = h
+	}
+	h.count++
+	h.total += took
+	if took > h.max {
+		h.max = took
+	}
+	bucket := len(latencyBuckets)
+	for idx, bound := range latencyBuckets {
+		if took <= bound {
+			bucket = idx
+			break
+		}
+	}
+	h.counts[bucket]++
+	slowQuery := metrics.slowQuery
+	metrics.mu.Unlock()
+	if slowQuery > 0 && took >= slowQuery {
+		log.Println("Slow query", name, "took", took.Round(time.Millisecond), "with", formatParams(args))
+	}
+}
+
+/*
+formatParams lists the parameters of a query for the log. Strings that may be
+credentials or mail addresses, like session IDs and OAuth states, are
+redacted as in the traffic log, see package redact.
+*/
+func formatParams(args []driver.NamedValue) string {
+	params := make([]string, len(args))
+	for idx, arg := range args {
+		switch value := arg.Value.(type) {
+		case string:
+			if redact.Sensitive(value) {
+				params[idx] = redact.Redacted
+				continue
+			}
+			if len(value) > maxLoggedParam {
+				value = value[:maxLoggedParam] + "..."
+			}
+			params[idx] = fmt.Sprintf("%q", value)
+		case []byte:
+			params[idx] = fmt.Sprintf("<%d bytes>", len(value))
+		case time.Time:
+			params[idx] = value.Format(time.RFC3339)
+		default:
+			params[idx] = fmt.Sprint(value)
+		}
+	}
+	return "[" + strings.Join(params, " ") + "]"
+}
+
+/*
+queryName names a query after the function of this package running it, found
+on the stack, so GetFreeClass and its closures are all "GetFreeClass" without
+any of them saying so.
+*/
+func queryName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	prefix := "github.com/deebakkarthi/coraserver/db."
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, prefix) {
+			name := strings.TrimPrefix(strings.TrimPrefix(frame.Function, prefix), "Store.")
+			// Methods of the driver wrappers below
+			if !strings.HasPrefix(name, "(") && !strings.HasPrefix(name, "timed") {
+				return strings.SplitN(name, ".", 2)[0]
+			}
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// The interfaces the connections and statements of the MySQL driver implement
+type mysqlConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+	driver.NamedValueChecker
+}
+
+type mysqlStmt interface {
+	driver.Stmt
+	driver.StmtQueryContext
+	driver.StmtExecContext
+	driver.NamedValueChecker
+}
+
+// timedDriver opens MySQL connections (see connect) that time their queries
+type timedDriver struct{}
+
+func (timedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := connect(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if timed, ok := conn.(mysqlConn); ok {
+		return timedConn{timed}, nil
+	}
+	return conn, nil
+}
+
+type timedConn struct {
+	mysqlConn
+}
+
+func (c timedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c timedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.mysqlConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if timed, ok := stmt.(mysqlStmt); ok {
+		return timedStmt{mysqlStmt: timed, name: queryName()}, nil
+	}
+	return stmt, nil
+}
+
+func (c timedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.mysqlConn.QueryContext(ctx, query, args)
+	// Skipped queries are prepared and run again, and timed then
+	if err != driver.ErrSkip {
+		observe(queryName(), time.Since(start), args)
+	}
+	return rows, err
+}
+
+func (c timedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.mysqlConn.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		observe(queryName(), time.Since(start), args)
+	}
+	return result, err
+}
+
+type timedStmt struct {
+	mysqlStmt
+	name string
+}
+
+func (s timedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := s.mysqlStmt.QueryContext(ctx, args)
+	observe(s.name, time.Since(start), args)
+	return rows, err
+}
+
+func (s timedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := s.mysqlStmt.ExecContext(ctx, args)
+	observe(s.name, time.Since(start), args)
+	return result, err
+}
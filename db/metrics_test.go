@@ -0,0 +1,66 @@
+package db
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryName(t *testing.T) {
+	name := func() string { return queryName() }()
+	if name != "TestQueryName" {
+		t.Errorf("queryName() = %q; want TestQueryName", name)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	SetSlowQuery(100 * time.Millisecond)
+	defer SetSlowQuery(DefaultSlowQuery)
+
+	long := strings.Repeat("no token ", 12)
+	args := []driver.NamedValue{{Value: 2}, {Value: "TUE"}, {Value: long}}
+	observe("TestObserveFast", 3*time.Millisecond, args)
+	observe("TestObserveFast", 40*time.Millisecond, args)
+	observe("TestObserveSlow", 20*time.Second, args)
+
+	stats := QueryStats()
+	fast := stats["TestObserveFast"]
+	if fast.Count != 2 || fast.MaxMs != 40 || fast.MeanMs != 21.5 {
+		t.Errorf("fast query stats = %+v; want 2 queries, max 40ms, mean 21.5ms", fast)
+	}
+	for _, bucket := range fast.Buckets {
+		want := 0
+		if bucket.LE == "5ms" || bucket.LE == "50ms" {
+			want = 1
+		}
+		if bucket.Count != want {
+			t.Errorf("fast query bucket %s = %d; want %d", bucket.LE, bucket.Count, want)
+		}
+	}
+	slow := stats["TestObserveSlow"].Buckets
+	if last := slow[len(slow)-1]; last.LE != "+Inf" || last.Count != 1 {
+		t.Errorf("slow query last bucket = %+v; want 1 in +Inf", last)
+	}
+
+	if strings.Contains(logs.String(), "TestObserveFast") {
+		t.Errorf("logged a fast query:\n%s", logs.String())
+	}
+	want := `Slow query TestObserveSlow took 20s with [2 "TUE" "` + long[:maxLoggedParam] + `..."]`
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("slow query log = %q; want %q", logs.String(), want)
+	}
+
+	// A session ID and a mail, which must not reach the log
+	observe("TestObserveSecret", 20*time.Second, []driver.NamedValue{
+		{Value: "4f9c2a7d1e8b3f6a0c5d9e2b7a1f4c8d"}, {Value: "student@cb.students.amrita.edu"}})
+	if want := "Slow query TestObserveSecret took 20s with [[redacted] [redacted]]"; !strings.Contains(logs.String(), want) {
+		t.Errorf("slow query log = %q; want %q", logs.String(), want)
+	}
+}
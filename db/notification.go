@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+// A Notification sent to a user, kept so they can read it later in the app
+type Notification struct {
+	ID        int64     `json:"id"`
+	Mail      string    `json:"-"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Body      string    `json:"body,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// When the user marked it read, nil while unread
+	ReadAt *time.Time `json:"readAt"`
+}
+
+func AddNotification(dsn string, notification Notification) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO notification (mail, kind, title, body, created_at) VALUES (?, ?, ?, ?, ?)`,
+		notification.Mail, notification.Kind, notification.Title, notification.Body, notification.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetNotifications lists up to limit notifications of mail, only the unread ones with unread, latest first
+func GetNotifications(dsn string, mail string, unread bool, limit int) ([]Notification, error) {
+	var notifications []Notification
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `SELECT id, mail, kind, title, body, created_at, read_at FROM notification WHERE mail = ?`
+	if unread {
+		query += ` AND read_at IS NULL`
+	}
+	rows, err := db.Query(query+` ORDER BY created_at DESC, id DESC LIMIT ?`, mail, limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Notification
+		var readAt sql.NullTime
+		err := rows.Scan(&tmp.ID, &tmp.Mail, &tmp.Kind, &tmp.Title, &tmp.Body, &tmp.CreatedAt, &readAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if readAt.Valid {
+			tmp.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, tmp)
+	}
+	return notifications, rows.Err()
+}
+
+func CountUnreadNotifications(dsn string, mail string) (int, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM notification WHERE mail = ? AND read_at IS NULL`, mail).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return count, nil
+}
+
+/*
+MarkNotificationsRead marks the unread notifications of mail with ids, or all
+of them when ids is empty, read at at and returns how many it marked
+*/
+func MarkNotificationsRead(dsn string, mail string, ids []int64, at time.Time) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	query := `UPDATE notification SET read_at = ? WHERE mail = ? AND read_at IS NULL`
+	args := []interface{}{at, mail}
+	if len(ids) > 0 {
+		query += ` AND id IN (?` + strings.Repeat(`, ?`, len(ids)-1) + `)`
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// PurgeNotifications deletes the notifications sent before before and returns how many went
+func PurgeNotifications(dsn string, before time.Time) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM notification WHERE created_at < ?`, before)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// How long a user has to finish logging in at the identity provider
+const oauthStateLifetime = 10 * time.Minute
+
+// The PKCE code verifier of a login started by /oauth/login, keyed by its state parameter
+type OAuthState struct {
+	State        string
+	Provider     string
+	CodeVerifier string
+	CreatedAt    time.Time
+}
+
+func SaveOAuthState(dsn string, state OAuthState) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	// Piggyback the cleanup of abandoned logins on new ones
+	_, err = db.Exec(`DELETE FROM oauth_state WHERE created_at < ?`, time.Now().Add(-oauthStateLifetime))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO oauth_state (state, provider, code_verifier,
+    created_at) VALUES (?, ?, ?, ?)`, state.State, state.Provider, state.CodeVerifier, state.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+/*
+TakeOAuthState returns the state and deletes it so that it can only be used
+once. sql.ErrNoRows means it never existed, was already used or has expired.
+*/
+func TakeOAuthState(dsn string, state string) (OAuthState, error) {
+	var oauthState OAuthState
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return oauthState, err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return oauthState, err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(`SELECT state, provider, code_verifier, created_at FROM
+    oauth_state WHERE state = ? AND created_at >= ? FOR UPDATE`, state,
+		time.Now().Add(-oauthStateLifetime)).Scan(&oauthState.State,
+		&oauthState.Provider, &oauthState.CodeVerifier, &oauthState.CreatedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err)
+		}
+		return oauthState, err
+	}
+	_, err = tx.Exec(`DELETE FROM oauth_state WHERE state = ?`, state)
+	if err != nil {
+		log.Println(err)
+		return oauthState, err
+	}
+	return oauthState, tx.Commit()
+}
@@ -0,0 +1,195 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// An OfficeHour is a slot of the week in which a faculty member takes visitors
+type OfficeHour struct {
+	Faculty string `json:"faculty"`
+	Day     string `json:"day"`
+	Slot    int    `json:"slot"`
+	// Where to find them, like a staff room
+	Place string `json:"place,omitempty"`
+}
+
+// States of an appointment
+const (
+	AppointmentPending  = "pending"
+	AppointmentAccepted = "accepted"
+	AppointmentDeclined = "declined"
+)
+
+/*
+An Appointment is a student asking to meet a faculty member for a few minutes
+from Start, within a slot of a date
+*/
+type Appointment struct {
+	ID        int64     `json:"id"`
+	Faculty   string    `json:"faculty"`
+	Student   string    `json:"student"`
+	Date      time.Time `json:"date"`
+	Slot      int       `json:"slot"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Note      string    `json:"note,omitempty"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Set once the faculty member answered
+	Reply     string     `json:"reply,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+}
+
+// An AppointmentFilter picks appointments; zero fields match everything
+type AppointmentFilter struct {
+	Faculty string
+	Student string
+	Date    time.Time
+	Slot    int
+	Status  string
+}
+
+// GetOfficeHours lists the office hours of faculty, or of everyone when it is empty
+func GetOfficeHours(dsn string, faculty string) ([]OfficeHour, error) {
+	var hours []OfficeHour
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"faculty_id = ?"}, []interface{}{faculty})
+	rows, err := db.Query(`SELECT faculty_id, day, slot_id, place FROM office_hour`+clause+`
+    ORDER BY faculty_id, FIELD(day, 'MON', 'TUE', 'WED', 'THU', 'FRI'), slot_id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp OfficeHour
+		err := rows.Scan(&tmp.Faculty, &tmp.Day, &tmp.Slot, &tmp.Place)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		hours = append(hours, tmp)
+	}
+	return hours, rows.Err()
+}
+
+// SetOfficeHours replaces the office hours of faculty with hours
+func SetOfficeHours(dsn string, faculty string, hours []OfficeHour) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`DELETE FROM office_hour WHERE faculty_id = ?`, faculty)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, hour := range hours {
+		_, err = tx.Exec(`INSERT INTO office_hour (faculty_id, day, slot_id, place)
+    VALUES (?, ?, ?, ?)`, faculty, hour.Day, hour.Slot, hour.Place)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateAppointment stores a pending appointment and returns its ID
+func CreateAppointment(dsn string, appointment Appointment) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO appointment (faculty_id, student_id, date, slot_id,
+    start_at, end_at, note, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		appointment.Faculty, appointment.Student, appointment.Date, appointment.Slot,
+		appointment.Start, appointment.End, appointment.Note, AppointmentPending, appointment.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+/*
+DecideAppointment accepts or declines a pending appointment. sql.ErrNoRows
+means there is no such appointment or it was already decided.
+*/
+func DecideAppointment(dsn string, id int64, status string, reply string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE appointment SET status = ?, reply = ?, decided_at = ?
+    WHERE id = ? AND status = ?`, status, reply, at, id, AppointmentPending)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAppointments lists the appointments matching filter, soonest first
+func GetAppointments(dsn string, filter AppointmentFilter) ([]Appointment, error) {
+	var appointments []Appointment
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"faculty_id = ?", "student_id = ?", "date = ?", "slot_id = ?", "status = ?"},
+		[]interface{}{filter.Faculty, filter.Student, filter.Date, filter.Slot, filter.Status})
+	rows, err := db.Query(`SELECT id, faculty_id, student_id, date, slot_id, start_at, end_at,
+    note, status, created_at, reply, decided_at FROM appointment`+clause+` ORDER BY start_at, id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Appointment
+		var decidedAt sql.NullTime
+		err := rows.Scan(&tmp.ID, &tmp.Faculty, &tmp.Student, &tmp.Date, &tmp.Slot, &tmp.Start,
+			&tmp.End, &tmp.Note, &tmp.Status, &tmp.CreatedAt, &tmp.Reply, &decidedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.DecidedAt = nullTimePtr(decidedAt)
+		appointments = append(appointments, tmp)
+	}
+	return appointments, rows.Err()
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+Override changes one period of the weekly timetable on a single date: the
+class is cancelled, or held by a substitute faculty member, in a substitute
+room, or both. The period is the static entry starting at Slot, so a lab is
+overridden as a whole.
+*/
+type Override struct {
+	Class     string    `json:"class"`
+	Date      time.Time `json:"date"`
+	Slot      int       `json:"slot"`
+	Span      int       `json:"span"`
+	Subject   string    `json:"subject"`
+	Cancelled bool      `json:"cancelled"`
+	// Substitutes, empty when unchanged
+	Faculty   string    `json:"faculty,omitempty"`
+	Room      string    `json:"room,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SetOverride stores the override, replacing the one of the same period
+func SetOverride(dsn string, override Override) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO class_override (class_id, date, slot_id, span,
+    subject_id, cancelled, faculty_id, room_id, reason, created_by, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE span = VALUES(span),
+    subject_id = VALUES(subject_id), cancelled = VALUES(cancelled),
+    faculty_id = VALUES(faculty_id), room_id = VALUES(room_id), reason = VALUES(reason),
+    created_by = VALUES(created_by), created_at = VALUES(created_at)`,
+		override.Class, override.Date, override.Slot, override.Span, override.Subject,
+		override.Cancelled, nullString(override.Faculty), nullString(override.Room),
+		override.Reason, override.CreatedBy, override.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func DeleteOverride(dsn string, class string, date time.Time, slot int) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM class_override WHERE class_id = ? AND date = ?
+    AND slot_id = ?`, class, date, slot)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetOverrides lists the overrides on date, of class when it is not empty, in class and slot order
+func GetOverrides(dsn string, date time.Time, class string) ([]Override, error) {
+	var overrides []Override
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"date = ?", "class_id = ?"}, []interface{}{date, class})
+	rows, err := db.Query(`SELECT class_id, date, slot_id, span, subject_id, cancelled,
+    faculty_id, room_id, reason, created_by, created_at FROM class_override`+clause+`
+    ORDER BY class_id, slot_id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Override
+		var faculty, room sql.NullString
+		err := rows.Scan(&tmp.Class, &tmp.Date, &tmp.Slot, &tmp.Span, &tmp.Subject,
+			&tmp.Cancelled, &faculty, &room, &tmp.Reason, &tmp.CreatedBy, &tmp.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.Faculty = faculty.String
+		tmp.Room = room.String
+		overrides = append(overrides, tmp)
+	}
+	return overrides, rows.Err()
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// GetPreferences returns the JSON preferences of mail, sql.ErrNoRows when none were saved
+func GetPreferences(dsn string, mail string) (string, error) {
+	var data string
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return data, err
+	}
+	defer db.Close()
+
+	err = db.QueryRow(`SELECT data FROM preference WHERE mail = ?`, mail).Scan(&data)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	return data, err
+}
+
+// SetPreferences replaces the preferences of mail with data, a JSON object
+func SetPreferences(dsn string, mail string, data string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO preference (mail, data, updated_at) VALUES (?, ?, ?)
+    ON DUPLICATE KEY UPDATE data = VALUES(data), updated_at = VALUES(updated_at)`,
+		mail, data, at)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetAllPreferences returns the JSON preferences of every user who saved some, by mail
+func GetAllPreferences(dsn string) (map[string]string, error) {
+	prefs := make(map[string]string)
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT mail, data FROM preference`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mail, data string
+		err := rows.Scan(&mail, &data)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		prefs[mail] = data
+	}
+	return prefs, rows.Err()
+}
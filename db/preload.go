@@ -0,0 +1,301 @@
+package db
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+/*
+Preloaded is a Repository keeping the timetable in memory: the static periods,
+slots, room blocks and the bookings from yesterday on, loaded in one go. Free
+class and free slot lookups are then mask tests on an availability matrix and
+day timetables come from a Memory, without a round trip to the database.
+
+Its own bookings and cancellations update the copy in place; its other writes
+to any of it throw the copy away and the next lookup loads it again, as does
+refresh passing, which is how writes of other servers on the same database
+show up. Lookups of dates before the copy starts, or while it can't be loaded,
+go to the database. Everything else passes straight through.
+*/
+type Preloaded struct {
+	Repository
+	refresh time.Duration
+
+	mu    sync.Mutex
+	index *Memory
+	// nil when a slot ID is too high for it, the free lookups use index then
+	matrix   *availability
+	from     time.Time
+	loadedAt time.Time
+	// Set when loading failed, so the database is not asked for the whole timetable on every lookup
+	retryAt time.Time
+}
+
+// How long the lookups go to the database after the timetable could not be loaded
+const preloadRetry = 10 * time.Second
+
+var _ Repository = &Preloaded{}
+
+// NewPreloaded loads the timetable of repo, reloading it at least every refresh
+func NewPreloaded(repo Repository, refresh time.Duration) *Preloaded {
+	p := &Preloaded{Repository: repo, refresh: refresh}
+	p.mu.Lock()
+	p.load(time.Now())
+	p.mu.Unlock()
+	return p
+}
+
+// load must be called with mu held; the copy is left out when it fails
+func (p *Preloaded) load(now time.Time) {
+	p.index = nil
+	p.matrix = nil
+	p.retryAt = now.Add(preloadRetry)
+	// A day early, whatever the time zone of the dates asked for
+	from := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+	index := NewMemory()
+	entries, err := p.Repository.GetStatic(TimetableFilter{})
+	if err != nil {
+		log.Println("Error preloading the timetable:", err)
+		return
+	}
+	for _, entry := range entries {
+		entry.Version = 0
+		index.SetStatic(entry)
+	}
+	for _, slot := range p.Repository.GetAllSlot() {
+		index.AddSlot(slot, "", "")
+	}
+	bookings, err := p.Repository.GetBookings(BookingFilter{StartDate: from})
+	if err != nil {
+		log.Println("Error preloading the bookings:", err)
+		return
+	}
+	for _, booking := range bookings {
+		index.Booking(booking.Class, booking.Date, booking.Slot, booking.Faculty, booking.Subject)
+	}
+	blocks, err := p.Repository.GetBlocks("", from, time.Time{})
+	if err != nil {
+		log.Println("Error preloading the room blocks:", err)
+		return
+	}
+	for _, block := range blocks {
+		index.CreateBlock(block)
+	}
+	p.index = index
+	p.matrix = newAvailability(entries, bookings, blocks)
+	p.from = from
+	p.loadedAt = now
+	p.retryAt = time.Time{}
+}
+
+/*
+lookup runs find on the copy holding dates, loading it if needed, with mu held
+so the copy can't change underneath. It tells whether there was one; the
+database has to be asked otherwise.
+*/
+func (p *Preloaded) lookup(dates []time.Time, find func(index *Memory, matrix *availability)) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if (p.index == nil && !now.Before(p.retryAt)) || (p.index != nil && now.Sub(p.loadedAt) >= p.refresh) {
+		p.load(now)
+	}
+	if p.index == nil {
+		return false
+	}
+	for _, date := range dates {
+		if date.Before(p.from) {
+			return false
+		}
+	}
+	find(p.index, p.matrix)
+	return true
+}
+
+// invalidate throws the copy away after a write to what it holds
+func (p *Preloaded) invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.index = nil
+	p.matrix = nil
+	p.retryAt = time.Time{}
+}
+
+// update applies a booking or cancellation, done when err is nil, to the copy
+func (p *Preloaded) update(err error, apply func(index *Memory, matrix *availability)) {
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.index == nil {
+		return
+	}
+	apply(p.index, p.matrix)
+}
+
+func (p *Preloaded) GetFreeClass(slot int, date time.Time) []string {
+	var classes []string
+	found := p.lookup([]time.Time{date}, func(index *Memory, matrix *availability) {
+		mask, ok := slotMask([]int{slot})
+		if matrix == nil || !ok {
+			classes = index.GetFreeClass(slot, date)
+			return
+		}
+		classes = matrix.freeRooms(mask, []time.Time{date})
+	})
+	if !found {
+		return p.Repository.GetFreeClass(slot, date)
+	}
+	return classes
+}
+
+func (p *Preloaded) GetFreeSlot(class string, date time.Time) []int {
+	var slots []int
+	found := p.lookup([]time.Time{date}, func(index *Memory, matrix *availability) {
+		if matrix == nil {
+			slots = index.GetFreeSlot(class, date)
+			return
+		}
+		slots = matrix.freeSlots(class, date)
+	})
+	if !found {
+		return p.Repository.GetFreeSlot(class, date)
+	}
+	return slots
+}
+
+func (p *Preloaded) MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
+	var classes []string
+	found := p.lookup([]time.Time{date}, func(index *Memory, matrix *availability) {
+		if matrix == nil || startSlot < 0 || endSlot > maxMatrixSlot {
+			classes = index.MultiFreeSlot(startSlot, endSlot, date)
+			return
+		}
+		classes = matrix.freeRooms(slotRange(startSlot, endSlot), []time.Time{date})
+	})
+	if !found {
+		return p.Repository.MultiFreeSlot(startSlot, endSlot, date)
+	}
+	return classes
+}
+
+func (p *Preloaded) GetFreeRooms(slots []int, dates []time.Time) []string {
+	var classes []string
+	found := p.lookup(dates, func(index *Memory, matrix *availability) {
+		mask, ok := slotMask(slots)
+		if matrix == nil || !ok {
+			classes = index.GetFreeRooms(slots, dates)
+			return
+		}
+		classes = matrix.freeRooms(mask, dates)
+	})
+	if !found {
+		return p.Repository.GetFreeRooms(slots, dates)
+	}
+	return classes
+}
+
+func (p *Preloaded) GetTimetableByDay(class string, date time.Time) []string {
+	var subjects []string
+	found := p.lookup([]time.Time{date}, func(index *Memory, matrix *availability) {
+		subjects = index.GetTimetableByDay(class, date)
+	})
+	if !found {
+		return p.Repository.GetTimetableByDay(class, date)
+	}
+	return subjects
+}
+
+func (p *Preloaded) Booking(class string, date time.Time, slot int, faculty string, subject string) (int64, error) {
+	rowsAffected, err := p.Repository.Booking(class, date, slot, faculty, subject)
+	if rowsAffected > 0 {
+		p.update(err, func(index *Memory, matrix *availability) {
+			index.Booking(class, date, slot, faculty, subject)
+			if matrix != nil {
+				matrix.book(class, date, []int{slot})
+			}
+		})
+	}
+	return rowsAffected, err
+}
+
+func (p *Preloaded) MultiBooking(class string, date time.Time, startSlot int, endSlot int, faculty string, subject string) (int64, error) {
+	rowsAffected, err := p.Repository.MultiBooking(class, date, startSlot, endSlot, faculty, subject)
+	if rowsAffected != int64(endSlot-startSlot+1) {
+		// Which of the slots were booked is anyone's guess
+		if rowsAffected > 0 {
+			p.invalidate()
+		}
+		return rowsAffected, err
+	}
+	p.update(err, func(index *Memory, matrix *availability) {
+		var slots []int
+		for slot := startSlot; slot <= endSlot; slot++ {
+			index.Booking(class, date, slot, faculty, subject)
+			slots = append(slots, slot)
+		}
+		if matrix != nil {
+			matrix.book(class, date, slots)
+		}
+	})
+	return rowsAffected, err
+}
+
+func (p *Preloaded) CancelBooking(class string, date time.Time, slot int) error {
+	err := p.Repository.CancelBooking(class, date, slot)
+	p.update(err, func(index *Memory, matrix *availability) {
+		index.CancelBooking(class, date, slot)
+		if matrix != nil {
+			matrix.release(class, date, []int{slot})
+		}
+	})
+	return err
+}
+
+func (p *Preloaded) CancelBookingVersion(class string, date time.Time, slot int, version int) error {
+	err := p.Repository.CancelBookingVersion(class, date, slot, version)
+	p.update(err, func(index *Memory, matrix *availability) {
+		index.CancelBooking(class, date, slot)
+		if matrix != nil {
+			matrix.release(class, date, []int{slot})
+		}
+	})
+	return err
+}
+
+// The index keeps its own versions, so the booking is changed there whatever its version
+func (p *Preloaded) UpdateBooking(booking BookingRecord) error {
+	err := p.Repository.UpdateBooking(booking)
+	p.update(err, func(index *Memory, matrix *availability) {
+		booking.Version = 0
+		index.UpdateBooking(booking)
+	})
+	return err
+}
+
+func (p *Preloaded) SetStatic(entry StaticEntry) error {
+	defer p.invalidate()
+	return p.Repository.SetStatic(entry)
+}
+
+func (p *Preloaded) DeleteStatic(class string, day string, slot int) (int64, error) {
+	defer p.invalidate()
+	return p.Repository.DeleteStatic(class, day, slot)
+}
+
+func (p *Preloaded) ReplaceStatic(entries []StaticEntry) error {
+	defer p.invalidate()
+	return p.Repository.ReplaceStatic(entries)
+}
+
+func (p *Preloaded) CreateBlock(block Block) (int64, error) {
+	defer p.invalidate()
+	return p.Repository.CreateBlock(block)
+}
+
+func (p *Preloaded) DeleteBlock(id int64) (int64, error) {
+	defer p.invalidate()
+	return p.Repository.DeleteBlock(id)
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPreloaded(t *testing.T) {
+	repo := NewMemory()
+	repo.AddSlot(1, "08:00:00", "08:50:00")
+	repo.AddSlot(2, "08:50:00", "09:40:00")
+	repo.AddStatic("A104", "TUE", 1, "FREE")
+	repo.AddStatic("A104", "TUE", 2, "FREE")
+	repo.AddStatic("B201", "TUE", 1, "FREE")
+	repo.AddStatic("B201", "TUE", 2, "19CSE302")
+	tuesday := time.Now().UTC().Truncate(24 * time.Hour)
+	for tuesday.Weekday() != time.Tuesday {
+		tuesday = tuesday.AddDate(0, 0, 1)
+	}
+	p := NewPreloaded(repo, time.Hour)
+
+	if got, want := p.GetFreeClass(1, tuesday), []string{"A104", "B201"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFreeClass = %v; want %v", got, want)
+	}
+	// Written behind its back, like by another server
+	repo.Booking("A104", tuesday, 1, "faculty@cb.amrita.edu", "19CSE311")
+	if got, want := p.GetFreeClass(1, tuesday), []string{"A104", "B201"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFreeClass = %v; want %v from memory", got, want)
+	}
+	lastYear := tuesday.AddDate(0, 0, -364)
+	repo.Booking("B201", lastYear, 1, "faculty@cb.amrita.edu", "19CSE311")
+	if got := p.GetFreeClass(1, lastYear); len(got) != 1 {
+		t.Errorf("GetFreeClass a year ago = %v; want it from the database", got)
+	}
+
+	p.Booking("B201", tuesday, 1, "faculty@cb.amrita.edu", "19CSE302")
+	// Its own booking lands in the copy, still without the one behind its back
+	if got, want := p.GetFreeClass(1, tuesday), []string{"A104"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFreeClass after booking = %v; want %v", got, want)
+	}
+	p.CancelBooking("B201", tuesday, 1)
+	if got, want := p.GetFreeRooms([]int{1}, []time.Time{tuesday, tuesday.AddDate(0, 0, 7)}), []string{"A104", "B201"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFreeRooms after cancelling = %v; want %v", got, want)
+	}
+	p.SetStatic(StaticEntry{Class: "B201", Day: "TUE", Slot: 2, Subject: "FREE"})
+	if got, want := p.GetFreeSlot("B201", tuesday), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFreeSlot after an edit = %v; want %v", got, want)
+	}
+	if got := p.GetFreeClass(1, tuesday); !reflect.DeepEqual(got, []string{"B201"}) {
+		t.Errorf("GetFreeClass after reloading = %v; want [B201]", got)
+	}
+	if got, want := p.GetTimetableByDay("A104", tuesday), []string{"19CSE311", "FREE"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetTimetableByDay = %v; want %v", got, want)
+	}
+	p.CreateBlock(Block{Class: "B201", StartDate: tuesday, EndDate: tuesday})
+	if got := p.MultiFreeSlot(2, 2, tuesday); !reflect.DeepEqual(got, []string{"A104"}) {
+		t.Errorf("MultiFreeSlot with B201 blocked = %v; want [A104]", got)
+	}
+}
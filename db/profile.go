@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+/*
+A Profile is what an identity provider said about a user when they last logged
+in, kept so the next login does not have to wait for the provider to say it
+again. Data is the provider's own encoding of it.
+*/
+type Profile struct {
+	Provider  string          `json:"provider"`
+	UserID    string          `json:"userId"`
+	Data      json.RawMessage `json:"data"`
+	FetchedAt time.Time       `json:"fetchedAt"`
+}
+
+// GetProfile returns sql.ErrNoRows when the user's profile has not been saved
+func GetProfile(dsn string, provider string, userID string) (Profile, error) {
+	profile := Profile{Provider: provider, UserID: userID}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return profile, err
+	}
+	defer db.Close()
+
+	var data []byte
+	err = db.QueryRow(`SELECT data, fetched_at FROM profile WHERE provider = ? AND
+    user_id = ?`, provider, userID).Scan(&data, &profile.FetchedAt)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	profile.Data = data
+	return profile, err
+}
+
+// SaveProfile stores profile in place of the one saved before
+func SaveProfile(dsn string, profile Profile) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO profile (provider, user_id, data, fetched_at)
+    VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data),
+    fetched_at = VALUES(fetched_at)`, profile.Provider, profile.UserID,
+		[]byte(profile.Data), profile.FetchedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
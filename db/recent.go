@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Timetable views are remembered alongside the SearchFreeClass, SearchFreeSlot and SearchMultiFreeSlot kinds
+const ViewTimetable = "TIMETABLE"
+
+/*
+RecentView is a search or timetable view of a logged in user, kept so that the
+app can offer it again as a shortcut on any device. Viewing the same class and
+slots again only moves it to the front.
+*/
+type RecentView struct {
+	Mail      string    `json:"-"`
+	Kind      string    `json:"kind"`
+	Class     string    `json:"class,omitempty"`
+	StartSlot int       `json:"startSlot,omitempty"`
+	EndSlot   int       `json:"endSlot,omitempty"`
+	Date      time.Time `json:"date"`
+	At        time.Time `json:"at"`
+}
+
+// Like searches, views are recorded on the way to the database by RunViewRecorder
+var recentViews = make(chan pendingView, 1024)
+
+// A view on its way to the database it belongs in
+type pendingView struct {
+	dsn  string
+	view RecentView
+}
+
+func RecordView(dsn string, view RecentView) {
+	if view.At.IsZero() {
+		view.At = time.Now()
+	}
+	select {
+	case recentViews <- pendingView{dsn, view}:
+	default:
+		log.Println("recent view buffer full, dropping view")
+	}
+}
+
+// RunViewRecorder blocks forever, so it has to be started in its own goroutine. It serves every Store.
+func RunViewRecorder() {
+	for pending := range recentViews {
+		err := upsertView(pending.dsn, pending.view)
+		if err != nil {
+			log.Println("Error recording recent view", err)
+		}
+	}
+}
+
+func upsertView(dsn string, view RecentView) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO recent_view (mail, kind, class_id, start_slot_id,
+    end_slot_id, date, viewed_at) VALUES (?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY
+    UPDATE date = VALUES(date), viewed_at = VALUES(viewed_at)`,
+		view.Mail, view.Kind, view.Class, view.StartSlot, view.EndSlot, view.Date, view.At)
+	return err
+}
+
+// GetRecentViews returns the limit latest views of mail, latest first
+func GetRecentViews(dsn string, mail string, limit int) ([]RecentView, error) {
+	var views []RecentView
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT kind, class_id, start_slot_id, end_slot_id, date,
+    viewed_at FROM recent_view WHERE mail = ? ORDER BY viewed_at DESC LIMIT ?`, mail, limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tmp := RecentView{Mail: mail}
+		err := rows.Scan(&tmp.Kind, &tmp.Class, &tmp.StartSlot, &tmp.EndSlot, &tmp.Date, &tmp.At)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		views = append(views, tmp)
+	}
+	return views, rows.Err()
+}
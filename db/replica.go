@@ -0,0 +1,68 @@
+package db
+
+import (
+	"database/sql/driver"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// How long the primary takes the reads of a replica that could not be reached before it is tried again
+const replicaRetry = 30 * time.Second
+
+type replicaState struct {
+	primary string
+	// For the log, the DSN holds the password
+	addr      string
+	downUntil time.Time
+}
+
+var replicas = struct {
+	mu sync.Mutex
+	// By the DSN of the replica
+	states map[string]*replicaState
+}{states: make(map[string]*replicaState)}
+
+// openMySQL opens a connection to dsn, replaced by the tests
+var openMySQL = mysql.MySQLDriver{}.Open
+
+func registerReplica(replica string, primary string, addr string) {
+	replicas.mu.Lock()
+	defer replicas.mu.Unlock()
+	replicas.states[replica] = &replicaState{primary: primary, addr: addr}
+}
+
+/*
+connect opens a connection to dsn. When dsn is a replica that can't be reached
+the connection goes to its primary instead, and so do the next ones until
+replicaRetry has passed, so reads keep working through a replica outage.
+*/
+func connect(dsn string) (driver.Conn, error) {
+	replicas.mu.Lock()
+	state, ok := replicas.states[dsn]
+	var primary string
+	down := false
+	if ok {
+		primary = state.primary
+		down = time.Now().Before(state.downUntil)
+	}
+	replicas.mu.Unlock()
+	if !ok {
+		return openMySQL(dsn)
+	}
+	if !down {
+		conn, err := openMySQL(dsn)
+		if err == nil {
+			return conn, nil
+		}
+		replicas.mu.Lock()
+		if !time.Now().Before(state.downUntil) {
+			log.Println("Replica", state.addr, "is down, reading from the primary for", replicaRetry, "-", err)
+		}
+		state.downUntil = time.Now().Add(replicaRetry)
+		replicas.mu.Unlock()
+	}
+	return openMySQL(primary)
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeConn struct {
+	driver.Conn
+	dsn string
+}
+
+func TestReplicaFallback(t *testing.T) {
+	replicaUp := true
+	var opened []string
+	open := openMySQL
+	defer func() { openMySQL = open }()
+	openMySQL = func(dsn string) (driver.Conn, error) {
+		opened = append(opened, dsn)
+		if dsn == "replica" && !replicaUp {
+			return nil, errors.New("connection refused")
+		}
+		return fakeConn{dsn: dsn}, nil
+	}
+	registerReplica("replica", "primary", "replica:3306")
+
+	connectTo := func() string {
+		conn, err := connect("replica")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn.(fakeConn).dsn
+	}
+	if dsn := connectTo(); dsn != "replica" {
+		t.Errorf("read went to %s with the replica up; want replica", dsn)
+	}
+	replicaUp = false
+	if dsn := connectTo(); dsn != "primary" {
+		t.Errorf("read went to %s with the replica down; want primary", dsn)
+	}
+	opened = nil
+	if dsn := connectTo(); dsn != "primary" || len(opened) != 1 {
+		t.Errorf("read went to %s after trying %v; want primary without trying the replica again", dsn, opened)
+	}
+	replicaUp = true
+	replicas.states["replica"].downUntil = time.Now()
+	if dsn := connectTo(); dsn != "replica" {
+		t.Errorf("read went to %s once the replica is retried; want replica", dsn)
+	}
+}
+
+func TestReplicaDSN(t *testing.T) {
+	if dsn := replicaDSN(Config{Name: "cora_amrita"}, "primary"); dsn != "" {
+		t.Errorf("replicaDSN without a replica = %q; want none", dsn)
+	}
+	dsn := replicaDSN(Config{Name: "cora_amrita", Password: "pw", Replica: &Config{Addr: "replica.internal:3306"}}, "primary")
+	if want := "cora:pw@tcp(replica.internal:3306)/cora_amrita?parseTime=true&timeout=2s"; dsn != want {
+		t.Errorf("replicaDSN = %q; want %q", dsn, want)
+	}
+}
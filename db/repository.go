@@ -0,0 +1,717 @@
+package db
+
+import "time"
+
+/*
+Repository is everything the HTTP handlers need from the database. The api
+package only talks to this interface so its handlers can be tested against a
+fake; Store is the MySQL implementation backed by the functions of this
+package.
+*/
+type Repository interface {
+	GetFreeClass(slot int, date time.Time) []string
+	GetFreeSlot(class string, date time.Time) []int
+	MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string
+	GetFreeRooms(slots []int, dates []time.Time) []string
+	GetTimetableByDay(class string, date time.Time) []string
+	GetAllSlot() []int
+	GetSlotTimes() ([]SlotTime, error)
+	GetAllClass() []string
+	ClassExists(class string) (bool, error)
+	GetAllSubject() []string
+	GetCatalog() (Catalog, error)
+
+	GetBooking(faculty string) []BookingRecord
+	Booking(class string, date time.Time, slot int, faculty string, subject string) (int64, error)
+	MultiBooking(class string, date time.Time, startSlot int, endSlot int, faculty string, subject string) (int64, error)
+	CancelBooking(class string, date time.Time, slot int) error
+	CancelBookingVersion(class string, date time.Time, slot int, version int) error
+	UpdateBooking(booking BookingRecord) error
+
+	RecordSearch(event SearchEvent)
+	GetSearchStats(startDate time.Time, endDate time.Time, limit int) (SearchStats, error)
+	EachSearchEvent(startDate time.Time, endDate time.Time, fn func(SearchEvent) error) error
+	GetUtilization(startDate time.Time, endDate time.Time, limit int) (Utilization, error)
+
+	CreateSession(session Session) error
+	GetSession(id string) (Session, error)
+	GetUserSessions(mail string) ([]Session, error)
+	DeleteSession(id string) error
+	TouchSession(id string, ip string, at time.Time) error
+	DeleteExpiredSessions(before time.Time) (int64, error)
+	GetRefreshTokens() (map[string]string, error)
+	ReplaceRefreshToken(id string, old string, new string) (bool, error)
+
+	SaveOAuthState(state OAuthState) error
+	TakeOAuthState(state string) (OAuthState, error)
+
+	CreateAPIKey(key APIKey) error
+	GetAPIKey(id string) (APIKey, error)
+	GetAllAPIKey() ([]APIKey, error)
+	RevokeAPIKey(id string, at time.Time) (int64, error)
+	RotateAPIKey(id string, replacement APIKey, oldExpiresAt time.Time) error
+	TouchAPIKey(id string, at time.Time) error
+
+	GetStatic(filter TimetableFilter) ([]StaticEntry, error)
+	SetStatic(entry StaticEntry) error
+	DeleteStatic(class string, day string, slot int) (int64, error)
+	GetBookings(filter BookingFilter) ([]BookingRecord, error)
+	GetActiveUsers(query string, limit int) ([]UserSummary, error)
+	GetDashboardCounts(now time.Time) (DashboardCounts, error)
+
+	CreateAnnouncement(announcement Announcement) (int64, error)
+	UpdateAnnouncement(announcement Announcement) error
+	DeleteAnnouncement(id int64) (int64, error)
+	GetAnnouncements(activeAt time.Time) ([]Announcement, error)
+
+	RecordAudit(event AuditEvent) error
+	GetAuditEvents(action string, limit int) ([]AuditEvent, error)
+	EachAuditEvent(action string, limit int, fn func(AuditEvent) error) error
+	GetUserAuditEvents(mail string, limit int) ([]AuditEvent, error)
+
+	AddFavorite(mail string, favorite Favorite) error
+	DeleteFavorite(mail string, kind string, target string) (int64, error)
+	GetFavorites(mail string) ([]Favorite, error)
+	GetFavoriteUsers(kind string, target string) ([]string, error)
+	GetFavoriteTargets(kind string) ([]string, error)
+
+	RecordView(view RecentView)
+	GetRecentViews(mail string, limit int) ([]RecentView, error)
+
+	GetPreferences(mail string) (string, error)
+	SetPreferences(mail string, data string, at time.Time) error
+	GetAllPreferences() (map[string]string, error)
+
+	CreateExams(exams []Exam) ([]int64, error)
+	UpdateExam(exam Exam) error
+	DeleteExam(id int64) (int64, error)
+	GetExams(startDate time.Time, endDate time.Time) ([]Exam, error)
+
+	GetClassrooms() ([]Classroom, error)
+	SetClassroom(classroom Classroom) error
+
+	SetOverride(override Override) error
+	DeleteOverride(class string, date time.Time, slot int) (int64, error)
+	GetOverrides(date time.Time, class string) ([]Override, error)
+
+	CreateChangeRequest(change ChangeRequest) (int64, error)
+	DecideChangeRequest(id int64, status string, by string, note string, at time.Time) error
+	GetChangeRequests(faculty string, status string) ([]ChangeRequest, error)
+
+	CreateBlock(block Block) (int64, error)
+	DeleteBlock(id int64) (int64, error)
+	GetBlocks(class string, startDate time.Time, endDate time.Time) ([]Block, error)
+
+	CreateEvent(event Event) (int64, error)
+	DeleteEvent(id int64) (int64, error)
+	GetEvents(filter EventFilter) ([]Event, error)
+	ApproveEvent(id int64) (int64, error)
+
+	GetClubs() ([]Club, error)
+	SetClub(club Club) error
+	DeleteClub(id string) (int64, error)
+
+	SetEquipment(equipment Equipment) error
+	DeleteEquipment(id string) (int64, error)
+	GetEquipment() ([]Equipment, error)
+	ReserveEquipment(reservations []EquipmentReservation) error
+	ReleaseEquipment(equipment string, date time.Time, slot int) (int64, error)
+	GetEquipmentReservations(date time.Time, slot int) ([]EquipmentReservation, error)
+
+	JoinWaitlist(entry WaitlistEntry) (int64, error)
+	LeaveWaitlist(id int64) (int64, error)
+	GetWaitlist(filter WaitlistFilter) ([]WaitlistEntry, error)
+
+	CreateCheckIn(checkIn CheckIn) error
+	MarkCheckedIn(class string, date time.Time, slot int, at time.Time) error
+	GetCheckIns(class string, date time.Time) ([]CheckIn, error)
+
+	SetAttendance(class string, date time.Time, slot int, records []AttendanceRecord) error
+	GetAttendance(filter AttendanceFilter) ([]AttendanceRecord, error)
+
+	CreateAssignment(assignment Assignment) (int64, error)
+	UpdateAssignment(assignment Assignment) error
+	DeleteAssignment(id int64) (int64, error)
+	MarkAssignmentReminded(id int64) error
+	GetAssignments(filter AssignmentFilter) ([]Assignment, error)
+
+	CreateAttachment(attachment Attachment) error
+	GetAttachment(id string) (Attachment, error)
+	DeleteAttachment(id string) (int64, error)
+
+	GetCampuses() ([]Campus, error)
+	SetCampus(campus Campus) error
+	DeleteCampus(id string) (int64, error)
+
+	GetBuildings() ([]Building, error)
+	SetBuilding(building Building) error
+	DeleteBuilding(id string) (int64, error)
+	GetBuildingPaths() ([]BuildingPath, error)
+	SetBuildingPath(path BuildingPath) error
+	DeleteBuildingPath(from, to string) (int64, error)
+
+	GetRoomAliases() ([]RoomAlias, error)
+	SetRoomAlias(alias RoomAlias) error
+	DeleteRoomAlias(alias string) (int64, error)
+
+	GetTeamsChannels() ([]TeamsChannel, error)
+	SetTeamsChannel(channel TeamsChannel) error
+	DeleteTeamsChannel(section string) (int64, error)
+
+	GetOfficeHours(faculty string) ([]OfficeHour, error)
+	SetOfficeHours(faculty string, hours []OfficeHour) error
+	CreateAppointment(appointment Appointment) (int64, error)
+	DecideAppointment(id int64, status string, reply string, at time.Time) error
+	GetAppointments(filter AppointmentFilter) ([]Appointment, error)
+
+	GetEnrollments(filter EnrollmentFilter) ([]Enrollment, error)
+	SetEnrollments(subjects []string, enrollments []Enrollment) error
+	DeleteEnrollments(subject string) (int64, error)
+
+	GetCustomEntries(mail string) ([]CustomEntry, error)
+	CreateCustomEntry(entry CustomEntry) (int64, error)
+	DeleteCustomEntry(mail string, id int64) (int64, error)
+
+	AddNotification(notification Notification) (int64, error)
+	GetNotifications(mail string, unread bool, limit int) ([]Notification, error)
+	CountUnreadNotifications(mail string) (int, error)
+	MarkNotificationsRead(mail string, ids []int64, at time.Time) (int64, error)
+	PurgeNotifications(before time.Time) (int64, error)
+
+	AddText(text Text) (int64, error)
+	UpdateText(id int64, providerID string, status string, errText string, at time.Time) error
+	ClaimText(id int64, from string, to string, at time.Time) (bool, error)
+	SetTextStatus(providerID string, status string, errText string, at time.Time) (int64, error)
+	GetTexts(filter TextFilter) ([]Text, error)
+
+	CreateFeedback(feedback Feedback) (int64, error)
+	GetFeedback(filter FeedbackFilter) ([]Feedback, error)
+	CloseFeedback(id int64, status string, by string, note string, at time.Time) error
+
+	CreateErasureRequest(request ErasureRequest) (int64, error)
+	GetErasureRequests(mail string, status string) ([]ErasureRequest, error)
+	DecideErasureRequest(id int64, status string, by string, note string, at time.Time) error
+	EraseUser(mail string) (int64, error)
+
+	CountExpired(kind string, before time.Time) (int64, error)
+	PurgeExpired(kind string, before time.Time) (int64, error)
+
+	CreateBackup(backup Backup) error
+	GetBackups() ([]Backup, error)
+	GetBackup(id string) (Backup, error)
+	DeleteBackup(id string) (int64, error)
+
+	SetSubject(id string, name string) error
+	SetFaculty(id string, name string) error
+
+	AddTrash(item TrashItem) (int64, error)
+	GetTrash(kind string) ([]TrashItem, error)
+	GetTrashItem(id int64) (TrashItem, error)
+	DeleteTrash(id int64) (int64, error)
+	PurgeTrash(before time.Time) (int64, error)
+
+	CreateTimetableVersion(version TimetableVersion) (int64, error)
+	GetTimetableVersions(semester string) ([]TimetableVersion, error)
+	GetTimetableVersion(id int64) (TimetableVersion, error)
+	DeleteTimetableVersion(id int64) (int64, error)
+	ReplaceStatic(entries []StaticEntry) error
+
+	GetProfile(provider string, userID string) (Profile, error)
+	SaveProfile(profile Profile) error
+
+	SaveUser(user User) (int64, error)
+	GetUser(id int64) (User, error)
+	GetUsers(filter UserFilter) ([]User, error)
+	DisableUser(provider string, externalID string) (int64, error)
+	GetDirectoryDelta(provider string) (string, error)
+	SaveDirectoryDelta(provider string, deltaLink string, syncedAt time.Time) error
+	ReplaceGroupMembers(provider string, members []GroupMember) error
+	GetGroupMembers(filter GroupMemberFilter) ([]GroupMember, error)
+
+	RecordSecurityEvent(event SecurityEvent) error
+	GetSecurityEvents(filter SecurityEventFilter) ([]SecurityEvent, error)
+}
+
+/*
+Store is the MySQL Repository. The zero Store uses the database set with
+Configure; NewStore makes one bound to a database of its own, which is how the
+institutions of a multi-tenant deployment are kept apart.
+*/
+type Store struct {
+	dsn     string
+	replica string
+}
+
+// NewStore returns a Store on the database cfg describes
+func NewStore(cfg Config) Store {
+	dsn := formatDSN(cfg)
+	return Store{dsn: dsn, replica: replicaDSN(cfg, dsn)}
+}
+
+func (s Store) dataSource() string {
+	if s.dsn == "" {
+		return dataSourceName
+	}
+	return s.dsn
+}
+
+/*
+readSource is where the read-only timetable and analytics queries go: the
+replica when there is one, which falls back to the primary while it is down
+(see connect). Anything read to be written back, or right after a user's own
+write, stays on dataSource since the replica may lag.
+*/
+func (s Store) readSource() string {
+	replica := s.replica
+	if s.dsn == "" {
+		replica = replicaSourceName
+	}
+	if replica == "" {
+		return s.dataSource()
+	}
+	return replica
+}
+
+var _ Repository = Store{}
+
+func (s Store) GetFreeClass(slot int, date time.Time) []string {
+	return GetFreeClass(s.readSource(), slot, date)
+}
+func (s Store) GetFreeSlot(class string, date time.Time) []int {
+	return GetFreeSlot(s.readSource(), class, date)
+}
+func (s Store) MultiFreeSlot(startSlot int, endSlot int, date time.Time) []string {
+	return MultiFreeSlot(s.readSource(), startSlot, endSlot, date)
+}
+func (s Store) GetFreeRooms(slots []int, dates []time.Time) []string {
+	return GetFreeRooms(s.readSource(), slots, dates)
+}
+func (s Store) GetTimetableByDay(class string, date time.Time) []string {
+	return GetTimetableByDay(s.readSource(), class, date)
+}
+func (s Store) GetAllSlot() []int                         { return GetAllSlot(s.readSource()) }
+func (s Store) GetSlotTimes() ([]SlotTime, error)         { return GetSlotTimes(s.readSource()) }
+func (s Store) GetAllClass() []string                     { return GetAllClass(s.readSource()) }
+func (s Store) GetAllSubject() []string                   { return GetAllSubject(s.readSource()) }
+func (s Store) GetCatalog() (Catalog, error)              { return GetCatalog(s.readSource()) }
+func (s Store) GetBooking(faculty string) []BookingRecord { return GetBooking(s.dataSource(), faculty) }
+func (s Store) ClassExists(class string) (bool, error) {
+	return ClassExists(s.readSource(), class)
+}
+func (s Store) Booking(class string, date time.Time, slot int, faculty string, subject string) (int64, error) {
+	return Booking(s.dataSource(), class, date, slot, faculty, subject)
+}
+func (s Store) MultiBooking(class string, date time.Time, startSlot int, endSlot int, faculty string, subject string) (int64, error) {
+	return MultiBooking(s.dataSource(), class, date, startSlot, endSlot, faculty, subject)
+}
+func (s Store) CancelBooking(class string, date time.Time, slot int) error {
+	return CancelBooking(s.dataSource(), class, date, slot)
+}
+func (s Store) CancelBookingVersion(class string, date time.Time, slot int, version int) error {
+	return CancelBookingVersion(s.dataSource(), class, date, slot, version)
+}
+func (s Store) UpdateBooking(booking BookingRecord) error {
+	return UpdateBooking(s.dataSource(), booking)
+}
+
+func (s Store) RecordSearch(event SearchEvent) { RecordSearch(s.dataSource(), event) }
+func (s Store) GetSearchStats(startDate time.Time, endDate time.Time, limit int) (SearchStats, error) {
+	return GetSearchStats(s.readSource(), startDate, endDate, limit)
+}
+func (s Store) EachSearchEvent(startDate time.Time, endDate time.Time, fn func(SearchEvent) error) error {
+	return EachSearchEvent(s.readSource(), startDate, endDate, fn)
+}
+func (s Store) GetUtilization(startDate time.Time, endDate time.Time, limit int) (Utilization, error) {
+	return GetUtilization(s.readSource(), startDate, endDate, limit)
+}
+
+func (s Store) CreateSession(session Session) error   { return CreateSession(s.dataSource(), session) }
+func (s Store) GetSession(id string) (Session, error) { return GetSession(s.dataSource(), id) }
+func (s Store) GetUserSessions(mail string) ([]Session, error) {
+	return GetUserSessions(s.dataSource(), mail)
+}
+func (s Store) DeleteSession(id string) error { return DeleteSession(s.dataSource(), id) }
+func (s Store) TouchSession(id string, ip string, at time.Time) error {
+	return TouchSession(s.dataSource(), id, ip, at)
+}
+func (s Store) DeleteExpiredSessions(before time.Time) (int64, error) {
+	return DeleteExpiredSessions(s.dataSource(), before)
+}
+func (s Store) GetRefreshTokens() (map[string]string, error) {
+	return GetRefreshTokens(s.dataSource())
+}
+func (s Store) ReplaceRefreshToken(id string, old string, new string) (bool, error) {
+	return ReplaceRefreshToken(s.dataSource(), id, old, new)
+}
+
+func (s Store) SaveOAuthState(state OAuthState) error { return SaveOAuthState(s.dataSource(), state) }
+func (s Store) TakeOAuthState(state string) (OAuthState, error) {
+	return TakeOAuthState(s.dataSource(), state)
+}
+
+func (s Store) CreateAPIKey(key APIKey) error       { return CreateAPIKey(s.dataSource(), key) }
+func (s Store) GetAPIKey(id string) (APIKey, error) { return GetAPIKey(s.dataSource(), id) }
+func (s Store) GetAllAPIKey() ([]APIKey, error)     { return GetAllAPIKey(s.dataSource()) }
+func (s Store) RevokeAPIKey(id string, at time.Time) (int64, error) {
+	return RevokeAPIKey(s.dataSource(), id, at)
+}
+func (s Store) RotateAPIKey(id string, replacement APIKey, oldExpiresAt time.Time) error {
+	return RotateAPIKey(s.dataSource(), id, replacement, oldExpiresAt)
+}
+func (s Store) TouchAPIKey(id string, at time.Time) error { return TouchAPIKey(s.dataSource(), id, at) }
+
+func (s Store) GetStatic(filter TimetableFilter) ([]StaticEntry, error) {
+	return GetStatic(s.dataSource(), filter)
+}
+func (s Store) SetStatic(entry StaticEntry) error { return SetStatic(s.dataSource(), entry) }
+func (s Store) DeleteStatic(class string, day string, slot int) (int64, error) {
+	return DeleteStatic(s.dataSource(), class, day, slot)
+}
+func (s Store) GetBookings(filter BookingFilter) ([]BookingRecord, error) {
+	return GetBookings(s.dataSource(), filter)
+}
+func (s Store) GetActiveUsers(query string, limit int) ([]UserSummary, error) {
+	return GetActiveUsers(s.dataSource(), query, limit)
+}
+func (s Store) GetDashboardCounts(now time.Time) (DashboardCounts, error) {
+	return GetDashboardCounts(s.dataSource(), now)
+}
+
+func (s Store) CreateAnnouncement(announcement Announcement) (int64, error) {
+	return CreateAnnouncement(s.dataSource(), announcement)
+}
+func (s Store) UpdateAnnouncement(announcement Announcement) error {
+	return UpdateAnnouncement(s.dataSource(), announcement)
+}
+func (s Store) DeleteAnnouncement(id int64) (int64, error) {
+	return DeleteAnnouncement(s.dataSource(), id)
+}
+func (s Store) GetAnnouncements(activeAt time.Time) ([]Announcement, error) {
+	return GetAnnouncements(s.dataSource(), activeAt)
+}
+
+func (s Store) RecordAudit(event AuditEvent) error { return RecordAudit(s.dataSource(), event) }
+func (s Store) GetAuditEvents(action string, limit int) ([]AuditEvent, error) {
+	return GetAuditEvents(s.dataSource(), action, limit)
+}
+func (s Store) EachAuditEvent(action string, limit int, fn func(AuditEvent) error) error {
+	return EachAuditEvent(s.dataSource(), action, limit, fn)
+}
+func (s Store) GetUserAuditEvents(mail string, limit int) ([]AuditEvent, error) {
+	return GetUserAuditEvents(s.dataSource(), mail, limit)
+}
+
+func (s Store) AddFavorite(mail string, favorite Favorite) error {
+	return AddFavorite(s.dataSource(), mail, favorite)
+}
+func (s Store) DeleteFavorite(mail string, kind string, target string) (int64, error) {
+	return DeleteFavorite(s.dataSource(), mail, kind, target)
+}
+func (s Store) GetFavorites(mail string) ([]Favorite, error) {
+	return GetFavorites(s.dataSource(), mail)
+}
+func (s Store) GetFavoriteUsers(kind string, target string) ([]string, error) {
+	return GetFavoriteUsers(s.dataSource(), kind, target)
+}
+func (s Store) GetFavoriteTargets(kind string) ([]string, error) {
+	return GetFavoriteTargets(s.dataSource(), kind)
+}
+
+func (s Store) RecordView(view RecentView) { RecordView(s.dataSource(), view) }
+func (s Store) GetRecentViews(mail string, limit int) ([]RecentView, error) {
+	return GetRecentViews(s.dataSource(), mail, limit)
+}
+
+func (s Store) GetPreferences(mail string) (string, error) {
+	return GetPreferences(s.dataSource(), mail)
+}
+func (s Store) SetPreferences(mail string, data string, at time.Time) error {
+	return SetPreferences(s.dataSource(), mail, data, at)
+}
+func (s Store) GetAllPreferences() (map[string]string, error) {
+	return GetAllPreferences(s.readSource())
+}
+
+func (s Store) CreateExams(exams []Exam) ([]int64, error) { return CreateExams(s.dataSource(), exams) }
+func (s Store) UpdateExam(exam Exam) error                { return UpdateExam(s.dataSource(), exam) }
+func (s Store) DeleteExam(id int64) (int64, error)        { return DeleteExam(s.dataSource(), id) }
+func (s Store) GetExams(startDate time.Time, endDate time.Time) ([]Exam, error) {
+	return GetExams(s.dataSource(), startDate, endDate)
+}
+
+func (s Store) GetClassrooms() ([]Classroom, error) { return GetClassrooms(s.readSource()) }
+func (s Store) SetClassroom(classroom Classroom) error {
+	return SetClassroom(s.dataSource(), classroom)
+}
+
+func (s Store) SetOverride(override Override) error { return SetOverride(s.dataSource(), override) }
+func (s Store) DeleteOverride(class string, date time.Time, slot int) (int64, error) {
+	return DeleteOverride(s.dataSource(), class, date, slot)
+}
+func (s Store) GetOverrides(date time.Time, class string) ([]Override, error) {
+	return GetOverrides(s.dataSource(), date, class)
+}
+
+func (s Store) CreateChangeRequest(change ChangeRequest) (int64, error) {
+	return CreateChangeRequest(s.dataSource(), change)
+}
+func (s Store) DecideChangeRequest(id int64, status string, by string, note string, at time.Time) error {
+	return DecideChangeRequest(s.dataSource(), id, status, by, note, at)
+}
+func (s Store) GetChangeRequests(faculty string, status string) ([]ChangeRequest, error) {
+	return GetChangeRequests(s.dataSource(), faculty, status)
+}
+
+func (s Store) CreateBlock(block Block) (int64, error) { return CreateBlock(s.dataSource(), block) }
+func (s Store) DeleteBlock(id int64) (int64, error)    { return DeleteBlock(s.dataSource(), id) }
+func (s Store) GetBlocks(class string, startDate time.Time, endDate time.Time) ([]Block, error) {
+	return GetBlocks(s.dataSource(), class, startDate, endDate)
+}
+
+func (s Store) CreateEvent(event Event) (int64, error) { return CreateEvent(s.dataSource(), event) }
+func (s Store) DeleteEvent(id int64) (int64, error)    { return DeleteEvent(s.dataSource(), id) }
+func (s Store) GetEvents(filter EventFilter) ([]Event, error) {
+	return GetEvents(s.dataSource(), filter)
+}
+func (s Store) ApproveEvent(id int64) (int64, error) { return ApproveEvent(s.dataSource(), id) }
+
+func (s Store) GetClubs() ([]Club, error)           { return GetClubs(s.readSource()) }
+func (s Store) SetClub(club Club) error             { return SetClub(s.dataSource(), club) }
+func (s Store) DeleteClub(id string) (int64, error) { return DeleteClub(s.dataSource(), id) }
+
+func (s Store) SetEquipment(equipment Equipment) error {
+	return SetEquipment(s.dataSource(), equipment)
+}
+func (s Store) DeleteEquipment(id string) (int64, error) { return DeleteEquipment(s.dataSource(), id) }
+func (s Store) GetEquipment() ([]Equipment, error)       { return GetEquipment(s.dataSource()) }
+func (s Store) ReserveEquipment(reservations []EquipmentReservation) error {
+	return ReserveEquipment(s.dataSource(), reservations)
+}
+func (s Store) ReleaseEquipment(equipment string, date time.Time, slot int) (int64, error) {
+	return ReleaseEquipment(s.dataSource(), equipment, date, slot)
+}
+func (s Store) GetEquipmentReservations(date time.Time, slot int) ([]EquipmentReservation, error) {
+	return GetEquipmentReservations(s.dataSource(), date, slot)
+}
+
+func (s Store) JoinWaitlist(entry WaitlistEntry) (int64, error) {
+	return JoinWaitlist(s.dataSource(), entry)
+}
+func (s Store) LeaveWaitlist(id int64) (int64, error) { return LeaveWaitlist(s.dataSource(), id) }
+func (s Store) GetWaitlist(filter WaitlistFilter) ([]WaitlistEntry, error) {
+	return GetWaitlist(s.dataSource(), filter)
+}
+
+func (s Store) CreateCheckIn(checkIn CheckIn) error { return CreateCheckIn(s.dataSource(), checkIn) }
+func (s Store) MarkCheckedIn(class string, date time.Time, slot int, at time.Time) error {
+	return MarkCheckedIn(s.dataSource(), class, date, slot, at)
+}
+func (s Store) GetCheckIns(class string, date time.Time) ([]CheckIn, error) {
+	return GetCheckIns(s.dataSource(), class, date)
+}
+
+func (s Store) SetAttendance(class string, date time.Time, slot int, records []AttendanceRecord) error {
+	return SetAttendance(s.dataSource(), class, date, slot, records)
+}
+func (s Store) GetAttendance(filter AttendanceFilter) ([]AttendanceRecord, error) {
+	return GetAttendance(s.dataSource(), filter)
+}
+
+func (s Store) CreateAssignment(assignment Assignment) (int64, error) {
+	return CreateAssignment(s.dataSource(), assignment)
+}
+func (s Store) UpdateAssignment(assignment Assignment) error {
+	return UpdateAssignment(s.dataSource(), assignment)
+}
+func (s Store) DeleteAssignment(id int64) (int64, error) { return DeleteAssignment(s.dataSource(), id) }
+func (s Store) MarkAssignmentReminded(id int64) error {
+	return MarkAssignmentReminded(s.dataSource(), id)
+}
+func (s Store) GetAssignments(filter AssignmentFilter) ([]Assignment, error) {
+	return GetAssignments(s.dataSource(), filter)
+}
+
+func (s Store) CreateAttachment(attachment Attachment) error {
+	return CreateAttachment(s.dataSource(), attachment)
+}
+func (s Store) GetAttachment(id string) (Attachment, error) { return GetAttachment(s.dataSource(), id) }
+func (s Store) DeleteAttachment(id string) (int64, error) {
+	return DeleteAttachment(s.dataSource(), id)
+}
+
+func (s Store) GetCampuses() ([]Campus, error)        { return GetCampuses(s.readSource()) }
+func (s Store) SetCampus(campus Campus) error         { return SetCampus(s.dataSource(), campus) }
+func (s Store) DeleteCampus(id string) (int64, error) { return DeleteCampus(s.dataSource(), id) }
+func (s Store) GetRoomAliases() ([]RoomAlias, error)  { return GetRoomAliases(s.readSource()) }
+func (s Store) SetRoomAlias(alias RoomAlias) error    { return SetRoomAlias(s.dataSource(), alias) }
+func (s Store) DeleteRoomAlias(alias string) (int64, error) {
+	return DeleteRoomAlias(s.dataSource(), alias)
+}
+func (s Store) GetTeamsChannels() ([]TeamsChannel, error) { return GetTeamsChannels(s.readSource()) }
+func (s Store) SetTeamsChannel(channel TeamsChannel) error {
+	return SetTeamsChannel(s.dataSource(), channel)
+}
+func (s Store) DeleteTeamsChannel(section string) (int64, error) {
+	return DeleteTeamsChannel(s.dataSource(), section)
+}
+
+func (s Store) GetBuildings() ([]Building, error)   { return GetBuildings(s.readSource()) }
+func (s Store) SetBuilding(building Building) error { return SetBuilding(s.dataSource(), building) }
+func (s Store) DeleteBuilding(id string) (int64, error) {
+	return DeleteBuilding(s.dataSource(), id)
+}
+func (s Store) GetBuildingPaths() ([]BuildingPath, error) { return GetBuildingPaths(s.readSource()) }
+func (s Store) SetBuildingPath(path BuildingPath) error   { return SetBuildingPath(s.dataSource(), path) }
+func (s Store) DeleteBuildingPath(from, to string) (int64, error) {
+	return DeleteBuildingPath(s.dataSource(), from, to)
+}
+
+func (s Store) GetOfficeHours(faculty string) ([]OfficeHour, error) {
+	return GetOfficeHours(s.readSource(), faculty)
+}
+func (s Store) SetOfficeHours(faculty string, hours []OfficeHour) error {
+	return SetOfficeHours(s.dataSource(), faculty, hours)
+}
+func (s Store) CreateAppointment(appointment Appointment) (int64, error) {
+	return CreateAppointment(s.dataSource(), appointment)
+}
+func (s Store) DecideAppointment(id int64, status string, reply string, at time.Time) error {
+	return DecideAppointment(s.dataSource(), id, status, reply, at)
+}
+func (s Store) GetAppointments(filter AppointmentFilter) ([]Appointment, error) {
+	return GetAppointments(s.readSource(), filter)
+}
+
+func (s Store) GetEnrollments(filter EnrollmentFilter) ([]Enrollment, error) {
+	return GetEnrollments(s.readSource(), filter)
+}
+func (s Store) SetEnrollments(subjects []string, enrollments []Enrollment) error {
+	return SetEnrollments(s.dataSource(), subjects, enrollments)
+}
+func (s Store) DeleteEnrollments(subject string) (int64, error) {
+	return DeleteEnrollments(s.dataSource(), subject)
+}
+
+func (s Store) GetCustomEntries(mail string) ([]CustomEntry, error) {
+	return GetCustomEntries(s.readSource(), mail)
+}
+func (s Store) CreateCustomEntry(entry CustomEntry) (int64, error) {
+	return CreateCustomEntry(s.dataSource(), entry)
+}
+func (s Store) DeleteCustomEntry(mail string, id int64) (int64, error) {
+	return DeleteCustomEntry(s.dataSource(), mail, id)
+}
+
+func (s Store) AddNotification(notification Notification) (int64, error) {
+	return AddNotification(s.dataSource(), notification)
+}
+func (s Store) GetNotifications(mail string, unread bool, limit int) ([]Notification, error) {
+	return GetNotifications(s.readSource(), mail, unread, limit)
+}
+func (s Store) CountUnreadNotifications(mail string) (int, error) {
+	return CountUnreadNotifications(s.readSource(), mail)
+}
+func (s Store) MarkNotificationsRead(mail string, ids []int64, at time.Time) (int64, error) {
+	return MarkNotificationsRead(s.dataSource(), mail, ids, at)
+}
+func (s Store) PurgeNotifications(before time.Time) (int64, error) {
+	return PurgeNotifications(s.dataSource(), before)
+}
+func (s Store) AddText(text Text) (int64, error) { return AddText(s.dataSource(), text) }
+func (s Store) UpdateText(id int64, providerID string, status string, errText string, at time.Time) error {
+	return UpdateText(s.dataSource(), id, providerID, status, errText, at)
+}
+func (s Store) ClaimText(id int64, from string, to string, at time.Time) (bool, error) {
+	return ClaimText(s.dataSource(), id, from, to, at)
+}
+func (s Store) SetTextStatus(providerID string, status string, errText string, at time.Time) (int64, error) {
+	return SetTextStatus(s.dataSource(), providerID, status, errText, at)
+}
+func (s Store) GetTexts(filter TextFilter) ([]Text, error) { return GetTexts(s.dataSource(), filter) }
+
+func (s Store) CreateFeedback(feedback Feedback) (int64, error) {
+	return CreateFeedback(s.dataSource(), feedback)
+}
+func (s Store) GetFeedback(filter FeedbackFilter) ([]Feedback, error) {
+	return GetFeedback(s.dataSource(), filter)
+}
+func (s Store) CloseFeedback(id int64, status string, by string, note string, at time.Time) error {
+	return CloseFeedback(s.dataSource(), id, status, by, note, at)
+}
+
+func (s Store) CreateErasureRequest(request ErasureRequest) (int64, error) {
+	return CreateErasureRequest(s.dataSource(), request)
+}
+func (s Store) GetErasureRequests(mail string, status string) ([]ErasureRequest, error) {
+	return GetErasureRequests(s.dataSource(), mail, status)
+}
+func (s Store) DecideErasureRequest(id int64, status string, by string, note string, at time.Time) error {
+	return DecideErasureRequest(s.dataSource(), id, status, by, note, at)
+}
+func (s Store) EraseUser(mail string) (int64, error) { return EraseUser(s.dataSource(), mail) }
+
+func (s Store) CountExpired(kind string, before time.Time) (int64, error) {
+	return CountExpired(s.readSource(), kind, before)
+}
+func (s Store) PurgeExpired(kind string, before time.Time) (int64, error) {
+	return PurgeExpired(s.dataSource(), kind, before)
+}
+
+func (s Store) CreateBackup(backup Backup) error        { return CreateBackup(s.dataSource(), backup) }
+func (s Store) GetBackups() ([]Backup, error)           { return GetBackups(s.dataSource()) }
+func (s Store) GetBackup(id string) (Backup, error)     { return GetBackup(s.dataSource(), id) }
+func (s Store) DeleteBackup(id string) (int64, error)   { return DeleteBackup(s.dataSource(), id) }
+func (s Store) SetSubject(id string, name string) error { return SetSubject(s.dataSource(), id, name) }
+func (s Store) SetFaculty(id string, name string) error { return SetFaculty(s.dataSource(), id, name) }
+
+func (s Store) AddTrash(item TrashItem) (int64, error)     { return AddTrash(s.dataSource(), item) }
+func (s Store) GetTrash(kind string) ([]TrashItem, error)  { return GetTrash(s.dataSource(), kind) }
+func (s Store) GetTrashItem(id int64) (TrashItem, error)   { return GetTrashItem(s.dataSource(), id) }
+func (s Store) DeleteTrash(id int64) (int64, error)        { return DeleteTrash(s.dataSource(), id) }
+func (s Store) PurgeTrash(before time.Time) (int64, error) { return PurgeTrash(s.dataSource(), before) }
+
+func (s Store) CreateTimetableVersion(version TimetableVersion) (int64, error) {
+	return CreateTimetableVersion(s.dataSource(), version)
+}
+func (s Store) GetTimetableVersions(semester string) ([]TimetableVersion, error) {
+	return GetTimetableVersions(s.dataSource(), semester)
+}
+func (s Store) GetTimetableVersion(id int64) (TimetableVersion, error) {
+	return GetTimetableVersion(s.dataSource(), id)
+}
+func (s Store) DeleteTimetableVersion(id int64) (int64, error) {
+	return DeleteTimetableVersion(s.dataSource(), id)
+}
+func (s Store) ReplaceStatic(entries []StaticEntry) error {
+	return ReplaceStatic(s.dataSource(), entries)
+}
+func (s Store) GetProfile(provider string, userID string) (Profile, error) {
+	return GetProfile(s.dataSource(), provider, userID)
+}
+func (s Store) SaveProfile(profile Profile) error { return SaveProfile(s.dataSource(), profile) }
+
+func (s Store) SaveUser(user User) (int64, error)          { return SaveUser(s.dataSource(), user) }
+func (s Store) GetUser(id int64) (User, error)             { return GetUser(s.dataSource(), id) }
+func (s Store) GetUsers(filter UserFilter) ([]User, error) { return GetUsers(s.dataSource(), filter) }
+func (s Store) DisableUser(provider string, externalID string) (int64, error) {
+	return DisableUser(s.dataSource(), provider, externalID)
+}
+func (s Store) GetDirectoryDelta(provider string) (string, error) {
+	return GetDirectoryDelta(s.dataSource(), provider)
+}
+func (s Store) SaveDirectoryDelta(provider string, deltaLink string, syncedAt time.Time) error {
+	return SaveDirectoryDelta(s.dataSource(), provider, deltaLink, syncedAt)
+}
+func (s Store) ReplaceGroupMembers(provider string, members []GroupMember) error {
+	return ReplaceGroupMembers(s.dataSource(), provider, members)
+}
+func (s Store) GetGroupMembers(filter GroupMemberFilter) ([]GroupMember, error) {
+	return GetGroupMembers(s.readSource(), filter)
+}
+
+func (s Store) RecordSecurityEvent(event SecurityEvent) error {
+	return RecordSecurityEvent(s.dataSource(), event)
+}
+func (s Store) GetSecurityEvents(filter SecurityEventFilter) ([]SecurityEvent, error) {
+	return GetSecurityEvents(s.dataSource(), filter)
+}
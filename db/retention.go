@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Kinds of data kept for a retention period, see CountExpired and PurgeExpired
+const (
+	// Bookings, by their date
+	RetainBookings = "bookings"
+	// The audit log, by when changes were made
+	RetainAudit = "audit"
+	// The search events analytics are computed from, by when they were searched
+	RetainSearches = "searches"
+	// Sessions, by when they were last used
+	RetainSessions = "sessions"
+)
+
+// RetainedKinds lists the kinds of data a retention period can be set for
+var RetainedKinds = []string{RetainBookings, RetainAudit, RetainSearches, RetainSessions}
+
+// The table and column the age of each kind of data is told by
+var retainedColumns = map[string][2]string{
+	RetainBookings: {"dynamic", "date"},
+	RetainAudit:    {"audit_event", "at"},
+	RetainSearches: {"search_event", "searched_at"},
+	RetainSessions: {"session", "last_active_at"},
+}
+
+func retainedColumn(kind string) ([2]string, error) {
+	column, ok := retainedColumns[kind]
+	if !ok {
+		return column, fmt.Errorf("no retention for %q", kind)
+	}
+	return column, nil
+}
+
+// CountExpired counts the rows of kind older than before, which PurgeExpired would delete
+func CountExpired(dsn string, kind string, before time.Time) (int64, error) {
+	column, err := retainedColumn(kind)
+	if err != nil {
+		return 0, err
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	var count int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM `+column[0]+` WHERE `+column[1]+` < ?`, before).Scan(&count)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return count, nil
+}
+
+/*
+PurgeExpired deletes the rows of kind older than before and returns how many
+there were. Check-ins and equipment reservations go with their bookings.
+*/
+func PurgeExpired(dsn string, kind string, before time.Time) (int64, error) {
+	column, err := retainedColumn(kind)
+	if err != nil {
+		return 0, err
+	}
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM `+column[0]+` WHERE `+column[1]+` < ?`, before)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
@@ -0,0 +1,3 @@
+-- Upgrades a database created before appointments had a time within their slot
+ALTER TABLE appointment ADD COLUMN start_at DATETIME NOT NULL AFTER slot_id,
+    ADD COLUMN end_at DATETIME NOT NULL AFTER start_at;
@@ -0,0 +1,11 @@
+-- Upgrades a database created before admins could take backups
+CREATE TABLE IF NOT EXISTS db_backup (
+    id CHAR(32),
+    size BIGINT NOT NULL,
+    periods INT NOT NULL,
+    classrooms INT NOT NULL,
+    bookings INT NOT NULL,
+    created_by VARCHAR(254) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,2 @@
+-- Upgrades a database created before bookings were checked against versions
+ALTER TABLE dynamic ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,14 @@
+-- Upgrades a database created before buildings had coordinates and walking paths
+CREATE TABLE IF NOT EXISTS building (
+    id VARCHAR(32),
+    name VARCHAR(64) NOT NULL,
+    latitude DOUBLE,
+    longitude DOUBLE,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS building_path (
+    from_id VARCHAR(32),
+    to_id VARCHAR(32),
+    minutes INT NOT NULL,
+    PRIMARY KEY (from_id, to_id)
+);
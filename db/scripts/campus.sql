@@ -0,0 +1,24 @@
+-- Upgrades a database created before campuses were supported
+SET FOREIGN_KEY_CHECKS = 0;
+ALTER TABLE static MODIFY class_id VARCHAR(16);
+ALTER TABLE dynamic MODIFY class_id VARCHAR(16);
+ALTER TABLE search_event MODIFY class_id VARCHAR(16);
+ALTER TABLE recent_view MODIFY class_id VARCHAR(16) NOT NULL DEFAULT "";
+ALTER TABLE exam_hall MODIFY class_id VARCHAR(16);
+ALTER TABLE classroom MODIFY id VARCHAR(16);
+ALTER TABLE class_override MODIFY class_id VARCHAR(16), MODIFY room_id VARCHAR(16);
+ALTER TABLE change_request MODIFY class_id VARCHAR(16) NOT NULL, MODIFY new_class_id VARCHAR(16) NOT NULL;
+ALTER TABLE room_block MODIFY class_id VARCHAR(16) NOT NULL;
+ALTER TABLE event MODIFY class_id VARCHAR(16) NOT NULL;
+ALTER TABLE equipment MODIFY home_class_id VARCHAR(16);
+ALTER TABLE equipment_reservation MODIFY class_id VARCHAR(16) NOT NULL;
+ALTER TABLE waitlist MODIFY class_id VARCHAR(16) NOT NULL;
+ALTER TABLE booking_checkin MODIFY class_id VARCHAR(16);
+ALTER TABLE attendance MODIFY class_id VARCHAR(16);
+SET FOREIGN_KEY_CHECKS = 1;
+ALTER TABLE classroom ADD COLUMN campus VARCHAR(16) NOT NULL DEFAULT '', ADD INDEX (campus);
+CREATE TABLE IF NOT EXISTS campus (
+    id VARCHAR(16),
+    name VARCHAR(64) NOT NULL,
+    PRIMARY KEY (id)
+);
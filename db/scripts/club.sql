@@ -0,0 +1,3 @@
+-- Upgrades a database created before clubs could book events
+ALTER TABLE event ADD COLUMN club_id VARCHAR(32) NOT NULL DEFAULT "" AFTER organizer,
+    ADD COLUMN pending BOOLEAN NOT NULL DEFAULT FALSE;
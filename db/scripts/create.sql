@@ -18,24 +18,503 @@ CREATE TABLE IF NOT EXISTS faculty (
     PRIMARY KEY (id)
 );
 CREATE TABLE IF NOT EXISTS static (
-    class_id CHAR(4),
+    class_id VARCHAR(16),
     day ENUM ("MON", "TUE", "WED", "THU", "FRI"), 
     slot_id INT, 
     faculty_id CHAR(254),
     subject_id CHAR(8),
+    span INT NOT NULL DEFAULT 1,
+    version INT NOT NULL DEFAULT 1,
     FOREIGN KEY (slot_id) REFERENCES slot (id), 
     FOREIGN KEY (faculty_id) REFERENCES faculty (id), 
     FOREIGN KEY (subject_id) REFERENCES subject (id), 
     PRIMARY KEY (class_id, day, slot_id)
 );
 CREATE TABLE IF NOT EXISTS dynamic (
-    class_id CHAR(4),
+    class_id VARCHAR(16),
     date DATE, 
     slot_id INT, 
     faculty_id CHAR(254) NOT NULL, 
     subject_id CHAR(8) NOT NULL, 
+    version INT NOT NULL DEFAULT 1,
     FOREIGN KEY (faculty_id) REFERENCES faculty (id), 
     FOREIGN KEY (slot_id) REFERENCES slot (id), 
     FOREIGN KEY (subject_id) REFERENCES subject (id), 
     PRIMARY KEY (class_id, date, slot_id)
 );
+CREATE TABLE IF NOT EXISTS search_event (
+    id BIGINT AUTO_INCREMENT,
+    kind ENUM ("FREECLASS", "FREESLOT", "MULTIFREESLOT") NOT NULL,
+    class_id VARCHAR(16),
+    start_slot_id INT,
+    end_slot_id INT,
+    date DATE NOT NULL,
+    searched_at DATETIME NOT NULL,
+    INDEX (searched_at),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS session (
+    id VARCHAR(128),
+    provider VARCHAR(32) NOT NULL,
+    mail CHAR(254) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    refresh_token VARCHAR(4096),
+    device VARCHAR(128) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_active_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    user_id BIGINT,
+    impersonated_by VARCHAR(64),
+    INDEX (mail),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS oauth_state (
+    state VARCHAR(64),
+    provider VARCHAR(32) NOT NULL,
+    code_verifier CHAR(43) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (state)
+);
+CREATE TABLE IF NOT EXISTS api_key (
+    id CHAR(16),
+    name VARCHAR(64) NOT NULL,
+    secret_hash CHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    rate_limit INT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    last_used_at DATETIME,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS announcement (
+    id BIGINT AUTO_INCREMENT,
+    title VARCHAR(128) NOT NULL,
+    body TEXT NOT NULL,
+    starts_at DATETIME NOT NULL,
+    expires_at DATETIME,
+    created_at DATETIME NOT NULL,
+    version INT NOT NULL DEFAULT 1,
+    INDEX (starts_at),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS audit_event (
+    id BIGINT AUTO_INCREMENT,
+    actor VARCHAR(64) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    target VARCHAR(254) NOT NULL,
+    detail VARCHAR(1024) NOT NULL,
+    at DATETIME NOT NULL,
+    INDEX (at),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS favorite (
+    mail CHAR(254),
+    kind ENUM ("classroom", "section"),
+    target VARCHAR(32),
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (mail, kind, target)
+);
+CREATE TABLE IF NOT EXISTS recent_view (
+    mail CHAR(254),
+    kind ENUM ("FREECLASS", "FREESLOT", "MULTIFREESLOT", "TIMETABLE"),
+    class_id VARCHAR(16) NOT NULL DEFAULT "",
+    start_slot_id INT NOT NULL DEFAULT 0,
+    end_slot_id INT NOT NULL DEFAULT 0,
+    date DATE NOT NULL,
+    viewed_at DATETIME NOT NULL,
+    INDEX (mail, viewed_at),
+    PRIMARY KEY (mail, kind, class_id, start_slot_id, end_slot_id)
+);
+CREATE TABLE IF NOT EXISTS preference (
+    mail CHAR(254),
+    data TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (mail)
+);
+CREATE TABLE IF NOT EXISTS exam (
+    id BIGINT AUTO_INCREMENT,
+    subject_id CHAR(8) NOT NULL,
+    date DATE NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    version INT NOT NULL DEFAULT 1,
+    FOREIGN KEY (subject_id) REFERENCES subject (id),
+    INDEX (date),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS exam_hall (
+    exam_id BIGINT,
+    class_id VARCHAR(16),
+    first_roll VARCHAR(32) NOT NULL,
+    last_roll VARCHAR(32) NOT NULL,
+    FOREIGN KEY (exam_id) REFERENCES exam (id) ON DELETE CASCADE,
+    PRIMARY KEY (exam_id, class_id)
+);
+CREATE TABLE IF NOT EXISTS classroom (
+    id VARCHAR(16),
+    capacity INT NOT NULL,
+    building VARCHAR(32) NOT NULL,
+    floor INT NOT NULL,
+    campus VARCHAR(16) NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    INDEX (campus)
+);
+CREATE TABLE IF NOT EXISTS class_override (
+    class_id VARCHAR(16),
+    date DATE,
+    slot_id INT,
+    span INT NOT NULL DEFAULT 1,
+    subject_id CHAR(8) NOT NULL,
+    cancelled BOOLEAN NOT NULL,
+    faculty_id CHAR(254),
+    room_id VARCHAR(16),
+    reason VARCHAR(256) NOT NULL,
+    created_by CHAR(254) NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (slot_id) REFERENCES slot (id),
+    FOREIGN KEY (subject_id) REFERENCES subject (id),
+    FOREIGN KEY (faculty_id) REFERENCES faculty (id),
+    PRIMARY KEY (class_id, date, slot_id)
+);
+CREATE TABLE IF NOT EXISTS office_hour (
+    faculty_id CHAR(254) NOT NULL,
+    day ENUM ("MON", "TUE", "WED", "THU", "FRI") NOT NULL,
+    slot_id INT NOT NULL,
+    place VARCHAR(64) NOT NULL DEFAULT "",
+    PRIMARY KEY (faculty_id, day, slot_id)
+);
+CREATE TABLE IF NOT EXISTS appointment (
+    id BIGINT AUTO_INCREMENT,
+    faculty_id CHAR(254) NOT NULL,
+    student_id CHAR(254) NOT NULL,
+    date DATE NOT NULL,
+    slot_id INT NOT NULL,
+    start_at DATETIME NOT NULL,
+    end_at DATETIME NOT NULL,
+    note VARCHAR(256) NOT NULL DEFAULT "",
+    status ENUM ("pending", "accepted", "declined") NOT NULL,
+    created_at DATETIME NOT NULL,
+    reply VARCHAR(256) NOT NULL DEFAULT "",
+    decided_at DATETIME,
+    INDEX (faculty_id, date),
+    INDEX (student_id, date),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS change_request (
+    id BIGINT AUTO_INCREMENT,
+    faculty_id CHAR(254) NOT NULL,
+    class_id VARCHAR(16) NOT NULL,
+    day ENUM ("MON", "TUE", "WED", "THU", "FRI") NOT NULL,
+    slot_id INT NOT NULL,
+    new_class_id VARCHAR(16) NOT NULL,
+    new_day ENUM ("MON", "TUE", "WED", "THU", "FRI") NOT NULL,
+    new_slot_id INT NOT NULL,
+    reason VARCHAR(256) NOT NULL,
+    status ENUM ("pending", "approved", "rejected") NOT NULL,
+    created_at DATETIME NOT NULL,
+    decided_by CHAR(254),
+    decided_at DATETIME,
+    note VARCHAR(256) NOT NULL DEFAULT "",
+    INDEX (status, created_at),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS room_block (
+    id BIGINT AUTO_INCREMENT,
+    class_id VARCHAR(16) NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    reason VARCHAR(256) NOT NULL,
+    created_at DATETIME NOT NULL,
+    INDEX (class_id, end_date),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS club (
+    id VARCHAR(32),
+    name VARCHAR(64) NOT NULL,
+    advisor_id CHAR(254) NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS club_member (
+    club_id VARCHAR(32),
+    mail CHAR(254),
+    coordinator BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (club_id, mail),
+    INDEX (mail)
+);
+CREATE TABLE IF NOT EXISTS event (
+    id BIGINT AUTO_INCREMENT,
+    class_id VARCHAR(16) NOT NULL,
+    title VARCHAR(128) NOT NULL,
+    organizer VARCHAR(64) NOT NULL,
+    club_id VARCHAR(32) NOT NULL DEFAULT "",
+    start_at DATETIME NOT NULL,
+    end_at DATETIME NOT NULL,
+    created_by CHAR(254) NOT NULL,
+    created_at DATETIME NOT NULL,
+    pending BOOLEAN NOT NULL DEFAULT FALSE,
+    INDEX (class_id, start_at),
+    INDEX (created_by),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS equipment (
+    id VARCHAR(32),
+    name VARCHAR(64) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    home_class_id VARCHAR(16),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS equipment_reservation (
+    equipment_id VARCHAR(32),
+    class_id VARCHAR(16) NOT NULL,
+    date DATE,
+    slot_id INT,
+    FOREIGN KEY (equipment_id) REFERENCES equipment (id) ON DELETE CASCADE,
+    FOREIGN KEY (class_id, date, slot_id) REFERENCES dynamic (class_id, date, slot_id) ON DELETE CASCADE,
+    PRIMARY KEY (equipment_id, date, slot_id)
+);
+CREATE TABLE IF NOT EXISTS waitlist (
+    id BIGINT AUTO_INCREMENT,
+    class_id VARCHAR(16) NOT NULL,
+    date DATE NOT NULL,
+    slot_id INT NOT NULL,
+    faculty_id CHAR(254) NOT NULL,
+    subject VARCHAR(64) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    INDEX (class_id, date, slot_id)
+);
+CREATE TABLE IF NOT EXISTS booking_checkin (
+    class_id VARCHAR(16),
+    date DATE,
+    slot_id INT,
+    token VARCHAR(80) NOT NULL,
+    checked_in_at DATETIME,
+    FOREIGN KEY (class_id, date, slot_id) REFERENCES dynamic (class_id, date, slot_id) ON DELETE CASCADE,
+    PRIMARY KEY (class_id, date, slot_id)
+);
+CREATE TABLE IF NOT EXISTS attendance (
+    class_id VARCHAR(16),
+    date DATE,
+    slot_id INT,
+    subject_id CHAR(8) NOT NULL,
+    roll VARCHAR(32),
+    present BOOLEAN NOT NULL,
+    marked_by CHAR(254) NOT NULL,
+    marked_at DATETIME NOT NULL,
+    PRIMARY KEY (class_id, date, slot_id, roll),
+    INDEX (roll, subject_id),
+    INDEX (subject_id, date)
+);
+CREATE TABLE IF NOT EXISTS assignment (
+    id BIGINT AUTO_INCREMENT,
+    subject_id CHAR(8) NOT NULL,
+    section VARCHAR(32) NOT NULL DEFAULT '',
+    title VARCHAR(128) NOT NULL,
+    due DATETIME NOT NULL,
+    link VARCHAR(512) NOT NULL DEFAULT '',
+    created_by CHAR(254) NOT NULL,
+    created_at DATETIME NOT NULL,
+    reminded BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    INDEX (due)
+);
+CREATE TABLE IF NOT EXISTS attachment (
+    id CHAR(32),
+    name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(128) NOT NULL,
+    size BIGINT NOT NULL,
+    uploaded_by CHAR(254) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS campus (
+    id VARCHAR(16),
+    name VARCHAR(64) NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS enrollment (
+    subject_id CHAR(8),
+    mail CHAR(254),
+    PRIMARY KEY (subject_id, mail),
+    INDEX (mail)
+);
+CREATE TABLE IF NOT EXISTS custom_entry (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    title VARCHAR(64) NOT NULL,
+    day ENUM ("MON", "TUE", "WED", "THU", "FRI", "SAT", "SUN") NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    place VARCHAR(64) NOT NULL DEFAULT "",
+    created_at DATETIME NOT NULL,
+    INDEX (mail),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS notification (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    title VARCHAR(256) NOT NULL,
+    body TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    read_at DATETIME,
+    INDEX (mail, created_at),
+    INDEX (created_at),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS sms (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    phone VARCHAR(16) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    body TEXT NOT NULL,
+    provider_id VARCHAR(64) NOT NULL DEFAULT "",
+    status VARCHAR(16) NOT NULL,
+    error VARCHAR(256) NOT NULL DEFAULT "",
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    INDEX (mail),
+    INDEX (provider_id),
+    INDEX (status, created_at),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS feedback (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL DEFAULT "",
+    category VARCHAR(16) NOT NULL,
+    entity_kind VARCHAR(16) NOT NULL DEFAULT "",
+    entity_id VARCHAR(64) NOT NULL DEFAULT "",
+    message TEXT NOT NULL,
+    status ENUM ("open", "resolved", "dismissed") NOT NULL,
+    created_at DATETIME NOT NULL,
+    closed_by VARCHAR(254) NOT NULL DEFAULT "",
+    closed_at DATETIME,
+    note VARCHAR(256) NOT NULL DEFAULT "",
+    INDEX (status, created_at),
+    INDEX (mail),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS erasure_request (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    reason VARCHAR(256) NOT NULL DEFAULT "",
+    status ENUM ("pending", "approved", "rejected") NOT NULL,
+    created_at DATETIME NOT NULL,
+    decided_by VARCHAR(254) NOT NULL DEFAULT "",
+    decided_at DATETIME,
+    note VARCHAR(256) NOT NULL DEFAULT "",
+    INDEX (status, created_at),
+    INDEX (mail),
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS db_backup (
+    id CHAR(32),
+    size BIGINT NOT NULL,
+    periods INT NOT NULL,
+    classrooms INT NOT NULL,
+    bookings INT NOT NULL,
+    created_by VARCHAR(254) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS building (
+    id VARCHAR(32),
+    name VARCHAR(64) NOT NULL,
+    latitude DOUBLE,
+    longitude DOUBLE,
+    PRIMARY KEY (id)
+);
+CREATE TABLE IF NOT EXISTS building_path (
+    from_id VARCHAR(32),
+    to_id VARCHAR(32),
+    minutes INT NOT NULL,
+    PRIMARY KEY (from_id, to_id)
+);
+CREATE TABLE IF NOT EXISTS room_alias (
+    alias VARCHAR(64),
+    class_id VARCHAR(16) NOT NULL,
+    PRIMARY KEY (alias)
+);
+CREATE TABLE IF NOT EXISTS teams_channel (
+    section VARCHAR(32),
+    webhook VARCHAR(512) NOT NULL DEFAULT "",
+    team_id VARCHAR(64) NOT NULL DEFAULT "",
+    channel_id VARCHAR(128) NOT NULL DEFAULT "",
+    classes VARCHAR(256) NOT NULL DEFAULT "",
+    PRIMARY KEY (section)
+);
+CREATE TABLE IF NOT EXISTS trash (
+    id BIGINT AUTO_INCREMENT,
+    kind VARCHAR(16) NOT NULL,
+    target VARCHAR(128) NOT NULL,
+    data JSON NOT NULL,
+    deleted_by VARCHAR(64) NOT NULL,
+    deleted_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    INDEX (deleted_at)
+);
+CREATE TABLE IF NOT EXISTS timetable_version (
+    id BIGINT AUTO_INCREMENT,
+    semester VARCHAR(32) NOT NULL,
+    label VARCHAR(128) NOT NULL DEFAULT '',
+    size INT NOT NULL,
+    entries JSON NOT NULL,
+    created_by VARCHAR(64) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    INDEX (semester, created_at)
+);
+CREATE TABLE IF NOT EXISTS profile (
+    provider VARCHAR(32),
+    user_id VARCHAR(64),
+    data JSON NOT NULL,
+    fetched_at DATETIME NOT NULL,
+    PRIMARY KEY (provider, user_id)
+);
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT AUTO_INCREMENT,
+    provider VARCHAR(32) NOT NULL,
+    external_id VARCHAR(64) NOT NULL,
+    mail CHAR(254) NOT NULL,
+    display_name VARCHAR(128) NOT NULL,
+    given_name VARCHAR(64) NOT NULL,
+    surname VARCHAR(64) NOT NULL,
+    job_title VARCHAR(128) NOT NULL,
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    last_login_at DATETIME,
+    PRIMARY KEY (id),
+    UNIQUE (provider, external_id),
+    INDEX (mail),
+    INDEX (display_name)
+);
+CREATE TABLE IF NOT EXISTS directory_sync (
+    provider VARCHAR(32),
+    delta_link VARCHAR(4096) NOT NULL,
+    synced_at DATETIME NOT NULL,
+    PRIMARY KEY (provider)
+);
+CREATE TABLE IF NOT EXISTS group_member (
+    provider VARCHAR(32),
+    mail CHAR(254),
+    section VARCHAR(32) NOT NULL DEFAULT "",
+    role VARCHAR(16) NOT NULL DEFAULT "",
+    synced_at DATETIME NOT NULL,
+    PRIMARY KEY (provider, mail),
+    INDEX (mail),
+    INDEX (section)
+);
+CREATE TABLE IF NOT EXISTS security_event (
+    id BIGINT AUTO_INCREMENT,
+    kind VARCHAR(32) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    subject VARCHAR(254) NOT NULL,
+    detail VARCHAR(1024) NOT NULL,
+    at DATETIME NOT NULL,
+    INDEX (at),
+    INDEX (ip),
+    PRIMARY KEY (id)
+);
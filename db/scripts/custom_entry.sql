@@ -0,0 +1,13 @@
+-- Upgrades a database created before users could add their own timetable entries
+CREATE TABLE IF NOT EXISTS custom_entry (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    title VARCHAR(64) NOT NULL,
+    day ENUM ("MON", "TUE", "WED", "THU", "FRI", "SAT", "SUN") NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    place VARCHAR(64) NOT NULL DEFAULT "",
+    created_at DATETIME NOT NULL,
+    INDEX (mail),
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,7 @@
+-- Upgrades a database created before students were enrolled in electives
+CREATE TABLE IF NOT EXISTS enrollment (
+    subject_id CHAR(8),
+    mail CHAR(254),
+    PRIMARY KEY (subject_id, mail),
+    INDEX (mail)
+);
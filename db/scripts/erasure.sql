@@ -0,0 +1,14 @@
+-- Upgrades a database created before users could ask for their data to be erased
+CREATE TABLE IF NOT EXISTS erasure_request (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    reason VARCHAR(256) NOT NULL DEFAULT "",
+    status ENUM ("pending", "approved", "rejected") NOT NULL,
+    created_at DATETIME NOT NULL,
+    decided_by VARCHAR(254) NOT NULL DEFAULT "",
+    decided_at DATETIME,
+    note VARCHAR(256) NOT NULL DEFAULT "",
+    INDEX (status, created_at),
+    INDEX (mail),
+    PRIMARY KEY (id)
+);
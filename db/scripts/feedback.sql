@@ -0,0 +1,17 @@
+-- Upgrades a database created before users could send feedback
+CREATE TABLE IF NOT EXISTS feedback (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL DEFAULT "",
+    category VARCHAR(16) NOT NULL,
+    entity_kind VARCHAR(16) NOT NULL DEFAULT "",
+    entity_id VARCHAR(64) NOT NULL DEFAULT "",
+    message TEXT NOT NULL,
+    status ENUM ("open", "resolved", "dismissed") NOT NULL,
+    created_at DATETIME NOT NULL,
+    closed_by VARCHAR(254) NOT NULL DEFAULT "",
+    closed_at DATETIME,
+    note VARCHAR(256) NOT NULL DEFAULT "",
+    INDEX (status, created_at),
+    INDEX (mail),
+    PRIMARY KEY (id)
+);
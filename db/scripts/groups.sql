@@ -0,0 +1,11 @@
+-- Upgrades a database created before sections and roles were synced from groups
+CREATE TABLE IF NOT EXISTS group_member (
+    provider VARCHAR(32),
+    mail CHAR(254),
+    section VARCHAR(32) NOT NULL DEFAULT "",
+    role VARCHAR(16) NOT NULL DEFAULT "",
+    synced_at DATETIME NOT NULL,
+    PRIMARY KEY (provider, mail),
+    INDEX (mail),
+    INDEX (section)
+);
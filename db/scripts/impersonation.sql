@@ -0,0 +1,2 @@
+-- Upgrades a database created before admins could impersonate users
+ALTER TABLE session ADD COLUMN impersonated_by VARCHAR(64);
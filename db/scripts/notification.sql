@@ -0,0 +1,13 @@
+-- Upgrades a database created before notifications were kept in an inbox
+CREATE TABLE IF NOT EXISTS notification (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    title VARCHAR(256) NOT NULL,
+    body TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    read_at DATETIME,
+    INDEX (mail, created_at),
+    INDEX (created_at),
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,17 @@
+-- Upgrades a database created before critical alerts were texted
+CREATE TABLE IF NOT EXISTS sms (
+    id BIGINT AUTO_INCREMENT,
+    mail CHAR(254) NOT NULL,
+    phone VARCHAR(16) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    body TEXT NOT NULL,
+    provider_id VARCHAR(64) NOT NULL DEFAULT "",
+    status VARCHAR(16) NOT NULL,
+    error VARCHAR(256) NOT NULL DEFAULT "",
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    INDEX (mail),
+    INDEX (provider_id),
+    INDEX (status, created_at),
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,9 @@
+-- Upgrades a database created before sections were posted to on Microsoft Teams
+CREATE TABLE IF NOT EXISTS teams_channel (
+    section VARCHAR(32),
+    webhook VARCHAR(512) NOT NULL DEFAULT "",
+    team_id VARCHAR(64) NOT NULL DEFAULT "",
+    channel_id VARCHAR(128) NOT NULL DEFAULT "",
+    classes VARCHAR(256) NOT NULL DEFAULT "",
+    PRIMARY KEY (section)
+);
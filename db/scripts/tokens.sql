@@ -0,0 +1,3 @@
+-- Upgrades a database created before OAuth states and check-in codes could be longer
+ALTER TABLE oauth_state MODIFY state VARCHAR(64);
+ALTER TABLE booking_checkin MODIFY token VARCHAR(80) NOT NULL;
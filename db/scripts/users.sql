@@ -0,0 +1,2 @@
+-- Upgrades a database created before the user directory
+ALTER TABLE session ADD COLUMN user_id BIGINT;
@@ -0,0 +1,4 @@
+-- Upgrades a database created before edits were checked against versions
+ALTER TABLE static ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE announcement ADD COLUMN version INT NOT NULL DEFAULT 1;
+ALTER TABLE exam ADD COLUMN version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	SearchFreeClass     = "FREECLASS"
+	SearchFreeSlot      = "FREESLOT"
+	SearchMultiFreeSlot = "MULTIFREESLOT"
+)
+
+// Zero values of Class, StartSlot and EndSlot are stored as NULL
+type SearchEvent struct {
+	Kind      string    `json:"kind"`
+	Class     string    `json:"class,omitempty"`
+	StartSlot int       `json:"startSlot,omitempty"`
+	EndSlot   int       `json:"endSlot,omitempty"`
+	Date      time.Time `json:"date"`
+	At        time.Time `json:"at"`
+}
+
+type SearchCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+type SearchStats struct {
+	StartDate string        `json:"startDate"`
+	EndDate   string        `json:"endDate"`
+	Total     int           `json:"total"`
+	Kinds     []SearchCount `json:"kinds"`
+	Rooms     []SearchCount `json:"rooms"`
+	Slots     []SearchCount `json:"slots"`
+	Days      []SearchCount `json:"days"`
+}
+
+const (
+	searchBatchSize     = 100
+	searchFlushInterval = 5 * time.Second
+)
+
+/*
+Searches are recorded on the hot path of the free class queries so they must
+never wait on the database. RecordSearch only pushes onto this buffered channel
+and RunSearchRecorder drains it in batches. When the buffer is full the event is
+dropped; losing a few analytics rows is better than slowing down students.
+*/
+var searchEvents = make(chan pendingSearch, 4096)
+
+// A search on its way to the database it belongs in
+type pendingSearch struct {
+	dsn   string
+	event SearchEvent
+}
+
+func RecordSearch(dsn string, event SearchEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	select {
+	case searchEvents <- pendingSearch{dsn, event}:
+	default:
+		log.Println("search event buffer full, dropping event")
+	}
+}
+
+// RunSearchRecorder blocks forever, so it has to be started in its own goroutine. It serves every Store.
+func RunSearchRecorder() {
+	batches := make(map[string][]SearchEvent)
+	ticker := time.NewTicker(searchFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case pending := <-searchEvents:
+			batches[pending.dsn] = append(batches[pending.dsn], pending.event)
+			if len(batches[pending.dsn]) < searchBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		for dsn, batch := range batches {
+			if len(batch) == 0 {
+				continue
+			}
+			err := insertSearchEvents(dsn, batch)
+			if err != nil {
+				log.Println("Error recording search events", err)
+			}
+			batches[dsn] = batch[:0]
+		}
+	}
+}
+
+func insertSearchEvents(dsn string, events []SearchEvent) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	placeholders := make([]string, len(events))
+	args := make([]interface{}, 0, len(events)*6)
+	for idx, event := range events {
+		placeholders[idx] = "(?, ?, ?, ?, ?, ?)"
+		args = append(args, event.Kind, nullString(event.Class),
+			nullInt(event.StartSlot), nullInt(event.EndSlot), event.Date, event.At)
+	}
+	_, err = db.Exec(`INSERT INTO search_event (kind, class_id, start_slot_id,
+    end_slot_id, date, searched_at) VALUES `+strings.Join(placeholders, ", "), args...)
+	return err
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(i int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i), Valid: i != 0}
+}
+
+/*
+GetSearchStats aggregates the searches made between startDate and endDate
+(inclusive, by the time the search was made). Multi slot searches count towards
+every slot in their range.
+*/
+func GetSearchStats(dsn string, startDate time.Time, endDate time.Time, limit int) (SearchStats, error) {
+	var stats SearchStats
+	stats.StartDate = startDate.Format("2006-01-02")
+	stats.EndDate = endDate.Format("2006-01-02")
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return stats, err
+	}
+	defer db.Close()
+
+	from := startDate
+	to := endDate.AddDate(0, 0, 1)
+	err = db.QueryRow(`SELECT COUNT(*) FROM search_event WHERE searched_at >= ?
+    AND searched_at < ?`, from, to).Scan(&stats.Total)
+	if err != nil {
+		log.Println(err)
+		return stats, err
+	}
+	queries := []struct {
+		dest  *[]SearchCount
+		query string
+	}{
+		{&stats.Kinds, `SELECT kind, COUNT(*) AS n FROM search_event WHERE
+        searched_at >= ? AND searched_at < ? GROUP BY kind ORDER BY n DESC`},
+		{&stats.Rooms, `SELECT class_id, COUNT(*) AS n FROM search_event WHERE
+        searched_at >= ? AND searched_at < ? AND class_id IS NOT NULL
+        GROUP BY class_id ORDER BY n DESC`},
+		{&stats.Slots, `SELECT s.id, COUNT(*) AS n FROM search_event e JOIN slot s
+        ON s.id BETWEEN e.start_slot_id AND COALESCE(e.end_slot_id, e.start_slot_id)
+        WHERE e.searched_at >= ? AND e.searched_at < ? GROUP BY s.id ORDER BY n DESC`},
+		{&stats.Days, `SELECT UPPER(LEFT(DAYNAME(date), 3)), COUNT(*) AS n FROM
+        search_event WHERE searched_at >= ? AND searched_at < ?
+        GROUP BY UPPER(LEFT(DAYNAME(date), 3)) ORDER BY n DESC`},
+	}
+	for _, q := range queries {
+		rows, err := db.Query(q.query+" LIMIT ?", from, to, limit)
+		if err != nil {
+			log.Println(err)
+			return stats, err
+		}
+		for rows.Next() {
+			var tmp SearchCount
+			err := rows.Scan(&tmp.Key, &tmp.Count)
+			if err != nil {
+				rows.Close()
+				log.Println(err)
+				return stats, err
+			}
+			*q.dest = append(*q.dest, tmp)
+		}
+		rows.Close()
+	}
+	return stats, nil
+}
+
+/*
+EachSearchEvent calls fn with every search made from startDate to endDate,
+oldest first, as it is read. An error from fn stops it and is returned.
+*/
+func EachSearchEvent(dsn string, startDate time.Time, endDate time.Time, fn func(SearchEvent) error) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT kind, class_id, start_slot_id, end_slot_id, date, searched_at
+    FROM search_event WHERE searched_at >= ? AND searched_at < ? ORDER BY searched_at, id`,
+		startDate, endDate.AddDate(0, 0, 1))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp SearchEvent
+		var class sql.NullString
+		var startSlot, endSlot sql.NullInt64
+		err := rows.Scan(&tmp.Kind, &class, &startSlot, &endSlot, &tmp.Date, &tmp.At)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		tmp.Class, tmp.StartSlot, tmp.EndSlot = class.String, int(startSlot.Int64), int(endSlot.Int64)
+		if err := fn(tmp); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+SecurityEvent is something suspicious seen on the login and API key endpoints,
+like a failed code exchange or a lockout. Subject is who it was about when
+that is known, like "apikey:<id>" or a user's mail.
+*/
+type SecurityEvent struct {
+	ID      int64     `json:"id"`
+	Kind    string    `json:"kind"`
+	IP      string    `json:"ip"`
+	Subject string    `json:"subject"`
+	Detail  string    `json:"detail"`
+	At      time.Time `json:"at"`
+}
+
+// SecurityEventFilter narrows down GetSecurityEvents; zero fields match everything
+type SecurityEventFilter struct {
+	Kind    string
+	IP      string
+	Subject string
+	Limit   int
+}
+
+func RecordSecurityEvent(dsn string, event SecurityEvent) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO security_event (kind, ip, subject, detail, at)
+    VALUES (?, ?, ?, ?, ?)`, event.Kind, event.IP, event.Subject, event.Detail, event.At)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetSecurityEvents returns the latest events matching filter
+func GetSecurityEvents(dsn string, filter SecurityEventFilter) ([]SecurityEvent, error) {
+	var events []SecurityEvent
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"kind = ?", "ip = ?", "subject = ?"},
+		[]interface{}{filter.Kind, filter.IP, filter.Subject})
+	rows, err := db.Query(`SELECT id, kind, ip, subject, detail, at FROM
+    security_event`+clause+` ORDER BY at DESC, id DESC LIMIT ?`, append(args, filter.Limit)...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp SecurityEvent
+		err := rows.Scan(&tmp.ID, &tmp.Kind, &tmp.IP, &tmp.Subject, &tmp.Detail, &tmp.At)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		events = append(events, tmp)
+	}
+	return events, rows.Err()
+}
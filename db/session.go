@@ -0,0 +1,223 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+type Session struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	Mail     string `json:"mail"`
+	Name     string `json:"name"`
+	// Device name sent by the app, or a summary of the User-Agent
+	Device       string    `json:"device"`
+	IP           string    `json:"ip"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+	// Only set when the provider issued one, never sent to clients
+	RefreshToken string `json:"-"`
+	// The User logged in, 0 for sessions created before the user directory
+	UserID int64 `json:"userId"`
+	// The admin acting as the user, see the admin impersonation endpoints
+	ImpersonatedBy string `json:"impersonatedBy,omitempty"`
+}
+
+func CreateSession(dsn string, session Session) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	stmt, err := db.Prepare(`INSERT INTO session (id, provider, mail, name,
+    refresh_token, device, ip, created_at, last_active_at, expires_at, user_id,
+    impersonated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(session.ID, session.Provider, session.Mail, session.Name,
+		nullString(session.RefreshToken), session.Device, session.IP,
+		session.CreatedAt, session.CreatedAt, session.ExpiresAt,
+		sql.NullInt64{Int64: session.UserID, Valid: session.UserID != 0},
+		nullString(session.ImpersonatedBy))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// GetSession returns sql.ErrNoRows if the session does not exist or has expired
+func GetSession(dsn string, id string) (Session, error) {
+	var session Session
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return session, err
+	}
+	defer db.Close()
+
+	var refreshToken sql.NullString
+	var userID sql.NullInt64
+	var impersonatedBy sql.NullString
+	err = db.QueryRow(`SELECT id, provider, mail, name, refresh_token, device,
+    ip, created_at, last_active_at, expires_at, user_id, impersonated_by FROM
+    session WHERE id = ? AND expires_at > ?`, id, time.Now()).Scan(&session.ID,
+		&session.Provider, &session.Mail, &session.Name, &refreshToken,
+		&session.Device, &session.IP, &session.CreatedAt, &session.LastActiveAt,
+		&session.ExpiresAt, &userID, &impersonatedBy)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	session.RefreshToken = refreshToken.String
+	session.UserID = userID.Int64
+	session.ImpersonatedBy = impersonatedBy.String
+	return session, err
+}
+
+// GetUserSessions returns every unexpired session of mail
+func GetUserSessions(dsn string, mail string) ([]Session, error) {
+	var sessions []Session
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, provider, mail, name, refresh_token, device,
+    ip, created_at, last_active_at, expires_at, user_id, impersonated_by FROM
+    session WHERE mail = ? AND expires_at > ? ORDER BY last_active_at DESC`,
+		mail, time.Now())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Session
+		var refreshToken sql.NullString
+		var userID sql.NullInt64
+		var impersonatedBy sql.NullString
+		err := rows.Scan(&tmp.ID, &tmp.Provider, &tmp.Mail, &tmp.Name,
+			&refreshToken, &tmp.Device, &tmp.IP, &tmp.CreatedAt,
+			&tmp.LastActiveAt, &tmp.ExpiresAt, &userID, &impersonatedBy)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tmp.RefreshToken = refreshToken.String
+		tmp.UserID = userID.Int64
+		tmp.ImpersonatedBy = impersonatedBy.String
+		sessions = append(sessions, tmp)
+	}
+	return sessions, rows.Err()
+}
+
+func DeleteSession(dsn string, id string) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM session WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// TouchSession records that the session was just used from ip
+func TouchSession(dsn string, id string, ip string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE session SET ip = ?, last_active_at = ? WHERE id = ?`, ip, at, id)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes the sessions that expired before before and returns how many there were
+func DeleteExpiredSessions(dsn string, before time.Time) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM session WHERE expires_at <= ?`, before)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetRefreshTokens returns the refresh tokens of the unexpired sessions that have one, by session ID
+func GetRefreshTokens(dsn string) (map[string]string, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, refresh_token FROM session WHERE
+    refresh_token IS NOT NULL AND expires_at > ?`, time.Now())
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make(map[string]string)
+	for rows.Next() {
+		var id, refreshToken string
+		err := rows.Scan(&id, &refreshToken)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		tokens[id] = refreshToken
+	}
+	return tokens, rows.Err()
+}
+
+/*
+ReplaceRefreshToken sets the refresh token of a session to new if it still is
+old, and tells whether it was. A session ended meanwhile is left alone.
+*/
+func ReplaceRefreshToken(dsn string, id string, old string, new string) (bool, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE session SET refresh_token = ? WHERE id = ?
+    AND refresh_token = ?`, new, id, old)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// A Text message sent to a user's phone, kept to track its delivery
+type Text struct {
+	ID    int64  `json:"id"`
+	Mail  string `json:"mail"`
+	Phone string `json:"phone"`
+	Kind  string `json:"kind"`
+	Body  string `json:"body"`
+	// ID the SMS provider gave it, empty until it took it
+	ProviderID string `json:"providerId,omitempty"`
+	// One of the notify.SMS statuses
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TextFilter narrows down GetTexts; empty fields match everything
+type TextFilter struct {
+	Mail   string
+	Status string
+	// Most texts listed, all when 0
+	Limit int
+}
+
+func AddText(dsn string, text Text) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO sms (mail, phone, kind, body, provider_id, status, error, created_at,
+    updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, text.Mail, text.Phone, text.Kind, text.Body, text.ProviderID,
+		text.Status, text.Error, text.CreatedAt, text.UpdatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateText records what became of sending text id: the provider's ID of it, its status and error
+func UpdateText(dsn string, id int64, providerID string, status string, errText string, at time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE sms SET provider_id = ?, status = ?, error = ?, updated_at = ? WHERE id = ?`,
+		providerID, status, errText, at, id)
+	if err != nil {
+		log.Println(err)
+	}
+	return err
+}
+
+/*
+ClaimText moves text id from the status from to the status to, and tells
+whether it was still in from. Of several servers sending the same texts, only
+the one that claims a text sends it.
+*/
+func ClaimText(dsn string, id int64, from string, to string, at time.Time) (bool, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE sms SET status = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		to, at, id, from)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected == 1, nil
+}
+
+// SetTextStatus records a delivery report of the text the provider knows as providerID and returns how many it matched
+func SetTextStatus(dsn string, providerID string, status string, errText string, at time.Time) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE sms SET status = ?, error = ?, updated_at = ? WHERE provider_id = ?`,
+		status, errText, at, providerID)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetTexts lists the texts filter matches, latest first
+func GetTexts(dsn string, filter TextFilter) ([]Text, error) {
+	var texts []Text
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"mail = ?", "status = ?"}, []interface{}{filter.Mail, filter.Status})
+	query := `SELECT id, mail, phone, kind, body, provider_id, status, error, created_at, updated_at FROM sms` +
+		clause + ` ORDER BY created_at DESC, id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp Text
+		err := rows.Scan(&tmp.ID, &tmp.Mail, &tmp.Phone, &tmp.Kind, &tmp.Body, &tmp.ProviderID, &tmp.Status,
+			&tmp.Error, &tmp.CreatedAt, &tmp.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		texts = append(texts, tmp)
+	}
+	return texts, rows.Err()
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+/*
+TeamsChannel is where a class section is posted its timetable changes and the
+announcements on Microsoft Teams: an incoming Webhook of the channel, or the
+ChannelID of the team TeamID to post to with Graph. Classes are the classrooms
+the section meets in, whose changes are posted to it.
+*/
+type TeamsChannel struct {
+	Section   string   `json:"section"`
+	Webhook   string   `json:"webhook,omitempty"`
+	TeamID    string   `json:"teamId,omitempty"`
+	ChannelID string   `json:"channelId,omitempty"`
+	Classes   []string `json:"classes"`
+}
+
+// HasClass reports whether the section meets in class
+func (c TeamsChannel) HasClass(class string) bool {
+	for _, tmp := range c.Classes {
+		if tmp == class {
+			return true
+		}
+	}
+	return false
+}
+
+func GetTeamsChannels(dsn string) ([]TeamsChannel, error) {
+	var channels []TeamsChannel
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT section, webhook, team_id, channel_id, classes
+    FROM teams_channel ORDER BY section`)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp TeamsChannel
+		var classes string
+		err := rows.Scan(&tmp.Section, &tmp.Webhook, &tmp.TeamID, &tmp.ChannelID, &classes)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if classes != "" {
+			tmp.Classes = strings.Split(classes, ",")
+		}
+		channels = append(channels, tmp)
+	}
+	return channels, rows.Err()
+}
+
+// SetTeamsChannel adds the channel of the section or replaces it
+func SetTeamsChannel(dsn string, channel TeamsChannel) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO teams_channel (section, webhook, team_id,
+    channel_id, classes) VALUES (?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE
+    webhook = VALUES(webhook), team_id = VALUES(team_id),
+    channel_id = VALUES(channel_id), classes = VALUES(classes)`, channel.Section,
+		channel.Webhook, channel.TeamID, channel.ChannelID, strings.Join(channel.Classes, ","))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+func DeleteTeamsChannel(dsn string, section string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM teams_channel WHERE section = ?`, section)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+/*
+A TimetableVersion is a copy of the whole weekly timetable taken at CreatedAt,
+so it can be compared with another one or rolled back to. Entries is only
+filled by GetTimetableVersion; Size is their number.
+*/
+type TimetableVersion struct {
+	ID        int64         `json:"id"`
+	Semester  string        `json:"semester"`
+	Label     string        `json:"label"`
+	Size      int           `json:"size"`
+	Entries   []StaticEntry `json:"entries,omitempty"`
+	CreatedBy string        `json:"createdBy"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// CreateTimetableVersion stores version with its Entries and returns its ID
+func CreateTimetableVersion(dsn string, version TimetableVersion) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	entries, err := json.Marshal(version.Entries)
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.Exec(`INSERT INTO timetable_version (semester, label, size, entries,
+    created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`, version.Semester, version.Label,
+		len(version.Entries), entries, version.CreatedBy, version.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetTimetableVersions lists the versions of a semester, or of all of them when it is empty, the latest first and without their entries
+func GetTimetableVersions(dsn string, semester string) ([]TimetableVersion, error) {
+	var versions []TimetableVersion
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"semester = ?"}, []interface{}{semester})
+	rows, err := db.Query(`SELECT id, semester, label, size, created_by, created_at
+    FROM timetable_version`+clause+` ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp TimetableVersion
+		err := rows.Scan(&tmp.ID, &tmp.Semester, &tmp.Label, &tmp.Size, &tmp.CreatedBy, &tmp.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		versions = append(versions, tmp)
+	}
+	return versions, rows.Err()
+}
+
+// GetTimetableVersion returns a version with its entries, or sql.ErrNoRows for unknown IDs
+func GetTimetableVersion(dsn string, id int64) (TimetableVersion, error) {
+	var version TimetableVersion
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return version, err
+	}
+	defer db.Close()
+
+	var entries []byte
+	err = db.QueryRow(`SELECT id, semester, label, size, entries, created_by, created_at
+    FROM timetable_version WHERE id = ?`, id).Scan(&version.ID, &version.Semester,
+		&version.Label, &version.Size, &entries, &version.CreatedBy, &version.CreatedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err)
+		}
+		return version, err
+	}
+	err = json.Unmarshal(entries, &version.Entries)
+	return version, err
+}
+
+func DeleteTimetableVersion(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM timetable_version WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+/*
+ReplaceStatic swaps the whole weekly timetable for entries in one transaction,
+so either all of it changes or, when an entry names a subject, slot or faculty
+member that is gone, none of it. Periods that stay keep counting up their
+version.
+*/
+func ReplaceStatic(dsn string, entries []StaticEntry) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query(`SELECT class_id, day, slot_id, version FROM static FOR UPDATE`)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	versions := make(map[staticKey]int)
+	for rows.Next() {
+		var key staticKey
+		var version int
+		err := rows.Scan(&key.class, &key.day, &key.slot, &version)
+		if err != nil {
+			rows.Close()
+			log.Println(err)
+			return err
+		}
+		versions[key] = version
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println(err)
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM static`)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, entry := range entries {
+		key := staticKey{class: entry.Class, day: entry.Day, slot: entry.Slot}
+		if entry.Span < 1 {
+			entry.Span = 1
+		}
+		_, err = tx.Exec(`INSERT INTO static (class_id, day, slot_id, faculty_id, subject_id,
+    span, version) VALUES (?, ?, ?, ?, ?, ?, ?)`, entry.Class, entry.Day, entry.Slot,
+			nullString(entry.Faculty), entry.Subject, entry.Span, versions[key]+1)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
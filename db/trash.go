@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// What a TrashItem holds
+const (
+	TrashTimetable    = "timetable"
+	TrashBooking      = "booking"
+	TrashAnnouncement = "announcement"
+)
+
+/*
+A TrashItem is a timetable entry, booking or announcement deleted by an admin,
+kept as the JSON of its StaticEntry, BookingRecord or Announcement until it is
+restored or purged. Target names it the way the audit log does.
+*/
+type TrashItem struct {
+	ID        int64           `json:"id"`
+	Kind      string          `json:"kind"`
+	Target    string          `json:"target"`
+	Data      json.RawMessage `json:"data"`
+	DeletedBy string          `json:"deletedBy"`
+	DeletedAt time.Time       `json:"deletedAt"`
+}
+
+const trashColumns = `id, kind, target, data, deleted_by, deleted_at`
+
+func scanTrashItem(scanner interface{ Scan(...interface{}) error }) (TrashItem, error) {
+	var item TrashItem
+	var data []byte
+	err := scanner.Scan(&item.ID, &item.Kind, &item.Target, &data, &item.DeletedBy, &item.DeletedAt)
+	item.Data = data
+	return item, err
+}
+
+// AddTrash keeps item and returns its ID
+func AddTrash(dsn string, item TrashItem) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO trash (kind, target, data, deleted_by, deleted_at)
+    VALUES (?, ?, ?, ?, ?)`, item.Kind, item.Target, []byte(item.Data), item.DeletedBy, item.DeletedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetTrash lists the trash of one kind, or all of it when kind is empty, the latest deleted first
+func GetTrash(dsn string, kind string) ([]TrashItem, error) {
+	var items []TrashItem
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"kind = ?"}, []interface{}{kind})
+	rows, err := db.Query(`SELECT `+trashColumns+` FROM trash`+clause+
+		` ORDER BY deleted_at DESC, id DESC`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetTrashItem returns sql.ErrNoRows for unknown IDs
+func GetTrashItem(dsn string, id int64) (TrashItem, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return TrashItem{}, err
+	}
+	defer db.Close()
+
+	item, err := scanTrashItem(db.QueryRow(`SELECT `+trashColumns+` FROM trash WHERE id = ?`, id))
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	return item, err
+}
+
+func DeleteTrash(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM trash WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// PurgeTrash deletes what was deleted before before for good and returns how many items went
+func PurgeTrash(dsn string, before time.Time) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM trash WHERE deleted_at < ?`, before)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
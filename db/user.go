@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+)
+
+/*
+A User is an account of the institution as CORA knows it, added at its first
+login or by a directory sync. ID is ours and never changes; ExternalID is the
+provider's (the Azure AD object ID, the OIDC subject). A user removed from the
+directory is kept, Disabled, so what refers to them still does.
+*/
+type User struct {
+	ID          int64      `json:"id"`
+	Provider    string     `json:"provider"`
+	ExternalID  string     `json:"externalId"`
+	Mail        string     `json:"mail"`
+	DisplayName string     `json:"displayName"`
+	GivenName   string     `json:"givenName"`
+	Surname     string     `json:"surname"`
+	JobTitle    string     `json:"jobTitle"`
+	Disabled    bool       `json:"disabled"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// UserFilter narrows down GetUsers; Query matches the mail or the name
+type UserFilter struct {
+	Query string
+	Limit int
+}
+
+const userColumns = `id, provider, external_id, mail, display_name, given_name, surname,
+    job_title, disabled, created_at, updated_at, last_login_at`
+
+func scanUser(scanner interface{ Scan(...interface{}) error }) (User, error) {
+	var user User
+	var lastLoginAt sql.NullTime
+	err := scanner.Scan(&user.ID, &user.Provider, &user.ExternalID, &user.Mail,
+		&user.DisplayName, &user.GivenName, &user.Surname, &user.JobTitle,
+		&user.Disabled, &user.CreatedAt, &user.UpdatedAt, &lastLoginAt)
+	user.LastLoginAt = nullTimePtr(lastLoginAt)
+	return user, err
+}
+
+/*
+SaveUser adds a user or updates the one with the same provider and external ID,
+and returns its ID. A nil LastLoginAt keeps the one stored, so a directory sync
+does not erase when someone last logged in; saving a user enables them again.
+*/
+func SaveUser(dsn string, user User) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	now := time.Now()
+	// LAST_INSERT_ID(id) makes LastInsertId return the ID of the updated row too
+	result, err := db.Exec(`INSERT INTO users (provider, external_id, mail, display_name,
+    given_name, surname, job_title, disabled, created_at, updated_at, last_login_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, FALSE, ?, ?, ?) ON DUPLICATE KEY UPDATE
+    id = LAST_INSERT_ID(id), mail = VALUES(mail), display_name = VALUES(display_name),
+    given_name = VALUES(given_name), surname = VALUES(surname), job_title = VALUES(job_title),
+    disabled = FALSE, updated_at = VALUES(updated_at),
+    last_login_at = COALESCE(VALUES(last_login_at), last_login_at)`,
+		user.Provider, user.ExternalID, user.Mail, user.DisplayName, user.GivenName,
+		user.Surname, user.JobTitle, now, now, timePtrArg(user.LastLoginAt))
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetUser returns sql.ErrNoRows for unknown IDs
+func GetUser(dsn string, id int64) (User, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return User{}, err
+	}
+	defer db.Close()
+
+	user, err := scanUser(db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err)
+	}
+	return user, err
+}
+
+// GetUsers lists the users matching filter by name, disabled ones included
+func GetUsers(dsn string, filter UserFilter) ([]User, error) {
+	var users []User
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Query) + "%"
+	rows, err := db.Query(`SELECT `+userColumns+` FROM users WHERE mail LIKE ? OR
+    display_name LIKE ? ORDER BY display_name, id LIMIT ?`, pattern, pattern, filter.Limit)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// DisableUser marks a user removed from the provider's directory and tells whether there was one
+func DisableUser(dsn string, provider string, externalID string) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE users SET disabled = TRUE, updated_at = ? WHERE
+    provider = ? AND external_id = ?`, time.Now(), provider, externalID)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetDirectoryDelta returns where the last directory sync of provider stopped, "" before the first one
+func GetDirectoryDelta(dsn string, provider string) (string, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	defer db.Close()
+
+	var deltaLink string
+	err = db.QueryRow(`SELECT delta_link FROM directory_sync WHERE provider = ?`, provider).Scan(&deltaLink)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	return deltaLink, err
+}
+
+func SaveDirectoryDelta(dsn string, provider string, deltaLink string, syncedAt time.Time) error {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO directory_sync (provider, delta_link, synced_at)
+    VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE delta_link = VALUES(delta_link),
+    synced_at = VALUES(synced_at)`, provider, deltaLink, syncedAt)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+/*
+A WaitlistEntry is a faculty member waiting for a booked slot of a room. When
+the booking is cancelled the oldest entry of the slot gets it.
+*/
+type WaitlistEntry struct {
+	ID        int64     `json:"id"`
+	Class     string    `json:"class"`
+	Date      time.Time `json:"date"`
+	Slot      int       `json:"slot"`
+	Faculty   string    `json:"faculty"`
+	Subject   string    `json:"subject,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// A WaitlistFilter picks entries; zero fields match everything
+type WaitlistFilter struct {
+	Class   string
+	Date    time.Time
+	Slot    int
+	Faculty string
+}
+
+// JoinWaitlist stores entry and returns its ID
+func JoinWaitlist(dsn string, entry WaitlistEntry) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO waitlist (class_id, date, slot_id, faculty_id,
+    subject, created_at) VALUES (?, ?, ?, ?, ?, ?)`, entry.Class, entry.Date, entry.Slot,
+		entry.Faculty, entry.Subject, entry.CreatedAt)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func LeaveWaitlist(dsn string, id int64) (int64, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM waitlist WHERE id = ?`, id)
+	if err != nil {
+		log.Println(err)
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetWaitlist lists the entries matching filter, oldest first
+func GetWaitlist(dsn string, filter WaitlistFilter) ([]WaitlistEntry, error) {
+	var entries []WaitlistEntry
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer db.Close()
+
+	clause, args := where([]string{"class_id = ?", "date = ?", "slot_id = ?", "faculty_id = ?"},
+		[]interface{}{filter.Class, filter.Date, filter.Slot, filter.Faculty})
+	rows, err := db.Query(`SELECT id, class_id, date, slot_id, faculty_id, subject, created_at
+    FROM waitlist`+clause+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp WaitlistEntry
+		err := rows.Scan(&tmp.ID, &tmp.Class, &tmp.Date, &tmp.Slot, &tmp.Faculty, &tmp.Subject, &tmp.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		entries = append(entries, tmp)
+	}
+	return entries, rows.Err()
+}
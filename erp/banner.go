@@ -0,0 +1,164 @@
+package erp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// How many sections Banner is asked for at once
+const bannerPageSize = 500
+
+/*
+Banner reads the class search results of a term from Ellucian Banner 9
+Student Registration, URL being its searchResults endpoint with the term
+filled in. It syncs the courses, their primary faculty and the timetable;
+Banner's rooms are not a classroom list so those are left alone. A section's
+course is its subject and course number, like CSE and 311 for CSE311, and its
+classroom the building and room, like A and 104 for A104.
+*/
+type Banner struct {
+	ImporterName string
+	URL          string
+	Token        string
+	Client       *http.Client
+}
+
+type bannerPage struct {
+	Success    bool            `json:"success"`
+	TotalCount int             `json:"totalCount"`
+	Data       []bannerSection `json:"data"`
+}
+
+type bannerSection struct {
+	Subject      string `json:"subject"`
+	CourseNumber string `json:"courseNumber"`
+	CourseTitle  string `json:"courseTitle"`
+	Faculty      []struct {
+		DisplayName      string `json:"displayName"`
+		EmailAddress     string `json:"emailAddress"`
+		PrimaryIndicator bool   `json:"primaryIndicator"`
+	} `json:"faculty"`
+	MeetingsFaculty []struct {
+		MeetingTime bannerMeeting `json:"meetingTime"`
+	} `json:"meetingsFaculty"`
+}
+
+type bannerMeeting struct {
+	Building  string `json:"building"`
+	Room      string `json:"room"`
+	BeginTime string `json:"beginTime"`
+	EndTime   string `json:"endTime"`
+	Monday    bool   `json:"monday"`
+	Tuesday   bool   `json:"tuesday"`
+	Wednesday bool   `json:"wednesday"`
+	Thursday  bool   `json:"thursday"`
+	Friday    bool   `json:"friday"`
+	Saturday  bool   `json:"saturday"`
+	Sunday    bool   `json:"sunday"`
+}
+
+func (b *Banner) Name() string { return b.ImporterName }
+
+func (b *Banner) Import(ctx context.Context) (Snapshot, error) {
+	snapshot := Snapshot{Courses: []Course{}, Faculty: []Person{}, Timetable: []Period{}}
+	courses := make(map[string]bool)
+	faculty := make(map[string]bool)
+	for offset := 0; ; {
+		page, err := b.page(ctx, offset)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		for _, section := range page.Data {
+			course := strings.TrimSpace(section.Subject) + strings.TrimSpace(section.CourseNumber)
+			if course == "" {
+				continue
+			}
+			if !courses[course] {
+				courses[course] = true
+				snapshot.Courses = append(snapshot.Courses, Course{Code: course, Title: section.CourseTitle})
+			}
+			var mail string
+			for _, person := range section.Faculty {
+				if person.PrimaryIndicator && person.EmailAddress != "" {
+					mail = person.EmailAddress
+					if !faculty[mail] {
+						faculty[mail] = true
+						snapshot.Faculty = append(snapshot.Faculty, Person{Mail: mail, Name: person.DisplayName})
+					}
+					break
+				}
+			}
+			for _, meeting := range section.MeetingsFaculty {
+				snapshot.Timetable = append(snapshot.Timetable, bannerPeriods(meeting.MeetingTime, course, mail)...)
+			}
+		}
+		offset += len(page.Data)
+		if len(page.Data) == 0 || offset >= page.TotalCount {
+			return snapshot, nil
+		}
+	}
+}
+
+// page reads the sections from offset on
+func (b *Banner) page(ctx context.Context, offset int) (bannerPage, error) {
+	var page bannerPage
+	pageURL, err := url.Parse(b.URL)
+	if err != nil {
+		return page, fmt.Errorf("erp: %v", err)
+	}
+	query := pageURL.Query()
+	query.Set("pageOffset", strconv.Itoa(offset))
+	query.Set("pageMaxSize", strconv.Itoa(bannerPageSize))
+	pageURL.RawQuery = query.Encode()
+
+	resp, err := get(ctx, b.Client, pageURL.String(), b.Token)
+	if err != nil {
+		return page, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return page, fmt.Errorf("erp: GET %s: %v", b.URL, err)
+	}
+	if !page.Success {
+		return page, fmt.Errorf("erp: GET %s: the search failed, is the term set?", b.URL)
+	}
+	return page, nil
+}
+
+// bannerPeriods returns a period for every day the meeting is on; meetings with no room or time are skipped
+func bannerPeriods(meeting bannerMeeting, course string, faculty string) []Period {
+	class := strings.TrimSpace(meeting.Building) + strings.TrimSpace(meeting.Room)
+	start, end := bannerTime(meeting.BeginTime), bannerTime(meeting.EndTime)
+	if class == "" || start == "" || end == "" {
+		return nil
+	}
+	days := []struct {
+		on  bool
+		day string
+	}{
+		{meeting.Monday, "MON"}, {meeting.Tuesday, "TUE"}, {meeting.Wednesday, "WED"},
+		{meeting.Thursday, "THU"}, {meeting.Friday, "FRI"}, {meeting.Saturday, "SAT"},
+		{meeting.Sunday, "SUN"},
+	}
+	var periods []Period
+	for _, day := range days {
+		if day.on {
+			periods = append(periods, Period{Class: class, Day: day.day, Start: start, End: end,
+				Course: course, Faculty: faculty})
+		}
+	}
+	return periods
+}
+
+// bannerTime turns Banner's 0800 into 08:00
+func bannerTime(hhmm string) string {
+	if len(hhmm) != 4 {
+		return ""
+	}
+	return hhmm[:2] + ":" + hhmm[2:]
+}
@@ -0,0 +1,154 @@
+package erp
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+CSV reads the exports an ERP writes into Dir, each with a header line naming
+its columns, in any order:
+
+	classrooms.csv  id, capacity, building, floor, campus
+	courses.csv     code, title
+	faculty.csv     mail, name
+	timetable.csv   class, day, slot or start and end, course, faculty
+
+Files that are not there are not synced.
+*/
+type CSV struct {
+	ImporterName string
+	Dir          string
+}
+
+func (c CSV) Name() string { return c.ImporterName }
+
+func (c CSV) Import(ctx context.Context) (Snapshot, error) {
+	var snapshot Snapshot
+	found, err := c.read("classrooms.csv", []string{"id"}, func(row map[string]string) error {
+		classroom := Classroom{ID: row["id"], Building: row["building"], Campus: row["campus"]}
+		var err error
+		if classroom.Capacity, err = atoi(row["capacity"]); err != nil {
+			return err
+		}
+		classroom.Floor, err = atoi(row["floor"])
+		snapshot.Classrooms = append(snapshot.Classrooms, classroom)
+		return err
+	})
+	if err != nil {
+		return snapshot, err
+	}
+	if found && snapshot.Classrooms == nil {
+		snapshot.Classrooms = []Classroom{}
+	}
+
+	found, err = c.read("courses.csv", []string{"code", "title"}, func(row map[string]string) error {
+		snapshot.Courses = append(snapshot.Courses, Course{Code: row["code"], Title: row["title"]})
+		return nil
+	})
+	if err != nil {
+		return snapshot, err
+	}
+	if found && snapshot.Courses == nil {
+		snapshot.Courses = []Course{}
+	}
+
+	found, err = c.read("faculty.csv", []string{"mail", "name"}, func(row map[string]string) error {
+		snapshot.Faculty = append(snapshot.Faculty, Person{Mail: row["mail"], Name: row["name"]})
+		return nil
+	})
+	if err != nil {
+		return snapshot, err
+	}
+	if found && snapshot.Faculty == nil {
+		snapshot.Faculty = []Person{}
+	}
+
+	found, err = c.read("timetable.csv", []string{"class", "day", "course"}, func(row map[string]string) error {
+		period := Period{Class: row["class"], Day: row["day"], Start: row["start"], End: row["end"],
+			Course: row["course"], Faculty: row["faculty"]}
+		var err error
+		period.Slot, err = atoi(row["slot"])
+		snapshot.Timetable = append(snapshot.Timetable, period)
+		return err
+	})
+	if err != nil {
+		return snapshot, err
+	}
+	if found && snapshot.Timetable == nil {
+		snapshot.Timetable = []Period{}
+	}
+	return snapshot, nil
+}
+
+/*
+read calls add with every row of the file name, by column, after checking its
+header has the required columns. It reports whether the file is there at all.
+*/
+func (c CSV) read(name string, required []string, add func(row map[string]string) error) (bool, error) {
+	file, err := os.Open(filepath.Join(c.Dir, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return true, fmt.Errorf("erp: %s: %v", name, err)
+	}
+	for idx := range header {
+		header[idx] = strings.ToLower(strings.TrimSpace(header[idx]))
+	}
+	for _, column := range required {
+		if !contains(header, column) {
+			return true, fmt.Errorf("erp: %s has no %s column", name, column)
+		}
+	}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, fmt.Errorf("erp: %s: %v", name, err)
+		}
+		row := make(map[string]string, len(header))
+		for idx, column := range header {
+			if idx < len(record) {
+				row[column] = strings.TrimSpace(record[idx])
+			}
+		}
+		if err := add(row); err != nil {
+			return true, fmt.Errorf("erp: %s line %d: %v", name, line, err)
+		}
+	}
+}
+
+// atoi reads an optional number, 0 when it is empty
+func atoi(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+/*
+Package erp reads classrooms, courses, faculty and the weekly timetable from
+the university's ERP or student information system. The API only knows the
+Importer interface; which adapter is behind each one is decided by
+config.json:
+
+	{"name": "exports", "kind": "csv", "dir": "/var/lib/cora/erp"}
+	{"name": "sis", "kind": "rest", "timetableURL": "https://sis.example.edu/api/timetable", "token": "..."}
+	{"name": "banner", "kind": "banner", "url": "https://banner.example.edu/StudentRegistrationSsb/ssb/searchResults/searchResults?txt_term=202310"}
+
+What an importer leaves out of its Snapshot is not synced.
+*/
+package erp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// An Importer reads what the ERP holds now
+type Importer interface {
+	Name() string
+	Import(ctx context.Context) (Snapshot, error)
+}
+
+/*
+Snapshot is what an ERP holds. A nil slice means the importer does not sync
+that kind of data, an empty one that the ERP has none.
+*/
+type Snapshot struct {
+	Classrooms []Classroom `json:"classrooms"`
+	Courses    []Course    `json:"courses"`
+	Faculty    []Person    `json:"faculty"`
+	Timetable  []Period    `json:"timetable"`
+}
+
+type Classroom struct {
+	ID       string `json:"id"`
+	Capacity int    `json:"capacity"`
+	Building string `json:"building"`
+	Floor    int    `json:"floor"`
+	Campus   string `json:"campus"`
+}
+
+// A course, by its subject code like 19CSE311
+type Course struct {
+	Code  string `json:"code"`
+	Title string `json:"title"`
+}
+
+// A faculty member, by mail
+type Person struct {
+	Mail string `json:"mail"`
+	Name string `json:"name"`
+}
+
+/*
+Period is a weekly meeting of a course in a classroom. Day is a day code or
+name, like TUE or Tuesday. It is in Slot, or, for ERPs that do not know the
+slots, from Start to End, like 08:00 and 09:40, which the API maps to slots.
+*/
+type Period struct {
+	Class   string `json:"class"`
+	Day     string `json:"day"`
+	Slot    int    `json:"slot,omitempty"`
+	Start   string `json:"start,omitempty"`
+	End     string `json:"end,omitempty"`
+	Course  string `json:"course"`
+	Faculty string `json:"faculty,omitempty"`
+}
+
+// The layout of an importer in the erp block of config.json, see the package comment
+type Config struct {
+	Name string `json:"name"`
+	// "csv", "rest" or "banner"
+	Kind string `json:"kind"`
+	// Directory of the CSV exports
+	Dir string `json:"dir"`
+	// Where the REST importer reads each kind of data from; kinds without a URL are not synced
+	ClassroomsURL string `json:"classroomsURL"`
+	CoursesURL    string `json:"coursesURL"`
+	FacultyURL    string `json:"facultyURL"`
+	TimetableURL  string `json:"timetableURL"`
+	// Banner class search results of a term
+	URL string `json:"url"`
+	// Sent as a bearer token when set
+	Token string `json:"token"`
+}
+
+// New returns the Importer config describes
+func New(config Config) (Importer, error) {
+	if config.Name == "" {
+		return nil, errors.New("erp: an importer needs a name")
+	}
+	switch config.Kind {
+	case "csv":
+		if config.Dir == "" {
+			return nil, errors.New("erp: csv needs dir")
+		}
+		return CSV{ImporterName: config.Name, Dir: config.Dir}, nil
+	case "rest":
+		if config.ClassroomsURL == "" && config.CoursesURL == "" && config.FacultyURL == "" && config.TimetableURL == "" {
+			return nil, errors.New("erp: rest needs at least one URL")
+		}
+		return &REST{
+			ImporterName:  config.Name,
+			ClassroomsURL: config.ClassroomsURL,
+			CoursesURL:    config.CoursesURL,
+			FacultyURL:    config.FacultyURL,
+			TimetableURL:  config.TimetableURL,
+			Token:         config.Token,
+		}, nil
+	case "banner":
+		if config.URL == "" {
+			return nil, errors.New("erp: banner needs url")
+		}
+		return &Banner{ImporterName: config.Name, URL: config.URL, Token: config.Token}, nil
+	}
+	return nil, fmt.Errorf("erp: unknown kind %q", config.Kind)
+}
+
+func defaultHTTPClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return &http.Client{Timeout: time.Minute}
+}
+
+// get sends a GET to url, with token as a bearer token when it is set
+func get(ctx context.Context, client *http.Client, url string, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := defaultHTTPClient(client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("erp: GET %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,101 @@
+package erp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"classrooms.csv": "id,capacity,building\nA104,60,A\nC301,40,C\n",
+		"timetable.csv":  "Class, Day, Start, End, Course\nA104,TUE,08:00,08:50,19CSE311\n",
+		"courses.csv":    "code,title\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot, err := CSV{ImporterName: "exports", Dir: dir}.Import(context.Background())
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	want := Snapshot{
+		Classrooms: []Classroom{{ID: "A104", Capacity: 60, Building: "A"}, {ID: "C301", Capacity: 40, Building: "C"}},
+		Courses:    []Course{},
+		Timetable:  []Period{{Class: "A104", Day: "TUE", Start: "08:00", End: "08:50", Course: "19CSE311"}},
+	}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("Import = %+v, want %+v", snapshot, want)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "faculty.csv"), []byte("name\nAda\n"), 0o644)
+	if _, err := (CSV{Dir: dir}).Import(context.Background()); err == nil {
+		t.Error("Import of a faculty.csv with no mail column succeeded")
+	}
+}
+
+func TestBanner(t *testing.T) {
+	pages := []string{
+		`{"success": true, "totalCount": 2, "data": [{"subject": "CSE", "courseNumber": "311",
+		  "courseTitle": "Compilers", "faculty": [{"displayName": "Ada", "emailAddress": "ada@example.edu",
+		  "primaryIndicator": true}], "meetingsFaculty": [{"meetingTime": {"building": "A", "room": "104",
+		  "beginTime": "0800", "endTime": "0850", "tuesday": true, "thursday": true}}]}]}`,
+		`{"success": true, "totalCount": 2, "data": [{"subject": "CSE", "courseNumber": "311",
+		  "courseTitle": "Compilers", "meetingsFaculty": [{"meetingTime": {"building": null, "room": null}}]}]}`,
+	}
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		if r.URL.Query().Get("txt_term") != "202310" {
+			t.Errorf("the term is gone from %s", r.URL)
+		}
+		if r.URL.Query().Get("pageOffset") == "0" {
+			w.Write([]byte(pages[0]))
+		} else {
+			w.Write([]byte(pages[1]))
+		}
+	}))
+	defer server.Close()
+
+	importer, err := New(Config{Name: "banner", Kind: "banner", URL: server.URL + "/searchResults?txt_term=202310", Token: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := importer.Import(context.Background())
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	want := Snapshot{
+		Courses: []Course{{Code: "CSE311", Title: "Compilers"}},
+		Faculty: []Person{{Mail: "ada@example.edu", Name: "Ada"}},
+		Timetable: []Period{
+			{Class: "A104", Day: "TUE", Start: "08:00", End: "08:50", Course: "CSE311", Faculty: "ada@example.edu"},
+			{Class: "A104", Day: "THU", Start: "08:00", End: "08:50", Course: "CSE311", Faculty: "ada@example.edu"},
+		},
+	}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("Import = %+v, want %+v", snapshot, want)
+	}
+	if len(tokens) != 2 || tokens[0] != "Bearer s3cret" {
+		t.Errorf("requests were authorized with %q, want two with the token", tokens)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, config := range []Config{
+		{Kind: "csv", Dir: "."},
+		{Name: "sis", Kind: "rest"},
+		{Name: "sis", Kind: "ldap"},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("New(%+v) succeeded", config)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package erp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+/*
+REST pulls each kind of data as a JSON array from its URL, in the layout of
+Snapshot's elements. A kind without a URL is not synced.
+*/
+type REST struct {
+	ImporterName  string
+	ClassroomsURL string
+	CoursesURL    string
+	FacultyURL    string
+	TimetableURL  string
+	Token         string
+	Client        *http.Client
+}
+
+func (r *REST) Name() string { return r.ImporterName }
+
+func (r *REST) Import(ctx context.Context) (Snapshot, error) {
+	var snapshot Snapshot
+	pulls := []struct {
+		url string
+		v   interface{}
+	}{
+		{r.ClassroomsURL, &snapshot.Classrooms},
+		{r.CoursesURL, &snapshot.Courses},
+		{r.FacultyURL, &snapshot.Faculty},
+		{r.TimetableURL, &snapshot.Timetable},
+	}
+	for _, pull := range pulls {
+		if pull.url == "" {
+			continue
+		}
+		if err := r.pull(ctx, pull.url, pull.v); err != nil {
+			return Snapshot{}, err
+		}
+	}
+	// An empty array syncs none, unlike a kind that is not pulled
+	if r.ClassroomsURL != "" && snapshot.Classrooms == nil {
+		snapshot.Classrooms = []Classroom{}
+	}
+	if r.CoursesURL != "" && snapshot.Courses == nil {
+		snapshot.Courses = []Course{}
+	}
+	if r.FacultyURL != "" && snapshot.Faculty == nil {
+		snapshot.Faculty = []Person{}
+	}
+	if r.TimetableURL != "" && snapshot.Timetable == nil {
+		snapshot.Timetable = []Period{}
+	}
+	return snapshot, nil
+}
+
+func (r *REST) pull(ctx context.Context, url string, v interface{}) error {
+	resp, err := get(ctx, r.Client, url, r.Token)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("erp: GET %s: %v", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+/*
+Package fields trims JSON responses to the fields a client asks for in the
+fields query parameter, so an app on a slow connection only downloads what it
+shows. fields=class,slot keeps those members of an object, or of every object
+of an array; a dotted name like equipment.kind reaches into nested ones.
+Requests without the parameter, error responses and other content types are
+left alone.
+*/
+package fields
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The fields kept of an object, in the order asked for; a nil tree keeps the whole value
+type tree struct {
+	names    []string
+	children map[string]*tree
+}
+
+// parse turns a fields parameter into a tree, nil when it names nothing
+func parse(param string) *tree {
+	var root *tree
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if root == nil {
+			root = &tree{children: make(map[string]*tree)}
+		}
+		root.add(strings.Split(path, "."))
+	}
+	return root
+}
+
+func (t *tree) add(path []string) {
+	name := path[0]
+	child, ok := t.children[name]
+	if !ok {
+		t.names = append(t.names, name)
+	}
+	if len(path) == 1 {
+		// The whole of it, whatever was asked of it before
+		t.children[name] = nil
+		return
+	}
+	if ok && child == nil {
+		return
+	}
+	if child == nil {
+		child = &tree{children: make(map[string]*tree)}
+		t.children[name] = child
+	}
+	child.add(path[1:])
+}
+
+// filter trims data to t; scalars are kept as they are
+func filter(data json.RawMessage, t *tree) (json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	if t == nil || len(data) == 0 {
+		return data, nil
+	}
+	switch data[0] {
+	case '{':
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for _, name := range t.names {
+			value, ok := object[name]
+			if !ok {
+				continue
+			}
+			value, err := filter(value, t.children[name])
+			if err != nil {
+				return nil, err
+			}
+			if buf.Len() > 1 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(name)
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+		return buf.Bytes(), nil
+	case '[':
+		var array []json.RawMessage
+		if err := json.Unmarshal(data, &array); err != nil {
+			return nil, err
+		}
+		for i := range array {
+			value, err := filter(array[i], t)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = value
+		}
+		return json.Marshal(array)
+	}
+	return data, nil
+}
+
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := parse(r.URL.Query().Get("fields"))
+		if t == nil || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fw := &responseWriter{ResponseWriter: w, fields: t, status: http.StatusOK}
+		defer fw.close()
+		next.ServeHTTP(fw, r)
+	})
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	fields *tree
+	status int
+	// Set once the status is known
+	wroteHeader bool
+	// Set when the response is not trimmed and goes straight out
+	passThrough bool
+	buf         bytes.Buffer
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if status < 200 || status >= 300 || mediaType != "application/json" {
+		w.passThrough = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passThrough {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// close sends the trimmed response, or the whole of it when it is not valid JSON
+func (w *responseWriter) close() {
+	if !w.wroteHeader || w.passThrough {
+		return
+	}
+	body, err := filter(w.buf.Bytes(), w.fields)
+	if err != nil {
+		body = w.buf.Bytes()
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
+
+// Flush only reaches the client for responses that are not trimmed, the others are sent whole in the end
+func (w *responseWriter) Flush() {
+	if !w.passThrough {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
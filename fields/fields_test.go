@@ -0,0 +1,58 @@
+package fields
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(t *testing.T, target string, status int, contentType string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	return rec
+}
+
+func TestTrimsObjects(t *testing.T) {
+	body := `{"slot":2,"until":"09:40","classes":["A104"]}`
+	rec := serve(t, "/?fields=classes,slot", http.StatusOK, "application/json", body)
+	if want := `{"classes":["A104"],"slot":2}`; rec.Body.String() != want {
+		t.Errorf("body = %s; want %s", rec.Body.String(), want)
+	}
+	rec = serve(t, "/", http.StatusOK, "application/json", body)
+	if rec.Body.String() != body {
+		t.Errorf("body without fields = %s; want it whole", rec.Body.String())
+	}
+}
+
+func TestTrimsArraysAndNested(t *testing.T) {
+	body := `[{"id":"PROJ-01","name":"Projector","reservations":[{"class":"A104","slot":2}]},{"id":"MIC-02","name":"Mic"}]`
+	rec := serve(t, "/?fields=id,reservations.slot", http.StatusOK, "application/json; charset=utf-8", body)
+	if want := `[{"id":"PROJ-01","reservations":[{"slot":2}]},{"id":"MIC-02"}]`; rec.Body.String() != want {
+		t.Errorf("body = %s; want %s", rec.Body.String(), want)
+	}
+	rec = serve(t, "/?fields=reservations.slot,reservations", http.StatusOK, "application/json", body)
+	if want := `[{"reservations":[{"class":"A104","slot":2}]},{}]`; rec.Body.String() != want {
+		t.Errorf("body asking for the whole of reservations = %s; want %s", rec.Body.String(), want)
+	}
+}
+
+func TestLeavesOthersAlone(t *testing.T) {
+	rec := serve(t, "/?fields=id", http.StatusNotFound, "text/plain; charset=utf-8", "No such equipment\n")
+	if rec.Code != http.StatusNotFound || rec.Body.String() != "No such equipment\n" {
+		t.Errorf("error = %d %q; want it untouched", rec.Code, rec.Body.String())
+	}
+	rec = serve(t, "/?fields=id", http.StatusOK, "text/calendar", "BEGIN:VCALENDAR")
+	if rec.Body.String() != "BEGIN:VCALENDAR" {
+		t.Errorf("calendar = %q; want it untouched", rec.Body.String())
+	}
+	rec = serve(t, "/?fields=id", http.StatusOK, "application/json", `{"id":`)
+	if rec.Body.String() != `{"id":` {
+		t.Errorf("invalid JSON = %q; want it untouched", rec.Body.String())
+	}
+}
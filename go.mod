@@ -1,8 +1,22 @@
 module github.com/deebakkarthi/coraserver
 
-go 1.15
+go 1.17
 
 require (
 	github.com/go-sql-driver/mysql v1.7.1
+	github.com/graph-gophers/graphql-go v1.3.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/net v0.12.0
 	golang.org/x/oauth2 v0.8.0
+	google.golang.org/grpc v1.57.0
+	google.golang.org/protobuf v1.31.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/opentracing/opentracing-go v1.2.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/appengine v1.6.7 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20230525234030-28d5490b6b19 // indirect
 )
@@ -0,0 +1,285 @@
+/*
+Package graph is a small client for the Microsoft Graph REST API. Every call
+is retried with exponential backoff when Graph answers 429 or 5xx (honoring the
+Retry-After header) and a circuit breaker stops us from hammering Graph while
+it is having an outage. A client sends at most MaxConcurrent requests at once
+and makes identical calls going at the same time share one request.
+*/
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/tracing"
+)
+
+const DefaultBaseURL = "https://graph.microsoft.com/v1.0/"
+
+// Returned without contacting Graph while the circuit breaker is open
+var ErrCircuitOpen = errors.New("graph: circuit breaker open")
+
+/*
+StatusError is returned when Graph answered with a non-200 status that is not
+worth retrying (or the retries ran out). Use Unavailable to tell Graph being
+down apart from Graph refusing the request.
+*/
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("graph: unexpected response status: %s", e.Status)
+}
+
+// Unauthorized reports whether Graph rejected the access token itself
+func (e *StatusError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+/*
+Unavailable reports whether err means Graph could not be reached or is
+failing on its side (network errors, 429, 5xx, open circuit), as opposed to
+Graph refusing the request. Handlers use it to pick 502 over 403.
+*/
+func Unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return retryable(statusErr.StatusCode)
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+const (
+	DefaultMaxConcurrent = 16
+	DefaultMaxQueued     = 256
+)
+
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	// Number of retries after the first attempt
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+
+	breaker *breaker
+	limiter *limiter
+	flights flights
+}
+
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: &tracing.Transport{}},
+		BaseURL:    DefaultBaseURL,
+		MaxRetries: 3,
+		BaseDelay:  200 * time.Millisecond,
+		MaxDelay:   5 * time.Second,
+		breaker:    newBreaker(5, 30*time.Second),
+		limiter:    newLimiter(DefaultMaxConcurrent, DefaultMaxQueued),
+	}
+}
+
+/*
+SetLimits lets at most maxConcurrent requests go to Graph at once, queueing at
+most maxQueued calls beyond that, or any number when it is 0; the rest fail
+with ErrBusy. It has to be called before the client is used.
+*/
+func (c *Client) SetLimits(maxConcurrent int, maxQueued int) {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	c.limiter = newLimiter(maxConcurrent, maxQueued)
+}
+
+/*
+Get performs an authenticated GET on endpoint (e.g. "me") and returns the body.
+A call identical to one going waits for that one's answer instead, see flights.
+*/
+func (c *Client) Get(ctx context.Context, accessToken string, endpoint string) ([]byte, error) {
+	return c.flights.do(ctx, accessToken+" "+endpoint, func() ([]byte, error) {
+		return c.call(ctx, accessToken, endpoint)
+	})
+}
+
+// call records a span covering the retries, each attempt gets one of its own from the transport
+func (c *Client) call(ctx context.Context, accessToken string, endpoint string) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "graph "+strings.SplitN(endpoint, "?", 2)[0], tracing.Client)
+	defer span.End()
+	if !c.breaker.allow() {
+		span.SetError(ErrCircuitOpen)
+		return nil, ErrCircuitOpen
+	}
+	body, err := c.get(ctx, accessToken, endpoint)
+	span.SetError(err)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrBusy):
+		// Says nothing about Graph, just give the trial slot back
+		c.breaker.release()
+	case Unavailable(err):
+		c.breaker.failure()
+	default:
+		// Any answer from Graph, even a 403, means it is up
+		c.breaker.success()
+	}
+	return body, err
+}
+
+func (c *Client) get(ctx context.Context, accessToken string, endpoint string) ([]byte, error) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		var body []byte
+		var wait time.Duration
+		body, wait, err = c.do(ctx, accessToken, endpoint)
+		if err == nil {
+			return body, nil
+		}
+		// Retrying would only make the queue longer
+		if !Unavailable(err) || errors.Is(err, ErrBusy) || attempt >= c.MaxRetries {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+		if wait > c.MaxDelay {
+			// Graph asked us to stay away for longer than we are willing to
+			// keep the user waiting
+			return nil, err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// do makes a single request once the limiter lets it. wait is the delay asked for by Retry-After, if any.
+func (c *Client) do(ctx context.Context, accessToken string, endpoint string) (body []byte, wait time.Duration, err error) {
+	err = c.limiter.acquire(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer c.limiter.release()
+	req, err := http.NewRequest("GET", c.BaseURL+endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		wait = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, wait, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: body}
+	}
+	return body, 0, nil
+}
+
+// Full jitter: a random delay in [0, BaseDelay*2^attempt), capped at MaxDelay
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// Retry-After is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+/*
+breaker is a consecutive failure circuit breaker. After threshold failed calls
+in a row it opens and rejects calls for cooldown. Once the cooldown is over a
+single trial call is let through (half open); its outcome closes the breaker
+or opens it for another cooldown.
+*/
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
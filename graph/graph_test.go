@@ -0,0 +1,227 @@
+package graph
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testClient(url string) *Client {
+	c := NewClient()
+	c.BaseURL = url + "/"
+	c.BaseDelay = time.Millisecond
+	c.MaxDelay = 50 * time.Millisecond
+	return c
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer ts.Close()
+
+	body, err := testClient(ts.URL).Get(context.Background(), "token", "me")
+	if err != nil {
+		t.Fatalf("Get() error = %v; want nil", err)
+	}
+	if string(body) != `{"id":"1"}` {
+		t.Errorf("Get() = %s; want {\"id\":\"1\"}", body)
+	}
+	if calls != 3 {
+		t.Errorf("server called %d times; want 3", calls)
+	}
+}
+
+func TestNoRetryOnForbidden(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer ts.Close()
+
+	_, err := testClient(ts.URL).Get(context.Background(), "token", "me")
+	statusErr, ok := err.(*StatusError)
+	if !ok || !statusErr.Unauthorized() {
+		t.Fatalf("Get() error = %v; want unauthorized *StatusError", err)
+	}
+	if Unavailable(err) {
+		t.Errorf("Unavailable(%v) = true; want false", err)
+	}
+	if calls != 1 {
+		t.Errorf("server called %d times; want 1", calls)
+	}
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	_, err := testClient(ts.URL).Get(context.Background(), "token", "me")
+	if !Unavailable(err) {
+		t.Errorf("Unavailable(%v) = false; want true", err)
+	}
+	if calls != 1 {
+		t.Errorf("server called %d times; want 1", calls)
+	}
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	c := testClient(ts.URL)
+	c.MaxRetries = 0
+	for i := 0; i < 5; i++ {
+		c.Get(context.Background(), "token", "me")
+	}
+	_, err := c.Get(context.Background(), "token", "me")
+	if err != ErrCircuitOpen {
+		t.Errorf("Get() error = %v; want ErrCircuitOpen", err)
+	}
+	if calls != 5 {
+		t.Errorf("server called %d times; want 5", calls)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var running, most int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&most)
+			if now <= seen || atomic.CompareAndSwapInt32(&most, seen, now) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	c := testClient(ts.URL)
+	c.SetLimits(2, 2)
+	errs := make(chan error, 5)
+	for i := 0; i < 4; i++ {
+		token := strconv.Itoa(i)
+		go func() {
+			_, err := c.Get(context.Background(), token, "me")
+			errs <- err
+		}()
+	}
+	// Two calls are at Graph and two queued, the next one does not fit
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		c.limiter.mu.Lock()
+		waiting := c.limiter.waiting
+		c.limiter.mu.Unlock()
+		if waiting == 2 && atomic.LoadInt32(&running) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls waiting and %d running; want 2 and 2", waiting, atomic.LoadInt32(&running))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := c.Get(context.Background(), "4", "me"); err != ErrBusy {
+		t.Errorf("Get() over the queue error = %v; want ErrBusy", err)
+	}
+	if most := atomic.LoadInt32(&most); most > 2 {
+		t.Errorf("%d requests at Graph at once; want at most 2", most)
+	}
+
+	full := testClient(ts.URL)
+	full.SetLimits(1, 0)
+	full.MaxRetries = 0
+	// Taken for good, every call has to queue
+	full.limiter.slots <- struct{}{}
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		_, err := full.Get(ctx, "5", "me")
+		cancel()
+		if err != ErrBusy {
+			t.Errorf("Get() out of time in the queue error = %v; want ErrBusy", err)
+		}
+	}
+	if !full.breaker.allow() {
+		t.Errorf("the breaker opened on calls that never reached Graph")
+	}
+}
+
+func TestIdenticalCallsShared(t *testing.T) {
+	var calls int32
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		started <- struct{}{}
+		<-release
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer ts.Close()
+
+	c := testClient(ts.URL)
+	bodies := make(chan string, 4)
+	get := func(token string) {
+		body, err := c.Get(context.Background(), token, "me")
+		if err != nil {
+			t.Error(err)
+		}
+		bodies <- string(body)
+	}
+	go get("alice")
+	<-started
+	go get("alice")
+	go get("alice")
+	go get("bob")
+	<-started
+	// Give the other calls for alice time to find the one going
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	got := map[string]int{}
+	for i := 0; i < 4; i++ {
+		got[<-bodies]++
+	}
+	if got["Bearer alice"] != 3 || got["Bearer bob"] != 1 {
+		t.Errorf("bodies = %v; want 3 for alice and 1 for bob", got)
+	}
+	if calls != 2 {
+		t.Errorf("server called %d times; want 2, once per user", calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 6, 13, 10, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"Tue, 13 Jun 2023 10:00:10 GMT": 10 * time.Second,
+		"garbage":                       0,
+	}
+	for value, want := range cases {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v; want %v", value, got, want)
+		}
+	}
+}
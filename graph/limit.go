@@ -0,0 +1,117 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Returned without contacting Graph when too many calls are already waiting for their turn, or a call's deadline passed while it waited
+var ErrBusy = errors.New("graph: too many calls waiting")
+
+/*
+limiter caps the requests to Graph in flight. Calls over the cap queue up
+until a request finishes or their context is done; past maxWaiting queued
+calls new ones fail with ErrBusy straight away, so a burst of logins cannot
+pile up goroutines without bound.
+*/
+type limiter struct {
+	slots      chan struct{}
+	maxWaiting int
+
+	mu      sync.Mutex
+	waiting int
+}
+
+func newLimiter(maxConcurrent int, maxWaiting int) *limiter {
+	return &limiter{slots: make(chan struct{}, maxConcurrent), maxWaiting: maxWaiting}
+}
+
+func (l *limiter) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	l.mu.Lock()
+	if l.maxWaiting > 0 && l.waiting >= l.maxWaiting {
+		l.mu.Unlock()
+		return ErrBusy
+	}
+	l.waiting++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		// Running out of time in the queue says nothing about Graph
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrBusy
+		}
+		return ctx.Err()
+	}
+}
+
+func (l *limiter) release() {
+	<-l.slots
+}
+
+// A call to Graph that others asking for the same thing wait for
+type flight struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+/*
+flights lets identical calls share one request: while a GET of an endpoint with
+an access token is going, the same GET with the same token waits for its
+result instead of making another. Tokens belong to one user, so nothing is
+shared between users.
+*/
+type flights struct {
+	mu      sync.Mutex
+	running map[string]*flight
+}
+
+/*
+do runs fetch unless an identical call is going, in which case it waits for
+that one. A shared result that failed only because the other caller gave up
+is not taken; the call is made again.
+*/
+func (f *flights) do(ctx context.Context, key string, fetch func() ([]byte, error)) ([]byte, error) {
+	for {
+		f.mu.Lock()
+		if f.running == nil {
+			f.running = make(map[string]*flight)
+		}
+		if call, ok := f.running[key]; ok {
+			f.mu.Unlock()
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if call.err != nil && (errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+				continue
+			}
+			// Every caller gets its own copy to unmarshal or keep
+			return append([]byte(nil), call.body...), call.err
+		}
+		call := &flight{done: make(chan struct{})}
+		f.running[key] = call
+		f.mu.Unlock()
+
+		call.body, call.err = fetch()
+		f.mu.Lock()
+		delete(f.running, key)
+		f.mu.Unlock()
+		close(call.done)
+		return call.body, call.err
+	}
+}
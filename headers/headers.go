@@ -0,0 +1,55 @@
+/*
+Package headers sets the security headers browsers look for on every response:
+HSTS, nosniff, a Content-Security-Policy fitting the embedded web app, and a
+Referrer-Policy. Each can be changed or left out per deployment, say when a
+proxy in front already sets it.
+*/
+package headers
+
+import "net/http"
+
+/*
+Options holds the value of each header; an empty one is not sent. Handlers may
+still set their own value, the ones here are only defaults.
+*/
+type Options struct {
+	Disabled                bool   `json:"disabled"`
+	StrictTransportSecurity string `json:"strictTransportSecurity"`
+	ContentTypeOptions      string `json:"contentTypeOptions"`
+	ContentSecurityPolicy   string `json:"contentSecurityPolicy"`
+	ReferrerPolicy          string `json:"referrerPolicy"`
+}
+
+/*
+The web app only loads its own script and stylesheet and calls its own API, so
+nothing else is allowed; nor is framing it, which also covers clickjacking.
+*/
+var DefaultOptions = Options{
+	StrictTransportSecurity: "max-age=31536000; includeSubDomains",
+	ContentTypeOptions:      "nosniff",
+	ContentSecurityPolicy:   "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'",
+	ReferrerPolicy:          "strict-origin-when-cross-origin",
+}
+
+func Handler(opts Options, next http.Handler) http.Handler {
+	if opts.Disabled {
+		return next
+	}
+	headers := map[string]string{
+		"Strict-Transport-Security": opts.StrictTransportSecurity,
+		"X-Content-Type-Options":    opts.ContentTypeOptions,
+		"Content-Security-Policy":   opts.ContentSecurityPolicy,
+		"Referrer-Policy":           opts.ReferrerPolicy,
+	}
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package headers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(t *testing.T, opts Options, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	Handler(opts, handler).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	return rec
+}
+
+func TestSetsDefaults(t *testing.T) {
+	rec := serve(t, DefaultOptions, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	want := map[string]string{
+		"Strict-Transport-Security": DefaultOptions.StrictTransportSecurity,
+		"X-Content-Type-Options":    "nosniff",
+		"Content-Security-Policy":   DefaultOptions.ContentSecurityPolicy,
+		"Referrer-Policy":           DefaultOptions.ReferrerPolicy,
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s = %q; want %q", name, got, value)
+		}
+	}
+}
+
+func TestLeavesOutEmpty(t *testing.T) {
+	opts := DefaultOptions
+	opts.StrictTransportSecurity = ""
+	rec := serve(t, opts, func(w http.ResponseWriter, r *http.Request) {})
+	if _, ok := rec.Header()["Strict-Transport-Security"]; ok {
+		t.Errorf("Strict-Transport-Security sent; want none")
+	}
+	if got := rec.Header().Get("Referrer-Policy"); got == "" {
+		t.Errorf("Referrer-Policy not sent")
+	}
+}
+
+func TestHandlerOverrides(t *testing.T) {
+	rec := serve(t, DefaultOptions, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "sandbox")
+	})
+	if got := rec.Header().Get("Content-Security-Policy"); got != "sandbox" {
+		t.Errorf("Content-Security-Policy = %q; want sandbox", got)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	rec := serve(t, Options{Disabled: true, ContentTypeOptions: "nosniff"}, func(w http.ResponseWriter, r *http.Request) {})
+	if len(rec.Header()) != 0 {
+		t.Errorf("headers = %v; want none", rec.Header())
+	}
+}
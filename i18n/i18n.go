@@ -0,0 +1,230 @@
+/*
+Package i18n translates what users read, error messages, notifications and
+digests, from English into the languages it has a bundle of. Messages are
+looked up by their English text, fmt verbs and all, so one without a
+translation stays English:
+
+	i18n.Sprintf("ta", "%s is due soon", title)
+
+Translations may reorder the arguments with explicit indexes, like %[2]s.
+Messages built before the language of who reads them is known, like
+notifications sent to several users, are a Message rendered with In.
+*/
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// English is the language of the messages themselves, and the fallback
+const English = "en"
+
+// The translations of one language, by English message
+type bundle struct {
+	// Of the errors answered to requests, see Translate
+	errors map[string]string
+	// Of the rest, see Message
+	messages map[string]string
+}
+
+var bundles = map[string]bundle{
+	"ta": tamil,
+}
+
+// Languages lists the languages there are messages in, English first
+func Languages() []string {
+	langs := []string{English}
+	for lang := range bundles {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs[1:])
+	return langs
+}
+
+// Supported tells whether there are messages in lang
+func Supported(lang string) bool {
+	_, ok := bundles[lang]
+	return ok || lang == English
+}
+
+/*
+Negotiate picks the language the client of an Accept-Language header, like
+"ta-IN,ta;q=0.9,en;q=0.8", prefers among those known reports. Only the
+primary subtag counts. It returns "" when none is known.
+*/
+func Negotiate(acceptLanguage string, known func(lang string) bool) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		lang := strings.ToLower(strings.SplitN(fields[0], "-", 2)[0])
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				q, err = strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					q = 0
+				}
+			}
+		}
+		if known(lang) && q > 0 {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	// Stable so that equal weights keep the client's order
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0].lang
+}
+
+// Language is Negotiate among the languages there are messages in, English when none matches
+func Language(acceptLanguage string) string {
+	if lang := Negotiate(acceptLanguage, Supported); lang != "" {
+		return lang
+	}
+	return English
+}
+
+// Sprintf formats the translation of format to lang
+func Sprintf(lang string, format string, args ...interface{}) string {
+	return M(format, args...).In(lang)
+}
+
+/*
+Translate translates the text of an error answered to a request to lang.
+Errors with arguments are recognised by the format they were made with, the
+arguments themselves are kept as they are. It returns message when it knows no
+translation.
+*/
+func Translate(lang string, message string) string {
+	bundle, ok := bundles[lang]
+	if !ok {
+		return message
+	}
+	if translation, ok := bundle.errors[message]; ok {
+		return translation
+	}
+	for _, p := range compiledPatterns(lang) {
+		if match := p.re.FindStringSubmatch(message); match != nil {
+			args := make([]interface{}, len(match)-1)
+			for idx, arg := range match[1:] {
+				args[idx] = arg
+			}
+			return fmt.Sprintf(p.translation, args...)
+		}
+	}
+	return message
+}
+
+// Message is a message to be formatted in the language of who reads it
+type Message struct {
+	Format string
+	// Messages among them are rendered in the same language
+	Args []interface{}
+}
+
+// M is the Message of format with args
+func M(format string, args ...interface{}) Message {
+	return Message{Format: format, Args: args}
+}
+
+// In renders m in lang
+func (m Message) In(lang string) string {
+	format := m.Format
+	if translation, ok := bundles[lang].messages[format]; ok {
+		format = translation
+	}
+	if len(m.Args) == 0 {
+		return format
+	}
+	args := make([]interface{}, len(m.Args))
+	for idx, arg := range m.Args {
+		if message, ok := arg.(Message); ok {
+			arg = message.In(lang)
+		}
+		args[idx] = arg
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// String renders m in English
+func (m Message) String() string {
+	return m.In(English)
+}
+
+// And lists parts, like "cancelled and moved to B201"
+func And(parts ...Message) Message {
+	switch len(parts) {
+	case 0:
+		return M("")
+	case 1:
+		return parts[0]
+	}
+	return M("%s and %s", And(parts[:len(parts)-1]...), parts[len(parts)-1])
+}
+
+// A message with arguments, recognised by the format it was made with
+type pattern struct {
+	re *regexp.Regexp
+	// With every verb a %s, the arguments are the matched text
+	translation string
+}
+
+var (
+	patternsOnce sync.Once
+	patterns     map[string][]pattern
+	verb         = regexp.MustCompile(`%(\[\d+\])?[-+# 0-9.]*[a-zA-Z]`)
+)
+
+func compiledPatterns(lang string) []pattern {
+	patternsOnce.Do(func() {
+		patterns = make(map[string][]pattern)
+		for lang, bundle := range bundles {
+			for format, translation := range bundle.errors {
+				if !verb.MatchString(format) {
+					continue
+				}
+				patterns[lang] = append(patterns[lang], pattern{
+					re:          formatPattern(format),
+					translation: verb.ReplaceAllString(translation, "%${1}s"),
+				})
+			}
+			// Longest first, so that the most specific format wins
+			sort.Slice(patterns[lang], func(i, j int) bool {
+				return len(patterns[lang][i].re.String()) > len(patterns[lang][j].re.String())
+			})
+		}
+	})
+	return patterns[lang]
+}
+
+// formatPattern matches the messages fmt makes of format, capturing each argument
+func formatPattern(format string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	rest := strings.ReplaceAll(format, "%%", "\x00")
+	for {
+		loc := verb.FindStringIndex(rest)
+		if loc == nil {
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(strings.ReplaceAll(rest[:loc[0]], "\x00", "%")))
+		expr.WriteString("(.+?)")
+		rest = rest[loc[1]:]
+	}
+	expr.WriteString(regexp.QuoteMeta(strings.ReplaceAll(rest, "\x00", "%")))
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
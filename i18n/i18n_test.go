@@ -0,0 +1,50 @@
+package i18n
+
+import "testing"
+
+func TestTranslate(t *testing.T) {
+	cases := map[string]string{
+		"Invalid slot value":     "slot மதிப்பு தவறானது",
+		"No such booking":        "அத்தகைய முன்பதிவு இல்லை",
+		"No such widget":         "அத்தகைய widget இல்லை",
+		"You are busy in slot 3": "பாடவேளை 3-இல் நீங்கள் வேலையாக உள்ளீர்கள்",
+		"Something went wrong":   "Something went wrong",
+	}
+	for message, want := range cases {
+		if got := Translate("ta", message); got != want {
+			t.Errorf("Translate(ta, %q) = %q; want %q", message, got, want)
+		}
+	}
+	if got := Translate("fr", "No such booking"); got != "No such booking" {
+		t.Errorf("Translate(fr) = %q; want it untouched", got)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	period := M("%s in %s on %s, slot %d", "19CSE311", "A104", "2023-06-13", 3)
+	body := M("%s is %s", period, And(M("cancelled"), M("moved to %s", "B201")))
+	if got, want := body.String(), "19CSE311 in A104 on 2023-06-13, slot 3 is cancelled and moved to B201"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+	want := "2023-06-13 அன்று A104-இல் 19CSE311, பாடவேளை 3 ரத்து செய்யப்பட்டது மற்றும் B201-க்கு மாற்றப்பட்டது"
+	if got := body.In("ta"); got != want {
+		t.Errorf("In(ta) = %q; want %q", got, want)
+	}
+	if got := Sprintf("ta", "Attendance in %s below %g%%", "19CSE311", 75.0); got != "19CSE311 வருகைப்பதிவு 75%-க்குக் கீழ் உள்ளது" {
+		t.Errorf("Sprintf(ta) = %q", got)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	cases := map[string]string{
+		"":                        "en",
+		"ta-IN,ta;q=0.9,en;q=0.8": "ta",
+		"hi, ta;q=0.5":            "ta",
+		"ta;q=0":                  "en",
+	}
+	for header, want := range cases {
+		if lang := Language(header); lang != want {
+			t.Errorf("Language(%q) = %q; want %q", header, lang, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package i18n
+
+// Tamil, the language of the Coimbatore campus
+var tamil = bundle{
+	errors: map[string]string{
+		"Invalid %s value":         "%s மதிப்பு தவறானது",
+		"Invalid preferences: %s":  "விருப்பங்கள் தவறானவை: %s",
+		"Invalid request body":     "கோரிக்கையின் உள்ளடக்கம் தவறானது",
+		"Invalid API key":          "API சாவி தவறானது",
+		"Invalid or expired state": "state தவறானது அல்லது காலாவதியானது",
+		"Invalid signature":        "கையொப்பம் தவறானது",
+		"Invalid backup":           "காப்புப்பிரதி தவறானது",
+
+		"No such %s":             "அத்தகைய %s இல்லை",
+		"No such active API key": "செயலில் உள்ள அத்தகைய API சாவி இல்லை",
+		"No such announcement":   "அத்தகைய அறிவிப்பு இல்லை",
+		"No such appointment":    "அத்தகைய சந்திப்பு இல்லை",
+		"No such assignment":     "அத்தகைய ஒப்படைப்பு இல்லை",
+		"No such attachment":     "அத்தகைய இணைப்பு இல்லை",
+		"No such block":          "அத்தகைய தடை இல்லை",
+		"No such booking":        "அத்தகைய முன்பதிவு இல்லை",
+		"No such building":       "அத்தகைய கட்டிடம் இல்லை",
+		"No such campus":         "அத்தகைய வளாகம் இல்லை",
+		"No such change request": "அத்தகைய மாற்றக் கோரிக்கை இல்லை",
+		"No such class":          "அத்தகைய வகுப்பறை இல்லை",
+		"No such club":           "அத்தகைய மன்றம் இல்லை",
+		"No such equipment":      "அத்தகைய உபகரணம் இல்லை",
+		"No such event":          "அத்தகைய நிகழ்வு இல்லை",
+		"No such exam":           "அத்தகைய தேர்வு இல்லை",
+		"No such faculty":        "அத்தகைய ஆசிரியர் இல்லை",
+		"No such favorite":       "அத்தகைய விருப்பம் இல்லை",
+		"No such period":         "அத்தகைய பாடவேளை இல்லை",
+		"No such session":        "அத்தகைய அமர்வு இல்லை",
+		"No such slot":           "அத்தகைய நேரம் இல்லை",
+		"No such user":           "அத்தகைய பயனர் இல்லை",
+		"No such waitlist entry": "காத்திருப்புப் பட்டியலில் அத்தகைய பதிவு இல்லை",
+
+		"Not logged in":  "உள்நுழையவில்லை",
+		"Forbidden":      "அனுமதி இல்லை",
+		"Unknown tenant": "அறியப்படாத நிறுவனம்",
+
+		"Already closed":          "ஏற்கனவே மூடப்பட்டது",
+		"Already decided":         "ஏற்கனவே முடிவு செய்யப்பட்டது",
+		"Already on the waitlist": "ஏற்கனவே காத்திருப்புப் பட்டியலில் உள்ளீர்கள்",
+		"Already requested":       "ஏற்கனவே கோரப்பட்டது",
+
+		"Booking no longer exists":       "முன்பதிவு இனி இல்லை",
+		"The booking is over":            "முன்பதிவு முடிந்துவிட்டது",
+		"The class was cancelled":        "வகுப்பு ரத்து செய்யப்பட்டது",
+		"The slot has been booked again": "இந்த நேரம் மீண்டும் முன்பதிவு செய்யப்பட்டுள்ளது",
+		"The slot is no longer free":     "இந்த நேரம் இனி காலியாக இல்லை",
+		"The slot is not booked":         "இந்த நேரம் முன்பதிவு செய்யப்படவில்லை",
+		"You already hold the booking":   "இந்த முன்பதிவு ஏற்கனவே உங்களிடம் உள்ளது",
+		"You are busy in slot %s":        "பாடவேளை %s-இல் நீங்கள் வேலையாக உள்ளீர்கள்",
+		"Overlaps another appointment":   "மற்றொரு சந்திப்புடன் நேரம் மோதுகிறது",
+		"The user is disabled":           "பயனர் முடக்கப்பட்டுள்ளார்",
+		"The link has expired":           "இணைப்பு காலாவதியாகிவிட்டது",
+
+		"File too large":         "கோப்பு மிகப் பெரியது",
+		"Request body too large": "கோரிக்கையின் உள்ளடக்கம் மிகப் பெரியது",
+		"Preferences too large":  "விருப்பங்கள் மிகப் பெரியவை",
+		"Unsupported file type":  "ஆதரிக்கப்படாத கோப்பு வகை",
+		"Attachment unavailable": "இணைப்பு கிடைக்கவில்லை",
+		"Too many favorites":     "விருப்பங்கள் மிக அதிகம்",
+		"Too many members":       "உறுப்பினர்கள் மிக அதிகம்",
+		"Rate limit exceeded":    "கோரிக்கைகள் மிக அதிகம்",
+		"Challenge required":     "சரிபார்ப்பு தேவை",
+		"Challenge failed":       "சரிபார்ப்பு தோல்வியடைந்தது",
+
+		"Too many broadcasts, try again later":        "ஒளிபரப்புகள் மிக அதிகம், பின்னர் மீண்டும் முயலவும்",
+		"Too many failed attempts, try again later":   "தோல்வியுற்ற முயற்சிகள் மிக அதிகம், பின்னர் மீண்டும் முயலவும்",
+		"Too many reports, try again later":           "புகார்கள் மிக அதிகம், பின்னர் மீண்டும் முயலவும்",
+		"Too many tasks are waiting, try again later": "பல பணிகள் காத்திருக்கின்றன, பின்னர் மீண்டும் முயலவும்",
+		"The server is shutting down":                 "சேவையகம் நிறுத்தப்படுகிறது",
+	},
+	messages: map[string]string{
+		"%s and %s": "%s மற்றும் %s",
+
+		// Waitlist
+		"Booked %s on %s": "%[2]s அன்று %[1]s உங்களுக்கு முன்பதிவு செய்யப்பட்டது",
+		"%s on %s, slot %d was freed and is now booked for you.": "%[2]s அன்று %[1]s, பாடவேளை %[3]d காலியானதால் இப்போது உங்களுக்கு முன்பதிவு செய்யப்பட்டுள்ளது.",
+
+		// Check-in
+		"Booking of %s released": "%s முன்பதிவு விடுவிக்கப்பட்டது",
+		"Nobody checked in to %s on %s, slot %d within %s, so the room was freed.": "%[2]s அன்று %[1]s, பாடவேளை %[3]d-இல் %[4]s-க்குள் யாரும் வருகையைப் பதிவு செய்யாததால் அறை விடுவிக்கப்பட்டது.",
+
+		// Assignments and attendance
+		"%s: %s is due soon":                         "%s: %s விரைவில் சமர்ப்பிக்க வேண்டும்",
+		"%s is due %s.":                              "%s %s-க்குள் சமர்ப்பிக்க வேண்டும்.",
+		"Attendance in %s below %g%%":                "%s வருகைப்பதிவு %g%%-க்குக் கீழ் உள்ளது",
+		"You attended %d of %d periods of %s, %g%%.": "%[3]s பாடத்தின் %[2]d பாடவேளைகளில் %[1]d-இல் கலந்துகொண்டீர்கள், %[4]g%%.",
+
+		// Timetable changes, overrides and relocations
+		"Timetable change approved":                 "கால அட்டவணை மாற்றம் ஏற்கப்பட்டது",
+		"Timetable change rejected":                 "கால அட்டவணை மாற்றம் நிராகரிக்கப்பட்டது",
+		"%s in %s on %s, slot %d":                   "%[3]s அன்று %[2]s-இல் %[1]s, பாடவேளை %[4]d",
+		"cancelled":                                 "ரத்து செய்யப்பட்டது",
+		"taken by %s":                               "%s எடுக்கிறார்",
+		"moved to %s":                               "%s-க்கு மாற்றப்பட்டது",
+		"%s is %s":                                  "%s %s",
+		"%s is %s: %s":                              "%s %s: %s",
+		"%s is back as scheduled":                   "%s அட்டவணைப்படி மீண்டும் நடைபெறும்",
+		"%s back as scheduled":                      "%s அட்டவணைப்படி மீண்டும்",
+		"Classes in %s moved to %s":                 "%s வகுப்புகள் %s-க்கு மாற்றப்பட்டன",
+		"Everything in %s on %s is moved to %s: %s": "%[2]s அன்று %[1]s-இல் உள்ள அனைத்தும் %[3]s-க்கு மாற்றப்பட்டுள்ளன: %[4]s",
+
+		// Club events
+		"%s in %s on behalf of %s":    "%[3]s சார்பில் %[2]s-இல் %[1]s",
+		"Event to approve":            "ஒப்புதலுக்குக் காத்திருக்கும் நிகழ்வு",
+		"%s booked %s from %s to %s.": "%[1]s %[2]s-ஐ %[3]s முதல் %[4]s வரை முன்பதிவு செய்துள்ளார்.",
+		"Event approved":              "நிகழ்வு ஏற்கப்பட்டது",
+		"%s was approved.":            "%s ஏற்கப்பட்டது.",
+		"Event rejected":              "நிகழ்வு நிராகரிக்கப்பட்டது",
+		"%s was rejected":             "%s நிராகரிக்கப்பட்டது",
+		"%s was rejected: %s":         "%s நிராகரிக்கப்பட்டது: %s",
+
+		// Office hours
+		"Appointment request":            "சந்திப்புக் கோரிக்கை",
+		"%s asks to meet you on %s.":     "%[1]s உங்களை %[2]s சந்திக்கக் கேட்கிறார்.",
+		"%s to %s":                       "%s முதல் %s வரை",
+		"Appointment accepted":           "சந்திப்பு ஏற்கப்பட்டது",
+		"Appointment declined":           "சந்திப்பு மறுக்கப்பட்டது",
+		"%s accepted meeting you on %s.": "%[2]s உங்களைச் சந்திக்க %[1]s ஒப்புக்கொண்டார்.",
+		"%s declined meeting you on %s.": "%[2]s உங்களைச் சந்திக்க %[1]s மறுத்துவிட்டார்.",
+
+		// Exams
+		"Exam hall changed":                  "தேர்வு அறை மாற்றப்பட்டது",
+		"Your %s exam on %s at %s is in %s.": "%[2]s அன்று %[3]s மணிக்கு உங்கள் %[1]s தேர்வு %[4]s-இல் நடைபெறும்.",
+
+		// Feedback and privacy
+		"Your report was resolved":                        "உங்கள் புகார் தீர்க்கப்பட்டது",
+		"Thanks for reporting it.":                        "தெரிவித்ததற்கு நன்றி.",
+		"Your request to erase your data was turned down": "உங்கள் தரவை அழிக்கும் கோரிக்கை நிராகரிக்கப்பட்டது",
+		"Your data was kept.":                             "உங்கள் தரவு அழிக்கப்படவில்லை.",
+
+		// Plain text timetables
+		"Period %d":           "பாடவேளை %d",
+		"Period %d, %s to %s": "பாடவேளை %d, %s முதல் %s வரை",
+		"free":                "காலி",
+		"No classes.":         "வகுப்புகள் இல்லை.",
+
+		// Digests
+		"Tomorrow, %s":      "நாளை, %s",
+		"Your week from %s": "%s முதல் உங்கள் வாரம்",
+		"%s in %s":          "%[2]s-இல் %[1]s",
+		"%s booked for %s":  "%[2]s-க்காக %[1]s முன்பதிவு",
+		"Due:":              "சமர்ப்பிக்க வேண்டியவை:",
+	},
+}
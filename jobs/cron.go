@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schedule decides when a job runs
+type Schedule interface {
+	// Next returns the first run after t, or the zero time when there is none
+	Next(t time.Time) time.Time
+}
+
+// every runs a job at a fixed interval, counted from the previous run
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+/*
+cron is a parsed crontab line. Every field is a bit set of the values it
+matches; the day of the month and the weekday follow cron in matching either
+when both are restricted.
+*/
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// The range of every cron field, in order
+var cronFields = [5]struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Shorthands accepted in place of the five fields
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse reads a schedule: "@every 15m" for a fixed interval, a descriptor like
+// "@daily", or the five fields of a crontab line, "minute hour day-of-month month
+// day-of-week", each a "*", a number, a range "1-5", a step "*/10" or "8-18/2", or
+// a comma separated list of those. Sunday is 0 or 7. Cron schedules follow the
+// time zone of the times given to Next.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil || interval < time.Second {
+			return nil, errors.New("jobs: invalid interval in " + strconv.Quote(spec))
+		}
+		return every(interval), nil
+	}
+	if expanded, ok := cronDescriptors[spec]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New("jobs: " + strconv.Quote(spec) + " does not have five fields")
+	}
+	var sets [5]uint64
+	for idx, field := range fields {
+		set, err := parseCronField(field, cronFields[idx].min, cronFields[idx].max)
+		if err != nil {
+			return nil, errors.New("jobs: invalid " + cronFields[idx].name + " in " + strconv.Quote(spec))
+		}
+		sets[idx] = set
+	}
+	// Sunday may be written 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return cron{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: fields[2] == "*", dowAny: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[idx+1:])
+			if err != nil || step < 1 {
+				return 0, errors.New("invalid step")
+			}
+			part = part[:idx]
+		}
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(bounds[0])
+			high, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, errors.New("invalid range")
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, err
+			}
+			low = value
+			// "5/15" means from 5 on
+			if step == 1 {
+				high = value
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, errors.New("out of range")
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+func (c cron) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next skips whole months, days and hours that cannot match, so it only takes a few hundred steps at worst
+func (c cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	// Like February 30th
+	return time.Time{}
+}
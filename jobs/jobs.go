@@ -0,0 +1,338 @@
+/*
+Package jobs runs the periodic work of the server, like releasing bookings
+nobody checked in to or purging the trash, on cron-like schedules. Every job
+can be paused, resumed and run on demand, and reports when it last ran, how
+long it took and how it went. Stop lets the jobs that are running finish
+before the process exits, so a shutdown does not cut one off halfway.
+
+A Queue runs one-off tasks, like imports too big to finish within a request,
+in a pool of workers and keeps track of how far each one got.
+*/
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownJob = errors.New("jobs: no such job")
+	ErrRunning    = errors.New("jobs: job is already running")
+	ErrStopped    = errors.New("jobs: scheduler is stopped")
+)
+
+// A Func does one run of a job; ctx is cancelled when the scheduler gives up waiting for it during Stop
+type Func func(ctx context.Context, now time.Time) error
+
+// Status describes a job; the times are nil before the first run and while it is paused
+type Status struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Paused         bool       `json:"paused"`
+	Running        bool       `json:"running"`
+	NextRun        *time.Time `json:"nextRun"`
+	LastRun        *time.Time `json:"lastRun"`
+	LastDurationMs int64      `json:"lastDurationMs"`
+	LastError      string     `json:"lastError"`
+	Runs           int        `json:"runs"`
+	Failures       int        `json:"failures"`
+}
+
+type job struct {
+	name         string
+	spec         string
+	schedule     Schedule
+	run          Func
+	paused       bool
+	running      bool
+	next         time.Time
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	runs         int
+	failures     int
+}
+
+// A Scheduler runs jobs in their own goroutines, one run of a job at a time
+type Scheduler struct {
+	location *time.Location
+	logger   *log.Logger
+
+	mu      sync.Mutex
+	jobs    []*job
+	started bool
+	stopped bool
+	wake    chan struct{}
+	done    chan struct{}
+	running sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeNow func() time.Time
+}
+
+// New returns a Scheduler working out cron schedules in location
+func New(location *time.Location, logger *log.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		location: location,
+		logger:   logger,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		timeNow:  time.Now,
+	}
+}
+
+// Add registers a job running run on the schedule spec, see Parse
+func (s *Scheduler) Add(name string, spec string, run Func) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("jobs: %s is already added", name)
+		}
+	}
+	j := &job{name: name, spec: spec, schedule: schedule, run: run}
+	if s.started {
+		j.next = schedule.Next(s.now())
+		s.poke()
+	}
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+func (s *Scheduler) now() time.Time {
+	return s.timeNow().In(s.location)
+}
+
+// poke makes the loop look at the schedules again; s.mu must be held
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) find(name string) *job {
+	for _, j := range s.jobs {
+		if j.name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// Start schedules the first run of every job and returns; the jobs run until Stop
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	now := s.now()
+	for _, j := range s.jobs {
+		j.next = j.schedule.Next(now)
+	}
+	go s.loop()
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+		now := s.now()
+		var next time.Time
+		for _, j := range s.jobs {
+			if j.paused || j.next.IsZero() {
+				continue
+			}
+			if !j.next.After(now) {
+				// A run that is still going when the next one is due skips it
+				if !j.running {
+					s.start(j, now)
+				}
+				j.next = j.schedule.Next(now)
+				if j.next.IsZero() {
+					continue
+				}
+			}
+			if next.IsZero() || j.next.Before(next) {
+				next = j.next
+			}
+		}
+		s.mu.Unlock()
+
+		// Nothing scheduled still wakes up now and then, the clock may have been set
+		wait := time.Hour
+		if !next.IsZero() && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// start runs j in its own goroutine; s.mu must be held
+func (s *Scheduler) start(j *job, now time.Time) {
+	j.running = true
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		started := time.Now()
+		err := s.call(j, now)
+		duration := time.Since(started)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		j.running = false
+		j.lastRun = now
+		j.lastDuration = duration
+		j.runs++
+		j.lastError = ""
+		if err != nil {
+			j.failures++
+			j.lastError = err.Error()
+			s.logger.Println("Job", j.name, "failed:", err)
+		}
+	}()
+}
+
+// call runs j once, turning a panic into an error so one bad run does not take the server down
+func (s *Scheduler) call(j *job, now time.Time) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return j.run(s.ctx, now)
+}
+
+// Pause stops a job from being scheduled; a run that is going finishes
+func (s *Scheduler) Pause(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.find(name)
+	if j == nil {
+		return ErrUnknownJob
+	}
+	j.paused = true
+	return nil
+}
+
+// Resume schedules a paused job again, from now on
+func (s *Scheduler) Resume(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.find(name)
+	if j == nil {
+		return ErrUnknownJob
+	}
+	if !j.paused {
+		return nil
+	}
+	j.paused = false
+	if s.started {
+		j.next = j.schedule.Next(s.now())
+		s.poke()
+	}
+	return nil
+}
+
+// RunNow starts a run of a job right away, paused or not, without waiting for it
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrStopped
+	}
+	j := s.find(name)
+	if j == nil {
+		return ErrUnknownJob
+	}
+	if j.running {
+		return ErrRunning
+	}
+	s.start(j, s.now())
+	return nil
+}
+
+// Status describes every job, in the order they were added
+func (s *Scheduler) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := Status{
+			Name:           j.name,
+			Schedule:       j.spec,
+			Paused:         j.paused,
+			Running:        j.running,
+			LastDurationMs: j.lastDuration.Milliseconds(),
+			LastError:      j.lastError,
+			Runs:           j.runs,
+			Failures:       j.failures,
+		}
+		if !j.paused && !j.next.IsZero() && !s.stopped {
+			next := j.next
+			status.NextRun = &next
+		}
+		if !j.lastRun.IsZero() {
+			lastRun := j.lastRun
+			status.LastRun = &lastRun
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+/*
+Stop keeps new runs from starting and waits for the ones going to finish. When
+ctx is done first, the context of those runs is cancelled and Stop returns
+ctx.Err() without waiting any longer.
+*/
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	started := s.started
+	s.poke()
+	s.mu.Unlock()
+	if started {
+		<-s.done
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
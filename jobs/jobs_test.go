@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2023, 6, 13, 10, 7, 30, 0, time.UTC) // A Tuesday
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"@every 15m", from.Add(15 * time.Minute)},
+		{"* * * * *", time.Date(2023, 6, 13, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2023, 6, 13, 10, 15, 0, 0, time.UTC)},
+		{"0 21 * * *", time.Date(2023, 6, 13, 21, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2023, 6, 14, 9, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2023, 6, 13, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2023, 6, 14, 0, 0, 0, 0, time.UTC)},
+		{"30 8-18/2 * * 1-5", time.Date(2023, 6, 13, 10, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2023, 6, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * *", time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)},
+		// Both days restricted matches either
+		{"0 0 1 * 4", time.Date(2023, 6, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", test.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(test.want) {
+			t.Errorf("Parse(%q).Next() = %v; want %v", test.spec, got, test.want)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "@every 1ms", "@every soon", "@sometimes"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) error = nil; want one", spec)
+		}
+	}
+}
+
+func TestParseLocation(t *testing.T) {
+	kolkata := time.FixedZone("IST", 5*3600+1800)
+	schedule, err := Parse("0 21 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := schedule.Next(time.Date(2023, 6, 13, 10, 0, 0, 0, time.UTC).In(kolkata))
+	if want := time.Date(2023, 6, 13, 15, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next() = %v; want %v", got, want)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	s := New(time.UTC, log.New(ioutil.Discard, "", 0))
+	ran := make(chan time.Time, 10)
+	release := make(chan struct{})
+	if err := s.Add("tick", "@every 1s", func(ctx context.Context, now time.Time) error {
+		ran <- now
+		<-release
+		return errors.New("broken")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("tick", "@hourly", nil); err == nil {
+		t.Errorf("Add() of a name taken error = nil; want one")
+	}
+	if err := s.Add("never", "0 0 30 2 *", func(ctx context.Context, now time.Time) error { panic("ran") }); err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the job did not run")
+	}
+	if err := s.RunNow("tick"); err != ErrRunning {
+		t.Errorf("RunNow() of a running job error = %v; want ErrRunning", err)
+	}
+	if err := s.Pause("tick"); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	// Stop waits for the run going to finish
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	status := s.Status()
+	if len(status) != 2 || status[0].Name != "tick" || !status[0].Paused || status[0].Running {
+		t.Fatalf("Status() = %+v", status)
+	}
+	if status[0].Runs != 1 || status[0].Failures != 1 || status[0].LastError != "broken" || status[0].LastRun == nil {
+		t.Errorf("Status() of tick = %+v; want one failed run", status[0])
+	}
+	if status[1].Runs != 0 || status[1].LastRun != nil {
+		t.Errorf("Status() of never = %+v; want no runs", status[1])
+	}
+	if err := s.RunNow("tick"); err != ErrStopped {
+		t.Errorf("RunNow() after Stop() error = %v; want ErrStopped", err)
+	}
+	if err := s.Pause("nope"); err != ErrUnknownJob {
+		t.Errorf("Pause() of an unknown job error = %v; want ErrUnknownJob", err)
+	}
+}
+
+func TestRunNowPanic(t *testing.T) {
+	s := New(time.UTC, log.New(ioutil.Discard, "", 0))
+	s.Add("panics", "@daily", func(ctx context.Context, now time.Time) error { panic("oops") })
+	if err := s.RunNow("panics"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.Status()[0]; status.Failures != 1 || status.LastError != "panic: oops" {
+		t.Errorf("Status() = %+v; want the panic recorded", status)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	s := New(time.UTC, log.New(ioutil.Discard, "", 0))
+	cancelled := make(chan struct{})
+	s.Add("slow", "@daily", func(ctx context.Context, now time.Time) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	s.Start()
+	s.RunNow("slow")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Stop() error = %v; want context.DeadlineExceeded", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("the run was not cancelled")
+	}
+}
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(1, 1, time.Hour, log.New(ioutil.Discard, "", 0))
+	release := make(chan struct{})
+	first, err := q.Submit("import", "admin", func(ctx context.Context, progress func(int, int)) (interface{}, error) {
+		progress(1, 2)
+		<-release
+		progress(2, 2)
+		return "imported", nil
+	})
+	if err != nil || first.State != TaskQueued || first.ID == "" {
+		t.Fatalf("Submit() = %+v, %v; want a queued task", first, err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if task, _ := q.Get(first.ID); task.Done == 1 {
+			if task.State != TaskRunning || task.Total != 2 || task.StartedAt == nil {
+				t.Errorf("Get() while running = %+v", task)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the task did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	second, err := q.Submit("import", "admin", func(ctx context.Context, progress func(int, int)) (interface{}, error) {
+		return nil, errors.New("bad row")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Submit("import", "admin", nil); err != ErrQueueFull {
+		t.Errorf("Submit() over the backlog error = %v; want ErrQueueFull", err)
+	}
+
+	stopped := make(chan error)
+	go func() { stopped <- q.Stop(context.Background()) }()
+	for {
+		q.mu.Lock()
+		stopping := q.stopped
+		q.mu.Unlock()
+		if stopping {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if task, _ := q.Get(first.ID); task.State != TaskDone || task.Result != "imported" || task.Done != 2 || task.FinishedAt == nil {
+		t.Errorf("first task = %+v; want it done", task)
+	}
+	// Stop lets the running task finish but not the waiting one start
+	if task, _ := q.Get(second.ID); task.State != TaskFailed || task.StartedAt != nil {
+		t.Errorf("second task = %+v; want it failed without starting", task)
+	}
+	if tasks := q.List(""); len(tasks) != 2 || tasks[0].ID != second.ID {
+		t.Errorf("List() = %+v; want both tasks, the latest first", tasks)
+	}
+	if _, ok := q.Get("nope"); ok {
+		t.Errorf("Get() of an unknown task ok = true")
+	}
+	if _, err := q.Submit("import", "admin", nil); err != ErrStopped {
+		t.Errorf("Submit() after Stop() error = %v; want ErrStopped", err)
+	}
+}
@@ -0,0 +1,232 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+// States of a Task
+const (
+	TaskQueued  = "queued"
+	TaskRunning = "running"
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+)
+
+var ErrQueueFull = errors.New("jobs: too many tasks are waiting")
+
+/*
+A Task is one piece of work handed to a Queue, like an import too big to do
+within a request. Done counts up to Total while it runs; Result is what it
+returned when it is done and Error why it failed.
+*/
+type Task struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	State      string      `json:"state"`
+	Done       int         `json:"done"`
+	Total      int         `json:"total"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	CreatedBy  string      `json:"createdBy"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	StartedAt  *time.Time  `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt"`
+}
+
+// A TaskFunc does the work of a task, reporting how far it got with progress
+type TaskFunc func(ctx context.Context, progress func(done int, total int)) (interface{}, error)
+
+type queued struct {
+	id  string
+	run TaskFunc
+}
+
+/*
+A Queue runs tasks in a fixed number of worker goroutines, in the order they
+were submitted. Tasks are only kept in memory, for retention after they
+finish, so a restart forgets them.
+*/
+type Queue struct {
+	logger    *log.Logger
+	retention time.Duration
+	pending   chan queued
+	ctx       context.Context
+	cancel    context.CancelFunc
+	workers   sync.WaitGroup
+
+	mu      sync.Mutex
+	tasks   map[string]*Task
+	stopped bool
+}
+
+// NewQueue starts workers workers taking tasks from a queue of at most backlog waiting ones
+func NewQueue(workers int, backlog int, retention time.Duration, logger *log.Logger) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		logger:    logger,
+		retention: retention,
+		pending:   make(chan queued, backlog),
+		ctx:       ctx,
+		cancel:    cancel,
+		tasks:     make(map[string]*Task),
+	}
+	for i := 0; i < workers; i++ {
+		q.workers.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func newTaskID() string {
+	id, err := token.Hex(12)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// Submit queues run and returns the task as it is now, queued
+func (q *Queue) Submit(kind string, createdBy string, run TaskFunc) (Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return Task{}, ErrStopped
+	}
+	q.forget(time.Now())
+	task := &Task{ID: newTaskID(), Kind: kind, State: TaskQueued, CreatedBy: createdBy, CreatedAt: time.Now()}
+	select {
+	case q.pending <- queued{id: task.ID, run: run}:
+	default:
+		return Task{}, ErrQueueFull
+	}
+	q.tasks[task.ID] = task
+	return *task, nil
+}
+
+// forget drops the tasks that finished longer than the retention ago; q.mu must be held
+func (q *Queue) forget(now time.Time) {
+	for id, task := range q.tasks {
+		if task.FinishedAt != nil && now.Sub(*task.FinishedAt) > q.retention {
+			delete(q.tasks, id)
+		}
+	}
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	for next := range q.pending {
+		q.mu.Lock()
+		task := q.tasks[next.id]
+		if q.stopped {
+			q.finish(task, nil, errors.New("the server shut down before the task started"))
+			q.mu.Unlock()
+			continue
+		}
+		started := time.Now()
+		task.State = TaskRunning
+		task.StartedAt = &started
+		q.mu.Unlock()
+
+		result, err := q.call(next)
+
+		q.mu.Lock()
+		q.finish(task, result, err)
+		q.mu.Unlock()
+	}
+}
+
+// finish records how task ended; q.mu must be held
+func (q *Queue) finish(task *Task, result interface{}, err error) {
+	finished := time.Now()
+	task.FinishedAt = &finished
+	if err != nil {
+		task.State = TaskFailed
+		task.Error = err.Error()
+		q.logger.Println("Task", task.ID, task.Kind, "failed:", err)
+		return
+	}
+	task.State = TaskDone
+	task.Result = result
+}
+
+// call runs a task, turning a panic into an error like Scheduler does for jobs
+func (q *Queue) call(next queued) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("panic: %v", recovered)
+		}
+	}()
+	return next.run(q.ctx, func(done int, total int) {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		task := q.tasks[next.id]
+		task.Done = done
+		task.Total = total
+	})
+}
+
+// Get returns a task by ID; ok is false for unknown and forgotten ones
+func (q *Queue) Get(id string) (Task, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	task, ok := q.tasks[id]
+	if !ok {
+		return Task{}, false
+	}
+	return *task, true
+}
+
+// List returns the tasks of kind, or of every kind when it is empty, the latest first
+func (q *Queue) List(kind string) []Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.forget(time.Now())
+	tasks := []Task{}
+	for _, task := range q.tasks {
+		if kind == "" || task.Kind == kind {
+			tasks = append(tasks, *task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.After(tasks[j].CreatedAt)
+	})
+	return tasks
+}
+
+/*
+Stop refuses new tasks and waits for the running ones to finish; the ones still
+waiting fail without starting. When ctx is done first, the context of the
+running tasks is cancelled and Stop returns ctx.Err().
+*/
+func (q *Queue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		return nil
+	}
+	q.stopped = true
+	close(q.pending)
+	q.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		return ctx.Err()
+	}
+}
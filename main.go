@@ -1,27 +1,54 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
-	"strconv"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
-
+	// Time zone names work on hosts and containers without a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/deebakkarthi/coraserver/api"
+	"github.com/deebakkarthi/coraserver/auth"
+	"github.com/deebakkarthi/coraserver/cache"
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/cdn"
+	"github.com/deebakkarthi/coraserver/compress"
+	"github.com/deebakkarthi/coraserver/conntrack"
 	"github.com/deebakkarthi/coraserver/db"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/microsoft"
+	"github.com/deebakkarthi/coraserver/erp"
+	"github.com/deebakkarthi/coraserver/fields"
+	"github.com/deebakkarthi/coraserver/graph"
+	"github.com/deebakkarthi/coraserver/headers"
+	"github.com/deebakkarthi/coraserver/notify"
+	"github.com/deebakkarthi/coraserver/rpcserver"
+	"github.com/deebakkarthi/coraserver/seal"
+	"github.com/deebakkarthi/coraserver/secrets"
+	"github.com/deebakkarthi/coraserver/storage"
+	"github.com/deebakkarthi/coraserver/token"
+	"github.com/deebakkarthi/coraserver/tracing"
+	"golang.org/x/net/http2"
 )
 
-// Global OAuth Configuration variable
-var oauthConfig *oauth2.Config
+// Providers, admin key and mobile redirect URLs handed to api.NewServer
+var apiConfig = api.Config{
+	Providers:          make(map[string]auth.Provider),
+	MobileRedirectURLs: make(map[string][]string),
+}
 
 const (
-	configFile     = "./config.json"
-	port           = ":42069"
-	organizationID = "00f9cda3-075e-44e5-aa0b-aba3add6539f"
+	configFile = "./config.json"
+	port       = ":42069"
+	// How long a shutdown waits for background jobs and requests to finish
+	shutdownTimeout = 30 * time.Second
 )
 
 /*
@@ -37,490 +64,923 @@ whenever you want to deserialize a json file the corresponding struct members
 should always be exported.
 */
 
-type insertResponse struct {
-	Inserted bool `json:"inserted"`
-}
 type oauthJSONRepr struct {
 	ClientID     string   `json:"clientID"`
 	ClientSecret string   `json:"clientSecret"`
 	RedirectURL  string   `json:"redirectURL"`
 	Scopes       []string `json:"scopes"`
 	Tenant       string   `json:"tenant"`
+	// See auth.ProviderConfig
+	MobileRedirectURLs []string `json:"mobileRedirectURLs"`
 }
 
-type graphMe struct {
-	OdataContext      string   `json:"@odata.context"`
-	BusinessPhones    []string `json:"businessPhones"`
-	DisplayName       string   `json:"displayName"`
-	GivenName         string   `json:"givenName"`
-	JobTitle          string   `json:"jobTitle"`
-	Mail              string   `json:"mail"`
-	MobilePhone       string   `json:"mobilePhone"`
-	OfficeLocation    string   `json:"officeLocation"`
-	PreferredLanguage string   `json:"preferredLanguage"`
-	Surname           string   `json:"surname"`
-	UserPrincipalName string   `json:"userPrincipalName"`
-	ID                string   `json:"id"`
-}
-
-type graphOrganization struct {
-	OdataContext string                   `json:"@odata.context"`
-	Value        []graphOrganizationValue `json:"value"`
-}
-
-type graphOrganizationValue struct {
-	ID                                        string   `json:"id"`
-	DeletedDateTime                           string   `json:"deletedDateTime"`
-	BusinessPhones                            []string `json:"businessPhones"`
-	City                                      string   `json:"city"`
-	Country                                   string   `json:"country"`
-	CountryLetterCode                         string   `json:"countryLetterCode"`
-	CreatedDateTime                           string   `json:"createdDateTime"`
-	DefaultUsageLocation                      string   `json:"defaultUsageLocation"`
-	DisplayName                               string   `json:"displayName"`
-	IsMultipleDataLocationsForServicesEnabled string   `json:"isMultipleDataLocationsForServicesEnabled"`
-	MarketingNotificationEmails               []string `json:"marketingNotificationEmails"`
-	OnPremisesLastSyncDateTime                string   `json:"onPremisesLastSyncDateTime"`
-	OnPremisesSyncEnabled                     string   `json:"onPremisesSyncEnabled"`
-	PartnerTenantType                         string   `json:"partnerTenantType"`
-	PostalCode                                string   `json:"postalCode"`
-	PreferredLanguage                         string   `json:"preferredLanguage"`
-	SecurityComplianceNotificationMails       []string `json:"securityComplianceNotificationMails"`
-	SecurityComplianceNotificationPhones      []string `json:"securityComplianceNotificationPhones"`
-	State                                     string   `json:"state"`
-	Street                                    string   `json:"street"`
-	TechnicalNotificationMails                []string `json:"technicalNotificationMails"`
-	TenantType                                string   `json:"tenantType"`
-	DirectorySizeQuota                        struct {
-		Used  int `json:"used"`
-		Total int `json:"total"`
-	} `json:"directorySizeQuota"`
-	OnPremisesSyncStatus []string `json:"onPremisesSyncStatus"`
-	AssignedPlans        []string `json:"assignedPlans"`
-	PrivacyProfile       struct {
-		ContactEmail string `json:"contactEmail"`
-		StatementURL string `json:"statementUrl"`
-	} `json:"privacyProfile"`
-	ProvisionedPlans []string `json:"provisionedPlans"`
-	VerifiedDomains  []struct {
-		Capabilities string `json:"capabilities"`
-		IsDefault    bool   `json:"isDefault"`
-		IsInitial    bool   `json:"isInitial"`
-		Name         string `json:"name"`
-		Type         string `json:"type"`
-	} `json:"verifiedDomains"`
-}
-
-type oauthExchangeResponse struct {
-	Name         string `json:"name"`
-	Mail         string `json:"mail"`
-	Organization string `json:"organization"`
+/*
+The complete layout of config.json. The OAuth fields are embedded so that they
+stay at the top level of the file, which keeps older config files working.
+*/
+type configJSONRepr struct {
+	oauthJSONRepr
+	Providers []auth.ProviderConfig `json:"providers"`
+	Graph     graphJSONRepr         `json:"graph"`
+	AdminKey  string                `json:"adminKey"`
+	// Reloadable, see settingsFromConfig
+	AllowedOrigins  []string         `json:"allowedOrigins"`
+	APIKeyRateLimit int              `json:"apiKeyRateLimit"`
+	Server          serverJSONRepr   `json:"server"`
+	Database        databaseJSONRepr `json:"database"`
+	// Defaults to compress.DefaultOptions
+	Compression compress.Options `json:"compression"`
+	// Defaults to headers.DefaultOptions
+	Headers headers.Options `json:"headers"`
+	// Defaults to tracing.DefaultConfig; nothing is traced without an endpoint
+	Tracing tracing.Config `json:"tracing"`
+	Debug   debugJSONRepr  `json:"debug"`
+	GRPC    grpcJSONRepr   `json:"grpc"`
+	// IANA name of the institution's time zone, like "Asia/Kolkata"; the server's own when empty
+	Timezone      string                `json:"timezone"`
+	Notifications notificationsJSONRepr `json:"notifications"`
+	CheckIn       checkInJSONRepr       `json:"checkIn"`
+	Attendance    attendanceJSONRepr    `json:"attendance"`
+	Attachments   attachmentsJSONRepr   `json:"attachments"`
+	Trash         trashJSONRepr         `json:"trash"`
+	// Where backups are kept, see package storage; on local disk in ./backups by default
+	Backups storage.Config `json:"backups"`
+	// Where classrooms, courses and the timetable are synced from, see package erp
+	ERP []erp.Config `json:"erp"`
+	CDN cdnJSONRepr  `json:"cdn"`
+	// How long bookings, audit entries, searches and sessions are kept, like {"audit": "17520h"}; forever when unset
+	Retention map[string]duration `json:"retention"`
+	// How long retries with the same Idempotency-Key get the first response, 24 hours when unset
+	IdempotencyWindow duration `json:"idempotencyWindow"`
+	// Schedules of the background jobs by name, like {"attendance-alerts": "0 20 * * *"} or "off"
+	Jobs     map[string]string `json:"jobs"`
+	Tasks    tasksJSONRepr     `json:"tasks"`
+	Security securityJSONRepr  `json:"security"`
+	// Turns on multi-tenant mode, see tenantJSONRepr
+	Tenants []tenantJSONRepr `json:"tenants"`
 }
 
 /*
-=init()= is a special type of function like =main()= that is called automatically
-by the go runtime. It is used to setup things that are needed before the main
-function. Here we are setting up the oauthConfig variable by unmarshalling the
-=config.json= file
+One institution of a multi-tenant deployment. It has its own database, identity
+providers and admin key; the top level ones are not used then, everything
+else is shared.
 */
-func init() {
+type tenantJSONRepr struct {
+	Name      string                `json:"name"`
+	Hosts     []string              `json:"hosts"`
+	Database  db.Config             `json:"database"`
+	Providers []auth.ProviderConfig `json:"providers"`
+	AdminKey  string                `json:"adminKey"`
+	ERP       []erp.Config          `json:"erp"`
+}
 
-	file, err := ioutil.ReadFile(configFile)
-	if err != nil {
-		log.Fatal("Error reading JSON file:", err)
-	}
+// The api.Config and database of a tenant, filled by init
+type tenantSetup struct {
+	name   string
+	hosts  []string
+	config api.Config
+	store  db.Store
+}
 
-	var jsonData oauthJSONRepr
-	err = json.Unmarshal(file, &jsonData)
-	if err != nil {
-		log.Fatal("Error unmarshalling JSON:", err)
-	}
+var tenants []tenantSetup
 
-	oauthConfig = &oauth2.Config{
-		ClientID:     jsonData.ClientID,
-		ClientSecret: jsonData.ClientSecret,
-		RedirectURL:  jsonData.RedirectURL,
-		Scopes:       jsonData.Scopes,
-		Endpoint:     microsoft.AzureADEndpoint(jsonData.Tenant),
-	}
+/*
+Uploaded files are kept by the storage backend described next to signingKey
+and maxBytes, see package storage; on local disk in ./attachments by default.
+Download URLs are signed with signingKey, a random one when unset, and uploads
+are capped at maxBytes, 10 MB when unset.
+*/
+type attachmentsJSONRepr struct {
+	storage.Config
+	SigningKey string `json:"signingKey"`
+	MaxBytes   int64  `json:"maxBytes"`
+}
 
+/*
+Students whose attendance in a subject falls below threshold percent (75 when
+unset) are told every night, at roll@studentDomain; without a domain nobody is.
+*/
+type attendanceJSONRepr struct {
+	Threshold     float64 `json:"threshold"`
+	StudentDomain string  `json:"studentDomain"`
 }
 
-func main() {
-	router := http.NewServeMux()
-
-	router.HandleFunc("/oauth/login", oauthLoginHandler)
-	router.HandleFunc("/oauth/exchange", oauthExchangeHandler)
-	router.HandleFunc("/db/freeclass", freeClassHandler)
-	router.HandleFunc("/db/freeslot", freeSlotHandler)
-	router.HandleFunc("/db/daytimetable", dayTimetableHandler)
-	router.HandleFunc("/db/booking", bookingHandler)
-	router.HandleFunc("/db/getAllSlot", getAllSlotHandler)
-	router.HandleFunc("/db/getAllClass", getAllClassHandler)
-	router.HandleFunc("/db/getAllSubject", getAllSubjectHandler)
-	router.HandleFunc("/db/getBooking", getBookingHandler)
-	router.HandleFunc("/db/cancelBooking", cancelBookingHandler)
-	router.HandleFunc("/db/multiFreeSlot", multiFreeSlotHandler)
-	router.HandleFunc("/db/multiBooking", multiBookingHandler)
-
-	server := &http.Server{Addr: port, Handler: router}
+// Deleted timetable entries, bookings and announcements can be restored for retention, 720h when unset
+type trashJSONRepr struct {
+	Retention duration `json:"retention"`
+}
 
-	log.Println("Server starting on port ", port)
-	log.Fatal(server.ListenAndServe())
+// Background tasks like async imports run workers at a time, 2 when unset
+type tasksJSONRepr struct {
+	Workers int `json:"workers"`
 }
 
-func generateRandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	rand.Seed(time.Now().UnixNano())
-	randomString := make([]byte, length)
-	for i := 0; i < length; i++ {
-		randomString[i] = charset[rand.Intn(len(charset))]
-	}
-	return string(randomString)
+/*
+An IP failing to log in or with an API key maxFailures times (10 when unset)
+within failureWindow (15m) is locked out for lockout (15m). With a captcha,
+IPs that failed challengeAfter times (3) have to solve it before trying again.
+OAuth states, session IDs, API key secrets and check-in codes are made of
+tokenBytes random bytes, 32 when unset. Refresh tokens are encrypted with
+tokenKeys when set.
+*/
+type securityJSONRepr struct {
+	MaxFailures    int                `json:"maxFailures"`
+	FailureWindow  duration           `json:"failureWindow"`
+	Lockout        duration           `json:"lockout"`
+	ChallengeAfter int                `json:"challengeAfter"`
+	Captcha        *captchaJSONRepr   `json:"captcha"`
+	TokenBytes     int                `json:"tokenBytes"`
+	TokenKeys      *tokenKeysJSONRepr `json:"tokenKeys"`
 }
 
-func oauthLoginHandler(w http.ResponseWriter, r *http.Request) {
-	state := generateRandomString(16)
-	authURL := oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOnline, oauth2.SetAuthURLParam("prompt", "select_account"))
-	http.Redirect(w, r, authURL, http.StatusFound)
+/*
+The keys refresh tokens are encrypted with, by ID, and the ID of the one new
+tokens are encrypted with; the others only decrypt. See package seal.
+*/
+type tokenKeysJSONRepr struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
 }
 
-func requestGraphAPI(accessToken string, endpoint string) ([]byte, error) {
-	url := "https://graph.microsoft.com/v1.0/" + endpoint
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// A reCAPTCHA, hCaptcha or Turnstile siteverify endpoint and the site's secret
+type captchaJSONRepr struct {
+	VerifyURL string `json:"verifyURL"`
+	Secret    string `json:"secret"`
+}
+
+// Bookings nobody checked in to are released grace after their slot starts, 15m when unset
+type checkInJSONRepr struct {
+	Grace duration `json:"grace"`
+}
+
+/*
+The database of the server. slowQuery and preload apply to every tenant's
+database too. Queries taking slowQuery are logged with their parameters, "0s"
+logs none. With preload the timetable is kept in memory, see db.Preloaded,
+and loaded again at least every preloadRefresh.
+*/
+type databaseJSONRepr struct {
+	db.Config
+	SlowQuery      duration `json:"slowQuery"`
+	Preload        bool     `json:"preload"`
+	PreloadRefresh duration `json:"preloadRefresh"`
+}
+
+// A CDN or proxy caching the public lookups, which is told what to drop through purge
+type cdnJSONRepr struct {
+	// How long it may serve a lookup; 0, the default, has it ask every time
+	MaxAge duration    `json:"maxAge"`
+	Purge  *cdn.Config `json:"purge"`
+}
+
+// Messages to users are posted to webhook, or only logged when it is empty
+type notificationsJSONRepr struct {
+	Webhook string `json:"webhook"`
+	// How long notifications stay in the users' inboxes, 90 days when unset
+	Retention duration `json:"retention"`
+	// Sends the digests users want by mail
+	SMTP *smtpJSONRepr `json:"smtp"`
+	// Texts critical alerts to the users who opted in
+	SMS *smsJSONRepr `json:"sms"`
+	// Posts timetable changes and announcements to the Teams channels of class sections
+	Teams *teamsJSONRepr `json:"teams"`
+	// Day of the week the weekly digests go out, like "SUN" (the default)
+	WeeklyDigestDay string `json:"weeklyDigestDay"`
+	// Messages per second broadcasts go out at, 10 when unset
+	BroadcastRate int `json:"broadcastRate"`
+}
+
+// An SMTP server, like "smtp.example.com:587", which is logged in to when username is set
+type smtpJSONRepr struct {
+	Addr     string `json:"addr"`
+	From     string `json:"from"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+/*
+A Twilio account texts are sent from, a number or messaging service. Delivery
+reports are posted to statusCallback, the public URL of /sms/status, when set.
+*/
+type smsJSONRepr struct {
+	AccountSID     string `json:"accountSid"`
+	AuthToken      string `json:"authToken"`
+	From           string `json:"from"`
+	StatusCallback string `json:"statusCallback"`
+}
+
+/*
+Teams channels are posted to through their incoming webhooks, or with Graph
+as the application of provider, a microsoft identity provider, when set.
+*/
+type teamsJSONRepr struct {
+	Provider string `json:"provider"`
+}
+
+/*
+Limits of the Graph client every Microsoft provider, of every tenant, shares:
+the most requests at once and calls queued beyond them, graph.DefaultMaxConcurrent
+and graph.DefaultMaxQueued when 0.
+*/
+type graphJSONRepr struct {
+	MaxConcurrent int `json:"maxConcurrent"`
+	MaxQueued     int `json:"maxQueued"`
+}
+
+// The gRPC service for other backends is only started when addr is set
+type grpcJSONRepr struct {
+	Addr string `json:"addr"`
+}
+
+/*
+pprof and runtime stats. With an address they get their own listener, which
+should only be reachable from inside the network; without one they are served
+under /admin/debug/ behind the admin key.
+*/
+type debugJSONRepr struct {
+	Enabled bool   `json:"enabled"`
+	Addr    string `json:"addr"`
+}
+
+/*
+Limits of the HTTP server. Fields left out of config.json keep the defaults
+below, an explicit 0 does not: a timeout of 0 is no timeout and a
+maxHeaderBytes of 0 is the 1 MB of net/http. maxBodyBytes and
+maxConcurrentStreams must be positive.
+*/
+type serverJSONRepr struct {
+	ReadHeaderTimeout duration `json:"readHeaderTimeout"`
+	ReadTimeout       duration `json:"readTimeout"`
+	WriteTimeout      duration `json:"writeTimeout"`
+	IdleTimeout       duration `json:"idleTimeout"`
+	MaxHeaderBytes    int      `json:"maxHeaderBytes"`
+	MaxBodyBytes      int64    `json:"maxBodyBytes"`
+	// Serves HTTPS with this certificate and key, HTTP/2 is only offered then
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// Keeps HTTPS clients on HTTP/1.1
+	DisableHTTP2 bool `json:"disableHTTP2"`
+	// Requests a client can have in flight at once on an HTTP/2 connection
+	MaxConcurrentStreams uint32 `json:"maxConcurrentStreams"`
+	// Closes HTTP/1.1 connections after every response instead of keeping them for idleTimeout
+	DisableKeepAlives bool `json:"disableKeepAlives"`
+}
+
+var compressionConfig = compress.DefaultOptions
+
+var headersConfig = headers.DefaultOptions
+
+var tracingConfig = tracing.DefaultConfig
+
+// Set when tracingConfig has an endpoint, flushed on shutdown
+var tracer *tracing.Tracer
+
+// How often a preloaded timetable is loaded again, 0 when it is not preloaded
+var preloadRefresh time.Duration
+
+// Calls Graph for the Microsoft providers, see graphJSONRepr
+var graphClient = graph.NewClient()
+
+var debugConfig debugJSONRepr
+
+var grpcConfig grpcJSONRepr
+
+var serverConfig = serverJSONRepr{
+	ReadHeaderTimeout: duration(5 * time.Second),
+	ReadTimeout:       duration(15 * time.Second),
+	WriteTimeout:      duration(30 * time.Second),
+	IdleTimeout:       duration(120 * time.Second),
+	MaxHeaderBytes:    64 << 10,
+	MaxBodyBytes:      1 << 20,
+	// What golang.org/x/net/http2 allows by default
+	MaxConcurrentStreams: 250,
+}
+
+// A time.Duration written as a string like "15s" or "2m" in config.json
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected response status: %s", resp.Status)
+		return err
 	}
-	body, err := ioutil.ReadAll(resp.Body)
+	parsed, err := time.ParseDuration(s)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	*d = duration(parsed)
+	return nil
+}
 
-	return body, nil
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
 }
 
-func oauthExchangeHandler(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
-	token, err := oauthConfig.Exchange(r.Context(), code)
+/*
+=init()= is a special type of function like =main()= that is called automatically
+by the go runtime. It is used to setup things that are needed before the main
+function. Here we are setting up the identity providers by unmarshalling the
+=config.json= file. The top level OAuth fields describe the Microsoft provider,
+further providers come from the =providers= list.
+*/
+func init() {
+
+	jsonData, err := readConfig()
 	if err != nil {
-		log.Println("Error while exchanging authorization code", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error()))
-		return
+		log.Fatal(err)
 	}
-	graphMeResponse, err := requestGraphAPI(token.AccessToken, "me")
-	if err != nil {
-		log.Println("Error getting user profile", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte(err.Error()))
-		return
+
+	providerConfigs := jsonData.Providers
+	if jsonData.ClientID != "" {
+		providerConfigs = append([]auth.ProviderConfig{{
+			Name:         "microsoft",
+			Type:         "microsoft",
+			ClientID:     jsonData.ClientID,
+			ClientSecret: jsonData.ClientSecret,
+			RedirectURL:  jsonData.RedirectURL,
+			Scopes:       jsonData.Scopes,
+			Tenant:       jsonData.Tenant,
+
+			MobileRedirectURLs: jsonData.MobileRedirectURLs,
+		}}, providerConfigs...)
 	}
-	graphOrganizationResponse, err := requestGraphAPI(token.AccessToken, "organization")
-	if err != nil {
-		log.Println("Error getting user organization", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte(err.Error()))
-		return
+	maxConcurrent, maxQueued := jsonData.Graph.MaxConcurrent, jsonData.Graph.MaxQueued
+	if maxConcurrent == 0 {
+		maxConcurrent = graph.DefaultMaxConcurrent
 	}
-	var organization graphOrganization
-	var profile graphMe
-	json.Unmarshal(graphMeResponse, &profile)
-	json.Unmarshal(graphOrganizationResponse, &organization)
-	if organization.Value[0].ID == organizationID {
-		response := oauthExchangeResponse{
-			Name:         profile.GivenName,
-			Mail:         profile.Mail,
-			Organization: organization.Value[0].DisplayName,
-		}
-		responseJSON, err := json.Marshal(response)
+	if maxQueued == 0 {
+		maxQueued = graph.DefaultMaxQueued
+	}
+	graphClient.SetLimits(maxConcurrent, maxQueued)
+	if len(jsonData.Tenants) == 0 {
+		setupProviders(&apiConfig, providerConfigs)
+		apiConfig.Settings = settingsFromConfig(jsonData, "")
+		err = apiConfig.Settings.Validate()
 		if err != nil {
-			log.Println("Error marshalling data", err)
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			return
+			log.Fatal("Invalid config: ", err)
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write(responseJSON)
-	} else {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte("This app is only for members of Amrita Vishwa Vidyapeetham"))
 	}
-	return
-}
-
-func freeClassHandler(w http.ResponseWriter, r *http.Request) {
-	slotStr := r.URL.Query().Get("slot")
-	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	apiConfig.Location = time.Local
+	if jsonData.Timezone != "" {
+		apiConfig.Location, err = time.LoadLocation(jsonData.Timezone)
+		if err != nil {
+			log.Fatal("Invalid timezone: ", err)
+		}
 	}
-	slot, err := strconv.Atoi(slotStr)
-	if err != nil {
-		http.Error(w, "Invalid slot value", http.StatusBadRequest)
-		return
+	db.Configure(jsonData.Database.Config)
+	db.SetSlowQuery(time.Duration(jsonData.Database.SlowQuery))
+	if jsonData.Database.Preload {
+		preloadRefresh = time.Duration(jsonData.Database.PreloadRefresh)
+		if preloadRefresh <= 0 {
+			log.Fatal("Invalid config: database.preloadRefresh must be positive")
+		}
 	}
-	var classroom []string = db.GetFreeClass(slot, date)
-	responseJSON, err := json.Marshal(classroom)
-	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+	serverConfig = jsonData.Server
+	if (serverConfig.CertFile == "") != (serverConfig.KeyFile == "") {
+		log.Fatal("Invalid config: server.certFile and server.keyFile go together")
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-}
-
-func freeSlotHandler(w http.ResponseWriter, r *http.Request) {
-	class := r.URL.Query().Get("class")
-	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if serverConfig.MaxConcurrentStreams == 0 {
+		log.Fatal("Invalid config: server.maxConcurrentStreams must be positive")
+	}
+	if serverConfig.MaxBodyBytes <= 0 {
+		log.Fatal("Invalid config: server.maxBodyBytes must be positive")
+	}
+	compressionConfig = jsonData.Compression
+	headersConfig = jsonData.Headers
+	tracingConfig = jsonData.Tracing
+	if tracingConfig.SampleRatio < 0 || tracingConfig.SampleRatio > 1 {
+		log.Fatal("Invalid config: tracing.sampleRatio must be between 0 and 1")
 	}
-	var slot []int = db.GetFreeSlot(class, date)
-	responseJSON, err := json.Marshal(slot)
+	debugConfig = jsonData.Debug
+	grpcConfig = jsonData.GRPC
+	apiConfig.Debug = debugConfig.Enabled && debugConfig.Addr == ""
+	apiConfig.CheckInGrace = time.Duration(jsonData.CheckIn.Grace)
+	apiConfig.AttendanceThreshold = jsonData.Attendance.Threshold
+	apiConfig.StudentMailDomain = jsonData.Attendance.StudentDomain
+	apiConfig.Storage, err = storage.New(jsonData.Attachments.Config)
 	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+		log.Fatal("Invalid attachment storage: ", err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-}
-
-func multiFreeSlotHandler(w http.ResponseWriter, r *http.Request) {
-	startSlotStr := r.URL.Query().Get("startSlot")
-	endSlotStr := r.URL.Query().Get("endSlot")
-	startSlot, err := strconv.Atoi(startSlotStr)
+	if (jsonData.Backups.Backend == "" || jsonData.Backups.Backend == "local") && jsonData.Backups.Dir == "" {
+		jsonData.Backups.Dir = "./backups"
+	}
+	apiConfig.Backups, err = storage.New(jsonData.Backups)
 	if err != nil {
-		http.Error(w, "Invalid slot value", http.StatusBadRequest)
-		return
+		log.Fatal("Invalid backup storage: ", err)
+	}
+	setupImporters(&apiConfig, jsonData.ERP)
+	apiConfig.AttachmentKey = []byte(jsonData.Attachments.SigningKey)
+	apiConfig.MaxUploadBytes = jsonData.Attachments.MaxBytes
+	apiConfig.TrashRetention = time.Duration(jsonData.Trash.Retention)
+	apiConfig.NotificationRetention = time.Duration(jsonData.Notifications.Retention)
+	if jsonData.Notifications.BroadcastRate < 0 {
+		log.Fatal("Invalid config: notifications.broadcastRate must not be negative")
 	}
-	endSlot, err := strconv.Atoi(endSlotStr)
+	apiConfig.BroadcastRate = jsonData.Notifications.BroadcastRate
+	apiConfig.Retention = make(map[string]time.Duration)
+	for kind, period := range jsonData.Retention {
+		apiConfig.Retention[kind] = time.Duration(period)
+	}
+	err = api.ValidateRetention(apiConfig.Retention)
 	if err != nil {
-		http.Error(w, "Invalid slot value", http.StatusBadRequest)
-		return
+		log.Fatal("Invalid config: ", err)
 	}
-	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
+	err = api.ValidateJobSchedules(jsonData.Jobs)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Fatal("Invalid job schedule: ", err)
+	}
+	apiConfig.JobSchedules = jsonData.Jobs
+	apiConfig.TaskWorkers = jsonData.Tasks.Workers
+	apiConfig.LoginMaxFailures = jsonData.Security.MaxFailures
+	apiConfig.LoginFailureWindow = time.Duration(jsonData.Security.FailureWindow)
+	apiConfig.LoginLockout = time.Duration(jsonData.Security.Lockout)
+	apiConfig.ChallengeAfter = jsonData.Security.ChallengeAfter
+	if captcha := jsonData.Security.Captcha; captcha != nil {
+		apiConfig.Challenger = auth.Captcha{VerifyURL: captcha.VerifyURL, Secret: captcha.Secret}
 	}
-	var slot []string = db.MultiFreeSlot(startSlot, endSlot, date)
-	responseJSON, err := json.Marshal(slot)
+	err = token.Validate(jsonData.Security.TokenBytes)
 	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+		log.Fatal("Invalid config: ", err)
+	}
+	apiConfig.TokenBytes = jsonData.Security.TokenBytes
+	if tokenKeys := jsonData.Security.TokenKeys; tokenKeys != nil {
+		apiConfig.TokenKeys, err = seal.NewKeyring(tokenKeys.Current, tokenKeys.Keys)
+		if err != nil {
+			log.Fatal("Invalid token keys: ", err)
+		}
+	}
+	if jsonData.CDN.MaxAge < 0 {
+		log.Fatal("Invalid config: cdn.maxAge must not be negative")
+	}
+	apiConfig.CDNMaxAge = time.Duration(jsonData.CDN.MaxAge)
+	if jsonData.IdempotencyWindow < 0 {
+		log.Fatal("Invalid config: idempotencyWindow must not be negative")
+	}
+	apiConfig.IdempotencyWindow = time.Duration(jsonData.IdempotencyWindow)
+	if purge := jsonData.CDN.Purge; purge != nil {
+		if purge.URL == "" {
+			log.Fatal("Invalid config: cdn.purge needs a url")
+		}
+		purger := cdn.New(*purge)
+		go purger.Run()
+		apiConfig.Purger = purger
+	}
+	if jsonData.Notifications.Webhook != "" {
+		webhook := notify.NewWebhook(jsonData.Notifications.Webhook)
+		go webhook.Run()
+		apiConfig.Notifier = webhook
+	}
+	if smtpConfig := jsonData.Notifications.SMTP; smtpConfig != nil {
+		mailer := notify.NewMail(smtpConfig.Addr, smtpConfig.From, smtpConfig.Username, smtpConfig.Password)
+		go mailer.Run()
+		apiConfig.Mailer = mailer
+	}
+	if smsConfig := jsonData.Notifications.SMS; smsConfig != nil {
+		if smsConfig.AccountSID == "" || smsConfig.From == "" {
+			log.Fatal("Invalid config: notifications.sms needs an accountSid and a from")
+		}
+		apiConfig.SMS = notify.NewTwilio(smsConfig.AccountSID, smsConfig.AuthToken, smsConfig.From, smsConfig.StatusCallback)
+	}
+	if teamsConfig := jsonData.Notifications.Teams; teamsConfig != nil {
+		connector := notify.NewTeamsConnector(nil)
+		if teamsConfig.Provider != "" {
+			if len(jsonData.Tenants) > 0 {
+				log.Fatal("Teams posts through Graph are not available in multi-tenant mode")
+			}
+			microsoft, ok := apiConfig.Providers[teamsConfig.Provider].(*auth.Microsoft)
+			if !ok {
+				log.Fatal("Invalid config: notifications.teams.provider must name a microsoft identity provider")
+			}
+			connector.Tokens = microsoft.AppTokenSource(context.Background())
+		}
+		go connector.Run()
+		apiConfig.Teams = connector
+	}
+	if day := jsonData.Notifications.WeeklyDigestDay; day != "" {
+		apiConfig.WeeklyDigestDay, err = calendar.ParseDay(day)
+		if err != nil {
+			log.Fatal("Invalid config: notifications.weeklyDigestDay: ", err)
+		}
+	}
+	if grpcConfig.Addr != "" && len(jsonData.Tenants) > 0 {
+		log.Fatal("The gRPC service is not available in multi-tenant mode")
+	}
+	for _, tenant := range jsonData.Tenants {
+		if !api.ValidTenantName(tenant.Name) {
+			log.Fatalf("Invalid tenant name %q", tenant.Name)
+		}
+		config := apiConfig
+		config.Tenant = tenant.Name
+		config.Providers = make(map[string]auth.Provider)
+		config.MobileRedirectURLs = make(map[string][]string)
+		setupProviders(&config, tenant.Providers)
+		config.Importers = nil
+		setupImporters(&config, tenant.ERP)
+		config.Settings = settingsFromConfig(jsonData, tenant.Name)
+		err = config.Settings.Validate()
+		if err != nil {
+			log.Fatal("Invalid config of tenant ", tenant.Name, ": ", err)
+		}
+		tenants = append(tenants, tenantSetup{
+			name:   tenant.Name,
+			hosts:  tenant.Hosts,
+			config: config,
+			store:  db.NewStore(tenant.Database),
+		})
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
 }
 
-func dayTimetableHandler(w http.ResponseWriter, r *http.Request) {
-	class := r.URL.Query().Get("class")
-	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
-	var subject []string = db.GetTimetableByDay(class, date)
-	responseJSON, err := json.Marshal(subject)
-	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+// setupProviders adds the identity providers to config, the first one being the default
+func setupProviders(config *api.Config, providerConfigs []auth.ProviderConfig) {
+	for _, providerConfig := range providerConfigs {
+		provider, err := auth.NewProvider(context.Background(), providerConfig, graphClient)
+		if err != nil {
+			log.Fatal("Error setting up identity provider:", err)
+		}
+		if _, ok := config.Providers[provider.Name()]; ok {
+			log.Fatal("Duplicate identity provider:", provider.Name())
+		}
+		config.Providers[provider.Name()] = provider
+		config.MobileRedirectURLs[provider.Name()] = providerConfig.MobileRedirectURLs
+		if config.DefaultProvider == nil {
+			config.DefaultProvider = provider
+		}
+	}
+	if config.DefaultProvider == nil {
+		log.Fatal("No identity provider configured")
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
 }
 
-func getAllSlotHandler(w http.ResponseWriter, r *http.Request) {
-	var slot []int = db.GetAllSlot()
-	responseJSON, err := json.Marshal(slot)
-	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+// setupImporters adds the ERP importers to config
+func setupImporters(config *api.Config, importerConfigs []erp.Config) {
+	names := make(map[string]bool)
+	for _, importerConfig := range importerConfigs {
+		importer, err := erp.New(importerConfig)
+		if err != nil {
+			log.Fatal("Error setting up ERP importer: ", err)
+		}
+		if names[importer.Name()] {
+			log.Fatal("Duplicate ERP importer: ", importer.Name())
+		}
+		names[importer.Name()] = true
+		config.Importers = append(config.Importers, importer)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
 }
 
-func getAllClassHandler(w http.ResponseWriter, r *http.Request) {
-	var class []string = db.GetAllClass()
-	responseJSON, err := json.Marshal(class)
+func readConfig() (configJSONRepr, error) {
+	jsonData := configJSONRepr{Server: serverConfig, Compression: compressionConfig, Headers: headersConfig, Tracing: tracingConfig,
+		Database: databaseJSONRepr{SlowQuery: duration(db.DefaultSlowQuery), PreloadRefresh: duration(5 * time.Minute)}}
+	file, err := ioutil.ReadFile(configFile)
 	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+		return jsonData, fmt.Errorf("Error reading JSON file: %v", err)
+	}
+	err = json.Unmarshal(file, &jsonData)
+	if err != nil {
+		return jsonData, fmt.Errorf("Error unmarshalling JSON: %v", err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	err = resolveSecrets(&jsonData)
+	if err != nil {
+		return jsonData, fmt.Errorf("Error resolving secrets: %v", err)
+	}
+	return jsonData, nil
 }
 
-func getAllSubjectHandler(w http.ResponseWriter, r *http.Request) {
-	var subject []string = db.GetAllSubject()
-	responseJSON, err := json.Marshal(subject)
-	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+// resolveSecrets replaces the env:, file: and keyvault: references in the secret fields by their values
+func resolveSecrets(jsonData *configJSONRepr) error {
+	fields := []*string{&jsonData.ClientSecret, &jsonData.AdminKey, &jsonData.Database.Password,
+		&jsonData.Attachments.SigningKey, &jsonData.Attachments.SecretAccessKey, &jsonData.Attachments.ContainerURL,
+		&jsonData.Backups.SecretAccessKey, &jsonData.Backups.ContainerURL}
+	for idx := range jsonData.ERP {
+		fields = append(fields, &jsonData.ERP[idx].Token)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	for idx := range jsonData.Providers {
+		fields = append(fields, &jsonData.Providers[idx].ClientSecret)
+	}
+	if jsonData.Security.Captcha != nil {
+		fields = append(fields, &jsonData.Security.Captcha.Secret)
+	}
+	if jsonData.Database.Replica != nil {
+		fields = append(fields, &jsonData.Database.Replica.Password)
+	}
+	if jsonData.Notifications.SMTP != nil {
+		fields = append(fields, &jsonData.Notifications.SMTP.Password)
+	}
+	if jsonData.Notifications.SMS != nil {
+		fields = append(fields, &jsonData.Notifications.SMS.AuthToken)
+	}
+	for idx := range jsonData.Tenants {
+		tenant := &jsonData.Tenants[idx]
+		fields = append(fields, &tenant.AdminKey, &tenant.Database.Password)
+		if tenant.Database.Replica != nil {
+			fields = append(fields, &tenant.Database.Replica.Password)
+		}
+		for idx := range tenant.Providers {
+			fields = append(fields, &tenant.Providers[idx].ClientSecret)
+		}
+		for idx := range tenant.ERP {
+			fields = append(fields, &tenant.ERP[idx].Token)
+		}
+	}
+	for _, field := range fields {
+		secret, err := secrets.Resolve(context.Background(), *field)
+		if err != nil {
+			return err
+		}
+		*field = secret
+	}
+	for name, value := range jsonData.Tracing.Headers {
+		secret, err := secrets.Resolve(context.Background(), value)
+		if err != nil {
+			return err
+		}
+		jsonData.Tracing.Headers[name] = secret
+	}
+	if purge := jsonData.CDN.Purge; purge != nil {
+		for name, value := range purge.Headers {
+			secret, err := secrets.Resolve(context.Background(), value)
+			if err != nil {
+				return err
+			}
+			purge.Headers[name] = secret
+		}
+	}
+	if tokenKeys := jsonData.Security.TokenKeys; tokenKeys != nil {
+		for id, key := range tokenKeys.Keys {
+			secret, err := secrets.Resolve(context.Background(), key)
+			if err != nil {
+				return err
+			}
+			tokenKeys.Keys[id] = secret
+		}
+	}
+	return nil
 }
 
-func getBookingHandler(w http.ResponseWriter, r *http.Request) {
-	faculty := r.URL.Query().Get("faculty")
-	var subject []db.BookingRecord = db.GetBooking(faculty)
-	responseJSON, err := json.Marshal(subject)
-	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+/*
+The settings that are picked up again on SIGHUP. Everything else in
+config.json (providers, server limits, compression, headers, tracing, debug) needs a restart.
+A tenant's settings are the top level ones with its own admin key; a tenant no
+longer in the file gets no admin key, which locks its admins out.
+*/
+func settingsFromConfig(jsonData configJSONRepr, tenant string) api.Settings {
+	settings := api.Settings{
+		AdminKey:        jsonData.AdminKey,
+		AllowedOrigins:  jsonData.AllowedOrigins,
+		APIKeyRateLimit: jsonData.APIKeyRateLimit,
+	}
+	if tenant != "" {
+		settings.AdminKey = ""
+		for _, t := range jsonData.Tenants {
+			if t.Name == tenant {
+				settings.AdminKey = t.AdminKey
+			}
+		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
+	return settings
 }
 
-func bookingHandler(w http.ResponseWriter, r *http.Request) {
-	var response insertResponse
-	class := r.URL.Query().Get("class")
-	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+/*
+reloadOnSignal rereads config.json every time the process gets a SIGHUP. A
+file that does not parse or settings that fail validation are logged and the
+running settings are kept, so a bad edit cannot take the server down. servers
+are keyed by tenant, "" when there are none. The settings of every tenant are
+validated before any is applied, so tenants never run a mix of old and new.
+*/
+func reloadOnSignal(servers map[string]*api.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		jsonData, err := readConfig()
+		settings := make(map[string]api.Settings, len(servers))
+		for tenant := range servers {
+			if err != nil {
+				break
+			}
+			settings[tenant] = settingsFromConfig(jsonData, tenant)
+			err = settings[tenant].Validate()
+			if err != nil && tenant != "" {
+				err = fmt.Errorf("tenant %s: %w", tenant, err)
+			}
+		}
+		if err == nil {
+			for tenant, server := range servers {
+				// Validated above, so this cannot fail
+				server.UpdateSettings(settings[tenant])
+			}
+		}
+		if err != nil {
+			log.Println("Keeping the current settings, reloading", configFile, "failed:", err)
+			continue
+		}
+		log.Println("Reloaded settings from", configFile)
 	}
-	slot, err := strconv.Atoi(r.URL.Query().Get("slot"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+}
+
+/*
+shutdownOnSignal stops the server gracefully on SIGINT or SIGTERM, or on a
+restart signal once the successor is serving (see startSuccessor). No new
+background job runs or connections are started, and the runs, requests and
+texts going get up to shutdownTimeout to finish, then the spans they recorded
+are exported. stopped is closed after that.
+*/
+func shutdownOnSignal(httpServer *http.Server, servers map[string]*api.Server, stopped chan<- struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, restartSignals...)...)
+	for sig := range signals {
+		if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+			break
+		}
+		log.Println("Restarting")
+		err := startSuccessor()
+		if err == nil {
+			break
+		}
+		log.Println("Restart failed, still serving:", err)
 	}
-	faculty := r.URL.Query().Get("faculty")
-	subject := r.URL.Query().Get("subject")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	log.Println("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for tenant, server := range servers {
+		err := server.StopJobs(ctx)
+		if err != nil {
+			log.Println("Background jobs", tenant, "did not finish:", err)
+		}
 	}
-	rowsAffected, err := db.Booking(class, date, slot, faculty, subject)
+	err := httpServer.Shutdown(ctx)
 	if err != nil {
-		log.Println(err)
-		response.Inserted = false
-	} else {
-		if rowsAffected > 0 {
-			response.Inserted = true
-		} else {
-			response.Inserted = false
+		log.Println("Requests did not finish:", err)
+	}
+	// After the requests, which may text too; texts not sent by then are sent on the next start
+	for tenant, server := range servers {
+		err := server.StopTexts(ctx)
+		if err != nil {
+			log.Println("Texts", tenant, "were not sent:", err)
 		}
 	}
-	responseJSON, err := json.Marshal(response)
-	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+	if tracer != nil {
+		err = tracer.Flush(ctx)
+		if err != nil {
+			log.Println("Spans were not exported:", err)
+		}
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-	return
+	close(stopped)
 }
 
-func multiBookingHandler(w http.ResponseWriter, r *http.Request) {
-	var response insertResponse
-	class := r.URL.Query().Get("class")
-	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+func main() {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	if tracingConfig.Endpoint != "" {
+		tracer = tracing.New(tracingConfig)
+		go tracer.Run()
+		tracing.SetTracer(tracer)
+		log.Println("Exporting traces to", tracingConfig.Endpoint)
+	}
+	servers := make(map[string]*api.Server)
+	var handler http.Handler
+	// Shared by the gRPC service, so its bookings reach a preloaded timetable
+	var repo db.Repository = db.Store{}
+	if len(tenants) == 0 {
+		repo = repository(db.Store{})
+		server := api.NewServer(repo, cache.NewMemory(), apiConfig, logger)
+		servers[""] = server
+		handler = server.CORS(server.Routes())
+	} else {
+		var tenantHandlers []api.Tenant
+		for _, tenant := range tenants {
+			tenantLogger := log.New(os.Stderr, tenant.name+" ", log.LstdFlags)
+			server := api.NewServer(repository(tenant.store), cache.NewMemory(), tenant.config, tenantLogger)
+			servers[tenant.name] = server
+			tenantHandlers = append(tenantHandlers, api.Tenant{Name: tenant.name, Hosts: tenant.hosts, Handler: server.CORS(server.Routes())})
+		}
+		var err error
+		handler, err = api.TenantHandler(tenantHandlers)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
-	startSlot, err := strconv.Atoi(r.URL.Query().Get("startSlot"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	go reloadOnSignal(servers)
+
+	go db.RunSearchRecorder()
+	go db.RunViewRecorder()
+	for _, server := range servers {
+		server.StartJobs()
+		go server.RunTexts()
 	}
-	endSlot, err := strconv.Atoi(r.URL.Query().Get("endSlot"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+
+	if debugConfig.Enabled && debugConfig.Addr != "" {
+		// No write timeout, CPU profiles and traces take as long as asked for
+		debugServer := &http.Server{
+			Addr:              debugConfig.Addr,
+			Handler:           api.DebugHandler(),
+			ReadHeaderTimeout: time.Duration(serverConfig.ReadHeaderTimeout),
+		}
+		listener, err := listen(debugConfig.Addr)
+		if err != nil {
+			log.Fatal("Debug listener: ", err)
+		}
+		go func() {
+			log.Println("Debug server starting on", debugConfig.Addr)
+			log.Println("Debug server stopped:", debugServer.Serve(listener))
+		}()
 	}
-	faculty := r.URL.Query().Get("faculty")
-	subject := r.URL.Query().Get("subject")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+
+	if grpcConfig.Addr != "" {
+		server := servers[""]
+		listener, err := listen(grpcConfig.Addr)
+		if err != nil {
+			log.Fatal("gRPC listener: ", err)
+		}
+		go func() {
+			log.Println("gRPC server starting on", grpcConfig.Addr)
+			log.Println("gRPC server stopped:", rpcserver.New(repo, server, apiConfig.Location).Serve(listener))
+		}()
+	}
+
+	connections := conntrack.New()
+	expvar.Publish("connections", expvar.Func(func() interface{} {
+		return connections.Stats()
+	}))
+	httpServer := &http.Server{
+		Addr:              port,
+		Handler:           connections.Handler(headers.Handler(headersConfig, compress.Handler(compressionConfig, fields.Handler(maxBytesHandler(serverConfig.MaxBodyBytes, handler))))),
+		ReadHeaderTimeout: time.Duration(serverConfig.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(serverConfig.ReadTimeout),
+		WriteTimeout:      time.Duration(serverConfig.WriteTimeout),
+		IdleTimeout:       time.Duration(serverConfig.IdleTimeout),
+		MaxHeaderBytes:    serverConfig.MaxHeaderBytes,
+		ConnState:         connections.ConnState,
+		ConnContext:       connections.ConnContext,
+	}
+	httpServer.SetKeepAlivesEnabled(!serverConfig.DisableKeepAlives)
+	if serverConfig.CertFile != "" {
+		configureHTTP2(httpServer)
 	}
-	rowsAffected, err := db.MultiBooking(class, date, startSlot, endSlot, faculty, subject)
+
+	listener, err := listen(port)
 	if err != nil {
-		log.Println(err)
-		response.Inserted = false
+		log.Fatal(err)
+	}
+	stopped := make(chan struct{})
+	go shutdownOnSignal(httpServer, servers, stopped)
+	notifyReady()
+
+	log.Println("Server starting on port ", port)
+	if serverConfig.CertFile != "" {
+		err = httpServer.ServeTLS(listener, serverConfig.CertFile, serverConfig.KeyFile)
 	} else {
-		if rowsAffected == int64(endSlot-startSlot+1) {
-			response.Inserted = true
-		} else {
-			response.Inserted = false
-		}
+		err = httpServer.Serve(listener)
 	}
-	responseJSON, err := json.Marshal(response)
-	if err != nil {
-		log.Println("Error marshalling data", err)
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		return
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(responseJSON)
-	return
+	<-stopped
+	log.Println("Server stopped")
 }
 
-func cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
-	class := r.URL.Query().Get("class")
-	date, err := time.Parse("2006-01-02", r.URL.Query().Get("date"))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+/*
+configureHTTP2 offers HTTP/2 to HTTPS clients unless it is disabled, so a client
+sends its requests side by side on one connection instead of opening more.
+Connections idle as long as HTTP/1.1 ones.
+*/
+func configureHTTP2(server *http.Server) {
+	if serverConfig.DisableHTTP2 {
+		// A non-nil empty map is what keeps net/http from enabling it
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
 		return
 	}
-	slot, err := strconv.Atoi(r.URL.Query().Get("slot"))
+	err := http2.ConfigureServer(server, &http2.Server{
+		MaxConcurrentStreams: serverConfig.MaxConcurrentStreams,
+		IdleTimeout:          time.Duration(serverConfig.IdleTimeout),
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Fatal("HTTP/2: ", err)
 	}
-	err = db.CancelBooking(class, date, slot)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// repository returns store, in front of a copy of its timetable in memory with database.preload
+func repository(store db.Store) db.Repository {
+	if preloadRefresh == 0 {
+		return store
 	}
-	http.Redirect(w, r, "/profile.html", http.StatusFound)
-	return
+	return db.NewPreloaded(store, preloadRefresh)
+}
+
+/*
+maxBytesHandler caps the size of every request body. Reading past the limit
+fails, so handlers decoding a body get an error instead of buffering whatever a
+client decides to send. Uploads are left to the API, which has its own limit.
+*/
+func maxBytesHandler(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == api.AttachmentUploadPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > limit {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,181 @@
+/*
+Package notify tells users about changes that concern them, like a class of
+theirs being cancelled. The API hands every Message to a Notifier, which may
+log it, post it to a push gateway or keep it for a test.
+*/
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of messages
+const (
+	KindTimetable   = "timetable"
+	KindWaitlist    = "waitlist"
+	KindBooking     = "booking"
+	KindAttendance  = "attendance"
+	KindAssignment  = "assignment"
+	KindAppointment = "appointment"
+	KindEvent       = "event"
+	KindDigest      = "digest"
+	KindBroadcast   = "broadcast"
+	KindFeedback    = "feedback"
+	KindPrivacy     = "privacy"
+	KindExam        = "exam"
+)
+
+// A Message to one user, addressed by mail
+type Message struct {
+	To    string `json:"to"`
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+/*
+Notifier delivers messages. Notify must not block on the delivery, handlers
+call it while answering a request.
+*/
+type Notifier interface {
+	Notify(msg Message)
+}
+
+// Log writes every message to Logger, for when there is nowhere to deliver to
+type Log struct {
+	Logger *log.Logger
+}
+
+func (l Log) Notify(msg Message) {
+	l.Logger.Printf("notify %s (%s): %s", msg.To, msg.Kind, msg.Title)
+}
+
+/*
+Webhook posts every message as JSON to URL. Messages are queued and posted by
+Run, so a slow gateway never holds up a request; when the queue is full they
+are dropped.
+*/
+type Webhook struct {
+	URL    string
+	client *http.Client
+	queue  chan Message
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan Message, 1024),
+	}
+}
+
+func (w *Webhook) Notify(msg Message) {
+	select {
+	case w.queue <- msg:
+	default:
+		log.Println("notification buffer full, dropping message to", msg.To)
+	}
+}
+
+// Run blocks forever, so it has to be started in its own goroutine
+func (w *Webhook) Run() {
+	for msg := range w.queue {
+		err := w.post(msg)
+		if err != nil {
+			log.Println("Error posting notification", err)
+		}
+	}
+}
+
+func (w *Webhook) post(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s answered %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+/*
+Mail sends every message as a plain text mail to its To address, from From,
+through the SMTP server at Addr ("smtp.example.com:587"). It logs in with
+Username and Password when there is a Username. Like Webhook it queues the
+messages for Run.
+*/
+type Mail struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+	queue    chan Message
+}
+
+func NewMail(addr string, from string, username string, password string) *Mail {
+	return &Mail{Addr: addr, From: from, Username: username, Password: password, queue: make(chan Message, 1024)}
+}
+
+func (m *Mail) Notify(msg Message) {
+	select {
+	case m.queue <- msg:
+	default:
+		log.Println("mail buffer full, dropping message to", msg.To)
+	}
+}
+
+// Run blocks forever, so it has to be started in its own goroutine
+func (m *Mail) Run() {
+	for msg := range m.queue {
+		var auth smtp.Auth
+		if m.Username != "" {
+			host, _, _ := net.SplitHostPort(m.Addr)
+			auth = smtp.PlainAuth("", m.Username, m.Password, host)
+		}
+		err := smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, mailBody(m.From, msg))
+		if err != nil {
+			log.Println("Error mailing notification", err)
+		}
+	}
+}
+
+// mailBody is the mail of msg, headers included; line breaks in the title cannot add headers
+func mailBody(from string, msg Message) []byte {
+	title := strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Title)
+	body := strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n")
+	return []byte("From: " + from + "\r\nTo: " + msg.To + "\r\nSubject: " + title +
+		"\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" + body + "\r\n")
+}
+
+// Memory keeps the messages, for tests
+type Memory struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *Memory) Notify(msg Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+}
+
+// Sent returns the messages passed to Notify, oldest first
+func (m *Memory) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestWebhookPosts(t *testing.T) {
+	received := make(chan Message, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("decoding posted message: %v", err)
+		}
+		received <- msg
+	}))
+	defer ts.Close()
+
+	webhook := NewWebhook(ts.URL)
+	go webhook.Run()
+	want := Message{To: "student@cb.students.amrita.edu", Kind: KindTimetable, Title: "Cancelled"}
+	webhook.Notify(want)
+	select {
+	case got := <-received:
+		if got != want {
+			t.Errorf("posted %+v; want %+v", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook did not post the message")
+	}
+}
+
+func TestMailBody(t *testing.T) {
+	body := string(mailBody("cora@cb.amrita.edu", Message{To: "student@cb.students.amrita.edu",
+		Title: "Your week\r\nBcc: someone@example.com", Body: "Mon: 19CSE302\nTue: free"}))
+	want := "From: cora@cb.amrita.edu\r\nTo: student@cb.students.amrita.edu\r\n" +
+		"Subject: Your week  Bcc: someone@example.com\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"Mon: 19CSE302\r\nTue: free\r\n"
+	if body != want {
+		t.Errorf("mail = %q; want %q", body, want)
+	}
+}
+
+func TestTwilio(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sid, token, _ := r.BasicAuth()
+		if r.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" || sid != "AC1" || token != "secret" {
+			t.Errorf("posted to %s as %s:%s", r.URL.Path, sid, token)
+		}
+		if r.FormValue("To") != "+919876543210" || r.FormValue("From") != "+15005550006" ||
+			r.FormValue("Body") != "Evacuate AB3" || r.FormValue("StatusCallback") != "https://cora.example.com/sms/status" {
+			t.Errorf("posted %v", r.PostForm)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM42", "status": "queued"}`))
+	}))
+	defer ts.Close()
+
+	twilio := NewTwilio("AC1", "secret", "+15005550006", "https://cora.example.com/sms/status")
+	twilio.BaseURL = ts.URL
+	id, err := twilio.SendSMS("+919876543210", "Evacuate AB3")
+	if err != nil || id != "SM42" {
+		t.Fatalf("SendSMS = %q, %v; want SM42", id, err)
+	}
+
+	report := url.Values{"MessageSid": {"SM42"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}}
+	r := httptest.NewRequest("POST", "/sms/status", strings.NewReader(report.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Twilio-Signature", twilio.signature(twilio.StatusCallback, report))
+	if status, err := twilio.ParseStatus(r); err != nil || status != (SMSStatus{ID: "SM42", Status: SMSUndelivered, Error: "30003"}) {
+		t.Errorf("ParseStatus = %+v, %v", status, err)
+	}
+	r = httptest.NewRequest("POST", "/sms/status", strings.NewReader(report.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Twilio-Signature", "forged")
+	if _, err := twilio.ParseStatus(r); err == nil {
+		t.Errorf("ParseStatus accepted a forged report")
+	}
+}
+
+func TestTeamsConnector(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding post: %v", err)
+		}
+		switch r.URL.Path {
+		case "/webhook":
+			card := body["attachments"].([]interface{})[0].(map[string]interface{})
+			if body["type"] != "message" || card["contentType"] != "application/vnd.microsoft.card.adaptive" {
+				t.Errorf("webhook got %v", body)
+			}
+			blocks := card["content"].(map[string]interface{})["body"].([]interface{})
+			if len(blocks) != 2 || blocks[0].(map[string]interface{})["text"] != "19CSE311 cancelled" {
+				t.Errorf("webhook got blocks %v", blocks)
+			}
+		case "/teams/T1/channels/19:abc@thread.tacv2/messages":
+			if r.Header.Get("Authorization") != "Bearer app-token" {
+				t.Errorf("Graph post with %q", r.Header.Get("Authorization"))
+			}
+			content := body["body"].(map[string]interface{})["content"]
+			if body["subject"] != "19CSE311 cancelled" || content != "Slot 3 &lt;today&gt;<br>Sorry" {
+				t.Errorf("Graph got %v", body)
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	teams := NewTeamsConnector(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "app-token"}))
+	teams.GraphURL = ts.URL + "/"
+	post := Post{Title: "19CSE311 cancelled", Text: "Slot 3 <today>\nSorry"}
+	if err := teams.send(Channel{Webhook: ts.URL + "/webhook"}, post); err != nil {
+		t.Errorf("posting to the webhook: %v", err)
+	}
+	if err := teams.send(Channel{TeamID: "T1", ChannelID: "19:abc@thread.tacv2"}, post); err != nil {
+		t.Errorf("posting with Graph: %v", err)
+	}
+	if err := teams.send(Channel{Webhook: ts.URL + "/gone"}, post); err == nil || strings.Contains(err.Error(), ts.URL) {
+		t.Errorf("posting to a missing webhook = %v, want an error without its URL", err)
+	}
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Statuses of a text message. It is SMSPending until a server claims it to send,
+SMSSending until the provider takes it, then has the statuses the provider
+reports, like Twilio's.
+*/
+const (
+	SMSPending     = "pending"
+	SMSSending     = "sending"
+	SMSQueued      = "queued"
+	SMSSent        = "sent"
+	SMSDelivered   = "delivered"
+	SMSUndelivered = "undelivered"
+	SMSFailed      = "failed"
+)
+
+/*
+SMS sends text messages through a provider, for the few messages that must
+reach users without the app, like emergencies. Unlike Notify, SendSMS blocks
+on the provider.
+*/
+type SMS interface {
+	// SendSMS texts body to the E.164 number to and returns the ID the provider gave the message
+	SendSMS(to string, body string) (id string, err error)
+	// ParseStatus reads a delivery report the provider posted to the status callback
+	ParseStatus(r *http.Request) (SMSStatus, error)
+}
+
+// A delivery report of a text message
+type SMSStatus struct {
+	// As returned by SendSMS
+	ID     string
+	Status string
+	// Provider's code of why it failed, if it did
+	Error string
+}
+
+/*
+Twilio sends text messages from From, a number or messaging service, with the
+Messages API of the account. Delivery reports are asked for when there is a
+StatusCallback, the public URL of the endpoint they are posted to, which they
+are signed for.
+*/
+type Twilio struct {
+	AccountSID     string
+	AuthToken      string
+	From           string
+	StatusCallback string
+	// Defaults to https://api.twilio.com
+	BaseURL string
+	client  *http.Client
+}
+
+func NewTwilio(accountSID string, authToken string, from string, statusCallback string) *Twilio {
+	return &Twilio{AccountSID: accountSID, AuthToken: authToken, From: from, StatusCallback: statusCallback,
+		BaseURL: "https://api.twilio.com", client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (t *Twilio) SendSMS(to string, body string) (string, error) {
+	form := url.Values{"To": {to}, "From": {t.From}, "Body": {body}}
+	if t.StatusCallback != "" {
+		form.Set("StatusCallback", t.StatusCallback)
+	}
+	req, err := http.NewRequest("POST", t.BaseURL+"/2010-04-01/Accounts/"+url.PathEscape(t.AccountSID)+"/Messages.json",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var message struct {
+		SID string `json:"sid"`
+		// Why it was refused
+		Message string `json:"message"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&message)
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("Twilio answered %s: %s", resp.Status, message.Message)
+	}
+	if err != nil {
+		return "", err
+	}
+	return message.SID, nil
+}
+
+// ParseStatus checks the X-Twilio-Signature of the report, which only Twilio can make with the auth token
+func (t *Twilio) ParseStatus(r *http.Request) (SMSStatus, error) {
+	if err := r.ParseForm(); err != nil {
+		return SMSStatus{}, err
+	}
+	if !hmac.Equal([]byte(r.Header.Get("X-Twilio-Signature")), []byte(t.signature(t.StatusCallback, r.PostForm))) {
+		return SMSStatus{}, errors.New("invalid signature")
+	}
+	return SMSStatus{ID: r.PostForm.Get("MessageSid"), Status: r.PostForm.Get("MessageStatus"),
+		Error: r.PostForm.Get("ErrorCode")}, nil
+}
+
+// signature is what Twilio signs a post of form to url with: the URL and the parameters sorted by name
+func (t *Twilio) signature(url string, form url.Values) string {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	data := url
+	for _, name := range names {
+		for _, value := range form[name] {
+			data += name + value
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(t.AuthToken))
+	mac.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// A Text sent by MemorySMS
+type Text struct {
+	ID   string
+	To   string
+	Body string
+}
+
+/*
+MemorySMS keeps the texts, for tests. Its delivery reports are forms of id,
+status and error, without a signature.
+*/
+type MemorySMS struct {
+	mu    sync.Mutex
+	texts []Text
+}
+
+func (m *MemorySMS) SendSMS(to string, body string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	text := Text{ID: fmt.Sprintf("SM%d", len(m.texts)+1), To: to, Body: body}
+	m.texts = append(m.texts, text)
+	return text.ID, nil
+}
+
+func (m *MemorySMS) ParseStatus(r *http.Request) (SMSStatus, error) {
+	if err := r.ParseForm(); err != nil {
+		return SMSStatus{}, err
+	}
+	return SMSStatus{ID: r.PostForm.Get("id"), Status: r.PostForm.Get("status"), Error: r.PostForm.Get("error")}, nil
+}
+
+// Texts returns the texts passed to SendSMS, oldest first
+func (m *MemorySMS) Texts() []Text {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Text(nil), m.texts...)
+}
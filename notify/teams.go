@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/graph"
+	"golang.org/x/oauth2"
+)
+
+/*
+A Channel of Microsoft Teams: one posted to through an incoming webhook of it,
+or the ChannelID of the team TeamID, posted to with the Graph API.
+*/
+type Channel struct {
+	Webhook   string
+	TeamID    string
+	ChannelID string
+}
+
+// A Post to a channel, about something a whole class section should know
+type Post struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+/*
+Teams posts to channels of Microsoft Teams. Like Notify, Post must not block on
+the delivery.
+*/
+type Teams interface {
+	Post(channel Channel, post Post)
+}
+
+type queuedPost struct {
+	channel Channel
+	post    Post
+}
+
+/*
+TeamsConnector posts to Teams, an Adaptive Card to an incoming webhook or a
+channel message with Graph. Graph posts log in as the application with
+Tokens, which needs the ChannelMessage.Send.Group permission consented to in
+the team; they fail without Tokens. Like Webhook, it queues the posts for Run.
+*/
+type TeamsConnector struct {
+	Tokens oauth2.TokenSource
+	// Defaults to graph.DefaultBaseURL
+	GraphURL string
+	client   *http.Client
+	queue    chan queuedPost
+}
+
+func NewTeamsConnector(tokens oauth2.TokenSource) *TeamsConnector {
+	return &TeamsConnector{
+		Tokens:   tokens,
+		GraphURL: graph.DefaultBaseURL,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan queuedPost, 1024),
+	}
+}
+
+func (t *TeamsConnector) Post(channel Channel, post Post) {
+	select {
+	case t.queue <- queuedPost{channel, post}:
+	default:
+		log.Println("Teams buffer full, dropping post", post.Title)
+	}
+}
+
+// Run blocks forever, so it has to be started in its own goroutine
+func (t *TeamsConnector) Run() {
+	for queued := range t.queue {
+		err := t.send(queued.channel, queued.post)
+		if err != nil {
+			log.Println("Error posting to Teams", err)
+		}
+	}
+}
+
+func (t *TeamsConnector) send(channel Channel, post Post) error {
+	if channel.Webhook != "" {
+		return t.postJSON(channel.Webhook, "", webhookCard(post))
+	}
+	if t.Tokens == nil {
+		return errors.New("no Graph login to post to a channel with")
+	}
+	token, err := t.Tokens.Token()
+	if err != nil {
+		return err
+	}
+	var message struct {
+		Subject string `json:"subject"`
+		Body    struct {
+			ContentType string `json:"contentType"`
+			Content     string `json:"content"`
+		} `json:"body"`
+	}
+	message.Subject = post.Title
+	message.Body.ContentType = "html"
+	message.Body.Content = strings.ReplaceAll(html.EscapeString(post.Text), "\n", "<br>")
+	endpoint := t.GraphURL + "teams/" + url.PathEscape(channel.TeamID) + "/channels/" + url.PathEscape(channel.ChannelID) + "/messages"
+	return t.postJSON(endpoint, token.AccessToken, message)
+}
+
+func (t *TeamsConnector) postJSON(endpoint string, accessToken string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		// Not the URL, whose secret anyone could post with
+		return fmt.Errorf("Teams answered %s to %q", resp.Status, excerpt(v))
+	}
+	return nil
+}
+
+// excerpt names what was posted in an error
+func excerpt(v interface{}) string {
+	body, _ := json.Marshal(v)
+	if len(body) > 64 {
+		body = append(body[:64], "..."...)
+	}
+	return string(body)
+}
+
+// webhookCard is post as the message an incoming webhook takes, an Adaptive Card with the title over the text
+func webhookCard(post Post) interface{} {
+	type textBlock struct {
+		Type   string `json:"type"`
+		Text   string `json:"text"`
+		Weight string `json:"weight,omitempty"`
+		Size   string `json:"size,omitempty"`
+		Wrap   bool   `json:"wrap"`
+	}
+	blocks := []textBlock{{Type: "TextBlock", Text: post.Title, Weight: "Bolder", Size: "Medium", Wrap: true}}
+	if post.Text != "" {
+		blocks = append(blocks, textBlock{Type: "TextBlock", Text: post.Text, Wrap: true})
+	}
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{map[string]interface{}{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]interface{}{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    blocks,
+			},
+		}},
+	}
+}
+
+// A post MemoryTeams was given
+type ChannelPost struct {
+	Channel Channel
+	Post
+}
+
+// MemoryTeams keeps the posts, for tests
+type MemoryTeams struct {
+	mu    sync.Mutex
+	posts []ChannelPost
+}
+
+func (m *MemoryTeams) Post(channel Channel, post Post) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.posts = append(m.posts, ChannelPost{Channel: channel, Post: post})
+}
+
+// Posts returns the posts passed to Post, oldest first
+func (m *MemoryTeams) Posts() []ChannelPost {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]ChannelPost(nil), m.posts...)
+}
@@ -0,0 +1,283 @@
+/*
+Package params binds the parameters of a request, from its query and a form
+body, into a struct describing what an endpoint takes, so that handlers get
+typed values and every bad parameter gets the same 400:
+
+	var query struct {
+		Class string    `param:"class,required"`
+		Date  time.Time `param:"date,required"`
+		Slot  int       `param:"slot,required,min=1"`
+		Kinds []string  `param:"kind"`
+	}
+	err := params.Decoder{Location: loc}.Request(r, &query)
+
+Fields without a param tag are left alone, but for embedded structs, whose
+fields are decoded as the struct's own. Strings, ints, floats, bools,
+durations like 15m, times and encoding.TextUnmarshaler types are supported,
+and slices of them, which take the parameter repeated or comma separated.
+A time.Time is a date like 2023-06-13, or the date of an RFC 3339 time in the
+Decoder's Location; with the instant option it is the RFC 3339 time itself.
+
+A missing or empty parameter leaves the zero value, unless it is required;
+a pointer field tells it apart from a given zero by staying nil.
+min and max bound numbers, the length of strings and the number of values of
+slices. When a parameter is given more than once, a field that is not a slice
+takes the first.
+*/
+package params
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/calendar"
+)
+
+// Error is a parameter that is missing, malformed or out of bounds
+type Error struct {
+	Param string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return "Invalid " + e.Param + " value"
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	ErrMissing     = errors.New("missing")
+	ErrOutOfBounds = errors.New("out of bounds")
+)
+
+type Decoder struct {
+	// Of the dates given as RFC 3339 times, UTC when nil
+	Location *time.Location
+}
+
+/*
+Request decodes the query parameters of r into dst, a pointer to a struct,
+with those of an application/x-www-form-urlencoded body. Parameters of the
+body come first when both have one.
+*/
+func (d Decoder) Request(r *http.Request, dst interface{}) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	return d.Decode(r.Form, dst)
+}
+
+// Decode decodes values into dst, a pointer to a struct. The first bad parameter is an *Error.
+func (d Decoder) Decode(values url.Values, dst interface{}) error {
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("params: decoding into %T, not a pointer to a struct", dst)
+	}
+	return d.decodeStruct(values, target.Elem())
+}
+
+// decodeStruct decodes into the fields of target, and those of the structs it embeds
+func (d Decoder) decodeStruct(values url.Values, target reflect.Value) error {
+	for idx := 0; idx < target.NumField(); idx++ {
+		field := target.Type().Field(idx)
+		tag, ok := field.Tag.Lookup("param")
+		if !ok && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := d.decodeStruct(values, target.Field(idx)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ok || tag == "-" {
+			continue
+		}
+		opts, err := parseTag(tag)
+		if err == nil && !target.Field(idx).CanSet() {
+			err = errors.New("unexported")
+		}
+		if err != nil {
+			return fmt.Errorf("params: field %s: %v", field.Name, err)
+		}
+		if err := d.decodeField(target.Field(idx), values[opts.name], opts); err != nil {
+			return &Error{Param: opts.name, Err: err}
+		}
+	}
+	return nil
+}
+
+type options struct {
+	name     string
+	required bool
+	instant  bool
+	min, max *float64
+}
+
+func parseTag(tag string) (options, error) {
+	parts := strings.Split(tag, ",")
+	opts := options{name: parts[0]}
+	for _, part := range parts[1:] {
+		key, value := part, ""
+		if idx := strings.Index(part, "="); idx >= 0 {
+			key, value = part[:idx], part[idx+1:]
+		}
+		switch key {
+		case "required":
+			opts.required = true
+		case "instant":
+			opts.instant = true
+		case "min", "max":
+			bound, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return opts, fmt.Errorf("bad %s %q", key, value)
+			}
+			if key == "min" {
+				opts.min = &bound
+			} else {
+				opts.max = &bound
+			}
+		default:
+			return opts, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return opts, nil
+}
+
+func (d Decoder) decodeField(field reflect.Value, raw []string, opts options) error {
+	var values []string
+	for _, value := range raw {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		if opts.required {
+			return ErrMissing
+		}
+		return nil
+	}
+	if field.Kind() == reflect.Slice && !isScalar(field) {
+		var items []string
+		for _, value := range values {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+		if err := checkBounds(float64(len(items)), opts); err != nil {
+			return err
+		}
+		// The bounds are of the number of values, not of each
+		opts.min, opts.max = nil, nil
+		slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for idx, item := range items {
+			if err := d.decodeValue(slice.Index(idx), item, opts); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	// The first one wins, which is the body's when both have the parameter
+	return d.decodeValue(field, values[0], opts)
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	textType     = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isScalar tells a slice type that decodes from one value, like []byte or a TextUnmarshaler
+func isScalar(field reflect.Value) bool {
+	return reflect.PtrTo(field.Type()).Implements(textType)
+}
+
+func (d Decoder) decodeValue(field reflect.Value, value string, opts options) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := d.decodeValue(ptr.Elem(), value, opts); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	switch {
+	// Before TextUnmarshaler, which time.Time is for RFC 3339 only
+	case field.Type() == timeType:
+		var t time.Time
+		var err error
+		if opts.instant {
+			t, err = time.Parse(time.RFC3339, value)
+		} else {
+			location := d.Location
+			if location == nil {
+				location = time.UTC
+			}
+			t, err = calendar.ParseDate(value, location)
+		}
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(duration))
+		return nil
+	case reflect.PtrTo(field.Type()).Implements(textType):
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		if err := checkBounds(float64(len(value)), opts); err != nil {
+			return err
+		}
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		if err := checkBounds(float64(number), opts); err != nil {
+			return err
+		}
+		field.SetInt(number)
+	case reflect.Float32, reflect.Float64:
+		number, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		if err := checkBounds(number, opts); err != nil {
+			return err
+		}
+		field.SetFloat(number)
+	case reflect.Bool:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(flag)
+	default:
+		return fmt.Errorf("params: cannot decode into %s", field.Type())
+	}
+	return nil
+}
+
+func checkBounds(value float64, opts options) error {
+	if (opts.min != nil && value < *opts.min) || (opts.max != nil && value > *opts.max) {
+		return ErrOutOfBounds
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package params
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type slot struct {
+	Class string    `param:"class,required"`
+	Date  time.Time `param:"date,required"`
+	Slot  int       `param:"slot,required,min=1"`
+}
+
+type booking struct {
+	slot
+	Equipment []string  `param:"equipment,max=3"`
+	DryRun    bool      `param:"dryRun"`
+	At        time.Time `param:"at,instant"`
+	Capacity  *int      `param:"capacity"`
+	Ignored   string
+}
+
+func TestDecode(t *testing.T) {
+	loc := time.FixedZone("IST", 5*3600+1800)
+	values, _ := url.ParseQuery("class=A104&date=2023-06-13&slot=2&equipment=PROJ-01,+MIC-02&equipment=HDMI&dryRun=true&at=2023-06-13T09:30:00%2B05:30&capacity=0&Ignored=x")
+	var got booking
+	if err := (Decoder{Location: loc}).Decode(values, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := booking{
+		slot:      slot{Class: "A104", Date: time.Date(2023, 6, 13, 0, 0, 0, 0, time.UTC), Slot: 2},
+		Equipment: []string{"PROJ-01", "MIC-02", "HDMI"},
+		DryRun:    true,
+		At:        time.Date(2023, 6, 13, 4, 0, 0, 0, time.UTC),
+	}
+	if !got.At.Equal(want.At) {
+		t.Errorf("At = %v; want %v", got.At, want.At)
+	}
+	if got.Capacity == nil || *got.Capacity != 0 {
+		t.Errorf("Capacity = %v; want a given 0", got.Capacity)
+	}
+	got.At, got.Capacity = want.At, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %+v; want %+v", got, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for query, param := range map[string]string{
+		"date=2023-06-13&slot=2":                              "class",
+		"class=A104&date=13/06/2023&slot=2":                   "date",
+		"class=A104&date=2023-06-13&slot=two":                 "slot",
+		"class=A104&date=2023-06-13&slot=0":                   "slot",
+		"class=A104&date=2023-06-13&slot=1&dryRun=x":          "dryRun",
+		"class=A104&date=2023-06-13&slot=1&equipment=a,b,c,d": "equipment",
+		"class=A104&date=2023-06-13&slot=1&at=2023-06-13":     "at",
+	} {
+		values, _ := url.ParseQuery(query)
+		err := Decoder{}.Decode(values, &booking{})
+		var paramErr *Error
+		if !errors.As(err, &paramErr) || paramErr.Param != param || err.Error() != "Invalid "+param+" value" {
+			t.Errorf("Decode(%s) = %v; want an error of %s", query, err, param)
+		}
+	}
+	if err := (Decoder{}).Decode(url.Values{}, booking{}); err == nil {
+		t.Errorf("decoding into a struct value succeeded")
+	}
+}
+
+func TestRequestBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/?class=A104&slot=1", strings.NewReader("class=B201&date=2023-06-13"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var got booking
+	if err := (Decoder{}).Request(r, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Class != "B201" || got.Slot != 1 || got.Date.IsZero() {
+		t.Errorf("Request = %+v; want the body's class with the query's slot", got)
+	}
+}
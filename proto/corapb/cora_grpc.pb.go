@@ -0,0 +1,310 @@
+// The timetable and free class queries for other campus services. Served by
+// the rpcserver package on its own port; every call needs an API key with the
+// scope noted on it in the x-api-key metadata.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.23.4
+// source: cora.proto
+
+package corapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Timetable_FreeClasses_FullMethodName  = "/cora.v1.Timetable/FreeClasses"
+	Timetable_FreeSlots_FullMethodName    = "/cora.v1.Timetable/FreeSlots"
+	Timetable_DayTimetable_FullMethodName = "/cora.v1.Timetable/DayTimetable"
+	Timetable_ListSlots_FullMethodName    = "/cora.v1.Timetable/ListSlots"
+	Timetable_ListClasses_FullMethodName  = "/cora.v1.Timetable/ListClasses"
+	Timetable_ListSubjects_FullMethodName = "/cora.v1.Timetable/ListSubjects"
+)
+
+// TimetableClient is the client API for Timetable service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TimetableClient interface {
+	// Rooms free in every slot from start_slot to end_slot. freeclass:read
+	FreeClasses(ctx context.Context, in *FreeClassesRequest, opts ...grpc.CallOption) (*FreeClassesResponse, error)
+	// Free slots of a room. freeclass:read
+	FreeSlots(ctx context.Context, in *FreeSlotsRequest, opts ...grpc.CallOption) (*FreeSlotsResponse, error)
+	// What a room has in each slot of a day. timetable:read
+	DayTimetable(ctx context.Context, in *DayTimetableRequest, opts ...grpc.CallOption) (*DayTimetableResponse, error)
+	// timetable:read
+	ListSlots(ctx context.Context, in *ListSlotsRequest, opts ...grpc.CallOption) (*ListSlotsResponse, error)
+	// timetable:read
+	ListClasses(ctx context.Context, in *ListClassesRequest, opts ...grpc.CallOption) (*ListClassesResponse, error)
+	// timetable:read
+	ListSubjects(ctx context.Context, in *ListSubjectsRequest, opts ...grpc.CallOption) (*ListSubjectsResponse, error)
+}
+
+type timetableClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTimetableClient(cc grpc.ClientConnInterface) TimetableClient {
+	return &timetableClient{cc}
+}
+
+func (c *timetableClient) FreeClasses(ctx context.Context, in *FreeClassesRequest, opts ...grpc.CallOption) (*FreeClassesResponse, error) {
+	out := new(FreeClassesResponse)
+	err := c.cc.Invoke(ctx, Timetable_FreeClasses_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *timetableClient) FreeSlots(ctx context.Context, in *FreeSlotsRequest, opts ...grpc.CallOption) (*FreeSlotsResponse, error) {
+	out := new(FreeSlotsResponse)
+	err := c.cc.Invoke(ctx, Timetable_FreeSlots_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *timetableClient) DayTimetable(ctx context.Context, in *DayTimetableRequest, opts ...grpc.CallOption) (*DayTimetableResponse, error) {
+	out := new(DayTimetableResponse)
+	err := c.cc.Invoke(ctx, Timetable_DayTimetable_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *timetableClient) ListSlots(ctx context.Context, in *ListSlotsRequest, opts ...grpc.CallOption) (*ListSlotsResponse, error) {
+	out := new(ListSlotsResponse)
+	err := c.cc.Invoke(ctx, Timetable_ListSlots_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *timetableClient) ListClasses(ctx context.Context, in *ListClassesRequest, opts ...grpc.CallOption) (*ListClassesResponse, error) {
+	out := new(ListClassesResponse)
+	err := c.cc.Invoke(ctx, Timetable_ListClasses_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *timetableClient) ListSubjects(ctx context.Context, in *ListSubjectsRequest, opts ...grpc.CallOption) (*ListSubjectsResponse, error) {
+	out := new(ListSubjectsResponse)
+	err := c.cc.Invoke(ctx, Timetable_ListSubjects_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TimetableServer is the server API for Timetable service.
+// All implementations must embed UnimplementedTimetableServer
+// for forward compatibility
+type TimetableServer interface {
+	// Rooms free in every slot from start_slot to end_slot. freeclass:read
+	FreeClasses(context.Context, *FreeClassesRequest) (*FreeClassesResponse, error)
+	// Free slots of a room. freeclass:read
+	FreeSlots(context.Context, *FreeSlotsRequest) (*FreeSlotsResponse, error)
+	// What a room has in each slot of a day. timetable:read
+	DayTimetable(context.Context, *DayTimetableRequest) (*DayTimetableResponse, error)
+	// timetable:read
+	ListSlots(context.Context, *ListSlotsRequest) (*ListSlotsResponse, error)
+	// timetable:read
+	ListClasses(context.Context, *ListClassesRequest) (*ListClassesResponse, error)
+	// timetable:read
+	ListSubjects(context.Context, *ListSubjectsRequest) (*ListSubjectsResponse, error)
+	mustEmbedUnimplementedTimetableServer()
+}
+
+// UnimplementedTimetableServer must be embedded to have forward compatible implementations.
+type UnimplementedTimetableServer struct {
+}
+
+func (UnimplementedTimetableServer) FreeClasses(context.Context, *FreeClassesRequest) (*FreeClassesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FreeClasses not implemented")
+}
+func (UnimplementedTimetableServer) FreeSlots(context.Context, *FreeSlotsRequest) (*FreeSlotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FreeSlots not implemented")
+}
+func (UnimplementedTimetableServer) DayTimetable(context.Context, *DayTimetableRequest) (*DayTimetableResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DayTimetable not implemented")
+}
+func (UnimplementedTimetableServer) ListSlots(context.Context, *ListSlotsRequest) (*ListSlotsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSlots not implemented")
+}
+func (UnimplementedTimetableServer) ListClasses(context.Context, *ListClassesRequest) (*ListClassesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClasses not implemented")
+}
+func (UnimplementedTimetableServer) ListSubjects(context.Context, *ListSubjectsRequest) (*ListSubjectsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSubjects not implemented")
+}
+func (UnimplementedTimetableServer) mustEmbedUnimplementedTimetableServer() {}
+
+// UnsafeTimetableServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TimetableServer will
+// result in compilation errors.
+type UnsafeTimetableServer interface {
+	mustEmbedUnimplementedTimetableServer()
+}
+
+func RegisterTimetableServer(s grpc.ServiceRegistrar, srv TimetableServer) {
+	s.RegisterService(&Timetable_ServiceDesc, srv)
+}
+
+func _Timetable_FreeClasses_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FreeClassesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TimetableServer).FreeClasses(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Timetable_FreeClasses_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TimetableServer).FreeClasses(ctx, req.(*FreeClassesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Timetable_FreeSlots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FreeSlotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TimetableServer).FreeSlots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Timetable_FreeSlots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TimetableServer).FreeSlots(ctx, req.(*FreeSlotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Timetable_DayTimetable_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DayTimetableRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TimetableServer).DayTimetable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Timetable_DayTimetable_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TimetableServer).DayTimetable(ctx, req.(*DayTimetableRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Timetable_ListSlots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSlotsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TimetableServer).ListSlots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Timetable_ListSlots_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TimetableServer).ListSlots(ctx, req.(*ListSlotsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Timetable_ListClasses_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClassesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TimetableServer).ListClasses(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Timetable_ListClasses_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TimetableServer).ListClasses(ctx, req.(*ListClassesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Timetable_ListSubjects_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSubjectsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TimetableServer).ListSubjects(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Timetable_ListSubjects_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TimetableServer).ListSubjects(ctx, req.(*ListSubjectsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Timetable_ServiceDesc is the grpc.ServiceDesc for Timetable service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Timetable_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cora.v1.Timetable",
+	HandlerType: (*TimetableServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "FreeClasses",
+			Handler:    _Timetable_FreeClasses_Handler,
+		},
+		{
+			MethodName: "FreeSlots",
+			Handler:    _Timetable_FreeSlots_Handler,
+		},
+		{
+			MethodName: "DayTimetable",
+			Handler:    _Timetable_DayTimetable_Handler,
+		},
+		{
+			MethodName: "ListSlots",
+			Handler:    _Timetable_ListSlots_Handler,
+		},
+		{
+			MethodName: "ListClasses",
+			Handler:    _Timetable_ListClasses_Handler,
+		},
+		{
+			MethodName: "ListSubjects",
+			Handler:    _Timetable_ListSubjects_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "cora.proto",
+}
@@ -0,0 +1,76 @@
+/*
+Package ratelimit keeps one token bucket per key (an API key, an IP, ...).
+Buckets that have been full for a while are dropped so the map does not grow
+with every client ever seen.
+*/
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	swept   time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+/*
+Allow takes a token from key's bucket, which holds at most burst tokens and
+refills at perMinute tokens a minute. When it is empty it returns false and
+how long to wait for the next token.
+*/
+func (l *Limiter) Allow(key string, perMinute int, burst int) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	rate := float64(perMinute) / float64(time.Minute)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += float64(now.Sub(b.last)) * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration(math.Ceil((1 - b.tokens) / rate))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Every few minutes forget buckets that have not been touched in a while
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < 5*time.Minute {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > 10*time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2023, 6, 13, 10, 0, 0, 0, time.UTC)
+	l := New()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("key", 60, 3); !ok {
+			t.Fatalf("Allow() #%d = false; want true", i+1)
+		}
+	}
+	ok, wait := l.Allow("key", 60, 3)
+	if ok {
+		t.Fatalf("Allow() after burst = true; want false")
+	}
+	if wait != time.Second {
+		t.Errorf("wait = %v; want 1s", wait)
+	}
+	if ok, _ := l.Allow("other", 60, 3); !ok {
+		t.Errorf("Allow() for another key = false; want true")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("key", 60, 3); !ok {
+		t.Errorf("Allow() after refill = false; want true")
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := New()
+	for i := 0; i < 1000; i++ {
+		if ok, _ := l.Allow("key", 0, 0); !ok {
+			t.Fatalf("Allow() with no limit = false; want true")
+		}
+	}
+}
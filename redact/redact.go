@@ -0,0 +1,45 @@
+/*
+Package redact decides which values must not be written to logs: mail
+addresses, API keys, bearer tokens and anything long enough and random
+looking to be a session ID, OAuth state or another token of package token.
+*/
+package redact
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+// What sensitive values are logged as
+const Redacted = "[redacted]"
+
+// The shortest token handed out, token.MinBytes base64url encoded; hex is longer
+var minTokenLength = base64.RawURLEncoding.EncodedLen(token.MinBytes)
+
+// Sensitive reports whether value is a mail address, an API key, a bearer token or looks like a token
+func Sensitive(value string) bool {
+	return strings.Contains(value, "@") || strings.Contains(value, "cora_") ||
+		strings.HasPrefix(value, "Bearer ") || looksLikeToken(value)
+}
+
+func looksLikeToken(value string) bool {
+	if len(value) < minTokenLength {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns value, or Redacted when it is sensitive
+func String(value string) string {
+	if Sensitive(value) {
+		return Redacted
+	}
+	return value
+}
@@ -0,0 +1,253 @@
+/*
+Package report writes tables for spreadsheets: CSV, or an Excel workbook with
+a sheet per table. Rows go out to the underlying writer as they are added,
+so a report of any size only holds one row at a time.
+*/
+package report
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Content types of the formats
+const (
+	CSVContentType  = "text/csv; charset=utf-8"
+	XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// Longest sheet name Excel opens
+const maxSheetName = 31
+
+// A Writer writes tables one row at a time
+type Writer interface {
+	// Table starts a table of the columns; the rows added next go in it
+	Table(name string, columns ...string) error
+	// Row adds a row of strings, integers and floats to the current table
+	Row(values ...interface{}) error
+	// Close finishes the report, the underlying writer is left open
+	Close() error
+}
+
+var ErrNoTable = errors.New("report: a row was added before any table")
+
+// CSV writes a table as comma separated values, with its columns as the header
+type CSV struct {
+	w      *csv.Writer
+	tables int
+}
+
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{w: csv.NewWriter(w)}
+}
+
+// Table writes the header; a CSV file has one table so there can be no other
+func (c *CSV) Table(name string, columns ...string) error {
+	if c.tables > 0 {
+		return errors.New("report: CSV holds a single table")
+	}
+	c.tables++
+	return c.w.Write(columns)
+}
+
+func (c *CSV) Row(values ...interface{}) error {
+	if c.tables == 0 {
+		return ErrNoTable
+	}
+	record := make([]string, len(values))
+	for idx, value := range values {
+		record[idx] = cell(value)
+		// Spreadsheets run text starting like a formula as one
+		if _, ok := value.(string); ok && record[idx] != "" && strings.ContainsRune("=+-@", rune(record[idx][0])) {
+			record[idx] = "'" + record[idx]
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *CSV) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+/*
+XLSX writes an Office Open XML workbook. Every table is a worksheet with its
+columns in the first row. Numbers are written as numbers and everything else
+as text; there are no styles.
+*/
+type XLSX struct {
+	zw     *zip.Writer
+	sheet  *bufio.Writer
+	names  []string
+	row    int
+	closed bool
+}
+
+func NewXLSX(w io.Writer) *XLSX {
+	return &XLSX{zw: zip.NewWriter(w)}
+}
+
+func (x *XLSX) Table(name string, columns ...string) error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	name = sheetName(name, len(x.names)+1)
+	for _, existing := range x.names {
+		if strings.EqualFold(existing, name) {
+			return fmt.Errorf("report: two sheets are called %q", name)
+		}
+	}
+	x.names = append(x.names, name)
+	file, err := x.zw.Create("xl/worksheets/sheet" + strconv.Itoa(len(x.names)) + ".xml")
+	if err != nil {
+		return err
+	}
+	x.sheet = bufio.NewWriter(file)
+	x.row = 0
+	x.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	values := make([]interface{}, len(columns))
+	for idx, column := range columns {
+		values[idx] = column
+	}
+	return x.Row(values...)
+}
+
+func (x *XLSX) Row(values ...interface{}) error {
+	if x.sheet == nil {
+		return ErrNoTable
+	}
+	x.row++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.row)
+	for idx, value := range values {
+		ref := column(idx) + strconv.Itoa(x.row)
+		switch value.(type) {
+		case int, int64, float64:
+			fmt.Fprintf(x.sheet, `<c r="%s"><v>%s</v></c>`, ref, cell(value))
+		default:
+			fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(x.sheet, []byte(cell(value)))
+			x.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (x *XLSX) endSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	x.sheet.WriteString(`</sheetData></worksheet>`)
+	err := x.sheet.Flush()
+	x.sheet = nil
+	return err
+}
+
+// Close writes the parts that list the sheets, which are only known at the end
+func (x *XLSX) Close() error {
+	if x.closed {
+		return nil
+	}
+	x.closed = true
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	if len(x.names) == 0 {
+		// A workbook needs a sheet
+		if err := x.Table("Sheet1"); err != nil {
+			return err
+		}
+		if err := x.endSheet(); err != nil {
+			return err
+		}
+	}
+	var types, workbook, rels strings.Builder
+	types.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for idx, name := range x.names {
+		n := strconv.Itoa(idx + 1)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%s.xml" `+
+			`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		fmt.Fprintf(&workbook, `" sheetId="%s" r:id="rId%s"/>`, n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%s" `+
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%s.xml"/>`, n, n)
+	}
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" ` +
+			`Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+	}
+	for _, part := range parts {
+		file, err := x.zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+	return x.zw.Close()
+}
+
+// cell formats a value the way it is written into a cell
+func cell(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// column returns the letters of the column at idx, A for 0, Z for 25, AA for 26
+func column(idx int) string {
+	var letters []byte
+	for idx++; idx > 0; idx = (idx - 1) / 26 {
+		letters = append([]byte{byte('A' + (idx-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+// sheetName makes name one Excel takes: without []:*?/\, not empty and at most 31 characters
+func sheetName(name string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet" + strconv.Itoa(n)
+	}
+	if runes := []rune(name); len(runes) > maxSheetName {
+		name = string(runes[:maxSheetName])
+	}
+	return name
+}
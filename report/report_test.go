@@ -0,0 +1,76 @@
+package report
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSV(&buf)
+	if err := w.Row("early"); err != ErrNoTable {
+		t.Errorf("Row before Table = %v; want ErrNoTable", err)
+	}
+	w.Table("rooms", "class", "occupied", "percentage")
+	w.Row("A104", 12, 37.5)
+	w.Row("=HYPERLINK(\"x\")", int64(0), 0.0)
+	if err := w.Table("slots", "slot"); err == nil {
+		t.Error("a second table in a CSV was accepted")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "class,occupied,percentage\nA104,12,37.5\n\"'=HYPERLINK(\"\"x\"\")\",0,0\n"
+	if buf.String() != want {
+		t.Errorf("CSV = %q; want %q", buf.String(), want)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewXLSX(&buf)
+	w.Table("rooms", "class", "occupied")
+	w.Row("A104 <lab>", 12)
+	w.Table("peak/hours", "slot")
+	w.Row(3)
+	if err := w.Table("Rooms", "class"); err == nil {
+		t.Error("two sheets named alike were accepted")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("the workbook is not a zip: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, file := range archive.File {
+		content, _ := file.Open()
+		data, _ := ioutil.ReadAll(content)
+		parts[file.Name] = string(data)
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels",
+		"xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("the workbook has no %s", name)
+		}
+	}
+	if sheet := parts["xl/worksheets/sheet1.xml"]; !strings.Contains(sheet, `<c r="A2" t="inlineStr"><is><t xml:space="preserve">A104 &lt;lab&gt;</t></is></c><c r="B2"><v>12</v></c>`) {
+		t.Errorf("sheet1 = %s; want A104 <lab> as text and 12 as a number", sheet)
+	}
+	if workbook := parts["xl/workbook.xml"]; !strings.Contains(workbook, `<sheet name="rooms" sheetId="1" r:id="rId1"/><sheet name="peak_hours" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("workbook = %s; want the sheets rooms and peak_hours", workbook)
+	}
+}
+
+func TestColumn(t *testing.T) {
+	for idx, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := column(idx); got != want {
+			t.Errorf("column(%d) = %s; want %s", idx, got, want)
+		}
+	}
+}
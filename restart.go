@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Zero-downtime restarts. On restartSignals the server starts its successor, the
+binary at the same path (which a deploy has just replaced) with the same
+arguments, and hands it the listening sockets, so connections keep being
+accepted throughout. Once the successor says it is serving, this process
+drains like on SIGTERM; when it fails to start, this one carries on.
+*/
+
+const (
+	// Addresses of the inherited listeners, in the order of their descriptors from 3
+	listenersEnv = "CORA_LISTENERS"
+	// Descriptor the successor writes to once it is serving
+	readyFDEnv = "CORA_READY_FD"
+	// How long a successor gets to start serving
+	restartTimeout = 30 * time.Second
+)
+
+type openListener struct {
+	addr     string
+	listener net.Listener
+}
+
+var listeners struct {
+	sync.Mutex
+	// Handed over by the predecessor and not claimed by listen yet
+	inherited map[string]net.Listener
+	open      []openListener
+}
+
+func inheritListeners() {
+	listeners.inherited = make(map[string]net.Listener)
+	addrs := os.Getenv(listenersEnv)
+	if addrs == "" {
+		return
+	}
+	for idx, addr := range strings.Split(addrs, ",") {
+		file := os.NewFile(uintptr(3+idx), addr)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			log.Println("Not taking over", addr+":", err)
+			continue
+		}
+		listeners.inherited[addr] = listener
+	}
+}
+
+// listen takes over the listener on addr from the predecessor, or else opens it
+func listen(addr string) (net.Listener, error) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	if listeners.inherited == nil {
+		inheritListeners()
+	}
+	listener, ok := listeners.inherited[addr]
+	if ok {
+		delete(listeners.inherited, addr)
+		log.Println("Took over the listener on", addr)
+	} else {
+		var err error
+		listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	listeners.open = append(listeners.open, openListener{addr: addr, listener: listener})
+	return listener, nil
+}
+
+/*
+notifyReady tells the predecessor, if any, that this process is serving so it
+can drain. Listeners it handed over that are no longer configured are closed.
+*/
+func notifyReady() {
+	listeners.Lock()
+	for addr, listener := range listeners.inherited {
+		log.Println("Closing the listener on", addr, "no longer configured")
+		listener.Close()
+	}
+	listeners.inherited = nil
+	listeners.Unlock()
+	fd, err := strconv.Atoi(os.Getenv(readyFDEnv))
+	if err != nil {
+		return
+	}
+	ready := os.NewFile(uintptr(fd), "ready")
+	defer ready.Close()
+	_, err = ready.Write([]byte{1})
+	if err != nil {
+		log.Println("Error telling the previous process we are ready:", err)
+	}
+}
+
+/*
+startSuccessor starts the next process with this one's listeners and waits up
+to restartTimeout for it to serve. A successor that did not make it in time is
+killed.
+*/
+func startSuccessor() error {
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	listeners.Lock()
+	var files []*os.File
+	var addrs []string
+	for _, open := range listeners.open {
+		filer, ok := open.listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		file, err := filer.File()
+		if err != nil {
+			listeners.Unlock()
+			return fmt.Errorf("handing over %s: %v", open.addr, err)
+		}
+		defer file.Close()
+		files = append(files, file)
+		addrs = append(addrs, open.addr)
+	}
+	listeners.Unlock()
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyRead.Close()
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyWrite)
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, listenersEnv+"=") && !strings.HasPrefix(env, readyFDEnv+"=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Env = append(cmd.Env, listenersEnv+"="+strings.Join(addrs, ","), readyFDEnv+"="+strconv.Itoa(3+len(files)))
+	err = cmd.Start()
+	readyWrite.Close()
+	if err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	// Fails at once if the successor exits, since no one else can write
+	readyRead.SetReadDeadline(time.Now().Add(restartTimeout))
+	_, err = readyRead.Read(make([]byte, 1))
+	if err != nil {
+		cmd.Process.Kill()
+		return fmt.Errorf("successor %d did not start serving: %v", cmd.Process.Pid, err)
+	}
+	log.Println("Successor", cmd.Process.Pid, "is serving")
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals that start a successor and hand the listeners over, see startSuccessor
+var restartSignals = []os.Signal{syscall.SIGUSR2}
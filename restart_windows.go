@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// Listeners can't be handed over on Windows, so there is no restart signal
+var restartSignals []os.Signal
@@ -0,0 +1,297 @@
+/*
+Package router is a small HTTP request router. Compared to http.ServeMux it
+adds path parameters ("/db/booking/{id}"), a trailing catch-all
+("/static/{path...}"), per method routes with proper 405 responses, and groups
+of routes that share a prefix and middleware.
+
+When several patterns match a path the most specific one wins: at the first
+segment where they differ a literal beats a parameter, which beats a
+catch-all.
+*/
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Middleware wraps a handler, e.g. to check authentication
+type Middleware func(http.Handler) http.Handler
+
+type segment struct {
+	literal  string
+	param    string
+	catchAll bool
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []segment
+	handler  http.Handler
+}
+
+// rank orders segments by how specific they are, literals first
+func (s segment) rank() int {
+	switch {
+	case s.catchAll:
+		return 2
+	case s.param != "":
+		return 1
+	}
+	return 0
+}
+
+type table struct {
+	routes           []*route
+	NotFound         http.Handler
+	MethodNotAllowed http.Handler
+}
+
+type Router struct {
+	table      *table
+	prefix     string
+	middleware []Middleware
+}
+
+func New() *Router {
+	return &Router{table: &table{}}
+}
+
+// Use adds middleware to the routes registered on r (and its groups) after this call
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+/*
+Group returns a router whose routes are prefixed with prefix and wrapped in
+the middleware of r plus whatever is added to the group with Use.
+*/
+func (r *Router) Group(prefix string) *Router {
+	middleware := make([]Middleware, len(r.middleware))
+	copy(middleware, r.middleware)
+	return &Router{table: r.table, prefix: r.prefix + prefix, middleware: middleware}
+}
+
+// Route is Group with the routes declared in fn, to keep them visually together
+func (r *Router) Route(prefix string, fn func(*Router)) {
+	fn(r.Group(prefix))
+}
+
+// With returns a group without a prefix that adds middleware to the routes declared on it
+func (r *Router) With(middleware ...Middleware) *Router {
+	g := r.Group("")
+	g.Use(middleware...)
+	return g
+}
+
+func (r *Router) Handle(method string, pattern string, handler http.Handler) {
+	pattern = r.prefix + pattern
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+	rt := &route{method: method, pattern: pattern, segments: parse(pattern), handler: handler}
+	for _, existing := range r.table.routes {
+		if existing.method == method && existing.pattern == pattern {
+			panic("router: duplicate route " + method + " " + pattern)
+		}
+	}
+	r.table.routes = append(r.table.routes, rt)
+	// Keep the most specific routes first so the first match is the best one
+	sort.SliceStable(r.table.routes, func(i, j int) bool {
+		return moreSpecific(r.table.routes[i].segments, r.table.routes[j].segments)
+	})
+}
+
+func (r *Router) HandleFunc(method string, pattern string, handler http.HandlerFunc) {
+	r.Handle(method, pattern, handler)
+}
+
+func (r *Router) Get(pattern string, handler http.HandlerFunc) {
+	r.Handle(http.MethodGet, pattern, handler)
+}
+
+func (r *Router) Post(pattern string, handler http.HandlerFunc) {
+	r.Handle(http.MethodPost, pattern, handler)
+}
+
+func (r *Router) Put(pattern string, handler http.HandlerFunc) {
+	r.Handle(http.MethodPut, pattern, handler)
+}
+
+func (r *Router) Patch(pattern string, handler http.HandlerFunc) {
+	r.Handle(http.MethodPatch, pattern, handler)
+}
+
+func (r *Router) Delete(pattern string, handler http.HandlerFunc) {
+	r.Handle(http.MethodDelete, pattern, handler)
+}
+
+// NotFound replaces http.NotFound for paths no route matches
+func (r *Router) NotFound(handler http.Handler) {
+	r.table.NotFound = handler
+}
+
+func parse(pattern string) []segment {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := make([]segment, 0, len(parts))
+	for idx, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name := part[1 : len(part)-1]
+			if strings.HasSuffix(name, "...") {
+				if idx != len(parts)-1 {
+					panic("router: catch-all must be the last segment in " + pattern)
+				}
+				segments = append(segments, segment{param: strings.TrimSuffix(name, "..."), catchAll: true})
+				continue
+			}
+			segments = append(segments, segment{param: name})
+			continue
+		}
+		segments = append(segments, segment{literal: part})
+	}
+	return segments
+}
+
+func moreSpecific(a []segment, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].rank() != b[i].rank() {
+			return a[i].rank() < b[i].rank()
+		}
+	}
+	return len(a) > len(b)
+}
+
+// match returns the path parameters if path matches the route
+func (rt *route) match(parts []string) (map[string]string, bool) {
+	var params map[string]string
+	for idx, seg := range rt.segments {
+		if seg.catchAll {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg.param] = strings.Join(parts[idx:], "/")
+			return params, true
+		}
+		if idx >= len(parts) {
+			return nil, false
+		}
+		if seg.param != "" {
+			if parts[idx] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg.param] = parts[idx]
+			continue
+		}
+		if seg.literal != parts[idx] {
+			return nil, false
+		}
+	}
+	return params, len(parts) == len(rt.segments)
+}
+
+type matchKey struct{}
+
+// The route a request was matched to, kept in its context
+type match struct {
+	pattern string
+	params  map[string]string
+}
+
+// Param returns the value of the path parameter name, or "" if the route has none
+func Param(r *http.Request, name string) string {
+	m, _ := r.Context().Value(matchKey{}).(*match)
+	if m == nil {
+		return ""
+	}
+	return m.params[name]
+}
+
+/*
+SetParam changes the value of the path parameter name for whatever handles r
+next, for a middleware normalizing it. It does nothing when the route has no
+such parameter.
+*/
+func SetParam(r *http.Request, name string, value string) {
+	m, _ := r.Context().Value(matchKey{}).(*match)
+	if m == nil {
+		return
+	}
+	if _, ok := m.params[name]; ok {
+		m.params[name] = value
+	}
+}
+
+// Pattern returns the full pattern of the route serving r, like "/db/booking/{id}", or "" outside of one
+func Pattern(r *http.Request) string {
+	m, _ := r.Context().Value(matchKey{}).(*match)
+	if m == nil {
+		return ""
+	}
+	return m.pattern
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.URL.Path
+	if req.URL.RawPath != "" {
+		path = req.URL.RawPath
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if req.URL.RawPath != "" {
+		for idx, part := range parts {
+			parts[idx] = unescape(part)
+		}
+	}
+	var allowed []string
+	for _, rt := range r.table.routes {
+		params, ok := rt.match(parts)
+		if !ok {
+			continue
+		}
+		if rt.method != req.Method && !(rt.method == http.MethodGet && req.Method == http.MethodHead) {
+			if !containsString(allowed, rt.method) {
+				allowed = append(allowed, rt.method)
+			}
+			continue
+		}
+		req = req.WithContext(context.WithValue(req.Context(), matchKey{}, &match{pattern: rt.pattern, params: params}))
+		rt.handler.ServeHTTP(w, req)
+		return
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.table.MethodNotAllowed != nil {
+			r.table.MethodNotAllowed.ServeHTTP(w, req)
+			return
+		}
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.table.NotFound != nil {
+		r.table.NotFound.ServeHTTP(w, req)
+		return
+	}
+	http.NotFound(w, req)
+}
+
+func unescape(s string) string {
+	if u, err := url.PathUnescape(s); err == nil {
+		return u
+	}
+	return s
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
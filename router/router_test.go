@@ -0,0 +1,136 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}
+}
+
+func serve(r *Router, method string, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestRouting(t *testing.T) {
+	r := New()
+	r.Get("/db/booking", respond("list"))
+	r.Get("/db/booking/{id}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("get " + Param(req, "id")))
+	})
+	r.Get("/db/booking/mine", respond("mine"))
+	r.Delete("/db/booking/{id}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("delete " + Param(req, "id")))
+	})
+	r.Get("/static/{path...}", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("static " + Param(req, "path")))
+	})
+
+	cases := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/db/booking", 200, "list"},
+		{"GET", "/db/booking/", 200, "list"},
+		{"GET", "/db/booking/42", 200, "get 42"},
+		{"GET", "/db/booking/mine", 200, "mine"},
+		{"DELETE", "/db/booking/42", 200, "delete 42"},
+		{"HEAD", "/db/booking/42", 200, ""},
+		{"GET", "/static/css/app.css", 200, "static css/app.css"},
+		{"GET", "/static", 200, "static "},
+		{"GET", "/db/booking/42/extra", 404, ""},
+		{"GET", "/nothing", 404, ""},
+		{"POST", "/db/booking/42", 405, ""},
+		{"GET", "/db/booking/a%2Fb", 200, "get a/b"},
+	}
+	for _, c := range cases {
+		rec := serve(r, c.method, c.path)
+		if rec.Code != c.status {
+			t.Errorf("%s %s status = %d; want %d", c.method, c.path, rec.Code, c.status)
+			continue
+		}
+		if c.status == 200 && c.method != "HEAD" && rec.Body.String() != c.body {
+			t.Errorf("%s %s body = %q; want %q", c.method, c.path, rec.Body.String(), c.body)
+		}
+	}
+	if allow := serve(r, "POST", "/db/booking/42").Header().Get("Allow"); allow != "GET, DELETE" {
+		t.Errorf("Allow = %q; want \"GET, DELETE\"", allow)
+	}
+}
+
+func TestGroupMiddleware(t *testing.T) {
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(name + " "))
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	r := New()
+	r.Use(tag("root"))
+	r.Route("/admin", func(admin *Router) {
+		admin.Use(tag("admin"))
+		admin.Get("/keys", respond("keys"))
+		admin.With(tag("extra")).Get("/keys/{id}", respond("key"))
+	})
+	r.Get("/public", respond("public"))
+
+	cases := map[string]string{
+		"/admin/keys":   "root admin keys",
+		"/admin/keys/1": "root admin extra key",
+		"/public":       "root public",
+	}
+	for path, want := range cases {
+		if got := serve(r, "GET", path).Body.String(); got != want {
+			t.Errorf("GET %s body = %q; want %q", path, got, want)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	pattern := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Pattern(r)))
+	}
+	r := New()
+	r.Route("/db", func(db *Router) {
+		db.Get("/booking/{id}", pattern)
+	})
+	r.Get("/static/{path...}", pattern)
+
+	cases := map[string]string{
+		"/db/booking/42":    "/db/booking/{id}",
+		"/static/css/a.css": "/static/{path...}",
+	}
+	for path, want := range cases {
+		if got := serve(r, "GET", path).Body.String(); got != want {
+			t.Errorf("Pattern of %s = %q; want %q", path, got, want)
+		}
+	}
+}
+
+func TestSetParam(t *testing.T) {
+	upper := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			SetParam(r, "class", strings.ToUpper(Param(r, "class")))
+			SetParam(r, "slot", "1")
+			next.ServeHTTP(w, r)
+		})
+	}
+	r := New()
+	r.Use(upper)
+	r.Get("/rooms/{class}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Param(r, "class") + Param(r, "slot")))
+	})
+	if got := serve(r, "GET", "/rooms/ab101").Body.String(); got != "AB101" {
+		t.Errorf("class after SetParam = %q; want AB101 and no slot", got)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Package rpcserver serves the Timetable gRPC service of proto/cora.proto for
+other campus backends. It answers from the same db.Repository as the HTTP
+handlers and takes the same API keys, sent in the x-api-key metadata, with
+the scope noted on each call in the proto file.
+*/
+package rpcserver
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/deebakkarthi/coraserver/api"
+	"github.com/deebakkarthi/coraserver/calendar"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/proto/corapb"
+)
+
+const apiKeyMetadata = "x-api-key"
+
+// Scope each method needs, keyed by its full name
+var methodScopes = map[string]string{
+	corapb.Timetable_FreeClasses_FullMethodName:  api.ScopeFreeClassRead,
+	corapb.Timetable_FreeSlots_FullMethodName:    api.ScopeFreeClassRead,
+	corapb.Timetable_DayTimetable_FullMethodName: api.ScopeTimetableRead,
+	corapb.Timetable_ListSlots_FullMethodName:    api.ScopeTimetableRead,
+	corapb.Timetable_ListClasses_FullMethodName:  api.ScopeTimetableRead,
+	corapb.Timetable_ListSubjects_FullMethodName: api.ScopeTimetableRead,
+}
+
+// Authenticator checks API keys; *api.Server is one
+type Authenticator interface {
+	AuthenticateAPIKey(header string, scope string) (db.APIKey, error)
+}
+
+type timetableServer struct {
+	corapb.UnimplementedTimetableServer
+	repo     db.Repository
+	location *time.Location
+}
+
+/*
+New returns a gRPC server with the Timetable service registered, ready to
+Serve. location is the institution's time zone, for timestamps sent as dates.
+*/
+func New(repo db.Repository, auth Authenticator, location *time.Location) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(authInterceptor(auth)))
+	corapb.RegisterTimetableServer(server, &timetableServer{repo: repo, location: location})
+	return server
+}
+
+func authInterceptor(auth Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		scope, ok := methodScopes[info.FullMethod]
+		if !ok {
+			return nil, status.Error(codes.PermissionDenied, "no scope grants "+info.FullMethod)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		keys := md.Get(apiKeyMetadata)
+		if len(keys) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "missing "+apiKeyMetadata+" metadata")
+		}
+		_, err := auth.AuthenticateAPIKey(keys[0], scope)
+		if rateLimitErr, ok := err.(*api.RateLimitError); ok {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %v", rateLimitErr.Wait.Round(time.Second))
+		}
+		switch err {
+		case nil:
+		case api.ErrInvalidAPIKey:
+			return nil, status.Error(codes.Unauthenticated, "invalid API key")
+		case api.ErrAPIKeyScope:
+			return nil, status.Error(codes.PermissionDenied, "API key lacks the "+scope+" scope")
+		default:
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (t *timetableServer) parseDate(value string) (time.Time, error) {
+	date, err := calendar.ParseDate(value, t.location)
+	if err != nil {
+		return date, status.Error(codes.InvalidArgument, "invalid date "+value+", expected 2006-01-02 or an RFC 3339 timestamp")
+	}
+	return date, nil
+}
+
+func int32s(values []int) []int32 {
+	converted := make([]int32, len(values))
+	for idx, value := range values {
+		converted[idx] = int32(value)
+	}
+	return converted
+}
+
+func (t *timetableServer) FreeClasses(ctx context.Context, req *corapb.FreeClassesRequest) (*corapb.FreeClassesResponse, error) {
+	date, err := t.parseDate(req.Date)
+	if err != nil {
+		return nil, err
+	}
+	startSlot, endSlot := int(req.StartSlot), int(req.EndSlot)
+	if endSlot == 0 {
+		endSlot = startSlot
+	}
+	if startSlot < 1 || endSlot < startSlot {
+		return nil, status.Error(codes.InvalidArgument, "invalid slot range")
+	}
+	var classes []string
+	if startSlot == endSlot {
+		classes = t.repo.GetFreeClass(startSlot, date)
+	} else {
+		classes = t.repo.MultiFreeSlot(startSlot, endSlot, date)
+	}
+	return &corapb.FreeClassesResponse{Classes: classes}, nil
+}
+
+func (t *timetableServer) FreeSlots(ctx context.Context, req *corapb.FreeSlotsRequest) (*corapb.FreeSlotsResponse, error) {
+	date, err := t.parseDate(req.Date)
+	if err != nil {
+		return nil, err
+	}
+	return &corapb.FreeSlotsResponse{Slots: int32s(t.repo.GetFreeSlot(req.Class, date))}, nil
+}
+
+// The subjects of GetTimetableByDay come in slot order, one for each slot
+func (t *timetableServer) DayTimetable(ctx context.Context, req *corapb.DayTimetableRequest) (*corapb.DayTimetableResponse, error) {
+	date, err := t.parseDate(req.Date)
+	if err != nil {
+		return nil, err
+	}
+	subjects := t.repo.GetTimetableByDay(req.Class, date)
+	slots := t.repo.GetAllSlot()
+	response := &corapb.DayTimetableResponse{}
+	for idx, subject := range subjects {
+		if idx < len(slots) {
+			response.Periods = append(response.Periods, &corapb.Period{Slot: int32(slots[idx]), Subject: subject})
+		}
+	}
+	return response, nil
+}
+
+func (t *timetableServer) ListSlots(ctx context.Context, req *corapb.ListSlotsRequest) (*corapb.ListSlotsResponse, error) {
+	return &corapb.ListSlotsResponse{Slots: int32s(t.repo.GetAllSlot())}, nil
+}
+
+func (t *timetableServer) ListClasses(ctx context.Context, req *corapb.ListClassesRequest) (*corapb.ListClassesResponse, error) {
+	return &corapb.ListClassesResponse{Classes: t.repo.GetAllClass()}, nil
+}
+
+func (t *timetableServer) ListSubjects(ctx context.Context, req *corapb.ListSubjectsRequest) (*corapb.ListSubjectsResponse, error) {
+	return &corapb.ListSubjectsResponse{Subjects: t.repo.GetAllSubject()}, nil
+}
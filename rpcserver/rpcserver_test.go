@@ -0,0 +1,96 @@
+package rpcserver
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/deebakkarthi/coraserver/api"
+	"github.com/deebakkarthi/coraserver/db"
+	"github.com/deebakkarthi/coraserver/proto/corapb"
+)
+
+// Knows one key, "good", which only has freeclass:read
+type fakeAuth struct{}
+
+func (fakeAuth) AuthenticateAPIKey(header string, scope string) (db.APIKey, error) {
+	if header != "good" {
+		return db.APIKey{}, api.ErrInvalidAPIKey
+	}
+	if scope != api.ScopeFreeClassRead {
+		return db.APIKey{}, api.ErrAPIKeyScope
+	}
+	return db.APIKey{ID: "good"}, nil
+}
+
+func newClient(t *testing.T) corapb.TimetableClient {
+	repo := db.NewMemory()
+	repo.AddStatic("A104", "TUE", 1, "FREE")
+	repo.AddStatic("A104", "TUE", 2, "FREE")
+	repo.AddStatic("B201", "TUE", 1, "FREE")
+	repo.AddStatic("B201", "TUE", 2, "19CSE302")
+
+	listener := bufconn.Listen(1 << 20)
+	server := New(repo, fakeAuth{}, time.UTC)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return corapb.NewTimetableClient(conn)
+}
+
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), apiKeyMetadata, key)
+}
+
+func TestFreeClasses(t *testing.T) {
+	client := newClient(t)
+
+	// 2023-06-13 is a Tuesday
+	resp, err := client.FreeClasses(withKey("good"), &corapb.FreeClassesRequest{Date: "2023-06-13", StartSlot: 1, EndSlot: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"A104"}; !reflect.DeepEqual(resp.Classes, want) {
+		t.Errorf("FreeClasses = %v; want %v", resp.Classes, want)
+	}
+	_, err = client.FreeClasses(withKey("good"), &corapb.FreeClassesRequest{Date: "13-06-2023", StartSlot: 1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("bad date = %v; want InvalidArgument", err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	client := newClient(t)
+
+	cases := []struct {
+		ctx  context.Context
+		want codes.Code
+	}{
+		{context.Background(), codes.Unauthenticated},
+		{withKey("bad"), codes.Unauthenticated},
+		{withKey("good"), codes.PermissionDenied},
+	}
+	for _, c := range cases {
+		_, err := client.ListClasses(c.ctx, &corapb.ListClassesRequest{})
+		if status.Code(err) != c.want {
+			t.Errorf("ListClasses = %v; want %v", err, c.want)
+		}
+	}
+}
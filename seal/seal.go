@@ -0,0 +1,115 @@
+/*
+Package seal encrypts the secrets kept in the database, like the refresh tokens
+of sessions, with AES-256-GCM. A sealed value names the key it was sealed with,
+which lets keys be rotated: new values are sealed with the current key while
+older ones still open with theirs, until they are sealed again.
+
+	sealed:<key id>:<base64url of nonce and ciphertext>
+*/
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+const prefix = "sealed:"
+
+var (
+	// Returned by Open for a value sealed with a key the Keyring does not have
+	ErrUnknownKey = errors.New("seal: unknown key")
+	// Returned by Open for a value that was damaged or sealed with another key of the same ID
+	ErrCorrupt = errors.New("seal: corrupt value")
+)
+
+// Keyring seals with its current key and opens with any of its keys
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+/*
+NewKeyring makes a Keyring of keys, by ID, each 32 bytes in standard base64
+like `openssl rand -base64 32` prints. current is the ID of the key to seal
+with.
+*/
+func NewKeyring(current string, keys map[string]string) (*Keyring, error) {
+	k := &Keyring{current: current, aeads: make(map[string]cipher.AEAD)}
+	for id, encoded := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("seal: invalid key ID %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("seal: key %q is not 32 bytes in base64", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id], err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := k.aeads[current]; !ok {
+		return nil, fmt.Errorf("seal: no key %q to seal with", current)
+	}
+	return k, nil
+}
+
+// Seal encrypts plaintext with the current key
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	aead := k.aeads[k.current]
+	nonce, err := token.Read(aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + k.current + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a sealed value; anything else was stored before sealing and is returned as is
+func (k *Keyring) Open(value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	id, encoded := splitSealed(value)
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plaintext), nil
+}
+
+// Current tells whether value is sealed with the current key, so sealing it again changes nothing
+func (k *Keyring) Current(value string) bool {
+	if !strings.HasPrefix(value, prefix) {
+		return false
+	}
+	id, _ := splitSealed(value)
+	return id == k.current
+}
+
+func splitSealed(value string) (id string, encoded string) {
+	rest := strings.TrimPrefix(value, prefix)
+	sep := strings.Index(rest, ":")
+	if sep < 0 {
+		return "", ""
+	}
+	return rest[:sep], rest[sep+1:]
+}
@@ -0,0 +1,86 @@
+package seal
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	oldKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	newKey = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func keyring(t *testing.T, current string, keys map[string]string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(current, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestSealOpen(t *testing.T) {
+	k := keyring(t, "old", map[string]string{"old": oldKey})
+	sealed, err := k.Seal("refresh-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, "sealed:old:") || strings.Contains(sealed, "refresh-token") {
+		t.Fatalf("Seal = %q; want it sealed with old", sealed)
+	}
+	opened, err := k.Open(sealed)
+	if err != nil || opened != "refresh-token" {
+		t.Errorf("Open = %q, %v; want refresh-token", opened, err)
+	}
+	if again, _ := k.Seal("refresh-token"); again == sealed {
+		t.Errorf("sealing twice gave the same value")
+	}
+}
+
+func TestOpenPlain(t *testing.T) {
+	k := keyring(t, "old", map[string]string{"old": oldKey})
+	opened, err := k.Open("refresh-token")
+	if err != nil || opened != "refresh-token" {
+		t.Errorf("Open of a plain value = %q, %v; want it as is", opened, err)
+	}
+	if k.Current("refresh-token") {
+		t.Errorf("a plain value is current")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old := keyring(t, "old", map[string]string{"old": oldKey})
+	sealed, err := old.Seal("refresh-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := keyring(t, "new", map[string]string{"old": oldKey, "new": newKey})
+	if rotated.Current(sealed) {
+		t.Errorf("a value sealed with old is current after rotating to new")
+	}
+	opened, err := rotated.Open(sealed)
+	if err != nil || opened != "refresh-token" {
+		t.Errorf("Open after rotating = %q, %v; want refresh-token", opened, err)
+	}
+	dropped := keyring(t, "new", map[string]string{"new": newKey})
+	if _, err := dropped.Open(sealed); err != ErrUnknownKey {
+		t.Errorf("Open without the old key = %v; want ErrUnknownKey", err)
+	}
+	swapped := keyring(t, "old", map[string]string{"old": newKey})
+	if _, err := swapped.Open(sealed); err != ErrCorrupt {
+		t.Errorf("Open with another key of the same ID = %v; want ErrCorrupt", err)
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	cases := []map[string]string{
+		{"old": "c2hvcnQ="},
+		{"a:b": oldKey},
+		{"other": oldKey},
+	}
+	for _, keys := range cases {
+		if _, err := NewKeyring("old", keys); err == nil {
+			t.Errorf("NewKeyring(%v) succeeded; want an error", keys)
+		}
+	}
+}
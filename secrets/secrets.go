@@ -0,0 +1,176 @@
+/*
+Package secrets resolves the secret values of config.json. A value is either
+the secret itself or a reference to where it is kept:
+
+	env:CORA_CLIENT_SECRET                                   an environment variable
+	file:/run/secrets/client_secret                          a file, e.g. a mounted Kubernetes or Docker secret
+	keyvault:https://cora.vault.azure.net/secrets/clientSecret  an Azure Key Vault secret (latest version)
+
+Trailing newlines are stripped from files. Key Vault is reached with the
+service principal in AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET
+when those are set, otherwise with the managed identity of the VM or App
+Service.
+*/
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	keyVaultResource   = "https://vault.azure.net"
+	keyVaultAPIVersion = "7.4"
+	// Azure Instance Metadata Service, hands out managed identity tokens
+	imdsTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+/*
+Resolver turns references into secrets. The zero value works; its fields
+exist so tests can point Key Vault somewhere else.
+*/
+type Resolver struct {
+	HTTPClient *http.Client
+	// Defaults to the Azure credentials described in the package comment
+	TokenSource oauth2.TokenSource
+}
+
+var defaultResolver Resolver
+
+// Resolve is Resolver.Resolve with the default Resolver
+func Resolve(ctx context.Context, value string) (string, error) {
+	return defaultResolver.Resolve(ctx, value)
+}
+
+// Resolve returns the secret value refers to, or value itself when it is not a reference
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secrets: environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		content, err := ioutil.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("secrets: %v", err)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case strings.HasPrefix(value, "keyvault:"):
+		return r.keyVault(ctx, strings.TrimPrefix(value, "keyvault:"))
+	}
+	return value, nil
+}
+
+func (r *Resolver) httpClient() *http.Client {
+	if r.HTTPClient != nil {
+		return r.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (r *Resolver) tokenSource(ctx context.Context) oauth2.TokenSource {
+	if r.TokenSource != nil {
+		return r.TokenSource
+	}
+	tenant := os.Getenv("AZURE_TENANT_ID")
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant != "" && clientID != "" && clientSecret != "" {
+		config := clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     "https://login.microsoftonline.com/" + tenant + "/oauth2/v2.0/token",
+			Scopes:       []string{keyVaultResource + "/.default"},
+		}
+		return config.TokenSource(context.WithValue(ctx, oauth2.HTTPClient, r.httpClient()))
+	}
+	return &managedIdentity{ctx: ctx, client: r.httpClient(), clientID: clientID}
+}
+
+// secretURL is like https://cora.vault.azure.net/secrets/clientSecret, optionally followed by a version
+func (r *Resolver) keyVault(ctx context.Context, secretURL string) (string, error) {
+	u, err := url.Parse(secretURL)
+	if err != nil || u.Host == "" || !strings.HasPrefix(u.Path, "/secrets/") {
+		return "", fmt.Errorf("secrets: %q is not a Key Vault secret URL", secretURL)
+	}
+	token, err := r.tokenSource(ctx).Token()
+	if err != nil {
+		return "", fmt.Errorf("secrets: getting a Key Vault token: %v", err)
+	}
+	query := u.Query()
+	query.Set("api-version", keyVaultAPIVersion)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	token.SetAuthHeader(req)
+	resp, err := r.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secrets: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secrets: Key Vault answered %s for %s", resp.Status, secretURL)
+	}
+	var secret struct {
+		Value string `json:"value"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&secret)
+	if err != nil {
+		return "", fmt.Errorf("secrets: decoding %s: %v", secretURL, err)
+	}
+	return secret.Value, nil
+}
+
+// managedIdentity gets Key Vault tokens from the instance metadata service
+type managedIdentity struct {
+	ctx    context.Context
+	client *http.Client
+	// Picks a user assigned identity, empty for the system assigned one
+	clientID string
+}
+
+func (m *managedIdentity) Token() (*oauth2.Token, error) {
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {keyVaultResource}}
+	if m.clientID != "" {
+		query.Set("client_id", m.clientID)
+	}
+	req, err := http.NewRequest("GET", imdsTokenURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(m.ctx)
+	req.Header.Set("Metadata", "true")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("managed identity endpoint answered %s", resp.Status)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: token.AccessToken, TokenType: token.TokenType}, nil
+}
@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestResolve(t *testing.T) {
+	os.Setenv("CORA_TEST_SECRET", "from-env")
+	defer os.Unsetenv("CORA_TEST_SECRET")
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secret")
+	ioutil.WriteFile(path, []byte("from-file\n"), 0600)
+
+	cases := map[string]string{
+		"plain":                "plain",
+		"env:CORA_TEST_SECRET": "from-env",
+		"file:" + path:         "from-file",
+	}
+	for value, want := range cases {
+		got, err := Resolve(context.Background(), value)
+		if err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := Resolve(context.Background(), "env:CORA_TEST_UNSET"); err == nil {
+		t.Errorf("Resolve of an unset variable succeeded")
+	}
+}
+
+func TestKeyVault(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer vault-token" || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/secrets/clientSecret" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"value":"from-vault","id":"x"}`))
+	}))
+	defer ts.Close()
+
+	r := &Resolver{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "vault-token"})}
+	got, err := r.Resolve(context.Background(), "keyvault:"+ts.URL+"/secrets/clientSecret")
+	if err != nil || got != "from-vault" {
+		t.Errorf("Resolve(keyvault) = %q, %v; want \"from-vault\"", got, err)
+	}
+	if _, err := r.Resolve(context.Background(), "keyvault:"+ts.URL+"/secrets/missing"); err == nil {
+		t.Errorf("Resolve of a missing Key Vault secret succeeded")
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Package storage keeps the content of uploaded files. The API only knows the
+Store interface; which backend is behind it is decided by config.json:
+
+	{"backend": "local", "dir": "./attachments"}
+	{"backend": "s3", "bucket": "cora", "region": "ap-south-1", "accessKeyID": "...", "secretAccessKey": "..."}
+	{"backend": "azure", "containerURL": "https://cora.blob.core.windows.net/attachments?sv=...&sig=..."}
+
+S3 is reached with Signature Version 4, so any S3 compatible service (MinIO,
+Ceph) works by setting endpoint. Azure Blob Storage is reached with a SAS URL
+of the container allowing reads, writes and deletes.
+*/
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Get for keys that were never put or were deleted
+var ErrNotFound = errors.New("storage: no such object")
+
+/*
+Store keeps objects under keys made of letters, digits, dashes and
+underscores. Deleting a missing object is not an error.
+*/
+type Store interface {
+	Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// The layout of the storage block of config.json, see the package comment
+type Config struct {
+	// "local", "s3" or "azure"; local when empty
+	Backend string `json:"backend"`
+	// Local directory, ./attachments when empty
+	Dir string `json:"dir"`
+	// Defaults to https://s3.{region}.amazonaws.com
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	AccessKeyID     string `json:"accessKeyID"`
+	SecretAccessKey string `json:"secretAccessKey"`
+	ContainerURL    string `json:"containerURL"`
+}
+
+// New returns the Store config describes
+func New(config Config) (Store, error) {
+	switch config.Backend {
+	case "", "local":
+		dir := config.Dir
+		if dir == "" {
+			dir = "./attachments"
+		}
+		err := os.MkdirAll(dir, 0750)
+		if err != nil {
+			return nil, fmt.Errorf("storage: %v", err)
+		}
+		return Local{Dir: dir}, nil
+	case "s3":
+		if config.Bucket == "" || config.Region == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+			return nil, errors.New("storage: s3 needs bucket, region, accessKeyID and secretAccessKey")
+		}
+		return &S3{
+			Endpoint:        config.Endpoint,
+			Region:          config.Region,
+			Bucket:          config.Bucket,
+			AccessKeyID:     config.AccessKeyID,
+			SecretAccessKey: config.SecretAccessKey,
+		}, nil
+	case "azure":
+		if config.ContainerURL == "" {
+			return nil, errors.New("storage: azure needs containerURL")
+		}
+		return &AzureBlob{ContainerURL: config.ContainerURL}, nil
+	}
+	return nil, fmt.Errorf("storage: unknown backend %q", config.Backend)
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func defaultHTTPClient(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	return &http.Client{Timeout: 5 * time.Minute}
+}
+
+// Local keeps every object in a file named after its key in Dir
+type Local struct {
+	Dir string
+}
+
+func (l Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(l.Dir, key), nil
+}
+
+// Put writes to a temporary file first, so that a failed upload never leaves half an object behind
+func (l Local) Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(l.Dir, ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (l Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+func (l Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// AzureBlob keeps every object in a block blob named after its key in the container of ContainerURL
+type AzureBlob struct {
+	// Includes the SAS token, like https://cora.blob.core.windows.net/attachments?sv=...&sig=...
+	ContainerURL string
+	HTTPClient   *http.Client
+}
+
+func (a *AzureBlob) do(ctx context.Context, method string, key string, body io.Reader) (*http.Request, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("storage: invalid key %q", key)
+	}
+	base, query := a.ContainerURL, ""
+	if at := strings.Index(base, "?"); at >= 0 {
+		base, query = base[:at], base[at:]
+	}
+	return http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+"/"+key+query, body)
+}
+
+func (a *AzureBlob) Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error {
+	req, err := a.do(ctx, http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	resp, err := defaultHTTPClient(a.HTTPClient).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("storage: azure answered %s to the upload of %s", resp.Status, key)
+	}
+	return nil
+}
+
+func (a *AzureBlob) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := a.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := defaultHTTPClient(a.HTTPClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("storage: azure answered %s to the download of %s", resp.Status, key)
+}
+
+func (a *AzureBlob) Delete(ctx context.Context, key string) error {
+	req, err := a.do(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := defaultHTTPClient(a.HTTPClient).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("storage: azure answered %s to the deletion of %s", resp.Status, key)
+	}
+	return nil
+}
+
+// Memory keeps the objects in a map, for tests
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *Memory) Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.objects == nil {
+		m.objects = make(map[string][]byte)
+	}
+	m.objects[key] = data
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStore puts, reads back and deletes an object
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	err := store.Put(ctx, "abc123", strings.NewReader("hello"), 5, "text/plain")
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	content, err := store.Get(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, _ := ioutil.ReadAll(content)
+	content.Close()
+	if string(data) != "hello" {
+		t.Errorf("Get = %q, want \"hello\"", data)
+	}
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "abc123"); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+	if _, err := store.Get(ctx, "abc123"); err != ErrNotFound {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Errorf("Put of an invalid key succeeded")
+	}
+}
+
+// fakeBlobs serves objects from a map, answering with the statuses of the service it fakes
+type fakeBlobs struct {
+	mu      sync.Mutex
+	objects map[string]string
+	created int
+	deleted int
+	// Checks the request before it is served
+	check func(r *http.Request) bool
+}
+
+func (f *fakeBlobs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.check(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		f.objects[r.URL.Path] = string(data)
+		w.WriteHeader(f.created)
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(data))
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(f.deleted)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := New(Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeBlobs{objects: make(map[string]string), created: http.StatusOK, deleted: http.StatusNoContent}
+	fake.check = func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/cora/") &&
+			strings.HasPrefix(r.Header.Get("Authorization"),
+				"AWS4-HMAC-SHA256 Credential=AKID/20230613/ap-south-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") &&
+			r.Header.Get("x-amz-date") == "20230613T083000Z"
+	}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	store := &S3{
+		Endpoint:        ts.URL,
+		Region:          "ap-south-1",
+		Bucket:          "cora",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Now:             func() time.Time { return time.Date(2023, 6, 13, 14, 0, 0, 0, time.FixedZone("IST", 19800)) },
+	}
+	testStore(t, store)
+}
+
+func TestAzureBlob(t *testing.T) {
+	fake := &fakeBlobs{objects: make(map[string]string), created: http.StatusCreated, deleted: http.StatusAccepted}
+	fake.check = func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/attachments/") && r.URL.Query().Get("sig") == "sas" &&
+			(r.Method != http.MethodPut || r.Header.Get("x-ms-blob-type") == "BlockBlob")
+	}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	store, err := New(Config{Backend: "azure", ContainerURL: ts.URL + "/attachments?sv=2021-08-06&sig=sas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
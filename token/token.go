@@ -0,0 +1,56 @@
+/*
+Package token generates the secrets handed out to clients, like OAuth states,
+session IDs, API keys and check-in codes, from crypto/rand. Sizes are in bytes
+of randomness; the encoded strings are longer.
+*/
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// Bounds of the configurable sizes. The columns holding tokens fit MaxBytes hex encoded, with room for a tenant.
+const (
+	DefaultBytes = 32
+	MinBytes     = 16
+	MaxBytes     = 40
+)
+
+// Validate checks a configured size, 0 standing for DefaultBytes
+func Validate(size int) error {
+	if size != 0 && (size < MinBytes || size > MaxBytes) {
+		return fmt.Errorf("token size %d is not between %d and %d bytes", size, MinBytes, MaxBytes)
+	}
+	return nil
+}
+
+// Read returns size random bytes
+func Read(size int) ([]byte, error) {
+	buf := make([]byte, size)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Hex returns size random bytes hex encoded, 2*size characters
+func Hex(size int) (string, error) {
+	buf, err := Read(size)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// URLSafe returns size random bytes unpadded base64url encoded, safe in URLs and headers
+func URLSafe(size int) (string, error) {
+	buf, err := Read(size)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,42 @@
+package token
+
+import "testing"
+
+func TestLengths(t *testing.T) {
+	hex, err := Hex(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hex) != 32 {
+		t.Errorf("len(Hex(16)) = %d; want 32", len(hex))
+	}
+	urlSafe, err := URLSafe(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urlSafe) != 43 {
+		t.Errorf("len(URLSafe(32)) = %d; want 43", len(urlSafe))
+	}
+}
+
+func TestUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		token, err := Hex(MinBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[token] {
+			t.Fatalf("Hex(%d) repeated %s", MinBytes, token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for size, valid := range map[int]bool{0: true, MinBytes: true, MaxBytes: true, 8: false, 64: false} {
+		if err := Validate(size); (err == nil) != valid {
+			t.Errorf("Validate(%d) = %v; want valid %v", size, err, valid)
+		}
+	}
+}
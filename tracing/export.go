@@ -0,0 +1,269 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// OTLP/HTTP endpoint of a collector, like http://localhost:4318; spans are posted to its /v1/traces
+	Endpoint string `json:"endpoint"`
+	// Sent with every export, like an API key of a tracing vendor
+	Headers     map[string]string `json:"headers"`
+	ServiceName string            `json:"serviceName"`
+	// Share of the traces started here that are recorded, from 0 to 1; traces continued from a caller follow its choice
+	SampleRatio float64 `json:"sampleRatio"`
+}
+
+var DefaultConfig = Config{
+	ServiceName: "coraserver",
+	SampleRatio: 1,
+}
+
+const (
+	// Spans waiting for export; more are dropped until the exporter catches up
+	queueSize = 4096
+	// Most spans in one export
+	batchSize = 512
+	// Longest a span waits for its batch to fill up
+	batchDelay = 5 * time.Second
+)
+
+/*
+Tracer batches the spans that ended and posts them to the collector as OTLP
+JSON. Run does the posting; a failed export is logged and its spans are lost.
+*/
+type Tracer struct {
+	config Config
+	client *http.Client
+	queue  chan *Span
+
+	mu      sync.Mutex
+	dropped int
+	flush   chan chan struct{}
+}
+
+func New(config Config) *Tracer {
+	return &Tracer{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan *Span, queueSize),
+		flush:  make(chan chan struct{}),
+	}
+}
+
+func (t *Tracer) sample(traceID [16]byte) bool {
+	return traceRatio(traceID) < t.config.SampleRatio
+}
+
+func (t *Tracer) export(span *Span) {
+	select {
+	case t.queue <- span:
+	default:
+		t.mu.Lock()
+		t.dropped++
+		t.mu.Unlock()
+	}
+}
+
+// Run posts batches of spans until the program exits
+func (t *Tracer) Run() {
+	timer := time.NewTimer(batchDelay)
+	var batch []*Span
+	send := func() {
+		if len(batch) > 0 {
+			err := t.post(batch)
+			if err != nil {
+				log.Println("Error exporting", len(batch), "spans:", err)
+			}
+			batch = nil
+		}
+		t.mu.Lock()
+		if t.dropped > 0 {
+			log.Println("Span queue full, dropped", t.dropped, "spans")
+			t.dropped = 0
+		}
+		t.mu.Unlock()
+	}
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				send()
+			}
+		case <-timer.C:
+			send()
+			timer.Reset(batchDelay)
+		case done := <-t.flush:
+			for len(t.queue) > 0 {
+				batch = append(batch, <-t.queue)
+				if len(batch) >= batchSize {
+					send()
+				}
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+// Flush exports the spans that ended so far, waiting for Run to do it until ctx is done
+func (t *Tracer) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case t.flush <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func attribute(key string, value interface{}) otlpAttribute {
+	attr := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		attr.Value.StringValue = &v
+	case int:
+		s := strconv.Itoa(v)
+		attr.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		attr.Value.IntValue = &s
+	case float64:
+		attr.Value.DoubleValue = &v
+	case bool:
+		attr.Value.BoolValue = &v
+	default:
+		s := fmt.Sprint(v)
+		attr.Value.StringValue = &s
+	}
+	return attr
+}
+
+func encodeSpan(span *Span) otlpSpan {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	encoded := otlpSpan{
+		TraceID:           hex.EncodeToString(span.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(span.context.SpanID[:]),
+		Name:              span.name,
+		Kind:              span.kind,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+	}
+	if span.parent != [8]byte{} {
+		encoded.ParentSpanID = hex.EncodeToString(span.parent[:])
+	}
+	keys := make([]string, 0, len(span.attributes))
+	for key := range span.attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		encoded.Attributes = append(encoded.Attributes, attribute(key, span.attributes[key]))
+	}
+	if span.err != "" {
+		// STATUS_CODE_ERROR
+		encoded.Status = &otlpStatus{Code: 2, Message: span.err}
+	}
+	return encoded
+}
+
+func (t *Tracer) post(batch []*Span) error {
+	var scope otlpScopeSpans
+	scope.Scope.Name = "github.com/deebakkarthi/coraserver/tracing"
+	for _, span := range batch {
+		scope.Spans = append(scope.Spans, encodeSpan(span))
+	}
+	var resource otlpResourceSpans
+	resource.Resource.Attributes = []otlpAttribute{attribute("service.name", t.config.ServiceName)}
+	resource.ScopeSpans = []otlpScopeSpans{scope}
+	request := otlpRequest{ResourceSpans: []otlpResourceSpans{resource}}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(t.config.Endpoint, "/")+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.config.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+/*
+Package tracing records spans of the work behind a request, like the HTTP
+request itself, its database queries and its Graph calls, and sends them to an
+OpenTelemetry collector over OTLP/HTTP. Trace context travels in the W3C
+traceparent header, so a trace started by a client or a proxy continues here
+and on to the services called.
+
+Nothing is recorded until SetTracer is called; until then Start returns a nil
+*Span, whose methods do nothing.
+*/
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/deebakkarthi/coraserver/token"
+)
+
+// Kinds of spans, numbered as in OTLP
+type Kind int
+
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+	Client   Kind = 3
+)
+
+const traceparentHeader = "traceparent"
+
+// SpanContext identifies a span across processes, as carried by traceparent
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+func (sc SpanContext) valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Span is an operation being timed; End it when the operation is over
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  [8]byte
+	kind    Kind
+	start   time.Time
+
+	mu         sync.Mutex
+	name       string
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+var current atomic.Value
+
+// SetTracer makes Start record spans with tracer; nil turns tracing off again
+func SetTracer(tracer *Tracer) {
+	current.Store(&tracer)
+}
+
+func currentTracer() *Tracer {
+	tracer, _ := current.Load().(**Tracer)
+	if tracer == nil {
+		return nil
+	}
+	return *tracer
+}
+
+// Enabled tells whether spans are being recorded, to skip work only needed for them
+func Enabled() bool {
+	return currentTracer() != nil
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+// FromContext returns the span ctx is in, or nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+/*
+Start begins a span as a child of the span in ctx, or of the remote one
+Extract put there, or else a new trace. The returned context is in the new
+span.
+*/
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	tracer := currentTracer()
+	if tracer == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: tracer, kind: kind, start: time.Now(), name: name}
+	var parent SpanContext
+	if parentSpan := FromContext(ctx); parentSpan != nil {
+		parent = parentSpan.context
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = remote
+	}
+	if parent.valid() {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		id, err := token.Read(16)
+		if err != nil {
+			return ctx, nil
+		}
+		copy(span.context.TraceID[:], id)
+		span.context.Sampled = tracer.sample(span.context.TraceID)
+	}
+	id, err := token.Read(8)
+	if err != nil {
+		return ctx, nil
+	}
+	copy(span.context.SpanID[:], id)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetName renames the span, say once the route of a request is known
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetAttribute records a string, int, int64, float64 or bool about the operation
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]interface{})
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the operation as failed, when err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and queues it for export if its trace is sampled
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.context.Sampled {
+		s.tracer.export(s)
+	}
+}
+
+// Context returns the IDs of the span, for logs
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// Inject sets the traceparent header for a call made within the span in ctx
+func Inject(ctx context.Context, header http.Header) {
+	span := FromContext(ctx)
+	if span == nil {
+		return
+	}
+	flags := "00"
+	if span.context.Sampled {
+		flags = "01"
+	}
+	header.Set(traceparentHeader, "00-"+hex.EncodeToString(span.context.TraceID[:])+"-"+hex.EncodeToString(span.context.SpanID[:])+"-"+flags)
+}
+
+// Extract returns ctx with the caller's span from the traceparent header, if it sent a valid one
+func Extract(ctx context.Context, header http.Header) context.Context {
+	sc, err := parseTraceparent(header.Get(traceparentHeader))
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func parseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("tracing: invalid traceparent %q", value)
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 {
+		return sc, fmt.Errorf("tracing: invalid trace ID in %q", value)
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != 8 {
+		return sc, fmt.Errorf("tracing: invalid span ID in %q", value)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, fmt.Errorf("tracing: invalid flags in %q", value)
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.valid() {
+		return sc, fmt.Errorf("tracing: zero ID in %q", value)
+	}
+	return sc, nil
+}
+
+// traceRatio turns the random end of a trace ID into a number from 0 to 1
+func traceRatio(traceID [16]byte) float64 {
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11) / (1 << 53)
+}
+
+/*
+Transport records a client span for each request made through it and passes
+the trace on in traceparent. Base defaults to http.DefaultTransport.
+*/
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx, span := Start(req.Context(), req.Method+" "+req.URL.Host, Client)
+	if span == nil {
+		return base.RoundTrip(req)
+	}
+	defer span.End()
+	// The query may hold credentials, the path is enough to tell calls apart
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.SetError(fmt.Errorf("%s", resp.Status))
+	}
+	return resp, nil
+}
@@ -0,0 +1,148 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const callerTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+// collect starts a collector and a tracer exporting to it, returning the spans it got by name
+func collect(t *testing.T) (*Tracer, func() map[string]otlpSpan) {
+	var mu sync.Mutex
+	spans := make(map[string]otlpSpan)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("X-Api-Key") != "k" {
+			t.Errorf("export to %s with key %q", r.URL.Path, r.Header.Get("X-Api-Key"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var request otlpRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("invalid export %s: %v", body, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resource := range request.ResourceSpans {
+			for _, scope := range resource.ScopeSpans {
+				for _, span := range scope.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}))
+	t.Cleanup(collector.Close)
+	tracer := New(Config{Endpoint: collector.URL, Headers: map[string]string{"X-Api-Key": "k"}, ServiceName: "test", SampleRatio: 1})
+	go tracer.Run()
+	SetTracer(tracer)
+	t.Cleanup(func() { SetTracer(nil) })
+	return tracer, func() map[string]otlpSpan {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tracer.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return spans
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	ctx, span := Start(context.Background(), "request", Server)
+	if span != nil || FromContext(ctx) != nil {
+		t.Errorf("Start without a tracer = %v; want no span", span)
+	}
+	span.SetAttribute("k", "v")
+	span.End()
+}
+
+func TestTrace(t *testing.T) {
+	_, spans := collect(t)
+	var sent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+
+	header := http.Header{"Traceparent": {"00-" + callerTrace + "-00f067aa0ba902b7-01"}}
+	ctx, request := Start(Extract(context.Background(), header), "request", Server)
+	queryCtx, query := Start(ctx, "query", Client)
+	query.SetAttribute("db.rows", 3)
+	query.End()
+	client := &http.Client{Transport: &Transport{}}
+	req, _ := http.NewRequest("GET", downstream.URL+"/me?secret=x", nil)
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	request.End()
+
+	got := spans()
+	if len(got) != 3 {
+		t.Fatalf("exported %v; want 3 spans", got)
+	}
+	if got["request"].TraceID != callerTrace || got["request"].ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("request span = %+v; want it to continue the caller's trace", got["request"])
+	}
+	if got["query"].TraceID != callerTrace || got["query"].ParentSpanID != got["request"].SpanID {
+		t.Errorf("query span = %+v; want it under the request", got["query"])
+	}
+	if FromContext(queryCtx) != query {
+		t.Errorf("context of the query span is not in it")
+	}
+	outbound := got["GET "+strings.TrimPrefix(downstream.URL, "http://")]
+	if outbound.ParentSpanID != got["request"].SpanID {
+		t.Errorf("outbound span = %+v; want it under the request", outbound)
+	}
+	if sent != "00-"+callerTrace+"-"+outbound.SpanID+"-01" {
+		t.Errorf("sent traceparent %q; want the outbound span", sent)
+	}
+	for _, attr := range outbound.Attributes {
+		if attr.Value.StringValue != nil && strings.Contains(*attr.Value.StringValue, "secret") {
+			t.Errorf("outbound span records the query: %+v", attr)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	tracer, spans := collect(t)
+	tracer.config.SampleRatio = 0
+	_, root := Start(context.Background(), "dropped", Server)
+	root.End()
+	header := http.Header{"Traceparent": {"00-" + callerTrace + "-00f067aa0ba902b7-01"}}
+	_, continued := Start(Extract(context.Background(), header), "continued", Server)
+	continued.End()
+
+	got := spans()
+	if _, ok := got["dropped"]; ok {
+		t.Errorf("exported a trace with a sample ratio of 0")
+	}
+	if _, ok := got["continued"]; !ok {
+		t.Errorf("did not export a trace the caller sampled")
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	cases := map[string]bool{
+		"00-" + callerTrace + "-00f067aa0ba902b7-01":              true,
+		"00-" + callerTrace + "-00f067aa0ba902b7-01-extra":        false,
+		"01-" + callerTrace + "-00f067aa0ba902b7-00-extra":        true,
+		"ff-" + callerTrace + "-00f067aa0ba902b7-01":              false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": false,
+		"00-" + callerTrace + "-00f067aa0ba902-01":                false,
+		"": false,
+	}
+	for value, valid := range cases {
+		if _, err := parseTraceparent(value); (err == nil) != valid {
+			t.Errorf("parseTraceparent(%q) = %v; want valid %v", value, err, valid)
+		}
+	}
+}
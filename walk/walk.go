@@ -0,0 +1,124 @@
+/*
+Package walk estimates how long it takes to walk between the buildings of a
+campus. Buildings are places with optional coordinates, and paths between two
+of them take a known number of minutes. Between places with coordinates and
+no path, the walk is estimated from the straight line distance, while a path
+stands for what the straight line misses, like a river or a fence. The time
+between any two places is the quickest chain of paths and estimates.
+*/
+package walk
+
+import "math"
+
+const (
+	// Metres a person walks in a minute
+	Speed = 75.0
+	// How much longer walking paths are than the straight line, on average
+	Detour = 1.3
+	// Mean radius of the Earth, in metres
+	earthRadius = 6371000.0
+)
+
+type place struct {
+	located   bool
+	lat, long float64
+}
+
+/*
+A Map holds the places and paths walks are estimated over. The zero value is
+not usable, see NewMap. Maps are not safe for concurrent changes.
+*/
+type Map struct {
+	places map[string]place
+	paths  map[string]map[string]float64
+}
+
+func NewMap() *Map {
+	return &Map{places: make(map[string]place), paths: make(map[string]map[string]float64)}
+}
+
+// AddPlace adds the place id, at latitude lat and longitude long when located
+func (m *Map) AddPlace(id string, located bool, lat, long float64) {
+	m.places[id] = place{located: located, lat: lat, long: long}
+}
+
+// AddPath adds a path of minutes between from and to, both ways, adding the places when unknown
+func (m *Map) AddPath(from, to string, minutes int) {
+	for _, id := range []string{from, to} {
+		if _, ok := m.places[id]; !ok {
+			m.places[id] = place{}
+		}
+		if m.paths[id] == nil {
+			m.paths[id] = make(map[string]float64)
+		}
+	}
+	m.paths[from][to] = float64(minutes)
+	m.paths[to][from] = float64(minutes)
+}
+
+// Straight returns the straight line distance between two places, in metres, with false unless both are located
+func (m *Map) Straight(from, to string) (float64, bool) {
+	a, b := m.places[from], m.places[to]
+	if !a.located || !b.located {
+		return 0, false
+	}
+	lat1, lat2 := a.lat*math.Pi/180, b.lat*math.Pi/180
+	dLat, dLong := lat2-lat1, (b.long-a.long)*math.Pi/180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h)), true
+}
+
+// Returns the minutes of walking straight from one place to the other, with false unless both are located
+func (m *Map) estimate(from, to string) (float64, bool) {
+	metres, ok := m.Straight(from, to)
+	return metres * Detour / Speed, ok
+}
+
+/*
+Minutes returns the minutes it takes to walk from one place to the other,
+rounded up, with false when the map cannot tell. Walking within a place takes
+no time.
+*/
+func (m *Map) Minutes(from, to string) (int, bool) {
+	if from == to {
+		return 0, true
+	}
+	if _, ok := m.places[from]; !ok {
+		return 0, false
+	}
+	if _, ok := m.places[to]; !ok {
+		return 0, false
+	}
+	// Dijkstra's algorithm over the paths and the estimates; maps hold few enough places to scan them all
+	best := map[string]float64{from: 0}
+	done := make(map[string]bool)
+	for {
+		current, found := "", false
+		for id, minutes := range best {
+			if !done[id] && (!found || minutes < best[current]) {
+				current, found = id, true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		if current == to {
+			return int(math.Ceil(best[to] - 1e-9)), true
+		}
+		done[current] = true
+		for id := range m.places {
+			if done[id] {
+				continue
+			}
+			minutes, ok := m.paths[current][id]
+			if !ok {
+				minutes, ok = m.estimate(current, id)
+			}
+			if ok {
+				if known, seen := best[id]; !seen || best[current]+minutes < known {
+					best[id] = best[current] + minutes
+				}
+			}
+		}
+	}
+}
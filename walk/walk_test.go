@@ -0,0 +1,51 @@
+package walk
+
+import "testing"
+
+func TestMinutes(t *testing.T) {
+	m := NewMap()
+	// AB1 and AB2 are 300 m apart east to west, the library 150 m north of AB1
+	m.AddPlace("AB1", true, 10.9, 76.9)
+	m.AddPlace("AB2", true, 10.9, 76.9+300/(111320*0.98200))
+	m.AddPlace("LIB", true, 10.9+150/111195.0, 76.9)
+	m.AddPlace("HOSTEL", false, 0, 0)
+	m.AddPath("HOSTEL", "LIB", 4)
+	m.AddPath("AB1", "AB2", 12)
+
+	cases := []struct {
+		from, to string
+		want     int
+		ok       bool
+	}{
+		{"AB1", "AB1", 0, true},
+		{"AB1", "LIB", 3, true},
+		// The path across stands for a detour the straight line misses, so the walk goes round by the library
+		{"AB1", "AB2", 9, true},
+		{"HOSTEL", "AB1", 7, true},
+		{"AB1", "NOWHERE", 0, false},
+	}
+	for _, c := range cases {
+		got, ok := m.Minutes(c.from, c.to)
+		if got != c.want || ok != c.ok {
+			t.Errorf("Minutes(%q, %q) = %d, %v; want %d, %v", c.from, c.to, got, ok, c.want, c.ok)
+		}
+	}
+
+	m.AddPlace("FARM", false, 0, 0)
+	if _, ok := m.Minutes("AB1", "FARM"); ok {
+		t.Error("Minutes to a place without coordinates or paths = ok; want false")
+	}
+}
+
+func TestStraight(t *testing.T) {
+	m := NewMap()
+	m.AddPlace("A", true, 0, 0)
+	m.AddPlace("B", true, 1, 0)
+	m.AddPlace("C", false, 0, 0)
+	if metres, ok := m.Straight("A", "B"); !ok || metres < 111000 || metres > 111400 {
+		t.Errorf("Straight over a degree of latitude = %.0f, %v; want about 111195 m", metres, ok)
+	}
+	if _, ok := m.Straight("A", "C"); ok {
+		t.Error("Straight to a place without coordinates = ok; want false")
+	}
+}
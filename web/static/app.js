@@ -0,0 +1,115 @@
+"use strict";
+
+const pages = { "/": "finder", "/timetable": "timetable" };
+
+function show(path) {
+  const page = pages[path] || "finder";
+  for (const id of Object.values(pages)) {
+    document.getElementById(id).hidden = id !== page;
+  }
+  for (const a of document.querySelectorAll("a[data-link]")) {
+    a.classList.toggle("active", pages[a.getAttribute("href")] === page);
+  }
+}
+
+function showError(message) {
+  const el = document.getElementById("error");
+  el.textContent = message;
+  el.hidden = !message;
+}
+
+async function getJSON(url) {
+  const resp = await fetch(url, { headers: { Accept: "application/json" } });
+  if (!resp.ok) {
+    throw new Error((await resp.text()) || resp.statusText);
+  }
+  return (await resp.json()) || [];
+}
+
+function fill(select, values) {
+  select.replaceChildren(...values.map((v) => new Option(v, v)));
+}
+
+async function init() {
+  const today = new Date().toISOString().slice(0, 10);
+  for (const input of document.querySelectorAll("input[type=date]")) {
+    input.value = today;
+  }
+  try {
+    const [slots, classes] = await Promise.all([
+      getJSON("/db/getAllSlot"),
+      getJSON("/db/getAllClass"),
+    ]);
+    for (const select of document.querySelectorAll("select.slots")) {
+      fill(select, slots);
+    }
+    fill(document.getElementById("classes"), classes);
+  } catch (err) {
+    showError(err.message);
+  }
+}
+
+document.getElementById("finder-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  const params = new URLSearchParams(form);
+  const results = document.getElementById("finder-results");
+  try {
+    const classes = await getJSON("/db/multiFreeSlot?" + params);
+    showError("");
+    results.replaceChildren(...classes.map((c) => {
+      const li = document.createElement("li");
+      li.textContent = c;
+      return li;
+    }));
+    if (classes.length === 0) {
+      results.textContent = "No class is free for the whole range.";
+    }
+  } catch (err) {
+    showError(err.message);
+  }
+});
+
+document.getElementById("timetable-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const form = new FormData(e.target);
+  const params = new URLSearchParams(form);
+  const table = document.getElementById("timetable-results");
+  try {
+    const [subjects, slots] = await Promise.all([
+      getJSON("/db/daytimetable?" + params),
+      getJSON("/db/getAllSlot"),
+    ]);
+    showError("");
+    table.replaceChildren();
+    const header = table.createTHead().insertRow();
+    for (const name of ["Slot", "Subject"]) {
+      const th = document.createElement("th");
+      th.textContent = name;
+      header.appendChild(th);
+    }
+    const body = table.createTBody();
+    subjects.forEach((subject, i) => {
+      const row = body.insertRow();
+      row.insertCell().textContent = slots[i] !== undefined ? slots[i] : i + 1;
+      row.insertCell().textContent = subject === "FREE" ? "Free" : subject;
+    });
+  } catch (err) {
+    showError(err.message);
+  }
+});
+
+document.addEventListener("click", (e) => {
+  const a = e.target.closest("a[data-link]");
+  if (!a) {
+    return;
+  }
+  e.preventDefault();
+  history.pushState(null, "", a.getAttribute("href"));
+  show(location.pathname);
+});
+
+window.addEventListener("popstate", () => show(location.pathname));
+
+show(location.pathname);
+init();
@@ -0,0 +1,93 @@
+/*
+Package web serves the browser front end, a free class finder and timetable
+view built into the binary. It is a single page app: paths it does not know
+get index.html when a browser navigates to them, so /timetable can be
+bookmarked.
+*/
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+type asset struct {
+	content     []byte
+	contentType string
+	etag        string
+}
+
+// The binary never changes while it runs, so everything is read and hashed once
+type handler struct {
+	assets map[string]asset
+}
+
+// Handler serves the files under static/ at the root of the site
+func Handler() http.Handler {
+	h := &handler{assets: make(map[string]asset)}
+	err := fs.WalkDir(staticFS, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := staticFS.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(content)
+		}
+		h.assets[strings.TrimPrefix(name, "static")] = asset{
+			content:     content,
+			contentType: contentType,
+			etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+		}
+		return nil
+	})
+	if err != nil {
+		// Can only happen if the embedded files are broken
+		panic(err)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+	if name == "/" {
+		name = "/index.html"
+	}
+	a, ok := h.assets[name]
+	if !ok {
+		// Routes of the app have no extension; only browsers navigating
+		// there get the app, API clients still see a 404
+		if path.Ext(name) != "" || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.NotFound(w, r)
+			return
+		}
+		name = "/index.html"
+		a = h.assets[name]
+	}
+	if name == "/index.html" {
+		// Always revalidate so a new release is picked up on the next load
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
+	w.Header().Set("ETag", a.etag)
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Without a modification time ServeContent relies on the ETag for If-None-Match
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(a.content))
+}
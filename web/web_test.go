@@ -0,0 +1,53 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func get(h http.Handler, path string, accept string, etag string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler()
+
+	rec := get(h, "/", "text/html", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<title>CORA</title>") {
+		t.Fatalf("GET / = %d; want the index page", rec.Code)
+	}
+	if rec.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("index Cache-Control = %q; want no-cache", rec.Header().Get("Cache-Control"))
+	}
+
+	rec = get(h, "/app.js", "", "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") &&
+		!strings.HasPrefix(rec.Header().Get("Content-Type"), "application/javascript") {
+		t.Errorf("GET /app.js = %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec := get(h, "/app.js", "", rec.Header().Get("ETag")); rec.Code != http.StatusNotModified {
+		t.Errorf("GET /app.js with its ETag = %d; want 304", rec.Code)
+	}
+
+	if rec := get(h, "/timetable", "text/html,application/xhtml+xml", ""); rec.Code != http.StatusOK ||
+		!strings.Contains(rec.Body.String(), "<title>CORA</title>") {
+		t.Errorf("browser GET /timetable = %d; want the index page", rec.Code)
+	}
+	if rec := get(h, "/timetable", "application/json", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("API GET /timetable = %d; want 404", rec.Code)
+	}
+	if rec := get(h, "/missing.js", "text/html", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /missing.js = %d; want 404", rec.Code)
+	}
+}